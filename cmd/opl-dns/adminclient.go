@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+)
+
+// adminClient calls the admin API of a running instance.
+type adminClient struct {
+	base   string
+	token  string
+	client *http.Client
+}
+
+// newAdminClient returns a client for the admin interface at addr, an
+// http:// or https:// URL or "unix:" followed by a socket path.
+func newAdminClient(addr, token string) *adminClient {
+	c := &adminClient{
+		base:   strings.TrimSuffix(addr, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		c.base = "http://opl-dns"
+		c.client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+	}
+	return c
+}
+
+// adminAddr returns the admin interface address to use: flagValue if it is
+// set, and otherwise the admin.listen_addr of the configuration file.
+func adminAddr(flagValue string, cfg *config.Config) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	if !cfg.Admin.Enabled {
+		return "", fmt.Errorf("the admin interface is not enabled in the configuration; give -admin")
+	}
+	addr := cfg.Admin.ListenAddr
+	if strings.HasPrefix(addr, "unix:") {
+		return addr, nil
+	}
+	local, err := localAddr(addr)
+	if err != nil {
+		return "", fmt.Errorf("admin.listen_addr: %w", err)
+	}
+	return "http://" + local, nil
+}
+
+// localAddr returns the address to reach a listener bound to addr from the
+// same host: a wildcard address is reached over loopback.
+func localAddr(addr string) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// connectAdmin returns a client for the admin interface of a running
+// instance. addr and token are the -admin and -token flags; the token
+// falls back to $OPL_ADMIN_TOKEN, and anything still missing is read from
+// the configuration file at configPath.
+func connectAdmin(configPath, addr, token string) (*adminClient, error) {
+	if token == "" {
+		token = os.Getenv("OPL_ADMIN_TOKEN")
+	}
+	if addr == "" || token == "" {
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("loading configuration: %w", err)
+		}
+		if addr, err = adminAddr(addr, cfg); err != nil {
+			return nil, err
+		}
+		if token == "" {
+			token = cfg.Admin.AuthToken
+		}
+	}
+	return newAdminClient(addr, token), nil
+}
+
+// do sends a request with body encoded as JSON, unless it is nil, and
+// decodes the response into out, unless it is nil. An error response is
+// returned as an error carrying the API's messages.
+func (c *adminClient) do(ctx context.Context, method, path string, body, out any) error {
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding admin API response: %w", err)
+	}
+	return nil
+}
+
+// send sends a request with body encoded as JSON, unless it is nil, and
+// returns a successful response for the caller to read and close.
+func (c *adminClient) send(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.base+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		var apiErr struct {
+			Errors []string `json:"errors"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) == nil && len(apiErr.Errors) > 0 {
+			return nil, fmt.Errorf("admin API: %s", strings.Join(apiErr.Errors, "; "))
+		}
+		return nil, fmt.Errorf("admin API returned %s", resp.Status)
+	}
+	return resp, nil
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/app"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+)
+
+// benchAllowed is the default mix of domains that should not be blocked.
+var benchAllowed = []string{
+	"example.com", "example.org", "example.net", "wikipedia.org",
+	"debian.org", "kernel.org", "mozilla.org", "python.org",
+	"golang.org", "ietf.org", "w3.org", "openstreetmap.org",
+}
+
+// benchResult is what "opl-dns bench -json" prints.
+type benchResult struct {
+	Server        string         `json:"server"`
+	Network       string         `json:"network"`
+	Concurrency   int            `json:"concurrency"`
+	DurationSec   float64        `json:"duration_seconds"`
+	Queries       int64          `json:"queries"`
+	QPS           float64        `json:"qps"`
+	Blocked       benchClass     `json:"blocked"`
+	Allowed       benchClass     `json:"allowed"`
+	ResponseCodes map[string]int `json:"response_codes"`
+}
+
+// benchClass summarizes the queries for blocked or for allowed domains.
+type benchClass struct {
+	Queries int64 `json:"queries"`
+	Errors  int64 `json:"errors"`
+	// AnsweredBlocked counts answers of 0.0.0.0 or ::, the server's block
+	// response
+	AnsweredBlocked int64        `json:"answered_blocked"`
+	Latency         benchLatency `json:"latency"`
+}
+
+type benchLatency struct {
+	Count  int64   `json:"count"`
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P90Ms  float64 `json:"p90_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+// benchCounter accumulates one class while the benchmark runs.
+type benchCounter struct {
+	latency stats.LatencyHistogram
+
+	mu              sync.Mutex
+	queries         int64
+	errors          int64
+	answeredBlocked int64
+}
+
+func (c *benchCounter) result() benchClass {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return benchClass{
+		Queries:         c.queries,
+		Errors:          c.errors,
+		AnsweredBlocked: c.answeredBlocked,
+		Latency:         benchLatency(c.latency.Stats()),
+	}
+}
+
+// runBench implements "opl-dns bench": it sends a mix of queries for
+// blocked and allowed domains to a DNS server and reports throughput,
+// latency and errors, for sizing hardware.
+func runBench(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("opl-dns bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	server := fs.String("server", "127.0.0.1:53", "DNS server to test")
+	duration := fs.Duration("duration", 10*time.Second, "How long to send queries")
+	concurrency := fs.Int("concurrency", 16, "Queries in flight at once")
+	qps := fs.Int("qps", 0, "Queries per second to send in total; 0 sends as fast as answers arrive")
+	blockedRatio := fs.Float64("blocked-ratio", 0.2, "Fraction of queries for blocked domains")
+	blockedList := fs.String("blocked", "", "Comma-separated blocked domains (default: fetched from the OPL API with -config)")
+	allowedList := fs.String("allowed", strings.Join(benchAllowed, ","), "Comma-separated domains that are not blocked")
+	configPath := fs.String("config", "config.json", "Configuration file used to fetch the blocklist when -blocked is not given")
+	timeout := fs.Duration("timeout", 2*time.Second, "Time to wait for each answer")
+	useTCP := fs.Bool("tcp", false, "Query over TCP instead of UDP")
+	asJSON := fs.Bool("json", false, "Print the result as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: opl-dns bench [flags]\n\nOnly test servers you operate.\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 || *concurrency < 1 || *duration <= 0 || *qps < 0 || *blockedRatio < 0 || *blockedRatio > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	allowed := splitDomains(*allowedList)
+	blocked := splitDomains(*blockedList)
+	if len(blocked) == 0 && *blockedRatio > 0 {
+		var err error
+		if blocked, err = benchBlockedDomains(*configPath); err != nil {
+			fmt.Fprintf(stderr, "Error getting blocked domains: %v; give -blocked or -blocked-ratio 0\n", err)
+			return 1
+		}
+	}
+	if (len(allowed) == 0 && *blockedRatio < 1) || (len(blocked) == 0 && *blockedRatio > 0) {
+		fmt.Fprintln(stderr, "Error: no domains to query")
+		return 2
+	}
+
+	network := "udp"
+	if *useTCP {
+		network = "tcp"
+	}
+	result, err := bench(benchConfig{
+		server:       *server,
+		network:      network,
+		duration:     *duration,
+		concurrency:  *concurrency,
+		qps:          *qps,
+		blockedRatio: *blockedRatio,
+		blocked:      blocked,
+		allowed:      allowed,
+		timeout:      *timeout,
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Fprintf(stdout, "%s\n", data)
+		return 0
+	}
+	printBenchResult(stdout, result)
+	return 0
+}
+
+type benchConfig struct {
+	server       string
+	network      string
+	duration     time.Duration
+	concurrency  int
+	qps          int
+	blockedRatio float64
+	blocked      []string
+	allowed      []string
+	timeout      time.Duration
+}
+
+// bench runs the benchmark described by cfg.
+func bench(cfg benchConfig) (benchResult, error) {
+	client := &dns.Client{Net: cfg.network, Timeout: cfg.timeout}
+	// Fail fast on an unreachable server rather than after the full run
+	probe := new(dns.Msg)
+	if len(cfg.allowed) > 0 {
+		probe.SetQuestion(dns.Fqdn(cfg.allowed[0]), dns.TypeA)
+	} else {
+		probe.SetQuestion(dns.Fqdn(cfg.blocked[0]), dns.TypeA)
+	}
+	if _, _, err := client.Exchange(probe, cfg.server); err != nil {
+		return benchResult{}, fmt.Errorf("no answer from %s: %w", cfg.server, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.duration)
+	defer cancel()
+
+	// With a rate, workers take one token per query
+	var tokens <-chan time.Time
+	if cfg.qps > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(cfg.qps))
+		defer ticker.Stop()
+		tokens = ticker.C
+	}
+
+	var blocked, allowed benchCounter
+	var rcodesMu sync.Mutex
+	rcodes := map[string]int{}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range cfg.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var conn *dns.Conn
+			defer func() {
+				if conn != nil {
+					conn.Close()
+				}
+			}()
+
+			for {
+				if tokens != nil {
+					select {
+					case <-ctx.Done():
+						return
+					case <-tokens:
+					}
+				} else if ctx.Err() != nil {
+					return
+				}
+
+				counter, domains := &allowed, cfg.allowed
+				if rand.Float64() < cfg.blockedRatio {
+					counter, domains = &blocked, cfg.blocked
+				}
+				m := new(dns.Msg)
+				m.SetQuestion(dns.Fqdn(domains[rand.IntN(len(domains))]), dns.TypeA)
+
+				if conn == nil {
+					c, err := client.Dial(cfg.server)
+					if err != nil {
+						counter.mu.Lock()
+						counter.queries++
+						counter.errors++
+						counter.mu.Unlock()
+						time.Sleep(10 * time.Millisecond)
+						continue
+					}
+					conn = c
+				}
+				resp, rtt, err := client.ExchangeWithConn(m, conn)
+				counter.mu.Lock()
+				counter.queries++
+				if err != nil {
+					counter.errors++
+					counter.mu.Unlock()
+					// A timed out or broken connection may deliver a stale
+					// answer to the next query; start a fresh one
+					conn.Close()
+					conn = nil
+					continue
+				}
+				if answeredBlocked(resp) {
+					counter.answeredBlocked++
+				}
+				counter.mu.Unlock()
+				counter.latency.Record(rtt)
+
+				rcodesMu.Lock()
+				rcodes[dns.RcodeToString[resp.Rcode]]++
+				rcodesMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	result := benchResult{
+		Server:        cfg.server,
+		Network:       cfg.network,
+		Concurrency:   cfg.concurrency,
+		DurationSec:   elapsed.Seconds(),
+		Blocked:       blocked.result(),
+		Allowed:       allowed.result(),
+		ResponseCodes: rcodes,
+	}
+	result.Queries = result.Blocked.Queries + result.Allowed.Queries
+	answered := result.Queries - result.Blocked.Errors - result.Allowed.Errors
+	result.QPS = float64(answered) / elapsed.Seconds()
+	return result, nil
+}
+
+// answeredBlocked reports whether resp is the server's block response.
+func answeredBlocked(resp *dns.Msg) bool {
+	for _, rr := range resp.Answer {
+		switch rr := rr.(type) {
+		case *dns.A:
+			return rr.A.Equal(net.IPv4zero)
+		case *dns.AAAA:
+			return rr.AAAA.Equal(net.IPv6zero)
+		}
+	}
+	return false
+}
+
+// benchBlockedDomains fetches the blocklist the configuration selects and
+// returns its domains.
+func benchBlockedDomains(configPath string) ([]string, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	blocklist, err := app.FetchBlocklist(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	for _, item := range blocklist.BlockList {
+		if item.Domain != "" {
+			seen[item.Domain] = true
+		}
+	}
+	return slices.Sorted(maps.Keys(seen)), nil
+}
+
+// splitDomains splits a comma-separated list, dropping empty entries.
+func splitDomains(list string) []string {
+	var domains []string
+	for _, d := range strings.Split(list, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+func printBenchResult(w io.Writer, r benchResult) {
+	fmt.Fprintf(w, "%d queries in %.1fs to %s over %s with %d in flight: %.0f answers/s\n\n",
+		r.Queries, r.DurationSec, r.Server, r.Network, r.Concurrency, r.QPS)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "\tqueries\terrors\tanswered blocked\tp50 ms\tp90 ms\tp99 ms\tmax ms\t")
+	for _, c := range []struct {
+		name string
+		benchClass
+	}{{"blocked", r.Blocked}, {"allowed", r.Allowed}} {
+		if c.Queries == 0 {
+			continue
+		}
+		l := c.Latency
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%.2f\t%.2f\t%.2f\t%.2f\t\n",
+			c.name, c.Queries, c.Errors, c.AnsweredBlocked, l.P50Ms, l.P90Ms, l.P99Ms, l.MaxMs)
+	}
+	tw.Flush()
+
+	if len(r.ResponseCodes) > 0 {
+		var codes []string
+		for _, code := range slices.Sorted(maps.Keys(r.ResponseCodes)) {
+			codes = append(codes, fmt.Sprintf("%s %d", code, r.ResponseCodes[code]))
+		}
+		fmt.Fprintf(w, "\nResponse codes: %s\n", strings.Join(codes, ", "))
+	}
+	if r.Blocked.Queries > 0 && r.Blocked.AnsweredBlocked < r.Blocked.Queries-r.Blocked.Errors {
+		fmt.Fprintln(w, "Some queries for blocked domains were not answered as blocked; check that the server enforces the same blocklist.")
+	}
+}
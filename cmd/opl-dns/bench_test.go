@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	opldns "github.com/online-picket-line/opl-for-dns/pkg/dns"
+)
+
+// startTestUpstream starts a UDP DNS server that answers servfail.test with
+// SERVFAIL, never answers drop.test, answers refused.test with REFUSED and
+// missing.test with NXDOMAIN, and answers anything else with 192.0.2.1.
+func startTestUpstream(t *testing.T) string {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{
+		PacketConn:        pc,
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			switch r.Question[0].Name {
+			case "drop.test.":
+				return
+			case "servfail.test.":
+				m.SetRcode(r, dns.RcodeServerFailure)
+			case "refused.test.":
+				m.SetRcode(r, dns.RcodeRefused)
+			case "missing.test.":
+				m.SetRcode(r, dns.RcodeNameError)
+			default:
+				m.SetReply(r)
+				m.Answer = append(m.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+					A:   net.ParseIP("192.0.2.1"),
+				})
+			}
+			w.WriteMsg(m)
+		}),
+	}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+
+	return pc.LocalAddr().String()
+}
+
+// startTestDNS starts an opl-dns DNS server on 127.0.0.1:0 that blocks the
+// given domains and forwards everything else to the test upstream, and
+// returns its address.
+func startTestDNS(t *testing.T, queryTimeout time.Duration, blocked ...string) string {
+	t.Helper()
+
+	client := api.NewClient("https://api.example.com", "", time.Second)
+	blocklist := &api.Blocklist{}
+	for _, d := range blocked {
+		blocklist.BlockList = append(blocklist.BlockList, api.BlockListItem{URL: "https://" + d, Employer: "Test Corp"})
+	}
+	client.SetBlocklistForTesting(blocklist)
+
+	server, err := opldns.NewServer(
+		"127.0.0.1:0",
+		opldns.PlainUpstreams(startTestUpstream(t)),
+		queryTimeout,
+		client,
+		nil,
+		slog.New(slog.DiscardHandler),
+	)
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	go server.Start()
+	go server.StartTCP()
+	for !server.Serving() {
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	})
+
+	return server.Addr().String()
+}
+
+func TestBenchCounterLatency(t *testing.T) {
+	var c benchCounter
+	if got := c.result().Latency; got != (benchLatency{}) {
+		t.Errorf("Expected no latency before any answer, got %+v", got)
+	}
+
+	for i := 1; i <= 100; i++ {
+		c.latency.Record(time.Duration(i) * time.Millisecond)
+	}
+	got := c.result().Latency
+	if got.Count != 100 || got.MaxMs != 100 {
+		t.Errorf("Expected 100 answers up to 100ms, got %+v", got)
+	}
+	if got.MeanMs < 50 || got.MeanMs > 51 {
+		t.Errorf("Expected a mean of 50.5ms, got %v", got.MeanMs)
+	}
+	// Percentiles come from histogram buckets, accurate to about 12%
+	for _, p := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"p50", got.P50Ms, 50},
+		{"p90", got.P90Ms, 90},
+		{"p99", got.P99Ms, 99},
+	} {
+		if p.got < p.want*0.88 || p.got > p.want*1.12 {
+			t.Errorf("Expected %s near %vms, got %v", p.name, p.want, p.got)
+		}
+	}
+	if !(got.P50Ms <= got.P90Ms && got.P90Ms <= got.P99Ms && got.P99Ms <= got.MaxMs) {
+		t.Errorf("Expected percentiles in order, got %+v", got)
+	}
+}
+
+func TestAnsweredBlocked(t *testing.T) {
+	answer := func(rr string) *dns.Msg {
+		m := new(dns.Msg)
+		if rr != "" {
+			r, err := dns.NewRR(rr)
+			if err != nil {
+				t.Fatalf("NewRR(%q) failed: %v", rr, err)
+			}
+			m.Answer = append(m.Answer, r)
+		}
+		return m
+	}
+
+	tests := []struct {
+		rr   string
+		want bool
+	}{
+		{"blocked.example. 60 IN A 0.0.0.0", true},
+		{"blocked.example. 60 IN AAAA ::", true},
+		{"allowed.test. 60 IN A 192.0.2.1", false},
+		{"allowed.test. 60 IN CNAME other.test.", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := answeredBlocked(answer(tt.rr)); got != tt.want {
+			t.Errorf("answeredBlocked(%q) = %v, want %v", tt.rr, got, tt.want)
+		}
+	}
+}
+
+func TestBench(t *testing.T) {
+	addr := startTestDNS(t, 500*time.Millisecond, "blocked.example")
+
+	result, err := bench(benchConfig{
+		server:       addr,
+		network:      "udp",
+		duration:     500 * time.Millisecond,
+		concurrency:  4,
+		blockedRatio: 0.5,
+		blocked:      []string{"blocked.example"},
+		allowed:      []string{"allowed.test", "servfail.test", "drop.test"},
+		timeout:      100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("bench failed: %v", err)
+	}
+
+	if b := result.Blocked; b.Queries == 0 || b.Errors != 0 || b.AnsweredBlocked != b.Queries {
+		t.Errorf("Expected every blocked query answered blocked, got %+v", b)
+	}
+	// Queries the server does not answer in time are errors, not answers
+	a := result.Allowed
+	if a.Queries == 0 || a.Errors == 0 || a.AnsweredBlocked != 0 {
+		t.Errorf("Expected allowed queries answered unblocked with some timeouts, got %+v", a)
+	}
+	if a.Latency.Count != a.Queries-a.Errors {
+		t.Errorf("Expected latency only for answers, got %d for %d answers", a.Latency.Count, a.Queries-a.Errors)
+	}
+	if result.ResponseCodes["NOERROR"] == 0 || result.ResponseCodes["SERVFAIL"] == 0 {
+		t.Errorf("Expected NOERROR and SERVFAIL answers, got %v", result.ResponseCodes)
+	}
+	var answered int64
+	for _, n := range result.ResponseCodes {
+		answered += int64(n)
+	}
+	if want := result.Queries - result.Blocked.Errors - result.Allowed.Errors; answered != want {
+		t.Errorf("Expected %d response codes, one per answer, got %d", want, answered)
+	}
+	if result.Queries != result.Blocked.Queries+result.Allowed.Queries || result.QPS <= 0 {
+		t.Errorf("Unexpected totals %+v", result)
+	}
+}
+
+func TestBenchUnreachable(t *testing.T) {
+	// Nothing answers on a port just released
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	addr := pc.LocalAddr().String()
+	pc.Close()
+
+	start := time.Now()
+	_, err = bench(benchConfig{
+		server:      addr,
+		network:     "udp",
+		duration:    10 * time.Second,
+		concurrency: 1,
+		allowed:     []string{"allowed.test"},
+		timeout:     100 * time.Millisecond,
+	})
+	if err == nil {
+		t.Fatal("Expected an error for a server that does not answer")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Expected bench to fail before running, took %v", time.Since(start))
+	}
+}
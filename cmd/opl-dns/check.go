@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/app"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+	"github.com/online-picket-line/opl-for-dns/pkg/dns"
+)
+
+// checkResult is what "opl-dns check" reports. It has the same fields as
+// the admin API's GET /api/blocklist/check response.
+type checkResult struct {
+	Domain        string `json:"domain"`
+	Client        string `json:"client,omitempty"`
+	Blocked       bool   `json:"blocked"`
+	Source        string `json:"source,omitempty"`
+	Group         string `json:"group,omitempty"`
+	Employer      string `json:"employer,omitempty"`
+	Pattern       string `json:"pattern,omitempty"`
+	MatchedDomain string `json:"matched_domain,omitempty"`
+	ActionType    string `json:"action_type,omitempty"`
+	Organization  string `json:"organization,omitempty"`
+	Description   string `json:"description,omitempty"`
+	StartDate     string `json:"start_date,omitempty"`
+	ExpiresAt     string `json:"expires_at,omitempty"`
+	MoreInfoURL   string `json:"more_info_url,omitempty"`
+	Explanation   string `json:"explanation"`
+}
+
+// runCheck implements "opl-dns check": it reports whether a domain or URL
+// would be blocked, by which employer and pattern, and why. The answer
+// comes from a running instance's admin API if -admin is given, and
+// otherwise from a fresh copy of the blocklist and the local policy the
+// configuration names.
+func runCheck(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("opl-dns check", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	adminURL := fs.String("admin", "", "Ask the running instance whose admin interface is at this URL or unix:socket path, e.g. http://127.0.0.1:8081")
+	token := fs.String("token", "", "Admin token for -admin (default $OPL_ADMIN_TOKEN)")
+	clientAddr := fs.String("client", "", "Check as the client with this IP address, applying its group")
+	asJSON := fs.Bool("json", false, "Print the result as JSON")
+	config.RegisterFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: opl-dns check [flags] <domain or URL>\n\n")
+		fs.PrintDefaults()
+	}
+
+	// Flags may come before or after the domain
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	rest := fs.Args()
+	if len(rest) > 0 {
+		if err := fs.Parse(rest[1:]); err != nil {
+			return 2
+		}
+	}
+	if len(rest) == 0 || fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	domain := hostOf(rest[0])
+
+	var client netip.Addr
+	if *clientAddr != "" {
+		var err error
+		if client, err = netip.ParseAddr(*clientAddr); err != nil {
+			fmt.Fprintf(stderr, "Invalid -client: %v\n", err)
+			return 2
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	var result checkResult
+	if *adminURL != "" {
+		if *token == "" {
+			*token = os.Getenv("OPL_ADMIN_TOKEN")
+		}
+		var err error
+		if result, err = checkAdmin(ctx, *adminURL, *token, client, domain); err != nil {
+			fmt.Fprintf(stderr, "Error checking %s: %v\n", domain, err)
+			return 1
+		}
+	} else {
+		cfg, err := config.Load(*configPath)
+		if err == nil {
+			err = cfg.ApplyFlags(fs)
+		}
+		if err == nil {
+			err = cfg.Validate()
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "Error loading configuration: %v\n", err)
+			return 1
+		}
+		d, err := app.Lookup(ctx, cfg, client, domain)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error checking %s: %v\n", domain, err)
+			return 1
+		}
+		result = newCheckResult(d, client)
+	}
+
+	if *asJSON {
+		data, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Fprintf(stdout, "%s\n", data)
+		return 0
+	}
+	printCheckResult(stdout, result)
+	return 0
+}
+
+// hostOf returns the host name in s, which may be a bare domain or a URL.
+func hostOf(s string) string {
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+	if u, err := url.Parse(s); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return strings.TrimPrefix(s, "https://")
+}
+
+// checkAdmin asks the admin API at addr how the running instance treats a
+// query for domain from client.
+func checkAdmin(ctx context.Context, addr, token string, client netip.Addr, domain string) (checkResult, error) {
+	query := url.Values{"domain": {domain}}
+	if client.IsValid() {
+		query.Set("client", client.String())
+	}
+	var result checkResult
+	err := newAdminClient(addr, token).do(ctx, http.MethodGet, "/api/blocklist/check?"+query.Encode(), nil, &result)
+	return result, err
+}
+
+// newCheckResult flattens a decision made locally.
+func newCheckResult(d dns.Decision, client netip.Addr) checkResult {
+	result := checkResult{
+		Domain:      d.Domain,
+		Blocked:     d.Blocked,
+		Source:      d.Source,
+		Group:       d.Group,
+		Explanation: d.Explain(),
+	}
+	if client.IsValid() {
+		result.Client = client.String()
+	}
+	if item := d.Item; item != nil {
+		result.Employer = item.Employer
+		result.Pattern = item.URL
+		result.MatchedDomain = item.Domain
+		result.ActionType = item.ActionDetails.ActionType
+		result.Organization = item.ActionDetails.Organization
+		result.Description = item.ActionDetails.Description
+		result.StartDate = item.StartDate
+		result.MoreInfoURL = item.MoreInfoURL
+		if !item.ExpiresAt.IsZero() {
+			result.ExpiresAt = item.ExpiresAt.Format(time.RFC3339)
+		}
+	}
+	return result
+}
+
+func printCheckResult(w io.Writer, r checkResult) {
+	verdict := "allowed"
+	if r.Blocked {
+		verdict = "BLOCKED"
+	}
+	fmt.Fprintf(w, "%s %s: %s\n", verdict, r.Domain, r.Explanation)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, field := range [][2]string{
+		{"client", r.Client},
+		{"group", r.Group},
+		{"employer", r.Employer},
+		{"pattern", r.Pattern},
+		{"matched domain", r.MatchedDomain},
+		{"action", r.ActionType},
+		{"organization", r.Organization},
+		{"description", r.Description},
+		{"started", r.StartDate},
+		{"ends", r.ExpiresAt},
+		{"more info", r.MoreInfoURL},
+	} {
+		if field[1] != "" {
+			fmt.Fprintf(tw, "  %s\t%s\n", field[0], field[1])
+		}
+	}
+	tw.Flush()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/app"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+	"github.com/online-picket-line/opl-for-dns/pkg/remoteconfig"
+)
+
+// runConfig implements "opl-dns config print": it prints the effective
+// configuration, merged from the file, its includes, the cached remote
+// configuration, the environment and the flags, with secrets redacted and
+// each setting's origin.
+func runConfig(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(stderr, "usage: opl-dns config print [-config path] [-json] [setting flags]")
+		return 2
+	}
+
+	fs := flag.NewFlagSet("opl-dns config print", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	asJSON := fs.Bool("json", false, "Print the configuration as a JSON configuration file, without origins")
+	config.RegisterFlags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	overrides := func(c *config.Config) error {
+		return c.ApplyFlags(fs)
+	}
+	cfg, err := app.LoadConfig(*configPath, nil, overrides)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error loading configuration: %v\n", err)
+		return 1
+	}
+
+	// The remote configuration is not fetched; the cached copy is what the
+	// server would start with if the publisher were unreachable
+	var remote *remoteconfig.Document
+	if cfg.RemoteConfig.URL != "" {
+		source, err := app.NewRemoteSource(cfg)
+		if err == nil {
+			remote, err = source.Cached()
+		}
+		if err != nil {
+			fmt.Fprintf(stderr, "Remote configuration not included: %v\n", err)
+		} else if cfg, err = app.LoadConfig(*configPath, remote, overrides); err != nil {
+			fmt.Fprintf(stderr, "Error loading configuration: %v\n", err)
+			return 1
+		}
+	}
+
+	redacted := cfg.Redacted()
+	if *asJSON {
+		data, _ := json.MarshalIndent(redacted, "", "  ")
+		fmt.Fprintf(stdout, "%s\n", data)
+		return 0
+	}
+
+	var remoteBody []byte
+	if remote != nil {
+		remoteBody = remote.Body
+	}
+	origins, err := config.Origins(*configPath, remoteBody, fs)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error loading configuration: %v\n", err)
+		return 1
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 8, 2, ' ', 0)
+	for _, s := range redacted.Settings() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", s.Key, s.Value, origins[s.Key])
+	}
+	tw.Flush()
+	return 0
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+)
+
+// runCtl implements "opl-dns ctl": runtime operations on a running
+// instance through its admin API.
+func runCtl(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("opl-dns ctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "config.json", "Configuration file naming the admin address and token")
+	adminURL := fs.String("admin", "", "Admin interface URL or unix:socket path (default from admin.listen_addr)")
+	token := fs.String("token", "", "Admin token (default $OPL_ADMIN_TOKEN, then admin.auth_token)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), `Usage: opl-dns ctl [flags] <operation>
+
+Operations:
+  reload               Reload the configuration file, as SIGHUP does
+  refresh              Fetch the blocklist now, as SIGUSR1 does
+  config               Print the configuration in effect, secrets redacted
+  set key=value ...    Change settings that apply without a restart, until
+                       the next reload or restart
+  versions             List the kept blocklist versions
+  rollback             Enforce the blocklist version before the current one
+  pin <hash>           Enforce a kept blocklist version, given by a unique
+                       prefix of its hash, instead of fetched blocklists
+  unpin                Enforce fetched blocklists again
+
+Flags:
+`)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	op, opArgs := fs.Arg(0), fs.Args()[1:]
+
+	client, err := connectAdmin(*configPath, *adminURL, *token)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	switch op {
+	case "reload":
+		var result struct {
+			Applied         []string `json:"applied"`
+			RestartRequired []string `json:"restart_required"`
+		}
+		if err = client.do(ctx, http.MethodPost, "/api/config/reload", nil, &result); err == nil {
+			printSettings(stdout, "Applied", result.Applied)
+			printSettings(stdout, "Restart required for", result.RestartRequired)
+		}
+	case "refresh":
+		if err = client.do(ctx, http.MethodPost, "/api/blocklist/refresh", nil, nil); err == nil {
+			fmt.Fprintln(stdout, "Blocklist refresh requested")
+		}
+	case "config":
+		var cfg json.RawMessage
+		if err = client.do(ctx, http.MethodGet, "/api/config", nil, &cfg); err == nil {
+			var out bytes.Buffer
+			if err = json.Indent(&out, cfg, "", "  "); err == nil {
+				fmt.Fprintln(stdout, out.String())
+			}
+		}
+	case "set":
+		var patch map[string]any
+		if patch, err = settingsPatch(opArgs); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return 2
+		}
+		var result struct {
+			Applied []string `json:"applied"`
+		}
+		if err = client.do(ctx, http.MethodPatch, "/api/config", patch, &result); err == nil {
+			printSettings(stdout, "Applied", result.Applied)
+		}
+	case "versions":
+		var result struct {
+			Current  string                 `json:"current"`
+			Pinned   string                 `json:"pinned"`
+			Versions []api.BlocklistVersion `json:"versions"`
+		}
+		if err = client.do(ctx, http.MethodGet, "/api/blocklist/versions", nil, &result); err == nil {
+			printVersions(stdout, result.Versions, result.Current, result.Pinned)
+		}
+	case "rollback", "pin":
+		path, body := "/api/blocklist/rollback", any(nil)
+		if op == "pin" {
+			if len(opArgs) != 1 {
+				fmt.Fprintln(stderr, "Error: pin needs one hash")
+				return 2
+			}
+			path, body = "/api/blocklist/pin", map[string]string{"hash": opArgs[0]}
+		}
+		var v api.BlocklistVersion
+		if err = client.do(ctx, http.MethodPost, path, body, &v); err == nil {
+			fmt.Fprintf(stdout, "Pinned blocklist version %s from %s; run \"opl-dns ctl unpin\" to enforce fetched blocklists again\n",
+				v.Hash, v.FetchedAt.Local().Format(time.DateTime))
+		}
+	case "unpin":
+		if err = client.do(ctx, http.MethodDelete, "/api/blocklist/pin", nil, nil); err == nil {
+			fmt.Fprintln(stdout, "Unpinned; the newest fetched blocklist is enforced")
+		}
+	default:
+		fmt.Fprintf(stderr, "Unknown operation %q\n\n", op)
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// settingsPatch turns key=value arguments, such as logging.level=debug,
+// into a partial configuration document. A value that is valid JSON is
+// taken as JSON, so lists and numbers can be given; anything else is a
+// string.
+func settingsPatch(args []string) (map[string]any, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("set needs at least one key=value")
+	}
+	patch := map[string]any{}
+	for _, arg := range args {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%q is not key=value", arg)
+		}
+
+		parts := strings.Split(key, ".")
+		section := patch
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := section[part].(map[string]any)
+			if !ok {
+				next = map[string]any{}
+				section[part] = next
+			}
+			section = next
+		}
+		if json.Valid([]byte(value)) {
+			section[parts[len(parts)-1]] = json.RawMessage(value)
+		} else {
+			section[parts[len(parts)-1]] = value
+		}
+	}
+	return patch, nil
+}
+
+func printVersions(w io.Writer, versions []api.BlocklistVersion, current, pinned string) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "\tHASH\tFETCHED\tEMPLOYERS\tURLS")
+	for _, v := range versions {
+		var mark []string
+		if v.Hash == current {
+			mark = append(mark, "current")
+		}
+		if v.Hash == pinned {
+			mark = append(mark, "pinned")
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\n", strings.Join(mark, ","), v.Hash[:min(12, len(v.Hash))],
+			v.FetchedAt.Local().Format(time.DateTime), v.Employers, v.URLs)
+	}
+	tw.Flush()
+}
+
+func printSettings(w io.Writer, label string, settings []string) {
+	if len(settings) > 0 {
+		fmt.Fprintf(w, "%s: %s\n", label, strings.Join(settings, ", "))
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// runDiag implements "opl-dns diag": it downloads a diagnostics bundle
+// from a running instance for attaching to a bug report.
+func runDiag(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("opl-dns diag", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "config.json", "Configuration file naming the admin address and token")
+	adminURL := fs.String("admin", "", "Admin interface URL or unix:socket path (default from admin.listen_addr)")
+	token := fs.String("token", "", "Admin token (default $OPL_ADMIN_TOKEN, then admin.auth_token)")
+	output := fs.String("output", "", "File to write the bundle to, or - for stdout (default opl-dns-diag-<time>.tar.gz)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: opl-dns diag [flags]\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	client, err := connectAdmin(*configPath, *adminURL, *token)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	resp, err := client.send(ctx, http.MethodGet, "/api/diag", nil)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer resp.Body.Close()
+
+	if *output == "-" {
+		if _, err := io.Copy(stdout, resp.Body); err != nil {
+			fmt.Fprintf(stderr, "Error: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+
+	path := *output
+	if path == "" {
+		path = "opl-dns-diag-" + time.Now().UTC().Format("20060102-150405") + ".tar.gz"
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	_, err = io.Copy(f, resp.Body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		fmt.Fprintf(stderr, "Error writing %s: %v\n", path, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "Wrote %s; review it before sharing, as the logs may name clients and domains\n", path)
+	return 0
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/app"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+	"github.com/online-picket-line/opl-for-dns/pkg/rpz"
+)
+
+// exportFormats lists the formats "opl-dns export" writes.
+var exportFormats = []string{"domains", "hosts", "rpz"}
+
+// runExport implements "opl-dns export": it fetches the blocklist the
+// configuration selects and writes the domains it blocks to stdout, for
+// resolvers and firewalls that cannot use opl-dns directly.
+func runExport(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("opl-dns export", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	format := fs.String("format", "domains", "Output format: domains (one per line), hosts (an /etc/hosts file answering 0.0.0.0) or rpz (a response policy zone file named by rpz.zone, answering as rpz.action)")
+	config.RegisterFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: opl-dns export [flags] > file\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 || !slices.Contains(exportFormats, *format) {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err == nil {
+		err = cfg.ApplyFlags(fs)
+	}
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "Error loading configuration: %v\n", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	blocklist, err := app.FetchBlocklist(ctx, cfg)
+	if err != nil {
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	if err := writeExport(stdout, *format, cfg, blocklist, time.Now()); err != nil {
+		fmt.Fprintf(stderr, "Error writing %s: %v\n", *format, err)
+		return 1
+	}
+	return 0
+}
+
+// writeExport writes the domains blocklist blocks at now to w in format.
+func writeExport(w io.Writer, format string, cfg *config.Config, blocklist *api.Blocklist, now time.Time) error {
+	if format == "rpz" {
+		return rpz.WriteZone(w, rpz.Config{
+			Zone:   cfg.RPZ.Zone,
+			Action: rpz.Action(cfg.RPZ.Action),
+			TTL:    cfg.RPZ.TTL.Duration,
+		}, blocklist, now)
+	}
+
+	bw := bufio.NewWriter(w)
+	if format == "hosts" {
+		fmt.Fprintf(bw, "# OPL blocklist exported by opl-dns at %s\n", now.UTC().Format(time.RFC3339))
+	}
+	for _, d := range exportDomains(blocklist, now) {
+		if format == "hosts" {
+			fmt.Fprintf(bw, "0.0.0.0 %s\n:: %s\n", d, d)
+		} else {
+			fmt.Fprintln(bw, d)
+		}
+	}
+	return bw.Flush()
+}
+
+// exportDomains returns the sorted, unique domains blocklist blocks at now.
+func exportDomains(blocklist *api.Blocklist, now time.Time) []string {
+	var domains []string
+	for _, item := range blocklist.BlockList {
+		if d := strings.ToLower(strings.TrimSuffix(item.Domain, ".")); d != "" && !item.Expired(now) {
+			domains = append(domains, d)
+		}
+	}
+	slices.Sort(domains)
+	return slices.Compact(domains)
+}
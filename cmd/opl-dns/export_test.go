@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+)
+
+func TestWriteExport(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	blocklist := &api.Blocklist{BlockList: []api.BlockListItem{
+		{Domain: "Shop.Example.com"},
+		{Domain: "acme.example"},
+		{Domain: "acme.example"},
+		{Domain: "ended.example", ExpiresAt: now.Add(-time.Minute)},
+	}}
+	cfg := config.DefaultConfig()
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{"domains", []string{"acme.example", "shop.example.com"}},
+		{"hosts", []string{"# OPL blocklist", "0.0.0.0 acme.example", ":: acme.example", "0.0.0.0 shop.example.com", ":: shop.example.com"}},
+		{"rpz", []string{"$ORIGIN opl.rpz.", "opl.rpz.", "opl.rpz.", "acme.example.opl.rpz.", "acme.example.opl.rpz.", "*.acme.example.opl.rpz."}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeExport(&buf, tt.format, cfg, blocklist, now); err != nil {
+				t.Fatalf("writeExport failed: %v", err)
+			}
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if len(lines) < len(tt.want) {
+				t.Fatalf("Expected at least %d lines, got %q", len(tt.want), buf.String())
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(lines[i], want) {
+					t.Errorf("Expected line %d to start with %q, got %q", i+1, want, lines[i])
+				}
+			}
+			if strings.Contains(buf.String(), "ended.example") {
+				t.Errorf("Expected ended actions left out, got %q", buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+)
+
+// runHealthcheck implements "opl-dns healthcheck": it resolves a name
+// through the local DNS listener and asks the admin interface for /health,
+// and exits non-zero if either fails. It is meant for container health
+// checks and exec probes, where an open port says little about whether
+// queries get answered.
+func runHealthcheck(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("opl-dns healthcheck", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	configPath := fs.String("config", "config.json", "Configuration file naming the DNS and admin addresses")
+	dnsAddr := fs.String("dns", "", "DNS listener to query (default from dns.listen_addr; \"off\" skips the query)")
+	adminURL := fs.String("admin", "", "Admin interface URL or unix:socket path (default from admin.listen_addr; \"off\" skips /health)")
+	domain := fs.String("domain", "example.com", "Name to resolve")
+	timeout := fs.Duration("timeout", 5*time.Second, "Time allowed for each check")
+	quiet := fs.Bool("quiet", false, "Print only failures")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: opl-dns healthcheck [flags]\n\n")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+
+	// The configuration is only needed for addresses not given as flags
+	if *dnsAddr == "" || *adminURL == "" {
+		cfg, err := config.Load(*configPath)
+		if err != nil {
+			fmt.Fprintf(stderr, "Error loading configuration: %v\n", err)
+			return 1
+		}
+		if *dnsAddr == "" {
+			*dnsAddr = "off"
+			if cfg.DNS.Enabled {
+				if *dnsAddr, err = localAddr(cfg.DNS.ListenAddr); err != nil {
+					fmt.Fprintf(stderr, "Error: dns.listen_addr: %v\n", err)
+					return 1
+				}
+			}
+		}
+		if *adminURL == "" {
+			*adminURL = "off"
+			if cfg.Admin.Enabled {
+				if *adminURL, err = adminAddr("", cfg); err != nil {
+					fmt.Fprintf(stderr, "Error: %v\n", err)
+					return 1
+				}
+			}
+		}
+	}
+	if *dnsAddr == "off" && *adminURL == "off" {
+		fmt.Fprintln(stderr, "Error: nothing to check; DNS and the admin interface are both off")
+		return 2
+	}
+
+	failed := false
+	report := func(name string, err error) {
+		switch {
+		case err != nil:
+			failed = true
+			fmt.Fprintf(stderr, "%s: %v\n", name, err)
+		case !*quiet:
+			fmt.Fprintf(stdout, "%s: ok\n", name)
+		}
+	}
+	if *dnsAddr != "off" {
+		report("dns "+*dnsAddr, checkResolve(*dnsAddr, *domain, *timeout))
+	}
+	if *adminURL != "off" {
+		report("admin /health", checkAdminHealth(*adminURL, *timeout))
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// checkResolve asks the DNS server at addr for domain's A record. NXDOMAIN
+// is an answer too; SERVFAIL, REFUSED and no answer at all are failures.
+func checkResolve(addr, domain string, timeout time.Duration) error {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(domain), dns.TypeA)
+	client := &dns.Client{Timeout: timeout}
+	resp, _, err := client.Exchange(m, addr)
+	if err != nil {
+		return err
+	}
+	switch resp.Rcode {
+	case dns.RcodeSuccess, dns.RcodeNameError:
+		return nil
+	}
+	return fmt.Errorf("%s answered %s", domain, dns.RcodeToString[resp.Rcode])
+}
+
+// checkAdminHealth fetches /health, which needs no token, and fails unless
+// it returns 200. A degraded server still answers queries, so it passes.
+func checkAdminHealth(addr string, timeout time.Duration) error {
+	c := newAdminClient(addr, "")
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base+"/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var health struct {
+		Status   string   `json:"status"`
+		Problems []string `json:"problems"`
+	}
+	json.NewDecoder(resp.Body).Decode(&health)
+	if resp.StatusCode != http.StatusOK {
+		if len(health.Problems) > 0 {
+			return fmt.Errorf("%s: %s", health.Status, strings.Join(health.Problems, "; "))
+		}
+		return fmt.Errorf("returned %s", resp.Status)
+	}
+	return nil
+}
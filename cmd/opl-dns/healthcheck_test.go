@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckResolve(t *testing.T) {
+	addr := startTestDNS(t, 2*time.Second, "blocked.example")
+
+	tests := []struct {
+		domain  string
+		wantErr string
+	}{
+		{"allowed.test", ""},
+		{"blocked.example", ""},
+		{"missing.test", ""},
+		{"servfail.test", "SERVFAIL"},
+		{"refused.test", "REFUSED"},
+		{"drop.test", "timeout"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			err := checkResolve(addr, tt.domain, 200*time.Millisecond)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Expected %s to pass, got %v", tt.domain, err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Expected %s to fail with %q, got %v", tt.domain, tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestCheckAdminHealth(t *testing.T) {
+	health := func(code int, body map[string]any) string {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/health" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(code)
+			json.NewEncoder(w).Encode(body)
+		}))
+		t.Cleanup(server.Close)
+		return server.URL
+	}
+
+	// Nothing listens on a port just released
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	unreachable := "http://" + ln.Addr().String()
+	ln.Close()
+
+	tests := []struct {
+		name    string
+		addr    string
+		wantErr string
+	}{
+		{"healthy", health(http.StatusOK, map[string]any{"status": "healthy"}), ""},
+		{"degraded", health(http.StatusOK, map[string]any{"status": "degraded", "problems": []string{"blocklist is stale"}}), ""},
+		{"unhealthy", health(http.StatusServiceUnavailable, map[string]any{"status": "unhealthy", "problems": []string{"no upstream answers"}}), "no upstream answers"},
+		{"unhealthy without problems", health(http.StatusServiceUnavailable, nil), "503"},
+		{"unreachable", unreachable, "connection refused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAdminHealth(tt.addr, time.Second)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Expected the check to pass, got %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Expected the check to fail with %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRunHealthcheck(t *testing.T) {
+	dnsAddr := startTestDNS(t, 2*time.Second)
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"healthy"}`))
+	}))
+	defer healthy.Close()
+	unhealthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unhealthy.Close()
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"both pass", []string{"-dns", dnsAddr, "-admin", healthy.URL, "-domain", "allowed.test"}, 0},
+		{"dns only", []string{"-dns", dnsAddr, "-admin", "off", "-domain", "missing.test"}, 0},
+		{"dns fails", []string{"-dns", dnsAddr, "-admin", healthy.URL, "-domain", "servfail.test"}, 1},
+		{"admin fails", []string{"-dns", dnsAddr, "-admin", unhealthy.URL, "-domain", "allowed.test"}, 1},
+		{"nothing to check", []string{"-dns", "off", "-admin", "off"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"-timeout", "500ms"}, tt.args...)
+			if got := runHealthcheck(args, &stdout, &stderr); got != tt.want {
+				t.Errorf("Expected exit code %d, got %d (stdout %q, stderr %q)", tt.want, got, stdout.String(), stderr.String())
+			}
+		})
+	}
+}
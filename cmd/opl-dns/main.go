@@ -2,19 +2,14 @@
 package main
 
 import (
-	"context"
 	"flag"
 	"fmt"
-	"log/slog"
+	"io"
 	"os"
-	"os/signal"
 	"strings"
-	"syscall"
-	"time"
 
-	"github.com/online-picket-line/opl-for-dns/pkg/api"
 	"github.com/online-picket-line/opl-for-dns/pkg/config"
-	"github.com/online-picket-line/opl-for-dns/pkg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/remoteconfig"
 	"github.com/online-picket-line/opl-for-dns/pkg/stats"
 )
 
@@ -23,217 +18,188 @@ var (
 	buildTime = "unknown"
 )
 
+// command is an opl-dns subcommand. run gets the arguments after the
+// subcommand name and returns the exit status.
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) int
+}
+
+// commands lists the subcommands in the order "opl-dns help" shows them.
+var commands = []command{
+	{"serve", "Run the DNS server (the default)", runServe},
+	{"validate", "Check a configuration before deploying it", func(args []string) int { return runValidate(args, os.Stdout) }},
+	{"check", "Report whether a domain or URL would be blocked, and why", func(args []string) int { return runCheck(args, os.Stdout, os.Stderr) }},
+	{"export", "Write the blocked domains as a list, hosts file or RPZ zone file", func(args []string) int { return runExport(args, os.Stdout, os.Stderr) }},
+	{"ctl", "Control a running server through its admin API", func(args []string) int { return runCtl(args, os.Stdout, os.Stderr) }},
+	{"diag", "Save a diagnostics bundle from a running server for a bug report", func(args []string) int { return runDiag(args, os.Stdout, os.Stderr) }},
+	{"healthcheck", "Exit non-zero unless the local server answers queries and reports healthy", func(args []string) int { return runHealthcheck(args, os.Stdout, os.Stderr) }},
+	{"bench", "Measure how many queries a DNS server answers, and how fast", func(args []string) int { return runBench(args, os.Stdout, os.Stderr) }},
+	{"config", "Print the effective configuration (config print)", func(args []string) int { return runConfig(args, os.Stdout, os.Stderr) }},
+	{"generate-config", "Write the default configuration or a preset", runGenerateConfig},
+	{"generate-signing-key", "Write a new Ed25519 signing key and print its public key", runGenerateSigningKey},
+	{"sign-config", "Sign a remote configuration document", runSignConfig},
+	{"env", "List the environment variables that override settings", runEnv},
+	{"version", "Show version information", runVersion},
+}
+
 func main() {
-	// Parse command line flags
-	configPath := flag.String("config", "config.json", "Path to configuration file")
-	showVersion := flag.Bool("version", false, "Show version information")
-	generateConfig := flag.Bool("generate-config", false, "Generate example configuration file")
-	flag.Parse()
-
-	if *showVersion {
-		fmt.Printf("OPL DNS Server v%s (built %s)\n", version, buildTime)
+	if len(os.Args) > 1 && os.Args[1] == "help" {
+		usage(os.Stdout)
 		os.Exit(0)
 	}
-
-	if *generateConfig {
-		cfg := config.DefaultConfig()
-		if err := cfg.Save("config.example.json"); err != nil {
-			fmt.Fprintf(os.Stderr, "Error generating config: %v\n", err)
-			os.Exit(1)
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		for _, c := range commands {
+			if c.name == os.Args[1] {
+				os.Exit(c.run(os.Args[2:]))
+			}
 		}
-		fmt.Println("Generated config.example.json")
-		os.Exit(0)
+		fmt.Fprintf(os.Stderr, "opl-dns: unknown command %q\n\n", os.Args[1])
+		usage(os.Stderr)
+		os.Exit(2)
 	}
+	os.Exit(runLegacy(os.Args[1:]))
+}
 
-	// Load configuration
-	cfg, err := config.Load(*configPath)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
-		os.Exit(1)
-	}
-
-	// Setup logging
-	var logLevel slog.Level
-	switch cfg.Logging.Level {
-	case "debug":
-		logLevel = slog.LevelDebug
-	case "warn":
-		logLevel = slog.LevelWarn
-	case "error":
-		logLevel = slog.LevelError
-	default:
-		logLevel = slog.LevelInfo
-	}
-
-	var handler slog.Handler
-	if cfg.Logging.Format == "json" {
-		handler = slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel})
-	} else {
-		handler = slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel})
-	}
-	logger := slog.New(handler)
-
-	logger.Info("Starting OPL DNS Server", "version", version)
-
-	// Validate configuration
-	if err := cfg.Validate(); err != nil {
-		logger.Error("Invalid configuration", "error", err)
-		os.Exit(1)
-	}
-
-	// Create API client
-	apiClient := api.NewClient(
-		cfg.API.BaseURL,
-		cfg.API.APIKey,
-		cfg.API.Timeout.Duration,
-	)
-
-	// Create stats collector
-	statsCollector := stats.NewCollector()
-
-	// Create DNS server
-	dnsServer, err := dns.NewServer(
-		cfg.DNS.ListenAddr,
-		cfg.DNS.UpstreamDNS,
-		cfg.DNS.QueryTimeout.Duration,
-		apiClient,
-		statsCollector,
-		logger.With("component", "dns"),
-	)
-	if err != nil {
-		logger.Error("Error creating DNS server", "error", err)
-		os.Exit(1)
-	}
-
-	// Context for shutdown
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// Initial blocklist fetch with retries
-	logger.Info("Fetching initial blocklist...")
-	for attempt := 1; attempt <= 10; attempt++ {
-		if _, err := apiClient.FetchBlocklist(ctx); err != nil {
-			logger.Warn("Error fetching initial blocklist", "error", err, "attempt", attempt, "maxAttempts", 10)
-			if attempt < 10 {
-				delay := time.Duration(attempt) * 3 * time.Second
-				if delay > 30*time.Second {
-					delay = 30 * time.Second
-				}
-				logger.Info("Retrying blocklist fetch...", "delay", delay)
-				select {
-				case <-time.After(delay):
-				case <-ctx.Done():
-					break
-				}
-			}
-		} else {
-			blocklist := apiClient.GetCachedBlocklist()
-			if blocklist != nil {
-				logger.Info("Blocklist loaded", "urls", blocklist.TotalURLs, "employers", len(blocklist.Employers))
-			}
-			break
-		}
+// runLegacy handles a command line without a subcommand, which serves as
+// "opl-dns serve" does. The flags that selected other modes before there
+// were subcommands still work.
+func runLegacy(args []string) int {
+	fs := flag.NewFlagSet("opl-dns", flag.ContinueOnError)
+	fs.Usage = func() {
+		usage(fs.Output())
+		fmt.Fprintf(fs.Output(), "\nFlags:\n")
+		fs.PrintDefaults()
+	}
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	showVersion := fs.Bool("version", false, "Same as \"opl-dns version\"")
+	generateConfig := fs.Bool("generate-config", false, "Same as \"opl-dns generate-config\"")
+	preset := fs.String("preset", "", "Same as \"opl-dns generate-config -preset\"")
+	output := fs.String("output", "config.example.json", "Path written by -generate-config and -preset")
+	generateSigningKey := fs.String("generate-signing-key", "", "Same as \"opl-dns generate-signing-key\"")
+	listEnv := fs.Bool("list-env", false, "Same as \"opl-dns env\"")
+	signConfig := fs.String("sign-config", "", "Same as \"opl-dns sign-config\"")
+	signingKey := fs.String("signing-key", "", "Ed25519 private key used by -sign-config")
+	config.RegisterFlags(fs)
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
 	}
 
-	// Start blocklist refresh goroutine
-	go func() {
-		ticker := time.NewTicker(cfg.API.RefreshInterval.Duration)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				logger.Debug("Refreshing blocklist...")
-				if _, err := apiClient.FetchBlocklist(ctx); err != nil {
-					logger.Error("Error refreshing blocklist", "error", err)
-				} else {
-					blocklist := apiClient.GetCachedBlocklist()
-					if blocklist != nil {
-						logger.Debug("Blocklist refreshed", "urls", blocklist.TotalURLs)
-					}
-				}
-			}
-		}
-	}()
-
-	// Start stats reporter goroutine if enabled
-	if cfg.Stats.Enabled {
-		// Determine instance ID
-		instanceID := cfg.Stats.InstanceID
-		if instanceID == "" {
-			if hostname, err := os.Hostname(); err == nil {
-				instanceID = hostname
-			} else {
-				instanceID = "opl-dns-unknown"
-			}
-		}
+	switch {
+	case *showVersion:
+		return runVersion(nil)
+	case *listEnv:
+		return runEnv(nil)
+	case *signConfig != "":
+		return runSignConfig([]string{"-signing-key", *signingKey, *signConfig})
+	case *generateConfig || *preset != "":
+		return runGenerateConfig([]string{"-preset", *preset, "-output", *output})
+	case *generateSigningKey != "":
+		return runGenerateSigningKey([]string{*generateSigningKey})
+	}
+	return serve(*configPath, fs)
+}
 
-		// Determine report URL
-		reportURL := cfg.Stats.ReportURL
-		if reportURL == "" {
-			reportURL = strings.TrimSuffix(cfg.API.BaseURL, "/") + "/dns-stats/report"
-		}
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: opl-dns [command] [flags]\n\nCommands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-22s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "  %-22s %s\n", "help", "Show this help")
+	fmt.Fprintf(w, "\nRun \"opl-dns <command> -h\" for a command's flags.\n")
+}
 
-		reporter := stats.NewReporter(stats.ReporterConfig{
-			Collector:  statsCollector,
-			InstanceID: instanceID,
-			Version:    version,
-			ReportURL:  reportURL,
-			APIKey:     cfg.API.APIKey,
-			Interval:   cfg.Stats.ReportInterval.Duration,
-			Logger:     logger.With("component", "stats"),
-			GetBlocklistSize: func() (int, int) {
-				blocklist := apiClient.GetCachedBlocklist()
-				if blocklist == nil {
-					return 0, 0
-				}
-				return blocklist.TotalURLs, len(blocklist.Employers)
-			},
-			GetLastRefresh: func() time.Time {
-				return apiClient.LastFetchTime()
-			},
-		})
-
-		go reporter.Start(ctx)
-		logger.Info("Stats reporting enabled", "instanceId", instanceID, "interval", cfg.Stats.ReportInterval.Duration)
-	}
-
-	// Start servers
-	errChan := make(chan error, 2)
-
-	// Start DNS server (UDP)
-	go func() {
-		if err := dnsServer.Start(); err != nil {
-			errChan <- fmt.Errorf("DNS server (UDP): %w", err)
-		}
-	}()
+func runVersion([]string) int {
+	fmt.Printf("OPL DNS Server v%s (built %s)\n", version, buildTime)
+	return 0
+}
 
-	// Start DNS server (TCP)
-	go func() {
-		if err := dnsServer.StartTCP(); err != nil {
-			errChan <- fmt.Errorf("DNS server (TCP): %w", err)
+func runEnv([]string) int {
+	for _, v := range config.EnvVars() {
+		if v.Alias != "" {
+			fmt.Printf("%s\t%s (also %s)\n", v.Name, v.Key, v.Alias)
+		} else {
+			fmt.Printf("%s\t%s\n", v.Name, v.Key)
 		}
-	}()
+	}
+	return 0
+}
+
+func runGenerateConfig(args []string) int {
+	fs := flag.NewFlagSet("opl-dns generate-config", flag.ContinueOnError)
+	preset := fs.String("preset", "", "Generate the configuration for a deployment preset ("+strings.Join(config.PresetNames(), ", ")+")")
+	output := fs.String("output", "config.example.json", "Path to write")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
 
-	// Wait for signals or errors
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	cfg := config.DefaultConfig()
+	if *preset != "" {
+		var err error
+		if cfg, err = config.Preset(*preset); err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating config: %v\n", err)
+			return 1
+		}
+	}
+	if err := cfg.Save(*output); err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating config: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Generated %s\n", *output)
+	return 0
+}
 
-	select {
-	case sig := <-sigChan:
-		logger.Info("Received signal, shutting down...", "signal", sig)
-	case err := <-errChan:
-		logger.Error("Server error", "error", err)
+func runGenerateSigningKey(args []string) int {
+	fs := flag.NewFlagSet("opl-dns generate-signing-key", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: opl-dns generate-signing-key <path>\n")
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
 	}
 
-	// Cancel context to stop background goroutines
-	cancel()
+	path := fs.Arg(0)
+	publicKey, err := stats.GenerateSigningKey(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error generating signing key: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Wrote %s. Register this public key with the OPL backend:\n%s", path, publicKey)
+	return 0
+}
 
-	// Shutdown servers
-	logger.Info("Stopping servers...")
-	dnsServer.Stop()
+func runSignConfig(args []string) int {
+	fs := flag.NewFlagSet("opl-dns sign-config", flag.ContinueOnError)
+	signingKey := fs.String("signing-key", "", "Ed25519 private key, as written by generate-signing-key")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: opl-dns sign-config -signing-key <key> <file>\n\nPrints the %s header value for a remote configuration file.\n\n", remoteconfig.HeaderSignature)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
 
-	logger.Info("Shutdown complete")
+	key, err := remoteconfig.LoadPrivateKey(*signingKey)
+	if err == nil {
+		var body []byte
+		if body, err = os.ReadFile(fs.Arg(0)); err == nil {
+			fmt.Println(remoteconfig.Sign(key, body))
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error signing configuration: %v\n", err)
+		return 1
+	}
+	return 0
 }
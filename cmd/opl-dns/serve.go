@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/app"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+	"github.com/online-picket-line/opl-for-dns/pkg/remoteconfig"
+)
+
+// runServe implements "opl-dns serve".
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("opl-dns serve", flag.ContinueOnError)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	config.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	return serve(*configPath, fs)
+}
+
+// serve runs the server with the configuration at configPath and the
+// settings flags given on fs until it is signalled to stop, and returns the
+// exit status.
+func serve(configPath string, fs *flag.FlagSet) int {
+	cfg, err := config.Load(configPath)
+	if err == nil {
+		err = cfg.ApplyFlags(fs)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading configuration: %v\n", err)
+		return 1
+	}
+
+	logLevel := new(slog.LevelVar)
+	logBuffer := app.NewLogBuffer(app.DefaultLogBufferLines)
+	logger, logOutput, err := app.OpenLogger(cfg.Logging, logBuffer, logLevel)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error opening log output: %v\n", err)
+		return 1
+	}
+	defer func() { logOutput.Close() }()
+	overrides := func(c *config.Config) error {
+		return c.ApplyFlags(fs)
+	}
+
+	var remote *remoteconfig.Source
+	if cfg.RemoteConfig.URL != "" {
+		if remote, err = app.NewRemoteSource(cfg); err == nil {
+			cfg, err = app.BootstrapRemote(context.Background(), configPath, remote, overrides, logger)
+		}
+		if err != nil {
+			logger.Error("Error loading remote configuration", "error", err)
+			return 1
+		}
+		// The remote configuration may change the logging settings
+		remoteLogger, remoteOutput, err := app.OpenLogger(cfg.Logging, logBuffer, logLevel)
+		if err != nil {
+			logger.Error("Error opening log output", "error", err)
+			return 1
+		}
+		logOutput.Close()
+		logger, logOutput = remoteLogger, remoteOutput
+	}
+
+	// Registered credentials replace the configured ones, now and on every
+	// reload
+	registered, err := app.Register(context.Background(), cfg, version, logger)
+	if err != nil {
+		logger.Error("Error registering with the OPL backend", "error", err)
+		return 1
+	}
+	if registered != nil {
+		registered.Apply(cfg)
+		fileOverrides := overrides
+		overrides = func(c *config.Config) error {
+			if err := fileOverrides(c); err != nil {
+				return err
+			}
+			return registered.Apply(c)
+		}
+	}
+
+	application, err := app.New(cfg, app.Options{
+		Logger:     logger,
+		LogLevel:   logLevel,
+		LogBuffer:  logBuffer,
+		Version:    version,
+		ConfigPath: configPath,
+		Overrides:  overrides,
+		Remote:     remote,
+	})
+	if err != nil {
+		logger.Error("Error initializing server", "error", err)
+		return 1
+	}
+
+	// Context for shutdown
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Wait for signals; SIGHUP reloads the configuration file, SIGUSR1
+	// refreshes the blocklist
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for {
+			select {
+			case sig := <-sigChan:
+				switch sig {
+				case syscall.SIGHUP:
+					if _, err := application.ReloadConfig(); err != nil {
+						logger.Error("Error reloading configuration", "error", err)
+					}
+					continue
+				case syscall.SIGUSR1:
+					application.RefreshBlocklist()
+					continue
+				case syscall.SIGUSR2:
+					// Caught so that it does not kill the server
+					logger.Info("Received SIGUSR2; answers are not cached, so there is nothing to flush")
+					continue
+				}
+				logger.Info("Received signal, shutting down...", "signal", sig)
+				cancel()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	if err := application.Run(ctx); err != nil {
+		logger.Error("Server exited with error", "error", err)
+		return 1
+	}
+
+	logger.Info("Shutdown complete")
+	return 0
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/app"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+)
+
+// runValidate implements "opl-dns validate": it loads the configuration,
+// runs app.Check, prints one line per check, and returns the exit status.
+func runValidate(args []string, stdout io.Writer) int {
+	fs := flag.NewFlagSet("opl-dns validate", flag.ContinueOnError)
+	configPath := fs.String("config", "config.json", "Path to configuration file")
+	offline := fs.Bool("offline", false, "Skip checks that contact the upstream resolvers and the OPL API")
+	config.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load(*configPath)
+	if err == nil {
+		err = cfg.ApplyFlags(fs)
+	}
+	if err != nil {
+		fmt.Fprintf(stdout, "FAIL  configuration: %v\n", err)
+		return 1
+	}
+
+	failed := 0
+	for _, r := range app.Check(context.Background(), cfg, app.CheckOptions{Offline: *offline}) {
+		switch {
+		case r.Err != nil:
+			failed++
+			fmt.Fprintf(stdout, "FAIL  %s: %v\n", r.Name, r.Err)
+		case r.Skipped != "":
+			fmt.Fprintf(stdout, "skip  %s: %s\n", r.Name, r.Skipped)
+		default:
+			fmt.Fprintf(stdout, "ok    %s\n", r.Name)
+		}
+	}
+	if failed > 0 {
+		fmt.Fprintf(stdout, "%d check(s) failed\n", failed)
+		return 1
+	}
+	return 0
+}
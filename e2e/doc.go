@@ -0,0 +1,7 @@
+// Package e2e holds end-to-end tests that boot the complete server in
+// process, against a fake OPL API and fake upstream resolvers, and drive it
+// over real DNS and HTTP connections. It contains no production code.
+//
+// Run the suite on its own with `make test-e2e`; it is also part of
+// `go test ./...`.
+package e2e
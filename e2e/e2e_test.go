@@ -0,0 +1,202 @@
+package e2e
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+)
+
+func TestBlocking(t *testing.T) {
+	h := newHarness(t, nil)
+
+	tests := []struct {
+		network string
+		name    string
+		qtype   uint16
+		want    string
+	}{
+		{"udp", "blocked.example", dns.TypeA, "0.0.0.0"},
+		{"udp", "www.blocked.example", dns.TypeA, "0.0.0.0"},
+		{"udp", "BLOCKED.example", dns.TypeA, "0.0.0.0"},
+		{"udp", "blocked.example", dns.TypeAAAA, "::"},
+		{"tcp", "blocked.example", dns.TypeA, "0.0.0.0"},
+		{"udp", "allowed.example", dns.TypeA, upstreamIPv4},
+		{"udp", "allowed.example", dns.TypeAAAA, upstreamIPv6},
+		{"tcp", "allowed.example", dns.TypeA, upstreamIPv4},
+		{"udp", "notblocked.example", dns.TypeA, upstreamIPv4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.network+"/"+tt.name+"/"+dns.TypeToString[tt.qtype], func(t *testing.T) {
+			if got := h.Resolve(tt.network, tt.name, tt.qtype); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	total, blocked, forwarded, _ := h.App.Stats().Snapshot()
+	if total != int64(len(tests)) || blocked != 5 || forwarded != 4 {
+		t.Errorf("Expected %d total, 5 blocked and 4 forwarded, got %d, %d and %d",
+			len(tests), total, blocked, forwarded)
+	}
+}
+
+func TestRefreshAppliesChanges(t *testing.T) {
+	h := newHarness(t, func(cfg *config.Config) {
+		cfg.API.RefreshInterval = config.Duration{Duration: 50 * time.Millisecond}
+		cfg.API.Timeout = cfg.API.RefreshInterval
+	})
+
+	if got := h.Resolve("udp", "newly-blocked.example", dns.TypeA); got != upstreamIPv4 {
+		t.Fatalf("Expected newly-blocked.example to be forwarded before refresh, got %s", got)
+	}
+
+	// Unchanged data is answered 304 on refresh
+	eventually(t, "a conditional refresh", func() bool {
+		_, notModified := h.API.Counts()
+		return notModified > 0
+	})
+
+	blocklist := defaultBlocklist()
+	delete(blocklist, "Test Corp")
+	blocklist["Other Corp"] = api.OPLBlocklistEntry{
+		MatchingURLRegexes: []string{"newly-blocked.example"},
+		ActionDetails:      api.ActionDetails{ID: "action-2", ActionType: "boycott", Status: "active"},
+	}
+	h.API.SetBlocklist(blocklist)
+
+	eventually(t, "the new entry to be blocked", func() bool {
+		return h.Resolve("udp", "newly-blocked.example", dns.TypeA) == "0.0.0.0"
+	})
+	if got := h.Resolve("udp", "blocked.example", dns.TypeA); got != upstreamIPv4 {
+		t.Errorf("Expected removed entry to be forwarded after refresh, got %s", got)
+	}
+}
+
+func TestStatsReportOnShutdown(t *testing.T) {
+	h := newHarness(t, nil)
+
+	h.Resolve("udp", "blocked.example", dns.TypeA)
+	h.Resolve("udp", "blocked.example", dns.TypeA)
+	h.Resolve("tcp", "www.blocked.example", dns.TypeA)
+	h.Resolve("udp", "allowed.example", dns.TypeA)
+	h.Stop()
+
+	reports := h.API.Reports()
+	if len(reports) != 1 {
+		t.Fatalf("Expected 1 stats report, got %d", len(reports))
+	}
+	report := reports[0]
+	if report.InstanceID != "e2e" || report.Version != "e2e" {
+		t.Errorf("Expected instance e2e and version e2e, got %q and %q", report.InstanceID, report.Version)
+	}
+	if report.TotalQueries != 4 || report.QueriesBlocked != 3 || report.QueriesForwarded != 1 {
+		t.Errorf("Expected 4 total, 3 blocked and 1 forwarded, got %d, %d and %d",
+			report.TotalQueries, report.QueriesBlocked, report.QueriesForwarded)
+	}
+	if report.BlocklistEmployers != 1 {
+		t.Errorf("Expected 1 blocklist employer, got %d", report.BlocklistEmployers)
+	}
+	if len(report.TopBlockedDomains) == 0 {
+		t.Error("Expected top blocked domains in report")
+	}
+	if report.APIFetch.Fetches != 1 || report.APIFetch.LastBytes == 0 {
+		t.Errorf("Expected the initial blocklist fetch in report, got %+v", report.APIFetch)
+	}
+}
+
+func TestUpstreamSoftFailover(t *testing.T) {
+	failing := startUpstream(t, dns.RcodeServerFailure)
+	healthy := startUpstream(t, dns.RcodeSuccess)
+	h := newHarness(t, func(cfg *config.Config) {
+		cfg.DNS.UpstreamDNS = config.Upstreams(failing, healthy)
+		cfg.DNS.SoftFailureRetries = 1
+	})
+
+	if got := h.Resolve("udp", "allowed.example", dns.TypeA); got != upstreamIPv4 {
+		t.Errorf("Expected answer from healthy upstream, got %s", got)
+	}
+	if n := h.App.Stats().SoftFailureRetries(); n != 1 {
+		t.Errorf("Expected 1 soft failure retry, got %d", n)
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	h := newHarness(t, func(cfg *config.Config) {
+		cfg.Policy.StateFile = filepath.Join(t.TempDir(), "policy.json")
+		cfg.Admin.Enabled = true
+		cfg.Admin.ListenAddr = "127.0.0.1:0"
+		cfg.Admin.AuthToken = "admin-token"
+	})
+	base := "http://" + h.App.AdminAddr().String()
+
+	do := func(method, path, body string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(method, base+path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin-token")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	// The DNS listeners report serving just after Ready
+	var code int
+	var body string
+	eventually(t, "the server to report healthy", func() bool {
+		code, body = do(http.MethodGet, "/readyz", "")
+		return code == http.StatusOK
+	})
+
+	code, body = do(http.MethodGet, "/health", "")
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200 from /health, got %d: %s", code, body)
+	}
+	var health struct {
+		Status string `json:"status"`
+		DNS    struct {
+			Serving bool `json:"serving"`
+		} `json:"dns"`
+		Blocklist struct {
+			Loaded    bool `json:"loaded"`
+			Employers int  `json:"employers"`
+		} `json:"blocklist"`
+	}
+	if err := json.Unmarshal([]byte(body), &health); err != nil {
+		t.Fatalf("Failed to decode health: %v", err)
+	}
+	if health.Status != "ok" || !health.DNS.Serving || !health.Blocklist.Loaded || health.Blocklist.Employers != 1 {
+		t.Errorf("Unexpected health: %s", body)
+	}
+
+	code, body = do(http.MethodPut, "/api/policy",
+		`{"allowlist":["blocked.example"],"blocks":[{"domain":"local-block.example","employer":"Local Corp"}]}`)
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200 from policy update, got %d: %s", code, body)
+	}
+	if got := h.Resolve("udp", "blocked.example", dns.TypeA); got != upstreamIPv4 {
+		t.Errorf("Expected allowlisted domain to be forwarded, got %s", got)
+	}
+	if got := h.Resolve("udp", "local-block.example", dns.TypeA); got != "0.0.0.0" {
+		t.Errorf("Expected locally blocked domain to be blocked, got %s", got)
+	}
+
+	code, body = do(http.MethodGet, "/metrics", "")
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200 from /metrics, got %d", code)
+	}
+	if !strings.Contains(body, `opl_dns_queries_total{result="blocked"} 1`) ||
+		!strings.Contains(body, `opl_dns_queries_total{result="forwarded"} 1`) {
+		t.Errorf("Expected one blocked and one forwarded query in metrics, got:\n%s", body)
+	}
+}
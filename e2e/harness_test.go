@@ -0,0 +1,294 @@
+package e2e
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/app"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+)
+
+// fakeAPI is an in-process OPL backend whose blocklist tests can change.
+type fakeAPI struct {
+	server *httptest.Server
+
+	mu          sync.Mutex
+	blocklist   map[string]api.OPLBlocklistEntry
+	fetches     int
+	notModified int
+	reports     []stats.StatsReport
+}
+
+func startFakeAPI(t *testing.T, blocklist map[string]api.OPLBlocklistEntry) *fakeAPI {
+	t.Helper()
+
+	f := &fakeAPI{blocklist: blocklist}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeAPI) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.URL.Path {
+	case "/blocklist.json":
+		f.fetches++
+		body, _ := json.Marshal(f.blocklist)
+		sum := sha256.Sum256(body)
+		hash := hex.EncodeToString(sum[:])
+		if r.URL.Query().Get("hash") == hash {
+			f.notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("X-Content-Hash", hash)
+		w.Write(body)
+	case "/blocklist/diff":
+		http.NotFound(w, r)
+	case "/dns-stats/report":
+		var report stats.StatsReport
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.reports = append(f.reports, report)
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// SetBlocklist replaces the blocklist served on the next fetch.
+func (f *fakeAPI) SetBlocklist(blocklist map[string]api.OPLBlocklistEntry) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.blocklist = blocklist
+}
+
+// Counts returns the number of blocklist fetches and how many of them
+// were answered 304 Not Modified.
+func (f *fakeAPI) Counts() (fetches, notModified int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.fetches, f.notModified
+}
+
+func (f *fakeAPI) Reports() []stats.StatsReport {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]stats.StatsReport(nil), f.reports...)
+}
+
+// upstreamIPv4 and upstreamIPv6 are the answers given by a healthy fake
+// upstream.
+const (
+	upstreamIPv4 = "192.0.2.1"
+	upstreamIPv6 = "2001:db8::1"
+)
+
+// startUpstream starts a fake resolver on UDP and TCP that answers every
+// query with rcode, plus an A or AAAA record when rcode is NOERROR.
+func startUpstream(t *testing.T, rcode int) string {
+	t.Helper()
+
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(r, rcode)
+		q := r.Question[0]
+		if rcode == dns.RcodeSuccess {
+			hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: 60}
+			switch q.Qtype {
+			case dns.TypeA:
+				m.Answer = append(m.Answer, &dns.A{Hdr: hdr, A: net.ParseIP(upstreamIPv4)})
+			case dns.TypeAAAA:
+				m.Answer = append(m.Answer, &dns.AAAA{Hdr: hdr, AAAA: net.ParseIP(upstreamIPv6)})
+			}
+		}
+		w.WriteMsg(m)
+	})
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen for upstream: %v", err)
+	}
+	ln, err := net.Listen("tcp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("Failed to listen for upstream: %v", err)
+	}
+
+	for _, srv := range []*dns.Server{
+		{PacketConn: pc, Handler: handler},
+		{Listener: ln, Handler: handler},
+	} {
+		started := make(chan struct{})
+		srv.NotifyStartedFunc = func() { close(started) }
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			srv.ActivateAndServe()
+		}()
+		<-started
+		t.Cleanup(func() {
+			srv.Shutdown()
+			<-done
+		})
+	}
+	return pc.LocalAddr().String()
+}
+
+// harness runs the full server stack.
+type harness struct {
+	t   *testing.T
+	API *fakeAPI
+	App *app.App
+
+	cancel  context.CancelFunc
+	errChan chan error
+	stopped bool
+}
+
+// defaultBlocklist blocks blocked.example for a strike at Test Corp.
+func defaultBlocklist() map[string]api.OPLBlocklistEntry {
+	return map[string]api.OPLBlocklistEntry{
+		"Test Corp": {
+			MoreInfoURL:        "https://union.example.org/test-corp",
+			MatchingURLRegexes: []string{"blocked.example"},
+			ActionDetails: api.ActionDetails{
+				ID:           "action-1",
+				Organization: "Test Workers United",
+				ActionType:   "strike",
+				Status:       "active",
+			},
+		},
+	}
+}
+
+// newHarness boots the server against a fake API serving defaultBlocklist
+// and one healthy upstream. configure may adjust the config first.
+func newHarness(t *testing.T, configure func(*config.Config)) *harness {
+	t.Helper()
+
+	h := &harness{t: t, API: startFakeAPI(t, defaultBlocklist())}
+
+	cfg := config.DefaultConfig()
+	cfg.DNS.ListenAddr = "127.0.0.1:0"
+	cfg.DNS.UpstreamDNS = config.Upstreams(startUpstream(t, dns.RcodeSuccess))
+	cfg.DNS.QueryTimeout = config.Duration{Duration: 2 * time.Second}
+	cfg.API.BaseURL = h.API.server.URL
+	cfg.API.Timeout = config.Duration{Duration: 2 * time.Second}
+	cfg.API.RetryMaxAttempts = 1
+	cfg.Stats.Enabled = true
+	cfg.Stats.InstanceID = "e2e"
+	cfg.Stats.ReportInterval = config.Duration{Duration: time.Hour}
+	if configure != nil {
+		configure(cfg)
+	}
+
+	a, err := app.New(cfg, app.Options{
+		Logger:  slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Version: "e2e",
+	})
+	if err != nil {
+		t.Fatalf("app.New failed: %v", err)
+	}
+	h.App = a
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	h.errChan = make(chan error, 1)
+	go func() {
+		h.errChan <- a.Run(ctx)
+	}()
+
+	select {
+	case <-a.Ready():
+	case err := <-h.errChan:
+		cancel()
+		t.Fatalf("Server exited before becoming ready: %v", err)
+	case <-time.After(10 * time.Second):
+		cancel()
+		t.Fatal("Timed out waiting for the server to become ready")
+	}
+
+	t.Cleanup(func() {
+		if !h.stopped {
+			h.Stop()
+		}
+	})
+	return h
+}
+
+// Stop shuts the server down and fails the test if Run returned an error.
+func (h *harness) Stop() {
+	h.t.Helper()
+	h.stopped = true
+	h.cancel()
+	select {
+	case err := <-h.errChan:
+		if err != nil {
+			h.t.Errorf("Run returned error: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		h.t.Fatal("Timed out waiting for the server to stop")
+	}
+}
+
+// Query sends one query over network ("udp" or "tcp") and returns the reply.
+func (h *harness) Query(network, name string, qtype uint16) *dns.Msg {
+	h.t.Helper()
+
+	c := &dns.Client{Net: network, Timeout: 2 * time.Second}
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	resp, _, err := c.Exchange(m, h.App.DNSAddr().String())
+	if err != nil {
+		h.t.Fatalf("%s query for %s failed: %v", network, name, err)
+	}
+	return resp
+}
+
+// Resolve returns the address in the single answer to an A or AAAA query.
+func (h *harness) Resolve(network, name string, qtype uint16) string {
+	h.t.Helper()
+
+	resp := h.Query(network, name, qtype)
+	if len(resp.Answer) != 1 {
+		h.t.Fatalf("Expected 1 answer for %s, got %d (rcode %s)", name, len(resp.Answer), dns.RcodeToString[resp.Rcode])
+	}
+	switch rr := resp.Answer[0].(type) {
+	case *dns.A:
+		return rr.A.String()
+	case *dns.AAAA:
+		return rr.AAAA.String()
+	}
+	h.t.Fatalf("Unexpected answer %v", resp.Answer[0])
+	return ""
+}
+
+// eventually polls cond until it holds or the deadline passes.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
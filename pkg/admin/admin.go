@@ -0,0 +1,321 @@
+// Package admin serves the local, authenticated admin interface: a small web
+// UI and JSON API for watching the server and managing local policy. It
+// listens separately from the DNS server and should be bound to a trusted
+// address.
+package admin
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/blocklog"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+	"github.com/online-picket-line/opl-for-dns/pkg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/policy"
+	"github.com/online-picket-line/opl-for-dns/pkg/ratelimit"
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+)
+
+// Config configures the admin server.
+type Config struct {
+	// ListenAddr is the address to listen on (e.g., "127.0.0.1:8081")
+	ListenAddr string
+
+	// AuthToken must be presented as a bearer token or as the password of
+	// HTTP basic auth (any username) on every request.
+	AuthToken string
+
+	// Policy is the store edited through the UI and API.
+	Policy *policy.Store
+
+	// Blocklist, if set, is reported on by /health, the dashboard, the
+	// blocklist listing and the lint report.
+	Blocklist *api.Client
+
+	// Stats, if set, supplies the query statistics shown on the dashboard.
+	Stats *stats.Collector
+
+	// DNS and Reporter, if set, are reported on by the health endpoints.
+	// DNS also answers the blocklist check endpoint, which otherwise
+	// applies Policy and Blocklist itself.
+	DNS      *dns.Server
+	Reporter *stats.Reporter
+
+	// BlockLog, if set, is served by the block history endpoints.
+	BlockLog *blocklog.Log
+
+	// Tenants are reported on by /health alongside Blocklist and Reporter.
+	Tenants []Tenant
+
+	// Reload, if set, reloads the configuration file for
+	// POST /api/config/reload and reports which changed settings were
+	// applied and which need a restart.
+	Reload func() (applied, restartRequired []string, err error)
+
+	// Refresh, if set, asks for an immediate blocklist fetch for
+	// POST /api/blocklist/refresh.
+	Refresh func()
+
+	// RunningConfig, if set, returns the configuration in effect for
+	// GET /api/config.
+	RunningConfig func() *config.Config
+
+	// PatchConfig, if set, applies a partial configuration document over
+	// the configuration in effect for PATCH /api/config and reports which
+	// settings changed.
+	PatchConfig func(patch []byte) (applied []string, err error)
+
+	// StaleAfter is how old the blocklist may get before /health reports
+	// "degraded". Zero disables the check.
+	StaleAfter time.Duration
+
+	// RequestsPerMinute limits authenticated endpoints per client IP,
+	// slowing token guessing. Zero disables the limit.
+	RequestsPerMinute int
+
+	// Recorder receives rate limiting events. Nil discards them.
+	Recorder stats.Recorder
+
+	// Metrics, if set, is served at /metrics for Prometheus scrapes. Leave
+	// it nil when a MetricsServer serves it instead.
+	Metrics http.Handler
+
+	// Debug serves net/http/pprof under /debug/pprof/ and expvar at
+	// /debug/vars. Leave it off when a MetricsServer serves them instead.
+	Debug bool
+
+	// PiholeToken, if set, serves the Pi-hole API subset at
+	// /admin/api.php to clients that send it as the auth query parameter.
+	PiholeToken string
+
+	// Version is reported in diagnostics bundles.
+	Version string
+
+	// RecentLogs, if set, returns recent log output for diagnostics
+	// bundles.
+	RecentLogs func() []byte
+
+	Logger *slog.Logger
+}
+
+// Tenant is a member organization served by the same DNS server, with its
+// own blocklist and stats reporter.
+type Tenant struct {
+	Name      string
+	Blocklist *api.Client
+	Reporter  *stats.Reporter
+}
+
+// Server is the admin HTTP server.
+type Server struct {
+	service
+
+	authToken   string
+	policy      *policy.Store
+	blocklist   *api.Client
+	collector   *stats.Collector
+	dns         *dns.Server
+	reporter    *stats.Reporter
+	blockLog    *blocklog.Log
+	tenants     []Tenant
+	reload      func() (applied, restartRequired []string, err error)
+	refresh     func()
+	running     func() *config.Config
+	patch       func(patch []byte) (applied []string, err error)
+	staleAfter  time.Duration
+	limiter     ratelimit.Limiter
+	metrics     http.Handler
+	debug       bool
+	piholeToken string
+	version     string
+	recentLogs  func() []byte
+	stats       stats.Recorder
+	logger      *slog.Logger
+}
+
+// New creates an admin server.
+func New(cfg Config) (*Server, error) {
+	if cfg.ListenAddr == "" {
+		return nil, fmt.Errorf("listen address is required")
+	}
+	if cfg.AuthToken == "" {
+		return nil, fmt.Errorf("auth token is required")
+	}
+	if cfg.Policy == nil {
+		return nil, fmt.Errorf("policy store is required")
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	recorder := cfg.Recorder
+	if recorder == nil {
+		recorder = stats.NopRecorder{}
+	}
+
+	s := &Server{
+		authToken:   cfg.AuthToken,
+		policy:      cfg.Policy,
+		blocklist:   cfg.Blocklist,
+		collector:   cfg.Stats,
+		dns:         cfg.DNS,
+		reporter:    cfg.Reporter,
+		blockLog:    cfg.BlockLog,
+		tenants:     cfg.Tenants,
+		reload:      cfg.Reload,
+		refresh:     cfg.Refresh,
+		running:     cfg.RunningConfig,
+		patch:       cfg.PatchConfig,
+		staleAfter:  cfg.StaleAfter,
+		limiter:     ratelimit.NewSlidingWindow(cfg.RequestsPerMinute, time.Minute),
+		metrics:     cfg.Metrics,
+		debug:       cfg.Debug,
+		piholeToken: cfg.PiholeToken,
+		version:     cfg.Version,
+		recentLogs:  cfg.RecentLogs,
+		stats:       recorder,
+		logger:      logger,
+	}
+	s.service = service{name: "admin", listenAddr: cfg.ListenAddr, logger: logger, handler: s.Handler}
+	return s, nil
+}
+
+// Handler returns the admin HTTP handler with authentication applied to
+// everything except the health endpoints.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/dashboard", http.StatusFound)
+	})
+	mux.HandleFunc("GET /dashboard", s.handleDashboard)
+	mux.HandleFunc("GET /api/stats", s.handleStats)
+	mux.HandleFunc("GET /api/stats/history", s.handleHistory)
+	mux.HandleFunc("GET /api/history/blocks", s.handleBlockHistory)
+	mux.HandleFunc("GET /api/history/blocks/{date}", s.handleBlockEvents)
+	mux.HandleFunc("GET /policy", s.handlePolicyPage)
+	mux.HandleFunc("POST /policy", s.handlePolicyForm)
+	mux.HandleFunc("GET /api/policy", s.handleGetPolicy)
+	mux.HandleFunc("PUT /api/policy", s.handlePutPolicy)
+	mux.HandleFunc("GET /api/config", s.handleGetConfig)
+	mux.HandleFunc("PATCH /api/config", s.handlePatchConfig)
+	mux.HandleFunc("POST /api/config/reload", s.handleReload)
+	mux.HandleFunc("POST /api/blocklist/refresh", s.handleRefresh)
+	mux.HandleFunc("GET /api/blocklist", s.handleBlocklist)
+	mux.HandleFunc("GET /api/blocklist/lint", s.handleLintReport)
+	mux.HandleFunc("GET /api/blocklist/check", s.handleBlocklistCheck)
+	mux.HandleFunc("GET /api/blocklist/versions", s.handleBlocklistVersions)
+	mux.HandleFunc("POST /api/blocklist/pin", s.handlePinBlocklist)
+	mux.HandleFunc("DELETE /api/blocklist/pin", s.handleUnpinBlocklist)
+	mux.HandleFunc("POST /api/blocklist/rollback", s.handleRollbackBlocklist)
+	mux.HandleFunc("GET /api/diag", s.handleDiagnostics)
+	if s.metrics != nil {
+		mux.Handle("GET /metrics", s.metrics)
+	}
+	if s.debug {
+		handleDebug(mux)
+	}
+
+	root := http.NewServeMux()
+	root.HandleFunc("GET /health", s.handleHealth)
+	root.HandleFunc("GET /livez", s.handleLivez)
+	root.HandleFunc("GET /readyz", s.handleReadyz)
+	if s.piholeToken != "" {
+		// Pi-hole clients authenticate in the query string, not with the
+		// admin token
+		root.Handle("/admin/api.php", s.rateLimit(http.HandlerFunc(s.handlePihole)))
+	}
+	root.Handle("/", s.rateLimit(requireToken(s.authToken, sameOrigin(mux))))
+	return recoverPanics(s.stats, s.logger, "admin", root)
+}
+
+// recoverPanics turns a panic in a handler into a 500 and a logged stack
+// trace. net/http would otherwise recover it by dropping the connection
+// without an answer or a count.
+func recoverPanics(recorder stats.Recorder, logger *slog.Logger, scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			recorder.RecordPanic(scope)
+			logger.Error("Recovered from panic serving request", "method", r.Method, "path", r.URL.Path, "panic", v, "stack", string(debug.Stack()))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// rateLimit rejects clients that exceed the request limit. It runs before
+// authentication so failed guesses count too.
+func (s *Server) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			client = r.RemoteAddr
+		}
+		if !s.limiter.Allow(client) {
+			s.stats.RecordRateLimited("admin")
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "Too many requests", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requireToken rejects requests that do not carry token.
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given := ""
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			given = strings.TrimPrefix(auth, "Bearer ")
+		} else if _, password, ok := r.BasicAuth(); ok {
+			given = password
+		}
+
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="opl-dns admin", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sameOrigin rejects state-changing requests sent by another site. Browsers
+// resend basic auth credentials automatically, so without this any page the
+// operator visits could submit the policy form.
+func sameOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if site := r.Header.Get("Sec-Fetch-Site"); site != "" && site != "same-origin" && site != "none" {
+			http.Error(w, "Cross-origin request rejected", http.StatusForbidden)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				http.Error(w, "Cross-origin request rejected", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
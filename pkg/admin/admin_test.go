@@ -0,0 +1,1241 @@
+package admin
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/blocklog"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+	"github.com/online-picket-line/opl-for-dns/pkg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/policy"
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+)
+
+const testToken = "test-token"
+
+func newTestServer(t *testing.T) (*Server, *policy.Store, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "policy.json")
+	store, err := policy.NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	s, err := New(Config{ListenAddr: "127.0.0.1:0", AuthToken: testToken, Policy: store})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return s, store, path
+}
+
+func TestNewRequiresToken(t *testing.T) {
+	store, _ := policy.NewStore("")
+	if _, err := New(Config{ListenAddr: "127.0.0.1:0", Policy: store}); err == nil {
+		t.Error("Expected error without auth token")
+	}
+}
+
+func TestAuth(t *testing.T) {
+	s, _, _ := newTestServer(t)
+	handler := s.Handler()
+
+	tests := []struct {
+		name       string
+		setAuth    func(*http.Request)
+		wantStatus int
+	}{
+		{"no credentials", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"wrong bearer token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer nope") }, http.StatusUnauthorized},
+		{"bearer token", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+testToken) }, http.StatusOK},
+		{"basic auth password", func(r *http.Request) { r.SetBasicAuth("admin", testToken) }, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/policy", nil)
+			tt.setAuth(req)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("Expected WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestPutPolicy(t *testing.T) {
+	s, store, path := newTestServer(t)
+	handler := s.Handler()
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/policy", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := put(`{"allowlist":["Union.Example.org"],"blocks":[{"domain":"scab.example","employer":"Scab Inc"}],"groups":[]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var applied policy.State
+	json.NewDecoder(rec.Body).Decode(&applied)
+	if len(applied.Allowlist) != 1 || applied.Allowlist[0] != "union.example.org" {
+		t.Errorf("Expected normalized state in response, got %+v", applied)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Expected policy file to be written: %v", err)
+	}
+
+	rec = put(`{"allowlist":["bad domain"],"groups":[{"name":"x","mode":"bogus","clients":["10.0.0.0/8"]}]}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400, got %d", rec.Code)
+	}
+	var resp struct{ Errors []string }
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if len(resp.Errors) != 2 {
+		t.Errorf("Expected 2 validation errors, got %v", resp.Errors)
+	}
+	if got := store.Policy().State().Blocks; len(got) != 1 {
+		t.Errorf("Expected previous policy to remain active, got blocks %+v", got)
+	}
+
+	if rec := put(`{"allowlist":[],"unknown":true}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for unknown field, got %d", rec.Code)
+	}
+}
+
+func TestPolicyForm(t *testing.T) {
+	s, store, _ := newTestServer(t)
+	handler := s.Handler()
+
+	post := func(form url.Values, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/policy", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth("admin", testToken)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	valid := url.Values{
+		"allowlist": {"# comment\nunion.example.org\n\n"},
+		"blocks":    {"scab.example | Scab Inc | Strikebreaking | agency\nother.example"},
+		"groups":    {"kids | enforce | 192.168.1.0/24, fd00::/8 | school.example\nguests | off | 192.168.50.0/24"},
+	}
+
+	rec := post(valid, map[string]string{"Origin": "http://example.com"})
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/policy?applied=1" {
+		t.Fatalf("Expected redirect after apply, got %d %s: %s", rec.Code, rec.Header().Get("Location"), rec.Body)
+	}
+
+	state := store.Policy().State()
+	if len(state.Blocks) != 2 || state.Blocks[0].Reason != "Strikebreaking | agency" {
+		t.Errorf("Unexpected blocks: %+v", state.Blocks)
+	}
+	if len(state.Groups) != 2 || len(state.Groups[0].Clients) != 2 || state.Groups[0].Allowlist[0] != "school.example" {
+		t.Errorf("Unexpected groups: %+v", state.Groups)
+	}
+
+	// The page renders the applied state back in the same format
+	req := httptest.NewRequest(http.MethodGet, "/policy?applied=1", nil)
+	req.SetBasicAuth("admin", testToken)
+	page := httptest.NewRecorder()
+	handler.ServeHTTP(page, req)
+	body := page.Body.String()
+	for _, want := range []string{"Policy applied", "scab.example | Scab Inc | Strikebreaking | agency", "kids | enforce | 192.168.1.0/24, fd00::/8 | school.example"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected page to contain %q", want)
+		}
+	}
+
+	invalid := url.Values{
+		"allowlist": {"union.example.org"},
+		"groups":    {"kids | enforce"},
+	}
+	rec = post(invalid, nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for invalid form, got %d", rec.Code)
+	}
+	if !strings.Contains(rec.Body.String(), "groups line 1") || !strings.Contains(rec.Body.String(), "kids | enforce") {
+		t.Errorf("Expected error and submitted text in response, got: %s", rec.Body)
+	}
+	if len(store.Policy().State().Blocks) != 2 {
+		t.Error("Expected invalid form to leave policy unchanged")
+	}
+}
+
+func TestCrossOriginRejected(t *testing.T) {
+	s, store, _ := newTestServer(t)
+	handler := s.Handler()
+
+	for name, header := range map[string][2]string{
+		"origin":         {"Origin", "https://evil.example"},
+		"sec-fetch-site": {"Sec-Fetch-Site", "cross-site"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			form := url.Values{"blocks": {"union.example.org"}}
+			req := httptest.NewRequest(http.MethodPost, "/policy", strings.NewReader(form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.SetBasicAuth("admin", testToken)
+			req.Header.Set(header[0], header[1])
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("Expected 403, got %d", rec.Code)
+			}
+		})
+	}
+
+	if len(store.Policy().State().Blocks) != 0 {
+		t.Error("Expected cross-origin request not to change policy")
+	}
+}
+
+func TestHealth(t *testing.T) {
+	store, _ := policy.NewStore("")
+	client := api.NewClient("https://api.example.com", "", time.Second)
+	s, err := New(Config{ListenAddr: "127.0.0.1:0", AuthToken: testToken, Policy: store, Blocklist: client})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := s.Handler()
+
+	get := func(path string, auth bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if auth {
+			req.Header.Set("Authorization", "Bearer "+testToken)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// No credentials needed, but nothing to serve before the first fetch
+	if rec := get("/health", false); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before the blocklist loads, got %d", rec.Code)
+	}
+
+	client.SetBlocklistForTesting(&api.Blocklist{
+		TotalURLs: 1,
+		BlockList: []api.BlockListItem{{URL: "acme.com", Domain: "acme.com", Employer: "Acme"}},
+	})
+
+	rec := get("/health", false)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	var health healthStatus
+	json.NewDecoder(rec.Body).Decode(&health)
+	if health.Status != "ok" || health.Blocklist == nil || !health.Blocklist.Loaded || health.Blocklist.URLs != 1 {
+		t.Errorf("Unexpected health %+v", health)
+	}
+
+	if rec := get("/api/blocklist/lint", false); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected lint report to require auth, got %d", rec.Code)
+	}
+	rec = get("/api/blocklist/lint", true)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	var report api.LintReport
+	if err := json.NewDecoder(rec.Body).Decode(&report); err != nil {
+		t.Fatalf("Decoding lint report: %v", err)
+	}
+}
+
+func TestHealthTenants(t *testing.T) {
+	store, _ := policy.NewStore("")
+	client := api.NewClient("https://api.example.com", "", time.Second)
+	tenantClient := api.NewClient("https://api.example.com", "", time.Second)
+	s, err := New(Config{
+		ListenAddr: "127.0.0.1:0",
+		AuthToken:  testToken,
+		Policy:     store,
+		Blocklist:  client,
+		Tenants:    []Tenant{{Name: "local-12", Blocklist: tenantClient}},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	client.SetBlocklistForTesting(&api.Blocklist{TotalURLs: 1})
+
+	// A tenant without a blocklist degrades the server but leaves it ready
+	status := s.checkHealth()
+	if status.Status != healthDegraded || len(status.Tenants) != 1 || status.Tenants[0].Blocklist.Loaded {
+		t.Errorf("Expected degraded health with the tenant unloaded, got %+v", status)
+	}
+
+	tenantClient.SetBlocklistForTesting(&api.Blocklist{TotalURLs: 2})
+	status = s.checkHealth()
+	if status.Status != healthOK || status.Tenants[0].Name != "local-12" || status.Tenants[0].Blocklist.URLs != 2 {
+		t.Errorf("Expected ok health with the tenant loaded, got %+v", status)
+	}
+}
+
+func TestHealthProbes(t *testing.T) {
+	store, _ := policy.NewStore("")
+	client := api.NewClient("https://api.example.com", "", time.Second)
+	s, err := New(Config{
+		ListenAddr: "127.0.0.1:0",
+		AuthToken:  testToken,
+		Policy:     store,
+		Blocklist:  client,
+		StaleAfter: time.Nanosecond,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := s.Handler()
+
+	get := func(path string) (int, healthStatus) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		var status healthStatus
+		json.NewDecoder(rec.Body).Decode(&status)
+		return rec.Code, status
+	}
+
+	if code, _ := get("/livez"); code != http.StatusOK {
+		t.Errorf("Expected /livez to return 200 while starting, got %d", code)
+	}
+	if code, status := get("/readyz"); code != http.StatusServiceUnavailable || status.Status != healthStarting {
+		t.Errorf("Expected /readyz to return 503 starting, got %d %+v", code, status)
+	}
+
+	client.SetBlocklistForTesting(&api.Blocklist{
+		TotalURLs: 1,
+		BlockList: []api.BlockListItem{{URL: "acme.com", Domain: "acme.com", Employer: "Acme"}},
+	})
+	time.Sleep(time.Millisecond)
+
+	// A stale blocklist degrades health but the server stays ready
+	code, status := get("/health")
+	if code != http.StatusOK || status.Status != healthDegraded || !status.Blocklist.Stale || len(status.Problems) != 1 {
+		t.Errorf("Expected 200 degraded with a stale blocklist, got %d %+v", code, status)
+	}
+	if code, status := get("/readyz"); code != http.StatusOK || status.Status != healthDegraded || status.Blocklist != nil {
+		t.Errorf("Expected terse 200 degraded from /readyz, got %d %+v", code, status)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	store, _ := policy.NewStore("")
+	collector := stats.NewCollector()
+	s, err := New(Config{
+		ListenAddr:        "127.0.0.1:0",
+		AuthToken:         testToken,
+		Policy:            store,
+		RequestsPerMinute: 3,
+		Recorder:          collector,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := s.Handler()
+
+	get := func(path, remote string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = remote
+		req.Header.Set("Authorization", "Bearer wrong")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := get("/api/policy", "192.0.2.1:1000"); code != http.StatusUnauthorized {
+			t.Fatalf("request %d: expected 401, got %d", i, code)
+		}
+	}
+	if code := get("/api/policy", "192.0.2.1:2000"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected 429 once the limit is reached, got %d", code)
+	}
+	if code := get("/api/policy", "192.0.2.2:1000"); code != http.StatusUnauthorized {
+		t.Errorf("Expected other clients to be unaffected, got %d", code)
+	}
+	if code := get("/health", "192.0.2.1:1000"); code == http.StatusTooManyRequests {
+		t.Error("Expected /health not to be rate limited")
+	}
+	if got := collector.RateLimited()["admin"]; got != 1 {
+		t.Errorf("Expected 1 rate-limited request recorded, got %d", got)
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	store, _ := policy.NewStore("")
+	client := api.NewClient("https://api.example.com", "", time.Second)
+	collector := stats.NewCollector(stats.WithClientStats(stats.ClientStatsConfig{}))
+	s, err := New(Config{
+		ListenAddr: "127.0.0.1:0",
+		AuthToken:  testToken,
+		Policy:     store,
+		Blocklist:  client,
+		Stats:      collector,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := s.Handler()
+
+	client.SetBlocklistForTesting(&api.Blocklist{
+		TotalURLs: 3,
+		BlockList: []api.BlockListItem{
+			{URL: "globex.com", Domain: "globex.com", Employer: "Globex"},
+			{URL: "acme.com", Domain: "acme.com", Employer: "Acme", ActionDetails: api.ActionDetails{ActionType: "strike", Status: "active"}},
+			{URL: "acme.org", Domain: "acme.org", Employer: "Acme", ActionDetails: api.ActionDetails{ActionType: "strike", Status: "active"}},
+		},
+	})
+	collector.RecordBlock("acme.com")
+	collector.RecordBlock("acme.com")
+	collector.RecordEmployerBlock("Acme", "strike-7")
+	collector.RecordEmployerBlock("Acme", "strike-7")
+	collector.RecordQuery()
+	collector.RecordUpstreamRcode("NOERROR")
+	collector.RecordClientQuery(netip.MustParseAddr("192.168.1.23"), true)
+	collector.RecordQueryDuration(3 * time.Millisecond)
+	collector.RecordQueryType("HTTPS")
+	collector.RecordResponseRcode("NXDOMAIN")
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/api/stats")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	var d dashboard
+	if err := json.NewDecoder(rec.Body).Decode(&d); err != nil {
+		t.Fatalf("Decoding stats: %v", err)
+	}
+	if d.Queries == nil || d.Queries.Total != 3 || d.Queries.Blocked != 2 || d.Queries.Types["HTTPS"] != 1 || d.Queries.Rcodes["NXDOMAIN"] != 1 {
+		t.Errorf("Unexpected query stats %+v", d.Queries)
+	}
+	if len(d.TopBlocked) != 1 || d.TopBlocked[0].Domain != "acme.com" {
+		t.Errorf("Unexpected top blocked %+v", d.TopBlocked)
+	}
+	if len(d.TopEmployers) != 1 || d.TopEmployers[0].Count != 2 || d.TopEmployers[0].Actions[0].ID != "strike-7" {
+		t.Errorf("Unexpected top employers %+v", d.TopEmployers)
+	}
+	if len(d.TopClients) != 1 || d.TopClients[0].Client != "192.168.1.23" || d.TopClients[0].Blocked != 1 {
+		t.Errorf("Unexpected top clients %+v", d.TopClients)
+	}
+	if d.Latency == nil || d.Latency.Query.Count != 1 || d.Latency.Query.MaxMs != 3 {
+		t.Errorf("Unexpected latency %+v", d.Latency)
+	}
+	if d.Upstream == nil || d.Upstream.Rcodes["NOERROR"] != 1 {
+		t.Errorf("Unexpected upstream health %+v", d.Upstream)
+	}
+	if d.Blocklist == nil || len(d.Blocklist.Employers) != 2 {
+		t.Fatalf("Expected 2 employers, got %+v", d.Blocklist)
+	}
+	if acme := d.Blocklist.Employers[0]; acme.Name != "Acme" || len(acme.Domains) != 2 || acme.ActionType != "strike" {
+		t.Errorf("Unexpected employer summary %+v", acme)
+	}
+
+	rec = get("/dashboard")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"acme.com, acme.org", "Globex", "66.7%", "192.168.1.23", "strike-7 (2)", "Query handling"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected dashboard to contain %q", want)
+		}
+	}
+
+	if rec := get("/"); rec.Code != http.StatusFound || rec.Header().Get("Location") != "/dashboard" {
+		t.Errorf("Expected / to redirect to the dashboard, got %d %s", rec.Code, rec.Header().Get("Location"))
+	}
+}
+
+func TestStatsHistory(t *testing.T) {
+	store, _ := policy.NewStore("")
+	collector := stats.NewCollector()
+	s, err := New(Config{ListenAddr: "127.0.0.1:0", AuthToken: testToken, Policy: store, Stats: collector})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := s.Handler()
+
+	collector.RecordQuery()
+	collector.RecordBlock("acme.com")
+	collector.RecordBypass()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/api/stats/history?minutes=60")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	var h historyResponse
+	if err := json.NewDecoder(rec.Body).Decode(&h); err != nil {
+		t.Fatalf("Decoding history: %v", err)
+	}
+	if h.IntervalSeconds != 60 || len(h.Points) == 0 {
+		t.Fatalf("Unexpected history %+v", h)
+	}
+	if last := h.Points[len(h.Points)-1]; last.Queries != 2 || last.Blocked != 1 || last.Bypasses != 1 {
+		t.Errorf("Unexpected current minute %+v", last)
+	}
+
+	if rec := get("/api/stats/history?minutes=0"); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for minutes=0, got %d", rec.Code)
+	}
+}
+
+func TestBlockHistory(t *testing.T) {
+	store, _ := policy.NewStore("")
+	blockLog, err := blocklog.Open(blocklog.Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	s, err := New(Config{ListenAddr: "127.0.0.1:0", AuthToken: testToken, Policy: store, BlockLog: blockLog})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := s.Handler()
+
+	client := netip.MustParseAddr("192.0.2.1")
+	blockLog.Record(client, "acme.com", "Acme", "strike-1")
+	blockLog.Record(client, "globex.com", "Globex", "")
+	blockLog.Record(client, "acme.com", "Acme", "strike-1")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	blockLog.Run(ctx)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/api/history/blocks")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	var h blockHistoryResponse
+	if err := json.NewDecoder(rec.Body).Decode(&h); err != nil {
+		t.Fatalf("Decoding history: %v", err)
+	}
+	if len(h.Days) != 7 {
+		t.Fatalf("Expected a week of days, got %d", len(h.Days))
+	}
+	today := h.Days[6]
+	if today.Date != time.Now().UTC().Format(time.DateOnly) || today.Total != 3 || today.Employers[0] != (blocklog.EmployerCount{Employer: "Acme", Count: 2}) {
+		t.Errorf("Unexpected summary for today %+v", today)
+	}
+
+	rec = get("/api/history/blocks/" + today.Date + "?employer=acme&limit=1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	var e blockEventsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&e); err != nil {
+		t.Fatalf("Decoding events: %v", err)
+	}
+	if len(e.Events) != 1 || e.Events[0].Domain != "acme.com" || e.Events[0].ActionID != "strike-1" {
+		t.Errorf("Unexpected events %+v", e.Events)
+	}
+
+	for _, path := range []string{
+		"/api/history/blocks?from=yesterday",
+		"/api/history/blocks?from=2026-03-02&to=2026-03-01",
+		"/api/history/blocks?from=2020-01-01&to=2026-03-01",
+		"/api/history/blocks/2026-13-01",
+		"/api/history/blocks/2026-03-01?limit=0",
+	} {
+		if rec := get(path); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestBlockHistoryDisabled(t *testing.T) {
+	s, _, _ := newTestServer(t)
+	req := httptest.NewRequest(http.MethodGet, "/api/history/blocks", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code == http.StatusOK {
+		t.Errorf("Expected 404 without a block log, got %d", rec.Code)
+	}
+}
+
+func TestActivityChart(t *testing.T) {
+	start := time.Date(2024, 5, 1, 15, 0, 0, 0, time.UTC)
+	points := []stats.HistoryPoint{
+		{Time: start, Queries: 10, Blocked: 5},
+		{Time: start.Add(time.Minute)},
+		{Time: start.Add(2 * time.Minute), Queries: 20, Blocked: 20},
+	}
+
+	chart := buildActivityChart(points)
+	if chart == nil {
+		t.Fatal("Expected a chart")
+	}
+	if chart.Width != 2 || chart.Queries != 30 || chart.Blocked != 25 || chart.PeakQueries != 20 {
+		t.Errorf("Unexpected chart %+v", chart)
+	}
+	if chart.QueryLine != "0,20.0 1,40.0 2,0.0" {
+		t.Errorf("Unexpected query line %q", chart.QueryLine)
+	}
+	if chart.BlockedLine != "0,30.0 1,40.0 2,0.0" {
+		t.Errorf("Unexpected blocked line %q", chart.BlockedLine)
+	}
+
+	if buildActivityChart(points[:1]) != nil {
+		t.Error("Expected no chart for a single minute")
+	}
+}
+
+func TestBlocklistListing(t *testing.T) {
+	store, _ := policy.NewStore("")
+	client := api.NewClient("https://api.example.com", "", time.Second)
+	s, err := New(Config{ListenAddr: "127.0.0.1:0", AuthToken: testToken, Policy: store, Blocklist: client})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := s.Handler()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := get("/api/blocklist"); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before the blocklist loads, got %d", rec.Code)
+	}
+
+	strike := api.ActionDetails{ActionType: "strike"}
+	client.SetBlocklistForTesting(&api.Blocklist{
+		TotalURLs: 4,
+		BlockList: []api.BlockListItem{
+			{URL: "globex.com", Domain: "globex.com", Employer: "Globex"},
+			{URL: "acme.org", Domain: "acme.org", Employer: "Acme", StartDate: "2026-01-05", ActionDetails: strike},
+			{URL: "acme.com", Domain: "acme.com", Employer: "Acme", StartDate: "2026-01-05", ActionDetails: strike},
+			{URL: "acme.net", Domain: "acme.net", Employer: "Acme", StartDate: "2026-01-05", ActionDetails: strike},
+		},
+	})
+
+	tests := []struct {
+		path    string
+		total   int
+		domains []string
+	}{
+		{"/api/blocklist", 4, []string{"acme.com", "acme.net", "acme.org", "globex.com"}},
+		{"/api/blocklist?per_page=3", 4, []string{"acme.com", "acme.net", "acme.org"}},
+		{"/api/blocklist?per_page=3&page=2", 4, []string{"globex.com"}},
+		{"/api/blocklist?per_page=3&page=3", 4, nil},
+		{"/api/blocklist?employer=acme&per_page=2&page=2", 3, []string{"acme.org"}},
+		{"/api/blocklist?employer=Initech", 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := get(tt.path)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("Expected 200, got %d", rec.Code)
+			}
+			var page blocklistPage
+			if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+				t.Fatalf("Decoding page: %v", err)
+			}
+			if page.Total != tt.total {
+				t.Errorf("Expected total %d, got %d", tt.total, page.Total)
+			}
+			var domains []string
+			for _, e := range page.Entries {
+				domains = append(domains, e.Domain)
+			}
+			if strings.Join(domains, ",") != strings.Join(tt.domains, ",") {
+				t.Errorf("Expected domains %v, got %v", tt.domains, domains)
+			}
+		})
+	}
+
+	rec := get("/api/blocklist?employer=acme&per_page=1")
+	var page blocklistPage
+	json.NewDecoder(rec.Body).Decode(&page)
+	if e := page.Entries[0]; e.Employer != "Acme" || e.ActionType != "strike" || e.StartDate != "2026-01-05" {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+
+	for _, path := range []string{"/api/blocklist?page=0", "/api/blocklist?per_page=x"} {
+		if rec := get(path); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestBlocklistCheck(t *testing.T) {
+	get := func(handler http.Handler, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	s, store, _ := newTestServer(t)
+	if rec := get(s.Handler(), "/api/blocklist/check?domain=acme.com"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without a DNS server, got %d", rec.Code)
+	}
+
+	client := api.NewClient("https://api.example.com", "", time.Second)
+	client.SetBlocklistForTesting(&api.Blocklist{
+		BlockList: []api.BlockListItem{
+			{URL: "https://acme.com/careers", Domain: "acme.com", Employer: "Acme", StartDate: "2026-01-05",
+				ActionDetails: api.ActionDetails{ActionType: "strike"}},
+		},
+	})
+	if err := store.Apply(policy.State{
+		Groups: []policy.Group{{Name: "guests", Clients: []string{"10.9.0.0/16"}, Mode: policy.ModeOff}},
+	}); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	dnsServer, err := dns.NewServer("127.0.0.1:0", nil, time.Second, client, nil, nil, dns.WithPolicy(store))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	s, err = New(Config{ListenAddr: "127.0.0.1:0", AuthToken: testToken, Policy: store, DNS: dnsServer})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := s.Handler()
+
+	check := func(path string) blocklistCheck {
+		t.Helper()
+		rec := get(handler, path)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", path, rec.Code)
+		}
+		var result blocklistCheck
+		if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+			t.Fatalf("Decoding result: %v", err)
+		}
+		return result
+	}
+
+	got := check("/api/blocklist/check?domain=www.acme.com")
+	if !got.Blocked || got.Source != "blocklist" || got.Employer != "Acme" || got.Pattern != "https://acme.com/careers" ||
+		got.MatchedDomain != "acme.com" || got.ActionType != "strike" || got.Explanation == "" {
+		t.Errorf("Unexpected result %+v", got)
+	}
+	if got := check("/api/blocklist/check?domain=www.acme.com&client=10.9.0.1"); got.Blocked || got.Group != "guests" || got.Client != "10.9.0.1" {
+		t.Errorf("Expected the guests group to be exempt, got %+v", got)
+	}
+	if got := check("/api/blocklist/check?domain=example.org"); got.Blocked || got.Source != "" {
+		t.Errorf("Expected no match, got %+v", got)
+	}
+
+	for _, path := range []string{"/api/blocklist/check", "/api/blocklist/check?domain=acme.com&client=nope"} {
+		if rec := get(handler, path); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", path, rec.Code)
+		}
+	}
+
+	// With DNS disabled the check applies the policy and blocklist itself
+	if s, err = New(Config{ListenAddr: "127.0.0.1:0", AuthToken: testToken, Policy: store, Blocklist: client}); err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler = s.Handler()
+	if got := check("/api/blocklist/check?domain=www.acme.com"); !got.Blocked || got.Employer != "Acme" {
+		t.Errorf("Expected a block without a DNS server, got %+v", got)
+	}
+	if got := check("/api/blocklist/check?domain=www.acme.com&client=10.9.0.1"); got.Blocked || got.Group != "guests" {
+		t.Errorf("Expected the guests group to be exempt without a DNS server, got %+v", got)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "admin.sock")
+
+	// A socket left behind by a server that is gone is replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := Listen("unix:" + path)
+	if err != nil {
+		t.Fatalf("Listen over a stale socket failed: %v", err)
+	}
+	defer ln.Close()
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o660 {
+		t.Errorf("Expected mode 0660, got %v, %v", info.Mode().Perm(), err)
+	}
+
+	// One still in use is not
+	if _, err := Listen("unix:" + path); err == nil {
+		t.Error("Expected an error for a socket in use")
+	}
+}
+
+func TestControlEndpoints(t *testing.T) {
+	store, _ := policy.NewStore("")
+	refreshed := 0
+	var patched string
+	running := config.DefaultConfig()
+	running.Admin.AuthToken = testToken
+	s, err := New(Config{
+		ListenAddr:    "127.0.0.1:0",
+		AuthToken:     testToken,
+		Policy:        store,
+		Refresh:       func() { refreshed++ },
+		RunningConfig: func() *config.Config { return running },
+		PatchConfig: func(patch []byte) ([]string, error) {
+			patched = string(patch)
+			if strings.Contains(patched, "listen_addr") {
+				return nil, errors.New("dns.listen_addr cannot be changed without a restart")
+			}
+			return []string{"logging.level"}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	do := func(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	handler := s.Handler()
+
+	if rec := do(handler, http.MethodPost, "/api/blocklist/refresh", ""); rec.Code != http.StatusAccepted || refreshed != 1 {
+		t.Errorf("Expected a refresh to be requested, got %d and %d calls", rec.Code, refreshed)
+	}
+
+	rec := do(handler, http.MethodGet, "/api/config", "")
+	var got config.Config
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/config: %d, %v", rec.Code, err)
+	}
+	if got.Admin.AuthToken != config.Redaction || got.DNS.ListenAddr != running.DNS.ListenAddr {
+		t.Errorf("Expected the redacted running configuration, got %+v", got.Admin)
+	}
+
+	rec = do(handler, http.MethodPatch, "/api/config", `{"logging":{"level":"debug"}}`)
+	if rec.Code != http.StatusOK || patched != `{"logging":{"level":"debug"}}` || !strings.Contains(rec.Body.String(), "logging.level") {
+		t.Errorf("Unexpected PATCH result %d %s (patch %q)", rec.Code, rec.Body, patched)
+	}
+	if rec := do(handler, http.MethodPatch, "/api/config", `{"dns":{"listen_addr":":53"}}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a rejected patch to be a 400, got %d", rec.Code)
+	}
+
+	// Without the hooks, the endpoints do not exist
+	bare, _, _ := newTestServer(t)
+	for _, req := range [][2]string{{http.MethodPost, "/api/blocklist/refresh"}, {http.MethodGet, "/api/config"}, {http.MethodPatch, "/api/config"}} {
+		if rec := do(bare.Handler(), req[0], req[1], "{}"); rec.Code != http.StatusNotFound {
+			t.Errorf("%s %s: expected 404, got %d", req[0], req[1], rec.Code)
+		}
+	}
+}
+
+func TestDebugEndpoints(t *testing.T) {
+	get := func(handler http.Handler, path string, authed bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if authed {
+			req.Header.Set("Authorization", "Bearer "+testToken)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	s, store, _ := newTestServer(t)
+	if rec := get(s.Handler(), "/debug/vars", true); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 with debug off, got %d", rec.Code)
+	}
+
+	s, err := New(Config{ListenAddr: "127.0.0.1:0", AuthToken: testToken, Policy: store, Debug: true})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := s.Handler()
+
+	if rec := get(handler, "/debug/vars", false); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without the token, got %d", rec.Code)
+	}
+
+	rec := get(handler, "/debug/vars", true)
+	var vars map[string]json.RawMessage
+	if err := json.NewDecoder(rec.Body).Decode(&vars); err != nil {
+		t.Fatalf("Decoding /debug/vars: %v", err)
+	}
+	for _, name := range []string{"goroutines", "memstats"} {
+		if _, ok := vars[name]; !ok {
+			t.Errorf("Expected %s in /debug/vars", name)
+		}
+	}
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/goroutine?debug=1"} {
+		if rec := get(handler, path, true); rec.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d", path, rec.Code)
+		}
+	}
+}
+
+func TestMetricsServer(t *testing.T) {
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "opl_dns_queries_total 1\n")
+	})
+	get := func(s *MetricsServer, path, token string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	s, err := NewMetrics(MetricsConfig{ListenAddr: "127.0.0.1:0", AuthToken: "scrape", Metrics: metrics, Debug: true})
+	if err != nil {
+		t.Fatalf("NewMetrics failed: %v", err)
+	}
+	if code := get(s, "/metrics", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without the token, got %d", code)
+	}
+	if code := get(s, "/metrics", testToken); code != http.StatusUnauthorized {
+		t.Errorf("Expected the admin token refused, got %d", code)
+	}
+	for _, path := range []string{"/metrics", "/debug/vars"} {
+		if code := get(s, path, "scrape"); code != http.StatusOK {
+			t.Errorf("%s: expected 200 with the token, got %d", path, code)
+		}
+	}
+	if code := get(s, "/api/policy", "scrape"); code != http.StatusNotFound {
+		t.Errorf("Expected no admin API on the metrics listener, got %d", code)
+	}
+
+	s, _ = NewMetrics(MetricsConfig{ListenAddr: "127.0.0.1:0", Metrics: metrics})
+	if code := get(s, "/metrics", ""); code != http.StatusOK {
+		t.Errorf("Expected 200 without a token configured, got %d", code)
+	}
+	if code := get(s, "/debug/vars", ""); code != http.StatusNotFound {
+		t.Errorf("Expected 404 with debug off, got %d", code)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	store, _ := policy.NewStore("")
+	blocklist := api.NewClient("https://api.example.com", "", time.Second)
+	blocklist.SetBlocklistForTesting(&api.Blocklist{
+		Version:   "42",
+		TotalURLs: 1,
+		Employers: []api.Employer{{Name: "Acme", URLCount: 1}},
+		BlockList: []api.BlockListItem{{URL: "https://acme.com", Domain: "acme.com", Employer: "Acme"}},
+	})
+	running := config.DefaultConfig()
+	running.Admin.AuthToken = testToken
+	s, err := New(Config{
+		ListenAddr:    "127.0.0.1:0",
+		AuthToken:     testToken,
+		Policy:        store,
+		Blocklist:     blocklist,
+		RunningConfig: func() *config.Config { return running },
+		Version:       "1.2.3",
+		RecentLogs:    func() []byte { return []byte("level=INFO msg=hello\n") },
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/diag", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/gzip" {
+		t.Fatalf("Expected a gzip bundle, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Bundle is not gzipped: %v", err)
+	}
+	files := map[string]string{}
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Reading bundle: %v", err)
+		}
+		data, _ := io.ReadAll(tr)
+		files[path.Base(hdr.Name)] = string(data)
+	}
+
+	for _, name := range []string{"version.json", "config.json", "health.json", "blocklist.json", "logs.txt", "goroutines.txt"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("Expected %s in the bundle", name)
+		}
+	}
+	if !strings.Contains(files["version.json"], `"version": "1.2.3"`) {
+		t.Errorf("Expected the version in version.json, got:\n%s", files["version.json"])
+	}
+	if strings.Contains(files["config.json"], testToken) {
+		t.Error("Expected the admin token to be redacted from config.json")
+	}
+	if !strings.Contains(files["blocklist.json"], `"version": "42"`) || strings.Contains(files["blocklist.json"], "acme.com") {
+		t.Errorf("Expected blocklist metadata without entries, got:\n%s", files["blocklist.json"])
+	}
+	if files["logs.txt"] != "level=INFO msg=hello\n" {
+		t.Errorf("Unexpected logs.txt %q", files["logs.txt"])
+	}
+	if !strings.Contains(files["goroutines.txt"], "goroutine ") {
+		t.Error("Expected a goroutine dump")
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	store, _ := policy.NewStore("")
+	collector := stats.NewCollector()
+	s, err := New(Config{
+		ListenAddr:    "127.0.0.1:0",
+		AuthToken:     testToken,
+		Policy:        store,
+		Recorder:      collector,
+		RunningConfig: func() *config.Config { panic("boom") },
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/config", nil)
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 after a panic, got %d", rec.Code)
+	}
+	if got := collector.Panics()["admin"]; got != 1 {
+		t.Errorf("Expected 1 recorded panic, got %d", got)
+	}
+}
+
+func TestBlocklistVersionEndpoints(t *testing.T) {
+	domain := "one.example"
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]api.OPLBlocklistEntry{
+			"Acme": {MatchingURLRegexes: []string{domain}},
+		})
+	}))
+	defer apiServer.Close()
+	versions, err := api.OpenVersionStore(t.TempDir(), 5)
+	if err != nil {
+		t.Fatalf("OpenVersionStore failed: %v", err)
+	}
+	blocklist := api.NewClient(apiServer.URL, "", time.Second, api.WithVersionStore(versions))
+	for _, d := range []string{"one.example", "two.example"} {
+		domain = d
+		if _, err := blocklist.FetchBlocklist(context.Background()); err != nil {
+			t.Fatalf("FetchBlocklist failed: %v", err)
+		}
+	}
+
+	store, _ := policy.NewStore("")
+	s, err := New(Config{ListenAddr: "127.0.0.1:0", AuthToken: testToken, Policy: store, Blocklist: blocklist})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	do := func(handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	handler := s.Handler()
+
+	var list blocklistVersions
+	rec := do(handler, http.MethodGet, "/api/blocklist/versions", "")
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil || len(list.Versions) != 2 || list.Current != list.Versions[0].Hash || list.Pinned != "" {
+		t.Fatalf("Unexpected version list %d %+v (%v)", rec.Code, list, err)
+	}
+
+	rec = do(handler, http.MethodPost, "/api/blocklist/rollback", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), list.Versions[1].Hash) {
+		t.Errorf("Expected a rollback to the older version, got %d %s", rec.Code, rec.Body)
+	}
+	if _, blocked := blocklist.CheckDomain("one.example"); !blocked {
+		t.Error("Expected the older version enforced")
+	}
+	if rec := do(handler, http.MethodPost, "/api/blocklist/rollback", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 with nothing older to roll back to, got %d", rec.Code)
+	}
+	if rec := do(handler, http.MethodPost, "/api/blocklist/pin", `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a hash, got %d", rec.Code)
+	}
+	if rec := do(handler, http.MethodPost, "/api/blocklist/pin", `{"hash": "`+list.Versions[0].Hash[:10]+`"}`); rec.Code != http.StatusOK {
+		t.Errorf("Expected a pin by prefix, got %d %s", rec.Code, rec.Body)
+	}
+	if rec := do(handler, http.MethodDelete, "/api/blocklist/pin", ""); rec.Code != http.StatusOK || versions.Pinned() != "" {
+		t.Errorf("Expected an unpin, got %d %s", rec.Code, rec.Body)
+	}
+
+	// Without a version store, the endpoints do not exist
+	bare, _, _ := newTestServer(t)
+	if rec := do(bare.Handler(), http.MethodGet, "/api/blocklist/versions", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 without versions, got %d", rec.Code)
+	}
+}
+
+func TestPihole(t *testing.T) {
+	const piholeToken = "pihole-token"
+	store, _ := policy.NewStore("")
+	client := api.NewClient("https://api.example.com", "", time.Second)
+	client.SetBlocklistForTesting(&api.Blocklist{
+		BlockList: []api.BlockListItem{
+			{Domain: "acme.com", Employer: "Acme"},
+			{Domain: "Acme.com", Employer: "Acme"},
+			{Domain: "ended.example", Employer: "Ended", ExpiresAt: time.Now().Add(-time.Hour)},
+		},
+	})
+	collector := stats.NewCollector()
+	for range 1234 {
+		collector.RecordQuery()
+	}
+	collector.RecordBlock("acme.com")
+	collector.RecordBlock("www.acme.com")
+	collector.RecordBlock("acme.com")
+	dnsServer, err := dns.NewServer("127.0.0.1:0", nil, time.Second, client, nil, slog.New(slog.DiscardHandler))
+	if err != nil {
+		t.Fatalf("NewServer failed: %v", err)
+	}
+	s, err := New(Config{
+		ListenAddr:  "127.0.0.1:0",
+		AuthToken:   testToken,
+		Policy:      store,
+		Blocklist:   client,
+		Stats:       collector,
+		DNS:         dnsServer,
+		PiholeToken: piholeToken,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	handler := s.Handler()
+
+	get := func(query string) *httptest.ResponseRecorder {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/api.php?"+query, nil))
+		return rec
+	}
+	decode := func(query string, v any) {
+		t.Helper()
+		rec := get(query)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d: %s", query, rec.Code, rec.Body)
+		}
+		if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+			t.Fatalf("%s: decoding: %v", query, err)
+		}
+	}
+
+	var version map[string]int
+	if decode("version", &version); version["version"] != piholeAPIVersion {
+		t.Errorf("Expected the API version without auth, got %v", version)
+	}
+	for _, query := range []string{"summaryRaw", "summaryRaw&auth=" + testToken, "disable&auth=wrong"} {
+		if body := get(query).Body.String(); strings.TrimSpace(body) != "[]" {
+			t.Errorf("%s: expected an empty list without the Pi-hole token, got %s", query, body)
+		}
+	}
+
+	var raw piholeSummary
+	decode("summaryRaw&auth="+piholeToken, &raw)
+	if raw.DomainsBeingBlocked != 1 || raw.DNSQueriesToday != 1237 || raw.AdsBlockedToday != 3 || raw.QueriesForwarded != 1234 ||
+		raw.Status != "enabled" || !raw.GravityLastUpdated.FileExists {
+		t.Errorf("Unexpected raw summary %+v", raw)
+	}
+	var formatted map[string]any
+	decode("summary&auth="+piholeToken, &formatted)
+	if formatted["dns_queries_today"] != "1,237" || formatted["ads_percentage_today"] != "0.2" {
+		t.Errorf("Expected formatted counts, got %v", formatted)
+	}
+
+	var top map[string]map[string]int64
+	decode("topItems=1&auth="+piholeToken, &top)
+	if len(top["top_ads"]) != 1 || top["top_ads"]["acme.com"] != 2 || top["top_queries"] == nil {
+		t.Errorf("Expected acme.com as the top blocked domain, got %v", top)
+	}
+	if body := get("recentBlocked&auth=" + piholeToken).Body.String(); body != "acme.com" {
+		t.Errorf("Expected acme.com blocked last, got %q", body)
+	}
+
+	var status map[string]string
+	decode("disable=300&auth="+piholeToken, &status)
+	if paused, until := dnsServer.BlockingPaused(); status["status"] != "disabled" || !paused || time.Until(until) < 299*time.Second {
+		t.Errorf("Expected blocking paused for 5 minutes, got %v (paused %v until %v)", status, paused, until)
+	}
+	if health := s.checkHealth(); !health.DNS.BlockingPaused {
+		t.Errorf("Expected /health to report the pause, got %+v", health.DNS)
+	}
+	decode("enable&auth="+piholeToken, &status)
+	if paused, _ := dnsServer.BlockingPaused(); status["status"] != "enabled" || paused {
+		t.Errorf("Expected blocking resumed, got %v", status)
+	}
+	if rec := get("disable=soon&auth=" + piholeToken); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a bad duration rejected, got %d", rec.Code)
+	}
+
+	unset, _, _ := newTestServer(t)
+	rec := httptest.NewRecorder()
+	unset.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/admin/api.php?version", nil))
+	if rec.Code == http.StatusOK {
+		t.Errorf("Expected no Pi-hole API without a token, got %d", rec.Code)
+	}
+
+	if got := groupThousands(-1234567); got != "-1,234,567" {
+		t.Errorf("Expected -1,234,567, got %s", got)
+	}
+}
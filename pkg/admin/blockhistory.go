@@ -0,0 +1,112 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/blocklog"
+)
+
+const (
+	// defaultHistoryDays is how many days /api/history/blocks covers when
+	// no range is given.
+	defaultHistoryDays = 7
+
+	// maxHistoryDays bounds the range of one /api/history/blocks request.
+	maxHistoryDays = 366
+
+	defaultEventLimit = 1000
+	maxEventLimit     = 10000
+)
+
+// blockHistoryResponse is the body of /api/history/blocks.
+type blockHistoryResponse struct {
+	Days []blocklog.DaySummary `json:"days"`
+}
+
+// blockEventsResponse is the body of /api/history/blocks/{date}.
+type blockEventsResponse struct {
+	Date   string           `json:"date"`
+	Events []blocklog.Event `json:"events"`
+}
+
+// handleBlockHistory serves per-day block counts by employer. The from and
+// to query parameters are inclusive YYYY-MM-DD dates in UTC and default to
+// the last week; employer restricts the counts to one employer.
+func (s *Server) handleBlockHistory(w http.ResponseWriter, r *http.Request) {
+	if s.blockLog == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	today := time.Now().UTC()
+	to, err := dateParam(query.Get("to"), today)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {"to: " + err.Error()}})
+		return
+	}
+	from, err := dateParam(query.Get("from"), to.AddDate(0, 0, 1-defaultHistoryDays))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {"from: " + err.Error()}})
+		return
+	}
+	if from.After(to) {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {"from must not be after to"}})
+		return
+	}
+	if to.Sub(from) >= maxHistoryDays*24*time.Hour {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {fmt.Sprintf("range must not exceed %d days", maxHistoryDays)}})
+		return
+	}
+
+	days, err := s.blockLog.Summarize(from, to, query.Get("employer"))
+	if err != nil {
+		s.logger.Error("Error reading block history", "error", err)
+		http.Error(w, "Error reading block history", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, blockHistoryResponse{Days: days})
+}
+
+// handleBlockEvents serves the individual block events of one UTC day,
+// oldest first. employer restricts them to one employer and limit caps how
+// many are returned.
+func (s *Server) handleBlockEvents(w http.ResponseWriter, r *http.Request) {
+	if s.blockLog == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	date, err := time.Parse(time.DateOnly, r.PathValue("date"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {"date must be YYYY-MM-DD"}})
+		return
+	}
+	limit, ok := positiveParam(r.URL.Query().Get("limit"), defaultEventLimit)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {"limit must be a positive integer"}})
+		return
+	}
+
+	events, err := s.blockLog.Events(date, r.URL.Query().Get("employer"), min(limit, maxEventLimit))
+	if err != nil {
+		s.logger.Error("Error reading block history", "error", err)
+		http.Error(w, "Error reading block history", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, blockEventsResponse{Date: date.Format(time.DateOnly), Events: events})
+}
+
+// dateParam parses a YYYY-MM-DD date, returning fallback if value is empty.
+func dateParam(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("must be YYYY-MM-DD")
+	}
+	return t, nil
+}
@@ -0,0 +1,180 @@
+package admin
+
+import (
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/dns"
+)
+
+// Blocklist listing page sizes.
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// blocklistPage is the body of GET /api/blocklist.
+type blocklistPage struct {
+	Total   int              `json:"total"`
+	Page    int              `json:"page"`
+	PerPage int              `json:"per_page"`
+	Entries []blocklistEntry `json:"entries"`
+}
+
+// blocklistEntry is one enforced domain.
+type blocklistEntry struct {
+	Domain     string `json:"domain"`
+	Employer   string `json:"employer"`
+	ActionType string `json:"action_type,omitempty"`
+	StartDate  string `json:"start_date,omitempty"`
+}
+
+// handleBlocklist lists the domains currently enforced from the OPL
+// blocklist, sorted by domain. The employer query parameter restricts the
+// list to one employer (case-insensitive); page and per_page select a page,
+// starting from 1.
+func (s *Server) handleBlocklist(w http.ResponseWriter, r *http.Request) {
+	if s.blocklist == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	page, ok := positiveParam(query.Get("page"), 1)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {"page must be a positive integer"}})
+		return
+	}
+	perPage, ok := positiveParam(query.Get("per_page"), defaultPageSize)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {"per_page must be a positive integer"}})
+		return
+	}
+	perPage = min(perPage, maxPageSize)
+
+	cached := s.blocklist.GetCachedBlocklist()
+	if cached == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string][]string{"errors": {"no blocklist loaded yet"}})
+		return
+	}
+
+	employer := query.Get("employer")
+	var entries []blocklistEntry
+	for _, item := range cached.BlockList {
+		if employer != "" && !strings.EqualFold(item.Employer, employer) {
+			continue
+		}
+		entries = append(entries, blocklistEntry{
+			Domain:     item.Domain,
+			Employer:   item.Employer,
+			ActionType: item.ActionDetails.ActionType,
+			StartDate:  item.StartDate,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Domain < entries[j].Domain })
+
+	result := blocklistPage{
+		Total:   len(entries),
+		Page:    page,
+		PerPage: perPage,
+		Entries: []blocklistEntry{},
+	}
+	if start := (page - 1) * perPage; start < len(entries) {
+		result.Entries = entries[start:min(start+perPage, len(entries))]
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// positiveParam parses an optional positive integer query parameter,
+// returning fallback when it is absent.
+func positiveParam(value string, fallback int) (int, bool) {
+	if value == "" {
+		return fallback, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n, true
+}
+
+// blocklistCheck is the body of GET /api/blocklist/check.
+type blocklistCheck struct {
+	Domain        string `json:"domain"`
+	Client        string `json:"client,omitempty"`
+	Blocked       bool   `json:"blocked"`
+	Source        string `json:"source,omitempty"`
+	Group         string `json:"group,omitempty"`
+	Tenant        string `json:"tenant,omitempty"`
+	Employer      string `json:"employer,omitempty"`
+	Pattern       string `json:"pattern,omitempty"`
+	MatchedDomain string `json:"matched_domain,omitempty"`
+	ActionType    string `json:"action_type,omitempty"`
+	Organization  string `json:"organization,omitempty"`
+	Description   string `json:"description,omitempty"`
+	StartDate     string `json:"start_date,omitempty"`
+	ExpiresAt     string `json:"expires_at,omitempty"`
+	MoreInfoURL   string `json:"more_info_url,omitempty"`
+	Explanation   string `json:"explanation"`
+}
+
+// handleBlocklistCheck reports whether the running server would block the
+// domain query parameter, and why. The optional client parameter is the
+// address of the client asking, which selects its group.
+func (s *Server) handleBlocklistCheck(w http.ResponseWriter, r *http.Request) {
+	if s.dns == nil && s.blocklist == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	domain := query.Get("domain")
+	if domain == "" {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {"domain is required"}})
+		return
+	}
+	var client netip.Addr
+	if v := query.Get("client"); v != "" {
+		var err error
+		if client, err = netip.ParseAddr(v); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {"client must be an IP address"}})
+			return
+		}
+	}
+
+	var d dns.Decision
+	if s.dns != nil {
+		d = s.dns.Explain(client, domain)
+	} else {
+		d = dns.Decide(s.policy.Policy(), s.blocklist, client, domain)
+	}
+	result := blocklistCheck{
+		Domain:      d.Domain,
+		Blocked:     d.Blocked,
+		Source:      d.Source,
+		Group:       d.Group,
+		Tenant:      d.Tenant,
+		Explanation: d.Explain(),
+	}
+	if client.IsValid() {
+		result.Client = client.String()
+	}
+	if item := d.Item; item != nil {
+		result.Employer = item.Employer
+		result.Pattern = item.URL
+		result.MatchedDomain = item.Domain
+		result.ActionType = item.ActionDetails.ActionType
+		result.Organization = item.ActionDetails.Organization
+		result.Description = item.ActionDetails.Description
+		result.StartDate = item.StartDate
+		result.MoreInfoURL = item.MoreInfoURL
+		if !item.ExpiresAt.IsZero() {
+			result.ExpiresAt = item.ExpiresAt.Format(time.RFC3339)
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
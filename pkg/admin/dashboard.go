@@ -0,0 +1,207 @@
+package admin
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+)
+
+var dashboardTemplate = template.Must(template.ParseFS(templateFS, "templates/dashboard.html"))
+
+// dashboardRefresh is how often the dashboard page reloads itself. The page
+// uses a meta refresh rather than script so the CSP can stay script-free.
+const dashboardRefresh = 10 * time.Second
+
+// dashboard is the body of /api/stats and the data rendered by
+// templates/dashboard.html. The activity chart is HTML only; its data is
+// served by /api/stats/history.
+type dashboard struct {
+	GeneratedAt  time.Time             `json:"generated_at"`
+	Uptime       string                `json:"uptime,omitempty"`
+	Queries      *queryStats           `json:"queries,omitempty"`
+	Activity     *activityChart        `json:"-"`
+	TopBlocked   []stats.DomainCount   `json:"top_blocked,omitempty"`
+	TopEmployers []stats.EmployerCount `json:"top_blocked_employers,omitempty"`
+	TopClients   []stats.ClientCount   `json:"top_clients,omitempty"`
+	Latency      *latencySummary       `json:"latency,omitempty"`
+	Upstream     *upstreamHealth       `json:"upstream,omitempty"`
+	RateLimited  map[string]int64      `json:"rate_limited,omitempty"`
+	Panics       map[string]int64      `json:"panics,omitempty"`
+	Blocklist    *blocklistSummary     `json:"blocklist,omitempty"`
+
+	// Refresh is the page reload interval in seconds; HTML only.
+	Refresh int `json:"-"`
+}
+
+type queryStats struct {
+	Total          int64   `json:"total"`
+	Blocked        int64   `json:"blocked"`
+	Forwarded      int64   `json:"forwarded"`
+	BlockedPercent float64 `json:"blocked_percent"`
+
+	// Types counts queries by type; Rcodes counts answers by rcode
+	Types  map[string]int64 `json:"types,omitempty"`
+	Rcodes map[string]int64 `json:"rcodes,omitempty"`
+}
+
+type latencySummary struct {
+	Query    latencyPercentiles `json:"query"`
+	Upstream latencyPercentiles `json:"upstream"`
+}
+
+type latencyPercentiles struct {
+	Count  int64   `json:"count"`
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P90Ms  float64 `json:"p90_ms"`
+	P99Ms  float64 `json:"p99_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+type upstreamHealth struct {
+	Rcodes             map[string]int64 `json:"rcodes"`
+	SoftFailureRetries int64            `json:"soft_failure_retries"`
+}
+
+type blocklistSummary struct {
+	LastFetch       time.Time         `json:"last_fetch,omitzero"`
+	URLs            int               `json:"urls"`
+	StreamConnected bool              `json:"stream_connected"`
+	Fetches         fetchSummary      `json:"fetches"`
+	Employers       []employerSummary `json:"employers"`
+}
+
+type fetchSummary struct {
+	Total               int64   `json:"total"`
+	NotModified         int64   `json:"not_modified"`
+	Failures            int64   `json:"failures"`
+	NotModifiedRatio    float64 `json:"not_modified_ratio"`
+	LastDurationMs      int64   `json:"last_duration_ms"`
+	LastBytes           int64   `json:"last_bytes"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+}
+
+type employerSummary struct {
+	Name         string   `json:"name"`
+	Organization string   `json:"organization,omitempty"`
+	ActionType   string   `json:"action_type,omitempty"`
+	Status       string   `json:"status,omitempty"`
+	Location     string   `json:"location,omitempty"`
+	StartDate    string   `json:"start_date,omitempty"`
+	MoreInfoURL  string   `json:"more_info_url,omitempty"`
+	Domains      []string `json:"domains"`
+}
+
+// topBlockedLimit is the number of top blocked domains and employers shown.
+const topBlockedLimit = 20
+
+// topClientsLimit is the number of clients shown when per-client stats are
+// enabled.
+const topClientsLimit = 20
+
+// buildDashboard gathers the current statistics and blocklist. Sections
+// whose source was not configured are left out.
+func (s *Server) buildDashboard() dashboard {
+	d := dashboard{
+		GeneratedAt: time.Now(),
+		Refresh:     int(dashboardRefresh.Seconds()),
+	}
+
+	if s.collector != nil {
+		total, blocked, forwarded, _ := s.collector.Snapshot()
+		d.Uptime = s.collector.Uptime().Truncate(time.Second).String()
+		d.Queries = &queryStats{
+			Total:     total,
+			Blocked:   blocked,
+			Forwarded: forwarded,
+			Types:     s.collector.QueryTypes(),
+			Rcodes:    s.collector.ResponseRcodes(),
+		}
+		if total > 0 {
+			d.Queries.BlockedPercent = float64(blocked) * 100 / float64(total)
+		}
+		d.Activity = buildActivityChart(s.collector.History(stats.HistoryWindow))
+		d.TopBlocked = s.collector.TopBlockedDomains(topBlockedLimit)
+		d.TopEmployers = s.collector.TopBlockedEmployers(topBlockedLimit)
+		d.TopClients = s.collector.TopClients(topClientsLimit)
+		d.Latency = &latencySummary{
+			Query:    latencyPercentiles(s.collector.QueryLatency()),
+			Upstream: latencyPercentiles(s.collector.UpstreamLatency()),
+		}
+		d.Upstream = &upstreamHealth{
+			Rcodes:             s.collector.UpstreamRcodes(),
+			SoftFailureRetries: s.collector.SoftFailureRetries(),
+		}
+		d.RateLimited = s.collector.RateLimited()
+		d.Panics = s.collector.Panics()
+	}
+
+	if s.blocklist != nil {
+		summary := &blocklistSummary{
+			LastFetch:       s.blocklist.LastFetchTime(),
+			StreamConnected: s.blocklist.StreamConnected(),
+		}
+		if s.collector != nil {
+			f := s.collector.APIFetchStats()
+			summary.Fetches = fetchSummary{
+				Total:            f.Fetches,
+				NotModified:      f.NotModified,
+				Failures:         f.Failures,
+				NotModifiedRatio: f.NotModifiedRatio,
+				LastDurationMs:   f.LastDurationMs,
+				LastBytes:        f.LastBytes,
+			}
+		}
+		summary.Fetches.ConsecutiveFailures = s.blocklist.ConsecutiveFailures()
+
+		if cached := s.blocklist.GetCachedBlocklist(); cached != nil {
+			summary.URLs = cached.TotalURLs
+			summary.Employers = summarizeEmployers(cached.BlockList)
+		}
+		d.Blocklist = summary
+	}
+
+	return d
+}
+
+// summarizeEmployers groups blocklist items by employer, sorted by name.
+func summarizeEmployers(items []api.BlockListItem) []employerSummary {
+	index := make(map[string]int)
+	var employers []employerSummary
+	for _, item := range items {
+		i, ok := index[item.Employer]
+		if !ok {
+			i = len(employers)
+			index[item.Employer] = i
+			employers = append(employers, employerSummary{
+				Name:         item.Employer,
+				Organization: item.ActionDetails.Organization,
+				ActionType:   item.ActionDetails.ActionType,
+				Status:       item.ActionDetails.Status,
+				Location:     item.Location,
+				StartDate:    item.StartDate,
+				MoreInfoURL:  item.MoreInfoURL,
+			})
+		}
+		employers[i].Domains = append(employers[i].Domains, item.Domain)
+	}
+	sort.Slice(employers, func(i, j int) bool { return employers[i].Name < employers[j].Name })
+	return employers
+}
+
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	if err := dashboardTemplate.Execute(w, s.buildDashboard()); err != nil {
+		s.logger.Error("Error rendering dashboard", "error", err)
+	}
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.buildDashboard())
+}
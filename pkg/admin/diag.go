@@ -0,0 +1,165 @@
+package admin
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// started approximates when the process started, for the uptime in
+// diagnostics bundles.
+var started = time.Now()
+
+// diagVersion is version.json in a diagnostics bundle.
+type diagVersion struct {
+	Version       string    `json:"version"`
+	GoVersion     string    `json:"go_version"`
+	OS            string    `json:"os"`
+	Arch          string    `json:"arch"`
+	CPUs          int       `json:"cpus"`
+	Goroutines    int       `json:"goroutines"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+	CollectedAt   time.Time `json:"collected_at"`
+}
+
+// diagBlocklist is blocklist.json in a diagnostics bundle: what was
+// fetched, without the entries themselves.
+type diagBlocklist struct {
+	Loaded          bool            `json:"loaded"`
+	Version         string          `json:"version,omitempty"`
+	GeneratedAt     string          `json:"generated_at,omitempty"`
+	LastFetch       time.Time       `json:"last_fetch,omitzero"`
+	URLs            int             `json:"urls"`
+	Employers       []diagEmployer  `json:"employers"`
+	FetchFailures   int             `json:"consecutive_fetch_failures"`
+	StreamConnected bool            `json:"stream_connected"`
+	Lint            json.RawMessage `json:"lint,omitempty"`
+}
+
+type diagEmployer struct {
+	Name string `json:"name"`
+	URLs int    `json:"urls"`
+}
+
+// handleDiagnostics serves a gzipped tarball for attaching to bug reports:
+// the version and platform, the configuration in effect with secrets
+// redacted, the health report, blocklist metadata, recent log output and a
+// dump of every goroutine.
+func (s *Server) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	now := time.Now().UTC()
+	name := "opl-dns-diag-" + now.Format("20060102-150405")
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`.tar.gz"`)
+	if err := s.writeDiagnostics(w, name, now); err != nil {
+		s.logger.Warn("Error writing diagnostics bundle", "error", err)
+	}
+}
+
+// writeDiagnostics writes the diagnostics bundle to w with every file under
+// dir.
+func (s *Server) writeDiagnostics(w io.Writer, dir string, now time.Time) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	add := func(name string, data []byte) error {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    dir + "/" + name,
+			Mode:    0o644,
+			Size:    int64(len(data)),
+			ModTime: now,
+		}); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	addJSON := func(name string, v any) error {
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		return add(name, append(data, '\n'))
+	}
+
+	files := []func() error{
+		func() error {
+			return addJSON("version.json", diagVersion{
+				Version:       s.version,
+				GoVersion:     runtime.Version(),
+				OS:            runtime.GOOS,
+				Arch:          runtime.GOARCH,
+				CPUs:          runtime.NumCPU(),
+				Goroutines:    runtime.NumGoroutine(),
+				UptimeSeconds: int64(time.Since(started).Seconds()),
+				CollectedAt:   now,
+			})
+		},
+		func() error {
+			if s.running == nil {
+				return nil
+			}
+			return addJSON("config.json", s.running().Redacted())
+		},
+		func() error {
+			return addJSON("health.json", s.checkHealth())
+		},
+		func() error {
+			if s.blocklist == nil {
+				return nil
+			}
+			return addJSON("blocklist.json", s.blocklistMetadata())
+		},
+		func() error {
+			if s.recentLogs == nil {
+				return nil
+			}
+			return add("logs.txt", s.recentLogs())
+		},
+		func() error {
+			var buf bytes.Buffer
+			if err := pprof.Lookup("goroutine").WriteTo(&buf, 2); err != nil {
+				return err
+			}
+			return add("goroutines.txt", buf.Bytes())
+		},
+	}
+	for _, file := range files {
+		if err := file(); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// blocklistMetadata describes the cached blocklist without its entries.
+func (s *Server) blocklistMetadata() diagBlocklist {
+	meta := diagBlocklist{
+		LastFetch:       s.blocklist.LastFetchTime(),
+		FetchFailures:   s.blocklist.ConsecutiveFailures(),
+		StreamConnected: s.blocklist.StreamConnected(),
+		Employers:       []diagEmployer{},
+	}
+	if cached := s.blocklist.GetCachedBlocklist(); cached != nil {
+		meta.Loaded = true
+		meta.Version = cached.Version
+		meta.GeneratedAt = cached.GeneratedAt
+		meta.URLs = cached.TotalURLs
+		for _, e := range cached.Employers {
+			meta.Employers = append(meta.Employers, diagEmployer{Name: e.Name, URLs: e.URLCount})
+		}
+	}
+	if report := s.blocklist.LintReport(); report != nil {
+		meta.Lint, _ = json.Marshal(report)
+	}
+	return meta
+}
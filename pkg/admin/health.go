@@ -0,0 +1,222 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+)
+
+// Overall health states. A degraded server still answers queries and
+// enforces the blocklist it has, so it stays ready.
+const (
+	healthOK       = "ok"
+	healthDegraded = "degraded"
+	healthStarting = "starting"
+)
+
+// healthStatus is the body of /health and /readyz.
+type healthStatus struct {
+	Status   string   `json:"status"`
+	Problems []string `json:"problems,omitempty"`
+
+	DNS           *dnsHealth            `json:"dns,omitempty"`
+	Upstreams     []dns.UpstreamStatus  `json:"upstreams,omitempty"`
+	Blocklist     *blocklistHealth      `json:"blocklist,omitempty"`
+	StatsReporter *stats.ReporterStatus `json:"stats_reporter,omitempty"`
+	Tenants       []tenantHealth        `json:"tenants,omitempty"`
+}
+
+// tenantHealth reports on a tenant's blocklist and stats reporter.
+type tenantHealth struct {
+	Name          string                `json:"name"`
+	Blocklist     *blocklistHealth      `json:"blocklist"`
+	StatsReporter *stats.ReporterStatus `json:"stats_reporter,omitempty"`
+}
+
+type dnsHealth struct {
+	Serving bool   `json:"serving"`
+	Addr    string `json:"addr,omitempty"`
+
+	// BlockingPaused is set while blocking is paused, until PausedUntil
+	// or, if that is unset, until it is resumed
+	BlockingPaused bool      `json:"blocking_paused,omitempty"`
+	PausedUntil    time.Time `json:"paused_until,omitzero"`
+
+	// RateLimitEvictions counts client networks the rate limiter forgot
+	// early because it was tracking as many as it can, as in a flood from
+	// spoofed sources
+	RateLimitEvictions uint64 `json:"rate_limit_evictions,omitempty"`
+}
+
+type blocklistHealth struct {
+	Loaded          bool      `json:"loaded"`
+	LastFetch       time.Time `json:"last_fetch,omitzero"`
+	AgeSeconds      int64     `json:"age_seconds"`
+	Stale           bool      `json:"stale"`
+	URLs            int       `json:"urls"`
+	Employers       int       `json:"employers"`
+	StreamConnected bool      `json:"stream_connected"`
+	FetchFailures   int       `json:"consecutive_fetch_failures"`
+	LintErrors      int       `json:"lint_errors"`
+	LintWarnings    int       `json:"lint_warnings"`
+
+	// PinnedVersion is set while a blocklist version is pinned and fetched
+	// blocklists are not enforced
+	PinnedVersion string `json:"pinned_version,omitempty"`
+}
+
+// checkHealth reports on each configured component. The server is
+// "starting" until the DNS listeners serve and the first blocklist has
+// loaded, and "degraded" while the blocklist is stale, every upstream is
+// failing, or the last stats report failed. A tenant's blocklist or stats
+// report failing only degrades the server, since the other tenants are
+// still served.
+func (s *Server) checkHealth() healthStatus {
+	status := healthStatus{Status: healthOK}
+	var notReady, degraded []string
+
+	if s.dns != nil {
+		d := &dnsHealth{Serving: s.dns.Serving()}
+		if addr := s.dns.Addr(); addr != nil {
+			d.Addr = addr.String()
+		}
+		d.BlockingPaused, d.PausedUntil = s.dns.BlockingPaused()
+		d.RateLimitEvictions = s.dns.RateLimitEvictions()
+		status.DNS = d
+		if !d.Serving {
+			notReady = append(notReady, "DNS listeners are not serving")
+		}
+
+		status.Upstreams = s.dns.UpstreamHealth()
+		failing := 0
+		for _, u := range status.Upstreams {
+			if u.Failing() {
+				failing++
+			}
+		}
+		if failing > 0 && failing == len(status.Upstreams) {
+			degraded = append(degraded, "all upstream resolvers are failing")
+		}
+	}
+
+	if s.blocklist != nil {
+		bl := s.blocklistHealth(s.blocklist)
+		if bl.Stale {
+			degraded = append(degraded, fmt.Sprintf("blocklist is older than %s", s.staleAfter))
+		}
+		status.Blocklist = bl
+
+		if !bl.Loaded {
+			notReady = append(notReady, "no blocklist loaded yet")
+		}
+	}
+
+	if s.reporter != nil {
+		r := s.reporter.Status()
+		status.StatsReporter = &r
+		if r.LastError != "" {
+			degraded = append(degraded, "last stats report failed")
+		}
+	}
+
+	for _, t := range s.tenants {
+		th := tenantHealth{Name: t.Name, Blocklist: s.blocklistHealth(t.Blocklist)}
+		switch {
+		case !th.Blocklist.Loaded:
+			degraded = append(degraded, fmt.Sprintf("tenant %q has no blocklist loaded yet", t.Name))
+		case th.Blocklist.Stale:
+			degraded = append(degraded, fmt.Sprintf("tenant %q blocklist is older than %s", t.Name, s.staleAfter))
+		}
+		if t.Reporter != nil {
+			r := t.Reporter.Status()
+			th.StatsReporter = &r
+			if r.LastError != "" {
+				degraded = append(degraded, fmt.Sprintf("tenant %q last stats report failed", t.Name))
+			}
+		}
+		status.Tenants = append(status.Tenants, th)
+	}
+
+	switch {
+	case len(notReady) > 0:
+		status.Status = healthStarting
+		status.Problems = notReady
+	case len(degraded) > 0:
+		status.Status = healthDegraded
+		status.Problems = degraded
+	}
+	return status
+}
+
+// blocklistHealth reports on the blocklist fetched by client.
+func (s *Server) blocklistHealth(client *api.Client) *blocklistHealth {
+	bl := &blocklistHealth{
+		LastFetch:       client.LastFetchTime(),
+		StreamConnected: client.StreamConnected(),
+		FetchFailures:   client.ConsecutiveFailures(),
+	}
+	if cached := client.GetCachedBlocklist(); cached != nil {
+		bl.Loaded = true
+		bl.URLs = cached.TotalURLs
+		bl.Employers = len(cached.Employers)
+	}
+	if store := client.VersionStore(); store != nil {
+		bl.PinnedVersion = store.Pinned()
+	}
+	if report := client.LintReport(); report != nil {
+		bl.LintErrors = report.Errors()
+		bl.LintWarnings = report.Warnings()
+	}
+	if !bl.LastFetch.IsZero() {
+		age := time.Since(bl.LastFetch)
+		bl.AgeSeconds = int64(age.Seconds())
+		bl.Stale = s.staleAfter > 0 && age > s.staleAfter
+	}
+	return bl
+}
+
+// handleHealth reports the state of every component. It reveals no policy
+// or query data, so it is served without authentication for load balancers
+// and monitoring. It returns 503 until the server is ready.
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	status := s.checkHealth()
+	writeJSON(w, healthCode(status), status)
+}
+
+// handleReadyz is the readiness probe: 200 once the server can answer
+// queries with a blocklist, including while degraded, 503 before.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	status := s.checkHealth()
+	writeJSON(w, healthCode(status), healthStatus{Status: status.Status, Problems: status.Problems})
+}
+
+// handleLivez is the liveness probe. Answering at all shows the process is
+// not wedged, so it always returns 200.
+func (s *Server) handleLivez(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, healthStatus{Status: healthOK})
+}
+
+func healthCode(status healthStatus) int {
+	if status.Status == healthStarting {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusOK
+}
+
+// handleLintReport returns the full lint report for the current blocklist.
+func (s *Server) handleLintReport(w http.ResponseWriter, r *http.Request) {
+	if s.blocklist == nil {
+		http.NotFound(w, r)
+		return
+	}
+	report := s.blocklist.LintReport()
+	if report == nil {
+		writeJSON(w, http.StatusServiceUnavailable, map[string][]string{"errors": {"no blocklist loaded yet"}})
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,105 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+)
+
+// historyResponse is the body of /api/stats/history.
+type historyResponse struct {
+	IntervalSeconds int            `json:"interval_seconds"`
+	Points          []historyPoint `json:"points"`
+}
+
+type historyPoint struct {
+	Time     time.Time `json:"time"`
+	Queries  int64     `json:"queries"`
+	Blocked  int64     `json:"blocked"`
+	Bypasses int64     `json:"bypasses"`
+}
+
+// activityChart is the per-minute query chart on the dashboard, drawn as
+// inline SVG so the page needs no script.
+type activityChart struct {
+	// Width is the number of minutes covered; the chart's viewBox is
+	// Width by activityChartHeight.
+	Width  int
+	Height int
+
+	// QueryLine and BlockedLine are SVG polyline points, both scaled to
+	// PeakQueries.
+	QueryLine   string
+	BlockedLine string
+
+	Since       time.Time
+	Queries     int64
+	Blocked     int64
+	PeakQueries int64
+}
+
+const activityChartHeight = 40
+
+// handleHistory serves per-minute query counts for the last day. The minutes
+// query parameter limits the response to the most recent minutes.
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if s.collector == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	maxMinutes := int(stats.HistoryWindow / time.Minute)
+	minutes, ok := positiveParam(r.URL.Query().Get("minutes"), maxMinutes)
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {"minutes must be a positive integer"}})
+		return
+	}
+	minutes = min(minutes, maxMinutes)
+
+	result := historyResponse{
+		IntervalSeconds: int(time.Minute / time.Second),
+		Points:          []historyPoint{},
+	}
+	for _, p := range s.collector.History(time.Duration(minutes-1) * time.Minute) {
+		result.Points = append(result.Points, historyPoint(p))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// buildActivityChart charts points, or returns nil if there are too few to
+// draw a line.
+func buildActivityChart(points []stats.HistoryPoint) *activityChart {
+	if len(points) < 2 {
+		return nil
+	}
+
+	chart := &activityChart{
+		Width:  len(points) - 1,
+		Height: activityChartHeight,
+		Since:  points[0].Time,
+	}
+	for _, p := range points {
+		chart.Queries += p.Queries
+		chart.Blocked += p.Blocked
+		chart.PeakQueries = max(chart.PeakQueries, p.Queries)
+	}
+
+	scale := max(chart.PeakQueries, 1)
+	line := func(value func(stats.HistoryPoint) int64) string {
+		var b strings.Builder
+		for i, p := range points {
+			if i > 0 {
+				b.WriteByte(' ')
+			}
+			y := float64(activityChartHeight) * float64(scale-value(p)) / float64(scale)
+			fmt.Fprintf(&b, "%d,%.1f", i, y)
+		}
+		return b.String()
+	}
+	chart.QueryLine = line(func(p stats.HistoryPoint) int64 { return p.Queries })
+	chart.BlockedLine = line(func(p stats.HistoryPoint) int64 { return p.Blocked })
+	return chart
+}
@@ -0,0 +1,130 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// unixPrefix marks a listen address as a Unix socket path.
+const unixPrefix = "unix:"
+
+// Listen opens the admin listener for addr, which is a TCP host:port or
+// "unix:" followed by a socket path. A socket file left behind by a server
+// that is no longer running is replaced; one still in use is an error. The
+// socket is made readable and writable by its owner and group only.
+func Listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, unixPrefix)
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another server", path)
+		}
+		os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0o660); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// service serves an HTTP handler on its own listener, bound on first use.
+type service struct {
+	name       string
+	listenAddr string
+	logger     *slog.Logger
+	handler    func() http.Handler
+
+	mu         sync.Mutex
+	listener   net.Listener
+	httpServer *http.Server
+}
+
+// Listen binds the listener. Calling it is optional; Start binds on
+// first use.
+func (s *service) Listen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listenLocked()
+}
+
+func (s *service) listenLocked() error {
+	if s.listener != nil {
+		return nil
+	}
+	ln, err := Listen(s.listenAddr)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", s.listenAddr, err)
+	}
+	s.listener = ln
+	return nil
+}
+
+// Addr returns the bound address, or nil if the server is not listening yet.
+func (s *service) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// Start serves until Stop is called.
+func (s *service) Start() error {
+	s.mu.Lock()
+	if err := s.listenLocked(); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	httpServer := &http.Server{
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	s.httpServer = httpServer
+	ln := s.listener
+	s.mu.Unlock()
+
+	s.logger.Info("Starting "+s.name+" server", "addr", ln.Addr())
+	if err := httpServer.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Stop gracefully shuts the server down and releases its listener.
+// Requests still in flight when ctx is done have their connections
+// closed.
+func (s *service) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	httpServer, ln := s.httpServer, s.listener
+	s.mu.Unlock()
+
+	if httpServer != nil {
+		err := httpServer.Shutdown(ctx)
+		if err != nil {
+			httpServer.Close()
+		}
+		return err
+	}
+	if ln != nil {
+		return ln.Close()
+	}
+	return nil
+}
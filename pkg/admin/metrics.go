@@ -0,0 +1,86 @@
+package admin
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+)
+
+// MetricsConfig configures the metrics server.
+type MetricsConfig struct {
+	// ListenAddr is a TCP host:port or "unix:" followed by a socket path
+	ListenAddr string
+
+	// AuthToken, if set, must be presented as for the admin interface.
+	// Without it anyone who can reach ListenAddr can read the endpoints.
+	AuthToken string
+
+	// Metrics is served at /metrics.
+	Metrics http.Handler
+
+	// Debug serves net/http/pprof under /debug/pprof/ and expvar at
+	// /debug/vars.
+	Debug bool
+
+	// Recorder receives panic events. Nil discards them.
+	Recorder stats.Recorder
+
+	Logger *slog.Logger
+}
+
+// MetricsServer serves Prometheus metrics and the debug endpoints on a
+// listener of their own, so scrapers and profilers need neither the admin
+// token nor a route to the admin interface.
+type MetricsServer struct {
+	service
+
+	authToken string
+	metrics   http.Handler
+	debug     bool
+	stats     stats.Recorder
+}
+
+// NewMetrics creates a metrics server.
+func NewMetrics(cfg MetricsConfig) (*MetricsServer, error) {
+	if cfg.ListenAddr == "" {
+		return nil, fmt.Errorf("listen address is required")
+	}
+	if cfg.Metrics == nil {
+		return nil, fmt.Errorf("metrics handler is required")
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+	recorder := cfg.Recorder
+	if recorder == nil {
+		recorder = stats.NopRecorder{}
+	}
+
+	s := &MetricsServer{
+		authToken: cfg.AuthToken,
+		metrics:   cfg.Metrics,
+		debug:     cfg.Debug,
+		stats:     recorder,
+	}
+	s.service = service{name: "metrics", listenAddr: cfg.ListenAddr, logger: logger, handler: s.Handler}
+	return s, nil
+}
+
+// Handler returns the metrics HTTP handler, with the token required if one
+// is set.
+func (s *MetricsServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", s.metrics)
+	if s.debug {
+		handleDebug(mux)
+	}
+
+	var h http.Handler = mux
+	if s.authToken != "" {
+		h = requireToken(s.authToken, h)
+	}
+	return recoverPanics(s.stats, s.logger, "metrics", h)
+}
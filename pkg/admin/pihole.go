@@ -0,0 +1,200 @@
+package admin
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+)
+
+// piholeAPIVersion is the version of the Pi-hole PHP API reported to
+// clients, the one dashboards and apps written for Pi-hole v5 speak.
+const piholeAPIVersion = 3
+
+// defaultPiholeTopItems is how many domains topItems lists when no count
+// is given.
+const defaultPiholeTopItems = 10
+
+// piholeSummary is the body of api.php?summaryRaw. Pi-hole's "today" is
+// the last 24 hours, which is what the stats history covers.
+type piholeSummary struct {
+	DomainsBeingBlocked int           `json:"domains_being_blocked"`
+	DNSQueriesToday     int64         `json:"dns_queries_today"`
+	AdsBlockedToday     int64         `json:"ads_blocked_today"`
+	AdsPercentageToday  float64       `json:"ads_percentage_today"`
+	UniqueDomains       int64         `json:"unique_domains"`
+	QueriesForwarded    int64         `json:"queries_forwarded"`
+	QueriesCached       int64         `json:"queries_cached"`
+	ClientsEverSeen     int64         `json:"clients_ever_seen"`
+	UniqueClients       int64         `json:"unique_clients"`
+	Status              string        `json:"status"`
+	GravityLastUpdated  piholeGravity `json:"gravity_last_updated"`
+}
+
+// piholeGravity reports when the blocklist was last fetched, which Pi-hole
+// calls the gravity update.
+type piholeGravity struct {
+	FileExists bool  `json:"file_exists"`
+	Absolute   int64 `json:"absolute"`
+	Relative   struct {
+		Days    int `json:"days"`
+		Hours   int `json:"hours"`
+		Minutes int `json:"minutes"`
+	} `json:"relative"`
+}
+
+// handlePihole serves the subset of Pi-hole's api.php that dashboards, apps
+// and home automation integrations use. Requests authenticate with the
+// auth query parameter; as Pi-hole does, those that do not get an empty
+// list.
+func (s *Server) handlePihole(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Has("version") {
+		writeJSON(w, http.StatusOK, map[string]int{"version": piholeAPIVersion})
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(query.Get("auth")), []byte(s.piholeToken)) != 1 {
+		writeJSON(w, http.StatusOK, []string{})
+		return
+	}
+
+	switch {
+	case query.Has("summaryRaw"):
+		writeJSON(w, http.StatusOK, s.piholeSummary())
+	case query.Has("summary"):
+		writeJSON(w, http.StatusOK, s.piholeSummary().formatted())
+	case query.Has("topItems"):
+		n, ok := positiveParam(query.Get("topItems"), defaultPiholeTopItems)
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {"topItems must be a positive integer"}})
+			return
+		}
+		// Only blocked domains are counted, so there are no top queries
+		top := map[string]map[string]int64{"top_queries": {}, "top_ads": {}}
+		if s.collector != nil {
+			for _, d := range s.collector.TopBlockedDomains(n) {
+				top["top_ads"][d.Domain] = d.Count
+			}
+		}
+		writeJSON(w, http.StatusOK, top)
+	case query.Has("recentBlocked"):
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if s.collector != nil {
+			w.Write([]byte(s.collector.LastBlockedDomain()))
+		}
+	case query.Has("enable"), query.Has("disable"):
+		if s.dns == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if query.Has("enable") {
+			s.dns.ResumeBlocking()
+		} else {
+			seconds := 0
+			if v := query.Get("disable"); v != "" {
+				var err error
+				if seconds, err = strconv.Atoi(v); err != nil || seconds < 0 {
+					writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {"disable must be a number of seconds"}})
+					return
+				}
+			}
+			s.dns.PauseBlocking(time.Duration(seconds) * time.Second)
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": s.piholeStatus()})
+	case query.Has("status"):
+		writeJSON(w, http.StatusOK, map[string]string{"status": s.piholeStatus()})
+	default:
+		writeJSON(w, http.StatusOK, []string{})
+	}
+}
+
+// piholeStatus is "disabled" while blocking is paused, and "enabled"
+// otherwise.
+func (s *Server) piholeStatus() string {
+	if s.dns != nil {
+		if paused, _ := s.dns.BlockingPaused(); paused {
+			return "disabled"
+		}
+	}
+	return "enabled"
+}
+
+// piholeSummary gathers the summary from the stats and blocklist. Counts
+// opl-dns does not keep, unique domains and cached answers, are 0.
+func (s *Server) piholeSummary() piholeSummary {
+	summary := piholeSummary{Status: s.piholeStatus()}
+
+	if s.collector != nil {
+		for _, p := range s.collector.History(stats.HistoryWindow) {
+			summary.DNSQueriesToday += p.Queries
+			summary.AdsBlockedToday += p.Blocked
+		}
+		summary.QueriesForwarded = summary.DNSQueriesToday - summary.AdsBlockedToday
+		if summary.DNSQueriesToday > 0 {
+			summary.AdsPercentageToday = float64(summary.AdsBlockedToday) * 100 / float64(summary.DNSQueriesToday)
+		}
+		summary.UniqueClients, _ = s.collector.UniqueClients()
+		summary.ClientsEverSeen = summary.UniqueClients
+	}
+
+	if s.blocklist != nil {
+		if cached := s.blocklist.GetCachedBlocklist(); cached != nil {
+			now := time.Now()
+			domains := make(map[string]bool)
+			for _, item := range cached.BlockList {
+				if !item.Expired(now) {
+					domains[strings.ToLower(item.Domain)] = true
+				}
+			}
+			summary.DomainsBeingBlocked = len(domains)
+		}
+		if last := s.blocklist.LastFetchTime(); !last.IsZero() {
+			g := &summary.GravityLastUpdated
+			g.FileExists = true
+			g.Absolute = last.Unix()
+			age := time.Since(last)
+			g.Relative.Days = int(age / (24 * time.Hour))
+			g.Relative.Hours = int(age/time.Hour) % 24
+			g.Relative.Minutes = int(age/time.Minute) % 60
+		}
+	}
+	return summary
+}
+
+// formatted returns the summary as api.php?summary gives it, with counts
+// as strings grouped in thousands and the percentage to one decimal.
+func (p piholeSummary) formatted() map[string]any {
+	return map[string]any{
+		"domains_being_blocked": groupThousands(int64(p.DomainsBeingBlocked)),
+		"dns_queries_today":     groupThousands(p.DNSQueriesToday),
+		"ads_blocked_today":     groupThousands(p.AdsBlockedToday),
+		"ads_percentage_today":  strconv.FormatFloat(p.AdsPercentageToday, 'f', 1, 64),
+		"unique_domains":        groupThousands(p.UniqueDomains),
+		"queries_forwarded":     groupThousands(p.QueriesForwarded),
+		"queries_cached":        groupThousands(p.QueriesCached),
+		"clients_ever_seen":     groupThousands(p.ClientsEverSeen),
+		"unique_clients":        groupThousands(p.UniqueClients),
+		"status":                p.Status,
+		"gravity_last_updated":  p.GravityLastUpdated,
+	}
+}
+
+// groupThousands formats n with commas between groups of three digits.
+func groupThousands(n int64) string {
+	digits := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	return sign + b.String()
+}
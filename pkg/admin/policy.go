@@ -0,0 +1,259 @@
+package admin
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/policy"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var policyTemplate = template.Must(template.ParseFS(templateFS, "templates/policy.html"))
+
+// maxPolicySize bounds request bodies for policy updates.
+const maxPolicySize = 1 << 20
+
+// policyPage is the data rendered by templates/policy.html.
+type policyPage struct {
+	Allowlist string
+	Blocks    string
+	Groups    string
+	StateFile string
+	Applied   bool
+	Errors    []string
+}
+
+func (s *Server) handlePolicyPage(w http.ResponseWriter, r *http.Request) {
+	state := s.policy.Policy().State()
+	s.renderPolicy(w, http.StatusOK, policyPage{
+		Allowlist: formatAllowlist(state.Allowlist),
+		Blocks:    formatBlocks(state.Blocks),
+		Groups:    formatGroups(state.Groups),
+		Applied:   r.URL.Query().Get("applied") == "1",
+	})
+}
+
+func (s *Server) handlePolicyForm(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxPolicySize)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	page := policyPage{
+		Allowlist: r.PostFormValue("allowlist"),
+		Blocks:    r.PostFormValue("blocks"),
+		Groups:    r.PostFormValue("groups"),
+	}
+
+	state, parseErrs := parseForm(page.Allowlist, page.Blocks, page.Groups)
+	keepSchedules(state.Groups, s.policy.Policy().State().Groups)
+	if len(parseErrs) == 0 {
+		if err := s.applyPolicy(r, state); err != nil {
+			parseErrs = splitErrors(err)
+		}
+	}
+	if len(parseErrs) > 0 {
+		page.Errors = parseErrs
+		s.renderPolicy(w, http.StatusBadRequest, page)
+		return
+	}
+
+	http.Redirect(w, r, "/policy?applied=1", http.StatusSeeOther)
+}
+
+func (s *Server) handleGetPolicy(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.policy.Policy().State())
+}
+
+func (s *Server) handlePutPolicy(w http.ResponseWriter, r *http.Request) {
+	var state policy.State
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPolicySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&state); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {err.Error()}})
+		return
+	}
+
+	if err := s.applyPolicy(r, state); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": splitErrors(err)})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.policy.Policy().State())
+}
+
+// applyPolicy validates and applies state, logging the change.
+func (s *Server) applyPolicy(r *http.Request, state policy.State) error {
+	if err := s.policy.Apply(state); err != nil {
+		s.logger.Warn("Rejected policy update", "remote", r.RemoteAddr, "error", err)
+		return err
+	}
+	applied := s.policy.Policy().State()
+	s.logger.Info("Applied policy update",
+		"remote", r.RemoteAddr,
+		"allowlist", len(applied.Allowlist),
+		"blocks", len(applied.Blocks),
+		"groups", len(applied.Groups),
+	)
+	return nil
+}
+
+func (s *Server) renderPolicy(w http.ResponseWriter, status int, page policyPage) {
+	page.StateFile = s.policy.Path()
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(status)
+	if err := policyTemplate.Execute(w, page); err != nil {
+		s.logger.Error("Error rendering policy page", "error", err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// splitErrors flattens an errors.Join result into one message per problem.
+func splitErrors(err error) []string {
+	var joined interface{ Unwrap() []error }
+	if errors.As(err, &joined) {
+		var msgs []string
+		for _, e := range joined.Unwrap() {
+			msgs = append(msgs, e.Error())
+		}
+		return msgs
+	}
+	return []string{err.Error()}
+}
+
+// parseForm reads the UI's plain-text policy format, one entry per line, which
+// keeps the page usable without JavaScript. Fields are separated by "|",
+// lists within a field by commas, and lines starting with "#" are ignored:
+//
+//	allowlist: domain
+//	blocks:    domain | employer | reason
+//	groups:    name | mode | clients | allowlist
+func parseForm(allowlist, blocks, groups string) (policy.State, []string) {
+	state := policy.State{}
+	var errs []string
+
+	for _, line := range formLines(allowlist) {
+		state.Allowlist = append(state.Allowlist, line.text)
+	}
+
+	for _, line := range formLines(blocks) {
+		fields := splitFields(line.text)
+		if len(fields) > 3 {
+			// Reasons may contain "|"
+			fields = append(fields[:2], strings.Join(fields[2:], " | "))
+		}
+		b := policy.Block{Domain: fields[0]}
+		if len(fields) > 1 {
+			b.Employer = fields[1]
+		}
+		if len(fields) > 2 {
+			b.Reason = fields[2]
+		}
+		state.Blocks = append(state.Blocks, b)
+	}
+
+	for _, line := range formLines(groups) {
+		fields := splitFields(line.text)
+		if len(fields) < 3 || len(fields) > 4 {
+			errs = append(errs, fmt.Sprintf("groups line %d: expected name | mode | clients | allowlist", line.num))
+			continue
+		}
+		g := policy.Group{
+			Name:    fields[0],
+			Mode:    fields[1],
+			Clients: splitList(fields[2]),
+		}
+		if len(fields) > 3 {
+			g.Allowlist = splitList(fields[3])
+		}
+		state.Groups = append(state.Groups, g)
+	}
+
+	return state, errs
+}
+
+// keepSchedules copies each group's schedule from the group of the same name
+// in current, since the form has no field for schedules.
+func keepSchedules(groups, current []policy.Group) {
+	for i := range groups {
+		for _, g := range current {
+			if g.Name == groups[i].Name {
+				groups[i].Schedule = g.Schedule
+			}
+		}
+	}
+}
+
+type formLine struct {
+	num  int
+	text string
+}
+
+func formLines(text string) []formLine {
+	var lines []formLine
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, formLine{num: i + 1, text: line})
+	}
+	return lines
+}
+
+func splitFields(line string) []string {
+	parts := strings.Split(line, "|")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts
+}
+
+func splitList(field string) []string {
+	return strings.FieldsFunc(field, func(r rune) bool { return r == ',' || r == ' ' })
+}
+
+func formatAllowlist(domains []string) string {
+	return strings.Join(domains, "\n")
+}
+
+func formatBlocks(blocks []policy.Block) string {
+	lines := make([]string, 0, len(blocks))
+	for _, b := range blocks {
+		line := b.Domain
+		if b.Employer != "" || b.Reason != "" {
+			line += " | " + b.Employer
+		}
+		if b.Reason != "" {
+			line += " | " + b.Reason
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func formatGroups(groups []policy.Group) string {
+	lines := make([]string, 0, len(groups))
+	for _, g := range groups {
+		line := fmt.Sprintf("%s | %s | %s", g.Name, g.Mode, strings.Join(g.Clients, ", "))
+		if len(g.Allowlist) > 0 {
+			line += " | " + strings.Join(g.Allowlist, ", ")
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,83 @@
+package admin
+
+import (
+	"io"
+	"net/http"
+)
+
+// maxPatchSize bounds the body of PATCH /api/config.
+const maxPatchSize = 1 << 20
+
+// reloadResponse is the body of a successful /api/config/reload.
+type reloadResponse struct {
+	Applied         []string `json:"applied"`
+	RestartRequired []string `json:"restart_required"`
+}
+
+// patchResponse is the body of a successful PATCH /api/config.
+type patchResponse struct {
+	Applied []string `json:"applied"`
+}
+
+// handleReload reloads the configuration file, as SIGHUP does. An invalid
+// file changes nothing and is reported as a 400.
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if s.reload == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	applied, restartRequired, err := s.reload()
+	if err != nil {
+		s.logger.Warn("Configuration reload failed", "error", err)
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {err.Error()}})
+		return
+	}
+	writeJSON(w, http.StatusOK, reloadResponse{Applied: applied, RestartRequired: restartRequired})
+}
+
+// handleGetConfig returns the configuration in effect, with secrets
+// redacted, in the configuration file format.
+func (s *Server) handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	if s.running == nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.running().Redacted())
+}
+
+// handlePatchConfig applies a partial configuration document, such as
+// {"logging": {"level": "debug"}}, over the configuration in effect. A
+// document that is invalid or changes a setting that needs a restart
+// changes nothing and is reported as a 400.
+func (s *Server) handlePatchConfig(w http.ResponseWriter, r *http.Request) {
+	if s.patch == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxPatchSize))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {"reading body: " + err.Error()}})
+		return
+	}
+	applied, err := s.patch(body)
+	if err != nil {
+		s.logger.Warn("Configuration change rejected", "error", err)
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {err.Error()}})
+		return
+	}
+	s.logger.Info("Configuration changed through the admin API", "applied", applied)
+	writeJSON(w, http.StatusOK, patchResponse{Applied: applied})
+}
+
+// handleRefresh asks for the blocklist to be fetched now, as SIGUSR1 does.
+// The fetch happens in the background.
+func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	if s.refresh == nil {
+		http.NotFound(w, r)
+		return
+	}
+	s.refresh()
+	writeJSON(w, http.StatusAccepted, map[string]string{"status": "refresh requested"})
+}
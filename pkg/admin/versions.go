@@ -0,0 +1,101 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+)
+
+// blocklistVersions is the body of GET /api/blocklist/versions.
+type blocklistVersions struct {
+	// Current is the hash of the blocklist being enforced
+	Current  string                 `json:"current"`
+	Pinned   string                 `json:"pinned,omitempty"`
+	Versions []api.BlocklistVersion `json:"versions"`
+}
+
+// pinRequest is the body of POST /api/blocklist/pin.
+type pinRequest struct {
+	// Hash is the version's hash or a prefix matching only it
+	Hash string `json:"hash"`
+}
+
+// versionStore returns the blocklist version store, or nil if versions are
+// not kept.
+func (s *Server) versionStore() *api.VersionStore {
+	if s.blocklist == nil {
+		return nil
+	}
+	return s.blocklist.VersionStore()
+}
+
+// handleBlocklistVersions lists the kept blocklist versions, newest first,
+// with the one in effect and the pinned one.
+func (s *Server) handleBlocklistVersions(w http.ResponseWriter, r *http.Request) {
+	store := s.versionStore()
+	if store == nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, blocklistVersions{
+		Current:  s.blocklist.CurrentVersion(),
+		Pinned:   store.Pinned(),
+		Versions: store.Versions(),
+	})
+}
+
+// handlePinBlocklist enforces a kept version instead of fetched blocklists
+// until it is unpinned.
+func (s *Server) handlePinBlocklist(w http.ResponseWriter, r *http.Request) {
+	if s.versionStore() == nil {
+		http.NotFound(w, r)
+		return
+	}
+	var req pinRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil || req.Hash == "" {
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {`body must be {"hash": "..."}`}})
+		return
+	}
+	v, err := s.blocklist.Pin(req.Hash)
+	s.writeVersionResult(w, v, err)
+}
+
+// handleRollbackBlocklist pins the version kept before the one in effect.
+func (s *Server) handleRollbackBlocklist(w http.ResponseWriter, r *http.Request) {
+	if s.versionStore() == nil {
+		http.NotFound(w, r)
+		return
+	}
+	v, err := s.blocklist.Rollback()
+	s.writeVersionResult(w, v, err)
+}
+
+// handleUnpinBlocklist goes back to enforcing the newest fetched blocklist.
+func (s *Server) handleUnpinBlocklist(w http.ResponseWriter, r *http.Request) {
+	if s.versionStore() == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if err := s.blocklist.Unpin(); err != nil {
+		s.logger.Warn("Error unpinning blocklist version", "error", err)
+		writeJSON(w, http.StatusInternalServerError, map[string][]string{"errors": {err.Error()}})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"current": s.blocklist.CurrentVersion()})
+}
+
+// writeVersionResult answers a pin or rollback with the version now
+// enforced.
+func (s *Server) writeVersionResult(w http.ResponseWriter, v api.BlocklistVersion, err error) {
+	switch {
+	case errors.Is(err, api.ErrVersionNotFound):
+		writeJSON(w, http.StatusNotFound, map[string][]string{"errors": {err.Error()}})
+	case err != nil:
+		s.logger.Warn("Error pinning blocklist version", "error", err)
+		writeJSON(w, http.StatusBadRequest, map[string][]string{"errors": {err.Error()}})
+	default:
+		writeJSON(w, http.StatusOK, v)
+	}
+}
@@ -0,0 +1,298 @@
+// Package alert watches the server for silent degradation, such as a rising
+// SERVFAIL rate, a blocklist that has stopped updating, or failing upstream
+// resolvers, and notifies operators through webhooks when a rule fires and
+// again when it resolves.
+package alert
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/dns"
+)
+
+// Metric names what a rule watches.
+type Metric string
+
+const (
+	// MetricServfailRate fires when more than Rule.Threshold of the
+	// answers sent to clients since the previous check were SERVFAIL.
+	MetricServfailRate Metric = "servfail_rate"
+
+	// MetricBlocklistAge fires when the blocklist was last fetched more
+	// than Rule.MaxAge ago, or has never been fetched after that long.
+	MetricBlocklistAge Metric = "blocklist_age"
+
+	// MetricUpstreamDown fires while any upstream resolver is failing.
+	MetricUpstreamDown Metric = "upstream_down"
+)
+
+// minServfailSample is how many answers are needed before a SERVFAIL rate is
+// judged. Until then the rule stays as it was and answers keep accumulating.
+const minServfailSample = 20
+
+// Rule is one alert condition.
+type Rule struct {
+	// Name identifies the rule in notifications.
+	Name string
+
+	Metric Metric
+
+	// Threshold is the SERVFAIL fraction, above 0 and at most 1, for
+	// MetricServfailRate.
+	Threshold float64
+
+	// MaxAge is the oldest acceptable blocklist for MetricBlocklistAge.
+	MaxAge time.Duration
+}
+
+// Validate reports whether r is complete for its metric.
+func (r Rule) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("rule name is required")
+	}
+	switch r.Metric {
+	case MetricServfailRate:
+		if r.Threshold <= 0 || r.Threshold > 1 {
+			return fmt.Errorf("rule %q: threshold must be above 0 and at most 1", r.Name)
+		}
+	case MetricBlocklistAge:
+		if r.MaxAge <= 0 {
+			return fmt.Errorf("rule %q: max_age must be positive", r.Name)
+		}
+	case MetricUpstreamDown:
+	default:
+		return fmt.Errorf("rule %q: unknown metric %q", r.Name, r.Metric)
+	}
+	return nil
+}
+
+// ResponseCounter supplies counts of answers sent to clients by rcode.
+// *stats.Collector implements it.
+type ResponseCounter interface {
+	ResponseRcodes() map[string]int64
+}
+
+// BlocklistSource reports when the blocklist was last fetched.
+// *api.Client implements it.
+type BlocklistSource interface {
+	LastFetchTime() time.Time
+}
+
+// UpstreamSource reports upstream resolver health. *dns.Server implements
+// it.
+type UpstreamSource interface {
+	UpstreamHealth() []dns.UpstreamStatus
+}
+
+// Config configures a Monitor.
+type Config struct {
+	Rules    []Rule
+	Webhooks []Webhook
+
+	// Interval is how often rules are checked. Defaults to one minute.
+	Interval time.Duration
+
+	// RepeatInterval is how often a rule that keeps firing is notified
+	// again. Zero notifies only when it starts firing.
+	RepeatInterval time.Duration
+
+	// Instance identifies this server in notifications.
+	Instance string
+
+	// Sources are required for the rules that use them.
+	Responses ResponseCounter
+	Blocklist BlocklistSource
+	Upstreams UpstreamSource
+
+	// Transport sends webhook requests. Nil uses http.DefaultTransport.
+	Transport http.RoundTripper
+
+	Logger *slog.Logger
+}
+
+// Monitor checks rules periodically and sends notifications when they
+// change state.
+type Monitor struct {
+	rules          []Rule
+	webhooks       []Webhook
+	interval       time.Duration
+	repeatInterval time.Duration
+	instance       string
+	responses      ResponseCounter
+	blocklist      BlocklistSource
+	upstreams      UpstreamSource
+	httpClient     *http.Client
+	logger         *slog.Logger
+	now            func() time.Time
+
+	started time.Time
+	// lastRcodes is the response counts at the previous judged check
+	lastRcodes map[string]int64
+	// firing holds, for each firing rule, when it was last notified
+	firing map[string]time.Time
+}
+
+// New creates a Monitor after checking that every rule is valid and has the
+// source it needs.
+func New(cfg Config) (*Monitor, error) {
+	for _, r := range cfg.Rules {
+		if err := r.Validate(); err != nil {
+			return nil, err
+		}
+		switch {
+		case r.Metric == MetricServfailRate && cfg.Responses == nil,
+			r.Metric == MetricBlocklistAge && cfg.Blocklist == nil,
+			r.Metric == MetricUpstreamDown && cfg.Upstreams == nil:
+			return nil, fmt.Errorf("rule %q: no source for %s", r.Name, r.Metric)
+		}
+	}
+	for _, w := range cfg.Webhooks {
+		if err := w.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	return &Monitor{
+		rules:          cfg.Rules,
+		webhooks:       cfg.Webhooks,
+		interval:       interval,
+		repeatInterval: cfg.RepeatInterval,
+		instance:       cfg.Instance,
+		responses:      cfg.Responses,
+		blocklist:      cfg.Blocklist,
+		upstreams:      cfg.Upstreams,
+		httpClient:     &http.Client{Timeout: 10 * time.Second, Transport: cfg.Transport},
+		logger:         logger,
+		now:            time.Now,
+		started:        time.Now(),
+		firing:         make(map[string]time.Time),
+	}, nil
+}
+
+// Run checks the rules every interval until ctx is cancelled.
+func (m *Monitor) Run(ctx context.Context) {
+	m.started = m.now()
+	if m.responses != nil {
+		m.lastRcodes = m.responses.ResponseRcodes()
+	}
+
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.check(ctx)
+		}
+	}
+}
+
+// check evaluates every rule once and notifies rules that started firing,
+// stopped firing, or are due a repeat.
+func (m *Monitor) check(ctx context.Context) {
+	now := m.now()
+	var sample servfailSample
+	var rcodes map[string]int64
+	if m.responses != nil {
+		rcodes = m.responses.ResponseRcodes()
+		for rcode, n := range rcodes {
+			d := n - m.lastRcodes[rcode]
+			sample.total += d
+			if rcode == "SERVFAIL" {
+				sample.servfail += d
+			}
+		}
+	}
+
+	for _, r := range m.rules {
+		firing, message, judged := m.evaluate(r, now, sample)
+		if !judged {
+			continue
+		}
+
+		notified, wasFiring := m.firing[r.Name]
+		switch {
+		case firing && !wasFiring:
+			m.firing[r.Name] = now
+			m.notify(ctx, Notification{Rule: r.Name, Metric: r.Metric, Status: StatusFiring, Message: message, Time: now})
+		case firing && m.repeatInterval > 0 && now.Sub(notified) >= m.repeatInterval:
+			m.firing[r.Name] = now
+			m.notify(ctx, Notification{Rule: r.Name, Metric: r.Metric, Status: StatusFiring, Message: message, Time: now})
+		case !firing && wasFiring:
+			delete(m.firing, r.Name)
+			m.notify(ctx, Notification{Rule: r.Name, Metric: r.Metric, Status: StatusResolved, Message: message, Time: now})
+		}
+	}
+	// A quiet interval's answers carry over into the next sample
+	if sample.total >= minServfailSample {
+		m.lastRcodes = rcodes
+	}
+}
+
+// servfailSample counts the answers sent since the previous judged check.
+type servfailSample struct {
+	total, servfail int64
+}
+
+// evaluate reports whether r is firing, with a message describing the
+// current value. judged is false when there is too little data to tell.
+func (m *Monitor) evaluate(r Rule, now time.Time, sample servfailSample) (firing bool, message string, judged bool) {
+	switch r.Metric {
+	case MetricServfailRate:
+		if sample.total < minServfailSample {
+			return false, "", false
+		}
+		rate := float64(sample.servfail) / float64(sample.total)
+		return rate > r.Threshold, fmt.Sprintf("SERVFAIL rate is %.1f%% of %d answers (threshold %.1f%%)", rate*100, sample.total, r.Threshold*100), true
+
+	case MetricBlocklistAge:
+		last := m.blocklist.LastFetchTime()
+		if last.IsZero() {
+			age := now.Sub(m.started)
+			return age > r.MaxAge, fmt.Sprintf("no blocklist fetched in %s (limit %s)", age.Round(time.Second), r.MaxAge), true
+		}
+		age := now.Sub(last)
+		return age > r.MaxAge, fmt.Sprintf("blocklist is %s old (limit %s)", age.Round(time.Second), r.MaxAge), true
+
+	case MetricUpstreamDown:
+		var down []string
+		statuses := m.upstreams.UpstreamHealth()
+		for _, u := range statuses {
+			if u.Failing() {
+				down = append(down, u.Addr)
+			}
+		}
+		if len(down) == 0 {
+			return false, fmt.Sprintf("all %d upstream resolvers are answering", len(statuses)), true
+		}
+		return true, fmt.Sprintf("%d of %d upstream resolvers failing: %s", len(down), len(statuses), strings.Join(down, ", ")), true
+	}
+	return false, "", false
+}
+
+// notify sends n to every webhook. Failures are logged; the next state
+// change or repeat sends again.
+func (m *Monitor) notify(ctx context.Context, n Notification) {
+	n.Instance = m.instance
+	m.logger.Warn("Alert "+string(n.Status), "rule", n.Rule, "message", n.Message)
+	for _, w := range m.webhooks {
+		if err := m.send(ctx, w, n); err != nil {
+			m.logger.Error("Error sending alert", "rule", n.Rule, "format", w.Format, "error", err)
+		}
+	}
+}
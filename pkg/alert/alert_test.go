@@ -0,0 +1,236 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/dns"
+)
+
+type fakeResponses map[string]int64
+
+func (f fakeResponses) ResponseRcodes() map[string]int64 { return maps.Clone(f) }
+
+type fakeBlocklist struct{ last time.Time }
+
+func (f *fakeBlocklist) LastFetchTime() time.Time { return f.last }
+
+type fakeUpstreams []dns.UpstreamStatus
+
+func (f fakeUpstreams) UpstreamHealth() []dns.UpstreamStatus { return f }
+
+// webhookRecorder collects the requests sent to it.
+type webhookRecorder struct {
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   []string
+}
+
+func (w *webhookRecorder) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.requests = append(w.requests, r)
+	w.bodies = append(w.bodies, string(body))
+}
+
+func (w *webhookRecorder) notifications(t *testing.T) []Notification {
+	t.Helper()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var ns []Notification
+	for _, b := range w.bodies {
+		var n Notification
+		if err := json.Unmarshal([]byte(b), &n); err != nil {
+			t.Fatalf("Decoding notification %q: %v", b, err)
+		}
+		ns = append(ns, n)
+	}
+	return ns
+}
+
+func TestBlocklistAgeFiresAndResolves(t *testing.T) {
+	hook := &webhookRecorder{}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	blocklist := &fakeBlocklist{last: start}
+	m, err := New(Config{
+		Rules:          []Rule{{Name: "stale", Metric: MetricBlocklistAge, MaxAge: 2 * time.Hour}},
+		Webhooks:       []Webhook{{URL: server.URL, Format: FormatJSON}},
+		RepeatInterval: time.Hour,
+		Instance:       "dns-1",
+		Blocklist:      blocklist,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	now := start
+	m.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	now = start.Add(time.Hour)
+	m.check(ctx)
+	if ns := hook.notifications(t); len(ns) != 0 {
+		t.Fatalf("Expected no alert for a fresh blocklist, got %+v", ns)
+	}
+
+	now = start.Add(3 * time.Hour)
+	m.check(ctx)
+	now = now.Add(30 * time.Minute)
+	m.check(ctx)
+	ns := hook.notifications(t)
+	if len(ns) != 1 || ns[0].Status != StatusFiring || ns[0].Rule != "stale" || ns[0].Instance != "dns-1" {
+		t.Fatalf("Expected one firing notification, got %+v", ns)
+	}
+	if !strings.Contains(ns[0].Message, "3h0m0s old") {
+		t.Errorf("Unexpected message %q", ns[0].Message)
+	}
+
+	now = now.Add(30 * time.Minute)
+	m.check(ctx)
+	if ns := hook.notifications(t); len(ns) != 2 || ns[1].Status != StatusFiring {
+		t.Fatalf("Expected a repeat after the repeat interval, got %+v", ns)
+	}
+
+	blocklist.last = now
+	m.check(ctx)
+	if ns := hook.notifications(t); len(ns) != 3 || ns[2].Status != StatusResolved {
+		t.Fatalf("Expected a resolved notification, got %+v", ns)
+	}
+}
+
+func TestBlocklistNeverFetched(t *testing.T) {
+	m, err := New(Config{
+		Rules:     []Rule{{Name: "stale", Metric: MetricBlocklistAge, MaxAge: time.Hour}},
+		Blocklist: &fakeBlocklist{},
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	m.started = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	firing, message, judged := m.evaluate(m.rules[0], m.started.Add(2*time.Hour), servfailSample{})
+	if !firing || !judged || !strings.Contains(message, "no blocklist fetched") {
+		t.Errorf("Expected an unfetched blocklist to fire, got %v %q %v", firing, message, judged)
+	}
+}
+
+func TestServfailRate(t *testing.T) {
+	hook := &webhookRecorder{}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	responses := fakeResponses{"NOERROR": 100}
+	m, err := New(Config{
+		Rules:     []Rule{{Name: "servfail", Metric: MetricServfailRate, Threshold: 0.05}},
+		Webhooks:  []Webhook{{URL: server.URL, Format: FormatJSON}},
+		Responses: responses,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	m.lastRcodes = map[string]int64{"NOERROR": 100}
+	ctx := context.Background()
+
+	// Too few answers to judge; they carry over to the next check
+	responses["SERVFAIL"] = 5
+	m.check(ctx)
+	if ns := hook.notifications(t); len(ns) != 0 {
+		t.Fatalf("Expected a small sample not to be judged, got %+v", ns)
+	}
+
+	responses["NOERROR"], responses["SERVFAIL"] = 190, 10
+	m.check(ctx)
+	ns := hook.notifications(t)
+	if len(ns) != 1 || ns[0].Status != StatusFiring {
+		t.Fatalf("Expected the rule to fire, got %+v", ns)
+	}
+	if !strings.Contains(ns[0].Message, "10.0% of 100 answers") {
+		t.Errorf("Unexpected message %q", ns[0].Message)
+	}
+
+	responses["NOERROR"] = 290
+	m.check(ctx)
+	if ns := hook.notifications(t); len(ns) != 2 || ns[1].Status != StatusResolved {
+		t.Fatalf("Expected the rule to resolve, got %+v", ns)
+	}
+}
+
+func TestUpstreamDown(t *testing.T) {
+	upstreams := fakeUpstreams{
+		{Addr: "1.1.1.1:53"},
+		{Addr: "9.9.9.9:53", ConsecutiveFailures: 3, LastError: "i/o timeout"},
+	}
+	m, err := New(Config{
+		Rules:     []Rule{{Name: "upstreams", Metric: MetricUpstreamDown}},
+		Upstreams: upstreams,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	firing, message, _ := m.evaluate(m.rules[0], time.Now(), servfailSample{})
+	if !firing || message != "1 of 2 upstream resolvers failing: 9.9.9.9:53" {
+		t.Errorf("Unexpected result %v %q", firing, message)
+	}
+}
+
+func TestNewRejectsRuleWithoutSource(t *testing.T) {
+	_, err := New(Config{Rules: []Rule{{Name: "upstreams", Metric: MetricUpstreamDown}}})
+	if err == nil || !strings.Contains(err.Error(), "no source") {
+		t.Errorf("Expected a missing source error, got %v", err)
+	}
+}
+
+func TestWebhookFormats(t *testing.T) {
+	hook := &webhookRecorder{}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	m, err := New(Config{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	n := Notification{Rule: "stale", Status: StatusFiring, Message: "blocklist is 3h0m0s old (limit 2h0m0s)", Instance: "dns-1"}
+
+	if err := m.send(context.Background(), Webhook{URL: server.URL, Format: FormatSlack}, n); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+	if err := m.send(context.Background(), Webhook{URL: server.URL, Format: FormatNtfy, Headers: map[string]string{"Authorization": "Bearer tk"}}, n); err != nil {
+		t.Fatalf("send failed: %v", err)
+	}
+
+	if want := `{"text":"[firing] dns-1 stale: blocklist is 3h0m0s old (limit 2h0m0s)"}`; hook.bodies[0] != want {
+		t.Errorf("Slack body = %s, want %s", hook.bodies[0], want)
+	}
+	ntfy := hook.requests[1]
+	if hook.bodies[1] != n.Message || ntfy.Header.Get("Title") != "[firing] dns-1 stale" || ntfy.Header.Get("Priority") != "high" {
+		t.Errorf("Unexpected ntfy request %v %q", ntfy.Header, hook.bodies[1])
+	}
+	if ntfy.Header.Get("Authorization") != "Bearer tk" {
+		t.Error("Expected configured headers to be sent")
+	}
+}
+
+func TestWebhookErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	m, _ := New(Config{})
+	err := m.send(context.Background(), Webhook{URL: server.URL, Format: FormatJSON}, Notification{})
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Expected a status error, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Format is the body a webhook expects.
+type Format string
+
+const (
+	// FormatJSON posts the Notification as JSON.
+	FormatJSON Format = "json"
+
+	// FormatSlack posts a Slack incoming webhook message. Discord and
+	// Mattermost accept it too.
+	FormatSlack Format = "slack"
+
+	// FormatNtfy posts a plain-text ntfy message to a topic URL.
+	FormatNtfy Format = "ntfy"
+)
+
+// Status is whether a notification reports a rule starting or stopping.
+type Status string
+
+const (
+	StatusFiring   Status = "firing"
+	StatusResolved Status = "resolved"
+)
+
+// Notification is one alert state change, and the body of FormatJSON
+// webhooks.
+type Notification struct {
+	Rule     string    `json:"rule"`
+	Metric   Metric    `json:"metric"`
+	Status   Status    `json:"status"`
+	Message  string    `json:"message"`
+	Instance string    `json:"instance,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// text is the one-line form used by chat formats.
+func (n Notification) text() string {
+	return fmt.Sprintf("[%s] %s: %s", n.Status, n.title(), n.Message)
+}
+
+func (n Notification) title() string {
+	if n.Instance == "" {
+		return n.Rule
+	}
+	return n.Instance + " " + n.Rule
+}
+
+// Webhook is where notifications are sent.
+type Webhook struct {
+	URL    string
+	Format Format
+
+	// Headers are sent with every request, e.g. for authentication.
+	Headers map[string]string
+}
+
+// Validate reports whether w has a usable URL and format.
+func (w Webhook) Validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("webhook URL must be an http:// or https:// URL")
+	}
+	switch w.Format {
+	case FormatJSON, FormatSlack, FormatNtfy:
+	default:
+		return fmt.Errorf("unknown webhook format %q", w.Format)
+	}
+	return nil
+}
+
+// send posts n to w in w's format.
+func (m *Monitor) send(ctx context.Context, w Webhook, n Notification) error {
+	var body []byte
+	contentType := "application/json"
+	switch w.Format {
+	case FormatSlack:
+		body, _ = json.Marshal(map[string]string{"text": n.text()})
+	case FormatNtfy:
+		body = []byte(n.Message)
+		contentType = "text/plain; charset=utf-8"
+	default:
+		body, _ = json.Marshal(n)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if w.Format == FormatNtfy {
+		req.Header.Set("Title", fmt.Sprintf("[%s] %s", n.Status, n.title()))
+		if n.Status == StatusFiring {
+			req.Header.Set("Priority", "high")
+			req.Header.Set("Tags", "warning")
+		} else {
+			req.Header.Set("Tags", "white_check_mark")
+		}
+	}
+	for k, v := range w.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
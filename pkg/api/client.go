@@ -4,13 +4,24 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
+	"maps"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 // Client is a client for the Online Picketline API.
@@ -18,12 +29,47 @@ type Client struct {
 	baseURL    string
 	apiKey     string
 	httpClient *http.Client
+	transport  *http.Transport
 
 	// Cached blocklist data
 	mu          sync.RWMutex
 	blocklist   *Blocklist
 	lastFetch   time.Time
 	contentHash string
+
+	// Raw entries keyed by employer name, kept so incremental updates can
+	// rebuild the blocklist without refetching it. entriesGen counts the
+	// times entries was replaced.
+	entries    map[string]OPLBlocklistEntry
+	entriesGen uint64
+
+	// Problems in the cached entries; parseIssues are those found while
+	// decoding the last full fetch.
+	lint        *LintReport
+	parseIssues []LintIssue
+
+	deltaUpdates    bool
+	filter          Filter
+	retryPolicy     RetryPolicy
+	logger          *slog.Logger
+	diffUnsupported atomic.Bool
+	streamConnected atomic.Bool
+	now             func() time.Time
+
+	recorder            stats.Recorder
+	tracer              trace.Tracer
+	consecutiveFailures atomic.Int64
+
+	hooksMu sync.Mutex
+	hooks   hooks
+
+	// versions, if set, keeps fetched blocklists. fetched is the hash of
+	// the newest fetched entries, current that of the blocklist being
+	// enforced, and pinned that of the pinned version, if any.
+	versions *VersionStore
+	fetched  string
+	current  string
+	pinned   string
 }
 
 // Blocklist represents the blocklist data from the API.
@@ -58,6 +104,10 @@ type BlockListItem struct {
 	MoreInfoURL   string
 	Location      string
 	ActionDetails ActionDetails
+
+	// ExpiresAt is when the action ends and the item stops being enforced,
+	// or zero if it has no end.
+	ExpiresAt time.Time
 }
 
 // ActionDetails provides detailed information about the labor action.
@@ -67,9 +117,11 @@ type ActionDetails struct {
 	ActionType   string `json:"actionType"`
 	Status       string `json:"status"`
 	StartDate    string `json:"startDate"`
+	EndDate      string `json:"endDate,omitempty"`
 	Description  string `json:"description"`
 	Demands      string `json:"demands"`
 	Location     string `json:"location"`
+	Region       string `json:"region,omitempty"`
 	ContactInfo  string `json:"contactInfo"`
 	UnionLogoURL string `json:"unionLogoUrl"`
 	LearnMoreURL string `json:"learnMoreUrl"`
@@ -81,52 +133,179 @@ type OPLBlocklistEntry struct {
 	MoreInfoURL        string        `json:"moreInfoUrl"`
 	MatchingURLRegexes []string      `json:"matchingUrlRegexes"`
 	StartTime          string        `json:"startTime"`
+	EndTime            string        `json:"endTime,omitempty"`
 	ActionDetails      ActionDetails `json:"actionDetails"`
 }
 
+// ClientOption customizes a Client.
+type ClientOption func(*Client)
+
+// WithDeltaUpdates enables fetching only changed employers from the
+// /blocklist/diff endpoint once a full blocklist has been loaded. The client
+// falls back to full fetches if the backend does not support diffs.
+func WithDeltaUpdates(enabled bool) ClientOption {
+	return func(c *Client) {
+		c.deltaUpdates = enabled
+	}
+}
+
+// WithLogger sets the logger used for retries and stream events.
+func WithLogger(logger *slog.Logger) ClientOption {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithRecorder sets where blocklist fetch metrics are recorded.
+func WithRecorder(r stats.Recorder) ClientOption {
+	return func(c *Client) {
+		c.recorder = r
+	}
+}
+
+// WithTracerProvider records a span for every blocklist fetch.
+func WithTracerProvider(tp trace.TracerProvider) ClientOption {
+	return func(c *Client) {
+		c.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// tracerName is the instrumentation scope of the client's spans.
+const tracerName = "github.com/online-picket-line/opl-for-dns/pkg/api"
+
 // NewClient creates a new API client.
-func NewClient(baseURL, apiKey string, timeout time.Duration) *Client {
-	return &Client{
+func NewClient(baseURL, apiKey string, timeout time.Duration, opts ...ClientOption) *Client {
+	c := &Client{
 		baseURL: strings.TrimSuffix(baseURL, "/"),
 		apiKey:  apiKey,
 		httpClient: &http.Client{
 			Timeout: timeout,
 		},
+		retryPolicy: DefaultRetryPolicy(),
+		logger:      slog.New(slog.DiscardHandler),
+		recorder:    stats.NopRecorder{},
+		tracer:      noop.NewTracerProvider().Tracer(tracerName),
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	return c
+}
+
+// BlocklistDiff is the response of the /blocklist/diff endpoint.
+type BlocklistDiff struct {
+	// Hash is the content hash of the blocklist after applying the diff.
+	Hash string `json:"hash"`
+
+	// Changed holds added or modified entries keyed by employer name.
+	Changed map[string]OPLBlocklistEntry `json:"changed"`
+
+	// Removed lists employers no longer on the blocklist.
+	Removed []string `json:"removed"`
 }
 
+// errDiffUnavailable means a diff cannot be served for the cached hash and a
+// full fetch is required.
+var errDiffUnavailable = errors.New("blocklist diff unavailable")
+
 // FetchBlocklist fetches the blocklist from the API.
 func (c *Client) FetchBlocklist(ctx context.Context) (*Blocklist, error) {
-	reqURL := fmt.Sprintf("%s/blocklist.json", c.baseURL)
-
 	// Add hash for conditional fetch if we have cached data
 	c.mu.RLock()
 	hash := c.contentHash
+	haveEntries := c.entries != nil
 	c.mu.RUnlock()
 
-	if hash != "" {
-		reqURL = fmt.Sprintf("%s?hash=%s", reqURL, url.QueryEscape(hash))
+	if c.deltaUpdates && hash != "" && haveEntries && !c.diffUnsupported.Load() {
+		fetch := stats.APIFetch{Kind: stats.FetchDiff}
+		start := time.Now()
+		ctx, span := c.startFetchSpan(ctx, fetch.Kind)
+		blocklist, err := c.fetchDiff(ctx, hash, &fetch)
+		c.recordFetch(&fetch, start, err)
+		endFetchSpan(span, &fetch, err)
+		if !errors.Is(err, errDiffUnavailable) {
+			return blocklist, err
+		}
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("creating request: %w", err)
+	fetch := stats.APIFetch{Kind: stats.FetchFull}
+	start := time.Now()
+	ctx, span := c.startFetchSpan(ctx, fetch.Kind)
+	blocklist, err := c.fetchFull(ctx, hash, &fetch)
+	c.recordFetch(&fetch, start, err)
+	endFetchSpan(span, &fetch, err)
+	return blocklist, err
+}
+
+// startFetchSpan starts the span for one blocklist request of kind.
+func (c *Client) startFetchSpan(ctx context.Context, kind string) (context.Context, trace.Span) {
+	return c.tracer.Start(ctx, "opl.blocklist.fetch",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("opl.fetch.kind", kind)),
+	)
+}
+
+// endFetchSpan records the outcome in fetch on span and ends it.
+func endFetchSpan(span trace.Span, fetch *stats.APIFetch, err error) {
+	span.SetAttributes(
+		attribute.String("opl.fetch.result", fetch.Result),
+		attribute.Int64("opl.fetch.bytes", fetch.Bytes),
+	)
+	if err != nil && !errors.Is(err, errDiffUnavailable) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "fetch failed")
 	}
+	span.End()
+}
 
-	if c.apiKey != "" {
-		req.Header.Set("X-API-Key", c.apiKey)
+// recordFetch completes fetch from the outcome of a request started at start
+// and passes it to the recorder. Requests abandoned because ctx was
+// cancelled are not recorded.
+func (c *Client) recordFetch(fetch *stats.APIFetch, start time.Time, err error) {
+	fetch.Duration = time.Since(start)
+
+	switch {
+	case err == nil:
+		if fetch.Result == "" {
+			fetch.Result = stats.FetchOK
+		}
+		c.consecutiveFailures.Store(0)
+	case errors.Is(err, errDiffUnavailable):
+		fetch.Result = stats.FetchUnavailable
+	case errors.Is(err, context.Canceled):
+		return
+	default:
+		fetch.Result = stats.FetchError
+		fetch.ConsecutiveFailures = int(c.consecutiveFailures.Add(1))
 	}
-	req.Header.Set("Accept", "application/json")
-	req.Header.Set("User-Agent", "OPL-DNS-Server/1.0.0")
 
-	resp, err := c.httpClient.Do(req)
+	c.recorder.RecordAPIFetch(*fetch)
+}
+
+// ConsecutiveFailures returns the number of blocklist fetches that have
+// failed since the last successful one.
+func (c *Client) ConsecutiveFailures() int {
+	return int(c.consecutiveFailures.Load())
+}
+
+// fetchFull downloads and parses the entire blocklist, filling in fetch's
+// size, parse time and not-modified result.
+func (c *Client) fetchFull(ctx context.Context, hash string, fetch *stats.APIFetch) (*Blocklist, error) {
+	reqURL := fmt.Sprintf("%s/blocklist.json", c.baseURL)
+	if hash != "" {
+		reqURL = fmt.Sprintf("%s?hash=%s", reqURL, url.QueryEscape(hash))
+	}
+
+	resp, err := c.get(ctx, reqURL)
 	if err != nil {
-		return nil, fmt.Errorf("making request: %w", err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	// Handle 304 Not Modified
 	if resp.StatusCode == http.StatusNotModified {
+		fetch.Result = stats.FetchNotModified
 		c.mu.RLock()
 		defer c.mu.RUnlock()
 		return c.blocklist, nil
@@ -134,27 +313,169 @@ func (c *Client) FetchBlocklist(ctx context.Context) (*Blocklist, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API returned status %d: %s", resp.StatusCode, string(body))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	body, err := io.ReadAll(resp.Body)
+	fetch.Bytes = int64(len(body))
 	if err != nil {
 		return nil, fmt.Errorf("reading response: %w", err)
 	}
 
-	// Parse the OPL blocklist format (map keyed by employer name)
-	var rawBlocklist map[string]json.RawMessage
-	if err := json.Unmarshal(body, &rawBlocklist); err != nil {
-		return nil, fmt.Errorf("parsing response: %w", err)
+	parseStart := time.Now()
+	entries, parseIssues, err := parseBlocklist(body)
+	if err != nil {
+		return nil, err
 	}
+	blocklist := buildBlocklist(entries, c.filter, c.now())
+	fetch.ParseDuration = time.Since(parseStart)
+	version := c.versionOf(entries)
+	lint := lintEntries(entries, parseIssues)
 
-	blocklist := &Blocklist{
-		GeneratedAt: time.Now().Format(time.RFC3339),
-		domainMap:   make(map[string]*BlockListItem),
+	// Update cache
+	c.mu.Lock()
+	c.entries = entries
+	c.entriesGen++
+	c.parseIssues = parseIssues
+	blocklist, lint = c.enforceLocked(blocklist, lint, version)
+	update := c.setBlocklistLocked(blocklist, lint)
+	c.lastFetch = time.Now()
+	if newHash := resp.Header.Get("X-Content-Hash"); newHash != "" {
+		c.contentHash = newHash
+	}
+	c.mu.Unlock()
+
+	c.publish(update)
+	c.keepVersion(version, entries)
+	return blocklist, nil
+}
+
+// fetchDiff downloads only the employers changed since hash and applies them
+// to the cached entries. It returns errDiffUnavailable when the backend has
+// no diff for hash (410) or does not implement the endpoint (404). It fills
+// in fetch as fetchFull does.
+func (c *Client) fetchDiff(ctx context.Context, hash string, fetch *stats.APIFetch) (*Blocklist, error) {
+	reqURL := fmt.Sprintf("%s/blocklist/diff?since=%s", c.baseURL, url.QueryEscape(hash))
+
+	resp, err := c.get(ctx, reqURL)
+	if err != nil {
+		return nil, err
 	}
+	defer resp.Body.Close()
 
-	employerSet := make(map[string]bool)
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		fetch.Result = stats.FetchNotModified
+		c.mu.RLock()
+		defer c.mu.RUnlock()
+		return c.blocklist, nil
+	case http.StatusNotFound:
+		// Remember so we don't ask again on every refresh
+		c.diffUnsupported.Store(true)
+		return nil, errDiffUnavailable
+	case http.StatusGone:
+		return nil, errDiffUnavailable
+	default:
+		body, _ := io.ReadAll(resp.Body)
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
 
+	body, err := io.ReadAll(resp.Body)
+	fetch.Bytes = int64(len(body))
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+
+	parseStart := time.Now()
+	var diff BlocklistDiff
+	if err := json.Unmarshal(body, &diff); err != nil {
+		return nil, fmt.Errorf("parsing diff response: %w", err)
+	}
+	fetch.ParseDuration = time.Since(parseStart)
+
+	// Apply the diff and build without holding the lock, which queries
+	// need. The cached entries are replaced on update, never modified.
+	c.mu.RLock()
+	cached, gen, cachedHash, parseIssues := c.entries, c.entriesGen, c.contentHash, c.parseIssues
+	c.mu.RUnlock()
+	// A concurrent update moved the cache on; the diff no longer applies
+	if cachedHash != hash {
+		return nil, errDiffUnavailable
+	}
+
+	entries := maps.Clone(cached)
+	for _, employer := range diff.Removed {
+		delete(entries, employer)
+	}
+	for employer, entry := range diff.Changed {
+		if strings.HasPrefix(employer, "_") {
+			continue
+		}
+		entries[employer] = entry
+	}
+
+	buildStart := time.Now()
+	blocklist := buildBlocklist(entries, c.filter, c.now())
+	fetch.ParseDuration += time.Since(buildStart)
+	version := c.versionOf(entries)
+	lint := lintEntries(entries, parseIssues)
+
+	c.mu.Lock()
+	// Another update landed while the diff was being applied
+	if c.entriesGen != gen || c.contentHash != hash {
+		c.mu.Unlock()
+		return nil, errDiffUnavailable
+	}
+	c.entries = entries
+	c.entriesGen++
+	blocklist, lint = c.enforceLocked(blocklist, lint, version)
+	update := c.setBlocklistLocked(blocklist, lint)
+	c.lastFetch = time.Now()
+	if diff.Hash != "" {
+		c.contentHash = diff.Hash
+	} else if newHash := resp.Header.Get("X-Content-Hash"); newHash != "" {
+		c.contentHash = newHash
+	}
+	c.mu.Unlock()
+
+	c.publish(update)
+	c.keepVersion(version, entries)
+	return blocklist, nil
+}
+
+// get issues an authenticated GET request to the API.
+func (c *Client) get(ctx context.Context, reqURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "OPL-DNS-Server/1.0.0")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("making request: %w", err)
+	}
+	return resp, nil
+}
+
+// parseBlocklist decodes the OPL blocklist format, a map keyed by employer
+// name. Internal fields are skipped; malformed entries are skipped and
+// returned as lint issues.
+func parseBlocklist(body []byte) (map[string]OPLBlocklistEntry, []LintIssue, error) {
+	var rawBlocklist map[string]json.RawMessage
+	if err := json.Unmarshal(body, &rawBlocklist); err != nil {
+		return nil, nil, fmt.Errorf("parsing response: %w", err)
+	}
+
+	var issues []LintIssue
+
+	entries := make(map[string]OPLBlocklistEntry, len(rawBlocklist))
 	for employerName, rawEntry := range rawBlocklist {
 		// Skip internal fields like _optimizedPatterns
 		if strings.HasPrefix(employerName, "_") {
@@ -163,19 +484,48 @@ func (c *Client) FetchBlocklist(ctx context.Context) (*Blocklist, error) {
 
 		var entry OPLBlocklistEntry
 		if err := json.Unmarshal(rawEntry, &entry); err != nil {
-			// Skip entries that don't match expected format
+			issues = append(issues, LintIssue{
+				Severity: LintError,
+				Code:     LintMalformedEntry,
+				Employer: employerName,
+				Message:  fmt.Sprintf("entry does not match the blocklist format and is ignored: %v", err),
+			})
 			continue
 		}
+		entries[employerName] = entry
+	}
 
-		// Add employer to set
-		if !employerSet[employerName] {
-			employerSet[employerName] = true
-			blocklist.Employers = append(blocklist.Employers, Employer{
-				ID:       entry.ActionDetails.ID,
-				Name:     employerName,
-				URLCount: len(entry.MatchingURLRegexes),
-			})
+	sort.Slice(issues, func(i, j int) bool { return issues[i].Employer < issues[j].Employer })
+	return entries, issues, nil
+}
+
+// buildBlocklist flattens employer entries that pass filter and have not
+// expired at now into a Blocklist with its domain lookup map. Employers are
+// processed in name order so the result is deterministic.
+func buildBlocklist(entries map[string]OPLBlocklistEntry, filter Filter, now time.Time) *Blocklist {
+	blocklist := &Blocklist{
+		GeneratedAt: time.Now().Format(time.RFC3339),
+		domainMap:   make(map[string]*BlockListItem),
+	}
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, employerName := range names {
+		entry := entries[employerName]
+		if !filter.Allows(entry) || expired(entry, now) {
+			continue
 		}
+		expires := expiresAt(entry)
+
+		blocklist.Employers = append(blocklist.Employers, Employer{
+			ID:       entry.ActionDetails.ID,
+			Name:     employerName,
+			URLCount: len(entry.MatchingURLRegexes),
+		})
 
 		// Add each URL/domain to the blocklist
 		for _, urlPattern := range entry.MatchingURLRegexes {
@@ -184,48 +534,29 @@ func (c *Client) FetchBlocklist(ctx context.Context) (*Blocklist, error) {
 				continue
 			}
 
-			item := BlockListItem{
-				URL:         urlPattern,
-				Domain:      domain,
-				Employer:    employerName,
-				EmployerID:  entry.ActionDetails.ID,
-				Reason:      entry.ActionDetails.ActionType,
-				StartDate:   entry.ActionDetails.StartDate,
-				MoreInfoURL: entry.MoreInfoURL,
-				Location:    entry.ActionDetails.Location,
-				ActionDetails: ActionDetails{
-					ID:           entry.ActionDetails.ID,
-					Organization: entry.ActionDetails.Organization,
-					ActionType:   entry.ActionDetails.ActionType,
-					Status:       entry.ActionDetails.Status,
-					StartDate:    entry.ActionDetails.StartDate,
-					Description:  entry.ActionDetails.Description,
-					Demands:      entry.ActionDetails.Demands,
-					Location:     entry.ActionDetails.Location,
-					UnionLogoURL: entry.ActionDetails.UnionLogoURL,
-					LearnMoreURL: entry.ActionDetails.LearnMoreURL,
-				},
-			}
-
-			blocklist.BlockList = append(blocklist.BlockList, item)
+			blocklist.BlockList = append(blocklist.BlockList, BlockListItem{
+				URL:           urlPattern,
+				Domain:        domain,
+				Employer:      employerName,
+				EmployerID:    entry.ActionDetails.ID,
+				Reason:        entry.ActionDetails.ActionType,
+				StartDate:     entry.ActionDetails.StartDate,
+				MoreInfoURL:   entry.MoreInfoURL,
+				Location:      entry.ActionDetails.Location,
+				ActionDetails: entry.ActionDetails,
+				ExpiresAt:     expires,
+			})
 			blocklist.TotalURLs++
-
-			// Add to domain map for fast lookup
-			normalizedDomain := strings.ToLower(domain)
-			blocklist.domainMap[normalizedDomain] = &blocklist.BlockList[len(blocklist.BlockList)-1]
 		}
 	}
 
-	// Update cache
-	c.mu.Lock()
-	c.blocklist = blocklist
-	c.lastFetch = time.Now()
-	if newHash := resp.Header.Get("X-Content-Hash"); newHash != "" {
-		c.contentHash = newHash
+	// Build the domain map once the slice is final so pointers stay valid
+	for i := range blocklist.BlockList {
+		item := &blocklist.BlockList[i]
+		blocklist.domainMap[strings.ToLower(item.Domain)] = item
 	}
-	c.mu.Unlock()
 
-	return blocklist, nil
+	return blocklist
 }
 
 // GetCachedBlocklist returns the cached blocklist without making an API request.
@@ -235,7 +566,9 @@ func (c *Client) GetCachedBlocklist() *Blocklist {
 	return c.blocklist
 }
 
-// CheckDomain checks if a domain is in the blocklist.
+// CheckDomain checks if a domain is in the blocklist. Items whose action
+// has ended since the last fetch are skipped, so a settled action stops
+// blocking on time even if the next refresh is a while off.
 func (c *Client) CheckDomain(domain string) (*BlockListItem, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -244,11 +577,13 @@ func (c *Client) CheckDomain(domain string) (*BlockListItem, bool) {
 		return nil, false
 	}
 
+	now := c.now()
+
 	// Normalize domain
 	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
 
 	// Direct lookup
-	if item, ok := c.blocklist.domainMap[domain]; ok {
+	if item, ok := c.blocklist.domainMap[domain]; ok && !item.Expired(now) {
 		return item, true
 	}
 
@@ -256,7 +591,7 @@ func (c *Client) CheckDomain(domain string) (*BlockListItem, bool) {
 	parts := strings.Split(domain, ".")
 	for i := 1; i < len(parts)-1; i++ {
 		parentDomain := strings.Join(parts[i:], ".")
-		if item, ok := c.blocklist.domainMap[parentDomain]; ok {
+		if item, ok := c.blocklist.domainMap[parentDomain]; ok && !item.Expired(now) {
 			return item, true
 		}
 	}
@@ -271,10 +606,16 @@ func (c *Client) LastFetchTime() time.Time {
 	return c.lastFetch
 }
 
+// CloseIdleConnections closes any idle keep-alive connections to the API.
+// It is safe to keep using the client afterwards.
+func (c *Client) CloseIdleConnections() {
+	c.httpClient.CloseIdleConnections()
+}
+
 // SetBlocklistForTesting sets the blocklist directly (for testing purposes).
+// Registered hooks are notified as for a fetch.
 func (c *Client) SetBlocklistForTesting(blocklist *Blocklist) {
 	c.mu.Lock()
-	defer c.mu.Unlock()
 
 	// Build domain map
 	blocklist.domainMap = make(map[string]*BlockListItem)
@@ -286,8 +627,11 @@ func (c *Client) SetBlocklistForTesting(blocklist *Blocklist) {
 		}
 	}
 
-	c.blocklist = blocklist
+	update := c.setBlocklistLocked(blocklist, lintEntries(c.entries, c.parseIssues))
 	c.lastFetch = time.Now()
+	c.mu.Unlock()
+
+	c.publish(update)
 }
 
 // extractDomain extracts the domain from a URL.
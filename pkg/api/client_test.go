@@ -5,8 +5,11 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
 )
 
 func TestNewClient(t *testing.T) {
@@ -123,6 +126,101 @@ func TestFetchBlocklistNotModified(t *testing.T) {
 	}
 }
 
+func TestFetchBlocklistDiff(t *testing.T) {
+	var fullFetches, diffFetches int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/blocklist.json":
+			fullFetches++
+			w.Header().Set("X-Content-Hash", "hash1")
+			json.NewEncoder(w).Encode(map[string]OPLBlocklistEntry{
+				"Old Corp":  {MatchingURLRegexes: []string{"old.example"}},
+				"Keep Corp": {MatchingURLRegexes: []string{"keep.example"}},
+			})
+		case "/blocklist/diff":
+			diffFetches++
+			if r.URL.Query().Get("since") != "hash1" {
+				t.Errorf("Expected since=hash1, got '%s'", r.URL.Query().Get("since"))
+			}
+			json.NewEncoder(w).Encode(BlocklistDiff{
+				Hash:    "hash2",
+				Changed: map[string]OPLBlocklistEntry{"New Corp": {MatchingURLRegexes: []string{"new.example"}}},
+				Removed: []string{"Old Corp"},
+			})
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 10*time.Second, WithDeltaUpdates(true))
+
+	if _, err := client.FetchBlocklist(context.Background()); err != nil {
+		t.Fatalf("First fetch failed: %v", err)
+	}
+	blocklist, err := client.FetchBlocklist(context.Background())
+	if err != nil {
+		t.Fatalf("Diff fetch failed: %v", err)
+	}
+
+	if fullFetches != 1 || diffFetches != 1 {
+		t.Errorf("Expected 1 full and 1 diff fetch, got %d and %d", fullFetches, diffFetches)
+	}
+	if blocklist.TotalURLs != 2 {
+		t.Errorf("Expected 2 URLs after diff, got %d", blocklist.TotalURLs)
+	}
+	if _, blocked := client.CheckDomain("old.example"); blocked {
+		t.Error("Expected removed employer to be unblocked")
+	}
+	if _, blocked := client.CheckDomain("new.example"); !blocked {
+		t.Error("Expected changed employer to be blocked")
+	}
+	if client.contentHash != "hash2" {
+		t.Errorf("Expected content hash 'hash2', got '%s'", client.contentHash)
+	}
+}
+
+func TestFetchBlocklistDiffFallback(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int
+		wantUnsupported bool
+	}{
+		{"endpoint missing", http.StatusNotFound, true},
+		{"hash expired", http.StatusGone, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fullFetches int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/blocklist/diff" {
+					w.WriteHeader(tt.status)
+					return
+				}
+				fullFetches++
+				w.Header().Set("X-Content-Hash", "hash1")
+				json.NewEncoder(w).Encode(map[string]OPLBlocklistEntry{
+					"Test Corp": {MatchingURLRegexes: []string{"example.com"}},
+				})
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL, "", 10*time.Second, WithDeltaUpdates(true))
+			for i := 0; i < 2; i++ {
+				if _, err := client.FetchBlocklist(context.Background()); err != nil {
+					t.Fatalf("Fetch %d failed: %v", i+1, err)
+				}
+			}
+
+			if fullFetches != 2 {
+				t.Errorf("Expected fallback to full fetch, got %d full fetches", fullFetches)
+			}
+			if client.diffUnsupported.Load() != tt.wantUnsupported {
+				t.Errorf("Expected diffUnsupported=%v", tt.wantUnsupported)
+			}
+		})
+	}
+}
+
 func TestFetchBlocklistError(t *testing.T) {
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
@@ -137,6 +235,68 @@ func TestFetchBlocklistError(t *testing.T) {
 	}
 }
 
+func TestFetchBlocklistRecordsMetrics(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch code := int(status.Load()); code {
+		case http.StatusOK:
+			w.Header().Set("X-Content-Hash", "hash1")
+			json.NewEncoder(w).Encode(map[string]OPLBlocklistEntry{
+				"Test Corp": {MatchingURLRegexes: []string{"example.com"}},
+			})
+		default:
+			w.WriteHeader(code)
+		}
+	}))
+	defer server.Close()
+
+	collector := stats.NewCollector()
+	client := NewClient(server.URL, "", 10*time.Second, WithRecorder(collector))
+
+	fetch := func() {
+		t.Helper()
+		client.FetchBlocklist(context.Background())
+	}
+
+	fetch()
+	s := collector.APIFetchStats()
+	if s.Fetches != 1 || s.LastBytes == 0 {
+		t.Errorf("Expected 1 fetch with a recorded size, got %+v", s)
+	}
+
+	status.Store(http.StatusNotModified)
+	fetch()
+	status.Store(http.StatusInternalServerError)
+	fetch()
+	fetch()
+
+	s = collector.APIFetchStats()
+	if s.Fetches != 4 || s.NotModified != 1 || s.Failures != 2 {
+		t.Errorf("Expected 4 fetches, 1 not modified and 2 failures, got %+v", s)
+	}
+	if s.NotModifiedRatio != 0.25 {
+		t.Errorf("Expected not-modified ratio 0.25, got %v", s.NotModifiedRatio)
+	}
+	if s.ConsecutiveFailures != 2 || client.ConsecutiveFailures() != 2 {
+		t.Errorf("Expected 2 consecutive failures, got %d and %d", s.ConsecutiveFailures, client.ConsecutiveFailures())
+	}
+
+	status.Store(http.StatusNotModified)
+	fetch()
+	if n := client.ConsecutiveFailures(); n != 0 {
+		t.Errorf("Expected consecutive failures reset after success, got %d", n)
+	}
+
+	// A cancelled fetch is not a failure of the API
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client.FetchBlocklist(ctx)
+	if s := collector.APIFetchStats(); s.Fetches != 5 || client.ConsecutiveFailures() != 0 {
+		t.Errorf("Expected cancelled fetch not to be recorded, got %+v", s)
+	}
+}
+
 func TestCheckDomain(t *testing.T) {
 	// Setup client with mock blocklist
 	client := NewClient("https://api.example.com", "", 10*time.Second)
@@ -164,8 +324,8 @@ func TestCheckDomain(t *testing.T) {
 	}{
 		{"example.com", true, "Test Corp"},
 		{"EXAMPLE.COM", true, "Test Corp"},
-		{"www.example.com", true, "Test Corp"},     // Should match parent domain
-		{"sub.example.com", true, "Test Corp"},     // Should match parent domain
+		{"www.example.com", true, "Test Corp"}, // Should match parent domain
+		{"sub.example.com", true, "Test Corp"}, // Should match parent domain
 		{"www.blocked.com", true, "Another Corp"},
 		{"notblocked.com", false, ""},
 		{"facebook.com", true, "Test Corp"},
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"strings"
+	"time"
+)
+
+// Statuses that mean an action is over. Entries with these statuses are
+// never enforced, whatever the filter says.
+var resolvedStatuses = map[string]bool{
+	"resolved": true,
+	"ended":    true,
+}
+
+// parseEndTime parses an action end timestamp, either RFC 3339 or a plain
+// date. A plain date ends at midnight UTC after that day, so an action is
+// still enforced on its last day. An empty value returns the zero time.
+func parseEndTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return day.AddDate(0, 0, 1), nil
+}
+
+// expiresAt returns when entry stops being enforced, or the zero time if it
+// has no end. When both the entry and its action details carry an end, the
+// earlier one wins. Unparseable values are ignored here and reported by lint.
+func expiresAt(entry OPLBlocklistEntry) time.Time {
+	var earliest time.Time
+	for _, value := range []string{entry.EndTime, entry.ActionDetails.EndDate} {
+		t, err := parseEndTime(value)
+		if err != nil || t.IsZero() {
+			continue
+		}
+		if earliest.IsZero() || t.Before(earliest) {
+			earliest = t
+		}
+	}
+	return earliest
+}
+
+// expired reports whether entry's action is over at now, either because it
+// is marked resolved or because its end has passed.
+func expired(entry OPLBlocklistEntry, now time.Time) bool {
+	if resolvedStatuses[strings.ToLower(entry.ActionDetails.Status)] {
+		return true
+	}
+	end := expiresAt(entry)
+	return !end.IsZero() && !now.Before(end)
+}
+
+// Expired reports whether the item's action has ended by now. Items whose
+// action has no end never expire.
+func (item *BlockListItem) Expired(now time.Time) bool {
+	return !item.ExpiresAt.IsZero() && !now.Before(item.ExpiresAt)
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseEndTime(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{"", time.Time{}, false},
+		{"2026-03-01T17:00:00Z", time.Date(2026, 3, 1, 17, 0, 0, 0, time.UTC), false},
+		{"2026-03-01T17:00:00-05:00", time.Date(2026, 3, 1, 22, 0, 0, 0, time.UTC), false},
+		{"2026-03-01", time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC), false},
+		{"March 1st", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseEndTime(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseEndTime(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseEndTime(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpired(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		entry   OPLBlocklistEntry
+		expired bool
+	}{
+		{"active, no end", OPLBlocklistEntry{ActionDetails: ActionDetails{Status: "active"}}, false},
+		{"resolved", OPLBlocklistEntry{ActionDetails: ActionDetails{Status: "Resolved"}}, true},
+		{"ended", OPLBlocklistEntry{ActionDetails: ActionDetails{Status: "ended"}}, true},
+		{"end time passed", OPLBlocklistEntry{EndTime: "2026-03-01T11:59:59Z"}, true},
+		{"end time ahead", OPLBlocklistEntry{EndTime: "2026-03-01T12:00:01Z"}, false},
+		{"end date is today", OPLBlocklistEntry{ActionDetails: ActionDetails{EndDate: "2026-03-01"}}, false},
+		{"end date was yesterday", OPLBlocklistEntry{ActionDetails: ActionDetails{EndDate: "2026-02-28"}}, true},
+		{"earlier end wins", OPLBlocklistEntry{EndTime: "2026-04-01", ActionDetails: ActionDetails{EndDate: "2026-02-28"}}, true},
+		{"invalid end ignored", OPLBlocklistEntry{EndTime: "soon"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expired(tt.entry, now); got != tt.expired {
+				t.Errorf("expired: expected %v, got %v", tt.expired, got)
+			}
+		})
+	}
+}
+
+func TestExpiryBetweenFetches(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]OPLBlocklistEntry{
+			"Settled Corp": {
+				MatchingURLRegexes: []string{"settled.example"},
+				ActionDetails:      ActionDetails{Status: "resolved"},
+			},
+			"Ending Corp": {
+				MatchingURLRegexes: []string{"ending.example", "www.parent.example"},
+				EndTime:            "2026-03-01T13:00:00Z",
+				ActionDetails:      ActionDetails{Status: "active"},
+			},
+			"Parent Corp": {
+				MatchingURLRegexes: []string{"parent.example"},
+				ActionDetails:      ActionDetails{Status: "active"},
+			},
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 10*time.Second)
+	client.now = func() time.Time { return now }
+
+	blocklist, err := client.FetchBlocklist(context.Background())
+	if err != nil {
+		t.Fatalf("FetchBlocklist failed: %v", err)
+	}
+	if len(blocklist.Employers) != 2 {
+		t.Errorf("Expected the resolved action to be dropped, got employers %+v", blocklist.Employers)
+	}
+	if _, blocked := client.CheckDomain("settled.example"); blocked {
+		t.Error("Expected resolved action not to block")
+	}
+	if _, blocked := client.CheckDomain("ending.example"); !blocked {
+		t.Error("Expected action to block before its end time")
+	}
+
+	// The end time passes before the next fetch
+	now = now.Add(2 * time.Hour)
+
+	if _, blocked := client.CheckDomain("ending.example"); blocked {
+		t.Error("Expected action to stop blocking after its end time")
+	}
+	item, blocked := client.CheckDomain("www.parent.example")
+	if !blocked || item.Employer != "Parent Corp" {
+		t.Errorf("Expected expired item to fall through to its parent domain, got %+v", item)
+	}
+}
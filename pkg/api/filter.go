@@ -0,0 +1,101 @@
+package api
+
+import "strings"
+
+// Action statuses ordered from least to most current. MinStatus filtering
+// compares against this ordering.
+var statusRank = map[string]int{
+	"resolved": 0,
+	"ended":    0,
+	"planned":  1,
+	"upcoming": 1,
+	"active":   2,
+}
+
+// Filter selects which blocklist entries are enforced. The zero value
+// allows everything.
+type Filter struct {
+	// ActionTypes restricts enforcement to these action types (e.g. "strike",
+	// "lockout"), compared case-insensitively. Empty allows all types.
+	ActionTypes []string
+
+	// MinStatus drops entries whose status ranks below it, e.g. "active"
+	// drops planned and resolved actions. Entries with an empty or unknown
+	// status are kept so an unexpected API value never silently unblocks.
+	MinStatus string
+
+	// Regions restricts enforcement to actions in these ISO 3166 region
+	// codes. A country code also matches its subdivisions, so "US" matches
+	// "US-CA".
+	Regions []string
+
+	// Locations restricts enforcement to actions whose free-text Location
+	// contains one of these strings, compared case-insensitively.
+	Locations []string
+}
+
+// Allows reports whether entry passes the filter.
+func (f Filter) Allows(entry OPLBlocklistEntry) bool {
+	if len(f.ActionTypes) > 0 {
+		matched := false
+		for _, t := range f.ActionTypes {
+			if strings.EqualFold(t, entry.ActionDetails.ActionType) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if !f.inScope(entry.ActionDetails) {
+		return false
+	}
+
+	if f.MinStatus != "" {
+		minRank, ok := statusRank[strings.ToLower(f.MinStatus)]
+		rank, known := statusRank[strings.ToLower(entry.ActionDetails.Status)]
+		if ok && known && rank < minRank {
+			return false
+		}
+	}
+
+	return true
+}
+
+// inScope applies geographic scoping. Actions without any region or location
+// are treated as global and always in scope.
+func (f Filter) inScope(details ActionDetails) bool {
+	if len(f.Regions) == 0 && len(f.Locations) == 0 {
+		return true
+	}
+	if details.Region == "" && details.Location == "" {
+		return true
+	}
+
+	region := strings.ToUpper(details.Region)
+	for _, r := range f.Regions {
+		r = strings.ToUpper(r)
+		if region == r || strings.HasPrefix(region, r+"-") {
+			return true
+		}
+	}
+
+	location := strings.ToLower(details.Location)
+	for _, l := range f.Locations {
+		if l != "" && strings.Contains(location, strings.ToLower(l)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WithFilter restricts which entries are enforced. Filtered entries are kept
+// in the raw cache so later diffs and stream events still apply to them.
+func WithFilter(f Filter) ClientOption {
+	return func(c *Client) {
+		c.filter = f
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFilterAllows(t *testing.T) {
+	entry := func(actionType, status string) OPLBlocklistEntry {
+		return OPLBlocklistEntry{ActionDetails: ActionDetails{ActionType: actionType, Status: status}}
+	}
+
+	tests := []struct {
+		name    string
+		filter  Filter
+		entry   OPLBlocklistEntry
+		allowed bool
+	}{
+		{"zero filter", Filter{}, entry("boycott", "resolved"), true},
+		{"type included", Filter{ActionTypes: []string{"strike", "lockout"}}, entry("Strike", "active"), true},
+		{"type excluded", Filter{ActionTypes: []string{"strike", "lockout"}}, entry("boycott", "active"), false},
+		{"status meets minimum", Filter{MinStatus: "planned"}, entry("strike", "active"), true},
+		{"status below minimum", Filter{MinStatus: "active"}, entry("strike", "planned"), false},
+		{"resolved below active", Filter{MinStatus: "active"}, entry("strike", "resolved"), false},
+		{"empty status kept", Filter{MinStatus: "active"}, entry("strike", ""), true},
+		{"unknown status kept", Filter{MinStatus: "active"}, entry("strike", "escalating"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Allows(tt.entry); got != tt.allowed {
+				t.Errorf("Allows: expected %v, got %v", tt.allowed, got)
+			}
+		})
+	}
+}
+
+func TestFilterGeographicScope(t *testing.T) {
+	entry := func(region, location string) OPLBlocklistEntry {
+		return OPLBlocklistEntry{ActionDetails: ActionDetails{Region: region, Location: location}}
+	}
+
+	tests := []struct {
+		name    string
+		filter  Filter
+		entry   OPLBlocklistEntry
+		allowed bool
+	}{
+		{"unscoped filter", Filter{}, entry("US-CA", "Oakland"), true},
+		{"global action", Filter{Regions: []string{"PT"}}, entry("", ""), true},
+		{"region match", Filter{Regions: []string{"PT"}}, entry("pt", ""), true},
+		{"country matches subdivision", Filter{Regions: []string{"US"}}, entry("US-CA", ""), true},
+		{"subdivision does not match country", Filter{Regions: []string{"US-CA"}}, entry("US", ""), false},
+		{"region mismatch", Filter{Regions: []string{"PT"}}, entry("US-NY", "New York"), false},
+		{"prefix is not a subdivision", Filter{Regions: []string{"US"}}, entry("USA", ""), false},
+		{"location match", Filter{Locations: []string{"lisbon"}}, entry("", "Lisbon, Portugal"), true},
+		{"location mismatch", Filter{Locations: []string{"Lisbon"}}, entry("", "Chicago, IL"), false},
+		{"either region or location", Filter{Regions: []string{"ES"}, Locations: []string{"Portugal"}}, entry("PT", "Porto, Portugal"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Allows(tt.entry); got != tt.allowed {
+				t.Errorf("Allows: expected %v, got %v", tt.allowed, got)
+			}
+		})
+	}
+}
+
+func TestFetchBlocklistWithFilter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]OPLBlocklistEntry{
+			"Strike Corp":  {MatchingURLRegexes: []string{"strike.example"}, ActionDetails: ActionDetails{ActionType: "strike", Status: "active"}},
+			"Boycott Corp": {MatchingURLRegexes: []string{"boycott.example"}, ActionDetails: ActionDetails{ActionType: "boycott", Status: "active"}},
+			"Planned Corp": {MatchingURLRegexes: []string{"planned.example"}, ActionDetails: ActionDetails{ActionType: "strike", Status: "planned"}},
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 10*time.Second, WithFilter(Filter{
+		ActionTypes: []string{"strike"},
+		MinStatus:   "active",
+	}))
+
+	blocklist, err := client.FetchBlocklist(context.Background())
+	if err != nil {
+		t.Fatalf("FetchBlocklist failed: %v", err)
+	}
+
+	if len(blocklist.Employers) != 1 || blocklist.Employers[0].Name != "Strike Corp" {
+		t.Errorf("Expected only Strike Corp, got %+v", blocklist.Employers)
+	}
+	if _, blocked := client.CheckDomain("boycott.example"); blocked {
+		t.Error("Expected boycott to be filtered out")
+	}
+	if _, blocked := client.CheckDomain("planned.example"); blocked {
+		t.Error("Expected planned action to be filtered out")
+	}
+	if _, blocked := client.CheckDomain("strike.example"); !blocked {
+		t.Error("Expected active strike to be blocked")
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"slices"
+	"sort"
+	"strings"
+)
+
+// BlocklistChange describes one update to the cached blocklist.
+type BlocklistChange struct {
+	// Previous is the blocklist before the update, or nil on first load.
+	Previous *Blocklist
+
+	// Current is the blocklist now in effect.
+	Current *Blocklist
+
+	// Added holds entries for domains that were not blocked before.
+	Added []BlockListItem
+
+	// Removed holds entries for domains that are no longer blocked.
+	Removed []BlockListItem
+}
+
+// hooks holds callbacks registered on a Client.
+type hooks struct {
+	updated []func(BlocklistChange)
+	added   []func(BlockListItem)
+	removed []func(BlockListItem)
+}
+
+// OnBlocklistUpdated registers fn to be called after every successful fetch
+// or stream event that replaces the cached blocklist. It is not called when
+// the API reports the blocklist unchanged.
+//
+// Hooks run synchronously on the goroutine that applied the update, after
+// the new blocklist is visible to CheckDomain, so they should return
+// quickly. Register hooks before starting fetches.
+func (c *Client) OnBlocklistUpdated(fn func(BlocklistChange)) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+	c.hooks.updated = append(c.hooks.updated, fn)
+}
+
+// OnEntryAdded registers fn to be called for each newly blocked domain,
+// under the same rules as OnBlocklistUpdated.
+func (c *Client) OnEntryAdded(fn func(BlockListItem)) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+	c.hooks.added = append(c.hooks.added, fn)
+}
+
+// OnEntryRemoved registers fn to be called for each domain that is no
+// longer blocked, under the same rules as OnBlocklistUpdated.
+func (c *Client) OnEntryRemoved(fn func(BlockListItem)) {
+	c.hooksMu.Lock()
+	defer c.hooksMu.Unlock()
+	c.hooks.removed = append(c.hooks.removed, fn)
+}
+
+// blocklistUpdate is the result of replacing the cached blocklist, announced
+// by publish once c.mu is released.
+type blocklistUpdate struct {
+	change      BlocklistChange
+	lint        *LintReport
+	lintChanged bool
+}
+
+// setBlocklistLocked installs blocklist as the cached list and lint as the
+// report on the entries it was built from. Linting takes time proportional
+// to the entries, so callers do it before taking c.mu. The caller holds c.mu.
+func (c *Client) setBlocklistLocked(blocklist *Blocklist, lint *LintReport) blocklistUpdate {
+	prevLint := c.lint
+	c.lint = lint
+
+	update := blocklistUpdate{
+		change:      diffBlocklists(c.blocklist, blocklist),
+		lint:        c.lint,
+		lintChanged: prevLint == nil || !slices.Equal(prevLint.Issues, c.lint.Issues),
+	}
+	c.blocklist = blocklist
+	return update
+}
+
+// publish logs new lint findings and runs the registered hooks for update.
+func (c *Client) publish(update blocklistUpdate) {
+	if update.lintChanged && len(update.lint.Issues) > 0 {
+		c.logger.Warn("Blocklist data has problems",
+			"errors", update.lint.Errors(),
+			"warnings", update.lint.Warnings(),
+		)
+		for _, issue := range update.lint.Issues {
+			c.logger.Debug("Blocklist lint issue",
+				"severity", issue.Severity,
+				"code", issue.Code,
+				"employer", issue.Employer,
+				"pattern", issue.Pattern,
+				"message", issue.Message,
+			)
+		}
+	}
+	c.notify(update.change)
+}
+
+// notify runs the registered hooks for change.
+func (c *Client) notify(change BlocklistChange) {
+	c.hooksMu.Lock()
+	h := c.hooks
+	c.hooksMu.Unlock()
+
+	for _, fn := range h.removed {
+		for _, item := range change.Removed {
+			fn(item)
+		}
+	}
+	for _, fn := range h.added {
+		for _, item := range change.Added {
+			fn(item)
+		}
+	}
+	for _, fn := range h.updated {
+		fn(change)
+	}
+}
+
+// diffBlocklists compares the blocked domains of two blocklists. Either may
+// be nil. Results are sorted by domain.
+func diffBlocklists(prev, curr *Blocklist) BlocklistChange {
+	change := BlocklistChange{Previous: prev, Current: curr}
+
+	prevDomains := blockedDomains(prev)
+	currDomains := blockedDomains(curr)
+	for domain, item := range currDomains {
+		if _, ok := prevDomains[domain]; !ok {
+			change.Added = append(change.Added, *item)
+		}
+	}
+	for domain, item := range prevDomains {
+		if _, ok := currDomains[domain]; !ok {
+			change.Removed = append(change.Removed, *item)
+		}
+	}
+
+	byDomain := func(items []BlockListItem) func(i, j int) bool {
+		return func(i, j int) bool {
+			return strings.ToLower(items[i].Domain) < strings.ToLower(items[j].Domain)
+		}
+	}
+	sort.Slice(change.Added, byDomain(change.Added))
+	sort.Slice(change.Removed, byDomain(change.Removed))
+	return change
+}
+
+func blockedDomains(b *Blocklist) map[string]*BlockListItem {
+	if b == nil {
+		return nil
+	}
+	return b.domainMap
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func itemDomains(items []BlockListItem) []string {
+	var domains []string
+	for _, item := range items {
+		domains = append(domains, item.Domain)
+	}
+	return domains
+}
+
+func TestBlocklistHooksOnFetch(t *testing.T) {
+	var mu sync.Mutex
+	current := map[string]OPLBlocklistEntry{
+		"Acme": {MatchingURLRegexes: []string{"acme.com", "shop.acme.com"}},
+	}
+	notModified := false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if notModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("X-Content-Hash", "hash")
+		json.NewEncoder(w).Encode(current)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 5*time.Second)
+
+	var changes []BlocklistChange
+	var added, removed []string
+	client.OnBlocklistUpdated(func(c BlocklistChange) {
+		// The new list must already be in effect
+		if got := client.GetCachedBlocklist(); got != c.Current {
+			t.Error("hook ran before the cached blocklist was replaced")
+		}
+		changes = append(changes, c)
+	})
+	client.OnEntryAdded(func(item BlockListItem) { added = append(added, item.Domain) })
+	client.OnEntryRemoved(func(item BlockListItem) { removed = append(removed, item.Domain) })
+
+	if _, err := client.FetchBlocklist(context.Background()); err != nil {
+		t.Fatalf("FetchBlocklist failed: %v", err)
+	}
+	if len(changes) != 1 || changes[0].Previous != nil {
+		t.Fatalf("expected one change from an empty blocklist, got %+v", changes)
+	}
+	if want := []string{"acme.com", "shop.acme.com"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("added = %v, want %v", added, want)
+	}
+
+	mu.Lock()
+	current = map[string]OPLBlocklistEntry{
+		"Acme":   {MatchingURLRegexes: []string{"acme.com"}},
+		"Globex": {MatchingURLRegexes: []string{"globex.com"}},
+	}
+	mu.Unlock()
+	added = nil
+
+	if _, err := client.FetchBlocklist(context.Background()); err != nil {
+		t.Fatalf("FetchBlocklist failed: %v", err)
+	}
+	if want := []string{"globex.com"}; !reflect.DeepEqual(added, want) {
+		t.Errorf("added = %v, want %v", added, want)
+	}
+	if want := []string{"shop.acme.com"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+	if len(changes) != 2 || changes[1].Previous != changes[0].Current {
+		t.Errorf("expected second change to follow the first")
+	}
+
+	// An unchanged blocklist fires nothing
+	mu.Lock()
+	notModified = true
+	mu.Unlock()
+	if _, err := client.FetchBlocklist(context.Background()); err != nil {
+		t.Fatalf("FetchBlocklist failed: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Errorf("expected no hook for 304, got %d changes", len(changes))
+	}
+}
+
+func TestBlocklistHooksOnEvent(t *testing.T) {
+	client := NewClient("https://api.example.com", "", 5*time.Second)
+	client.entries = map[string]OPLBlocklistEntry{}
+
+	var removed []string
+	client.OnEntryRemoved(func(item BlockListItem) { removed = append(removed, item.Domain) })
+
+	entry := &OPLBlocklistEntry{MatchingURLRegexes: []string{"acme.com"}}
+	if err := client.ApplyEvent(StreamEvent{Type: EventAdd, Employer: "Acme", Entry: entry}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ApplyEvent(StreamEvent{Type: EventResolved, Employer: "Acme"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"acme.com"}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+}
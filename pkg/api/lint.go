@@ -0,0 +1,168 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Lint issue severities. Errors mean an entry or pattern is broken as
+// published; warnings mean it is usable but probably not what the publisher
+// intended.
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// Lint issue codes.
+const (
+	LintMalformedEntry       = "malformed_entry"
+	LintInvalidPattern       = "invalid_pattern"
+	LintNoDomain             = "no_domain"
+	LintNoPatterns           = "no_patterns"
+	LintMissingActionDetails = "missing_action_details"
+	LintConflictingDomain    = "conflicting_domain"
+	LintInvalidEndTime       = "invalid_end_time"
+)
+
+// LintIssue is one problem found in the blocklist data.
+type LintIssue struct {
+	Severity string `json:"severity"`
+	Code     string `json:"code"`
+	Employer string `json:"employer,omitempty"`
+	Pattern  string `json:"pattern,omitempty"`
+	Message  string `json:"message"`
+}
+
+// LintReport lists the problems found in the current blocklist data.
+type LintReport struct {
+	CheckedAt time.Time   `json:"checked_at"`
+	Employers int         `json:"employers"`
+	Issues    []LintIssue `json:"issues"`
+}
+
+// Errors returns the number of error-severity issues.
+func (r *LintReport) Errors() int {
+	return r.count(LintError)
+}
+
+// Warnings returns the number of warning-severity issues.
+func (r *LintReport) Warnings() int {
+	return r.count(LintWarning)
+}
+
+func (r *LintReport) count(severity string) int {
+	if r == nil {
+		return 0
+	}
+	n := 0
+	for _, issue := range r.Issues {
+		if issue.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+// LintReport returns the report for the blocklist being enforced, which is
+// the pinned version while one is pinned, or nil if no blocklist has been
+// loaded.
+func (c *Client) LintReport() *LintReport {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.lint
+}
+
+// lintEntries checks parsed employer entries for problems that would
+// otherwise be skipped silently. parseIssues carries problems found while
+// decoding and is listed first; the rest follow in employer order.
+func lintEntries(entries map[string]OPLBlocklistEntry, parseIssues []LintIssue) *LintReport {
+	report := &LintReport{
+		CheckedAt: time.Now(),
+		Employers: len(entries),
+		Issues:    append(make([]LintIssue, 0, len(parseIssues)), parseIssues...),
+	}
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Domain to the first employer claiming it, in name order
+	owners := make(map[string]string)
+
+	for _, employer := range names {
+		entry := entries[employer]
+
+		if entry.ActionDetails == (ActionDetails{}) {
+			report.Issues = append(report.Issues, LintIssue{
+				Severity: LintWarning,
+				Code:     LintMissingActionDetails,
+				Employer: employer,
+				Message:  "entry has no action details; blocklist checks and logs will give no reason for blocking",
+			})
+		}
+		for _, end := range []string{entry.EndTime, entry.ActionDetails.EndDate} {
+			if _, err := parseEndTime(end); err != nil {
+				report.Issues = append(report.Issues, LintIssue{
+					Severity: LintWarning,
+					Code:     LintInvalidEndTime,
+					Employer: employer,
+					Message:  fmt.Sprintf("end time %q is not an RFC 3339 timestamp or date; the action never expires", end),
+				})
+			}
+		}
+		if len(entry.MatchingURLRegexes) == 0 {
+			report.Issues = append(report.Issues, LintIssue{
+				Severity: LintWarning,
+				Code:     LintNoPatterns,
+				Employer: employer,
+				Message:  "entry has no URL patterns and blocks nothing",
+			})
+		}
+
+		for _, pattern := range entry.MatchingURLRegexes {
+			if _, err := regexp.Compile(pattern); err != nil {
+				report.Issues = append(report.Issues, LintIssue{
+					Severity: LintError,
+					Code:     LintInvalidPattern,
+					Employer: employer,
+					Pattern:  pattern,
+					Message:  fmt.Sprintf("pattern is not a valid regular expression: %v", err),
+				})
+			}
+
+			domain := strings.ToLower(extractDomain(pattern))
+			if domain == "" {
+				report.Issues = append(report.Issues, LintIssue{
+					Severity: LintError,
+					Code:     LintNoDomain,
+					Employer: employer,
+					Pattern:  pattern,
+					Message:  "no domain could be extracted from pattern; it is ignored",
+				})
+				continue
+			}
+
+			owner, claimed := owners[domain]
+			if !claimed {
+				owners[domain] = employer
+				continue
+			}
+			if owner != employer {
+				report.Issues = append(report.Issues, LintIssue{
+					Severity: LintWarning,
+					Code:     LintConflictingDomain,
+					Employer: employer,
+					Pattern:  pattern,
+					Message:  fmt.Sprintf("domain %s is also listed for %q; blocklist checks and logs report only one of them as the employer", domain, owner),
+				})
+			}
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLintEntries(t *testing.T) {
+	details := ActionDetails{ID: "a-1", ActionType: "strike"}
+	entries := map[string]OPLBlocklistEntry{
+		"Acme":   {MatchingURLRegexes: []string{"acme.com", "shared.example"}, ActionDetails: details},
+		"Globex": {MatchingURLRegexes: []string{"Shared.example", "globex.com/(unclosed"}, ActionDetails: details},
+		"Hooli":  {MatchingURLRegexes: []string{"hooli.com"}},
+		"Initech": {
+			MatchingURLRegexes: []string{"https:///path-only"},
+			ActionDetails:      details,
+		},
+		"Umbrella": {ActionDetails: details},
+		"Wayne":    {MatchingURLRegexes: []string{"wayne.com"}, EndTime: "next week", ActionDetails: details},
+	}
+	parseIssues := []LintIssue{{Severity: LintError, Code: LintMalformedEntry, Employer: "Broken"}}
+
+	report := lintEntries(entries, parseIssues)
+
+	want := []struct{ code, employer string }{
+		{LintMalformedEntry, "Broken"},
+		{LintConflictingDomain, "Globex"},
+		{LintInvalidPattern, "Globex"},
+		{LintMissingActionDetails, "Hooli"},
+		{LintNoDomain, "Initech"},
+		{LintNoPatterns, "Umbrella"},
+		{LintInvalidEndTime, "Wayne"},
+	}
+	if len(report.Issues) != len(want) {
+		t.Fatalf("Expected %d issues, got %d: %+v", len(want), len(report.Issues), report.Issues)
+	}
+	for i, w := range want {
+		if got := report.Issues[i]; got.Code != w.code || got.Employer != w.employer {
+			t.Errorf("issue %d = %s/%s, want %s/%s", i, got.Code, got.Employer, w.code, w.employer)
+		}
+	}
+	if report.Employers != len(entries) {
+		t.Errorf("Expected %d employers, got %d", len(entries), report.Employers)
+	}
+	if report.Errors() != 3 || report.Warnings() != 4 {
+		t.Errorf("Expected 3 errors and 4 warnings, got %d and %d", report.Errors(), report.Warnings())
+	}
+}
+
+func TestLintEntriesClean(t *testing.T) {
+	report := lintEntries(map[string]OPLBlocklistEntry{
+		"Acme": {MatchingURLRegexes: []string{"acme.com", "www.acme.com"}, ActionDetails: ActionDetails{ActionType: "strike"}},
+	}, nil)
+	if len(report.Issues) != 0 {
+		t.Errorf("Expected no issues, got %+v", report.Issues)
+	}
+}
+
+func TestFetchBlocklistLintReport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{
+			"Acme": {"matchingUrlRegexes": ["acme.com"], "actionDetails": {"actionType": "strike"}},
+			"Broken": {"matchingUrlRegexes": "not-a-list"},
+			"_optimizedPatterns": {}
+		}`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 5*time.Second)
+	if client.LintReport() != nil {
+		t.Error("Expected no lint report before the first fetch")
+	}
+	if _, err := client.FetchBlocklist(context.Background()); err != nil {
+		t.Fatalf("FetchBlocklist failed: %v", err)
+	}
+
+	report := client.LintReport()
+	if report == nil || len(report.Issues) != 1 {
+		t.Fatalf("Expected one lint issue, got %+v", report)
+	}
+	if issue := report.Issues[0]; issue.Code != LintMalformedEntry || issue.Employer != "Broken" {
+		t.Errorf("Unexpected issue %+v", issue)
+	}
+
+	// Entries applied from the stream are linted too
+	entry := &OPLBlocklistEntry{MatchingURLRegexes: []string{"globex.com"}}
+	if err := client.ApplyEvent(StreamEvent{Type: EventAdd, Employer: "Globex", Entry: entry}); err != nil {
+		t.Fatal(err)
+	}
+	if got := client.LintReport().Warnings(); got != 1 {
+		t.Errorf("Expected a missing details warning after the stream event, got %d warnings", got)
+	}
+	if got := client.LintReport().Errors(); got != 1 {
+		t.Errorf("Expected the parse error to be kept, got %d errors", got)
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Registration introduces an instance to the backend.
+type Registration struct {
+	// InstanceID is the ID the instance would like; the backend may
+	// assign another
+	InstanceID string `json:"instance_id"`
+
+	// PublicKey is the PEM-encoded Ed25519 key the instance signs stats
+	// reports with
+	PublicKey string `json:"public_key"`
+
+	// Capabilities name the optional features the instance has enabled
+	Capabilities []string `json:"capabilities"`
+
+	// Contact is how the backend reaches the instance's operator
+	Contact string `json:"contact"`
+
+	Version string `json:"version"`
+}
+
+// Credentials are what the backend issues a registered instance.
+type Credentials struct {
+	InstanceID string `json:"instance_id"`
+	APIKey     string `json:"api_key"`
+}
+
+// Register sends reg to the registration endpoint at url and returns the
+// credentials issued. token, if set, is the enrollment token authorizing
+// the registration and is sent in the X-API-Key header. A nil client uses
+// http.DefaultClient.
+func Register(ctx context.Context, client *http.Client, url, token string, reg Registration) (Credentials, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	body, err := json.Marshal(reg)
+	if err != nil {
+		return Credentials{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return Credentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("X-API-Key", token)
+	}
+	req.Header.Set("User-Agent", "OPL-DNS-Server/"+reg.Version)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("registering instance: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return Credentials{}, fmt.Errorf("reading registration response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return Credentials{}, &StatusError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+
+	var creds Credentials
+	if err := json.Unmarshal(data, &creds); err != nil {
+		return Credentials{}, fmt.Errorf("parsing registration response: %w", err)
+	}
+	if creds.APIKey == "" || creds.InstanceID == "" {
+		return Credentials{}, fmt.Errorf("registration response has no api_key or instance_id")
+	}
+	return creds, nil
+}
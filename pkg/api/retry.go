@@ -0,0 +1,131 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy controls how FetchBlocklistWithRetry retries failed fetches.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the second attempt. Each further
+	// delay doubles, up to MaxBackoff. Delays are jittered by up to half
+	// their length so a fleet of instances doesn't retry in lockstep.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// AttemptTimeout bounds each individual attempt. Zero relies on the
+	// HTTP client timeout alone.
+	AttemptTimeout time.Duration
+}
+
+// DefaultRetryPolicy returns the policy used when none is configured.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    10,
+		InitialBackoff: 3 * time.Second,
+		MaxBackoff:     30 * time.Second,
+	}
+}
+
+// WithRetryPolicy sets the policy used by FetchBlocklistWithRetry.
+func WithRetryPolicy(p RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retryPolicy = p
+	}
+}
+
+// StatusError is returned when the API answers with an unexpected HTTP status.
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("API returned status %d: %s", e.StatusCode, e.Body)
+}
+
+// retryable reports whether a failed fetch is worth retrying. Client errors
+// such as a bad API key will not fix themselves.
+func retryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		code := statusErr.StatusCode
+		return code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+	}
+	return true
+}
+
+// backoff returns the jittered delay before the given retry (1-based).
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < retry && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// FetchBlocklistWithRetry calls FetchBlocklist until it succeeds, the retry
+// policy is exhausted, the error is not retryable, or ctx is done. It returns
+// the last error on failure.
+func (c *Client) FetchBlocklistWithRetry(ctx context.Context) (*Blocklist, error) {
+	policy := c.retryPolicy
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		blocklist, err := c.fetchAttempt(ctx, policy.AttemptTimeout)
+		if err == nil {
+			return blocklist, nil
+		}
+		lastErr = err
+
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !retryable(err) || attempt == policy.MaxAttempts {
+			break
+		}
+
+		delay := policy.backoff(attempt)
+		c.logger.Warn("Blocklist fetch failed, retrying",
+			"error", err,
+			"attempt", attempt,
+			"maxAttempts", policy.MaxAttempts,
+			"delay", delay,
+		)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return nil, lastErr
+}
+
+// fetchAttempt runs a single FetchBlocklist bounded by timeout.
+func (c *Client) fetchAttempt(ctx context.Context, timeout time.Duration) (*Blocklist, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return c.FetchBlocklist(ctx)
+}
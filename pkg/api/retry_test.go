@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func fastRetryPolicy(attempts int) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    attempts,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	}
+}
+
+func TestFetchBlocklistWithRetrySucceeds(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]OPLBlocklistEntry{
+			"Test Corp": {MatchingURLRegexes: []string{"example.com"}},
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 10*time.Second, WithRetryPolicy(fastRetryPolicy(5)))
+	blocklist, err := client.FetchBlocklistWithRetry(context.Background())
+	if err != nil {
+		t.Fatalf("FetchBlocklistWithRetry failed: %v", err)
+	}
+	if blocklist.TotalURLs != 1 {
+		t.Errorf("Expected 1 URL, got %d", blocklist.TotalURLs)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("Expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestFetchBlocklistWithRetryGivesUp(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		wantAttempts int32
+	}{
+		{"server error exhausts attempts", http.StatusInternalServerError, 4},
+		{"rate limit is retried", http.StatusTooManyRequests, 4},
+		{"bad API key is not retried", http.StatusUnauthorized, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			client := NewClient(server.URL, "", 10*time.Second, WithRetryPolicy(fastRetryPolicy(4)))
+			_, err := client.FetchBlocklistWithRetry(context.Background())
+
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.status {
+				t.Errorf("Expected StatusError %d, got %v", tt.status, err)
+			}
+			if calls.Load() != tt.wantAttempts {
+				t.Errorf("Expected %d attempts, got %d", tt.wantAttempts, calls.Load())
+			}
+		})
+	}
+}
+
+func TestFetchBlocklistWithRetryAttemptTimeout(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]OPLBlocklistEntry{})
+	}))
+	defer server.Close()
+	defer close(release)
+
+	policy := fastRetryPolicy(2)
+	policy.AttemptTimeout = 50 * time.Millisecond
+	client := NewClient(server.URL, "", 10*time.Second, WithRetryPolicy(policy))
+
+	if _, err := client.FetchBlocklistWithRetry(context.Background()); err != nil {
+		t.Fatalf("Expected second attempt to succeed after first timed out: %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("Expected 2 attempts, got %d", calls.Load())
+	}
+}
+
+func TestFetchBlocklistWithRetryContextCancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 10*time.Second, WithRetryPolicy(RetryPolicy{
+		MaxAttempts:    10,
+		InitialBackoff: time.Hour,
+		MaxBackoff:     time.Hour,
+	}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.FetchBlocklistWithRetry(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("Expected backoff wait to be interrupted by context")
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+
+	tests := []struct {
+		retry    int
+		min, max time.Duration
+	}{
+		{1, 500 * time.Millisecond, time.Second},
+		{2, time.Second, 2 * time.Second},
+		{3, 2 * time.Second, 4 * time.Second},
+		{10, 5 * time.Second, 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 50; i++ {
+			d := p.backoff(tt.retry)
+			if d < tt.min || d > tt.max {
+				t.Fatalf("backoff(%d) = %v, expected within [%v, %v]", tt.retry, d, tt.min, tt.max)
+			}
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// Stream event types sent by the OPL backend.
+const (
+	// EventAdd adds or replaces an employer's entry.
+	EventAdd = "add"
+	// EventUpdate is an alias for EventAdd used when an existing action changes.
+	EventUpdate = "update"
+	// EventRemove removes an employer from the blocklist.
+	EventRemove = "remove"
+	// EventResolved signals that a dispute was resolved; the employer is
+	// removed from the blocklist.
+	EventResolved = "resolved"
+	// EventPing is a keepalive and carries no change.
+	EventPing = "ping"
+)
+
+// StreamEvent is a single incremental blocklist change pushed over the
+// WebSocket stream.
+type StreamEvent struct {
+	Type     string             `json:"type"`
+	Employer string             `json:"employer,omitempty"`
+	Entry    *OPLBlocklistEntry `json:"entry,omitempty"`
+
+	// Hash is the content hash of the blocklist after applying this event.
+	// When present it is used for the next conditional fetch.
+	Hash string `json:"hash,omitempty"`
+}
+
+// StreamConfig configures the real-time blocklist stream.
+type StreamConfig struct {
+	// URL is the WebSocket endpoint. Defaults to the API base URL with a
+	// ws:// or wss:// scheme and a /blocklist/stream path.
+	URL string
+
+	// MinBackoff and MaxBackoff bound the exponential reconnect delay.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	// Logger overrides the client's logger for stream events.
+	Logger *slog.Logger
+}
+
+// errNoEntries is returned by ApplyEvent before a full fetch has loaded the
+// entries an event changes.
+var errNoEntries = errors.New("no blocklist fetched to apply the event to")
+
+// ApplyEvent applies an incremental change to the cached blocklist without
+// refetching it. Events are rejected until a fetch has loaded the entries:
+// a blocklist built from events alone would be partial, and adopting their
+// hash would keep it enforced through conditional fetches.
+func (c *Client) ApplyEvent(ev StreamEvent) error {
+	switch ev.Type {
+	case EventPing:
+		return nil
+	case EventAdd, EventUpdate:
+		if ev.Employer == "" || ev.Entry == nil {
+			return fmt.Errorf("%s event requires employer and entry", ev.Type)
+		}
+	case EventRemove, EventResolved:
+		if ev.Employer == "" {
+			return fmt.Errorf("%s event requires employer", ev.Type)
+		}
+	default:
+		return fmt.Errorf("unknown event type %q", ev.Type)
+	}
+
+	// The event is applied to a snapshot and built without holding the
+	// lock, which queries need. If a fetch replaced the entries meanwhile,
+	// the event is applied again on top of them; events are idempotent.
+	for {
+		c.mu.RLock()
+		cached, gen, parseIssues := c.entries, c.entriesGen, c.parseIssues
+		c.mu.RUnlock()
+		if cached == nil {
+			return errNoEntries
+		}
+
+		entries := maps.Clone(cached)
+		switch ev.Type {
+		case EventAdd, EventUpdate:
+			entries[ev.Employer] = *ev.Entry
+		case EventRemove, EventResolved:
+			delete(entries, ev.Employer)
+		}
+		blocklist := buildBlocklist(entries, c.filter, c.now())
+		version := c.versionOf(entries)
+		lint := lintEntries(entries, parseIssues)
+
+		c.mu.Lock()
+		if c.entriesGen != gen {
+			c.mu.Unlock()
+			continue
+		}
+		c.entries = entries
+		c.entriesGen++
+		update := c.setBlocklistLocked(c.enforceLocked(blocklist, lint, version))
+		if ev.Hash != "" {
+			c.contentHash = ev.Hash
+		}
+		c.mu.Unlock()
+
+		c.publish(update)
+		c.keepVersion(version, entries)
+		return nil
+	}
+}
+
+// StreamConnected reports whether the real-time stream is currently connected.
+func (c *Client) StreamConnected() bool {
+	return c.streamConnected.Load()
+}
+
+// RunStream maintains a WebSocket connection to the API and applies pushed
+// events to the cached blocklist. It reconnects with exponential backoff and
+// blocks until ctx is cancelled. Periodic FetchBlocklist calls remain the
+// source of truth while the stream is down.
+func (c *Client) RunStream(ctx context.Context, cfg StreamConfig) {
+	if cfg.URL == "" {
+		cfg.URL = c.defaultStreamURL()
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = time.Second
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = time.Minute
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = c.logger
+	}
+
+	backoff := cfg.MinBackoff
+	for {
+		connected, err := c.streamOnce(ctx, cfg.URL, logger)
+		if ctx.Err() != nil {
+			return
+		}
+		if connected {
+			backoff = cfg.MinBackoff
+		}
+
+		logger.Warn("Blocklist stream disconnected, falling back to polling",
+			"error", err,
+			"retryIn", backoff,
+		)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return
+		}
+
+		backoff *= 2
+		if backoff > cfg.MaxBackoff {
+			backoff = cfg.MaxBackoff
+		}
+	}
+}
+
+// streamOnce runs a single stream connection until it fails. It reports
+// whether the connection was established.
+func (c *Client) streamOnce(ctx context.Context, streamURL string, logger *slog.Logger) (bool, error) {
+	wsConfig, err := websocket.NewConfig(streamURL, c.baseURL)
+	if err != nil {
+		return false, fmt.Errorf("invalid stream URL: %w", err)
+	}
+	if c.apiKey != "" {
+		wsConfig.Header.Set("X-API-Key", c.apiKey)
+	}
+	wsConfig.Header.Set("User-Agent", "OPL-DNS-Server/1.0.0")
+
+	ws, err := c.dialStream(ctx, wsConfig)
+	if err != nil {
+		return false, fmt.Errorf("connecting: %w", err)
+	}
+	defer ws.Close()
+
+	// Unblock Receive when the context is cancelled
+	stop := context.AfterFunc(ctx, func() { ws.Close() })
+	defer stop()
+
+	c.streamConnected.Store(true)
+	defer c.streamConnected.Store(false)
+
+	logger.Info("Blocklist stream connected", "url", streamURL)
+
+	// Events may have been missed while disconnected; resync once. Events
+	// applied without it could be missing earlier changes, so the stream is
+	// dropped and polling continues until a reconnect resyncs. The backoff
+	// keeps growing meanwhile, as if the connection had failed.
+	if _, err := c.FetchBlocklist(ctx); err != nil {
+		return false, fmt.Errorf("resyncing: %w", err)
+	}
+
+	for {
+		var ev StreamEvent
+		if err := websocket.JSON.Receive(ws, &ev); err != nil {
+			return true, err
+		}
+
+		if err := c.ApplyEvent(ev); err != nil {
+			logger.Warn("Ignoring invalid blocklist stream event", "type", ev.Type, "error", err)
+			continue
+		}
+
+		switch ev.Type {
+		case EventPing:
+		case EventResolved:
+			logger.Info("Labor dispute resolved, employer unblocked", "employer", ev.Employer)
+		default:
+			logger.Debug("Applied blocklist stream event", "type", ev.Type, "employer", ev.Employer)
+		}
+	}
+}
+
+// dialStream opens the WebSocket using the client's proxy and TLS settings.
+// x/net/websocket has no proxy support of its own, so proxied connections are
+// tunnelled with CONNECT (or SOCKS) and the handshake runs over the tunnel.
+func (c *Client) dialStream(ctx context.Context, cfg *websocket.Config) (*websocket.Conn, error) {
+	host := cfg.Location.Hostname()
+
+	proxyURL, err := c.proxyFor(cfg.Location)
+	if err != nil {
+		return nil, fmt.Errorf("selecting proxy: %w", err)
+	}
+	if proxyURL == nil {
+		cfg.TlsConfig = c.tlsConfig(host)
+		return cfg.DialContext(ctx)
+	}
+
+	conn, err := c.dialTunnel(ctx, proxyURL, canonicalAddr(cfg.Location))
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if cfg.Location.Scheme == "wss" {
+		tlsConn := tls.Client(conn, c.tlsConfig(host))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	ws, err := websocket.NewClient(cfg, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+// defaultStreamURL derives the WebSocket endpoint from the API base URL.
+func (c *Client) defaultStreamURL() string {
+	u, err := url.Parse(c.baseURL)
+	if err != nil {
+		return ""
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/blocklist/stream"
+	return u.String()
+}
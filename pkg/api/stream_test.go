@@ -0,0 +1,264 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func TestApplyEvent(t *testing.T) {
+	client := NewClient("https://api.example.com", "", 10*time.Second)
+
+	// Without fetched entries an event would become the whole blocklist
+	err := client.ApplyEvent(StreamEvent{
+		Type:     EventAdd,
+		Employer: "Test Corp",
+		Entry:    &OPLBlocklistEntry{MatchingURLRegexes: []string{"example.com"}},
+		Hash:     "h0",
+	})
+	if !errors.Is(err, errNoEntries) || client.contentHash != "" {
+		t.Fatalf("Expected the event rejected before a fetch, got %v (hash %q)", err, client.contentHash)
+	}
+	client.entries = map[string]OPLBlocklistEntry{}
+
+	err = client.ApplyEvent(StreamEvent{
+		Type:     EventAdd,
+		Employer: "Test Corp",
+		Entry: &OPLBlocklistEntry{
+			MatchingURLRegexes: []string{"example.com"},
+			ActionDetails:      ActionDetails{ID: "a-1", ActionType: "strike"},
+		},
+		Hash: "h1",
+	})
+	if err != nil {
+		t.Fatalf("ApplyEvent(add) failed: %v", err)
+	}
+	if _, blocked := client.CheckDomain("www.example.com"); !blocked {
+		t.Error("Expected domain to be blocked after add event")
+	}
+	if client.contentHash != "h1" {
+		t.Errorf("Expected content hash 'h1', got '%s'", client.contentHash)
+	}
+
+	if err := client.ApplyEvent(StreamEvent{Type: EventResolved, Employer: "Test Corp"}); err != nil {
+		t.Fatalf("ApplyEvent(resolved) failed: %v", err)
+	}
+	if _, blocked := client.CheckDomain("example.com"); blocked {
+		t.Error("Expected domain to be unblocked after resolved event")
+	}
+	if client.GetCachedBlocklist().TotalURLs != 0 {
+		t.Errorf("Expected empty blocklist, got %d URLs", client.GetCachedBlocklist().TotalURLs)
+	}
+}
+
+func TestApplyEventConcurrent(t *testing.T) {
+	client := NewClient("https://api.example.com", "", 10*time.Second)
+	client.entries = map[string]OPLBlocklistEntry{}
+
+	// Events built on a snapshot another event replaced are applied again,
+	// so none is lost
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := client.ApplyEvent(StreamEvent{
+				Type:     EventAdd,
+				Employer: fmt.Sprintf("Corp %d", i),
+				Entry:    &OPLBlocklistEntry{MatchingURLRegexes: []string{fmt.Sprintf("corp%d.example", i)}},
+			})
+			if err != nil {
+				t.Errorf("ApplyEvent failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := range 20 {
+		if _, blocked := client.CheckDomain(fmt.Sprintf("corp%d.example", i)); !blocked {
+			t.Errorf("Expected corp%d.example blocked", i)
+		}
+	}
+}
+
+func TestApplyEventInvalid(t *testing.T) {
+	client := NewClient("https://api.example.com", "", 10*time.Second)
+
+	tests := []StreamEvent{
+		{Type: "bogus", Employer: "X"},
+		{Type: EventAdd, Employer: "X"},
+		{Type: EventRemove},
+	}
+	for _, ev := range tests {
+		if err := client.ApplyEvent(ev); err == nil {
+			t.Errorf("Expected error for event %+v", ev)
+		}
+	}
+}
+
+func TestDefaultStreamURL(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		expected string
+	}{
+		{"https://onlinepicketline.com/api", "wss://onlinepicketline.com/api/blocklist/stream"},
+		{"http://localhost:3000/api/", "ws://localhost:3000/api/blocklist/stream"},
+	}
+	for _, tt := range tests {
+		client := NewClient(tt.baseURL, "", 10*time.Second)
+		if got := client.defaultStreamURL(); got != tt.expected {
+			t.Errorf("defaultStreamURL(%s): expected '%s', got '%s'", tt.baseURL, tt.expected, got)
+		}
+	}
+}
+
+func TestRunStream(t *testing.T) {
+	var connections atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/blocklist.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]OPLBlocklistEntry{
+			"Old Corp": {MatchingURLRegexes: []string{"old.example"}},
+		})
+	})
+	mux.Handle("/blocklist/stream", websocket.Handler(func(ws *websocket.Conn) {
+		if ws.Request().Header.Get("X-API-Key") != "test-key" {
+			t.Errorf("Expected API key header on stream connection")
+		}
+
+		// The first connection pushes one event and drops; the second
+		// pushes another and stays open, exercising reconnect.
+		if connections.Add(1) == 1 {
+			websocket.JSON.Send(ws, StreamEvent{
+				Type:     EventAdd,
+				Employer: "New Corp",
+				Entry:    &OPLBlocklistEntry{MatchingURLRegexes: []string{"new.example"}},
+			})
+			return
+		}
+		websocket.JSON.Send(ws, StreamEvent{Type: EventResolved, Employer: "Old Corp"})
+		io.Copy(io.Discard, ws)
+	}))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(server.URL, "test-key", 10*time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.RunStream(ctx, StreamConfig{
+			MinBackoff: 10 * time.Millisecond,
+			MaxBackoff: 10 * time.Millisecond,
+			Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		})
+	}()
+
+	waitFor(t, func() bool {
+		_, oldBlocked := client.CheckDomain("old.example")
+		return connections.Load() >= 2 && !oldBlocked && client.StreamConnected()
+	})
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunStream did not return after cancellation")
+	}
+
+	if client.StreamConnected() {
+		t.Error("Expected stream to report disconnected after shutdown")
+	}
+}
+
+func TestRunStreamResyncFails(t *testing.T) {
+	var connections atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/blocklist.json", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	})
+	mux.Handle("/blocklist/stream", websocket.Handler(func(ws *websocket.Conn) {
+		connections.Add(1)
+		websocket.JSON.Send(ws, StreamEvent{
+			Type:     EventAdd,
+			Employer: "New Corp",
+			Entry:    &OPLBlocklistEntry{MatchingURLRegexes: []string{"new.example"}},
+			Hash:     "partial",
+		})
+		io.Copy(io.Discard, ws)
+	}))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client := NewClient(server.URL, "", 10*time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.RunStream(ctx, StreamConfig{
+			MinBackoff: 10 * time.Millisecond,
+			MaxBackoff: 10 * time.Millisecond,
+			Logger:     slog.New(slog.DiscardHandler),
+		})
+	}()
+
+	// Each connection fails to resync and is dropped before its event is
+	// applied, so the event neither becomes the blocklist nor sets the hash
+	// conditional fetches send
+	waitFor(t, func() bool { return connections.Load() >= 2 })
+	cancel()
+	<-done
+
+	if _, blocked := client.CheckDomain("new.example"); blocked {
+		t.Error("Expected no blocklist built from a stream event alone")
+	}
+	client.mu.RLock()
+	hash := client.contentHash
+	client.mu.RUnlock()
+	if hash != "" {
+		t.Errorf("Expected no content hash adopted without a fetch, got %q", hash)
+	}
+}
+
+func TestRunStreamInvalidURL(t *testing.T) {
+	client := NewClient("https://api.example.com", "", 10*time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var logs strings.Builder
+	client.RunStream(ctx, StreamConfig{
+		URL:    "ws://127.0.0.1:1/blocklist/stream",
+		Logger: slog.New(slog.NewTextHandler(&logs, nil)),
+	})
+
+	if !strings.Contains(logs.String(), "falling back to polling") {
+		t.Errorf("Expected disconnect to be logged, got: %s", logs.String())
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
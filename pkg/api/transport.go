@@ -0,0 +1,205 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/net/proxy"
+)
+
+// TransportConfig configures how the client reaches the API, for networks
+// that force egress through a proxy or inspect TLS with a private CA.
+type TransportConfig struct {
+	// ProxyURL routes API traffic through an http://, https://, or
+	// socks5:// proxy. Empty honors HTTP_PROXY, HTTPS_PROXY, and NO_PROXY.
+	ProxyURL string
+
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile string
+
+	// ClientCertFile and ClientKeyFile hold a PEM client certificate and key
+	// presented to the API or a TLS-inspecting proxy that requires one.
+	ClientCertFile string
+	ClientKeyFile  string
+}
+
+// NewTransport builds an HTTP transport from cfg, starting from the
+// defaults of http.DefaultTransport.
+func NewTransport(cfg TransportConfig) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.ProxyURL != "" {
+		u, err := parseProxyURL(cfg.ProxyURL)
+		if err != nil {
+			return nil, err
+		}
+		t.Proxy = http.ProxyURL(u)
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.ClientCertFile != "" || cfg.ClientKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	t.TLSClientConfig = tlsConfig
+
+	return t, nil
+}
+
+// WithTransport sets the transport for all API requests, including the
+// blocklist stream.
+func WithTransport(t *http.Transport) ClientOption {
+	return func(c *Client) {
+		c.transport = t
+		c.httpClient.Transport = t
+	}
+}
+
+func parseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy URL %q: scheme must be http, https, or socks5", raw)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q: missing host", raw)
+	}
+	return u, nil
+}
+
+// proxyFor returns the proxy to use for a WebSocket connection to target,
+// following the same rules as HTTP requests.
+func (c *Client) proxyFor(target *url.URL) (*url.URL, error) {
+	proxyFunc := http.ProxyFromEnvironment
+	if c.transport != nil {
+		proxyFunc = c.transport.Proxy
+	}
+	if proxyFunc == nil {
+		return nil, nil
+	}
+
+	// Proxy selection keys off the http(s) scheme
+	u := *target
+	switch u.Scheme {
+	case "wss":
+		u.Scheme = "https"
+	case "ws":
+		u.Scheme = "http"
+	}
+	return proxyFunc(&http.Request{URL: &u})
+}
+
+// tlsConfig returns the TLS settings for connections to serverName.
+func (c *Client) tlsConfig(serverName string) *tls.Config {
+	var cfg *tls.Config
+	if c.transport != nil && c.transport.TLSClientConfig != nil {
+		cfg = c.transport.TLSClientConfig.Clone()
+	} else {
+		cfg = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	cfg.ServerName = serverName
+	return cfg
+}
+
+// dialTunnel opens a TCP connection to addr ("host:port") through proxyURL.
+func (c *Client) dialTunnel(ctx context.Context, proxyURL *url.URL, addr string) (net.Conn, error) {
+	var d net.Dialer
+
+	if proxyURL.Scheme == "socks5" || proxyURL.Scheme == "socks5h" {
+		dialer, err := proxy.FromURL(proxyURL, &d)
+		if err != nil {
+			return nil, fmt.Errorf("configuring SOCKS proxy: %w", err)
+		}
+		return dialer.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+	}
+
+	proxyAddr := canonicalAddr(proxyURL)
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to proxy: %w", err)
+	}
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, c.tlsConfig(proxyURL.Hostname()))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake with proxy: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	// Abort the CONNECT exchange if ctx ends first
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := proxyURL.User; u != nil {
+		password, _ := u.Password()
+		creds := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+creds)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("sending CONNECT to proxy: %w", err)
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("reading CONNECT response: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused CONNECT: %s", resp.Status)
+	}
+	return conn, nil
+}
+
+// canonicalAddr returns u's host:port, adding the scheme's default port.
+func canonicalAddr(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return u.Host
+	}
+	switch u.Scheme {
+	case "https", "wss":
+		return net.JoinHostPort(u.Hostname(), "443")
+	case "socks5", "socks5h":
+		return net.JoinHostPort(u.Hostname(), "1080")
+	default:
+		return net.JoinHostPort(u.Hostname(), "80")
+	}
+}
@@ -0,0 +1,251 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+func blocklistHandler(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]OPLBlocklistEntry{
+		"Test Corp": {MatchingURLRegexes: []string{"example.com"}},
+	})
+}
+
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestNewTransportCAFile(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(blocklistHandler))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	untrusted := NewClient(server.URL, "", 5*time.Second, WithRetryPolicy(RetryPolicy{MaxAttempts: 1}))
+	if _, err := untrusted.FetchBlocklist(context.Background()); err == nil {
+		t.Fatal("Expected certificate error without CA file")
+	}
+
+	caFile := writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	transport, err := NewTransport(TransportConfig{CAFile: caFile})
+	if err != nil {
+		t.Fatalf("NewTransport failed: %v", err)
+	}
+	client := NewClient(server.URL, "", 5*time.Second, WithTransport(transport))
+	if _, err := client.FetchBlocklist(context.Background()); err != nil {
+		t.Fatalf("Expected fetch to succeed with CA file: %v", err)
+	}
+}
+
+func TestNewTransportClientCert(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "opl-dns test client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create client certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	clientCert, _ := x509.ParseCertificate(certDER)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(blocklistHandler))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+
+	withoutCert, _ := NewTransport(TransportConfig{CAFile: caFile})
+	client := NewClient(server.URL, "", 5*time.Second, WithTransport(withoutCert))
+	if _, err := client.FetchBlocklist(context.Background()); err == nil {
+		t.Fatal("Expected handshake failure without client certificate")
+	}
+
+	withCert, err := NewTransport(TransportConfig{
+		CAFile:         caFile,
+		ClientCertFile: writePEM(t, "client.pem", "CERTIFICATE", certDER),
+		ClientKeyFile:  writePEM(t, "client-key.pem", "EC PRIVATE KEY", keyDER),
+	})
+	if err != nil {
+		t.Fatalf("NewTransport failed: %v", err)
+	}
+	client = NewClient(server.URL, "", 5*time.Second, WithTransport(withCert))
+	if _, err := client.FetchBlocklist(context.Background()); err != nil {
+		t.Fatalf("Expected fetch to succeed with client certificate: %v", err)
+	}
+}
+
+func TestNewTransportErrors(t *testing.T) {
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	os.WriteFile(notPEM, []byte("not a certificate"), 0600)
+
+	tests := []struct {
+		name string
+		cfg  TransportConfig
+	}{
+		{"unsupported proxy scheme", TransportConfig{ProxyURL: "ftp://proxy:21"}},
+		{"proxy without host", TransportConfig{ProxyURL: "http://"}},
+		{"missing CA file", TransportConfig{CAFile: "/nonexistent/ca.pem"}},
+		{"CA file without certificates", TransportConfig{CAFile: notPEM}},
+		{"missing client key", TransportConfig{ClientCertFile: notPEM}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTransport(tt.cfg); err == nil {
+				t.Error("Expected error")
+			}
+		})
+	}
+}
+
+// fakeProxy is a forward proxy that handles both absolute-URI requests and
+// CONNECT tunnels, recording what it was asked for.
+type fakeProxy struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []string
+}
+
+func startFakeProxy(t *testing.T) *fakeProxy {
+	t.Helper()
+
+	p := &fakeProxy{}
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p.mu.Lock()
+		p.requests = append(p.requests, r.Method+" "+r.Host)
+		p.mu.Unlock()
+
+		if r.Method != http.MethodConnect {
+			r.RequestURI = ""
+			resp, err := http.DefaultTransport.RoundTrip(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			defer resp.Body.Close()
+			w.WriteHeader(resp.StatusCode)
+			io.Copy(w, resp.Body)
+			return
+		}
+
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go func() {
+			io.Copy(upstream, conn)
+			upstream.Close()
+		}()
+		io.Copy(conn, upstream)
+		conn.Close()
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *fakeProxy) Requests() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.requests...)
+}
+
+func TestFetchBlocklistThroughProxy(t *testing.T) {
+	proxy := startFakeProxy(t)
+	api := httptest.NewServer(http.HandlerFunc(blocklistHandler))
+	defer api.Close()
+
+	transport, err := NewTransport(TransportConfig{ProxyURL: proxy.URL})
+	if err != nil {
+		t.Fatalf("NewTransport failed: %v", err)
+	}
+	client := NewClient(api.URL, "", 5*time.Second, WithTransport(transport))
+	if _, err := client.FetchBlocklist(context.Background()); err != nil {
+		t.Fatalf("FetchBlocklist through proxy failed: %v", err)
+	}
+
+	reqs := proxy.Requests()
+	if len(reqs) != 1 || reqs[0] != "GET "+api.Listener.Addr().String() {
+		t.Errorf("Expected one proxied GET, got %v", reqs)
+	}
+}
+
+func TestRunStreamThroughProxy(t *testing.T) {
+	proxy := startFakeProxy(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/blocklist.json", blocklistHandler)
+	mux.Handle("/blocklist/stream", websocket.Handler(func(ws *websocket.Conn) {
+		io.Copy(io.Discard, ws)
+	}))
+	api := httptest.NewServer(mux)
+	defer api.Close()
+
+	transport, _ := NewTransport(TransportConfig{ProxyURL: proxy.URL})
+	client := NewClient(api.URL, "", 5*time.Second, WithTransport(transport))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.RunStream(ctx, StreamConfig{})
+	}()
+
+	waitFor(t, client.StreamConnected)
+	cancel()
+	<-done
+
+	var sawConnect bool
+	for _, req := range proxy.Requests() {
+		if req == "CONNECT "+api.Listener.Addr().String() {
+			sawConnect = true
+		}
+	}
+	if !sawConnect {
+		t.Errorf("Expected stream to tunnel through proxy, got %v", proxy.Requests())
+	}
+}
@@ -0,0 +1,388 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrVersionNotFound means no kept blocklist version matches a hash.
+var ErrVersionNotFound = errors.New("blocklist version not found")
+
+// BlocklistVersion describes a fetched blocklist kept on disk.
+type BlocklistVersion struct {
+	// Hash is the SHA-256 of the blocklist entries, in hex
+	Hash      string    `json:"hash"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Employers int       `json:"employers"`
+	URLs      int       `json:"urls"`
+}
+
+// VersionStore keeps the most recently fetched blocklists in a directory,
+// one file per version named by its hash, with an index that also records
+// the pinned version.
+type VersionStore struct {
+	dir  string
+	keep int
+
+	mu    sync.Mutex
+	index versionIndex
+}
+
+// versionIndex is index.json in the version directory. Versions are newest
+// first.
+type versionIndex struct {
+	Pinned   string             `json:"pinned,omitempty"`
+	Versions []BlocklistVersion `json:"versions"`
+}
+
+// OpenVersionStore opens or creates the version directory dir, keeping the
+// keep newest versions besides a pinned one.
+func OpenVersionStore(dir string, keep int) (*VersionStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("blocklist version directory is required")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("creating blocklist version directory: %w", err)
+	}
+	s := &VersionStore{dir: dir, keep: max(keep, 1)}
+	data, err := os.ReadFile(s.indexPath())
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return nil, fmt.Errorf("reading blocklist version index: %w", err)
+	default:
+		if err := json.Unmarshal(data, &s.index); err != nil {
+			return nil, fmt.Errorf("parsing blocklist version index: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// Versions returns the kept versions, newest first.
+func (s *VersionStore) Versions() []BlocklistVersion {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.index.Versions)
+}
+
+// Pinned returns the hash of the pinned version, or "" if none is.
+func (s *VersionStore) Pinned() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.index.Pinned
+}
+
+// Find returns the version whose hash starts with prefix, which must match
+// exactly one.
+func (s *VersionStore) Find(prefix string) (BlocklistVersion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prefix = strings.ToLower(prefix)
+	var found []BlocklistVersion
+	for _, v := range s.index.Versions {
+		if prefix != "" && strings.HasPrefix(v.Hash, prefix) {
+			found = append(found, v)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return BlocklistVersion{}, fmt.Errorf("%w: %q", ErrVersionNotFound, prefix)
+	case 1:
+		return found[0], nil
+	}
+	return BlocklistVersion{}, fmt.Errorf("%q matches %d blocklist versions; give more of the hash", prefix, len(found))
+}
+
+// add records entries, fetched at now, as the newest version. A version
+// already kept moves to the front. It reports whether the entries were not
+// kept before.
+func (s *VersionStore) add(hash string, entries map[string]OPLBlocklistEntry, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.index.Versions) > 0 && s.index.Versions[0].Hash == hash {
+		return false, nil
+	}
+	known := slices.ContainsFunc(s.index.Versions, func(v BlocklistVersion) bool { return v.Hash == hash })
+	if !known {
+		data, err := json.Marshal(entries)
+		if err != nil {
+			return false, err
+		}
+		if err := writeFileAtomic(s.versionPath(hash), data); err != nil {
+			return false, fmt.Errorf("saving blocklist version: %w", err)
+		}
+	}
+
+	v := BlocklistVersion{Hash: hash, FetchedAt: now.UTC(), Employers: len(entries)}
+	for _, entry := range entries {
+		v.URLs += len(entry.MatchingURLRegexes)
+	}
+	versions := []BlocklistVersion{v}
+	kept := 1
+	for _, old := range s.index.Versions {
+		switch {
+		case old.Hash == hash:
+		case old.Hash == s.index.Pinned:
+			versions = append(versions, old)
+		case kept < s.keep:
+			versions = append(versions, old)
+			kept++
+		default:
+			os.Remove(s.versionPath(old.Hash))
+		}
+	}
+	s.index.Versions = versions
+	return !known, s.saveIndexLocked()
+}
+
+// load reads the entries of the version with hash.
+func (s *VersionStore) load(hash string) (map[string]OPLBlocklistEntry, error) {
+	data, err := os.ReadFile(s.versionPath(hash))
+	if err != nil {
+		return nil, fmt.Errorf("reading blocklist version: %w", err)
+	}
+	var entries map[string]OPLBlocklistEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parsing blocklist version: %w", err)
+	}
+	return entries, nil
+}
+
+// setPinned records hash as the pinned version; "" unpins.
+func (s *VersionStore) setPinned(hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.index.Pinned = hash
+	return s.saveIndexLocked()
+}
+
+func (s *VersionStore) saveIndexLocked() error {
+	data, err := json.MarshalIndent(s.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(s.indexPath(), data); err != nil {
+		return fmt.Errorf("saving blocklist version index: %w", err)
+	}
+	return nil
+}
+
+func (s *VersionStore) indexPath() string {
+	return filepath.Join(s.dir, "index.json")
+}
+
+func (s *VersionStore) versionPath(hash string) string {
+	return filepath.Join(s.dir, hash+".json")
+}
+
+// writeFileAtomic writes data to a temporary file and renames it over path,
+// so a crash never leaves a truncated file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// entriesHash identifies a set of entries. Map keys are marshalled in
+// sorted order, so equal entries hash equally.
+func entriesHash(entries map[string]OPLBlocklistEntry) string {
+	data, _ := json.Marshal(entries)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// WithVersionStore keeps every newly fetched blocklist in store and enables
+// Pin, Rollback and Unpin.
+func WithVersionStore(store *VersionStore) ClientOption {
+	return func(c *Client) {
+		c.versions = store
+	}
+}
+
+// VersionStore returns the client's version store, or nil if it has none.
+func (c *Client) VersionStore() *VersionStore {
+	return c.versions
+}
+
+// CurrentVersion returns the hash of the blocklist being enforced, or ""
+// if it is unknown because the client has no version store or no blocklist.
+func (c *Client) CurrentVersion() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.current
+}
+
+// versionOf returns the hash entries are kept under, or "" without a
+// version store.
+func (c *Client) versionOf(entries map[string]OPLBlocklistEntry) string {
+	if c.versions == nil {
+		return ""
+	}
+	return entriesHash(entries)
+}
+
+// enforceLocked returns the blocklist and lint report to install now that
+// blocklist, built from entries with hash and linted as lint, has been
+// fetched: those themselves, or the installed ones while a version is
+// pinned. The caller holds c.mu.
+func (c *Client) enforceLocked(blocklist *Blocklist, lint *LintReport, hash string) (*Blocklist, *LintReport) {
+	c.fetched = hash
+	if c.pinned != "" {
+		return c.blocklist, c.lint
+	}
+	c.current = hash
+	return blocklist, lint
+}
+
+// keepVersion adds newly fetched entries to the version store, if there is
+// one. Failing to keep a version does not stop it being enforced.
+func (c *Client) keepVersion(hash string, entries map[string]OPLBlocklistEntry) {
+	if c.versions == nil {
+		return
+	}
+	added, err := c.versions.add(hash, entries, c.now())
+	if err != nil {
+		c.logger.Warn("Error keeping blocklist version", "hash", hash, "error", err)
+		return
+	}
+	if pinned := c.versions.Pinned(); added && pinned != "" {
+		c.logger.Warn("Fetched a new blocklist version but a version is pinned; unpin to enforce it",
+			"fetched", hash, "pinned", pinned)
+	}
+}
+
+// Pin enforces the kept version whose hash starts with prefix instead of
+// fetched blocklists, until Unpin. The pin survives restarts once
+// RestorePin is called at startup. Fetching continues, and new versions are
+// kept.
+func (c *Client) Pin(prefix string) (BlocklistVersion, error) {
+	if c.versions == nil {
+		return BlocklistVersion{}, fmt.Errorf("blocklist versions are not kept")
+	}
+	v, err := c.versions.Find(prefix)
+	if err != nil {
+		return BlocklistVersion{}, err
+	}
+	if err := c.pin(v.Hash); err != nil {
+		return BlocklistVersion{}, err
+	}
+	c.logger.Warn("Blocklist version pinned; fetched blocklists are not enforced until it is unpinned", "hash", v.Hash)
+	return v, nil
+}
+
+// Rollback pins the version kept before the one being enforced.
+func (c *Client) Rollback() (BlocklistVersion, error) {
+	if c.versions == nil {
+		return BlocklistVersion{}, fmt.Errorf("blocklist versions are not kept")
+	}
+	current := c.CurrentVersion()
+	versions := c.versions.Versions()
+	i := slices.IndexFunc(versions, func(v BlocklistVersion) bool { return v.Hash == current })
+	if i < 0 || i+1 >= len(versions) {
+		return BlocklistVersion{}, fmt.Errorf("%w: no version older than the one in effect is kept", ErrVersionNotFound)
+	}
+	return c.Pin(versions[i+1].Hash)
+}
+
+// Unpin goes back to enforcing the newest fetched blocklist.
+func (c *Client) Unpin() error {
+	if c.versions == nil {
+		return fmt.Errorf("blocklist versions are not kept")
+	}
+	if err := c.versions.setPinned(""); err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	entries, hash, parseIssues := c.entries, c.fetched, c.parseIssues
+	c.mu.RUnlock()
+	// Nothing fetched since a restart: fall back to the newest kept
+	if entries == nil {
+		versions := c.versions.Versions()
+		if len(versions) == 0 {
+			c.mu.Lock()
+			c.pinned = ""
+			c.mu.Unlock()
+			return nil
+		}
+		var err error
+		if entries, err = c.versions.load(versions[0].Hash); err != nil {
+			return err
+		}
+		hash, parseIssues = versions[0].Hash, nil
+	}
+	blocklist := buildBlocklist(entries, c.filter, c.now())
+	lint := lintEntries(entries, parseIssues)
+
+	c.mu.Lock()
+	c.pinned = ""
+	c.current = hash
+	update := c.setBlocklistLocked(blocklist, lint)
+	c.mu.Unlock()
+
+	c.publish(update)
+	c.logger.Info("Blocklist version unpinned", "hash", hash)
+	return nil
+}
+
+// RestorePin enforces the version pinned before a restart, if any. Call it
+// after registering hooks and before the first fetch.
+func (c *Client) RestorePin() error {
+	if c.versions == nil {
+		return nil
+	}
+	hash := c.versions.Pinned()
+	if hash == "" {
+		return nil
+	}
+	if err := c.pin(hash); err != nil {
+		return err
+	}
+	c.logger.Warn("Blocklist version is pinned; fetched blocklists are not enforced until it is unpinned", "hash", hash)
+	return nil
+}
+
+// pin installs the kept version with hash and records it as pinned. The
+// lint report is for the pinned entries; problems found while decoding them
+// are not kept, so it lacks those.
+func (c *Client) pin(hash string) error {
+	entries, err := c.versions.load(hash)
+	if err != nil {
+		return err
+	}
+	if err := c.versions.setPinned(hash); err != nil {
+		return err
+	}
+	blocklist := buildBlocklist(entries, c.filter, c.now())
+	lint := lintEntries(entries, nil)
+
+	c.mu.Lock()
+	c.pinned = hash
+	c.current = hash
+	update := c.setBlocklistLocked(blocklist, lint)
+	c.mu.Unlock()
+
+	c.publish(update)
+	return nil
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// versionServer serves a blocklist blocking the domain in *domain.
+func versionServer(t *testing.T, domain *atomic.Value) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]OPLBlocklistEntry{
+			"Acme": {MatchingURLRegexes: []string{domain.Load().(string)}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestBlocklistVersions(t *testing.T) {
+	dir := t.TempDir()
+	var domain atomic.Value
+	server := versionServer(t, &domain)
+
+	store, err := OpenVersionStore(dir, 2)
+	if err != nil {
+		t.Fatalf("OpenVersionStore failed: %v", err)
+	}
+	client := NewClient(server.URL, "", 5*time.Second, WithVersionStore(store))
+	fetch := func(d string) *Blocklist {
+		t.Helper()
+		domain.Store(d)
+		blocklist, err := client.FetchBlocklist(context.Background())
+		if err != nil {
+			t.Fatalf("FetchBlocklist failed: %v", err)
+		}
+		return blocklist
+	}
+	blocked := func(d string) bool {
+		_, ok := client.CheckDomain(d)
+		return ok
+	}
+
+	fetch("one.example")
+	fetch("one.example")
+	fetch("two.example")
+	fetch("three.example")
+	versions := store.Versions()
+	if len(versions) != 2 {
+		t.Fatalf("Expected the 2 newest versions kept, got %+v", versions)
+	}
+	if versions[0].Employers != 1 || versions[0].URLs != 1 || versions[0].Hash != client.CurrentVersion() {
+		t.Errorf("Expected the newest version to be current, got %+v (current %s)", versions[0], client.CurrentVersion())
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(files) != 3 {
+		t.Errorf("Expected 2 versions and the index on disk, got %v", files)
+	}
+
+	// A bad publish: roll back, and keep the older version while fetches
+	// continue
+	if _, err := client.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if !blocked("two.example") || blocked("three.example") {
+		t.Error("Expected the previous version enforced after a rollback")
+	}
+	if _, err := client.Rollback(); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("Expected no older version to roll back to, got %v", err)
+	}
+	fetched := fetch("four.example")
+	if !blocked("two.example") || blocked("four.example") {
+		t.Error("Expected a fetch not to replace the pinned version")
+	}
+	if fetched != client.GetCachedBlocklist() {
+		t.Error("Expected a fetch to return the pinned blocklist being enforced")
+	}
+	if pinned := store.Pinned(); pinned != versions[1].Hash {
+		t.Errorf("Expected %s pinned, got %q", versions[1].Hash, pinned)
+	}
+	if len(store.Versions()) != 3 {
+		t.Errorf("Expected the pinned version kept besides the 2 newest, got %+v", store.Versions())
+	}
+
+	// The pin survives a restart
+	store, err = OpenVersionStore(dir, 2)
+	if err != nil {
+		t.Fatalf("OpenVersionStore failed: %v", err)
+	}
+	client = NewClient(server.URL, "", 5*time.Second, WithVersionStore(store))
+	if err := client.RestorePin(); err != nil {
+		t.Fatalf("RestorePin failed: %v", err)
+	}
+	if !blocked("two.example") {
+		t.Error("Expected the pinned version enforced after a restart")
+	}
+
+	if err := client.Unpin(); err != nil {
+		t.Fatalf("Unpin failed: %v", err)
+	}
+	if !blocked("four.example") || blocked("two.example") {
+		t.Error("Expected the newest fetched version enforced after unpinning")
+	}
+
+	if _, err := client.Pin(versions[0].Hash[:8]); err != nil {
+		t.Fatalf("Pin by prefix failed: %v", err)
+	}
+	if !blocked("three.example") {
+		t.Error("Expected the version pinned by prefix enforced")
+	}
+	if _, err := client.Pin("zz"); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("Expected an unknown hash rejected, got %v", err)
+	}
+}
+
+func TestRestorePinMissingVersion(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "index.json"), []byte(`{"pinned": "abc", "versions": []}`), 0o600)
+	store, err := OpenVersionStore(dir, 2)
+	if err != nil {
+		t.Fatalf("OpenVersionStore failed: %v", err)
+	}
+	client := NewClient("http://127.0.0.1:0", "", time.Second, WithVersionStore(store))
+	if err := client.RestorePin(); err == nil {
+		t.Error("Expected an error for a pinned version missing from disk")
+	}
+	if client.GetCachedBlocklist() != nil {
+		t.Error("Expected no blocklist installed")
+	}
+}
+
+func TestPinnedVersionLint(t *testing.T) {
+	var domain atomic.Value
+	server := versionServer(t, &domain)
+	store, err := OpenVersionStore(t.TempDir(), 2)
+	if err != nil {
+		t.Fatalf("OpenVersionStore failed: %v", err)
+	}
+	client := NewClient(server.URL, "", 5*time.Second, WithVersionStore(store))
+	fetch := func(d string) {
+		t.Helper()
+		domain.Store(d)
+		if _, err := client.FetchBlocklist(context.Background()); err != nil {
+			t.Fatalf("FetchBlocklist failed: %v", err)
+		}
+	}
+	lintErrors := func() int {
+		return client.LintReport().Errors()
+	}
+
+	fetch("good.example")
+	fetch("[bad.example")
+	if lintErrors() == 0 {
+		t.Fatal("Expected the invalid pattern reported")
+	}
+
+	// The report follows the pinned version, not the newest fetched one
+	if _, err := client.Rollback(); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if n := lintErrors(); n != 0 {
+		t.Errorf("Expected no errors in the pinned version, got %d", n)
+	}
+	fetch("(bad.example")
+	if n := lintErrors(); n != 0 {
+		t.Errorf("Expected a fetch not to replace the pinned version's report, got %d errors", n)
+	}
+
+	if err := client.Unpin(); err != nil {
+		t.Fatalf("Unpin failed: %v", err)
+	}
+	if lintErrors() == 0 {
+		t.Error("Expected the newest fetched version's report after unpinning")
+	}
+}
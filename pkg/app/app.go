@@ -0,0 +1,1150 @@
+// Package app wires the OPL DNS server components together and runs them
+// until shutdown. It is the programmatic equivalent of the opl-dns binary.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/admin"
+	"github.com/online-picket-line/opl-for-dns/pkg/alert"
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/blocklog"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+	"github.com/online-picket-line/opl-for-dns/pkg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/odoh"
+	"github.com/online-picket-line/opl-for-dns/pkg/policy"
+	"github.com/online-picket-line/opl-for-dns/pkg/remoteconfig"
+	"github.com/online-picket-line/opl-for-dns/pkg/rpz"
+	"github.com/online-picket-line/opl-for-dns/pkg/sdnotify"
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+	"github.com/online-picket-line/opl-for-dns/pkg/stats/otelstats"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Options customizes an App beyond what the configuration expresses.
+type Options struct {
+	// Logger receives all component logs. Defaults to a logger built from
+	// the logging configuration that writes to stdout.
+	Logger *slog.Logger
+
+	// Version is reported in logs and stats reports. Defaults to "dev".
+	Version string
+
+	// Recorder, if set, receives every query and blocklist fetch event in
+	// addition to the built-in collector that feeds the OPL stats report.
+	Recorder stats.Recorder
+
+	// LogLevel, if set, controls Logger's level so Reload can change it.
+	// It is ignored when Logger is nil; the App then manages its own.
+	LogLevel *slog.LevelVar
+
+	// LogBuffer, if set, is the recent log output included in diagnostics
+	// bundles; Logger should write to it. It is ignored when Logger is nil;
+	// the App then keeps its own.
+	LogBuffer *LogBuffer
+
+	// ConfigPath is the file ReloadConfig reads. Empty disables
+	// ReloadConfig.
+	ConfigPath string
+
+	// Overrides, if set, is applied to the configuration ReloadConfig reads,
+	// so that settings given on the command line survive a reload.
+	Overrides func(*config.Config) error
+
+	// Remote, if set, is the source of the remote configuration, as
+	// returned by NewRemoteSource and prepared by BootstrapRemote. Its
+	// current document is layered over the file on every reload, and it is
+	// fetched again every remote_config.refresh_interval.
+	Remote *remoteconfig.Source
+}
+
+// App is a fully wired OPL DNS server.
+type App struct {
+	cfg     *config.Config
+	logger  *slog.Logger
+	version string
+
+	apiClient      *api.Client
+	apiTransport   *http.Transport
+	statsCollector *stats.Collector
+	policyStore    *policy.Store
+	dnsServer      *dns.Server
+	adminServer    *admin.Server
+	metricsServer  *admin.MetricsServer
+	rpzServer      *rpz.Server
+	reporter       *stats.Reporter
+	blockLog       *blocklog.Log
+	alerts         *alert.Monitor
+	telemetry      *otelstats.OTLP
+	tenants        []*tenant
+
+	// Live settings changed by Reload
+	configPath      string
+	overrides       func(*config.Config) error
+	remote          *remoteconfig.Source
+	logLevel        *slog.LevelVar
+	refreshInterval atomic.Int64
+	refreshChanged  chan struct{}
+	reloadMu        sync.Mutex
+	// running is the configuration in effect: the startup configuration
+	// with reloaded settings applied
+	running *config.Config
+
+	// refreshNow asks refreshBlocklist for an immediate fetch
+	refreshNow chan struct{}
+
+	ready chan struct{}
+}
+
+// New validates the configuration and creates all components. No sockets are
+// bound and no network requests are made until Run is called.
+func New(cfg *config.Config, opts Options) (_ *App, err error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	logger, logLevel, logBuffer := opts.Logger, opts.LogLevel, opts.LogBuffer
+	if logger == nil {
+		logLevel = new(slog.LevelVar)
+		logBuffer = NewLogBuffer(DefaultLogBufferLines)
+		logger = NewLoggerWithLevel(cfg.Logging, io.MultiWriter(os.Stdout, logBuffer), logLevel)
+	}
+	version := opts.Version
+	if version == "" {
+		version = "dev"
+	}
+
+	transport, err := api.NewTransport(api.TransportConfig{
+		ProxyURL:       cfg.API.ProxyURL,
+		CAFile:         cfg.API.CAFile,
+		ClientCertFile: cfg.API.ClientCertFile,
+		ClientKeyFile:  cfg.API.ClientKeyFile,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("configuring API transport: %w", err)
+	}
+
+	// If a later step fails, what was opened so far is closed again, newest
+	// first, so that New can be retried
+	var closers []func() error
+	defer func() {
+		if err != nil {
+			for _, c := range slices.Backward(closers) {
+				c()
+			}
+		}
+	}()
+	closers = append(closers, func() error {
+		transport.CloseIdleConnections()
+		return nil
+	})
+
+	collectorOpts := []stats.CollectorOption{
+		stats.WithMaxBlockedDomains(cfg.Stats.MaxBlockedDomains),
+	}
+	if c := cfg.Stats.Clients; c.Enabled {
+		collectorOpts = append(collectorOpts, stats.WithClientStats(stats.ClientStatsConfig{
+			MaxClients: c.MaxClients,
+			Anonymize:  c.Anonymize,
+			Report:     c.Report,
+		}))
+	}
+	statsCollector := stats.NewCollector(collectorOpts...)
+	if path := cfg.Stats.StateFile; path != "" {
+		// Losing old counters is better than refusing to serve DNS
+		if cp, err := stats.LoadCheckpoint(path); err != nil {
+			logger.Warn("Starting with fresh stats counters", "error", err)
+		} else {
+			statsCollector.Restore(cp)
+		}
+	}
+
+	// Exporters receive every client's events, tenants' included; the
+	// collector only sees clients outside every tenant
+	exporters := opts.Recorder
+
+	// Prometheus metrics are served by the metrics listener if there is
+	// one, and otherwise by the admin listener alongside its other endpoints
+	var metrics http.Handler
+	if cfg.Admin.Enabled || cfg.Metrics.ListenAddr != "" {
+		prom, err := otelstats.NewPrometheus()
+		if err != nil {
+			return nil, err
+		}
+		exporters = stats.Multi(exporters, prom)
+		metrics = prom.Handler()
+	}
+
+	var telemetry *otelstats.OTLP
+	if t := cfg.Telemetry; t.OTLPEndpoint != "" {
+		telemetry, err = otelstats.NewOTLP(context.Background(), otelstats.OTLPConfig{
+			Endpoint:         t.OTLPEndpoint,
+			Headers:          t.Headers,
+			Metrics:          t.Metrics,
+			Traces:           t.Traces,
+			MetricInterval:   t.MetricInterval.Duration,
+			TraceSampleRatio: t.TraceSampleRatio,
+			ServiceVersion:   version,
+			InstanceID:       instanceID(cfg),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("configuring OpenTelemetry export: %w", err)
+		}
+		closers = append(closers, func() error {
+			return telemetry.Shutdown(context.Background())
+		})
+		exporters = stats.Multi(exporters, telemetry)
+	}
+	recorder := stats.Multi(statsCollector, exporters)
+
+	var versionStore *api.VersionStore
+	if v := cfg.API.Versions; v.Dir != "" {
+		if versionStore, err = api.OpenVersionStore(v.Dir, v.Keep); err != nil {
+			return nil, err
+		}
+	}
+
+	apiOpts := []api.ClientOption{
+		api.WithTransport(transport),
+		api.WithTracerProvider(telemetryTracerProvider(telemetry)),
+		api.WithRetryPolicy(api.RetryPolicy{
+			MaxAttempts:    cfg.API.RetryMaxAttempts,
+			InitialBackoff: cfg.API.RetryInitialBackoff.Duration,
+			MaxBackoff:     cfg.API.RetryMaxBackoff.Duration,
+			AttemptTimeout: cfg.API.Timeout.Duration,
+		}),
+		api.WithDeltaUpdates(cfg.API.DeltaUpdates),
+		api.WithFilter(apiFilter(cfg)),
+	}
+	apiLogger := logger.With("component", "api")
+	apiClient := api.NewClient(
+		cfg.API.BaseURL,
+		cfg.API.APIKey,
+		cfg.API.Timeout.Duration,
+		append(apiOpts,
+			api.WithLogger(apiLogger),
+			api.WithRecorder(recorder),
+			api.WithVersionStore(versionStore),
+		)...,
+	)
+
+	apiClient.OnBlocklistUpdated(func(change api.BlocklistChange) {
+		logBlocklistChange(apiLogger, change)
+	})
+
+	var rpzServer *rpz.Server
+	if cfg.RPZ.Enabled {
+		if rpzServer, err = newRPZServer(cfg, logger.With("component", "rpz")); err != nil {
+			return nil, fmt.Errorf("creating RPZ server: %w", err)
+		}
+		closers = append(closers, func() error {
+			return rpzServer.Shutdown(context.Background())
+		})
+		// Registered before the pinned version is restored, so the zone
+		// starts from it
+		apiClient.OnBlocklistUpdated(func(change api.BlocklistChange) {
+			rpzServer.Update(change.Current)
+		})
+	}
+	if err := apiClient.RestorePin(); err != nil {
+		apiLogger.Warn("Error restoring the pinned blocklist version; fetched blocklists are enforced", "error", err)
+	}
+
+	dnsOpts := []dns.Option{
+		dns.WithSoftFailureRetries(cfg.DNS.SoftFailureRetries),
+		dns.WithTracerProvider(telemetryTracerProvider(telemetry)),
+		dns.WithRateLimit(dns.RateLimitConfig{
+			QueriesPerSecond: cfg.DNS.RateLimit.QueriesPerSecond,
+			Burst:            cfg.DNS.RateLimit.Burst,
+			Slip:             cfg.DNS.RateLimit.Slip,
+			IPv4PrefixLen:    cfg.DNS.RateLimit.IPv4PrefixLen,
+			IPv6PrefixLen:    cfg.DNS.RateLimit.IPv6PrefixLen,
+		}),
+	}
+
+	if cfg.DNS.Enabled && cfg.DNS.ODoH.Enabled() {
+		odohClient, err := odoh.NewClient(cfg.DNS.ODoH.ProxyURL, cfg.DNS.ODoH.TargetURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating ODoH client: %w", err)
+		}
+		dnsOpts = append(dnsOpts, dns.WithODoH(odohClient))
+	}
+
+	var blockLog *blocklog.Log
+	if h := cfg.Stats.BlockHistory; h.Dir != "" {
+		if blockLog, err = blocklog.Open(blocklog.Config{
+			Dir:       h.Dir,
+			Retention: h.Retention.Duration,
+			Logger:    logger.With("component", "blocklog"),
+		}); err != nil {
+			return nil, err
+		}
+		dnsOpts = append(dnsOpts, dns.WithBlockLog(blockLog))
+	}
+
+	tenants, tenantTable := newTenants(cfg, apiOpts, collectorOpts, exporters, logger)
+	if tenantTable != nil {
+		dnsOpts = append(dnsOpts, dns.WithTenants(tenantTable))
+	}
+
+	var policyStore *policy.Store
+	if cfg.Policy.StateFile != "" || len(cfg.Groups) > 0 {
+		if policyStore, err = policy.NewStore(cfg.Policy.StateFile); err != nil {
+			return nil, err
+		}
+		if err := policyStore.SetGroups(policyGroups(cfg)); err != nil {
+			return nil, err
+		}
+		dnsOpts = append(dnsOpts, dns.WithPolicy(policyStore))
+	}
+
+	var dnsServer *dns.Server
+	if cfg.DNS.Enabled {
+		if dnsServer, err = dns.NewServer(
+			cfg.DNS.ListenAddr,
+			upstreams(cfg),
+			cfg.DNS.QueryTimeout.Duration,
+			apiClient,
+			recorder,
+			logger.With("component", "dns"),
+			dnsOpts...,
+		); err != nil {
+			return nil, fmt.Errorf("creating DNS server: %w", err)
+		}
+		closers = append(closers, func() error {
+			return dnsServer.Shutdown(context.Background())
+		})
+	}
+
+	a := &App{
+		cfg:            cfg,
+		logger:         logger,
+		version:        version,
+		apiClient:      apiClient,
+		apiTransport:   transport,
+		statsCollector: statsCollector,
+		policyStore:    policyStore,
+		dnsServer:      dnsServer,
+		rpzServer:      rpzServer,
+		blockLog:       blockLog,
+		telemetry:      telemetry,
+		tenants:        tenants,
+		configPath:     opts.ConfigPath,
+		overrides:      opts.Overrides,
+		remote:         opts.Remote,
+		logLevel:       logLevel,
+		refreshChanged: make(chan struct{}, 1),
+		refreshNow:     make(chan struct{}, 1),
+		running:        cfg,
+		ready:          make(chan struct{}),
+	}
+	a.refreshInterval.Store(int64(cfg.API.RefreshInterval.Duration))
+	if cfg.Stats.Enabled {
+		if a.reporter, err = a.newReporter(); err != nil {
+			return nil, err
+		}
+		for _, t := range a.tenants {
+			if t.reporter, err = a.newTenantReporter(t); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(cfg.Alerts.Rules) > 0 {
+		if a.alerts, err = a.newAlertMonitor(); err != nil {
+			return nil, fmt.Errorf("configuring alerts: %w", err)
+		}
+	}
+
+	adminMetrics, adminDebug := metrics, cfg.Admin.Debug
+	if m := cfg.Metrics; m.ListenAddr != "" {
+		if a.metricsServer, err = admin.NewMetrics(admin.MetricsConfig{
+			ListenAddr: m.ListenAddr,
+			AuthToken:  m.AuthToken,
+			Metrics:    metrics,
+			Debug:      cfg.Admin.Debug,
+			Recorder:   recorder,
+			Logger:     logger.With("component", "metrics"),
+		}); err != nil {
+			return nil, fmt.Errorf("creating metrics server: %w", err)
+		}
+		adminMetrics, adminDebug = nil, false
+	}
+
+	if cfg.Admin.Enabled {
+		a.adminServer, err = admin.New(admin.Config{
+			ListenAddr:        cfg.Admin.ListenAddr,
+			AuthToken:         cfg.Admin.AuthToken,
+			Policy:            a.editablePolicy(),
+			Blocklist:         apiClient,
+			Stats:             statsCollector,
+			DNS:               dnsServer,
+			Reporter:          a.reporter,
+			BlockLog:          blockLog,
+			Tenants:           a.adminTenants(),
+			Reload:            a.adminReload(),
+			Refresh:           a.RefreshBlocklist,
+			RunningConfig:     a.RunningConfig,
+			PatchConfig:       a.PatchConfig,
+			StaleAfter:        cfg.Admin.HealthStaleAfter.Duration,
+			RequestsPerMinute: cfg.Admin.RateLimitPerMinute,
+			Recorder:          recorder,
+			Metrics:           adminMetrics,
+			Debug:             adminDebug,
+			PiholeToken:       cfg.Admin.PiholeAPIToken,
+			Version:           version,
+			RecentLogs:        recentLogs(logBuffer),
+			Logger:            logger.With("component", "admin"),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("creating admin server: %w", err)
+		}
+	}
+
+	return a, nil
+}
+
+// Run creates an App with default options and runs it until ctx is cancelled.
+func Run(ctx context.Context, cfg *config.Config) error {
+	a, err := New(cfg, Options{})
+	if err != nil {
+		return err
+	}
+	return a.Run(ctx)
+}
+
+// Run binds the DNS and admin listeners, loads the initial blocklist, starts
+// all background workers, and serves queries until ctx is cancelled or a
+// server fails. It returns only after every goroutine it started has exited.
+func (a *App) Run(ctx context.Context) error {
+	a.logger.Info("Starting OPL DNS Server", "version", a.version)
+	// Flushed last so the final spans and counters are exported
+	defer a.shutdownTelemetry()
+
+	if a.dnsServer != nil {
+		if err := a.dnsServer.Listen(); err != nil {
+			return err
+		}
+	}
+	if a.adminServer != nil {
+		if err := a.adminServer.Listen(); err != nil {
+			a.closeListeners()
+			return err
+		}
+	}
+	if a.metricsServer != nil {
+		if err := a.metricsServer.Listen(); err != nil {
+			a.closeListeners()
+			return err
+		}
+	}
+	if a.rpzServer != nil {
+		if err := a.rpzServer.Listen(); err != nil {
+			a.closeListeners()
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	defer a.apiClient.CloseIdleConnections()
+	for _, t := range a.tenants {
+		defer t.client.CloseIdleConnections()
+	}
+	// Saved after the reporter's final report has moved the delta baselines
+	defer a.saveStats()
+	defer wg.Wait()
+
+	a.fetchInitialBlocklist(ctx)
+	// Stopped while fetching, like a stop once serving, is not an error
+	if ctx.Err() != nil {
+		a.closeListeners()
+		return nil
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.refreshBlocklist(ctx)
+	}()
+
+	if a.cfg.API.StreamEnabled {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.apiClient.RunStream(ctx, api.StreamConfig{
+				URL: a.cfg.API.StreamURL,
+			})
+		}()
+		for _, t := range a.tenants {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				t.client.RunStream(ctx, api.StreamConfig{
+					URL: tenantStreamURL(a.cfg, t.cfg),
+				})
+			}()
+		}
+	}
+
+	if a.reporter != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.reporter.Start(ctx)
+		}()
+	}
+	for _, t := range a.tenants {
+		if t.reporter != nil {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				t.reporter.Start(ctx)
+			}()
+		}
+	}
+
+	if a.cfg.Stats.StateFile != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.checkpointStats(ctx)
+		}()
+	}
+
+	if a.alerts != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.alerts.Run(ctx)
+		}()
+	}
+
+	if a.blockLog != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.blockLog.Run(ctx)
+		}()
+	}
+
+	if a.rpzServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.rpzServer.Run(ctx)
+		}()
+	}
+
+	if interval := a.cfg.RemoteConfig.RefreshInterval.Duration; a.remote != nil && interval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.refetchRemote(ctx, interval)
+		}()
+	}
+
+	if a.cfg.ConfigWatch.Enabled && a.configPath != "" {
+		// Taken before Ready so that later edits are never mistaken for
+		// the running configuration
+		loaded, _ := configDigest(a.configPath)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.watchConfig(ctx, loaded)
+		}()
+	}
+
+	errChan := make(chan error, 6)
+
+	if a.dnsServer != nil {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := a.dnsServer.Start(); err != nil {
+				errChan <- fmt.Errorf("DNS server (UDP): %w", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := a.dnsServer.StartTCP(); err != nil {
+				errChan <- fmt.Errorf("DNS server (TCP): %w", err)
+			}
+		}()
+	}
+
+	if a.adminServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := a.adminServer.Start(); err != nil {
+				errChan <- fmt.Errorf("admin server: %w", err)
+			}
+		}()
+	}
+
+	if a.metricsServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := a.metricsServer.Start(); err != nil {
+				errChan <- fmt.Errorf("metrics server: %w", err)
+			}
+		}()
+	}
+
+	if a.rpzServer != nil {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := a.rpzServer.Start(); err != nil {
+				errChan <- fmt.Errorf("RPZ server (UDP): %w", err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if err := a.rpzServer.StartTCP(); err != nil {
+				errChan <- fmt.Errorf("RPZ server (TCP): %w", err)
+			}
+		}()
+	}
+
+	// The watchdog stops before draining, when the listeners stop answering
+	watchdogCtx, stopWatchdog := context.WithCancel(ctx)
+	defer stopWatchdog()
+	if interval := sdnotify.WatchdogInterval(); interval > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.feedWatchdog(watchdogCtx, interval)
+		}()
+	}
+
+	close(a.ready)
+	if a.dnsServer != nil {
+		a.notify(sdnotify.Ready, sdnotify.Status("Serving DNS on "+a.dnsServer.Addr().String()))
+	} else {
+		a.notify(sdnotify.Ready, sdnotify.Status("Running with DNS disabled"))
+	}
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+	case runErr = <-errChan:
+		a.logger.Error("Server error", "error", runErr)
+	}
+	a.notify(sdnotify.Stopping)
+	stopWatchdog()
+	a.drain()
+
+	// Stop background goroutines. The stats reporter sends its final
+	// report now, so it covers every query answered.
+	cancel()
+
+	return runErr
+}
+
+// drain stops the DNS and admin servers accepting queries and requests,
+// and waits up to shutdown.timeout for those in flight.
+func (a *App) drain() {
+	a.reloadMu.Lock()
+	timeout := a.running.Shutdown.Timeout.Duration
+	a.reloadMu.Unlock()
+	a.logger.Info("Stopping servers...", "timeout", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	logStop := func(component string, err error) {
+		if errors.Is(err, context.DeadlineExceeded) {
+			a.logger.Warn("Requests still in flight at shutdown timeout", "component", component)
+		} else if err != nil {
+			a.logger.Debug("Server stop", "component", component, "error", err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	if a.dnsServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logStop("dns", a.dnsServer.Shutdown(ctx))
+		}()
+	}
+	if a.adminServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logStop("admin", a.adminServer.Stop(ctx))
+		}()
+	}
+	if a.metricsServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logStop("metrics", a.metricsServer.Stop(ctx))
+		}()
+	}
+	if a.rpzServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logStop("rpz", a.rpzServer.Shutdown(ctx))
+		}()
+	}
+	wg.Wait()
+}
+
+// closeListeners releases the sockets bound by Run, for when it fails
+// before serving.
+func (a *App) closeListeners() {
+	if a.dnsServer != nil {
+		a.dnsServer.Stop()
+	}
+	if a.adminServer != nil {
+		a.adminServer.Stop(context.Background())
+	}
+	if a.metricsServer != nil {
+		a.metricsServer.Stop(context.Background())
+	}
+	if a.rpzServer != nil {
+		a.rpzServer.Shutdown(context.Background())
+	}
+}
+
+// AdminAddr returns the address the admin server is bound to, or nil if the
+// admin interface is disabled or not yet bound.
+func (a *App) AdminAddr() net.Addr {
+	if a.adminServer == nil {
+		return nil
+	}
+	return a.adminServer.Addr()
+}
+
+// MetricsAddr returns the address the metrics server is bound to, or nil if
+// metrics are not served on their own listener or it is not yet bound.
+func (a *App) MetricsAddr() net.Addr {
+	if a.metricsServer == nil {
+		return nil
+	}
+	return a.metricsServer.Addr()
+}
+
+// RPZAddr returns the address the RPZ server is bound to, or nil if it is
+// disabled or not yet bound.
+func (a *App) RPZAddr() net.Addr {
+	if a.rpzServer == nil {
+		return nil
+	}
+	return a.rpzServer.Addr()
+}
+
+// Policy returns the local policy store, or nil if local policy is disabled.
+func (a *App) Policy() *policy.Store {
+	return a.policyStore
+}
+
+// Ready is closed once the listeners are bound and the servers are starting.
+func (a *App) Ready() <-chan struct{} {
+	return a.ready
+}
+
+// DNSAddr returns the address the DNS server is bound to, or nil if DNS is
+// disabled or Run has not bound the listeners yet.
+func (a *App) DNSAddr() net.Addr {
+	if a.dnsServer == nil {
+		return nil
+	}
+	return a.dnsServer.Addr()
+}
+
+// APIClient returns the blocklist client used by the App.
+func (a *App) APIClient() *api.Client {
+	return a.apiClient
+}
+
+// Stats returns the stats collector used by the App.
+func (a *App) Stats() *stats.Collector {
+	return a.statsCollector
+}
+
+// fetchInitialBlocklist loads the blocklist using the client's retry policy.
+// Failing to load it is not fatal: the server starts with an empty blocklist
+// and the refresh loop keeps trying. It returns early if ctx is cancelled.
+func (a *App) fetchInitialBlocklist(ctx context.Context) {
+	a.logger.Info("Fetching initial blocklist...")
+	defer a.fetchTenantBlocklists(ctx)()
+	if _, err := a.apiClient.FetchBlocklistWithRetry(ctx); err != nil {
+		if ctx.Err() == nil {
+			a.logger.Error("Error fetching initial blocklist, starting with empty blocklist", "error", err)
+		}
+		return
+	}
+
+	if blocklist := a.apiClient.GetCachedBlocklist(); blocklist != nil {
+		a.logger.Info("Blocklist loaded", "urls", blocklist.TotalURLs, "employers", len(blocklist.Employers))
+	}
+}
+
+// refreshBlocklist periodically refetches the blocklist until ctx is
+// cancelled. Each refresh retries within the refresh interval so a failing
+// tick never overlaps the next one.
+func (a *App) refreshBlocklist(ctx context.Context) {
+	interval := a.currentRefreshInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.refreshChanged:
+			interval = a.currentRefreshInterval()
+			ticker.Reset(interval)
+			continue
+		case <-ticker.C:
+			a.logger.Debug("Refreshing blocklist...")
+		case <-a.refreshNow:
+			a.logger.Info("Refreshing blocklist on request")
+			ticker.Reset(interval)
+		}
+
+		tickCtx, cancel := context.WithTimeout(ctx, interval)
+		waitTenants := a.fetchTenantBlocklists(tickCtx)
+		_, err := a.apiClient.FetchBlocklistWithRetry(tickCtx)
+		waitTenants()
+		cancel()
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			a.logger.Error("Error refreshing blocklist", "error", err)
+		} else {
+			blocklist := a.apiClient.GetCachedBlocklist()
+			if blocklist != nil {
+				a.logger.Debug("Blocklist refreshed", "urls", blocklist.TotalURLs)
+			}
+		}
+	}
+}
+
+// RefreshBlocklist asks for the blocklist to be fetched now rather than at
+// the next refresh interval, which then restarts. It returns without
+// waiting for the fetch; a request made while one is pending is dropped.
+func (a *App) RefreshBlocklist() {
+	select {
+	case a.refreshNow <- struct{}{}:
+	default:
+	}
+}
+
+// checkpointStats saves the stats counters every checkpoint interval until
+// ctx is cancelled.
+func (a *App) checkpointStats(ctx context.Context) {
+	ticker := time.NewTicker(a.cfg.Stats.CheckpointInterval.Duration)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.saveStats()
+		}
+	}
+}
+
+// saveStats writes the stats counters to the state file, if one is set.
+func (a *App) saveStats() {
+	path := a.cfg.Stats.StateFile
+	if path == "" {
+		return
+	}
+	if err := stats.SaveCheckpoint(path, a.statsCollector.Checkpoint()); err != nil {
+		a.logger.Error("Error saving stats", "error", err)
+	}
+}
+
+// shutdownTelemetry flushes pending OpenTelemetry data, if export is on.
+func (a *App) shutdownTelemetry() {
+	if a.telemetry == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := a.telemetry.Shutdown(ctx); err != nil {
+		a.logger.Warn("Error flushing telemetry", "error", err)
+	}
+}
+
+// telemetryTracerProvider returns the tracer provider of t, or a no-op one
+// when OpenTelemetry export is off.
+func telemetryTracerProvider(t *otelstats.OTLP) trace.TracerProvider {
+	if t == nil {
+		return noop.NewTracerProvider()
+	}
+	return t.TracerProvider()
+}
+
+// logBlocklistChange logs which domains a blocklist update added or removed.
+func logBlocklistChange(logger *slog.Logger, change api.BlocklistChange) {
+	if len(change.Added) == 0 && len(change.Removed) == 0 {
+		return
+	}
+	logger.Info("Blocklist changed",
+		"added", len(change.Added),
+		"removed", len(change.Removed),
+		"urls", change.Current.TotalURLs,
+	)
+	for _, item := range change.Added {
+		logger.Debug("Domain blocked", "domain", item.Domain, "employer", item.Employer)
+	}
+	for _, item := range change.Removed {
+		logger.Debug("Domain unblocked", "domain", item.Domain, "employer", item.Employer)
+	}
+}
+
+// reportContent converts the stats.report_content settings.
+func reportContent(cfg *config.Config) stats.ReportContent {
+	rc := cfg.Stats.ReportContent
+	return stats.ReportContent{
+		TopDomains:   rc.TopDomains,
+		TopEmployers: rc.TopEmployers,
+		TopClients:   rc.TopClients,
+		Exclude:      rc.Exclude,
+		Labels:       rc.Labels,
+	}
+}
+
+// recentLogs returns the admin hook for b, or nil if no log output is kept.
+func recentLogs(b *LogBuffer) func() []byte {
+	if b == nil {
+		return nil
+	}
+	return b.Bytes
+}
+
+// apiFilter selects the blocklist entries cfg enforces.
+func apiFilter(cfg *config.Config) api.Filter {
+	return api.Filter{
+		ActionTypes: cfg.API.IncludeActionTypes,
+		MinStatus:   cfg.API.MinStatus,
+		Regions:     cfg.API.Regions,
+		Locations:   cfg.API.Locations,
+	}
+}
+
+// upstreams converts the dns.upstream_dns entries.
+func upstreams(cfg *config.Config) []dns.Upstream {
+	converted := make([]dns.Upstream, len(cfg.DNS.UpstreamDNS))
+	for i, u := range cfg.DNS.UpstreamDNS {
+		converted[i] = dns.Upstream{
+			Addr:        u.Address,
+			Protocol:    u.Protocol,
+			ServerName:  u.ServerName,
+			Timeout:     u.Timeout.Duration,
+			Weight:      u.Weight,
+			HealthCheck: u.HealthCheck,
+		}
+	}
+	return converted
+}
+
+// policyGroups converts the groups section.
+func policyGroups(cfg *config.Config) []policy.Group {
+	groups := make([]policy.Group, len(cfg.Groups))
+	for i, g := range cfg.Groups {
+		groups[i] = policy.Group{
+			Name:      g.Name,
+			Clients:   g.Clients,
+			Mode:      g.Mode,
+			Allowlist: g.Allowlist,
+		}
+		for _, w := range g.Schedule {
+			groups[i].Schedule = append(groups[i].Schedule, policy.Window(w))
+		}
+	}
+	return groups
+}
+
+// editablePolicy returns the policy store for the admin interface, or nil if
+// there is no state file to save edits to.
+func (a *App) editablePolicy() *policy.Store {
+	if a.cfg.Policy.StateFile == "" {
+		return nil
+	}
+	return a.policyStore
+}
+
+// newReporter builds the stats reporter from the stats configuration.
+func (a *App) newReporter() (*stats.Reporter, error) {
+	// Determine report URL
+	reportURL := a.cfg.Stats.ReportURL
+	if reportURL == "" {
+		reportURL = strings.TrimSuffix(a.cfg.API.BaseURL, "/") + "/dns-stats/report"
+	}
+	return a.buildReporter(a.statsCollector, instanceID(a.cfg), reportURL, a.cfg.API.APIKey, a.apiClient, a.logger)
+}
+
+// newTenantReporter builds the stats reporter for a tenant, which reports
+// with its own instance ID and API key.
+func (a *App) newTenantReporter(t *tenant) (*stats.Reporter, error) {
+	return a.buildReporter(t.collector, t.instanceID, t.reportURL(a.cfg), t.cfg.APIKey, t.client, t.logger)
+}
+
+// buildReporter builds a reporter sending collector's counters and the size
+// of client's blocklist.
+func (a *App) buildReporter(collector *stats.Collector, instanceID, reportURL, apiKey string, client *api.Client, logger *slog.Logger) (*stats.Reporter, error) {
+	content := reportContent(a.cfg)
+	if err := content.Validate(); err != nil {
+		return nil, fmt.Errorf("stats.report_content: %w", err)
+	}
+
+	var signer *stats.ReportSigner
+	if s := a.cfg.Stats.Signing; s.Algorithm != "" {
+		var err error
+		if signer, err = stats.LoadReportSigner(stats.SigningAlgorithm(s.Algorithm), s.KeyFile); err != nil {
+			return nil, fmt.Errorf("loading stats signing key: %w", err)
+		}
+	} else if r := a.cfg.Registration; r.Enabled {
+		// The key registered with the backend, once Register has made it
+		if _, err := os.Stat(r.KeyFile); err == nil {
+			if signer, err = stats.LoadReportSigner(stats.SigningEd25519, r.KeyFile); err != nil {
+				return nil, fmt.Errorf("loading registration.key_file: %w", err)
+			}
+		}
+	}
+
+	logger.Info("Stats reporting enabled", "instanceId", instanceID, "interval", a.cfg.Stats.ReportInterval.Duration, "privacy", statsPrivacy(a.cfg))
+
+	return stats.NewReporter(stats.ReporterConfig{
+		Collector:  collector,
+		InstanceID: instanceID,
+		Version:    a.version,
+		ReportURL:  reportURL,
+		APIKey:     apiKey,
+		Interval:   a.cfg.Stats.ReportInterval.Duration,
+		Privacy:    statsPrivacy(a.cfg),
+		Content:    content,
+		Signer:     signer,
+		Logger:     logger.With("component", "stats"),
+		Transport:  a.apiTransport,
+		GetBlocklistSize: func() (int, int) {
+			blocklist := client.GetCachedBlocklist()
+			if blocklist == nil {
+				return 0, 0
+			}
+			return blocklist.TotalURLs, len(blocklist.Employers)
+		},
+		GetLastRefresh: func() time.Time {
+			return client.LastFetchTime()
+		},
+	}), nil
+}
+
+// newAlertMonitor builds the alert monitor from the alerts configuration.
+func (a *App) newAlertMonitor() (*alert.Monitor, error) {
+	cfg := a.cfg.Alerts
+	var rules []alert.Rule
+	for _, r := range cfg.Rules {
+		rules = append(rules, alert.Rule{
+			Name:      r.Name,
+			Metric:    alert.Metric(r.Metric),
+			Threshold: r.Threshold,
+			MaxAge:    r.MaxAge.Duration,
+		})
+	}
+	var webhooks []alert.Webhook
+	for _, w := range cfg.Webhooks {
+		webhooks = append(webhooks, alert.Webhook{
+			URL:     w.URL,
+			Format:  alert.Format(w.Format),
+			Headers: w.Headers,
+		})
+	}
+
+	alertCfg := alert.Config{
+		Rules:          rules,
+		Webhooks:       webhooks,
+		Interval:       cfg.CheckInterval.Duration,
+		RepeatInterval: cfg.RepeatInterval.Duration,
+		Instance:       instanceID(a.cfg),
+		Responses:      a.statsCollector,
+		Blocklist:      a.apiClient,
+		Transport:      a.apiTransport,
+		Logger:         a.logger.With("component", "alert"),
+	}
+	if a.dnsServer != nil {
+		alertCfg.Upstreams = a.dnsServer
+	}
+	return alert.New(alertCfg)
+}
+
+// instanceID identifies this server in stats reports and telemetry. It
+// defaults to the hostname, hashed unless the stats privacy mode is full.
+func instanceID(cfg *config.Config) string {
+	if cfg.Stats.InstanceID != "" {
+		return cfg.Stats.InstanceID
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "opl-dns-unknown"
+	}
+	if statsPrivacy(cfg).HidesHostname() {
+		return stats.AnonymousInstanceID(hostname)
+	}
+	return hostname
+}
+
+// statsPrivacy returns the configured stats privacy mode. Validate has
+// already rejected unknown modes.
+func statsPrivacy(cfg *config.Config) stats.Privacy {
+	privacy, _ := stats.ParsePrivacy(cfg.Stats.Privacy)
+	return privacy
+}
+
+// NewLogger builds the process logger described by the logging configuration.
+func NewLogger(cfg config.LoggingConfig, w io.Writer) *slog.Logger {
+	return NewLoggerWithLevel(cfg, w, new(slog.LevelVar))
+}
+
+// NewLoggerWithLevel is like NewLogger, but sets level to the configured
+// level and filters by it, so the level can be changed later. Pass level as
+// Options.LogLevel to let Reload change it.
+func NewLoggerWithLevel(cfg config.LoggingConfig, w io.Writer, level *slog.LevelVar) *slog.Logger {
+	level.Set(parseLogLevel(cfg.Level))
+
+	var handler slog.Handler
+	if cfg.Format == "json" {
+		handler = slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})
+	} else {
+		handler = slog.NewTextHandler(w, &slog.HandlerOptions{Level: level})
+	}
+	return slog.New(handler)
+}
+
+func parseLogLevel(name string) slog.Level {
+	switch name {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
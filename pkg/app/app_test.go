@@ -0,0 +1,1186 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+	"github.com/online-picket-line/opl-for-dns/pkg/remoteconfig"
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+)
+
+// The lifecycle tests start the whole server stack on ephemeral ports against
+// fake upstream DNS and OPL API servers. Run them with `make test-race` to
+// have the race detector cover the full query path as well.
+
+// startFakeUpstream starts a UDP DNS server that answers every A query with
+// 192.0.2.1.
+func startFakeUpstream(t *testing.T) string {
+	t.Helper()
+	return startFakeUpstreamAnswering(t, "192.0.2.1")
+}
+
+// startFakeUpstreamAnswering starts a UDP DNS server that answers every A
+// query with ip.
+func startFakeUpstreamAnswering(t *testing.T, ip string) string {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen for fake upstream: %v", err)
+	}
+
+	started := make(chan struct{})
+	server := &dns.Server{
+		PacketConn:        pc,
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			if r.Question[0].Qtype == dns.TypeA {
+				m.Answer = append(m.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+					A:   net.ParseIP(ip),
+				})
+			}
+			w.WriteMsg(m)
+		}),
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		server.ActivateAndServe()
+	}()
+	<-started
+
+	t.Cleanup(func() {
+		server.Shutdown()
+		<-done
+	})
+	return pc.LocalAddr().String()
+}
+
+// fakeAPI is an in-process stand-in for the OPL backend.
+type fakeAPI struct {
+	server *httptest.Server
+
+	mu      sync.Mutex
+	reports []stats.StatsReport
+}
+
+func startFakeAPI(t *testing.T) *fakeAPI {
+	t.Helper()
+
+	f := &fakeAPI{}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/blocklist.json":
+			json.NewEncoder(w).Encode(map[string]api.OPLBlocklistEntry{
+				"Test Corp": {
+					MoreInfoURL:        "https://union.example.org",
+					MatchingURLRegexes: []string{"blocked.example"},
+					ActionDetails:      api.ActionDetails{ID: "action-1", ActionType: "strike"},
+				},
+			})
+		case "/dns-stats/report":
+			var report stats.StatsReport
+			if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+				t.Errorf("Failed to decode stats report: %v", err)
+			}
+			f.mu.Lock()
+			f.reports = append(f.reports, report)
+			f.mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	return f
+}
+
+func (f *fakeAPI) Reports() []stats.StatsReport {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]stats.StatsReport(nil), f.reports...)
+}
+
+func testConfig(apiURL, upstream string) *config.Config {
+	cfg := config.DefaultConfig()
+	cfg.DNS.ListenAddr = "127.0.0.1:0"
+	cfg.DNS.UpstreamDNS = config.Upstreams(upstream)
+	cfg.DNS.QueryTimeout = config.Duration{Duration: 2 * time.Second}
+	cfg.API.BaseURL = apiURL
+	cfg.API.Timeout = config.Duration{Duration: 2 * time.Second}
+	cfg.Stats.Enabled = true
+	cfg.Stats.InstanceID = "lifecycle-test"
+	cfg.Stats.ReportInterval = config.Duration{Duration: time.Hour}
+	return cfg
+}
+
+func discardLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+// startApp runs an App in the background and waits for it to become ready.
+// The returned stop function cancels it and returns Run's error.
+func startApp(t *testing.T, cfg *config.Config) (*App, func() error) {
+	t.Helper()
+
+	a, err := New(cfg, Options{Logger: discardLogger(), Version: "test"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- a.Run(ctx)
+	}()
+
+	select {
+	case <-a.Ready():
+	case err := <-errChan:
+		cancel()
+		t.Fatalf("Run exited before becoming ready: %v", err)
+	case <-time.After(10 * time.Second):
+		cancel()
+		t.Fatal("Timed out waiting for app to become ready")
+	}
+
+	return a, func() error {
+		cancel()
+		select {
+		case err := <-errChan:
+			return err
+		case <-time.After(10 * time.Second):
+			t.Fatal("Timed out waiting for Run to return")
+			return nil
+		}
+	}
+}
+
+func query(t *testing.T, network, addr, name string) *dns.Msg {
+	t.Helper()
+
+	c := &dns.Client{Net: network, Timeout: 2 * time.Second}
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), dns.TypeA)
+	resp, _, err := c.Exchange(m, addr)
+	if err != nil {
+		t.Fatalf("%s query for %s failed: %v", network, name, err)
+	}
+	return resp
+}
+
+func answerIP(t *testing.T, resp *dns.Msg) string {
+	t.Helper()
+
+	if len(resp.Answer) != 1 {
+		t.Fatalf("Expected 1 answer, got %d", len(resp.Answer))
+	}
+	a, ok := resp.Answer[0].(*dns.A)
+	if !ok {
+		t.Fatalf("Expected A record, got %T", resp.Answer[0])
+	}
+	return a.A.String()
+}
+
+// checkNoGoroutineLeak waits for the goroutine count to return to baseline,
+// dumping all stacks if it does not.
+func checkNoGoroutineLeak(t *testing.T, baseline int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n := runtime.NumGoroutine()
+		if n <= baseline {
+			return
+		}
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			buf = buf[:runtime.Stack(buf, true)]
+			t.Fatalf("Goroutine leak: %d running, baseline %d\n%s", n, baseline, buf)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestAppLifecycle(t *testing.T) {
+	upstream := startFakeUpstream(t)
+	fake := startFakeAPI(t)
+	defer fake.server.Close()
+
+	baseline := runtime.NumGoroutine()
+
+	a, stop := startApp(t, testConfig(fake.server.URL, upstream))
+	addr := a.DNSAddr().String()
+
+	if ip := answerIP(t, query(t, "udp", addr, "blocked.example")); ip != "0.0.0.0" {
+		t.Errorf("Expected blocked domain to resolve to 0.0.0.0, got %s", ip)
+	}
+	if ip := answerIP(t, query(t, "udp", addr, "www.blocked.example")); ip != "0.0.0.0" {
+		t.Errorf("Expected subdomain of blocked domain to resolve to 0.0.0.0, got %s", ip)
+	}
+	if ip := answerIP(t, query(t, "udp", addr, "allowed.example")); ip != "192.0.2.1" {
+		t.Errorf("Expected allowed domain to be forwarded upstream, got %s", ip)
+	}
+	if ip := answerIP(t, query(t, "tcp", addr, "blocked.example")); ip != "0.0.0.0" {
+		t.Errorf("Expected blocked domain over TCP to resolve to 0.0.0.0, got %s", ip)
+	}
+
+	if err := stop(); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	reports := fake.Reports()
+	if len(reports) != 1 {
+		t.Fatalf("Expected final stats report on shutdown, got %d reports", len(reports))
+	}
+	if reports[0].QueriesBlocked != 3 || reports[0].QueriesForwarded != 1 {
+		t.Errorf("Expected 3 blocked and 1 forwarded in final report, got %d and %d",
+			reports[0].QueriesBlocked, reports[0].QueriesForwarded)
+	}
+
+	// Both listeners must be released.
+	if _, err := net.Dial("tcp", addr); err == nil {
+		t.Error("Expected TCP listener to be closed after shutdown")
+	}
+
+	checkNoGoroutineLeak(t, baseline)
+}
+
+func TestAppTenants(t *testing.T) {
+	upstream := startFakeUpstream(t)
+	fake := startFakeAPI(t)
+	defer fake.server.Close()
+	tenantAPI := startFakeAPI(t)
+	defer tenantAPI.server.Close()
+
+	cfg := testConfig(fake.server.URL, upstream)
+	cfg.Tenants = []config.TenantConfig{{
+		Name:    "local",
+		Clients: []string{"127.0.0.0/8"},
+		BaseURL: tenantAPI.server.URL,
+	}}
+	a, stop := startApp(t, cfg)
+	if ip := answerIP(t, query(t, "udp", a.DNSAddr().String(), "blocked.example")); ip != "0.0.0.0" {
+		t.Errorf("Expected the tenant's blocklist to block, got %s", ip)
+	}
+	if err := stop(); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	// The query came from the tenant's prefix, so only its report counts it
+	reports := tenantAPI.Reports()
+	if len(reports) != 1 || reports[0].InstanceID != "lifecycle-test-local" || reports[0].QueriesBlocked != 1 {
+		t.Errorf("Expected one tenant report counting the block, got %+v", reports)
+	}
+	if reports := fake.Reports(); len(reports) != 1 || reports[0].QueriesBlocked != 0 {
+		t.Errorf("Expected the top-level report not to count tenant queries, got %+v", reports)
+	}
+}
+
+func TestAppRestartOnSameAddress(t *testing.T) {
+	upstream := startFakeUpstream(t)
+	fake := startFakeAPI(t)
+	defer fake.server.Close()
+
+	baseline := runtime.NumGoroutine()
+
+	cfg := testConfig(fake.server.URL, upstream)
+	cfg.Stats.Enabled = false
+
+	a, stop := startApp(t, cfg)
+	addr := a.DNSAddr().String()
+	if err := stop(); err != nil {
+		t.Fatalf("First Run returned error: %v", err)
+	}
+
+	// Rebinding the exact address proves the previous run released it.
+	cfg.DNS.ListenAddr = addr
+	a, stop = startApp(t, cfg)
+	if ip := answerIP(t, query(t, "tcp", a.DNSAddr().String(), "allowed.example")); ip != "192.0.2.1" {
+		t.Errorf("Expected forwarded answer after restart, got %s", ip)
+	}
+	if err := stop(); err != nil {
+		t.Fatalf("Second Run returned error: %v", err)
+	}
+
+	checkNoGoroutineLeak(t, baseline)
+}
+
+func TestAppStatsSurviveRestart(t *testing.T) {
+	upstream := startFakeUpstream(t)
+	fake := startFakeAPI(t)
+	defer fake.server.Close()
+
+	cfg := testConfig(fake.server.URL, upstream)
+	cfg.Stats.StateFile = filepath.Join(t.TempDir(), "stats.json")
+
+	a, stop := startApp(t, cfg)
+	query(t, "udp", a.DNSAddr().String(), "blocked.example")
+	if err := stop(); err != nil {
+		t.Fatalf("First Run returned error: %v", err)
+	}
+
+	a, stop = startApp(t, cfg)
+	query(t, "udp", a.DNSAddr().String(), "allowed.example")
+	if err := stop(); err != nil {
+		t.Fatalf("Second Run returned error: %v", err)
+	}
+
+	reports := fake.Reports()
+	if len(reports) != 2 {
+		t.Fatalf("Expected a final report from each run, got %d", len(reports))
+	}
+	second := reports[1]
+	if second.TotalQueries != 2 || second.QueriesBlocked != 1 || second.QueriesForwarded != 1 {
+		t.Errorf("Expected lifetime totals 2/1/1 after restart, got %d/%d/%d",
+			second.TotalQueries, second.QueriesBlocked, second.QueriesForwarded)
+	}
+	if second.QueriesSinceLastReport != 1 || second.BlockedSinceLastReport != 0 {
+		t.Errorf("Expected deltas to continue from the first run's report, got %d queries and %d blocked",
+			second.QueriesSinceLastReport, second.BlockedSinceLastReport)
+	}
+	if second.CountersSince != reports[0].CountersSince {
+		t.Errorf("Expected counters to date from the first run, got %s and %s",
+			reports[0].CountersSince, second.CountersSince)
+	}
+}
+
+func TestAppStopBeforeInitialFetchCompletes(t *testing.T) {
+	upstream := startFakeUpstream(t)
+
+	baseline := runtime.NumGoroutine()
+
+	// An API that never answers in time keeps Run in its initial fetch.
+	block := make(chan struct{})
+	slowAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+
+	a, err := New(testConfig(slowAPI.URL, upstream), Options{Logger: discardLogger()})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- a.Run(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errChan:
+		if err != nil {
+			t.Errorf("Expected a clean stop, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Run did not return after cancellation during initial fetch")
+	}
+
+	close(block)
+	slowAPI.Close()
+	checkNoGoroutineLeak(t, baseline)
+}
+
+func TestAppAdminPolicy(t *testing.T) {
+	upstream := startFakeUpstream(t)
+	fake := startFakeAPI(t)
+	defer fake.server.Close()
+
+	cfg := testConfig(fake.server.URL, upstream)
+	cfg.Stats.Enabled = false
+	cfg.Policy.StateFile = filepath.Join(t.TempDir(), "policy.json")
+	cfg.Admin.Enabled = true
+	cfg.Admin.ListenAddr = "127.0.0.1:0"
+	cfg.Admin.AuthToken = "admin-token"
+
+	a, stop := startApp(t, cfg)
+	addr := a.DNSAddr().String()
+
+	body := `{"allowlist":["blocked.example"],"blocks":[{"domain":"allowed.example","employer":"Local Corp"}]}`
+	req, _ := http.NewRequest(http.MethodPut, "http://"+a.AdminAddr().String()+"/api/policy", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Admin request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 from admin API, got %d", resp.StatusCode)
+	}
+
+	if ip := answerIP(t, query(t, "udp", addr, "blocked.example")); ip != "192.0.2.1" {
+		t.Errorf("Expected allowlisted domain to be forwarded, got %s", ip)
+	}
+	if ip := answerIP(t, query(t, "udp", addr, "allowed.example")); ip != "0.0.0.0" {
+		t.Errorf("Expected manually blocked domain to resolve to 0.0.0.0, got %s", ip)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "http://"+a.AdminAddr().String()+"/metrics", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Metrics request failed: %v", err)
+	}
+	metrics, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(metrics), `opl_dns_queries_total{result="blocked"} 1`) {
+		t.Errorf("Expected blocked query in Prometheus metrics, got:\n%s", metrics)
+	}
+
+	if err := stop(); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	// The applied policy survives a restart
+	a, stop = startApp(t, cfg)
+	if ip := answerIP(t, query(t, "udp", a.DNSAddr().String(), "allowed.example")); ip != "0.0.0.0" {
+		t.Errorf("Expected persisted manual block after restart, got %s", ip)
+	}
+	if err := stop(); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+}
+
+func TestAppMetricsListener(t *testing.T) {
+	upstream := startFakeUpstream(t)
+	fake := startFakeAPI(t)
+	defer fake.server.Close()
+
+	cfg := testConfig(fake.server.URL, upstream)
+	cfg.Stats.Enabled = false
+	cfg.Policy.StateFile = filepath.Join(t.TempDir(), "policy.json")
+	cfg.Admin.Enabled = true
+	cfg.Admin.ListenAddr = "127.0.0.1:0"
+	cfg.Admin.AuthToken = "admin-token"
+	cfg.Metrics.ListenAddr = "127.0.0.1:0"
+
+	a, stop := startApp(t, cfg)
+	defer stop()
+	query(t, "udp", a.DNSAddr().String(), "blocked.example")
+
+	get := func(addr net.Addr, token string) (int, string) {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, "http://"+addr.String()+"/metrics", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Metrics request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+	if code, body := get(a.MetricsAddr(), ""); code != http.StatusOK || !strings.Contains(body, "opl_dns_queries") {
+		t.Errorf("Expected metrics on the metrics listener, got %d", code)
+	}
+	if code, _ := get(a.AdminAddr(), "admin-token"); code != http.StatusNotFound {
+		t.Errorf("Expected no metrics on the admin listener, got %d", code)
+	}
+}
+
+func TestAppRPZ(t *testing.T) {
+	upstream := startFakeUpstream(t)
+	fake := startFakeAPI(t)
+	defer fake.server.Close()
+
+	cfg := testConfig(fake.server.URL, upstream)
+	cfg.RPZ.Enabled = true
+	cfg.RPZ.ListenAddr = "127.0.0.1:0"
+	cfg.RPZ.Action = "nxdomain"
+
+	a, stop := startApp(t, cfg)
+	defer stop()
+
+	m := new(dns.Msg)
+	m.SetAxfr("opl.rpz.")
+	envs, err := new(dns.Transfer).In(m, a.RPZAddr().String())
+	if err != nil {
+		t.Fatalf("Zone transfer failed: %v", err)
+	}
+	var blocked bool
+	for env := range envs {
+		if env.Error != nil {
+			t.Fatalf("Zone transfer failed: %v", env.Error)
+		}
+		for _, rr := range env.RR {
+			if cname, ok := rr.(*dns.CNAME); ok && cname.Hdr.Name == "blocked.example.opl.rpz." && cname.Target == "." {
+				blocked = true
+			}
+		}
+	}
+	if !blocked {
+		t.Error("Expected the zone to block blocked.example")
+	}
+}
+
+func TestAppDNSDisabled(t *testing.T) {
+	fake := startFakeAPI(t)
+	defer fake.server.Close()
+
+	cfg := testConfig(fake.server.URL, "127.0.0.1:1")
+	cfg.DNS.Enabled = false
+	cfg.DNS.ListenAddr = ""
+	cfg.Policy.StateFile = filepath.Join(t.TempDir(), "policy.json")
+	cfg.Admin.Enabled = true
+	cfg.Admin.ListenAddr = "127.0.0.1:0"
+	cfg.Admin.AuthToken = "admin-token"
+
+	a, stop := startApp(t, cfg)
+	if addr := a.DNSAddr(); addr != nil {
+		t.Errorf("Expected no DNS listener, got %s", addr)
+	}
+	if a.APIClient().GetCachedBlocklist() == nil {
+		t.Error("Expected the blocklist to be fetched with DNS disabled")
+	}
+
+	resp, err := http.Get("http://" + a.AdminAddr().String() + "/health")
+	if err != nil {
+		t.Fatalf("Health request failed: %v", err)
+	}
+	var health struct {
+		Status string          `json:"status"`
+		DNS    json.RawMessage `json:"dns"`
+	}
+	json.NewDecoder(resp.Body).Decode(&health)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || health.Status != "ok" || health.DNS != nil {
+		t.Errorf("Expected healthy status without DNS, got %d %+v", resp.StatusCode, health)
+	}
+
+	if err := stop(); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+}
+
+func TestAppSystemdNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+	t.Setenv("WATCHDOG_USEC", "100000")
+	t.Setenv("WATCHDOG_PID", "")
+
+	// next returns the next notification other than a watchdog ping, and
+	// whether any pings came before it
+	next := func() (string, bool) {
+		t.Helper()
+		pinged := false
+		buf := make([]byte, 512)
+		for {
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatalf("Reading notification: %v", err)
+			}
+			if msg := string(buf[:n]); msg != "WATCHDOG=1" {
+				return msg, pinged
+			}
+			pinged = true
+		}
+	}
+
+	fake := startFakeAPI(t)
+	defer fake.server.Close()
+	cfg := testConfig(fake.server.URL, startFakeUpstream(t))
+	cfg.Stats.Enabled = false
+	a, stop := startApp(t, cfg)
+
+	if msg, _ := next(); !strings.HasPrefix(msg, "READY=1\nSTATUS=Serving DNS on ") {
+		t.Errorf("Expected READY with a status, got %q", msg)
+	}
+
+	// Pings arrive while the listeners answer
+	time.Sleep(200 * time.Millisecond)
+	if _, err := a.Reload(cfg); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if msg, pinged := next(); msg != "RELOADING=1" || !pinged {
+		t.Errorf("Expected watchdog pings then RELOADING, got %q (pinged %v)", msg, pinged)
+	}
+	if msg, _ := next(); msg != "READY=1" {
+		t.Errorf("Expected READY after the reload, got %q", msg)
+	}
+
+	if err := stop(); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if msg, _ := next(); msg != "STOPPING=1" {
+		t.Errorf("Expected STOPPING, got %q", msg)
+	}
+}
+
+func TestAppRefreshBlocklist(t *testing.T) {
+	var fetches atomic.Int32
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]api.OPLBlocklistEntry{})
+	}))
+	defer apiServer.Close()
+
+	cfg := testConfig(apiServer.URL, startFakeUpstream(t))
+	cfg.Stats.Enabled = false
+	cfg.API.RefreshInterval = config.Duration{Duration: time.Hour}
+	a, stop := startApp(t, cfg)
+	defer stop()
+
+	if n := fetches.Load(); n != 1 {
+		t.Fatalf("Expected the initial fetch only, got %d", n)
+	}
+	a.RefreshBlocklist()
+	deadline := time.Now().Add(5 * time.Second)
+	for fetches.Load() < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the requested refresh")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.DNS.UpstreamDNS = nil
+
+	if _, err := New(cfg, Options{Logger: discardLogger()}); err == nil {
+		t.Error("Expected error for invalid configuration")
+	}
+}
+
+func TestAppReload(t *testing.T) {
+	upstream := startFakeUpstream(t)
+	fake := startFakeAPI(t)
+	defer fake.server.Close()
+
+	dir := t.TempDir()
+	cfg := testConfig(fake.server.URL, upstream)
+	cfg.Stats.Enabled = false
+	cfg.Policy.StateFile = filepath.Join(dir, "policy.json")
+	cfgPath := filepath.Join(dir, "config.json")
+	if err := cfg.Save(cfgPath); err != nil {
+		t.Fatal(err)
+	}
+
+	logLevel := new(slog.LevelVar)
+	a, err := New(cfg, Options{Logger: discardLogger(), LogLevel: logLevel, ConfigPath: cfgPath})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errChan := make(chan error, 1)
+	go func() { errChan <- a.Run(ctx) }()
+	<-a.Ready()
+	addr := a.DNSAddr().String()
+
+	// Edit the configuration and policy files as an operator would
+	second := startFakeUpstreamAnswering(t, "192.0.2.2")
+	edited := testConfig(fake.server.URL, second)
+	edited.Stats.Enabled = false
+	edited.Policy.StateFile = cfg.Policy.StateFile
+	edited.Logging.Level = "debug"
+	edited.API.RefreshInterval = config.Duration{Duration: time.Minute}
+	edited.DNS.ListenAddr = "127.0.0.1:5353"
+	if err := edited.Save(cfgPath); err != nil {
+		t.Fatal(err)
+	}
+	policyFile := `{"blocks":[{"domain":"local.example","employer":"Local Corp"}]}`
+	if err := os.WriteFile(cfg.Policy.StateFile, []byte(policyFile), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := a.ReloadConfig()
+	if err != nil {
+		t.Fatalf("ReloadConfig failed: %v", err)
+	}
+	wantApplied := []string{"policy", "api.refresh_interval", "dns.upstream_dns", "logging.level"}
+	if !slices.Equal(result.Applied, wantApplied) {
+		t.Errorf("Applied = %v, want %v", result.Applied, wantApplied)
+	}
+	if !slices.Equal(result.RestartRequired, []string{"dns.listen_addr"}) {
+		t.Errorf("RestartRequired = %v", result.RestartRequired)
+	}
+
+	if ip := answerIP(t, query(t, "udp", addr, "example.com")); ip != "192.0.2.2" {
+		t.Errorf("Expected the new upstream to answer, got %s", ip)
+	}
+	if ip := answerIP(t, query(t, "udp", addr, "local.example")); ip != "0.0.0.0" {
+		t.Errorf("Expected the reloaded manual block to apply, got %s", ip)
+	}
+	if logLevel.Level() != slog.LevelDebug {
+		t.Errorf("Expected log level debug, got %v", logLevel.Level())
+	}
+	if got := a.currentRefreshInterval(); got != time.Minute {
+		t.Errorf("Expected refresh interval 1m, got %v", got)
+	}
+
+	// Pending restarts are reported again; applied settings are not
+	result, err = a.ReloadConfig()
+	if err != nil {
+		t.Fatalf("ReloadConfig failed: %v", err)
+	}
+	if !slices.Equal(result.Applied, []string{"policy"}) || !slices.Equal(result.RestartRequired, []string{"dns.listen_addr"}) {
+		t.Errorf("Unexpected second reload %+v", result)
+	}
+
+	// An invalid file changes nothing
+	edited.DNS.UpstreamDNS = nil
+	if err := edited.Save(cfgPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ReloadConfig(); err == nil {
+		t.Error("Expected an invalid configuration to be rejected")
+	}
+	if ip := answerIP(t, query(t, "udp", addr, "example.com")); ip != "192.0.2.2" {
+		t.Errorf("Expected the upstream to be unchanged, got %s", ip)
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+}
+
+func TestAppPatchConfig(t *testing.T) {
+	fake := startFakeAPI(t)
+	defer fake.server.Close()
+
+	cfg := testConfig(fake.server.URL, startFakeUpstream(t))
+	cfg.Stats.Enabled = false
+	logLevel := new(slog.LevelVar)
+	a, err := New(cfg, Options{Logger: discardLogger(), LogLevel: logLevel})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errChan := make(chan error, 1)
+	go func() { errChan <- a.Run(ctx) }()
+	<-a.Ready()
+
+	applied, err := a.PatchConfig([]byte(`{"logging": {"level": "debug"}, "api": {"refresh_interval": "1m"}}`))
+	if err != nil {
+		t.Fatalf("PatchConfig failed: %v", err)
+	}
+	if !slices.Equal(applied, []string{"api.refresh_interval", "logging.level"}) {
+		t.Errorf("Unexpected applied settings %v", applied)
+	}
+	if logLevel.Level() != slog.LevelDebug || a.currentRefreshInterval() != time.Minute {
+		t.Errorf("Expected the patch to take effect, got level %v and interval %v", logLevel.Level(), a.currentRefreshInterval())
+	}
+	if running := a.RunningConfig(); running.Logging.Level != "debug" || running.API.BaseURL != fake.server.URL {
+		t.Errorf("Expected the running configuration to be patched in place, got %+v", running)
+	}
+
+	for _, patch := range []string{
+		`{"dns": {"listen_addr": "127.0.0.1:5353"}}`,
+		`{"logging": {"colour": "blue"}}`,
+		`{"dns": {"upstream_dns": []}}`,
+		`not json`,
+	} {
+		if _, err := a.PatchConfig([]byte(patch)); err == nil {
+			t.Errorf("%s: expected an error", patch)
+		}
+	}
+	if a.RunningConfig().DNS.ListenAddr != cfg.DNS.ListenAddr {
+		t.Error("Expected a rejected patch to change nothing")
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+}
+
+func TestAppWatchesConfig(t *testing.T) {
+	upstream := startFakeUpstream(t)
+	fake := startFakeAPI(t)
+	defer fake.server.Close()
+
+	cfg := testConfig(fake.server.URL, upstream)
+	cfg.Stats.Enabled = false
+	cfg.ConfigWatch = config.ConfigWatchConfig{
+		Enabled:      true,
+		PollInterval: config.Duration{Duration: 10 * time.Millisecond},
+		Debounce:     config.Duration{Duration: 20 * time.Millisecond},
+	}
+	cfgPath := filepath.Join(t.TempDir(), "config.json")
+	if err := cfg.Save(cfgPath); err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := New(cfg, Options{Logger: discardLogger(), ConfigPath: cfgPath})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errChan := make(chan error, 1)
+	go func() { errChan <- a.Run(ctx) }()
+	<-a.Ready()
+
+	edited := *cfg
+	edited.API.RefreshInterval = config.Duration{Duration: time.Minute}
+	if err := edited.Save(cfgPath); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for a.currentRefreshInterval() != time.Minute {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the edited configuration to be applied")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	upstream := startFakeUpstream(t)
+	fake := startFakeAPI(t)
+	defer fake.server.Close()
+
+	cfg := testConfig(fake.server.URL, upstream)
+	for _, r := range Check(context.Background(), cfg, CheckOptions{}) {
+		if r.Err != nil || r.Skipped != "" {
+			t.Errorf("Check %s: err %v, skipped %q", r.Name, r.Err, r.Skipped)
+		}
+	}
+
+	// A taken listen address and an unreachable API both fail
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	cfg.DNS.ListenAddr = taken.Addr().String()
+	cfg.API.BaseURL = "http://" + taken.Addr().String() + "/missing"
+	cfg.API.Timeout = config.Duration{Duration: 200 * time.Millisecond}
+
+	failed := map[string]bool{}
+	for _, r := range Check(context.Background(), cfg, CheckOptions{}) {
+		if r.Err != nil {
+			failed[r.Name] = true
+		}
+	}
+	if !failed["dns.listen_addr"] || !failed["api.base_url"] || len(failed) != 2 {
+		t.Errorf("Expected dns.listen_addr and api.base_url to fail, got %v", failed)
+	}
+
+	offline := Check(context.Background(), cfg, CheckOptions{Offline: true})
+	if last := offline[len(offline)-1]; last.Name != "api.base_url" || last.Skipped == "" {
+		t.Errorf("Expected the API check to be skipped offline, got %+v", last)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	fake := startFakeAPI(t)
+	defer fake.server.Close()
+
+	cfg := testConfig(fake.server.URL, startFakeUpstream(t))
+	cfg.Groups = []config.GroupConfig{{Name: "guests", Clients: []string{"10.9.0.0/16"}, Mode: config.GroupModeOff}}
+
+	d, err := Lookup(context.Background(), cfg, netip.Addr{}, "www.blocked.example")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if !d.Blocked || d.Item.Employer != "Test Corp" || d.Item.URL != "blocked.example" {
+		t.Errorf("Expected a blocklist match for Test Corp, got %+v", d)
+	}
+
+	d, err = Lookup(context.Background(), cfg, netip.MustParseAddr("10.9.0.1"), "blocked.example")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	}
+	if d.Blocked || d.Group != "guests" {
+		t.Errorf("Expected the guests group to be exempt, got %+v", d)
+	}
+
+	cfg.API.IncludeActionTypes = []string{"boycott"}
+	if d, err := Lookup(context.Background(), cfg, netip.Addr{}, "blocked.example"); err != nil || d.Blocked {
+		t.Errorf("Expected the action type filter to apply, got %+v, %v", d, err)
+	}
+}
+
+func TestAppRemoteConfig(t *testing.T) {
+	upstream := startFakeUpstream(t)
+	fake := startFakeAPI(t)
+	defer fake.server.Close()
+
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "signing.key")
+	publicPEM, err := stats.GenerateSigningKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := remoteconfig.LoadPrivateKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyFile := filepath.Join(dir, "publisher.pem")
+	if err := os.WriteFile(publicKeyFile, publicPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	published := []byte(`{"api":{"refresh_interval":"30m"},"remote_config":{"url":"http://elsewhere.example"}}`)
+	publish := func(body string) {
+		mu.Lock()
+		defer mu.Unlock()
+		published = []byte(body)
+	}
+	publisher := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set(remoteconfig.HeaderSignature, remoteconfig.Sign(privateKey, published))
+		w.Write(published)
+	}))
+	defer publisher.Close()
+
+	cfg := testConfig(fake.server.URL, upstream)
+	cfg.Stats.Enabled = false
+	cfg.RemoteConfig = config.RemoteConfigConfig{
+		URL:             publisher.URL,
+		PublicKeyFile:   publicKeyFile,
+		CacheFile:       filepath.Join(dir, "remote-cache.json"),
+		RefreshInterval: config.Duration{Duration: 20 * time.Millisecond},
+	}
+	cfgPath := filepath.Join(dir, "config.json")
+	if err := cfg.Save(cfgPath); err != nil {
+		t.Fatal(err)
+	}
+
+	remote, err := NewRemoteSource(cfg)
+	if err != nil {
+		t.Fatalf("NewRemoteSource failed: %v", err)
+	}
+	bootstrapped, err := BootstrapRemote(context.Background(), cfgPath, remote, nil, discardLogger())
+	if err != nil {
+		t.Fatalf("BootstrapRemote failed: %v", err)
+	}
+	if bootstrapped.API.RefreshInterval.Duration != 30*time.Minute {
+		t.Errorf("Expected the remote refresh interval, got %v", bootstrapped.API.RefreshInterval)
+	}
+	if bootstrapped.RemoteConfig.URL != publisher.URL {
+		t.Errorf("Expected the remote document not to change remote_config, got %q", bootstrapped.RemoteConfig.URL)
+	}
+
+	a, err := New(bootstrapped, Options{Logger: discardLogger(), ConfigPath: cfgPath, Remote: remote})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errChan := make(chan error, 1)
+	go func() { errChan <- a.Run(ctx) }()
+	<-a.Ready()
+
+	// An invalid document is skipped; the next good one is applied
+	publish(`{"dns":{"upstream_dns":[]}}`)
+	time.Sleep(100 * time.Millisecond)
+	if got := a.currentRefreshInterval(); got != 30*time.Minute {
+		t.Errorf("Expected the invalid document to be ignored, refresh interval is %v", got)
+	}
+	publish(`{"api":{"refresh_interval":"45m"}}`)
+	deadline := time.Now().Add(5 * time.Second)
+	for a.currentRefreshInterval() != 45*time.Minute {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the remote configuration to be applied")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	// With the publisher down, a restart uses the cached document
+	publisher.Close()
+	remote, err = NewRemoteSource(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bootstrapped, err = BootstrapRemote(context.Background(), cfgPath, remote, nil, discardLogger())
+	if err != nil {
+		t.Fatalf("BootstrapRemote failed: %v", err)
+	}
+	if bootstrapped.API.RefreshInterval.Duration != 45*time.Minute {
+		t.Errorf("Expected the cached refresh interval, got %v", bootstrapped.API.RefreshInterval)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	var registrations []api.Registration
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/dns-instances/register" || r.Header.Get("X-API-Key") != "enroll-me" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		var reg api.Registration
+		json.NewDecoder(r.Body).Decode(&reg)
+		registrations = append(registrations, reg)
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(api.Credentials{InstanceID: "opl-7f3a", APIKey: "issued-key"})
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	cfg := testConfig(server.URL, "127.0.0.1:53")
+	cfg.Registration = config.RegistrationConfig{
+		Enabled:         true,
+		EnrollmentToken: "enroll-me",
+		Contact:         "ops@local12.example",
+		StateFile:       filepath.Join(dir, "registration.json"),
+		KeyFile:         filepath.Join(dir, "instance.key"),
+	}
+
+	reg, err := Register(context.Background(), cfg, "test", discardLogger())
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if reg.APIKey != "issued-key" || reg.InstanceID != "opl-7f3a" {
+		t.Errorf("Unexpected credentials %+v", reg)
+	}
+	if len(registrations) != 1 {
+		t.Fatalf("Expected one registration, got %d", len(registrations))
+	}
+	sent := registrations[0]
+	if sent.InstanceID != "lifecycle-test" || sent.Contact != "ops@local12.example" || !slices.Contains(sent.Capabilities, "stats") {
+		t.Errorf("Unexpected registration %+v", sent)
+	}
+	signer, err := stats.LoadReportSigner(stats.SigningEd25519, cfg.Registration.KeyFile)
+	if err != nil {
+		t.Fatalf("Expected an instance key to be created: %v", err)
+	}
+	if public, _ := signer.PublicKeyPEM(); string(public) != sent.PublicKey {
+		t.Errorf("Expected the instance's public key sent, got %q", sent.PublicKey)
+	}
+
+	// Later starts use the saved credentials without registering again
+	again, err := Register(context.Background(), cfg, "test", discardLogger())
+	if err != nil || *again != *reg || len(registrations) != 1 {
+		t.Errorf("Expected the saved credentials reused, got %+v, %v after %d registrations", again, err, len(registrations))
+	}
+	again.Apply(cfg)
+	if cfg.API.APIKey != "issued-key" || cfg.Stats.InstanceID != "opl-7f3a" {
+		t.Errorf("Expected the credentials applied, got %q and %q", cfg.API.APIKey, cfg.Stats.InstanceID)
+	}
+
+	os.Remove(cfg.Registration.StateFile)
+	cfg.Registration.EnrollmentToken = "wrong"
+	if _, err := Register(context.Background(), cfg, "test", discardLogger()); err == nil {
+		t.Error("Expected a refused registration to fail")
+	}
+	if _, err := os.Stat(cfg.Registration.StateFile); err == nil {
+		t.Error("Expected no state saved after a refused registration")
+	}
+}
+
+func TestLogBuffer(t *testing.T) {
+	b := NewLogBuffer(2)
+	if got := b.Bytes(); len(got) != 0 {
+		t.Errorf("Expected an empty buffer, got %q", got)
+	}
+	logger := slog.New(slog.NewTextHandler(b, &slog.HandlerOptions{
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	logger.Info("one")
+	logger.Info("two")
+	if got, want := string(b.Bytes()), "level=INFO msg=one\nlevel=INFO msg=two\n"; got != want {
+		t.Errorf("Got %q, want %q", got, want)
+	}
+	logger.Info("three")
+	if got, want := string(b.Bytes()), "level=INFO msg=two\nlevel=INFO msg=three\n"; got != want {
+		t.Errorf("Got %q after wrapping, want %q", got, want)
+	}
+}
+
+func TestOpenLogger(t *testing.T) {
+	syslogConn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listening failed: %v", err)
+	}
+	defer syslogConn.Close()
+
+	path := filepath.Join(t.TempDir(), "opl-dns.log")
+	buffer := NewLogBuffer(10)
+	logger, closer, err := OpenLogger(config.LoggingConfig{
+		Level:      "info",
+		Format:     "text",
+		File:       path,
+		MaxSizeMB:  1,
+		MaxBackups: 1,
+		Syslog: config.SyslogConfig{
+			Enabled: true,
+			Address: "udp://" + syslogConn.LocalAddr().String(),
+			Tag:     "opl-test",
+		},
+	}, buffer, new(slog.LevelVar))
+	if err != nil {
+		t.Fatalf("OpenLogger failed: %v", err)
+	}
+	logger.With("upstream", "9.9.9.9:53").Warn("Upstream unreachable")
+	logger.Debug("Not logged")
+	closer.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Reading log file: %v", err)
+	}
+	if !strings.Contains(string(data), `level=WARN msg="Upstream unreachable" upstream=9.9.9.9:53`) || strings.Contains(string(data), "Not logged") {
+		t.Errorf("Unexpected log file contents %q", data)
+	}
+	if !bytes.Equal(buffer.Bytes(), data) {
+		t.Errorf("Expected the buffer to match the file, got %q", buffer.Bytes())
+	}
+
+	syslogConn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	msg := make([]byte, 1024)
+	n, _, err := syslogConn.ReadFrom(msg)
+	if err != nil {
+		t.Fatalf("Reading syslog message: %v", err)
+	}
+	// Facility daemon (3) and severity warning (4)
+	got := string(msg[:n])
+	if !strings.HasPrefix(got, "<28>") || !strings.Contains(got, `opl-test[`) ||
+		!strings.HasSuffix(strings.TrimSpace(got), `msg="Upstream unreachable" upstream=9.9.9.9:53`) {
+		t.Errorf("Unexpected syslog message %q", got)
+	}
+}
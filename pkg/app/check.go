@@ -0,0 +1,190 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/admin"
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+	"github.com/online-picket-line/opl-for-dns/pkg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/policy"
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+)
+
+// CheckResult is the outcome of one Check.
+type CheckResult struct {
+	// Name says what was checked, usually a setting such as
+	// "dns.listen_addr"
+	Name string
+
+	// Err is why the check failed, or nil
+	Err error
+
+	// Skipped, if set, is why the check was not run
+	Skipped string
+}
+
+// CheckOptions controls which checks Check runs.
+type CheckOptions struct {
+	// Offline skips the checks that contact the upstream resolvers and the
+	// OPL API.
+	Offline bool
+}
+
+// Check goes beyond cfg.Validate to find what would stop a server with
+// this configuration from starting or working: listen addresses that
+// cannot be bound, key and certificate files that cannot be loaded, and
+// upstreams or an API that cannot be reached. Listeners are closed again
+// straight away, so the check fails if a server is already running on the
+// same addresses.
+func Check(ctx context.Context, cfg *config.Config, opts CheckOptions) []CheckResult {
+	if err := cfg.Validate(); err != nil {
+		return []CheckResult{{Name: "configuration", Err: err}}
+	}
+	results := []CheckResult{{Name: "configuration"}}
+	add := func(name string, err error) {
+		results = append(results, CheckResult{Name: name, Err: err})
+	}
+
+	// A registered instance fetches with the key it was issued
+	if cfg.Registration.Enabled {
+		reg, err := LoadRegistration(cfg.Registration.StateFile)
+		switch {
+		case err != nil:
+			add("registration", err)
+		case reg == nil:
+			results = append(results, CheckResult{Name: "registration", Skipped: "not registered yet; the server registers on first start"})
+		default:
+			registered := *cfg
+			reg.Apply(&registered)
+			cfg = &registered
+			add("registration", nil)
+		}
+	}
+
+	if cfg.DNS.Enabled {
+		add("dns.listen_addr", checkBind(cfg.DNS.ListenAddr, true))
+	}
+	if cfg.Admin.Enabled {
+		ln, err := admin.Listen(cfg.Admin.ListenAddr)
+		if err == nil {
+			ln.Close()
+		}
+		add("admin.listen_addr", err)
+	}
+	if addr := cfg.Metrics.ListenAddr; addr != "" {
+		ln, err := admin.Listen(addr)
+		if err == nil {
+			ln.Close()
+		}
+		add("metrics.listen_addr", err)
+	}
+	if cfg.RPZ.Enabled {
+		add("rpz.listen_addr", checkBind(cfg.RPZ.ListenAddr, true))
+	}
+
+	if cfg.Logging.File != "" {
+		f, err := openLogFile(cfg.Logging)
+		if err == nil {
+			f.Close()
+		}
+		add("logging.file", err)
+	}
+	if cfg.Logging.Syslog.Enabled {
+		w, err := dialSyslog(cfg.Logging.Syslog)
+		if err == nil {
+			w.Close()
+		}
+		add("logging.syslog", err)
+	}
+
+	transport, err := api.NewTransport(api.TransportConfig{
+		ProxyURL:       cfg.API.ProxyURL,
+		CAFile:         cfg.API.CAFile,
+		ClientCertFile: cfg.API.ClientCertFile,
+		ClientKeyFile:  cfg.API.ClientKeyFile,
+	})
+	add("api proxy and TLS files", err)
+
+	if s := cfg.Stats.Signing; s.Algorithm != "" {
+		_, err := stats.LoadReportSigner(stats.SigningAlgorithm(s.Algorithm), s.KeyFile)
+		add("stats.signing.key_file", err)
+	}
+	if cfg.Stats.Enabled {
+		add("stats.report_content", reportContent(cfg).Validate())
+	}
+	if cfg.Policy.StateFile != "" || len(cfg.Groups) > 0 {
+		store, err := policy.NewStore(cfg.Policy.StateFile)
+		if err == nil {
+			err = store.SetGroups(policyGroups(cfg))
+		}
+		add("policy", err)
+	}
+
+	switch {
+	case !cfg.DNS.Enabled:
+	case cfg.DNS.ODoH.Enabled():
+		results = append(results, CheckResult{Name: "dns.odoh", Skipped: "ODoH targets are not probed"})
+	default:
+		for _, upstream := range upstreams(cfg) {
+			name := "upstream " + upstream.String()
+			if opts.Offline {
+				results = append(results, CheckResult{Name: name, Skipped: "offline"})
+				continue
+			}
+			add(name, dns.ProbeUpstream(ctx, upstream, cfg.DNS.QueryTimeout.Duration))
+		}
+	}
+
+	type source struct{ name, baseURL, apiKey string }
+	sources := []source{{"api.base_url", cfg.API.BaseURL, cfg.API.APIKey}}
+	for _, t := range cfg.Tenants {
+		baseURL := t.BaseURL
+		if baseURL == "" {
+			baseURL = cfg.API.BaseURL
+		}
+		sources = append(sources, source{"tenant " + t.Name, baseURL, t.APIKey})
+	}
+	for _, src := range sources {
+		switch {
+		case opts.Offline:
+			results = append(results, CheckResult{Name: src.name, Skipped: "offline"})
+		case transport == nil:
+			results = append(results, CheckResult{Name: src.name, Skipped: "API transport could not be configured"})
+		default:
+			// One attempt: a deployment gate should fail fast, not ride
+			// out an outage the way the server does
+			client := api.NewClient(src.baseURL, src.apiKey, cfg.API.Timeout.Duration,
+				api.WithTransport(transport),
+				api.WithRetryPolicy(api.RetryPolicy{MaxAttempts: 1, AttemptTimeout: cfg.API.Timeout.Duration}),
+			)
+			_, err := client.FetchBlocklist(ctx)
+			client.CloseIdleConnections()
+			if err != nil {
+				err = fmt.Errorf("fetching blocklist: %w", err)
+			}
+			add(src.name, err)
+		}
+	}
+	return results
+}
+
+// checkBind reports whether addr can be listened on over TCP and, if udp
+// is set, UDP.
+func checkBind(addr string, udp bool) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	l.Close()
+	if udp {
+		pc, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return err
+		}
+		pc.Close()
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package app
+
+import (
+	"bytes"
+	"sync"
+)
+
+// DefaultLogBufferLines is how many lines of log output a LogBuffer
+// created by New keeps.
+const DefaultLogBufferLines = 1000
+
+// LogBuffer keeps the most recent lines of log output for diagnostics
+// bundles. slog handlers write each record with a single Write, so every
+// Write is kept as one line.
+type LogBuffer struct {
+	mu    sync.Mutex
+	lines [][]byte
+	next  int
+	full  bool
+}
+
+// NewLogBuffer returns a LogBuffer that keeps the last n lines.
+func NewLogBuffer(n int) *LogBuffer {
+	return &LogBuffer{lines: make([][]byte, max(n, 1))}
+}
+
+// Write records p as one line, dropping the oldest line once the buffer is
+// full. It never fails.
+func (b *LogBuffer) Write(p []byte) (int, error) {
+	line := bytes.Clone(p)
+	b.mu.Lock()
+	b.lines[b.next] = line
+	b.next = (b.next + 1) % len(b.lines)
+	if b.next == 0 {
+		b.full = true
+	}
+	b.mu.Unlock()
+	return len(p), nil
+}
+
+// Bytes returns the lines kept, oldest first.
+func (b *LogBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var buf bytes.Buffer
+	if b.full {
+		for _, line := range b.lines[b.next:] {
+			buf.Write(line)
+		}
+	}
+	for _, line := range b.lines[:b.next] {
+		buf.Write(line)
+	}
+	return buf.Bytes()
+}
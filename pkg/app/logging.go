@@ -0,0 +1,191 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"log/syslog"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+	"github.com/online-picket-line/opl-for-dns/pkg/logfile"
+)
+
+// OpenLogger builds the process logger for the logging configuration,
+// writing to standard output, the log file and syslog as configured, and to
+// buffer if it is not nil. level is set and filtered by as in
+// NewLoggerWithLevel. Close the returned io.Closer to close the log file and
+// syslog connection.
+func OpenLogger(cfg config.LoggingConfig, buffer *LogBuffer, level *slog.LevelVar) (*slog.Logger, io.Closer, error) {
+	var writers []io.Writer
+	var closers logClosers
+	if cfg.Stdout {
+		writers = append(writers, os.Stdout)
+	}
+	if cfg.File != "" {
+		f, err := openLogFile(cfg)
+		if err != nil {
+			return nil, nil, err
+		}
+		writers = append(writers, f)
+		closers = append(closers, f)
+	}
+	if buffer != nil {
+		writers = append(writers, buffer)
+	}
+
+	logger := NewLoggerWithLevel(cfg, io.MultiWriter(writers...), level)
+	if cfg.Syslog.Enabled {
+		w, err := dialSyslog(cfg.Syslog)
+		if err != nil {
+			closers.Close()
+			return nil, nil, err
+		}
+		closers = append(closers, w)
+		logger = slog.New(fanoutHandler{logger.Handler(), newSyslogHandler(w, level)})
+	}
+	return logger, closers, nil
+}
+
+func openLogFile(cfg config.LoggingConfig) (*logfile.File, error) {
+	return logfile.Open(cfg.File, logfile.Options{
+		MaxSize:    int64(cfg.MaxSizeMB) << 20,
+		MaxAge:     cfg.MaxAge.Duration,
+		MaxBackups: cfg.MaxBackups,
+	})
+}
+
+// dialSyslog connects to the syslog daemon or server cfg names.
+func dialSyslog(cfg config.SyslogConfig) (*syslog.Writer, error) {
+	var network, addr string
+	if cfg.Address != "" {
+		u, err := url.Parse(cfg.Address)
+		if err != nil {
+			return nil, fmt.Errorf("parsing logging.syslog.address: %w", err)
+		}
+		network, addr = u.Scheme, u.Host
+	}
+	tag := cfg.Tag
+	if tag == "" {
+		tag = "opl-dns"
+	}
+	w, err := syslog.Dial(network, addr, syslog.LOG_DAEMON|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to syslog: %w", err)
+	}
+	return w, nil
+}
+
+type logClosers []io.Closer
+
+func (c logClosers) Close() error {
+	var errs []error
+	for _, closer := range c {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// fanoutHandler passes each record to several handlers.
+type fanoutHandler []slog.Handler
+
+func (h fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, handler := range h {
+		if handler.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, handler := range h {
+		if handler.Enabled(ctx, r.Level) {
+			errs = append(errs, handler.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(fanoutHandler, len(h))
+	for i, handler := range h {
+		out[i] = handler.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (h fanoutHandler) WithGroup(name string) slog.Handler {
+	out := make(fanoutHandler, len(h))
+	for i, handler := range h {
+		out[i] = handler.WithGroup(name)
+	}
+	return out
+}
+
+// syslogHandler sends records to syslog at the priority matching their
+// level. Syslog stamps the time and priority itself, so messages carry only
+// the text and attributes.
+type syslogHandler struct {
+	slog.Handler
+	out *syslogOutput
+}
+
+// syslogOutput collects one formatted record at a time for sending.
+type syslogOutput struct {
+	mu  sync.Mutex
+	w   *syslog.Writer
+	buf bytes.Buffer
+}
+
+func newSyslogHandler(w *syslog.Writer, level slog.Leveler) *syslogHandler {
+	out := &syslogOutput{w: w}
+	return &syslogHandler{
+		Handler: slog.NewTextHandler(&out.buf, &slog.HandlerOptions{
+			Level: level,
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if len(groups) == 0 && (a.Key == slog.TimeKey || a.Key == slog.LevelKey) {
+					return slog.Attr{}
+				}
+				return a
+			},
+		}),
+		out: out,
+	}
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.out.mu.Lock()
+	defer h.out.mu.Unlock()
+
+	h.out.buf.Reset()
+	if err := h.Handler.Handle(ctx, r); err != nil {
+		return err
+	}
+	msg := strings.TrimSuffix(h.out.buf.String(), "\n")
+	switch {
+	case r.Level >= slog.LevelError:
+		return h.out.w.Err(msg)
+	case r.Level >= slog.LevelWarn:
+		return h.out.w.Warning(msg)
+	case r.Level >= slog.LevelInfo:
+		return h.out.w.Info(msg)
+	default:
+		return h.out.w.Debug(msg)
+	}
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{Handler: h.Handler.WithAttrs(attrs), out: h.out}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{Handler: h.Handler.WithGroup(name), out: h.out}
+}
@@ -0,0 +1,71 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+	"github.com/online-picket-line/opl-for-dns/pkg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/policy"
+)
+
+// Lookup reports how a server started with cfg would answer a query for
+// domain from client, without starting one. It fetches the blocklist from
+// the OPL API once and loads the local policy file and groups. client may
+// be the zero Addr, in which case no group applies.
+func Lookup(ctx context.Context, cfg *config.Config, client netip.Addr, domain string) (dns.Decision, error) {
+	var p *policy.Policy
+	if cfg.Policy.StateFile != "" || len(cfg.Groups) > 0 {
+		store, err := policy.NewStore(cfg.Policy.StateFile)
+		if err == nil {
+			err = store.SetGroups(policyGroups(cfg))
+		}
+		if err != nil {
+			return dns.Decision{}, err
+		}
+		p = store.Policy()
+	}
+
+	apiClient, err := fetchOnce(ctx, cfg)
+	if err != nil {
+		return dns.Decision{}, err
+	}
+	return dns.Decide(p, apiClient, client, domain), nil
+}
+
+// FetchBlocklist fetches the blocklist a server started with cfg would
+// enforce, trying once.
+func FetchBlocklist(ctx context.Context, cfg *config.Config) (*api.Blocklist, error) {
+	apiClient, err := fetchOnce(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return apiClient.GetCachedBlocklist(), nil
+}
+
+// fetchOnce returns an API client for cfg that has fetched the blocklist
+// with a single attempt.
+func fetchOnce(ctx context.Context, cfg *config.Config) (*api.Client, error) {
+	transport, err := api.NewTransport(api.TransportConfig{
+		ProxyURL:       cfg.API.ProxyURL,
+		CAFile:         cfg.API.CAFile,
+		ClientCertFile: cfg.API.ClientCertFile,
+		ClientKeyFile:  cfg.API.ClientKeyFile,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("configuring API transport: %w", err)
+	}
+
+	apiClient := api.NewClient(cfg.API.BaseURL, cfg.API.APIKey, cfg.API.Timeout.Duration,
+		api.WithTransport(transport),
+		api.WithRetryPolicy(api.RetryPolicy{MaxAttempts: 1, AttemptTimeout: cfg.API.Timeout.Duration}),
+		api.WithFilter(apiFilter(cfg)),
+	)
+	defer apiClient.CloseIdleConnections()
+	if _, err := apiClient.FetchBlocklist(ctx); err != nil {
+		return nil, fmt.Errorf("fetching blocklist: %w", err)
+	}
+	return apiClient, nil
+}
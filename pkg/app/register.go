@@ -0,0 +1,179 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+)
+
+// Registered holds the credentials the backend issued this instance.
+type Registered struct {
+	InstanceID   string    `json:"instance_id"`
+	APIKey       string    `json:"api_key"`
+	URL          string    `json:"url"`
+	RegisteredAt time.Time `json:"registered_at"`
+}
+
+// Apply uses the issued credentials in place of api.api_key and
+// stats.instance_id. Pass it in Options.Overrides so that reloaded
+// configurations keep them.
+func (r *Registered) Apply(cfg *config.Config) error {
+	cfg.API.APIKey = r.APIKey
+	cfg.Stats.InstanceID = r.InstanceID
+	return nil
+}
+
+// Register returns the credentials issued to this instance, registering it
+// with the backend first if registration.state_file holds none. The
+// instance's key pair is created in registration.key_file if it does not
+// exist yet. It returns nil if registration is disabled.
+func Register(ctx context.Context, cfg *config.Config, version string, logger *slog.Logger) (*Registered, error) {
+	r := cfg.Registration
+	if !r.Enabled {
+		return nil, nil
+	}
+	if reg, err := LoadRegistration(r.StateFile); err != nil || reg != nil {
+		return reg, err
+	}
+
+	publicKey, err := instancePublicKey(r.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("registration.key_file: %w", err)
+	}
+	transport, err := api.NewTransport(api.TransportConfig{
+		ProxyURL:       cfg.API.ProxyURL,
+		CAFile:         cfg.API.CAFile,
+		ClientCertFile: cfg.API.ClientCertFile,
+		ClientKeyFile:  cfg.API.ClientKeyFile,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("configuring API transport: %w", err)
+	}
+	defer transport.CloseIdleConnections()
+
+	url := registrationURL(cfg)
+	logger.Info("Registering instance with the OPL backend", "url", url)
+	ctx, cancel := context.WithTimeout(ctx, cfg.API.Timeout.Duration)
+	defer cancel()
+	creds, err := api.Register(ctx, &http.Client{Transport: transport}, url, r.EnrollmentToken, api.Registration{
+		InstanceID:   instanceID(cfg),
+		PublicKey:    string(publicKey),
+		Capabilities: capabilities(cfg),
+		Contact:      r.Contact,
+		Version:      version,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	reg := &Registered{
+		InstanceID:   creds.InstanceID,
+		APIKey:       creds.APIKey,
+		URL:          url,
+		RegisteredAt: time.Now().UTC(),
+	}
+	if err := saveRegistration(r.StateFile, reg); err != nil {
+		return nil, err
+	}
+	logger.Info("Instance registered", "instanceId", reg.InstanceID)
+	return reg, nil
+}
+
+// LoadRegistration reads the credentials saved in path, or returns nil if
+// the instance has not registered yet.
+func LoadRegistration(path string) (*Registered, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading registration state: %w", err)
+	}
+	var reg Registered
+	if err := json.Unmarshal(data, &reg); err != nil {
+		return nil, fmt.Errorf("parsing registration state %s: %w", path, err)
+	}
+	if reg.APIKey == "" || reg.InstanceID == "" {
+		return nil, fmt.Errorf("registration state %s has no api_key or instance_id; remove it to register again", path)
+	}
+	return &reg, nil
+}
+
+// saveRegistration writes reg to path, readable only by its owner since it
+// holds the API key.
+func saveRegistration(path string, reg *Registered) error {
+	data, err := json.MarshalIndent(reg, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("saving registration state: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("saving registration state: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("saving registration state: %w", err)
+	}
+	return nil
+}
+
+// instancePublicKey returns the public half of the Ed25519 key in path,
+// creating the key if the file does not exist. A key left by a failed
+// registration is reused.
+func instancePublicKey(path string) ([]byte, error) {
+	signer, err := stats.LoadReportSigner(stats.SigningEd25519, path)
+	if err == nil {
+		return signer.PublicKeyPEM()
+	}
+	if _, statErr := os.Stat(path); !errors.Is(statErr, os.ErrNotExist) {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, err
+	}
+	return stats.GenerateSigningKey(path)
+}
+
+// registrationURL is registration.url, or the endpoint under api.base_url.
+func registrationURL(cfg *config.Config) string {
+	if cfg.Registration.URL != "" {
+		return cfg.Registration.URL
+	}
+	return strings.TrimSuffix(cfg.API.BaseURL, "/") + "/dns-instances/register"
+}
+
+// capabilities names the optional features cfg enables, so the backend
+// knows what to expect from the instance.
+func capabilities(cfg *config.Config) []string {
+	caps := []string{"signed_stats"}
+	for _, c := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"dns", cfg.DNS.Enabled},
+		{"stats", cfg.Stats.Enabled},
+		{"client_stats", cfg.Stats.Clients.Enabled},
+		{"delta_updates", cfg.API.DeltaUpdates},
+		{"stream", cfg.API.StreamEnabled},
+		{"tenants", len(cfg.Tenants) > 0},
+	} {
+		if c.enabled {
+			caps = append(caps, c.name)
+		}
+	}
+	return caps
+}
@@ -0,0 +1,200 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+	"github.com/online-picket-line/opl-for-dns/pkg/remoteconfig"
+	"github.com/online-picket-line/opl-for-dns/pkg/sdnotify"
+)
+
+// ReloadResult lists what a reload changed.
+type ReloadResult struct {
+	// Applied are the settings now in effect, plus "policy" when the
+	// policy state file was re-read.
+	Applied []string `json:"applied"`
+
+	// RestartRequired are changed settings that only take effect after a
+	// restart. They are reported again on every reload until then.
+	RestartRequired []string `json:"restart_required"`
+}
+
+// ReloadConfig reads the configuration file the App was started with,
+// layers the current remote configuration over it, applies
+// Options.Overrides, and applies the result as Reload does.
+func (a *App) ReloadConfig() (ReloadResult, error) {
+	if a.configPath == "" {
+		return ReloadResult{}, fmt.Errorf("no configuration file to reload")
+	}
+	var doc *remoteconfig.Document
+	if a.remote != nil {
+		doc = a.remote.Current()
+	}
+	cfg, err := LoadConfig(a.configPath, doc, a.overrides)
+	if err != nil {
+		return ReloadResult{}, err
+	}
+	return a.Reload(cfg)
+}
+
+// Reload applies the settings of cfg that can change without rebinding
+// sockets or rebuilding components: the upstream resolvers, the client
+// groups, the blocklist refresh interval, the log level, and the shutdown
+// timeout. It also re-reads the policy state file, picking up allowlist
+// edits. Other changed settings are logged and
+// returned as needing a restart. If cfg is invalid or the policy file cannot
+// be read, nothing is changed.
+func (a *App) Reload(cfg *config.Config) (ReloadResult, error) {
+	if err := cfg.Validate(); err != nil {
+		return ReloadResult{}, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	// systemd hears about reloads only once it has been told the server is
+	// ready
+	select {
+	case <-a.ready:
+		a.notify(sdnotify.Reloading)
+		defer a.notify(sdnotify.Ready)
+	default:
+	}
+
+	result := ReloadResult{Applied: []string{}, RestartRequired: []string{}}
+	if a.policyStore != nil && cfg.Policy.StateFile == a.running.Policy.StateFile {
+		if err := a.policyStore.Reload(); err != nil {
+			return ReloadResult{}, err
+		}
+		result.Applied = append(result.Applied, "policy")
+	}
+
+	changes := config.Changes(a.running, cfg)
+	if a.policyStore != nil && slices.Contains(changes, "groups") {
+		if err := a.policyStore.SetGroups(policyGroups(cfg)); err != nil {
+			return ReloadResult{}, err
+		}
+	}
+
+	running := *a.running
+	for _, name := range changes {
+		if !a.reloadable(name) {
+			result.RestartRequired = append(result.RestartRequired, name)
+			continue
+		}
+		switch name {
+		case "dns.upstream_dns":
+			if a.dnsServer != nil {
+				a.dnsServer.SetUpstreams(upstreams(cfg))
+			}
+			running.DNS.UpstreamDNS = cfg.DNS.UpstreamDNS
+		case "groups":
+			running.Groups = cfg.Groups
+		case "api.refresh_interval":
+			a.refreshInterval.Store(int64(cfg.API.RefreshInterval.Duration))
+			select {
+			case a.refreshChanged <- struct{}{}:
+			default:
+			}
+			running.API.RefreshInterval = cfg.API.RefreshInterval
+		case "shutdown.timeout":
+			running.Shutdown.Timeout = cfg.Shutdown.Timeout
+		case "logging.level":
+			a.logLevel.Set(parseLogLevel(cfg.Logging.Level))
+			running.Logging.Level = cfg.Logging.Level
+		}
+		result.Applied = append(result.Applied, name)
+	}
+	a.running = &running
+
+	a.logger.Info("Configuration reloaded", "applied", result.Applied)
+	if len(result.RestartRequired) > 0 {
+		a.logger.Warn("Some configuration changes need a restart", "settings", result.RestartRequired)
+	}
+	return result, nil
+}
+
+// reloadable reports whether Reload applies a change to the named setting
+// without a restart.
+func (a *App) reloadable(name string) bool {
+	switch name {
+	case "dns.upstream_dns", "api.refresh_interval", "shutdown.timeout":
+		return true
+	case "groups":
+		return a.policyStore != nil
+	case "logging.level":
+		return a.logLevel != nil
+	}
+	return false
+}
+
+// RunningConfig returns the configuration in effect: the startup
+// configuration with the settings applied by reloads and patches since.
+func (a *App) RunningConfig() *config.Config {
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+	return a.running
+}
+
+// PatchConfig applies patch, a partial configuration document, over the
+// configuration in effect, as Reload does, and returns the settings it
+// changed. It refuses unknown settings and settings that need a restart.
+// The change lasts until the next reload or restart, either of which
+// returns to the configuration file.
+func (a *App) PatchConfig(patch []byte) ([]string, error) {
+	base := a.RunningConfig()
+
+	// Decoding the patch over a copy merges objects and replaces lists,
+	// as configuration layers do
+	data, err := json.Marshal(base)
+	if err != nil {
+		return nil, err
+	}
+	cfg := new(config.Config)
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(patch))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return nil, fmt.Errorf("parsing configuration: %w", err)
+	}
+
+	var fixed []string
+	for _, name := range config.Changes(base, cfg) {
+		if !a.reloadable(name) {
+			fixed = append(fixed, name)
+		}
+	}
+	if len(fixed) > 0 {
+		return nil, fmt.Errorf("%s cannot be changed without a restart", strings.Join(fixed, ", "))
+	}
+
+	result, err := a.Reload(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return slices.DeleteFunc(result.Applied, func(name string) bool { return name == "policy" }), nil
+}
+
+// adminReload returns the admin interface's reload hook, or nil if there
+// is no configuration file to reload.
+func (a *App) adminReload() func() (applied, restartRequired []string, err error) {
+	if a.configPath == "" {
+		return nil
+	}
+	return func() ([]string, []string, error) {
+		result, err := a.ReloadConfig()
+		return result.Applied, result.RestartRequired, err
+	}
+}
+
+// currentRefreshInterval returns the blocklist refresh interval in effect.
+func (a *App) currentRefreshInterval() time.Duration {
+	return time.Duration(a.refreshInterval.Load())
+}
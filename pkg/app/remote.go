@@ -0,0 +1,145 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+	"github.com/online-picket-line/opl-for-dns/pkg/remoteconfig"
+)
+
+// NewRemoteSource creates the source for cfg's remote_config section. It
+// uses the API's proxy and TLS settings.
+func NewRemoteSource(cfg *config.Config) (*remoteconfig.Source, error) {
+	r := cfg.RemoteConfig
+	key, err := remoteconfig.LoadPublicKey(r.PublicKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("remote_config.public_key_file: %w", err)
+	}
+	transport, err := api.NewTransport(api.TransportConfig{
+		ProxyURL:       cfg.API.ProxyURL,
+		CAFile:         cfg.API.CAFile,
+		ClientCertFile: cfg.API.ClientCertFile,
+		ClientKeyFile:  cfg.API.ClientKeyFile,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("configuring API transport: %w", err)
+	}
+	return remoteconfig.New(remoteconfig.Config{
+		URL:       r.URL,
+		APIKey:    r.APIKey,
+		PublicKey: key,
+		CacheFile: r.CacheFile,
+		Timeout:   cfg.API.Timeout.Duration,
+		Transport: transport,
+	}), nil
+}
+
+// LoadConfig reads the configuration file at path, layers doc over it if
+// doc is not nil, and then applies overrides if set. The remote_config
+// section always comes from the file, so a remote document cannot change
+// where configuration is fetched from or which key signs it.
+func LoadConfig(path string, doc *remoteconfig.Document, overrides func(*config.Config) error) (*config.Config, error) {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if doc != nil {
+		local := cfg.RemoteConfig
+		if err := cfg.Layer(doc.Body); err != nil {
+			return nil, fmt.Errorf("parsing remote configuration: %w", err)
+		}
+		cfg.RemoteConfig = local
+	}
+	if overrides != nil {
+		if err := overrides(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// BootstrapRemote returns the configuration at path with the remote
+// document layered over it. It prefers a freshly fetched document and falls
+// back to the cached one when the fetch fails or the fetched document does
+// not give a valid configuration. If neither is usable it returns the local
+// configuration; the App applies the remote one once a later fetch
+// succeeds. The document used becomes remote's current document.
+func BootstrapRemote(ctx context.Context, path string, remote *remoteconfig.Source, overrides func(*config.Config) error, logger *slog.Logger) (*config.Config, error) {
+	try := func(doc *remoteconfig.Document) (*config.Config, error) {
+		cfg, err := LoadConfig(path, doc, overrides)
+		if err != nil {
+			return nil, err
+		}
+		if err := cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid configuration: %w", err)
+		}
+		if err := remote.Accept(doc); err != nil {
+			logger.Warn("Remote configuration not cached", "error", err)
+		}
+		return cfg, nil
+	}
+
+	doc, err := remote.Fetch(ctx)
+	if err == nil {
+		var cfg *config.Config
+		if cfg, err = try(doc); err == nil {
+			logger.Info("Using remote configuration", "fetched", doc.Fetched)
+			return cfg, nil
+		}
+	}
+	logger.Warn("Remote configuration unavailable, trying the cached copy", "error", err)
+
+	if doc, err = remote.Cached(); err == nil {
+		var cfg *config.Config
+		if cfg, err = try(doc); err == nil {
+			logger.Info("Using cached remote configuration", "fetched", doc.Fetched)
+			return cfg, nil
+		}
+	}
+	logger.Warn("Cached remote configuration unavailable, starting with the local configuration", "error", err)
+	return LoadConfig(path, nil, overrides)
+}
+
+// refetchRemote fetches the remote configuration every interval and applies
+// it as Reload does when it changes. A document that does not verify or
+// does not give a valid configuration is logged and ignored; the running
+// configuration and the cache keep the last good one.
+func (a *App) refetchRemote(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		doc, err := a.remote.Fetch(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				a.logger.Warn("Remote configuration fetch failed", "error", err)
+			}
+			continue
+		}
+		if current := a.remote.Current(); current != nil && bytes.Equal(current.Body, doc.Body) {
+			continue
+		}
+
+		cfg, err := LoadConfig(a.configPath, doc, a.overrides)
+		if err == nil {
+			_, err = a.Reload(cfg)
+		}
+		if err != nil {
+			a.logger.Error("Not applying remote configuration", "error", err)
+			continue
+		}
+		if err := a.remote.Accept(doc); err != nil {
+			a.logger.Warn("Remote configuration not cached", "error", err)
+		}
+	}
+}
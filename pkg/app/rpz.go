@@ -0,0 +1,28 @@
+package app
+
+import (
+	"log/slog"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+	"github.com/online-picket-line/opl-for-dns/pkg/rpz"
+)
+
+// newRPZServer creates the server for the rpz section, which serves the
+// top-level blocklist; tenants' blocklists are not in the zone.
+func newRPZServer(cfg *config.Config, logger *slog.Logger) (*rpz.Server, error) {
+	keys := make([]rpz.Key, 0, len(cfg.RPZ.TSIGKeys))
+	for _, k := range cfg.RPZ.TSIGKeys {
+		keys = append(keys, rpz.Key{Name: k.Name, Algorithm: k.Algorithm, Secret: k.Secret})
+	}
+	return rpz.New(rpz.Config{
+		ListenAddr:    cfg.RPZ.ListenAddr,
+		Zone:          cfg.RPZ.Zone,
+		Action:        rpz.Action(cfg.RPZ.Action),
+		TTL:           cfg.RPZ.TTL.Duration,
+		AllowTransfer: cfg.RPZ.AllowTransfer,
+		Keys:          keys,
+		Notify:        cfg.RPZ.Notify,
+		JournalSize:   cfg.RPZ.JournalSize,
+		Logger:        logger,
+	})
+}
@@ -0,0 +1,48 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/sdnotify"
+)
+
+// notify tells systemd about a change of state. It does nothing unless the
+// server runs as a Type=notify service.
+func (a *App) notify(states ...string) {
+	if _, err := sdnotify.Notify(states...); err != nil {
+		a.logger.Warn("Error notifying systemd", "error", err)
+	}
+}
+
+// feedWatchdog pings the systemd watchdog twice per interval for as long as
+// the DNS listeners answer, so that systemd restarts a server that is still
+// running but no longer serving. With DNS disabled there is nothing to
+// probe, so every ping is sent.
+func (a *App) feedWatchdog(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if a.dnsServer == nil {
+				a.notify(sdnotify.Watchdog)
+				continue
+			}
+			probeCtx, cancel := context.WithTimeout(ctx, interval/4)
+			err := a.dnsServer.Probe(probeCtx)
+			cancel()
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+				a.logger.Warn("DNS listeners not answering, withholding watchdog ping", "error", err)
+				continue
+			}
+			a.notify(sdnotify.Watchdog)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/admin"
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+	"github.com/online-picket-line/opl-for-dns/pkg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/ipmatch"
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+)
+
+// tenant is a member organization served alongside the top-level clients,
+// with its own blocklist and stats.
+type tenant struct {
+	cfg        config.TenantConfig
+	instanceID string
+	client     *api.Client
+	collector  *stats.Collector
+	reporter   *stats.Reporter
+	logger     *slog.Logger
+}
+
+// newTenants creates a blocklist client and stats collector for each
+// configured tenant. Tenant clients share the top-level client's options
+// apart from the version store, which is kept for the top-level blocklist
+// only. exporters receives every tenant's events besides its collector, so
+// metrics and telemetry cover all clients.
+func newTenants(cfg *config.Config, apiOpts []api.ClientOption, collectorOpts []stats.CollectorOption, exporters stats.Recorder, logger *slog.Logger) ([]*tenant, *ipmatch.Table[*dns.Tenant]) {
+	if len(cfg.Tenants) == 0 {
+		return nil, nil
+	}
+	tenants := make([]*tenant, 0, len(cfg.Tenants))
+	table := new(ipmatch.Table[*dns.Tenant])
+	for _, tc := range cfg.Tenants {
+		t := &tenant{
+			cfg:        tc,
+			instanceID: tc.InstanceID,
+			collector:  stats.NewCollector(collectorOpts...),
+			logger:     logger.With("tenant", tc.Name),
+		}
+		if t.instanceID == "" {
+			t.instanceID = instanceID(cfg) + "-" + tc.Name
+		}
+		recorder := stats.Multi(t.collector, exporters)
+
+		baseURL := tc.BaseURL
+		if baseURL == "" {
+			baseURL = cfg.API.BaseURL
+		}
+		apiLogger := t.logger.With("component", "api")
+		opts := append(append([]api.ClientOption(nil), apiOpts...),
+			api.WithLogger(apiLogger),
+			api.WithRecorder(recorder),
+		)
+		t.client = api.NewClient(baseURL, tc.APIKey, cfg.API.Timeout.Duration, opts...)
+		t.client.OnBlocklistUpdated(func(change api.BlocklistChange) {
+			logBlocklistChange(apiLogger, change)
+		})
+
+		served := &dns.Tenant{Name: tc.Name, Blocklist: t.client, Stats: recorder}
+		for _, c := range tc.Clients {
+			// Validate has already rejected unparseable clients
+			prefix, _ := ipmatch.ParsePrefix(c)
+			table.Insert(prefix, served)
+		}
+		tenants = append(tenants, t)
+	}
+	return tenants, table
+}
+
+// reportURL is where the tenant's stats reports are sent: stats.report_url
+// if set, otherwise its own API.
+func (t *tenant) reportURL(cfg *config.Config) string {
+	if cfg.Stats.ReportURL != "" {
+		return cfg.Stats.ReportURL
+	}
+	baseURL := t.cfg.BaseURL
+	if baseURL == "" {
+		baseURL = cfg.API.BaseURL
+	}
+	return strings.TrimSuffix(baseURL, "/") + "/dns-stats/report"
+}
+
+// fetchTenantBlocklists starts fetching every tenant's blocklist and
+// returns a function that waits for the fetches to finish. A tenant's
+// failure is logged and does not affect the others.
+func (a *App) fetchTenantBlocklists(ctx context.Context) (wait func()) {
+	var wg sync.WaitGroup
+	for _, t := range a.tenants {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := t.client.FetchBlocklistWithRetry(ctx); err != nil {
+				if ctx.Err() == nil {
+					t.logger.Error("Error fetching tenant blocklist", "error", err)
+				}
+				return
+			}
+			if blocklist := t.client.GetCachedBlocklist(); blocklist != nil {
+				t.logger.Debug("Tenant blocklist loaded", "urls", blocklist.TotalURLs, "employers", len(blocklist.Employers))
+			}
+		}()
+	}
+	return wg.Wait
+}
+
+// adminTenants describes the tenants for the admin server.
+func (a *App) adminTenants() []admin.Tenant {
+	var tenants []admin.Tenant
+	for _, t := range a.tenants {
+		tenants = append(tenants, admin.Tenant{Name: t.cfg.Name, Blocklist: t.client, Reporter: t.reporter})
+	}
+	return tenants
+}
+
+// tenantStreamURL is the WebSocket endpoint for a tenant: api.stream_url
+// unless the tenant has its own API, whose default endpoint is used.
+func tenantStreamURL(cfg *config.Config, tc config.TenantConfig) string {
+	if tc.BaseURL != "" {
+		return ""
+	}
+	return cfg.API.StreamURL
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/config"
+)
+
+// watchConfig applies edits to the configuration file, or to files it
+// includes, as ReloadConfig does. It polls rather than relying on file
+// system notifications: polling also sees Kubernetes ConfigMap updates,
+// which swap a symlink above the file. An edit is applied once the files
+// have stayed the same for the debounce period; an invalid edit is logged
+// and skipped until the files change again. loaded is the configDigest of
+// the files the running configuration was read from.
+func (a *App) watchConfig(ctx context.Context, loaded [sha256.Size]byte) {
+	watch := a.cfg.ConfigWatch
+	ticker := time.NewTicker(watch.PollInterval.Duration)
+	defer ticker.Stop()
+
+	applied := loaded
+	var pending [sha256.Size]byte
+	var pendingSince time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		digest, err := configDigest(a.configPath)
+		if err != nil {
+			// A file may be briefly missing while it is replaced
+			a.logger.Debug("Cannot read configuration files", "path", a.configPath, "error", err)
+			continue
+		}
+		if digest == applied {
+			pendingSince = time.Time{}
+			continue
+		}
+		if pendingSince.IsZero() || digest != pending {
+			pending, pendingSince = digest, time.Now()
+			continue
+		}
+		if time.Since(pendingSince) < watch.Debounce.Duration {
+			continue
+		}
+
+		applied, pendingSince = digest, time.Time{}
+		a.logger.Info("Configuration file changed, reloading", "path", a.configPath)
+		if _, err := a.ReloadConfig(); err != nil {
+			a.logger.Error("Not applying edited configuration", "error", err)
+		}
+	}
+}
+
+// configDigest hashes the configuration file at path together with the
+// files it includes, so an edit to any of them is seen.
+func configDigest(path string) ([sha256.Size]byte, error) {
+	files, err := config.Files(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	h := sha256.New()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return [sha256.Size]byte{}, err
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", file, len(data))
+		h.Write(data)
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum, nil
+}
@@ -0,0 +1,287 @@
+// Package blocklog keeps a history of individual blocked queries on disk, so
+// operators can see when and for whom blocks happened rather than only the
+// lifetime totals. Events are appended to one JSON Lines file per UTC day,
+// which makes retention a matter of deleting old files.
+package blocklog
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultRetention is how long events are kept when Config.Retention is
+// zero.
+const DefaultRetention = 30 * 24 * time.Hour
+
+// queueSize is how many events may wait to be written before new ones are
+// dropped. Blocking the DNS handler on disk I/O would be worse.
+const queueSize = 4096
+
+// flushInterval bounds how long a recorded event may sit in the write
+// buffer before it is visible to queries.
+const flushInterval = time.Second
+
+// Event is one blocked query.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Domain   string    `json:"domain"`
+	Employer string    `json:"employer,omitempty"`
+	ActionID string    `json:"action_id,omitempty"`
+
+	// Client is a keyed hash of the client address. The key changes when
+	// the server restarts.
+	Client string `json:"client,omitempty"`
+}
+
+// Config configures a Log.
+type Config struct {
+	// Dir holds the daily event files. It is created if missing.
+	Dir string
+
+	// Retention is how long events are kept. Whole days older than this
+	// are deleted. Defaults to DefaultRetention.
+	Retention time.Duration
+
+	Logger *slog.Logger
+}
+
+// Log records block events and answers queries about them.
+type Log struct {
+	dir       string
+	retention time.Duration
+	logger    *slog.Logger
+	now       func() time.Time
+
+	// key hashes client addresses; it is random per process
+	key []byte
+
+	events  chan Event
+	dropped atomic.Int64
+}
+
+// Open creates the event directory if needed and returns a Log. Events are
+// only written while Run is active.
+func Open(cfg Config) (*Log, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("block log directory is required")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("creating block log directory: %w", err)
+	}
+	if cfg.Retention <= 0 {
+		cfg.Retention = DefaultRetention
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.New(slog.DiscardHandler)
+	}
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	return &Log{
+		dir:       cfg.Dir,
+		retention: cfg.Retention,
+		logger:    logger,
+		now:       time.Now,
+		key:       key,
+		events:    make(chan Event, queueSize),
+	}, nil
+}
+
+// Record queues a blocked query from client for writing. It never blocks;
+// if the writer has fallen behind, the event is dropped and counted.
+func (l *Log) Record(client netip.Addr, domain, employer, actionID string) {
+	ev := Event{
+		Time:     l.now().UTC(),
+		Domain:   domain,
+		Employer: employer,
+		ActionID: actionID,
+	}
+	if client.IsValid() {
+		ev.Client = l.hash(client)
+	}
+
+	select {
+	case l.events <- ev:
+	default:
+		l.dropped.Add(1)
+	}
+}
+
+// Dropped returns how many events were discarded because the writer could
+// not keep up.
+func (l *Log) Dropped() int64 {
+	return l.dropped.Load()
+}
+
+func (l *Log) hash(client netip.Addr) string {
+	mac := hmac.New(sha256.New, l.key)
+	mac.Write([]byte(client.Unmap().String()))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// Run writes queued events until ctx is cancelled, then writes whatever is
+// still queued. It also deletes days older than the retention period, once
+// at startup and again whenever the day changes.
+func (l *Log) Run(ctx context.Context) {
+	w := &dayWriter{dir: l.dir}
+	defer func() {
+		if err := w.close(); err != nil {
+			l.logger.Error("Error closing block log", "error", err)
+		}
+	}()
+
+	l.prune(l.now())
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case ev := <-l.events:
+					l.write(w, ev)
+				default:
+					return
+				}
+			}
+		case ev := <-l.events:
+			l.write(w, ev)
+		case <-ticker.C:
+			if err := w.flush(); err != nil {
+				l.logger.Error("Error writing block log", "error", err)
+			}
+		}
+	}
+}
+
+func (l *Log) write(w *dayWriter, ev Event) {
+	rotated, err := w.write(ev)
+	if err != nil {
+		l.logger.Error("Error writing block log", "error", err)
+	}
+	if rotated {
+		l.prune(ev.Time)
+	}
+}
+
+// prune deletes the files of days that ended more than retention before
+// now.
+func (l *Log) prune(now time.Time) {
+	cutoff := day(now.Add(-l.retention))
+	days, err := l.days()
+	if err != nil {
+		l.logger.Error("Error listing block log", "error", err)
+		return
+	}
+	for _, d := range days {
+		if d.Before(cutoff) {
+			if err := os.Remove(l.path(d)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				l.logger.Error("Error pruning block log", "error", err)
+			}
+		}
+	}
+}
+
+const fileLayout = "2006-01-02"
+
+// day returns the start of the UTC day containing t.
+func day(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+func fileName(d time.Time) string {
+	return "blocks-" + d.Format(fileLayout) + ".jsonl"
+}
+
+func (l *Log) path(d time.Time) string {
+	return filepath.Join(l.dir, fileName(d))
+}
+
+// days lists the days that have an event file, oldest first.
+func (l *Log) days() ([]time.Time, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, err
+	}
+	var days []time.Time
+	for _, e := range entries {
+		name, ok := strings.CutPrefix(e.Name(), "blocks-")
+		if !ok {
+			continue
+		}
+		name, ok = strings.CutSuffix(name, ".jsonl")
+		if !ok {
+			continue
+		}
+		if d, err := time.Parse(fileLayout, name); err == nil {
+			days = append(days, d)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days, nil
+}
+
+// dayWriter appends events to the file of the day they happened on.
+type dayWriter struct {
+	dir  string
+	day  time.Time
+	file *os.File
+	buf  *bufio.Writer
+}
+
+// write appends ev, switching files if ev is from a different day than the
+// previous event. It reports whether it switched.
+func (w *dayWriter) write(ev Event) (rotated bool, err error) {
+	d := day(ev.Time)
+	if w.file == nil || !d.Equal(w.day) {
+		rotated = w.file != nil
+		if err := w.close(); err != nil {
+			return rotated, err
+		}
+		f, err := os.OpenFile(filepath.Join(w.dir, fileName(d)), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+		if err != nil {
+			return rotated, fmt.Errorf("opening block log: %w", err)
+		}
+		w.day, w.file, w.buf = d, f, bufio.NewWriter(f)
+	}
+
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return rotated, err
+	}
+	w.buf.Write(line)
+	return rotated, w.buf.WriteByte('\n')
+}
+
+func (w *dayWriter) flush() error {
+	if w.buf == nil {
+		return nil
+	}
+	return w.buf.Flush()
+}
+
+func (w *dayWriter) close() error {
+	if w.file == nil {
+		return nil
+	}
+	err := errors.Join(w.buf.Flush(), w.file.Close())
+	w.file, w.buf = nil, nil
+	return err
+}
@@ -0,0 +1,156 @@
+package blocklog
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// record queues events as if they arrived at the given times, then writes
+// them with Run.
+func record(t *testing.T, l *Log, events ...Event) {
+	t.Helper()
+
+	for _, ev := range events {
+		l.now = func() time.Time { return ev.Time }
+		l.Record(netip.MustParseAddr("192.0.2.1"), ev.Domain, ev.Employer, ev.ActionID)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	l.Run(ctx)
+}
+
+func TestSummarize(t *testing.T) {
+	l, err := Open(Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	day1 := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+	record(t, l,
+		Event{Time: day1, Domain: "acme.com", Employer: "Acme"},
+		Event{Time: day1.Add(time.Hour), Domain: "shop.acme.com", Employer: "Acme"},
+		Event{Time: day1.Add(2 * time.Hour), Domain: "globex.com", Employer: "Globex"},
+		Event{Time: day2, Domain: "globex.com", Employer: "Globex"},
+	)
+
+	days, err := l.Summarize(day1, day2.AddDate(0, 0, 1), "")
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if len(days) != 3 {
+		t.Fatalf("Expected 3 days, got %d", len(days))
+	}
+	if days[0].Date != "2026-03-01" || days[0].Total != 3 {
+		t.Errorf("Unexpected first day %+v", days[0])
+	}
+	if e := days[0].Employers; len(e) != 2 || e[0] != (EmployerCount{"Acme", 2}) || e[1] != (EmployerCount{"Globex", 1}) {
+		t.Errorf("Unexpected employer counts %+v", e)
+	}
+	if days[1].Total != 1 || days[2].Total != 0 || days[2].Employers == nil {
+		t.Errorf("Unexpected later days %+v", days[1:])
+	}
+
+	days, err = l.Summarize(day1, day1, "acme")
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if days[0].Total != 2 || len(days[0].Employers) != 1 {
+		t.Errorf("Expected only Acme blocks, got %+v", days[0])
+	}
+}
+
+func TestEvents(t *testing.T) {
+	l, err := Open(Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	record(t, l,
+		Event{Time: start, Domain: "acme.com", Employer: "Acme", ActionID: "strike-1"},
+		Event{Time: start.Add(time.Minute), Domain: "globex.com", Employer: "Globex"},
+		Event{Time: start.Add(2 * time.Minute), Domain: "shop.acme.com", Employer: "Acme"},
+	)
+
+	events, err := l.Events(start, "Acme", 10)
+	if err != nil {
+		t.Fatalf("Events failed: %v", err)
+	}
+	if len(events) != 2 || events[0].Domain != "acme.com" || events[0].ActionID != "strike-1" {
+		t.Fatalf("Unexpected events %+v", events)
+	}
+	if events[0].Client == "" || events[0].Client == "192.0.2.1" {
+		t.Errorf("Expected a hashed client, got %q", events[0].Client)
+	}
+
+	if events, _ := l.Events(start, "", 1); len(events) != 1 {
+		t.Errorf("Expected limit to apply, got %d events", len(events))
+	}
+	if events, err := l.Events(start.AddDate(0, 0, -1), "", 10); err != nil || len(events) != 0 {
+		t.Errorf("Expected no events for an empty day, got %v, %v", events, err)
+	}
+}
+
+func TestSkipsTruncatedLine(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	record(t, l, Event{Time: start, Domain: "acme.com", Employer: "Acme"})
+
+	f, err := os.OpenFile(filepath.Join(dir, "blocks-2026-03-01.jsonl"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"time":"2026-03-01T11:00:00Z","dom`)
+	f.Close()
+
+	days, err := l.Summarize(start, start, "")
+	if err != nil {
+		t.Fatalf("Summarize failed: %v", err)
+	}
+	if days[0].Total != 1 {
+		t.Errorf("Expected the truncated line to be skipped, got %+v", days[0])
+	}
+}
+
+func TestRetention(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(Config{Dir: dir, Retention: 48 * time.Hour})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	start := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	record(t, l,
+		Event{Time: start, Domain: "acme.com"},
+		Event{Time: start.AddDate(0, 0, 1), Domain: "acme.com"},
+		Event{Time: start.AddDate(0, 0, 2), Domain: "acme.com"},
+		Event{Time: start.AddDate(0, 0, 3), Domain: "acme.com"},
+	)
+
+	days, err := l.days()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 3 || !days[0].Equal(day(start.AddDate(0, 0, 1))) {
+		t.Errorf("Expected the first day to be pruned, got %v", days)
+	}
+}
+
+func TestRecordDropsWhenFull(t *testing.T) {
+	l, err := Open(Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	for range queueSize + 5 {
+		l.Record(netip.Addr{}, "acme.com", "Acme", "")
+	}
+	if got := l.Dropped(); got != 5 {
+		t.Errorf("Expected 5 dropped events, got %d", got)
+	}
+}
@@ -0,0 +1,101 @@
+package blocklog
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DaySummary counts the blocked queries of one UTC day.
+type DaySummary struct {
+	Date      string          `json:"date"`
+	Total     int64           `json:"total"`
+	Employers []EmployerCount `json:"employers"`
+}
+
+// EmployerCount is the number of blocked queries for one employer.
+type EmployerCount struct {
+	Employer string `json:"employer"`
+	Count    int64  `json:"count"`
+}
+
+// Summarize returns one summary per day from from to to, inclusive, oldest
+// first. Days without events are included with zero counts. A non-empty
+// employer restricts the counts to that employer (case-insensitive).
+func (l *Log) Summarize(from, to time.Time, employer string) ([]DaySummary, error) {
+	var summaries []DaySummary
+	for d := day(from); !d.After(day(to)); d = d.AddDate(0, 0, 1) {
+		counts := make(map[string]int64)
+		summary := DaySummary{Date: d.Format(fileLayout), Employers: []EmployerCount{}}
+		err := l.scan(d, func(ev Event) bool {
+			if employer == "" || strings.EqualFold(ev.Employer, employer) {
+				counts[ev.Employer]++
+				summary.Total++
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for name, count := range counts {
+			summary.Employers = append(summary.Employers, EmployerCount{Employer: name, Count: count})
+		}
+		sort.Slice(summary.Employers, func(i, j int) bool {
+			if summary.Employers[i].Count != summary.Employers[j].Count {
+				return summary.Employers[i].Count > summary.Employers[j].Count
+			}
+			return summary.Employers[i].Employer < summary.Employers[j].Employer
+		})
+		summaries = append(summaries, summary)
+	}
+	return summaries, nil
+}
+
+// Events returns up to limit events from the UTC day containing d, oldest
+// first. A non-empty employer restricts them to that employer
+// (case-insensitive).
+func (l *Log) Events(d time.Time, employer string, limit int) ([]Event, error) {
+	events := []Event{}
+	err := l.scan(day(d), func(ev Event) bool {
+		if employer == "" || strings.EqualFold(ev.Employer, employer) {
+			events = append(events, ev)
+		}
+		return len(events) < limit
+	})
+	return events, err
+}
+
+// scan calls fn for each event of day d until fn returns false. A missing
+// file means no events. Lines that do not parse, such as one cut short by a
+// crash, are skipped.
+func (l *Log) scan(d time.Time, fn func(Event) bool) error {
+	f, err := os.Open(l.path(d))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading block log: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var ev Event
+		if json.Unmarshal(scanner.Bytes(), &ev) != nil {
+			continue
+		}
+		if !fn(ev) {
+			return nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading block log: %w", err)
+	}
+	return nil
+}
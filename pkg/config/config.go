@@ -4,7 +4,12 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 )
 
@@ -21,21 +26,112 @@ type Config struct {
 
 	// Logging configuration
 	Logging LoggingConfig `json:"logging"`
+
+	// Local policy (allowlist, manual blocks, client groups)
+	Policy PolicyConfig `json:"policy"`
+
+	// Client groups fixed in this file, applied alongside the policy
+	Groups []GroupConfig `json:"groups"`
+
+	// Member organizations served from this process, each with its own
+	// blocklist and stats
+	Tenants []TenantConfig `json:"tenants"`
+
+	// Admin interface configuration
+	Admin AdminConfig `json:"admin"`
+
+	// A listener for Prometheus metrics and profiling apart from the admin
+	// interface
+	Metrics MetricsConfig `json:"metrics"`
+
+	// Serving the blocklist to other resolvers as a response policy zone
+	RPZ RPZConfig `json:"rpz"`
+
+	// OpenTelemetry export configuration
+	Telemetry TelemetryConfig `json:"telemetry"`
+
+	// Alert rules and the webhooks they notify
+	Alerts AlertsConfig `json:"alerts"`
+
+	// Watching this file for changes
+	ConfigWatch ConfigWatchConfig `json:"config_watch"`
+
+	// Centrally managed configuration layered over this file
+	RemoteConfig RemoteConfigConfig `json:"remote_config"`
+
+	// Registering this instance with the OPL backend
+	Registration RegistrationConfig `json:"registration"`
+
+	// Stopping the server
+	Shutdown ShutdownConfig `json:"shutdown"`
 }
 
 // DNSConfig holds DNS server settings.
 type DNSConfig struct {
+	// Enabled controls whether DNS queries are served. Turning it off
+	// leaves the admin interface and stats reporting running, for use
+	// alongside a resolver that is deployed separately.
+	Enabled bool `json:"enabled"`
+
 	// ListenAddr is the address to listen on (e.g., "0.0.0.0:53")
 	ListenAddr string `json:"listen_addr"`
 
 	// UpstreamDNS is the list of upstream DNS servers
-	UpstreamDNS []string `json:"upstream_dns"`
+	UpstreamDNS []UpstreamConfig `json:"upstream_dns"`
 
 	// CacheTTL is how long to cache DNS responses
 	CacheTTL Duration `json:"cache_ttl"`
 
 	// QueryTimeout is the timeout for upstream DNS queries
 	QueryTimeout Duration `json:"query_timeout"`
+
+	// SoftFailureRetries is how many further upstreams to try when one
+	// answers SERVFAIL or REFUSED. 0 returns the first answer as-is.
+	SoftFailureRetries int `json:"soft_failure_retries"`
+
+	// ODoH resolves allowed queries through an Oblivious DoH proxy and
+	// target instead of UpstreamDNS, so no single party sees both the
+	// client and its queries.
+	ODoH ODoHConfig `json:"odoh"`
+
+	// RateLimit limits UDP queries per client network.
+	RateLimit DNSRateLimitConfig `json:"rate_limit"`
+}
+
+// DNSRateLimitConfig holds per-client query rate limiting settings.
+type DNSRateLimitConfig struct {
+	// QueriesPerSecond is the sustained rate allowed per client network.
+	// 0 disables rate limiting.
+	QueriesPerSecond float64 `json:"queries_per_second"`
+
+	// Burst is how many queries a client network may send at once
+	Burst int `json:"burst"`
+
+	// Slip answers every Nth limited query with a truncated reply so real
+	// clients retry over TCP. 0 drops all limited queries.
+	Slip int `json:"slip"`
+
+	// IPv4PrefixLen and IPv6PrefixLen group client addresses into networks
+	// that share one limit
+	IPv4PrefixLen int `json:"ipv4_prefix_len"`
+	IPv6PrefixLen int `json:"ipv6_prefix_len"`
+}
+
+// ODoHConfig holds Oblivious DNS over HTTPS (RFC 9230) upstream settings.
+// ODoH is enabled when both URLs are set.
+type ODoHConfig struct {
+	// ProxyURL is the oblivious proxy endpoint
+	// (e.g., "https://odoh-proxy.example/proxy")
+	ProxyURL string `json:"proxy_url"`
+
+	// TargetURL is the target resolver endpoint
+	// (e.g., "https://odoh-target.example/dns-query")
+	TargetURL string `json:"target_url"`
+}
+
+// Enabled reports whether ODoH upstream resolution is configured.
+func (c ODoHConfig) Enabled() bool {
+	return c.ProxyURL != "" && c.TargetURL != ""
 }
 
 // APIConfig holds Online Picketline API settings.
@@ -44,13 +140,84 @@ type APIConfig struct {
 	BaseURL string `json:"base_url"`
 
 	// APIKey is the API key for authentication
-	APIKey string `json:"api_key"`
+	APIKey string `json:"api_key" secret:"true"`
 
 	// RefreshInterval is how often to refresh the blocklist
 	RefreshInterval Duration `json:"refresh_interval"`
 
 	// Timeout is the HTTP request timeout
 	Timeout Duration `json:"timeout"`
+
+	// ProxyURL routes API traffic (including the stream and stats reports)
+	// through an http://, https://, or socks5:// proxy. Empty honors the
+	// HTTP_PROXY, HTTPS_PROXY, and NO_PROXY environment variables.
+	ProxyURL string `json:"proxy_url" secret:"password"`
+
+	// CAFile is a PEM bundle trusted in addition to the system roots, for
+	// networks with a TLS-inspecting proxy.
+	CAFile string `json:"ca_file"`
+
+	// ClientCertFile and ClientKeyFile are a PEM client certificate and key
+	// presented on TLS connections that require one.
+	ClientCertFile string `json:"client_cert_file"`
+	ClientKeyFile  string `json:"client_key_file"`
+
+	// RetryMaxAttempts is the number of attempts per blocklist fetch,
+	// including the first, for both the initial load and each refresh.
+	RetryMaxAttempts int `json:"retry_max_attempts"`
+
+	// RetryInitialBackoff is the delay before the first retry; it doubles
+	// on each further retry up to RetryMaxBackoff, with jitter.
+	RetryInitialBackoff Duration `json:"retry_initial_backoff"`
+
+	// RetryMaxBackoff caps the delay between retries
+	RetryMaxBackoff Duration `json:"retry_max_backoff"`
+
+	// IncludeActionTypes limits enforcement to these action types
+	// (e.g. ["strike", "lockout"]). Empty enforces all action types.
+	IncludeActionTypes []string `json:"include_action_types"`
+
+	// MinStatus drops actions whose status ranks below it
+	// (resolved < planned < active). Empty enforces all statuses except
+	// resolved, which is never enforced.
+	MinStatus string `json:"min_status"`
+
+	// Regions limits enforcement to actions in these ISO 3166 region codes
+	// (e.g. ["PT"] or ["US-CA"]). Actions with no region or location are
+	// global and always enforced.
+	Regions []string `json:"regions"`
+
+	// Locations limits enforcement to actions whose location text contains
+	// one of these strings (e.g. ["Lisbon", "Portugal"]).
+	Locations []string `json:"locations"`
+
+	// DeltaUpdates fetches only changed employers from /blocklist/diff on
+	// refresh instead of downloading the whole list. Falls back to full
+	// fetches when the backend does not support diffs.
+	DeltaUpdates bool `json:"delta_updates"`
+
+	// StreamEnabled opens a WebSocket to the API for real-time blocklist
+	// updates. Periodic refreshes continue and take over whenever the
+	// stream is disconnected.
+	StreamEnabled bool `json:"stream_enabled"`
+
+	// StreamURL overrides the WebSocket endpoint.
+	// Defaults to {api.base_url}/blocklist/stream with a ws:// or wss:// scheme
+	StreamURL string `json:"stream_url"`
+
+	// Versions keeps recently fetched blocklists on disk so the admin API
+	// can roll back to one or pin it
+	Versions BlocklistVersionsConfig `json:"versions"`
+}
+
+// BlocklistVersionsConfig holds blocklist version history settings.
+type BlocklistVersionsConfig struct {
+	// Dir holds the kept blocklists. Empty disables version history,
+	// rollback and pinning.
+	Dir string `json:"dir"`
+
+	// Keep is how many versions are kept, besides a pinned one
+	Keep int `json:"keep"`
 }
 
 // LoggingConfig holds logging settings.
@@ -60,6 +227,41 @@ type LoggingConfig struct {
 
 	// Format is the log format (json, text)
 	Format string `json:"format"`
+
+	// Stdout writes logs to standard output
+	Stdout bool `json:"stdout"`
+
+	// File also appends logs to this file, for devices whose standard
+	// output is lost on reboot. Empty disables file logging.
+	File string `json:"file"`
+
+	// MaxSizeMB rotates the log file when it would grow past this many
+	// megabytes. 0 disables rotation by size.
+	MaxSizeMB int `json:"max_size_mb"`
+
+	// MaxAge rotates the log file once it has been written to for this
+	// long (e.g., "24h"). 0 disables rotation by age.
+	MaxAge Duration `json:"max_age"`
+
+	// MaxBackups is how many rotated log files are kept, as file.1 (newest)
+	// to file.N
+	MaxBackups int `json:"max_backups"`
+
+	// Syslog also sends logs to syslog
+	Syslog SyslogConfig `json:"syslog"`
+}
+
+// SyslogConfig holds syslog output settings.
+type SyslogConfig struct {
+	// Enabled sends logs to syslog
+	Enabled bool `json:"enabled"`
+
+	// Address is a remote syslog server as udp://host:514 or
+	// tcp://host:514. Empty uses the local syslog daemon.
+	Address string `json:"address"`
+
+	// Tag identifies the messages (default "opl-dns")
+	Tag string `json:"tag"`
 }
 
 // StatsConfig holds stats reporting settings.
@@ -71,14 +273,301 @@ type StatsConfig struct {
 	ReportInterval Duration `json:"report_interval"`
 
 	// InstanceID is a unique identifier for this DNS server instance.
-	// If empty, the hostname will be used.
+	// If empty, the hostname will be used, or a hash of it when Privacy is
+	// not "full".
 	InstanceID string `json:"instance_id"`
 
+	// Privacy limits what stats reports include: "full" sends everything
+	// enabled, "anonymized" hides the hostname, and "aggregate-only"
+	// also leaves out top blocked domains and per-client counts.
+	Privacy string `json:"privacy"`
+
 	// ReportURL is the URL to POST stats reports to.
 	// Defaults to {api.base_url}/dns-stats/report
 	ReportURL string `json:"report_url"`
+
+	// StateFile is where counters are saved so lifetime totals and report
+	// deltas survive restarts. Empty keeps them in memory only.
+	StateFile string `json:"state_file"`
+
+	// CheckpointInterval is how often counters are saved to StateFile. They
+	// are also saved on shutdown.
+	CheckpointInterval Duration `json:"checkpoint_interval"`
+
+	// MaxBlockedDomains bounds how many distinct blocked domains are
+	// counted for the top blocked domains. Once full, rarely blocked
+	// domains make way for new ones.
+	MaxBlockedDomains int `json:"max_blocked_domains"`
+
+	// Clients controls per-client query counts
+	Clients ClientStatsConfig `json:"clients"`
+
+	// ReportContent selects what stats reports include
+	ReportContent ReportContentConfig `json:"report_content"`
+
+	// Signing signs reports so the backend can authenticate this instance
+	Signing StatsSigningConfig `json:"signing"`
+
+	// BlockHistory keeps individual block events on disk for the admin
+	// history API
+	BlockHistory BlockHistoryConfig `json:"block_history"`
+}
+
+// ReportContentConfig trims or enriches stats reports, within what Privacy
+// allows.
+type ReportContentConfig struct {
+	// TopDomains, TopEmployers and TopClients are how many entries each
+	// top list holds
+	TopDomains   int `json:"top_domains"`
+	TopEmployers int `json:"top_employers"`
+	TopClients   int `json:"top_clients"`
+
+	// Exclude lists report fields to leave out, by their JSON name
+	// (e.g., "queryTypes")
+	Exclude []string `json:"exclude"`
+
+	// Labels are sent with every report (e.g., {"site": "hq", "region": "PT"})
+	Labels map[string]string `json:"labels"`
 }
 
+// StatsSigningConfig holds stats report signing settings. Reports are
+// signed when Algorithm is set.
+type StatsSigningConfig struct {
+	// Algorithm is "hmac-sha256" or "ed25519"
+	Algorithm string `json:"algorithm"`
+
+	// KeyFile holds the HMAC secret or the PEM-encoded Ed25519 private key
+	KeyFile string `json:"key_file"`
+}
+
+// BlockHistoryConfig holds block event history settings.
+type BlockHistoryConfig struct {
+	// Dir holds one file of block events per day. Empty disables the
+	// history.
+	Dir string `json:"dir"`
+
+	// Retention is how long block events are kept
+	Retention Duration `json:"retention"`
+}
+
+// ClientStatsConfig holds per-client query statistics settings. The counts
+// are shown on the admin dashboard.
+type ClientStatsConfig struct {
+	// Enabled controls whether queries are counted per client
+	Enabled bool `json:"enabled"`
+
+	// MaxClients bounds how many clients are tracked; the least active
+	// client is dropped when a new one arrives
+	MaxClients int `json:"max_clients"`
+
+	// Anonymize records a hash of each client address instead of the
+	// address. Hashes change when the server restarts.
+	Anonymize bool `json:"anonymize"`
+
+	// Report includes the top clients, hashed, in the stats report
+	Report bool `json:"report"`
+}
+
+// PolicyConfig holds local policy settings.
+type PolicyConfig struct {
+	// StateFile is where the allowlist, manual blocks, and client groups
+	// edited through the admin UI are stored. It is kept separate from this
+	// config file. Empty disables local policy other than the groups
+	// section.
+	StateFile string `json:"state_file"`
+}
+
+// AdminConfig holds admin interface settings.
+type AdminConfig struct {
+	// Enabled controls whether the admin interface is served
+	Enabled bool `json:"enabled"`
+
+	// ListenAddr is the address to listen on, or "unix:" followed by a
+	// socket path. Keep it on localhost or a management network; it is
+	// never exposed to DNS clients.
+	ListenAddr string `json:"listen_addr"`
+
+	// AuthToken is required on every admin request, as a bearer token or
+	// as the HTTP basic auth password.
+	AuthToken string `json:"auth_token" secret:"true"`
+
+	// RateLimitPerMinute limits requests per client IP to the authenticated
+	// endpoints. 0 disables the limit.
+	RateLimitPerMinute int `json:"rate_limit_per_minute"`
+
+	// HealthStaleAfter is how old the blocklist may get before /health
+	// reports "degraded". 0 disables the check.
+	HealthStaleAfter Duration `json:"health_stale_after"`
+
+	// Debug serves Go profiling data under /debug/pprof/ and runtime
+	// variables (goroutines, heap and GC statistics) at /debug/vars.
+	Debug bool `json:"debug"`
+
+	// PiholeAPIToken, if set, serves a subset of the Pi-hole admin API at
+	// /admin/api.php for Pi-hole dashboards and apps, which send it as the
+	// auth query parameter. It must differ from AuthToken, since it
+	// travels in URLs.
+	PiholeAPIToken string `json:"pihole_api_token" secret:"true"`
+}
+
+// MetricsConfig holds settings for serving Prometheus metrics and the debug
+// endpoints on their own listener.
+type MetricsConfig struct {
+	// ListenAddr, if set, serves /metrics, and the debug endpoints when
+	// admin.debug is on, here instead of on the admin listener. A
+	// host:port or "unix:" followed by a socket path.
+	ListenAddr string `json:"listen_addr"`
+
+	// AuthToken, if set, must be presented as for the admin interface. It
+	// may only be left empty on a loopback address or a Unix socket.
+	AuthToken string `json:"auth_token" secret:"true"`
+}
+
+// TelemetryConfig holds OpenTelemetry export settings. Export is enabled
+// when OTLPEndpoint is set.
+type TelemetryConfig struct {
+	// OTLPEndpoint is the base URL of an OTLP/HTTP collector
+	// (e.g., "http://otel-collector:4318")
+	OTLPEndpoint string `json:"otlp_endpoint"`
+
+	// Headers are sent with every export, e.g. for collector authentication
+	Headers map[string]string `json:"headers" secret:"true"`
+
+	// Metrics and Traces select which signals are exported
+	Metrics bool `json:"metrics"`
+	Traces  bool `json:"traces"`
+
+	// MetricInterval is how often metrics are pushed
+	MetricInterval Duration `json:"metric_interval"`
+
+	// TraceSampleRatio is the fraction of queries traced, from 0 to 1
+	TraceSampleRatio float64 `json:"trace_sample_ratio"`
+}
+
+// AlertsConfig holds alerting settings. Alerting is enabled when there are
+// rules.
+type AlertsConfig struct {
+	// CheckInterval is how often rules are checked
+	CheckInterval Duration `json:"check_interval"`
+
+	// RepeatInterval is how often a rule that keeps firing is notified
+	// again. Zero notifies only when it starts and stops firing.
+	RepeatInterval Duration `json:"repeat_interval"`
+
+	// Rules are the conditions to alert on
+	Rules []AlertRuleConfig `json:"rules"`
+
+	// Webhooks receive a message when a rule starts or stops firing
+	Webhooks []WebhookConfig `json:"webhooks"`
+}
+
+// AlertRuleConfig is one alert condition.
+type AlertRuleConfig struct {
+	// Name identifies the rule in messages
+	Name string `json:"name"`
+
+	// Metric is "servfail_rate", "blocklist_age" or "upstream_down"
+	Metric string `json:"metric"`
+
+	// Threshold is the SERVFAIL fraction (e.g., 0.05) for servfail_rate
+	Threshold float64 `json:"threshold,omitempty"`
+
+	// MaxAge is the oldest acceptable blocklist for blocklist_age
+	MaxAge Duration `json:"max_age,omitzero"`
+}
+
+// ConfigWatchConfig holds settings for applying configuration file edits
+// automatically, as a SIGHUP would.
+type ConfigWatchConfig struct {
+	// Enabled turns on watching the configuration file
+	Enabled bool `json:"enabled"`
+
+	// PollInterval is how often the file is checked for changes
+	PollInterval Duration `json:"poll_interval"`
+
+	// Debounce is how long the file must stay unchanged before it is
+	// applied, so that partial writes are not read
+	Debounce Duration `json:"debounce"`
+}
+
+// RemoteConfigConfig holds settings for fetching configuration from a
+// central server. The fetched document uses the same format as this file and
+// is layered over it.
+type RemoteConfigConfig struct {
+	// URL serves the configuration document. Empty disables remote
+	// configuration.
+	URL string `json:"url"`
+
+	// APIKey is sent in the X-API-Key header
+	APIKey string `json:"api_key" secret:"true"`
+
+	// PublicKeyFile holds the PEM Ed25519 public key documents must be
+	// signed with
+	PublicKeyFile string `json:"public_key_file"`
+
+	// CacheFile keeps the last applied document for starting offline
+	CacheFile string `json:"cache_file"`
+
+	// RefreshInterval is how often the document is fetched again. Zero
+	// fetches only at startup.
+	RefreshInterval Duration `json:"refresh_interval"`
+}
+
+// RegistrationConfig holds settings for registering this instance with the
+// OPL backend, which issues its API key and instance ID.
+type RegistrationConfig struct {
+	// Enabled registers the instance on first start, and uses the issued
+	// credentials in place of api.api_key and stats.instance_id
+	Enabled bool `json:"enabled"`
+
+	// URL overrides the registration endpoint, by default
+	// api.base_url + "/dns-instances/register"
+	URL string `json:"url"`
+
+	// EnrollmentToken authorizes the registration, if the backend asks for
+	// one
+	EnrollmentToken string `json:"enrollment_token" secret:"true"`
+
+	// Contact is how the backend reaches the operator, such as an email
+	// address
+	Contact string `json:"contact"`
+
+	// StateFile keeps the issued credentials. The instance registers again
+	// if it is removed.
+	StateFile string `json:"state_file"`
+
+	// KeyFile holds the instance's Ed25519 private key, created when the
+	// instance registers. Stats reports are signed with it unless
+	// stats.signing is set.
+	KeyFile string `json:"key_file"`
+}
+
+// ShutdownConfig holds settings for stopping the server.
+type ShutdownConfig struct {
+	// Timeout is how long queries and admin requests in flight get to
+	// finish once the server stops accepting new ones
+	Timeout Duration `json:"timeout"`
+}
+
+// WebhookConfig is where alert messages are sent.
+type WebhookConfig struct {
+	// URL receives a POST per message
+	URL string `json:"url" secret:"url"`
+
+	// Format is "json", "slack" or "ntfy"
+	Format string `json:"format"`
+
+	// Headers are sent with every message, e.g. for authentication
+	Headers map[string]string `json:"headers,omitempty" secret:"true"`
+}
+
+// MinReportInterval is the shortest stats.report_interval accepted.
+const MinReportInterval = 10 * time.Second
+
+// regionCodePattern matches ISO 3166-1 alpha-2 country codes with an optional
+// ISO 3166-2 subdivision suffix.
+var regionCodePattern = regexp.MustCompile(`^[A-Za-z]{2}(-[A-Za-z0-9]{1,3})?$`)
+
 // Duration is a wrapper for time.Duration that supports JSON marshaling.
 type Duration struct {
 	time.Duration
@@ -115,86 +604,182 @@ func (d *Duration) UnmarshalJSON(b []byte) error {
 func DefaultConfig() *Config {
 	return &Config{
 		DNS: DNSConfig{
-			ListenAddr:   "0.0.0.0:53",
-			UpstreamDNS:  []string{"8.8.8.8:53", "8.8.4.4:53"},
-			CacheTTL:     Duration{5 * time.Minute},
-			QueryTimeout: Duration{5 * time.Second},
+			Enabled:            true,
+			ListenAddr:         "0.0.0.0:53",
+			UpstreamDNS:        Upstreams("8.8.8.8:53", "8.8.4.4:53"),
+			CacheTTL:           Duration{5 * time.Minute},
+			QueryTimeout:       Duration{5 * time.Second},
+			SoftFailureRetries: 1,
+			RateLimit: DNSRateLimitConfig{
+				QueriesPerSecond: 0,
+				Burst:            100,
+				Slip:             2,
+				IPv4PrefixLen:    24,
+				IPv6PrefixLen:    56,
+			},
 		},
 		API: APIConfig{
-			BaseURL:         "https://onlinepicketline.com/api",
-			APIKey:          "",
-			RefreshInterval: Duration{15 * time.Minute},
-			Timeout:         Duration{10 * time.Second},
+			BaseURL:             "https://onlinepicketline.com/api",
+			APIKey:              "",
+			RefreshInterval:     Duration{15 * time.Minute},
+			Timeout:             Duration{10 * time.Second},
+			ProxyURL:            "",
+			CAFile:              "",
+			ClientCertFile:      "",
+			ClientKeyFile:       "",
+			RetryMaxAttempts:    10,
+			RetryInitialBackoff: Duration{3 * time.Second},
+			RetryMaxBackoff:     Duration{30 * time.Second},
+			IncludeActionTypes:  []string{},
+			MinStatus:           "",
+			Regions:             []string{},
+			Locations:           []string{},
+			DeltaUpdates:        true,
+			StreamEnabled:       false,
+			StreamURL:           "",
+			Versions: BlocklistVersionsConfig{
+				Dir:  "",
+				Keep: 5,
+			},
 		},
 		Stats: StatsConfig{
-			Enabled:        false,
-			ReportInterval: Duration{5 * time.Minute},
-			InstanceID:     "",
-			ReportURL:      "",
+			Enabled:            false,
+			ReportInterval:     Duration{5 * time.Minute},
+			InstanceID:         "",
+			Privacy:            "full",
+			ReportURL:          "",
+			StateFile:          "",
+			CheckpointInterval: Duration{time.Minute},
+			MaxBlockedDomains:  10000,
+			Clients: ClientStatsConfig{
+				Enabled:    false,
+				MaxClients: 1000,
+				Anonymize:  false,
+				Report:     false,
+			},
+			ReportContent: ReportContentConfig{
+				TopDomains:   10,
+				TopEmployers: 10,
+				TopClients:   10,
+				Exclude:      []string{},
+				Labels:       map[string]string{},
+			},
+			Signing: StatsSigningConfig{
+				Algorithm: "",
+				KeyFile:   "",
+			},
+			BlockHistory: BlockHistoryConfig{
+				Dir:       "",
+				Retention: Duration{30 * 24 * time.Hour},
+			},
 		},
 		Logging: LoggingConfig{
-			Level:  "info",
-			Format: "text",
+			Level:      "info",
+			Format:     "text",
+			Stdout:     true,
+			MaxSizeMB:  10,
+			MaxBackups: 3,
+			Syslog: SyslogConfig{
+				Tag: "opl-dns",
+			},
+		},
+		Policy: PolicyConfig{
+			StateFile: "",
+		},
+		Groups:  []GroupConfig{},
+		Tenants: []TenantConfig{},
+		Admin: AdminConfig{
+			Enabled:            false,
+			ListenAddr:         "127.0.0.1:8081",
+			AuthToken:          "",
+			RateLimitPerMinute: 300,
+			HealthStaleAfter:   Duration{time.Hour},
+			PiholeAPIToken:     "",
+		},
+		Metrics: MetricsConfig{
+			ListenAddr: "",
+			AuthToken:  "",
+		},
+		RPZ: RPZConfig{
+			Enabled:       false,
+			ListenAddr:    "127.0.0.1:5300",
+			Zone:          "opl.rpz",
+			Action:        "null",
+			TTL:           Duration{time.Minute},
+			AllowTransfer: []string{"127.0.0.1", "::1"},
+			TSIGKeys:      []TSIGKeyConfig{},
+			Notify:        []string{},
+			JournalSize:   64,
+		},
+		Telemetry: TelemetryConfig{
+			OTLPEndpoint:     "",
+			Headers:          map[string]string{},
+			Metrics:          true,
+			Traces:           true,
+			MetricInterval:   Duration{time.Minute},
+			TraceSampleRatio: 0.1,
+		},
+		Alerts: AlertsConfig{
+			CheckInterval:  Duration{time.Minute},
+			RepeatInterval: Duration{time.Hour},
+			Rules:          []AlertRuleConfig{},
+			Webhooks:       []WebhookConfig{},
+		},
+		ConfigWatch: ConfigWatchConfig{
+			Enabled:      false,
+			PollInterval: Duration{5 * time.Second},
+			Debounce:     Duration{2 * time.Second},
+		},
+		RemoteConfig: RemoteConfigConfig{
+			URL:             "",
+			RefreshInterval: Duration{time.Hour},
+		},
+		Registration: RegistrationConfig{
+			Enabled: false,
+		},
+		Shutdown: ShutdownConfig{
+			Timeout: Duration{10 * time.Second},
 		},
 	}
 }
 
-// Load loads configuration from a JSON file.
+// Load loads configuration from a JSON file and the files it includes.
 func Load(path string) (*Config, error) {
 	cfg := DefaultConfig()
 
-	data, err := os.ReadFile(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return cfg, nil // Return defaults if config doesn't exist
+	// A missing file leaves the defaults, which the environment may still
+	// override
+	if _, err := os.Stat(path); err == nil {
+		err := readLayers(path, func(path string, data []byte) error {
+			if err := json.Unmarshal(data, cfg); err != nil {
+				return fmt.Errorf("parsing config file %s: %w", path, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
 		}
+	} else if !os.IsNotExist(err) {
 		return nil, fmt.Errorf("reading config file: %w", err)
 	}
 
-	if err := json.Unmarshal(data, cfg); err != nil {
-		return nil, fmt.Errorf("parsing config file: %w", err)
-	}
-
 	// Apply environment variable overrides
-	cfg.applyEnvOverrides()
+	if err := cfg.applyEnvOverrides(); err != nil {
+		return nil, err
+	}
 
 	return cfg, nil
 }
 
-// applyEnvOverrides applies environment variable overrides to the config.
-// This allows Docker deployments to configure settings via environment variables.
-func (c *Config) applyEnvOverrides() {
-	// DNS settings
-	if v := os.Getenv("DNS_LISTEN_ADDR"); v != "" {
-		c.DNS.ListenAddr = v
-	}
-
-	// API settings
-	if v := os.Getenv("OPL_API_BASE_URL"); v != "" {
-		c.API.BaseURL = v
-	}
-	if v := os.Getenv("OPL_API_KEY"); v != "" {
-		c.API.APIKey = v
-	}
-
-	// Logging settings
-	if v := os.Getenv("LOG_LEVEL"); v != "" {
-		c.Logging.Level = v
-	}
-	if v := os.Getenv("LOG_FORMAT"); v != "" {
-		c.Logging.Format = v
-	}
-
-	// Stats settings
-	if v := os.Getenv("STATS_ENABLED"); v == "true" || v == "1" {
-		c.Stats.Enabled = true
-	}
-	if v := os.Getenv("STATS_INSTANCE_ID"); v != "" {
-		c.Stats.InstanceID = v
-	}
-	if v := os.Getenv("STATS_REPORT_URL"); v != "" {
-		c.Stats.ReportURL = v
+// Layer applies the settings in data, a configuration document in the file
+// format, over c. Settings data leaves out keep their values; objects are
+// merged and lists replaced. Environment overrides are applied again so
+// they still win over every layer.
+func (c *Config) Layer(data []byte) error {
+	if err := json.Unmarshal(data, c); err != nil {
+		return err
 	}
+	return c.applyEnvOverrides()
 }
 
 // Save saves the configuration to a JSON file.
@@ -213,14 +798,325 @@ func (c *Config) Save(path string) error {
 
 // Validate validates the configuration.
 func (c *Config) Validate() error {
-	if c.DNS.ListenAddr == "" {
+	if !c.DNS.Enabled && !c.Admin.Enabled && !c.Stats.Enabled {
+		return fmt.Errorf("at least one of dns.enabled, admin.enabled and stats.enabled must be true")
+	}
+	if c.DNS.Enabled && c.DNS.ListenAddr == "" {
 		return fmt.Errorf("dns.listen_addr is required")
 	}
-	if len(c.DNS.UpstreamDNS) == 0 {
+	if (c.DNS.ODoH.ProxyURL == "") != (c.DNS.ODoH.TargetURL == "") {
+		return fmt.Errorf("dns.odoh.proxy_url and dns.odoh.target_url must be set together")
+	}
+	if c.DNS.ODoH.Enabled() {
+		proxy, err := url.Parse(c.DNS.ODoH.ProxyURL)
+		if err != nil || proxy.Scheme != "https" || proxy.Host == "" {
+			return fmt.Errorf("dns.odoh.proxy_url must be an https:// URL")
+		}
+		target, err := url.Parse(c.DNS.ODoH.TargetURL)
+		if err != nil || target.Scheme != "https" || target.Host == "" {
+			return fmt.Errorf("dns.odoh.target_url must be an https:// URL")
+		}
+		if proxy.Host == target.Host {
+			return fmt.Errorf("dns.odoh.proxy_url and dns.odoh.target_url must be different hosts")
+		}
+	} else if len(c.DNS.UpstreamDNS) == 0 {
 		return fmt.Errorf("dns.upstream_dns is required")
 	}
+	for _, u := range c.DNS.UpstreamDNS {
+		if err := u.validate(); err != nil {
+			return err
+		}
+	}
+	if c.DNS.QueryTimeout.Duration <= 0 {
+		return fmt.Errorf("dns.query_timeout must be positive, e.g. \"5s\" (got %s)", c.DNS.QueryTimeout)
+	}
+	if c.DNS.CacheTTL.Duration < 0 {
+		return fmt.Errorf("dns.cache_ttl must not be negative (got %s)", c.DNS.CacheTTL)
+	}
+	if c.DNS.SoftFailureRetries < 0 {
+		return fmt.Errorf("dns.soft_failure_retries must not be negative")
+	}
+	if c.DNS.RateLimit.QueriesPerSecond < 0 {
+		return fmt.Errorf("dns.rate_limit.queries_per_second must not be negative; use 0 to disable rate limiting")
+	}
+	if rl := c.DNS.RateLimit; rl.QueriesPerSecond > 0 {
+		if rl.Burst < 1 {
+			return fmt.Errorf("dns.rate_limit.burst must be at least 1")
+		}
+		if rl.Slip < 0 {
+			return fmt.Errorf("dns.rate_limit.slip must not be negative")
+		}
+		if rl.IPv4PrefixLen < 1 || rl.IPv4PrefixLen > 32 {
+			return fmt.Errorf("dns.rate_limit.ipv4_prefix_len must be between 1 and 32")
+		}
+		if rl.IPv6PrefixLen < 1 || rl.IPv6PrefixLen > 128 {
+			return fmt.Errorf("dns.rate_limit.ipv6_prefix_len must be between 1 and 128")
+		}
+	}
+	if !c.Logging.Stdout && c.Logging.File == "" && !c.Logging.Syslog.Enabled {
+		return fmt.Errorf("at least one of logging.stdout, logging.file and logging.syslog.enabled must be set")
+	}
+	if c.Logging.MaxSizeMB < 0 || c.Logging.MaxBackups < 0 || c.Logging.MaxAge.Duration < 0 {
+		return fmt.Errorf("logging.max_size_mb, logging.max_age and logging.max_backups must not be negative")
+	}
+	if addr := c.Logging.Syslog.Address; addr != "" {
+		u, err := url.Parse(addr)
+		if err != nil || (u.Scheme != "udp" && u.Scheme != "tcp") || u.Port() == "" {
+			return fmt.Errorf("logging.syslog.address must look like udp://host:514 or tcp://host:514")
+		}
+	}
 	if c.API.BaseURL == "" {
 		return fmt.Errorf("api.base_url is required")
 	}
+	if c.API.ProxyURL != "" {
+		u, err := url.Parse(c.API.ProxyURL)
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("api.proxy_url must be a URL like http://proxy:3128")
+		}
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return fmt.Errorf("api.proxy_url must use http://, https://, or socks5://")
+		}
+	}
+	if (c.API.ClientCertFile == "") != (c.API.ClientKeyFile == "") {
+		return fmt.Errorf("api.client_cert_file and api.client_key_file must be set together")
+	}
+	if c.API.Timeout.Duration <= 0 {
+		return fmt.Errorf("api.timeout must be positive, e.g. \"10s\" (got %s)", c.API.Timeout)
+	}
+	if c.API.RefreshInterval.Duration <= 0 {
+		return fmt.Errorf("api.refresh_interval must be positive, e.g. \"15m\" (got %s)", c.API.RefreshInterval)
+	}
+	if c.API.RefreshInterval.Duration < c.API.Timeout.Duration {
+		return fmt.Errorf("api.refresh_interval (%s) must not be shorter than api.timeout (%s), or a slow fetch overlaps the next one; raise api.refresh_interval or lower api.timeout", c.API.RefreshInterval, c.API.Timeout)
+	}
+	if c.API.RetryMaxAttempts < 1 {
+		return fmt.Errorf("api.retry_max_attempts must be at least 1")
+	}
+	if c.API.RetryMaxAttempts > 1 {
+		if c.API.RetryInitialBackoff.Duration <= 0 {
+			return fmt.Errorf("api.retry_initial_backoff must be positive when api.retry_max_attempts is above 1 (got %s)", c.API.RetryInitialBackoff)
+		}
+		if c.API.RetryMaxBackoff.Duration < c.API.RetryInitialBackoff.Duration {
+			return fmt.Errorf("api.retry_max_backoff (%s) must not be shorter than api.retry_initial_backoff (%s)", c.API.RetryMaxBackoff, c.API.RetryInitialBackoff)
+		}
+	}
+	for _, t := range c.API.IncludeActionTypes {
+		if strings.TrimSpace(t) == "" {
+			return fmt.Errorf("api.include_action_types must not contain empty values")
+		}
+	}
+	switch strings.ToLower(c.API.MinStatus) {
+	case "", "resolved", "ended", "planned", "upcoming", "active":
+	default:
+		return fmt.Errorf("api.min_status must be one of resolved, ended, planned, upcoming, active (got %q)", c.API.MinStatus)
+	}
+	for _, r := range c.API.Regions {
+		if !regionCodePattern.MatchString(r) {
+			return fmt.Errorf("api.regions: %q is not an ISO 3166 code like \"PT\" or \"US-CA\"", r)
+		}
+	}
+	if c.API.StreamURL != "" && !strings.HasPrefix(c.API.StreamURL, "ws://") && !strings.HasPrefix(c.API.StreamURL, "wss://") {
+		return fmt.Errorf("api.stream_url must use ws:// or wss://")
+	}
+	if c.API.Versions.Dir != "" && c.API.Versions.Keep < 2 {
+		return fmt.Errorf("api.versions.keep must be at least 2 so there is a version to roll back to")
+	}
+	if c.Stats.Enabled && c.Stats.ReportInterval.Duration < MinReportInterval {
+		return fmt.Errorf("stats.report_interval must be at least %s so reports don't flood the backend (got %s)", MinReportInterval, c.Stats.ReportInterval)
+	}
+	if c.Stats.StateFile != "" && c.Stats.CheckpointInterval.Duration <= 0 {
+		return fmt.Errorf("stats.checkpoint_interval must be positive when stats.state_file is set")
+	}
+	switch c.Stats.Privacy {
+	case "", "full", "anonymized", "aggregate-only":
+	default:
+		return fmt.Errorf("stats.privacy must be one of full, anonymized, aggregate-only (got %q)", c.Stats.Privacy)
+	}
+	if c.Stats.MaxBlockedDomains < 1 {
+		return fmt.Errorf("stats.max_blocked_domains must be at least 1")
+	}
+	if c.Stats.Clients.Enabled && c.Stats.Clients.MaxClients < 1 {
+		return fmt.Errorf("stats.clients.max_clients must be at least 1")
+	}
+	if rc := c.Stats.ReportContent; rc.TopDomains < 1 || rc.TopEmployers < 1 || rc.TopClients < 1 ||
+		rc.TopDomains > 1000 || rc.TopEmployers > 1000 || rc.TopClients > 1000 {
+		return fmt.Errorf("stats.report_content top list sizes must be between 1 and 1000")
+	}
+	switch c.Stats.Signing.Algorithm {
+	case "":
+	case "hmac-sha256", "ed25519":
+		if c.Stats.Signing.KeyFile == "" {
+			return fmt.Errorf("stats.signing.key_file is required when stats.signing.algorithm is set")
+		}
+	default:
+		return fmt.Errorf("stats.signing.algorithm must be hmac-sha256 or ed25519 (got %q)", c.Stats.Signing.Algorithm)
+	}
+	if c.Stats.BlockHistory.Dir != "" && c.Stats.BlockHistory.Retention.Duration < 24*time.Hour {
+		return fmt.Errorf("stats.block_history.retention must be at least 24h")
+	}
+	if c.Admin.Enabled {
+		if c.Admin.ListenAddr == "" || c.Admin.ListenAddr == "unix:" {
+			return fmt.Errorf("admin.listen_addr is required when admin is enabled")
+		}
+		if c.Admin.AuthToken == "" {
+			return fmt.Errorf("admin.auth_token is required when admin is enabled")
+		}
+		if c.Policy.StateFile == "" {
+			return fmt.Errorf("policy.state_file is required when admin is enabled")
+		}
+		if c.Admin.HealthStaleAfter.Duration < 0 {
+			return fmt.Errorf("admin.health_stale_after must not be negative")
+		}
+		if c.Admin.RateLimitPerMinute < 0 {
+			return fmt.Errorf("admin.rate_limit_per_minute must not be negative; use 0 to disable the limit")
+		}
+		if c.Admin.PiholeAPIToken != "" && c.Admin.PiholeAPIToken == c.Admin.AuthToken {
+			return fmt.Errorf("admin.pihole_api_token must differ from admin.auth_token")
+		}
+	}
+	if m := c.Metrics; m.ListenAddr != "" {
+		if err := validateMetricsAddr(m.ListenAddr, m.AuthToken != ""); err != nil {
+			return fmt.Errorf("metrics.listen_addr %w", err)
+		}
+		// Port 0 picks a free port, so equal addresses do not collide
+		if c.Admin.Enabled && m.ListenAddr == c.Admin.ListenAddr && !strings.HasSuffix(m.ListenAddr, ":0") {
+			return fmt.Errorf("metrics.listen_addr must differ from admin.listen_addr")
+		}
+	}
+	if err := validateRPZ(c.RPZ); err != nil {
+		return err
+	}
+	if r := c.RPZ; r.Enabled && c.DNS.Enabled && r.ListenAddr == c.DNS.ListenAddr && !strings.HasSuffix(r.ListenAddr, ":0") {
+		return fmt.Errorf("rpz.listen_addr must differ from dns.listen_addr")
+	}
+	if t := c.Telemetry; t.OTLPEndpoint != "" {
+		u, err := url.Parse(t.OTLPEndpoint)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("telemetry.otlp_endpoint must be an http:// or https:// URL")
+		}
+		if t.TraceSampleRatio < 0 || t.TraceSampleRatio > 1 {
+			return fmt.Errorf("telemetry.trace_sample_ratio must be between 0 and 1")
+		}
+		if t.Metrics && t.MetricInterval.Duration <= 0 {
+			return fmt.Errorf("telemetry.metric_interval must be positive")
+		}
+	}
+	if a := c.Alerts; len(a.Rules) > 0 {
+		if len(a.Webhooks) == 0 {
+			return fmt.Errorf("alerts.webhooks must not be empty when alerts.rules are set")
+		}
+		if a.CheckInterval.Duration <= 0 {
+			return fmt.Errorf("alerts.check_interval must be positive")
+		}
+		if a.RepeatInterval.Duration < 0 {
+			return fmt.Errorf("alerts.repeat_interval must not be negative")
+		}
+		names := make(map[string]bool)
+		for _, r := range a.Rules {
+			if r.Name == "" {
+				return fmt.Errorf("alerts.rules: every rule needs a name")
+			}
+			if names[r.Name] {
+				return fmt.Errorf("alerts.rules: duplicate rule name %q", r.Name)
+			}
+			names[r.Name] = true
+			switch r.Metric {
+			case "servfail_rate":
+				if r.Threshold <= 0 || r.Threshold > 1 {
+					return fmt.Errorf("alerts.rules: %q threshold must be above 0 and at most 1", r.Name)
+				}
+			case "blocklist_age":
+				if r.MaxAge.Duration <= 0 {
+					return fmt.Errorf("alerts.rules: %q max_age must be positive", r.Name)
+				}
+			case "upstream_down":
+			default:
+				return fmt.Errorf("alerts.rules: %q metric must be one of servfail_rate, blocklist_age, upstream_down (got %q)", r.Name, r.Metric)
+			}
+		}
+		for _, w := range a.Webhooks {
+			u, err := url.Parse(w.URL)
+			if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("alerts.webhooks: url must be an http:// or https:// URL")
+			}
+			switch w.Format {
+			case "json", "slack", "ntfy":
+			default:
+				return fmt.Errorf("alerts.webhooks: format must be one of json, slack, ntfy (got %q)", w.Format)
+			}
+		}
+	}
+
+	if err := validateGroups(c.Groups); err != nil {
+		return err
+	}
+	if err := validateTenants(c.Tenants); err != nil {
+		return err
+	}
+
+	if c.ConfigWatch.Enabled {
+		if c.ConfigWatch.PollInterval.Duration <= 0 {
+			return fmt.Errorf("config_watch.poll_interval must be positive")
+		}
+		if c.ConfigWatch.Debounce.Duration < 0 {
+			return fmt.Errorf("config_watch.debounce must not be negative")
+		}
+	}
+
+	if r := c.RemoteConfig; r.URL != "" {
+		u, err := url.Parse(r.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("remote_config.url must be an http:// or https:// URL")
+		}
+		if r.PublicKeyFile == "" {
+			return fmt.Errorf("remote_config.public_key_file is required when remote_config.url is set")
+		}
+		if r.RefreshInterval.Duration < 0 {
+			return fmt.Errorf("remote_config.refresh_interval must not be negative")
+		}
+	}
+
+	if r := c.Registration; r.Enabled {
+		if r.URL != "" {
+			u, err := url.Parse(r.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("registration.url must be an http:// or https:// URL")
+			}
+		}
+		if r.Contact == "" {
+			return fmt.Errorf("registration.contact is required when registration is enabled")
+		}
+		if r.StateFile == "" || r.KeyFile == "" {
+			return fmt.Errorf("registration.state_file and registration.key_file are required when registration is enabled")
+		}
+	}
+
+	if c.Shutdown.Timeout.Duration <= 0 {
+		return fmt.Errorf("shutdown.timeout must be positive")
+	}
 	return nil
 }
+
+// validateMetricsAddr checks a metrics listen address. Without a token it
+// must be reachable from this host only.
+func validateMetricsAddr(addr string, hasToken bool) error {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		if path == "" {
+			return fmt.Errorf("must name a socket path after unix:")
+		}
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("must be host:port or unix:path")
+	}
+	if hasToken {
+		return nil
+	}
+	if ip, err := netip.ParseAddr(host); (err == nil && ip.IsLoopback()) || host == "localhost" {
+		return nil
+	}
+	return fmt.Errorf("must be a loopback address or Unix socket unless metrics.auth_token is set")
+}
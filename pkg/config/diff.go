@@ -0,0 +1,63 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// Changes lists the settings that differ between old and new, by their JSON
+// path (e.g., "dns.upstream_dns"), sorted. Settings are compared one level
+// into each section, so a change anywhere inside "dns.odoh" is reported as
+// "dns.odoh".
+func Changes(old, new *Config) []string {
+	oldSections, newSections := sections(old), sections(new)
+
+	var changed []string
+	for _, name := range unionKeys(oldSections, newSections) {
+		oldFields, newFields := fields(oldSections[name]), fields(newSections[name])
+		if oldFields == nil || newFields == nil {
+			if !bytes.Equal(oldSections[name], newSections[name]) {
+				changed = append(changed, name)
+			}
+			continue
+		}
+		for _, field := range unionKeys(oldFields, newFields) {
+			if !bytes.Equal(oldFields[field], newFields[field]) {
+				changed = append(changed, name+"."+field)
+			}
+		}
+	}
+	return changed
+}
+
+func sections(c *Config) map[string]json.RawMessage {
+	data, _ := json.Marshal(c)
+	var m map[string]json.RawMessage
+	json.Unmarshal(data, &m)
+	return m
+}
+
+// fields splits a JSON object into its members, or returns nil if raw is
+// not an object.
+func fields(raw json.RawMessage) map[string]json.RawMessage {
+	var m map[string]json.RawMessage
+	if json.Unmarshal(raw, &m) != nil {
+		return nil
+	}
+	return m
+}
+
+func unionKeys(a, b map[string]json.RawMessage) []string {
+	var keys []string
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
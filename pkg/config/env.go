@@ -0,0 +1,187 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix starts the name of every environment variable that overrides a
+// setting. The rest of the name is the setting's JSON path in upper case,
+// with sections joined by underscores: dns.upstream_dns is
+// OPL_DNS_UPSTREAM_DNS.
+const EnvPrefix = "OPL_"
+
+// legacyEnv maps the environment variables supported before every setting
+// had one to their current names. The current name wins when both are set.
+var legacyEnv = map[string]string{
+	"OPL_DNS_LISTEN_ADDR":         "DNS_LISTEN_ADDR",
+	"OPL_API_API_KEY":             "OPL_API_KEY",
+	"OPL_LOGGING_LEVEL":           "LOG_LEVEL",
+	"OPL_LOGGING_FORMAT":          "LOG_FORMAT",
+	"OPL_STATS_ENABLED":           "STATS_ENABLED",
+	"OPL_STATS_INSTANCE_ID":       "STATS_INSTANCE_ID",
+	"OPL_STATS_REPORT_URL":        "STATS_REPORT_URL",
+	"OPL_ADMIN_AUTH_TOKEN":        "OPL_ADMIN_TOKEN",
+	"OPL_TELEMETRY_OTLP_ENDPOINT": "OTEL_EXPORTER_OTLP_ENDPOINT",
+}
+
+// EnvVar is an environment variable that overrides a setting.
+type EnvVar struct {
+	// Name is the variable name, e.g. "OPL_DNS_UPSTREAM_DNS"
+	Name string
+
+	// Key is the setting's JSON path, e.g. "dns.upstream_dns"
+	Key string
+
+	// Alias is an older name also accepted, if any
+	Alias string
+}
+
+// EnvVars lists the environment variables that override settings, in
+// configuration file order.
+func EnvVars() []EnvVar {
+	var vars []EnvVar
+	walkSettings(reflect.ValueOf(&Config{}).Elem(), "", func(_ reflect.Value, key string) error {
+		name := envName(key)
+		vars = append(vars, EnvVar{Name: name, Key: key, Alias: legacyEnv[name]})
+		return nil
+	})
+	return vars
+}
+
+// applyEnvOverrides applies environment variable overrides to the config.
+// This allows container deployments to configure any setting without a
+// configuration file. Empty variables are ignored.
+func (c *Config) applyEnvOverrides() error {
+	return c.applyEnv(os.LookupEnv)
+}
+
+func (c *Config) applyEnv(lookup func(string) (string, bool)) error {
+	return walkSettings(reflect.ValueOf(c).Elem(), "", func(field reflect.Value, key string) error {
+		name := envName(key)
+		value, _ := lookup(name)
+		if value == "" && legacyEnv[name] != "" {
+			name = legacyEnv[name]
+			value, _ = lookup(name)
+		}
+		if value == "" {
+			return nil
+		}
+		if err := parseSetting(field, value); err != nil {
+			return fmt.Errorf("environment variable %s: %w", name, err)
+		}
+		return nil
+	})
+}
+
+func envName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// walkSettings calls visit for every setting below v, a struct, with its
+// JSON path. Nested sections are walked rather than visited; Duration
+// counts as a setting.
+func walkSettings(v reflect.Value, prefix string, visit func(field reflect.Value, key string) error) error {
+	t := v.Type()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct && field.Type() != reflect.TypeFor[Duration]() {
+			if err := walkSettings(field, key+".", visit); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := visit(field, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseSetting parses value into field. Lists are comma-separated and maps
+// are comma-separated key=value pairs; either may also be given as JSON,
+// which is the only form for lists of objects such as alerts.rules. List
+// items with a short text form, such as upstreams, may use it.
+func parseSetting(field reflect.Value, value string) error {
+	if d, ok := field.Addr().Interface().(*Duration); ok {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		d.Duration = parsed
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", value)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected an integer, got %q", value)
+		}
+		field.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", value)
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		elem := field.Type().Elem()
+		textual := elem.Kind() == reflect.String || reflect.PointerTo(elem).Implements(reflect.TypeFor[encoding.TextUnmarshaler]())
+		if !textual || strings.HasPrefix(value, "[") {
+			return json.Unmarshal([]byte(value), field.Addr().Interface())
+		}
+		items := reflect.MakeSlice(field.Type(), 0, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			v := reflect.New(elem).Elem()
+			if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+				if err := u.UnmarshalText([]byte(item)); err != nil {
+					return err
+				}
+			} else {
+				v.SetString(item)
+			}
+			items = reflect.Append(items, v)
+		}
+		field.Set(items)
+	case reflect.Map:
+		if field.Type().Elem().Kind() != reflect.String || strings.HasPrefix(value, "{") {
+			return json.Unmarshal([]byte(value), field.Addr().Interface())
+		}
+		m := reflect.MakeMap(field.Type())
+		for _, pair := range strings.Split(value, ",") {
+			k, v, ok := strings.Cut(pair, "=")
+			if !ok || strings.TrimSpace(k) == "" {
+				return fmt.Errorf("expected key=value pairs, got %q", pair)
+			}
+			m.SetMapIndex(reflect.ValueOf(strings.TrimSpace(k)), reflect.ValueOf(strings.TrimSpace(v)))
+		}
+		field.Set(m)
+	default:
+		return json.Unmarshal([]byte(value), field.Addr().Interface())
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"flag"
+	"reflect"
+	"strings"
+)
+
+// settingFlag is a command-line flag that overrides one setting. The value
+// is checked when the flag is parsed and applied by ApplyFlags.
+type settingFlag struct {
+	key   string
+	typ   reflect.Type
+	value string
+}
+
+func (f *settingFlag) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *settingFlag) Set(value string) error {
+	if err := parseSetting(reflect.New(f.typ).Elem(), value); err != nil {
+		return err
+	}
+	f.value = value
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be given without a value, as
+// -stats.enabled.
+func (f *settingFlag) IsBoolFlag() bool {
+	return f.typ.Kind() == reflect.Bool
+}
+
+// flagName returns the flag for a setting's JSON path: dns.listen_addr is
+// -dns.listen-addr.
+func flagName(key string) string {
+	return strings.ReplaceAll(key, "_", "-")
+}
+
+// RegisterFlags defines a flag on fs for every setting. Values take the same
+// forms as environment variables.
+func RegisterFlags(fs *flag.FlagSet) {
+	walkSettings(reflect.ValueOf(&Config{}).Elem(), "", func(field reflect.Value, key string) error {
+		fs.Var(&settingFlag{key: key, typ: field.Type()}, flagName(key), "Override the "+key+" setting")
+		return nil
+	})
+}
+
+// ApplyFlags applies the settings flags given on fs's command line. Flags
+// are applied after the configuration file and environment, so they win.
+func (c *Config) ApplyFlags(fs *flag.FlagSet) error {
+	given := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		if sf, ok := f.Value.(*settingFlag); ok {
+			given[sf.key] = sf.value
+		}
+	})
+	if len(given) == 0 {
+		return nil
+	}
+	return walkSettings(reflect.ValueOf(c).Elem(), "", func(field reflect.Value, key string) error {
+		if value, ok := given[key]; ok {
+			return parseSetting(field, value)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// Group modes.
+const (
+	// GroupModeEnforce applies the blocklist to the group's clients
+	GroupModeEnforce = "enforce"
+
+	// GroupModeOff exempts the group's clients from all blocking
+	GroupModeOff = "off"
+)
+
+// GroupConfig applies policy to clients by source address. Groups defined
+// here sit alongside those in the policy state file, which cannot reuse
+// their names; where prefixes overlap, the most specific one wins.
+type GroupConfig struct {
+	// Name identifies the group in logs and the admin interface
+	Name string `json:"name"`
+
+	// Clients lists CIDRs or bare IP addresses
+	Clients []string `json:"clients"`
+
+	// Mode is "enforce" (the default) or "off"
+	Mode string `json:"mode,omitempty"`
+
+	// Allowlist holds extra domains never blocked for this group
+	Allowlist []string `json:"allowlist,omitempty"`
+
+	// Schedule limits when the group applies. Outside all of its windows
+	// the group's clients are treated as belonging to no group. Empty
+	// means always.
+	Schedule []ScheduleWindow `json:"schedule,omitempty"`
+}
+
+// ScheduleWindow is a daily time range in the server's local time zone.
+type ScheduleWindow struct {
+	// Days are "mon" to "sun", the days the window starts on. Empty means
+	// every day.
+	Days []string `json:"days,omitempty"`
+
+	// Start and End are "15:04" times. A window whose End is not after its
+	// Start runs past midnight into the next day.
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// validateGroups checks the groups section.
+func validateGroups(groups []GroupConfig) error {
+	names := make(map[string]bool)
+	for _, g := range groups {
+		if g.Name == "" {
+			return fmt.Errorf("groups: every group needs a name")
+		}
+		if names[g.Name] {
+			return fmt.Errorf("groups: duplicate group name %q", g.Name)
+		}
+		names[g.Name] = true
+
+		switch g.Mode {
+		case "", GroupModeEnforce, GroupModeOff:
+		default:
+			return fmt.Errorf("groups: %q mode must be %q or %q (got %q)", g.Name, GroupModeEnforce, GroupModeOff, g.Mode)
+		}
+		if len(g.Clients) == 0 {
+			return fmt.Errorf("groups: %q needs at least one client address or CIDR", g.Name)
+		}
+		for _, c := range g.Clients {
+			if _, err := netip.ParsePrefix(c); err == nil {
+				continue
+			}
+			if _, err := netip.ParseAddr(c); err != nil {
+				return fmt.Errorf("groups: %q client %q is not an IP address or CIDR", g.Name, c)
+			}
+		}
+		for _, w := range g.Schedule {
+			for _, d := range w.Days {
+				switch strings.ToLower(d) {
+				case "mon", "tue", "wed", "thu", "fri", "sat", "sun":
+				default:
+					return fmt.Errorf("groups: %q schedule day %q must be one of mon, tue, wed, thu, fri, sat, sun", g.Name, d)
+				}
+			}
+			for _, t := range []string{w.Start, w.End} {
+				if _, err := time.Parse("15:04", t); err != nil {
+					return fmt.Errorf("groups: %q schedule time %q must be in 15:04 form", g.Name, t)
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// includeHeader reads the include list of a configuration file. It is kept
+// out of Config because it describes how files are combined rather than a
+// setting.
+type includeHeader struct {
+	Include []string `json:"include"`
+}
+
+// readLayers calls layer with the contents of path and then, in order, of
+// every file it includes, recursively. Each layer is applied over the ones
+// before it, so an included file overrides the file including it and later
+// includes override earlier ones. Include paths are relative to the
+// including file and may be glob patterns, whose matches are taken in
+// lexical order; a pattern matching nothing is not an error, but a missing
+// plain path is.
+func readLayers(path string, layer func(path string, data []byte) error) error {
+	return readLayersFrom(path, layer, map[string]bool{})
+}
+
+func readLayersFrom(path string, layer func(path string, data []byte) error, including map[string]bool) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if including[abs] {
+		return fmt.Errorf("config file %s includes itself", path)
+	}
+	including[abs] = true
+	defer delete(including, abs)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	if err := layer(path, data); err != nil {
+		return err
+	}
+
+	var header includeHeader
+	if err := json.Unmarshal(data, &header); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	for _, pattern := range header.Include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("config file %s: include %q: %w", path, pattern, err)
+		}
+		if matches == nil && !hasMeta(pattern) {
+			return fmt.Errorf("config file %s: included file %s does not exist", path, pattern)
+		}
+		sort.Strings(matches)
+		for _, match := range matches {
+			if err := readLayersFrom(match, layer, including); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasMeta reports whether pattern is a glob rather than a plain path.
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// Files returns the configuration file at path and every file it includes,
+// in the order they are applied.
+func Files(path string) ([]string, error) {
+	var files []string
+	err := readLayers(path, func(path string, _ []byte) error {
+		files = append(files, path)
+		return nil
+	})
+	return files, err
+}
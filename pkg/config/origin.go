@@ -0,0 +1,115 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Setting is the value of one setting.
+type Setting struct {
+	// Key is the setting's JSON path, e.g. "dns.upstream_dns"
+	Key string
+
+	// Value is the setting's value as JSON
+	Value json.RawMessage
+}
+
+// Settings lists every setting of c, in configuration file order.
+func (c *Config) Settings() []Setting {
+	var out []Setting
+	walkSettings(reflect.ValueOf(c).Elem(), "", func(field reflect.Value, key string) error {
+		value, _ := json.Marshal(field.Interface())
+		out = append(out, Setting{Key: key, Value: value})
+		return nil
+	})
+	return out
+}
+
+// Origins reports where each setting got its value, by JSON path, for the
+// configuration loaded from path with the remote document remote (which may
+// be nil) layered over it and the flags given on fs (which may be nil). The
+// origin is "default", "file <path>" for the last file or include that sets
+// it, "remote", "env <name>" or "flag -<name>". The remote_config section
+// never comes from the remote document, which cannot change it.
+func Origins(path string, remote []byte, fs *flag.FlagSet) (map[string]string, error) {
+	return origins(path, remote, fs, os.LookupEnv)
+}
+
+func origins(path string, remote []byte, fs *flag.FlagSet, lookup func(string) (string, bool)) (map[string]string, error) {
+	var keys []string
+	walkSettings(reflect.ValueOf(&Config{}).Elem(), "", func(_ reflect.Value, key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	origin := make(map[string]string, len(keys))
+	for _, key := range keys {
+		origin[key] = "default"
+	}
+
+	// setBy records source for every setting present in a configuration
+	// document
+	setBy := func(data []byte, source string, skip string) error {
+		var doc map[string]any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if (skip == "" || !strings.HasPrefix(key, skip)) && present(doc, key) {
+				origin[key] = source
+			}
+		}
+		return nil
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		if err := readLayers(path, func(path string, data []byte) error {
+			return setBy(data, "file "+path, "")
+		}); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	if remote != nil {
+		if err := setBy(remote, "remote", "remote_config."); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, key := range keys {
+		name := envName(key)
+		if value, _ := lookup(name); value != "" {
+			origin[key] = "env " + name
+		} else if alias := legacyEnv[name]; alias != "" {
+			if value, _ := lookup(alias); value != "" {
+				origin[key] = "env " + alias
+			}
+		}
+	}
+
+	if fs != nil {
+		fs.Visit(func(f *flag.Flag) {
+			if sf, ok := f.Value.(*settingFlag); ok {
+				origin[sf.key] = "flag -" + f.Name
+			}
+		})
+	}
+	return origin, nil
+}
+
+// present reports whether the setting at key, a JSON path, appears in doc.
+func present(doc map[string]any, key string) bool {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		section, ok := doc[part].(map[string]any)
+		if !ok {
+			return false
+		}
+		doc = section
+	}
+	_, ok := doc[parts[len(parts)-1]]
+	return ok
+}
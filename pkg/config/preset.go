@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// presets adjust DefaultConfig for the common ways this server is deployed.
+// Each preset starts from the defaults, so settings it doesn't mention keep
+// their default values.
+var presets = map[string]func(*Config){
+	// A single household behind a home router: quiet logs kept in a small
+	// file that survives reboots, no reporting, a persistent local
+	// allowlist, and real-time updates so a settled dispute stops blocking
+	// promptly.
+	"home-router": func(c *Config) {
+		c.DNS.UpstreamDNS = Upstreams("9.9.9.9:53", "149.112.112.112:53")
+		c.API.MinStatus = "active"
+		c.API.StreamEnabled = true
+		c.Stats.Enabled = false
+		c.Logging.Level = "warn"
+		c.Logging.File = "/var/lib/opl-dns/opl-dns.log"
+		c.Logging.MaxSizeMB = 1
+		c.Logging.MaxBackups = 2
+		c.Policy.StateFile = "/var/lib/opl-dns/policy.json"
+	},
+
+	// A public or community resolver serving many unrelated clients: keep
+	// nothing that identifies users, retry upstream failures harder, answer
+	// quickly, and rate limit clients so the resolver can't be used for
+	// amplification.
+	"community-resolver": func(c *Config) {
+		c.DNS.UpstreamDNS = Upstreams("9.9.9.9:53", "149.112.112.112:53", "1.1.1.1:53")
+		c.DNS.QueryTimeout = Duration{3 * time.Second}
+		c.DNS.SoftFailureRetries = 2
+		c.DNS.RateLimit.QueriesPerSecond = 20
+		c.API.MinStatus = "active"
+		c.API.StreamEnabled = true
+		c.API.DeltaUpdates = true
+		c.Stats.Enabled = false
+		c.Logging.Level = "warn"
+		c.Logging.Format = "json"
+	},
+
+	// An office or school network run by an administrator: aggregate stats
+	// reporting, structured logs for the log pipeline, and the admin UI for
+	// managing local exceptions. Set admin.auth_token (or OPL_ADMIN_TOKEN)
+	// before starting.
+	"office": func(c *Config) {
+		c.API.StreamEnabled = true
+		c.Stats.Enabled = true
+		c.Logging.Level = "info"
+		c.Logging.Format = "json"
+		c.Policy.StateFile = "/var/lib/opl-dns/policy.json"
+		c.Admin.Enabled = true
+	},
+}
+
+// PresetNames returns the names accepted by Preset, sorted.
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Preset returns the default configuration adjusted for a named deployment
+// profile. The result is the same on every call, so it can be regenerated
+// and diffed against a running config.
+func Preset(name string) (*Config, error) {
+	apply, ok := presets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown preset %q (available: %s)", name, strings.Join(PresetNames(), ", "))
+	}
+	cfg := DefaultConfig()
+	apply(cfg)
+	return cfg, nil
+}
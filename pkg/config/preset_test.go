@@ -0,0 +1,49 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestPresetsValidate(t *testing.T) {
+	for _, name := range PresetNames() {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := Preset(name)
+			if err != nil {
+				t.Fatalf("Preset(%q) error = %v", name, err)
+			}
+			// The admin token is a secret and is never part of a preset
+			cfg.Admin.AuthToken = "secret"
+			if err := cfg.Validate(); err != nil {
+				t.Errorf("preset %q does not validate: %v", name, err)
+			}
+		})
+	}
+}
+
+func TestPresetDeterministic(t *testing.T) {
+	for _, name := range PresetNames() {
+		a, _ := Preset(name)
+		b, _ := Preset(name)
+		aJSON, _ := json.Marshal(a)
+		bJSON, _ := json.Marshal(b)
+		if string(aJSON) != string(bJSON) {
+			t.Errorf("preset %q differs between calls", name)
+		}
+	}
+}
+
+func TestPresetDoesNotModifyDefaults(t *testing.T) {
+	if _, err := Preset("community-resolver"); err != nil {
+		t.Fatal(err)
+	}
+	if got := DefaultConfig().Logging.Format; got != "text" {
+		t.Errorf("default logging format = %q after applying a preset", got)
+	}
+}
+
+func TestPresetUnknown(t *testing.T) {
+	if _, err := Preset("datacenter"); err == nil {
+		t.Error("expected error for unknown preset")
+	}
+}
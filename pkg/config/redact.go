@@ -0,0 +1,75 @@
+package config
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+)
+
+// Redaction is the placeholder Redacted puts in place of a secret.
+const Redaction = "REDACTED"
+
+// Settings tagged `secret:"..."` are hidden by Redacted:
+//
+//	secret:"true"      the whole value; for maps, every value
+//	secret:"password"  only the password of a URL's user info
+//	secret:"url"       everything in a URL after the host, as webhook URLs
+//	                   often carry their token in the path
+const secretTag = "secret"
+
+// Redacted returns a copy of c with secrets replaced by Redaction, for
+// printing or attaching to bug reports. Empty secrets are left empty, so it
+// is still visible whether one is set.
+func (c *Config) Redacted() *Config {
+	data, _ := json.Marshal(c)
+	out := &Config{}
+	json.Unmarshal(data, out)
+	redact(reflect.ValueOf(out).Elem())
+	return out
+}
+
+// redact replaces the secrets in v, walking into nested sections and lists
+// of objects.
+func redact(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Slice:
+		for i := range v.Len() {
+			redact(v.Index(i))
+		}
+		return
+	case reflect.Struct:
+	default:
+		return
+	}
+
+	t := v.Type()
+	for i := range t.NumField() {
+		field := v.Field(i)
+		switch t.Field(i).Tag.Get(secretTag) {
+		case "":
+			redact(field)
+		case "true":
+			switch field.Kind() {
+			case reflect.String:
+				if field.String() != "" {
+					field.SetString(Redaction)
+				}
+			case reflect.Map:
+				for _, k := range field.MapKeys() {
+					field.SetMapIndex(k, reflect.ValueOf(Redaction))
+				}
+			}
+		case "password":
+			if u, err := url.Parse(field.String()); err == nil && u.User != nil {
+				if _, ok := u.User.Password(); ok {
+					u.User = url.UserPassword(u.User.Username(), Redaction)
+					field.SetString(u.String())
+				}
+			}
+		case "url":
+			if u, err := url.Parse(field.String()); err == nil && u.Host != "" && (u.Path != "" || u.RawQuery != "" || u.User != nil) {
+				field.SetString(u.Scheme + "://" + u.Host + "/" + Redaction)
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/ipmatch"
+)
+
+// RPZConfig holds settings for serving the blocklist as a DNS response
+// policy zone, which BIND, PowerDNS Recursor, Knot Resolver and Unbound
+// transfer and enforce themselves.
+type RPZConfig struct {
+	// Enabled serves the zone on ListenAddr
+	Enabled bool `json:"enabled"`
+
+	// ListenAddr is the UDP and TCP address secondaries query and transfer
+	// the zone from
+	ListenAddr string `json:"listen_addr"`
+
+	// Zone is the name of the policy zone, as the secondaries configure it
+	Zone string `json:"zone"`
+
+	// Action is how resolvers answer for blocked domains: "null" answers
+	// 0.0.0.0 and ::, as opl-dns itself does, "nxdomain" denies the name
+	// exists and "nodata" answers with no records
+	Action string `json:"action"`
+
+	// TTL is the TTL of the zone's records, and of the answers resolvers
+	// give for blocked domains
+	TTL Duration `json:"ttl"`
+
+	// AllowTransfer lists the CIDRs or bare IP addresses allowed to query
+	// and transfer the zone
+	AllowTransfer []string `json:"allow_transfer"`
+
+	// TSIGKeys, if set, are the keys transfers must be signed with
+	TSIGKeys []TSIGKeyConfig `json:"tsig_keys"`
+
+	// Notify lists the host:port addresses of secondaries told about every
+	// change to the zone
+	Notify []string `json:"notify"`
+
+	// JournalSize is how many changes are kept to answer incremental
+	// transfers (IXFR). Secondaries further behind transfer the whole zone.
+	JournalSize int `json:"journal_size"`
+}
+
+// TSIGKeyConfig is a shared key secondaries sign zone transfers with.
+type TSIGKeyConfig struct {
+	// Name is the key name, as the secondaries configure it
+	Name string `json:"name"`
+
+	// Algorithm is one of hmac-sha256, hmac-sha512 and hmac-sha1
+	Algorithm string `json:"algorithm"`
+
+	// Secret is the base64 encoded key
+	Secret string `json:"secret" secret:"true"`
+}
+
+// validateRPZ checks the rpz section.
+func validateRPZ(r RPZConfig) error {
+	if !r.Enabled {
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(r.ListenAddr); err != nil {
+		return fmt.Errorf("rpz.listen_addr must be host:port")
+	}
+	if !validZoneName(r.Zone) {
+		return fmt.Errorf("rpz.zone must be a domain name, such as opl.rpz")
+	}
+	switch r.Action {
+	case "null", "nxdomain", "nodata":
+	default:
+		return fmt.Errorf("rpz.action must be one of null, nxdomain, nodata (got %q)", r.Action)
+	}
+	if r.TTL.Duration < 0 {
+		return fmt.Errorf("rpz.ttl must not be negative")
+	}
+	if len(r.AllowTransfer) == 0 {
+		return fmt.Errorf("rpz.allow_transfer must list at least one address or CIDR")
+	}
+	for _, a := range r.AllowTransfer {
+		if _, err := ipmatch.ParsePrefix(a); err != nil {
+			return fmt.Errorf("rpz.allow_transfer: %q is not an IP address or CIDR", a)
+		}
+	}
+	names := make(map[string]bool)
+	for _, k := range r.TSIGKeys {
+		name := strings.ToLower(strings.TrimSuffix(k.Name, "."))
+		if !validZoneName(name) {
+			return fmt.Errorf("rpz.tsig_keys: %q is not a valid key name", k.Name)
+		}
+		if names[name] {
+			return fmt.Errorf("rpz.tsig_keys: duplicate key name %q", k.Name)
+		}
+		names[name] = true
+		switch k.Algorithm {
+		case "hmac-sha256", "hmac-sha512", "hmac-sha1":
+		default:
+			return fmt.Errorf("rpz.tsig_keys: %q algorithm must be one of hmac-sha256, hmac-sha512, hmac-sha1 (got %q)", k.Name, k.Algorithm)
+		}
+		if secret, err := base64.StdEncoding.DecodeString(k.Secret); err != nil || len(secret) == 0 {
+			return fmt.Errorf("rpz.tsig_keys: %q secret must be base64 encoded", k.Name)
+		}
+	}
+	for _, n := range r.Notify {
+		if _, _, err := net.SplitHostPort(n); err != nil {
+			return fmt.Errorf("rpz.notify: %q must be host:port", n)
+		}
+	}
+	if r.JournalSize < 0 {
+		return fmt.Errorf("rpz.journal_size must not be negative")
+	}
+	return nil
+}
+
+// validZoneName reports whether name, with or without the final dot, is a
+// domain name of letters, digits, "-" and "_".
+func validZoneName(name string) bool {
+	name = strings.TrimSuffix(name, ".")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"net/url"
+	"regexp"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/ipmatch"
+)
+
+// tenantNamePattern keeps tenant names usable in instance IDs and logs.
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// TenantConfig serves one member organization from a shared server: its
+// clients are answered from its own blocklist, fetched with its own API
+// key, and counted in its own stats reports. Clients outside every tenant
+// are served with the top-level settings.
+type TenantConfig struct {
+	// Name identifies the tenant in logs, health reports and its default
+	// instance ID. Lowercase letters, digits, "-" and "_".
+	Name string `json:"name"`
+
+	// Clients lists the CIDRs or bare IP addresses the tenant serves.
+	// Where tenants' prefixes overlap, the most specific one wins.
+	Clients []string `json:"clients"`
+
+	// APIKey fetches the tenant's blocklist and authenticates its stats
+	// reports
+	APIKey string `json:"api_key" secret:"true"`
+
+	// BaseURL overrides api.base_url for the tenant
+	BaseURL string `json:"base_url,omitempty"`
+
+	// InstanceID identifies the tenant's stats reports. Defaults to the
+	// server's instance ID followed by "-" and the tenant name.
+	InstanceID string `json:"instance_id,omitempty"`
+}
+
+// validateTenants checks the tenants section.
+func validateTenants(tenants []TenantConfig) error {
+	names := make(map[string]bool)
+	prefixes := make(map[netip.Prefix]string)
+	for _, t := range tenants {
+		if !tenantNamePattern.MatchString(t.Name) {
+			return fmt.Errorf("tenants: %q is not a valid tenant name; use lowercase letters, digits, - and _", t.Name)
+		}
+		if names[t.Name] {
+			return fmt.Errorf("tenants: duplicate tenant name %q", t.Name)
+		}
+		names[t.Name] = true
+
+		if len(t.Clients) == 0 {
+			return fmt.Errorf("tenants: %q needs at least one client address or CIDR", t.Name)
+		}
+		for _, c := range t.Clients {
+			prefix, err := ipmatch.ParsePrefix(c)
+			if err != nil {
+				return fmt.Errorf("tenants: %q client %q is not an IP address or CIDR", t.Name, c)
+			}
+			if other, ok := prefixes[prefix]; ok {
+				return fmt.Errorf("tenants: %q and %q both list %s", other, t.Name, prefix)
+			}
+			prefixes[prefix] = t.Name
+		}
+
+		if t.BaseURL != "" {
+			u, err := url.Parse(t.BaseURL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("tenants: %q base_url must be an http:// or https:// URL", t.Name)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// Upstream protocols.
+const (
+	ProtocolUDP   = "udp"
+	ProtocolTCP   = "tcp"
+	ProtocolTLS   = "tls"
+	ProtocolHTTPS = "https"
+)
+
+// UpstreamConfig is one upstream resolver. In the configuration file it is
+// either an object or a string in the short form parsed by UnmarshalText,
+// e.g. "9.9.9.9:53" or "tls://9.9.9.9:853#dns.quad9.net".
+type UpstreamConfig struct {
+	// Address is "host:port" for udp, tcp and tls, and the query URL for
+	// https
+	Address string `json:"address"`
+
+	// Protocol is "udp", "tcp", "tls" or "https"
+	Protocol string `json:"protocol"`
+
+	// ServerName is the name verified in the TLS certificate and sent as
+	// SNI, for tls and https. Empty uses the host in Address.
+	ServerName string `json:"server_name,omitempty"`
+
+	// Timeout bounds each query to this upstream. Zero uses
+	// dns.query_timeout.
+	Timeout Duration `json:"timeout,omitzero"`
+
+	// Weight is the upstream's share of first attempts among the weighted
+	// upstreams. Upstreams without a weight are fallbacks, tried in order
+	// after the weighted ones.
+	Weight int `json:"weight,omitempty"`
+
+	// HealthCheck includes the upstream in health reports and upstream
+	// alerts. Defaults to true.
+	HealthCheck bool `json:"health_check"`
+}
+
+// Upstreams returns health-checked UDP upstreams for addrs.
+func Upstreams(addrs ...string) []UpstreamConfig {
+	upstreams := make([]UpstreamConfig, len(addrs))
+	for i, addr := range addrs {
+		upstreams[i] = UpstreamConfig{Address: addr, Protocol: ProtocolUDP, HealthCheck: true}
+	}
+	return upstreams
+}
+
+// UnmarshalText parses the short form: "host:port" for UDP, or
+// "udp://host:port", "tcp://host:port", "tls://host:port" or an https://
+// URL. A "#name" suffix on a tls address sets ServerName. The port defaults
+// to 53, or 853 for tls.
+func (u *UpstreamConfig) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	*u = UpstreamConfig{Protocol: ProtocolUDP, HealthCheck: true}
+
+	scheme, rest, found := strings.Cut(s, "://")
+	if !found {
+		rest = s
+	} else {
+		u.Protocol = scheme
+	}
+	switch u.Protocol {
+	case ProtocolHTTPS:
+		u.Address = s
+		return nil
+	case ProtocolUDP, ProtocolTCP, ProtocolTLS:
+	default:
+		return fmt.Errorf("upstream %q: unknown protocol %q", s, scheme)
+	}
+
+	if u.Protocol == ProtocolTLS {
+		rest, u.ServerName, _ = strings.Cut(rest, "#")
+	}
+	if _, _, err := net.SplitHostPort(rest); err != nil && rest != "" {
+		port := "53"
+		if u.Protocol == ProtocolTLS {
+			port = "853"
+		}
+		rest = net.JoinHostPort(strings.Trim(rest, "[]"), port)
+	}
+	u.Address = rest
+	return nil
+}
+
+// MarshalText returns the short form, which UnmarshalText accepts. It
+// cannot express Timeout, Weight or a disabled HealthCheck.
+func (u UpstreamConfig) MarshalText() ([]byte, error) {
+	switch u.Protocol {
+	case "", ProtocolUDP, ProtocolHTTPS:
+		return []byte(u.Address), nil
+	case ProtocolTLS:
+		if u.ServerName != "" {
+			return []byte("tls://" + u.Address + "#" + u.ServerName), nil
+		}
+	}
+	return []byte(u.Protocol + "://" + u.Address), nil
+}
+
+// UnmarshalJSON accepts the short form string or an object.
+func (u *UpstreamConfig) UnmarshalJSON(b []byte) error {
+	var s string
+	if json.Unmarshal(b, &s) == nil {
+		return u.UnmarshalText([]byte(s))
+	}
+
+	type plain UpstreamConfig
+	v := plain{Protocol: ProtocolUDP, HealthCheck: true}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*u = UpstreamConfig(v)
+	return nil
+}
+
+// MarshalJSON writes the short form when it says everything, so simple
+// configurations keep reading as a list of addresses.
+func (u UpstreamConfig) MarshalJSON() ([]byte, error) {
+	if u.Timeout.Duration == 0 && u.Weight == 0 && u.HealthCheck && (u.ServerName == "" || u.Protocol == ProtocolTLS) {
+		text, _ := u.MarshalText()
+		return json.Marshal(string(text))
+	}
+	type plain UpstreamConfig
+	return json.Marshal(plain(u))
+}
+
+// validate checks one entry of dns.upstream_dns.
+func (u UpstreamConfig) validate() error {
+	switch u.Protocol {
+	case ProtocolHTTPS:
+		parsed, err := url.Parse(u.Address)
+		if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return fmt.Errorf("dns.upstream_dns: %q must be an https:// URL", u.Address)
+		}
+	case ProtocolUDP, ProtocolTCP, ProtocolTLS:
+		if _, port, err := net.SplitHostPort(u.Address); err != nil || port == "" {
+			return fmt.Errorf("dns.upstream_dns: %q must be host:port", u.Address)
+		}
+		if u.ServerName != "" && u.Protocol != ProtocolTLS {
+			return fmt.Errorf("dns.upstream_dns: %q server_name only applies to tls and https", u.Address)
+		}
+	default:
+		return fmt.Errorf("dns.upstream_dns: %q protocol must be one of udp, tcp, tls, https (got %q)", u.Address, u.Protocol)
+	}
+	if u.Weight < 0 {
+		return fmt.Errorf("dns.upstream_dns: %q weight must not be negative", u.Address)
+	}
+	if u.Timeout.Duration < 0 {
+		return fmt.Errorf("dns.upstream_dns: %q timeout must not be negative", u.Address)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package dns
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/policy"
+)
+
+// Decision sources.
+const (
+	// SourcePolicy means local policy decided: an allowlist entry, a group
+	// with blocking turned off, or a manual block.
+	SourcePolicy = "policy"
+	// SourceBlocklist means the OPL blocklist matched.
+	SourceBlocklist = "blocklist"
+	// SourcePaused means blocking is paused and nothing is blocked.
+	SourcePaused = "paused"
+)
+
+// Decision is how the server treats a query for a domain.
+type Decision struct {
+	// Domain is the queried name, normalized.
+	Domain string
+
+	// Blocked reports whether the query is answered locally, with 0.0.0.0
+	// for A queries, :: for AAAA and no records otherwise, instead of being
+	// forwarded.
+	Blocked bool
+
+	// Source is SourcePolicy or SourceBlocklist, or empty when nothing
+	// matched and the query is forwarded.
+	Source string
+
+	// Group is the client group that applied, if any.
+	Group string
+
+	// Tenant is the tenant serving the client, if any.
+	Tenant string
+
+	// Item is the matching entry when Blocked. Manual blocks are reported
+	// as items with the action type "manual".
+	Item *api.BlockListItem
+}
+
+// Decide applies local policy p for client, then the OPL blocklist, to a
+// query for domain. p may be nil, and client may be the zero Addr when the
+// source is unknown.
+func Decide(p *policy.Policy, blocklist *api.Client, client netip.Addr, domain string) Decision {
+	d := Decision{Domain: policy.NormalizeDomain(domain)}
+	switch verdict, block := p.Evaluate(client, d.Domain); verdict {
+	case policy.VerdictAllow:
+		d.Source = SourcePolicy
+		d.Group, _ = p.GroupFor(client)
+		return d
+	case policy.VerdictBlock:
+		d.Blocked, d.Source = true, SourcePolicy
+		d.Item = &api.BlockListItem{
+			URL:      block.Domain,
+			Domain:   block.Domain,
+			Employer: block.Employer,
+			ActionDetails: api.ActionDetails{
+				ActionType:  "manual",
+				Description: block.Reason,
+			},
+		}
+		return d
+	}
+	if blocklist != nil {
+		if item, ok := blocklist.CheckDomain(d.Domain); ok {
+			d.Blocked, d.Source, d.Item = true, SourceBlocklist, item
+		}
+	}
+	return d
+}
+
+// Explain says in a sentence why the decision was made.
+func (d Decision) Explain() string {
+	switch {
+	case d.Source == SourcePaused:
+		return "not blocked; blocking is paused"
+	case d.Source == SourcePolicy && !d.Blocked && d.Group != "":
+		return fmt.Sprintf("allowed by local policy (client group %q)", d.Group)
+	case d.Source == SourcePolicy && !d.Blocked:
+		return "allowed by the local allowlist"
+	case d.Source == SourcePolicy:
+		msg := fmt.Sprintf("blocked by the local policy entry for %s", d.Item.Domain)
+		if d.Item.Employer != "" {
+			msg += fmt.Sprintf(" (employer %s)", d.Item.Employer)
+		}
+		if d.Item.ActionDetails.Description != "" {
+			msg += ": " + d.Item.ActionDetails.Description
+		}
+		return msg
+	case d.Source == SourceBlocklist:
+		var msg strings.Builder
+		fmt.Fprintf(&msg, "blocked by the OPL blocklist: %s matches pattern %q of employer %s", d.Domain, d.Item.URL, d.Item.Employer)
+		if t := d.Item.ActionDetails.ActionType; t != "" {
+			fmt.Fprintf(&msg, " (%s", t)
+			if org := d.Item.ActionDetails.Organization; org != "" {
+				fmt.Fprintf(&msg, " by %s", org)
+			}
+			msg.WriteString(")")
+		}
+		return msg.String()
+	}
+	return "not blocked; forwarded to the upstream resolvers"
+}
@@ -0,0 +1,70 @@
+package dns
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/policy"
+)
+
+func TestDecide(t *testing.T) {
+	apiClient := api.NewClient("https://api.example.com", "", 10*time.Second)
+	apiClient.SetBlocklistForTesting(&api.Blocklist{
+		BlockList: []api.BlockListItem{
+			{URL: "https://example.com/jobs", Domain: "example.com", Employer: "Test Corp",
+				ActionDetails: api.ActionDetails{ActionType: "strike", Organization: "Test Workers Union"}},
+		},
+	})
+
+	store, _ := policy.NewStore("")
+	err := store.Apply(policy.State{
+		Allowlist: []string{"news.example.com"},
+		Blocks:    []policy.Block{{Domain: "scab.example", Employer: "Scab Staffing Inc", Reason: "replacement workers"}},
+		Groups:    []policy.Group{{Name: "guests", Clients: []string{"10.9.0.0/16"}, Mode: policy.ModeOff}},
+	})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		client      string
+		domain      string
+		wantBlocked bool
+		wantSource  string
+		wantExplain string
+	}{
+		{"blocklist", "192.168.1.50", "WWW.Example.com.", true, SourceBlocklist,
+			`blocked by the OPL blocklist: www.example.com matches pattern "https://example.com/jobs" of employer Test Corp (strike by Test Workers Union)`},
+		{"allowlist", "192.168.1.50", "news.example.com", false, SourcePolicy, "allowed by the local allowlist"},
+		{"manual block", "", "scab.example", true, SourcePolicy,
+			"blocked by the local policy entry for scab.example (employer Scab Staffing Inc): replacement workers"},
+		{"group with blocking off", "10.9.1.1", "example.com", false, SourcePolicy, `allowed by local policy (client group "guests")`},
+		{"no match", "192.168.1.50", "example.org", false, "", "not blocked; forwarded to the upstream resolvers"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var client netip.Addr
+			if tt.client != "" {
+				client = netip.MustParseAddr(tt.client)
+			}
+			d := Decide(store.Policy(), apiClient, client, tt.domain)
+			if d.Blocked != tt.wantBlocked || d.Source != tt.wantSource {
+				t.Errorf("Expected blocked=%v source=%q, got %+v", tt.wantBlocked, tt.wantSource, d)
+			}
+			if d.Blocked != (d.Item != nil) {
+				t.Errorf("Expected an item exactly when blocked, got %+v", d)
+			}
+			if got := d.Explain(); got != tt.wantExplain {
+				t.Errorf("Expected explanation %q, got %q", tt.wantExplain, got)
+			}
+		})
+	}
+
+	if d := Decide(nil, nil, netip.Addr{}, "example.com"); d.Blocked || !strings.HasPrefix(d.Explain(), "not blocked") {
+		t.Errorf("Expected nothing to block without policy or blocklist, got %+v", d)
+	}
+}
@@ -0,0 +1,200 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+)
+
+// UpstreamStatus summarizes recent results from one upstream resolver.
+type UpstreamStatus struct {
+	Addr        string    `json:"addr"`
+	LastSuccess time.Time `json:"last_success,omitzero"`
+	LastFailure time.Time `json:"last_failure,omitzero"`
+	LastError   string    `json:"last_error,omitempty"`
+
+	// ConsecutiveFailures counts network errors and SERVFAIL or REFUSED
+	// answers since the last good answer.
+	ConsecutiveFailures int `json:"consecutive_failures"`
+
+	// Successes and Failures count exchanges since startup.
+	Successes int64 `json:"successes"`
+	Failures  int64 `json:"failures"`
+
+	// LatencyMs is the exchange time, smoothed over recent exchanges.
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+// Failing reports whether the upstream's most recent result was a failure.
+func (u UpstreamStatus) Failing() bool {
+	return u.ConsecutiveFailures > 0
+}
+
+// upstreamTracker records per-upstream results for health reporting.
+type upstreamTracker struct {
+	mu       sync.Mutex
+	statuses []UpstreamStatus
+	index    map[string]int
+}
+
+func newUpstreamTracker(addrs []string) *upstreamTracker {
+	t := &upstreamTracker{index: make(map[string]int, len(addrs))}
+	for _, addr := range addrs {
+		t.indexOf(addr)
+	}
+	return t
+}
+
+// retain replaces the tracked upstreams with addrs, keeping the history of
+// those that remain.
+func (t *upstreamTracker) retain(addrs []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	old, oldIndex := t.statuses, t.index
+	t.statuses, t.index = nil, make(map[string]int, len(addrs))
+	for _, addr := range addrs {
+		i := t.indexOf(addr)
+		if j, ok := oldIndex[addr]; ok {
+			t.statuses[i] = old[j]
+		}
+	}
+}
+
+// indexOf returns addr's position, adding it if needed. The caller holds
+// t.mu or has exclusive access.
+func (t *upstreamTracker) indexOf(addr string) int {
+	i, ok := t.index[addr]
+	if !ok {
+		i = len(t.statuses)
+		t.index[addr] = i
+		t.statuses = append(t.statuses, UpstreamStatus{Addr: addr})
+	}
+	return i
+}
+
+// latencySmoothing is the weight of the newest exchange in LatencyMs.
+const latencySmoothing = 0.2
+
+// record notes one exchange with addr. An empty reason means success. It
+// returns the upstream's consecutive failures afterwards, or 0 if addr is
+// not tracked.
+func (t *upstreamTracker) record(addr, reason string, d time.Duration) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	i, ok := t.index[addr]
+	if !ok {
+		return 0
+	}
+	s := &t.statuses[i]
+
+	ms := float64(d.Microseconds()) / 1000
+	if s.Successes+s.Failures == 0 {
+		s.LatencyMs = ms
+	} else {
+		s.LatencyMs += latencySmoothing * (ms - s.LatencyMs)
+	}
+
+	if reason == "" {
+		s.LastSuccess = time.Now()
+		s.ConsecutiveFailures = 0
+		s.Successes++
+	} else {
+		s.LastFailure = time.Now()
+		s.LastError = reason
+		s.ConsecutiveFailures++
+		s.Failures++
+	}
+	return s.ConsecutiveFailures
+}
+
+func (t *upstreamTracker) snapshot() []UpstreamStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]UpstreamStatus(nil), t.statuses...)
+}
+
+// recordUpstream notes one exchange with upstream for health reporting and
+// stats. result is one of the stats.Upstream* constants; reason describes a
+// failure.
+func (s *Server) recordUpstream(upstream, result, reason string, d time.Duration) {
+	failures := s.health.record(upstream, reason, d)
+	s.stats.RecordUpstreamExchange(stats.UpstreamExchange{
+		Upstream:            upstream,
+		Result:              result,
+		Duration:            d,
+		ConsecutiveFailures: failures,
+	})
+}
+
+// UpstreamHealth returns the recent results of each health-checked
+// upstream, in configured order. With ODoH enabled there is a single entry
+// for the ODoH target.
+func (s *Server) UpstreamHealth() []UpstreamStatus {
+	return s.health.snapshot()
+}
+
+// SetUpstreams replaces the upstream resolvers used for queries that arrive
+// from now on. Health history is kept for upstreams that remain. It has no
+// effect on resolution while ODoH is enabled.
+func (s *Server) SetUpstreams(upstreams []Upstream) {
+	s.upstreams.Store(newUpstreamSet(upstreams, s.queryTimeout))
+	if s.odoh == nil {
+		s.health.retain(healthChecked(upstreams))
+	}
+}
+
+// Serving reports whether both the UDP and TCP listeners are serving
+// queries.
+func (s *Server) Serving() bool {
+	return s.udpServing.Load() && s.tcpServing.Load()
+}
+
+// Probe checks that the UDP and TCP listeners answer by sending each a
+// query without a question, which the server answers itself without
+// consulting the blocklist or the upstreams. A listener bound to an
+// unspecified address is probed over loopback.
+func (s *Server) Probe(ctx context.Context) error {
+	udpAddr, ok := s.Addr().(*net.UDPAddr)
+	if !ok {
+		return fmt.Errorf("not listening")
+	}
+	addr := *udpAddr
+	if addr.IP.IsUnspecified() {
+		if addr.IP.To4() != nil {
+			addr.IP = net.IPv4(127, 0, 0, 1)
+		} else {
+			addr.IP = net.IPv6loopback
+		}
+	}
+
+	for _, network := range []string{"udp", "tcp"} {
+		c := &dns.Client{Net: network}
+		m := &dns.Msg{}
+		m.Id = dns.Id()
+		if _, _, err := c.ExchangeContext(ctx, m, addr.String()); err != nil {
+			return fmt.Errorf("%s listener: %w", network, err)
+		}
+	}
+	return nil
+}
+
+// ProbeUpstream asks u for the root name servers. SERVFAIL and REFUSED are
+// errors, since they mean it will not resolve for us; any other answer
+// shows it is usable. timeout applies unless u sets its own.
+func ProbeUpstream(ctx context.Context, u Upstream, timeout time.Duration) error {
+	m := new(dns.Msg)
+	m.SetQuestion(".", dns.TypeNS)
+	resp, err := newUpstreamConn(u, timeout).exchange(ctx, m)
+	if err != nil {
+		return err
+	}
+	if isSoftFailure(resp.Rcode) {
+		return fmt.Errorf("answered %s", dns.RcodeToString[resp.Rcode])
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package dns
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+)
+
+func TestUpstreamHealth(t *testing.T) {
+	servfail := startTestUpstream(t, dns.RcodeServerFailure, "")
+	good := startTestUpstream(t, dns.RcodeSuccess, "192.0.2.1")
+
+	server, _ := NewServer(
+		"127.0.0.1:0",
+		PlainUpstreams(servfail, good),
+		500*time.Millisecond,
+		api.NewClient("https://api.example.com", "", time.Second),
+		nil,
+		slog.New(slog.DiscardHandler),
+		WithSoftFailureRetries(1),
+	)
+
+	if health := server.UpstreamHealth(); len(health) != 2 || health[0].Addr != servfail || health[0].Failing() {
+		t.Fatalf("Expected both upstreams listed as healthy before any query, got %+v", health)
+	}
+
+	for range 2 {
+		r := new(dns.Msg)
+		r.SetQuestion("example.org.", dns.TypeA)
+		server.ServeDNS(&mockDNSWriter{}, r)
+	}
+
+	health := server.UpstreamHealth()
+	if h := health[0]; h.ConsecutiveFailures != 2 || h.Failures != 2 || h.Successes != 0 || h.LastError != "SERVFAIL" || !h.LastSuccess.IsZero() {
+		t.Errorf("Expected SERVFAIL upstream to be failing, got %+v", h)
+	}
+	if h := health[1]; h.Failing() || h.Successes != 2 || h.LastSuccess.IsZero() || h.LatencyMs <= 0 {
+		t.Errorf("Expected good upstream to be healthy, got %+v", h)
+	}
+}
+
+func TestUpstreamTrackerLatency(t *testing.T) {
+	tracker := newUpstreamTracker([]string{"192.0.2.53:53"})
+
+	tracker.record("192.0.2.53:53", "", 10*time.Millisecond)
+	if got := tracker.snapshot()[0].LatencyMs; got != 10 {
+		t.Errorf("Expected first exchange to set latency to 10ms, got %v", got)
+	}
+
+	if failures := tracker.record("192.0.2.53:53", "i/o timeout", 110*time.Millisecond); failures != 1 {
+		t.Errorf("Expected 1 consecutive failure, got %d", failures)
+	}
+	if got := tracker.snapshot()[0].LatencyMs; got != 30 {
+		t.Errorf("Expected smoothed latency of 30ms, got %v", got)
+	}
+}
+
+func TestServing(t *testing.T) {
+	server, _ := NewServer(
+		"127.0.0.1:0",
+		PlainUpstreams("127.0.0.1:1"),
+		time.Second,
+		api.NewClient("https://api.example.com", "", time.Second),
+		nil,
+		slog.New(slog.DiscardHandler),
+	)
+	if err := server.Listen(); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	if server.Serving() {
+		t.Error("Expected Serving to be false before Start")
+	}
+
+	done := make(chan struct{}, 2)
+	go func() { server.Start(); done <- struct{}{} }()
+	go func() { server.StartTCP(); done <- struct{}{} }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !server.Serving() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for Serving")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := server.Probe(ctx); err != nil {
+		t.Errorf("Probe failed while serving: %v", err)
+	}
+
+	server.Stop()
+	<-done
+	<-done
+	if server.Serving() {
+		t.Error("Expected Serving to be false after Stop")
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if err := server.Probe(ctx); err == nil {
+		t.Error("Expected Probe to fail after Stop")
+	}
+}
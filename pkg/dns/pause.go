@@ -0,0 +1,51 @@
+package dns
+
+import (
+	"time"
+)
+
+// pause is a period in which nothing is blocked.
+type pause struct {
+	// until is when blocking resumes, or zero to pause until
+	// ResumeBlocking is called
+	until time.Time
+}
+
+// PauseBlocking answers every query from upstream, local policy blocks
+// included, for d, or until ResumeBlocking if d is zero. A pause is not
+// saved; blocking resumes when the server restarts.
+func (s *Server) PauseBlocking(d time.Duration) {
+	p := &pause{}
+	if d > 0 {
+		p.until = time.Now().Add(d)
+	}
+	s.pause.Store(p)
+	if p.until.IsZero() {
+		s.logger.Warn("Blocking paused until resumed")
+	} else {
+		s.logger.Warn("Blocking paused", "until", p.until.Format(time.RFC3339))
+	}
+}
+
+// ResumeBlocking ends a pause started by PauseBlocking.
+func (s *Server) ResumeBlocking() {
+	if s.pause.Swap(nil) != nil {
+		s.logger.Info("Blocking resumed")
+	}
+}
+
+// BlockingPaused reports whether blocking is paused, and until when. until
+// is zero while paused until ResumeBlocking.
+func (s *Server) BlockingPaused() (paused bool, until time.Time) {
+	p := s.pause.Load()
+	if p == nil {
+		return false, time.Time{}
+	}
+	if !p.until.IsZero() && !time.Now().Before(p.until) {
+		// Ended; cleared here so the next check is quick, unless a new
+		// pause was started meanwhile
+		s.pause.CompareAndSwap(p, nil)
+		return false, time.Time{}
+	}
+	return true, p.until
+}
@@ -0,0 +1,112 @@
+package dns
+
+import (
+	"net"
+	"net/netip"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/ratelimit"
+)
+
+// RateLimitConfig limits UDP queries per client network. TCP queries are
+// not limited: a TCP handshake cannot come from a spoofed address, so TCP
+// is where limited clients are sent to retry.
+type RateLimitConfig struct {
+	// QueriesPerSecond is the sustained rate allowed per client network.
+	// Zero disables rate limiting.
+	QueriesPerSecond float64
+
+	// Burst is how many queries a client network may send at once.
+	Burst int
+
+	// Slip answers every Nth limited query with an empty truncated reply,
+	// so real clients sharing a limited network retry over TCP while most
+	// spoofed traffic is still dropped. Zero drops all limited queries.
+	Slip int
+
+	// IPv4PrefixLen and IPv6PrefixLen group clients into networks that
+	// share a limit, so one host cannot evade it by rotating addresses.
+	IPv4PrefixLen int
+	IPv6PrefixLen int
+}
+
+// rateLimiter applies a RateLimitConfig to incoming queries.
+type rateLimiter struct {
+	cfg     RateLimitConfig
+	limiter *ratelimit.TokenBucket
+	limited atomic.Uint64
+}
+
+// WithRateLimit limits UDP queries per client network as described by cfg.
+func WithRateLimit(cfg RateLimitConfig) Option {
+	return func(s *Server) {
+		if cfg.QueriesPerSecond <= 0 {
+			s.rateLimiter = nil
+			return
+		}
+		if cfg.IPv4PrefixLen <= 0 || cfg.IPv4PrefixLen > 32 {
+			cfg.IPv4PrefixLen = 32
+		}
+		if cfg.IPv6PrefixLen <= 0 || cfg.IPv6PrefixLen > 128 {
+			cfg.IPv6PrefixLen = 128
+		}
+		s.rateLimiter = &rateLimiter{
+			cfg:     cfg,
+			limiter: ratelimit.NewTokenBucket(cfg.QueriesPerSecond, cfg.Burst),
+		}
+	}
+}
+
+// rateLimit reports whether r from w's client is over its limit, in which
+// case it has already been dropped or answered with a truncated reply.
+func (s *Server) rateLimit(w dns.ResponseWriter, r *dns.Msg) bool {
+	rl := s.rateLimiter
+	if rl == nil {
+		return false
+	}
+	udpAddr, ok := w.RemoteAddr().(*net.UDPAddr)
+	if !ok {
+		return false
+	}
+	addr, ok := netip.AddrFromSlice(udpAddr.IP)
+	if !ok {
+		return false
+	}
+
+	if rl.limiter.Allow(rl.clientNetwork(addr.Unmap())) {
+		return false
+	}
+
+	s.stats.RecordRateLimited("dns")
+	if n := rl.limited.Add(1); rl.cfg.Slip > 0 && n%uint64(rl.cfg.Slip) == 0 {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.Truncated = true
+		w.WriteMsg(m)
+	}
+	return true
+}
+
+// RateLimitEvictions returns how many client networks the rate limiter
+// dropped to stay within the number it tracks. Evicted networks start with
+// a full burst if they return.
+func (s *Server) RateLimitEvictions() uint64 {
+	if s.rateLimiter == nil {
+		return 0
+	}
+	return s.rateLimiter.limiter.Evicted()
+}
+
+// clientNetwork returns the rate limit key for addr.
+func (rl *rateLimiter) clientNetwork(addr netip.Addr) string {
+	bits := rl.cfg.IPv6PrefixLen
+	if addr.Is4() {
+		bits = rl.cfg.IPv4PrefixLen
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return addr.String()
+	}
+	return prefix.String()
+}
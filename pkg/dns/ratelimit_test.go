@@ -0,0 +1,84 @@
+package dns
+
+import (
+	"log/slog"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+)
+
+func TestServeDNSRateLimit(t *testing.T) {
+	apiClient := api.NewClient("https://api.example.com", "", 10*time.Second)
+	apiClient.SetBlocklistForTesting(&api.Blocklist{
+		BlockList: []api.BlockListItem{{URL: "https://example.com", Employer: "Test Corp"}},
+	})
+	collector := stats.NewCollector()
+
+	server, _ := NewServer("127.0.0.1:5353", nil, time.Second, apiClient, collector, slog.New(slog.DiscardHandler),
+		WithRateLimit(RateLimitConfig{
+			QueriesPerSecond: 0.001,
+			Burst:            2,
+			Slip:             2,
+			IPv4PrefixLen:    24,
+		}),
+	)
+
+	query := func(remote net.Addr) *dns.Msg {
+		r := new(dns.Msg)
+		r.SetQuestion("example.com.", dns.TypeA)
+		w := &mockDNSWriter{remote: remote}
+		server.ServeDNS(w, r)
+		return w.msg
+	}
+	udp := func(ip string) net.Addr { return &net.UDPAddr{IP: net.ParseIP(ip), Port: 5000} }
+
+	for i := 0; i < 2; i++ {
+		if msg := query(udp("192.0.2.10")); msg == nil || msg.Truncated {
+			t.Fatalf("query %d: expected a normal answer within the burst", i)
+		}
+	}
+
+	// Same /24, different host: shares the exhausted limit
+	if msg := query(udp("192.0.2.99")); msg != nil {
+		t.Error("Expected first limited query to be dropped")
+	}
+	if msg := query(udp("192.0.2.10")); msg == nil || !msg.Truncated || len(msg.Answer) != 0 {
+		t.Errorf("Expected second limited query to slip a truncated reply, got %v", msg)
+	}
+
+	// Other networks and TCP are unaffected
+	if msg := query(udp("198.51.100.1")); msg == nil || msg.Truncated {
+		t.Error("Expected a different network to be answered")
+	}
+	if msg := query(&net.TCPAddr{IP: net.ParseIP("192.0.2.10"), Port: 5000}); msg == nil || msg.Truncated {
+		t.Error("Expected TCP queries not to be limited")
+	}
+
+	if got := collector.RateLimited()["dns"]; got != 2 {
+		t.Errorf("Expected 2 rate-limited queries recorded, got %d", got)
+	}
+}
+
+func TestClientNetwork(t *testing.T) {
+	server, _ := NewServer("127.0.0.1:5353", nil, time.Second, nil, nil, slog.New(slog.DiscardHandler),
+		WithRateLimit(RateLimitConfig{QueriesPerSecond: 1, IPv4PrefixLen: 24, IPv6PrefixLen: 56}),
+	)
+	rl := server.rateLimiter
+
+	tests := map[string]string{
+		"192.0.2.77":            "192.0.2.0/24",
+		"2001:db8:1:2ff::1":     "2001:db8:1:200::/56",
+		"::ffff:198.51.100.200": "198.51.100.0/24",
+	}
+	for ip, want := range tests {
+		got := rl.clientNetwork(netip.MustParseAddr(ip).Unmap())
+		if got != want {
+			t.Errorf("clientNetwork(%s) = %s, want %s", ip, got, want)
+		}
+	}
+}
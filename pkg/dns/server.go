@@ -3,99 +3,290 @@ package dns
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
+	"net/netip"
+	"runtime/debug"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/miekg/dns"
 	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/blocklog"
+	"github.com/online-picket-line/opl-for-dns/pkg/ipmatch"
+	"github.com/online-picket-line/opl-for-dns/pkg/odoh"
+	"github.com/online-picket-line/opl-for-dns/pkg/policy"
 	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 // Server is a DNS server that blocks domains involved in labor disputes.
 type Server struct {
 	listenAddr   string
-	upstreamDNS  []string
+	upstreams    atomic.Pointer[upstreamSet]
 	queryTimeout time.Duration
 
-	apiClient      *api.Client
-	statsCollector *stats.Collector
-	logger         *slog.Logger
+	apiClient *api.Client
+	stats     stats.Recorder
+	tracer    trace.Tracer
+	logger    *slog.Logger
 
-	server *dns.Server
-	mu     sync.RWMutex
+	softFailureRetries int
+	policy             *policy.Store
+	odoh               *odoh.Client
+	rateLimiter        *rateLimiter
+	blockLog           *blocklog.Log
+	tenants            *ipmatch.Table[*Tenant]
+	pause              atomic.Pointer[pause]
+
+	health *upstreamTracker
+
+	udpConn     net.PacketConn
+	tcpListener net.Listener
+	server      *dns.Server
+	tcpServer   *dns.Server
+	udpServing  atomic.Bool
+	tcpServing  atomic.Bool
+	mu          sync.RWMutex
+}
+
+// Option customizes a Server.
+type Option func(*Server)
+
+// WithSoftFailureRetries sets how many further upstreams are tried when an
+// upstream answers SERVFAIL or REFUSED. Network errors always fall through
+// to the next upstream and do not count against this cap.
+func WithSoftFailureRetries(n int) Option {
+	return func(s *Server) {
+		s.softFailureRetries = n
+	}
+}
+
+// WithPolicy applies the local allowlist, manual blocks, and client groups
+// in store before consulting the OPL blocklist.
+func WithPolicy(store *policy.Store) Option {
+	return func(s *Server) {
+		s.policy = store
+	}
 }
 
-// NewServer creates a new DNS server.
-func NewServer(listenAddr string, upstreamDNS []string, queryTimeout time.Duration, apiClient *api.Client, statsCollector *stats.Collector, logger *slog.Logger) (*Server, error) {
+// WithODoH resolves allowed queries through an Oblivious DoH proxy and
+// target instead of the plain upstream servers.
+func WithODoH(c *odoh.Client) Option {
+	return func(s *Server) {
+		s.odoh = c
+	}
+}
+
+// WithBlockLog records every blocked query in l.
+func WithBlockLog(l *blocklog.Log) Option {
+	return func(s *Server) {
+		s.blockLog = l
+	}
+}
+
+// WithTracerProvider records a span for every query and upstream exchange.
+// Query names are not recorded.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(s *Server) {
+		s.tracer = tp.Tracer(tracerName)
+	}
+}
+
+// tracerName is the instrumentation scope of the server's spans.
+const tracerName = "github.com/online-picket-line/opl-for-dns/pkg/dns"
+
+// NewServer creates a new DNS server that forwards allowed queries to
+// upstreams. A nil recorder discards query stats.
+func NewServer(listenAddr string, upstreams []Upstream, queryTimeout time.Duration, apiClient *api.Client, recorder stats.Recorder, logger *slog.Logger, opts ...Option) (*Server, error) {
 	if listenAddr == "" {
 		return nil, fmt.Errorf("listen address is required")
 	}
 
-	return &Server{
-		listenAddr:     listenAddr,
-		upstreamDNS:    upstreamDNS,
-		queryTimeout:   queryTimeout,
-		apiClient:      apiClient,
-		statsCollector: statsCollector,
-		logger:         logger,
-	}, nil
+	if recorder == nil {
+		recorder = stats.NopRecorder{}
+	}
+
+	s := &Server{
+		listenAddr:   listenAddr,
+		queryTimeout: queryTimeout,
+		apiClient:    apiClient,
+		stats:        recorder,
+		tracer:       noop.NewTracerProvider().Tracer(tracerName),
+		logger:       logger,
+	}
+	s.upstreams.Store(newUpstreamSet(upstreams, queryTimeout))
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.odoh != nil {
+		s.health = newUpstreamTracker([]string{s.odoh.String()})
+	} else {
+		s.health = newUpstreamTracker(healthChecked(upstreams))
+	}
+	return s, nil
+}
+
+// Listen binds the UDP and TCP sockets for the configured listen address.
+// When the address uses port 0, the TCP listener is bound to the port the
+// kernel picked for UDP so both transports share a single address. Calling
+// Listen is optional; Start and StartTCP bind on first use.
+func (s *Server) Listen() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.listenLocked()
+}
+
+func (s *Server) listenLocked() error {
+	if s.udpConn != nil {
+		return nil
+	}
+
+	udpConn, err := net.ListenPacket("udp", s.listenAddr)
+	if err != nil {
+		return fmt.Errorf("listening on UDP %s: %w", s.listenAddr, err)
+	}
+
+	tcpAddr := s.listenAddr
+	if host, port, err := net.SplitHostPort(s.listenAddr); err == nil && port == "0" {
+		tcpAddr = net.JoinHostPort(host, fmt.Sprint(udpConn.LocalAddr().(*net.UDPAddr).Port))
+	}
+
+	tcpListener, err := net.Listen("tcp", tcpAddr)
+	if err != nil {
+		udpConn.Close()
+		return fmt.Errorf("listening on TCP %s: %w", tcpAddr, err)
+	}
+
+	s.udpConn = udpConn
+	s.tcpListener = tcpListener
+	return nil
+}
+
+// Addr returns the bound UDP address, or nil if the server is not listening yet.
+func (s *Server) Addr() net.Addr {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.udpConn == nil {
+		return nil
+	}
+	return s.udpConn.LocalAddr()
 }
 
 // Start starts the DNS server.
 func (s *Server) Start() error {
 	s.mu.Lock()
-	s.server = &dns.Server{
-		Addr:    s.listenAddr,
-		Net:     "udp",
-		Handler: s,
+	if err := s.listenLocked(); err != nil {
+		s.mu.Unlock()
+		return err
 	}
+	server := &dns.Server{
+		PacketConn:        s.udpConn,
+		Net:               "udp",
+		Handler:           s,
+		NotifyStartedFunc: func() { s.udpServing.Store(true) },
+	}
+	s.server = server
 	s.mu.Unlock()
 
-	s.logger.Info("Starting DNS server", "addr", s.listenAddr)
-	return s.server.ListenAndServe()
+	s.logger.Info("Starting DNS server", "addr", s.udpConn.LocalAddr())
+	return server.ActivateAndServe()
 }
 
 // StartTCP starts the DNS server on TCP.
 func (s *Server) StartTCP() error {
+	s.mu.Lock()
+	if err := s.listenLocked(); err != nil {
+		s.mu.Unlock()
+		return err
+	}
 	tcpServer := &dns.Server{
-		Addr:    s.listenAddr,
-		Net:     "tcp",
-		Handler: s,
+		Listener:          s.tcpListener,
+		Net:               "tcp",
+		Handler:           s,
+		NotifyStartedFunc: func() { s.tcpServing.Store(true) },
 	}
-	s.logger.Info("Starting DNS server (TCP)", "addr", s.listenAddr)
-	return tcpServer.ListenAndServe()
+	s.tcpServer = tcpServer
+	s.mu.Unlock()
+
+	s.logger.Info("Starting DNS server (TCP)", "addr", s.tcpListener.Addr())
+	return tcpServer.ActivateAndServe()
 }
 
-// Stop stops the DNS server.
+// Stop stops the UDP and TCP servers, as Shutdown does without a
+// deadline.
 func (s *Server) Stop() error {
+	return s.Shutdown(context.Background())
+}
+
+// Shutdown stops accepting queries on both transports, waits until those
+// in flight have been answered or ctx is done, and releases the sockets.
+func (s *Server) Shutdown(ctx context.Context) error {
 	s.mu.RLock()
-	server := s.server
+	server, tcpServer := s.server, s.tcpServer
+	udpConn, tcpListener := s.udpConn, s.tcpListener
 	s.mu.RUnlock()
 
-	if server != nil {
-		return server.Shutdown()
+	s.udpServing.Store(false)
+	s.tcpServing.Store(false)
+
+	// Both transports drain at once, so a slow TCP client does not hold up
+	// the UDP side
+	results := make(chan error, 2)
+	for _, srv := range []*dns.Server{server, tcpServer} {
+		go func() {
+			if srv == nil {
+				results <- nil
+				return
+			}
+			results <- srv.ShutdownContext(ctx)
+		}()
 	}
-	return nil
+	err := errors.Join(<-results, <-results)
+
+	// Shutdown refuses servers that have not started serving yet; closing the
+	// sockets directly makes any pending ActivateAndServe return instead of
+	// blocking forever.
+	if udpConn != nil {
+		udpConn.Close()
+	}
+	if tcpListener != nil {
+		tcpListener.Close()
+	}
+
+	return err
 }
 
 // ServeDNS handles DNS queries.
 func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
-	m := new(dns.Msg)
-	m.SetReply(r)
-	m.Authoritative = false
-	m.RecursionAvailable = true
+	// w becomes the rcodeWriter below, which tells the recovery whether an
+	// answer went out before the panic
+	defer func() {
+		if v := recover(); v != nil {
+			s.recoverQuery(w, r, v)
+		}
+	}()
 
+	// A query without a question has nothing to resolve or count; it is
+	// answered straight away, which is what Probe relies on
 	if len(r.Question) == 0 {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		m.RecursionAvailable = true
 		w.WriteMsg(m)
 		return
 	}
 
-	q := r.Question[0]
-	domain := strings.ToLower(strings.TrimSuffix(q.Name, "."))
+	if s.rateLimit(w, r) {
+		return
+	}
 
 	// Get client IP
 	clientIP := ""
@@ -105,9 +296,38 @@ func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 		clientIP = addr.IP.String()
 	}
 
+	client, _ := netip.ParseAddr(clientIP)
+	_, recorder := s.serving(client)
+
+	start := time.Now()
+	ctx, span := s.tracer.Start(context.Background(), "dns.query", trace.WithSpanKind(trace.SpanKindServer))
+	rw := &rcodeWriter{ResponseWriter: w}
+	w = rw
+	defer func() {
+		recorder.RecordQueryDuration(time.Since(start))
+		if rw.written {
+			recorder.RecordResponseRcode(rcodeName(rw.rcode))
+			span.SetAttributes(attribute.String("dns.rcode", rcodeName(rw.rcode)))
+			if rw.rcode == dns.RcodeServerFailure {
+				span.SetStatus(codes.Error, "SERVFAIL")
+			}
+		}
+		span.End()
+	}()
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Authoritative = false
+	m.RecursionAvailable = true
+
+	q := r.Question[0]
+	domain := strings.ToLower(strings.TrimSuffix(q.Name, "."))
+	recorder.RecordQueryType(qtypeName(q.Qtype))
+	span.SetAttributes(attribute.String("dns.qtype", qtypeName(q.Qtype)))
+
 	// Check if domain is blocked
 	if q.Qtype == dns.TypeA || q.Qtype == dns.TypeAAAA {
-		if item, blocked := s.apiClient.CheckDomain(domain); blocked {
+		if item, blocked := s.checkDomain(client, domain); blocked {
 			s.logger.Info("Blocking domain",
 				"domain", domain,
 				"client", clientIP,
@@ -141,9 +361,16 @@ func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 				m.Answer = append(m.Answer, rr)
 			}
 
-			if s.statsCollector != nil {
-				s.statsCollector.RecordBlock(domain)
+			recorder.RecordBlock(domain)
+			recorder.RecordEmployerBlock(item.Employer, item.ActionDetails.ID)
+			recorder.RecordClientQuery(client, true)
+			if s.blockLog != nil {
+				s.blockLog.Record(client, domain, item.Employer, item.ActionDetails.ID)
 			}
+			span.SetAttributes(
+				attribute.Bool("opl.blocked", true),
+				attribute.String("opl.employer", item.Employer),
+			)
 
 			w.WriteMsg(m)
 			return
@@ -151,24 +378,79 @@ func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 	}
 
 	// Forward to upstream DNS
-	if s.statsCollector != nil {
-		s.statsCollector.RecordQuery()
+	recorder.RecordQuery()
+	recorder.RecordClientQuery(client, false)
+	span.SetAttributes(attribute.Bool("opl.blocked", false))
+	s.forwardQuery(ctx, w, r, m)
+}
+
+// Explain reports how the server treats a query for domain from client.
+func (s *Server) Explain(client netip.Addr, domain string) Decision {
+	var d Decision
+	if paused, _ := s.BlockingPaused(); paused {
+		d = Decision{Domain: policy.NormalizeDomain(domain), Source: SourcePaused}
+	} else {
+		var p *policy.Policy
+		if s.policy != nil {
+			p = s.policy.Policy()
+		}
+		blocklist, _ := s.serving(client)
+		d = Decide(p, blocklist, client, domain)
+	}
+	if t := s.tenantFor(client); t != nil {
+		d.Tenant = t.Name
 	}
-	s.forwardQuery(w, r, m)
+	return d
+}
+
+// checkDomain applies local policy for client, then the OPL blocklist.
+func (s *Server) checkDomain(client netip.Addr, domain string) (*api.BlockListItem, bool) {
+	d := s.Explain(client, domain)
+	return d.Item, d.Blocked
 }
 
 // forwardQuery forwards a DNS query to upstream DNS servers.
-func (s *Server) forwardQuery(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg) {
-	c := new(dns.Client)
-	c.Timeout = s.queryTimeout
+func (s *Server) forwardQuery(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, m *dns.Msg) {
+	if s.odoh != nil {
+		s.forwardODoH(ctx, w, r, m)
+		return
+	}
 
-	for _, upstream := range s.upstreamDNS {
-		resp, _, err := c.Exchange(r, upstream)
+	// Best soft-failure answer seen so far, returned if nothing better arrives
+	var fallback *dns.Msg
+	softFailures := 0
+
+	for _, conn := range s.upstreams.Load().order() {
+		upstream := conn.name
+		start := time.Now()
+		spanCtx, span := s.startUpstreamSpan(ctx, upstream)
+		resp, err := conn.exchange(spanCtx, r)
+		elapsed := time.Since(start)
+		endUpstreamSpan(span, resp, err)
 		if err != nil {
 			s.logger.Debug("Upstream DNS query failed",
 				"upstream", upstream,
 				"error", err,
 			)
+			s.recordUpstream(upstream, stats.UpstreamError, err.Error(), elapsed)
+			continue
+		}
+
+		s.stats.RecordUpstreamRcode(rcodeName(resp.Rcode))
+		if isSoftFailure(resp.Rcode) {
+			s.recordUpstream(upstream, stats.UpstreamSoftFailure, rcodeName(resp.Rcode), elapsed)
+		} else {
+			s.recordUpstream(upstream, stats.UpstreamOK, "", elapsed)
+		}
+
+		if isSoftFailure(resp.Rcode) && softFailures < s.softFailureRetries {
+			softFailures++
+			fallback = resp
+			s.logger.Debug("Upstream soft failure, trying next upstream",
+				"upstream", upstream,
+				"rcode", rcodeName(resp.Rcode),
+			)
+			s.stats.RecordSoftFailureRetry()
 			continue
 		}
 
@@ -178,12 +460,127 @@ func (s *Server) forwardQuery(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg) {
 		return
 	}
 
+	if fallback != nil {
+		fallback.Id = r.Id
+		w.WriteMsg(fallback)
+		return
+	}
+
 	// All upstreams failed
 	s.logger.Error("All upstream DNS servers failed")
 	m.Rcode = dns.RcodeServerFailure
 	w.WriteMsg(m)
 }
 
+// forwardODoH resolves r through the configured ODoH target.
+func (s *Server) forwardODoH(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, m *dns.Msg) {
+	ctx, cancel := context.WithTimeout(ctx, s.queryTimeout)
+	defer cancel()
+
+	start := time.Now()
+	ctx, span := s.startUpstreamSpan(ctx, s.odoh.String())
+	resp, err := s.odoh.Exchange(ctx, r)
+	elapsed := time.Since(start)
+	endUpstreamSpan(span, resp, err)
+	if err != nil {
+		s.logger.Error("ODoH query failed",
+			"upstream", s.odoh.String(),
+			"error", err,
+		)
+		s.recordUpstream(s.odoh.String(), stats.UpstreamError, err.Error(), elapsed)
+		m.Rcode = dns.RcodeServerFailure
+		w.WriteMsg(m)
+		return
+	}
+
+	s.stats.RecordUpstreamRcode(rcodeName(resp.Rcode))
+	if isSoftFailure(resp.Rcode) {
+		s.recordUpstream(s.odoh.String(), stats.UpstreamSoftFailure, rcodeName(resp.Rcode), elapsed)
+	} else {
+		s.recordUpstream(s.odoh.String(), stats.UpstreamOK, "", elapsed)
+	}
+	w.WriteMsg(resp)
+}
+
+// startUpstreamSpan starts the span for one exchange with upstream.
+func (s *Server) startUpstreamSpan(ctx context.Context, upstream string) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, "dns.upstream",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("dns.upstream", upstream)),
+	)
+}
+
+// endUpstreamSpan records the outcome of an upstream exchange and ends span.
+func endUpstreamSpan(span trace.Span, resp *dns.Msg, err error) {
+	switch {
+	case err != nil:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "exchange failed")
+	case isSoftFailure(resp.Rcode):
+		span.SetAttributes(attribute.String("dns.rcode", rcodeName(resp.Rcode)))
+		span.SetStatus(codes.Error, rcodeName(resp.Rcode))
+	default:
+		span.SetAttributes(attribute.String("dns.rcode", rcodeName(resp.Rcode)))
+	}
+	span.End()
+}
+
+// recoverQuery answers SERVFAIL to a query whose handling panicked with v,
+// unless an answer was already sent, so that one bad query cannot take the
+// server down with it.
+func (s *Server) recoverQuery(w dns.ResponseWriter, r *dns.Msg, v any) {
+	s.stats.RecordPanic("dns")
+	name := ""
+	if len(r.Question) > 0 {
+		name = r.Question[0].Name
+	}
+	s.logger.Error("Recovered from panic answering query", "query", name, "panic", v, "stack", string(debug.Stack()))
+
+	if rw, ok := w.(*rcodeWriter); ok && rw.written {
+		return
+	}
+	m := new(dns.Msg)
+	m.SetRcode(r, dns.RcodeServerFailure)
+	m.RecursionAvailable = true
+	w.WriteMsg(m)
+}
+
+// rcodeWriter remembers the rcode of the response written through it.
+type rcodeWriter struct {
+	dns.ResponseWriter
+	rcode   int
+	written bool
+}
+
+func (w *rcodeWriter) WriteMsg(m *dns.Msg) error {
+	w.rcode, w.written = m.Rcode, true
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// qtypeName names a query type for stats. Types without a registered name
+// are grouped as "OTHER" so clients cannot create unbounded stats keys.
+func qtypeName(qtype uint16) string {
+	if name, ok := dns.TypeToString[qtype]; ok {
+		return name
+	}
+	return "OTHER"
+}
+
+// rcodeName names a response code for stats, grouping unknown codes as
+// "OTHER".
+func rcodeName(rcode int) string {
+	if name, ok := dns.RcodeToString[rcode]; ok {
+		return name
+	}
+	return "OTHER"
+}
+
+// isSoftFailure reports whether rcode is an upstream failure worth retrying
+// elsewhere, as opposed to an authoritative answer such as NXDOMAIN.
+func isSoftFailure(rcode int) bool {
+	return rcode == dns.RcodeServerFailure || rcode == dns.RcodeRefused
+}
+
 // BlockedDomainInfo holds information about why a domain is blocked.
 type BlockedDomainInfo struct {
 	Domain       string
@@ -199,7 +596,7 @@ type BlockedDomainInfo struct {
 
 // GetBlockedDomainInfo returns information about a blocked domain.
 func (s *Server) GetBlockedDomainInfo(domain string) (*BlockedDomainInfo, bool) {
-	item, blocked := s.apiClient.CheckDomain(domain)
+	item, blocked := s.checkDomain(netip.Addr{}, domain)
 	if !blocked {
 		return nil, false
 	}
@@ -1,14 +1,26 @@
 package dns
 
 import (
+	"context"
+	"errors"
+	"io"
 	"log/slog"
+	"maps"
 	"net"
+	"net/netip"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/miekg/dns"
 	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/ipmatch"
+	"github.com/online-picket-line/opl-for-dns/pkg/policy"
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestNewServer(t *testing.T) {
@@ -17,7 +29,7 @@ func TestNewServer(t *testing.T) {
 
 	server, err := NewServer(
 		"127.0.0.1:5353",
-		[]string{"8.8.8.8:53"},
+		PlainUpstreams("8.8.8.8:53"),
 		5*time.Second,
 		apiClient,
 		nil,
@@ -38,7 +50,7 @@ func TestNewServerEmptyListenAddr(t *testing.T) {
 
 	_, err := NewServer(
 		"",
-		[]string{"8.8.8.8:53"},
+		PlainUpstreams("8.8.8.8:53"),
 		5*time.Second,
 		apiClient,
 		nil,
@@ -72,7 +84,7 @@ func TestGetBlockedDomainInfo(t *testing.T) {
 
 	server, _ := NewServer(
 		"127.0.0.1:5353",
-		[]string{"8.8.8.8:53"},
+		PlainUpstreams("8.8.8.8:53"),
 		5*time.Second,
 		apiClient,
 		nil,
@@ -104,7 +116,7 @@ func TestServeDNSEmptyQuestion(t *testing.T) {
 
 	server, _ := NewServer(
 		"127.0.0.1:5353",
-		[]string{"8.8.8.8:53"},
+		PlainUpstreams("8.8.8.8:53"),
 		5*time.Second,
 		apiClient,
 		nil,
@@ -124,9 +136,257 @@ func TestServeDNSEmptyQuestion(t *testing.T) {
 	}
 }
 
+func TestServeDNSQueryStats(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	apiClient := api.NewClient("https://api.example.com", "", 10*time.Second)
+	apiClient.SetBlocklistForTesting(&api.Blocklist{
+		BlockList: []api.BlockListItem{{URL: "https://example.com", Employer: "Test Corp"}},
+	})
+
+	collector := stats.NewCollector()
+	server, _ := NewServer(
+		"127.0.0.1:5353",
+		PlainUpstreams(startTestUpstream(t, dns.RcodeNameError, "")),
+		time.Second,
+		apiClient,
+		collector,
+		logger,
+	)
+
+	for _, q := range []struct {
+		domain string
+		qtype  uint16
+	}{
+		{"example.com", dns.TypeA},
+		{"missing.test", dns.TypeAAAA},
+		{"missing.test", dns.TypeHTTPS},
+		{"missing.test", 65280},
+	} {
+		r := new(dns.Msg)
+		r.SetQuestion(dns.Fqdn(q.domain), q.qtype)
+		server.ServeDNS(&mockDNSWriter{}, r)
+	}
+
+	wantTypes := map[string]int64{"A": 1, "AAAA": 1, "HTTPS": 1, "OTHER": 1}
+	if got := collector.QueryTypes(); !maps.Equal(got, wantTypes) {
+		t.Errorf("Expected query types %v, got %v", wantTypes, got)
+	}
+	wantRcodes := map[string]int64{"NOERROR": 1, "NXDOMAIN": 3}
+	if got := collector.ResponseRcodes(); !maps.Equal(got, wantRcodes) {
+		t.Errorf("Expected response rcodes %v, got %v", wantRcodes, got)
+	}
+}
+
+// panickingRecorder panics on every query type, standing in for a bug
+// anywhere in query handling.
+type panickingRecorder struct {
+	*stats.Collector
+}
+
+func (panickingRecorder) RecordQueryType(string) {
+	panic("boom")
+}
+
+func TestServeDNSRecoversPanic(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	apiClient := api.NewClient("https://api.example.com", "", 10*time.Second)
+	collector := stats.NewCollector()
+	server, _ := NewServer(
+		"127.0.0.1:5353",
+		PlainUpstreams("8.8.8.8:53"),
+		time.Second,
+		apiClient,
+		panickingRecorder{collector},
+		logger,
+	)
+
+	r := new(dns.Msg)
+	r.SetQuestion("example.com.", dns.TypeA)
+	w := &mockDNSWriter{}
+	server.ServeDNS(w, r)
+
+	if w.msg == nil || w.msg.Rcode != dns.RcodeServerFailure {
+		t.Fatalf("Expected SERVFAIL after a panic, got %v", w.msg)
+	}
+	if got := collector.Panics()["dns"]; got != 1 {
+		t.Errorf("Expected 1 recorded panic, got %d", got)
+	}
+}
+
+// startTestUpstream starts a UDP DNS server that answers every query with
+// rcode and, for NOERROR, an A record pointing at ip.
+func startTestUpstream(t *testing.T, rcode int, ip string) string {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	started := make(chan struct{})
+	server := &dns.Server{
+		PacketConn:        pc,
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetRcode(r, rcode)
+			if rcode == dns.RcodeSuccess {
+				m.Answer = append(m.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+					A:   net.ParseIP(ip),
+				})
+			}
+			w.WriteMsg(m)
+		}),
+	}
+	go server.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { server.Shutdown() })
+
+	return pc.LocalAddr().String()
+}
+
+func TestForwardQuerySoftFailureRetry(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	apiClient := api.NewClient("https://api.example.com", "", 10*time.Second)
+
+	servfail := startTestUpstream(t, dns.RcodeServerFailure, "")
+	refused := startTestUpstream(t, dns.RcodeRefused, "")
+	nxdomain := startTestUpstream(t, dns.RcodeNameError, "")
+	good := startTestUpstream(t, dns.RcodeSuccess, "192.0.2.1")
+
+	tests := []struct {
+		name        string
+		upstreams   []string
+		retries     int
+		wantRcode   int
+		wantRetries int64
+	}{
+		{"retry reaches good upstream", []string{servfail, good}, 1, dns.RcodeSuccess, 1},
+		{"refused is retried", []string{refused, good}, 1, dns.RcodeSuccess, 1},
+		{"retries disabled", []string{servfail, good}, 0, dns.RcodeServerFailure, 0},
+		{"cap reached", []string{servfail, refused, good}, 1, dns.RcodeRefused, 1},
+		{"nxdomain is authoritative", []string{nxdomain, good}, 1, dns.RcodeNameError, 0},
+		{"soft failure returned when others unreachable", []string{refused, "127.0.0.1:1"}, 1, dns.RcodeRefused, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collector := stats.NewCollector()
+			server, _ := NewServer(
+				"127.0.0.1:5353",
+				PlainUpstreams(tt.upstreams...),
+				500*time.Millisecond,
+				apiClient,
+				collector,
+				logger,
+				WithSoftFailureRetries(tt.retries),
+			)
+
+			r := new(dns.Msg)
+			r.SetQuestion("example.org.", dns.TypeA)
+			w := &mockDNSWriter{}
+			server.ServeDNS(w, r)
+
+			if w.msg == nil {
+				t.Fatal("Expected response message")
+			}
+			if w.msg.Rcode != tt.wantRcode {
+				t.Errorf("Expected rcode %s, got %s", dns.RcodeToString[tt.wantRcode], dns.RcodeToString[w.msg.Rcode])
+			}
+			if w.msg.Id != r.Id {
+				t.Errorf("Expected response ID %d, got %d", r.Id, w.msg.Id)
+			}
+			if got := collector.SoftFailureRetries(); got != tt.wantRetries {
+				t.Errorf("Expected %d soft failure retries, got %d", tt.wantRetries, got)
+			}
+		})
+	}
+}
+
+func TestServeDNSPolicy(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	apiClient := api.NewClient("https://api.example.com", "", 10*time.Second)
+	apiClient.SetBlocklistForTesting(&api.Blocklist{
+		BlockList: []api.BlockListItem{
+			{URL: "https://example.com", Employer: "Test Corp"},
+		},
+	})
+
+	store, _ := policy.NewStore("")
+	err := store.Apply(policy.State{
+		Allowlist: []string{"news.example.com"},
+		Blocks:    []policy.Block{{Domain: "scab.example", Employer: "Scab Staffing Inc"}},
+		Groups:    []policy.Group{{Name: "guests", Clients: []string{"10.9.0.0/16"}, Mode: policy.ModeOff}},
+	})
+	if err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	collector := stats.NewCollector(stats.WithClientStats(stats.ClientStatsConfig{}))
+	server, _ := NewServer(
+		"127.0.0.1:5353",
+		PlainUpstreams(startTestUpstream(t, dns.RcodeSuccess, "192.0.2.1")),
+		time.Second,
+		apiClient,
+		collector,
+		logger,
+		WithPolicy(store),
+	)
+
+	tests := []struct {
+		name   string
+		client string
+		domain string
+		wantIP string
+	}{
+		{"blocklist still applies", "192.168.1.50", "www.example.com", "0.0.0.0"},
+		{"allowlist overrides blocklist", "192.168.1.50", "news.example.com", "192.0.2.1"},
+		{"manual block", "192.168.1.50", "scab.example", "0.0.0.0"},
+		{"group with blocking off", "10.9.1.1", "example.com", "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := new(dns.Msg)
+			r.SetQuestion(dns.Fqdn(tt.domain), dns.TypeA)
+			w := &mockDNSWriter{remote: &net.UDPAddr{IP: net.ParseIP(tt.client), Port: 12345}}
+			server.ServeDNS(w, r)
+
+			if w.msg == nil || len(w.msg.Answer) != 1 {
+				t.Fatalf("Expected one answer, got %v", w.msg)
+			}
+			if ip := w.msg.Answer[0].(*dns.A).A.String(); ip != tt.wantIP {
+				t.Errorf("Expected %s, got %s", tt.wantIP, ip)
+			}
+		})
+	}
+
+	if q, u := collector.QueryLatency(), collector.UpstreamLatency(); q.Count != 4 || u.Count != 2 {
+		t.Errorf("Expected 4 query and 2 upstream timings, got %d and %d", q.Count, u.Count)
+	}
+
+	employers := collector.TopBlockedEmployers(10)
+	if len(employers) != 2 || employers[0].Employer != "Scab Staffing Inc" || employers[1].Employer != "Test Corp" {
+		t.Errorf("Unexpected employer counts %+v", employers)
+	}
+
+	clients := collector.TopClients(10)
+	if len(clients) != 2 || clients[0] != (stats.ClientCount{Client: "192.168.1.50", Queries: 3, Blocked: 2}) ||
+		clients[1] != (stats.ClientCount{Client: "10.9.1.1", Queries: 1}) {
+		t.Errorf("Unexpected client counts %+v", clients)
+	}
+
+	info, blocked := server.GetBlockedDomainInfo("scab.example")
+	if !blocked || info.Employer != "Scab Staffing Inc" || info.ActionType != "manual" {
+		t.Errorf("Expected manual block info, got %+v", info)
+	}
+}
+
 // mockDNSWriter is a mock implementation of dns.ResponseWriter
 type mockDNSWriter struct {
-	msg *dns.Msg
+	msg    *dns.Msg
+	remote net.Addr
 }
 
 func (m *mockDNSWriter) LocalAddr() net.Addr {
@@ -134,6 +394,9 @@ func (m *mockDNSWriter) LocalAddr() net.Addr {
 }
 
 func (m *mockDNSWriter) RemoteAddr() net.Addr {
+	if m.remote != nil {
+		return m.remote
+	}
 	return &net.UDPAddr{IP: net.ParseIP("192.168.1.50"), Port: 12345}
 }
 
@@ -169,3 +432,284 @@ func (m *mockUDPAddr) Network() string {
 func (m *mockUDPAddr) String() string {
 	return "192.168.1.50:12345"
 }
+
+func TestServeDNSTenants(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	apiClient := api.NewClient("https://api.example.com", "", 10*time.Second)
+	apiClient.SetBlocklistForTesting(&api.Blocklist{
+		BlockList: []api.BlockListItem{{URL: "https://example.com", Employer: "Test Corp"}},
+	})
+	tenantClient := api.NewClient("https://api.example.com", "", 10*time.Second)
+	tenantClient.SetBlocklistForTesting(&api.Blocklist{
+		BlockList: []api.BlockListItem{{URL: "https://tenant.example", Employer: "Tenant Corp"}},
+	})
+
+	collector, tenantCollector := stats.NewCollector(), stats.NewCollector()
+	tenants := new(ipmatch.Table[*Tenant])
+	tenants.Insert(netip.MustParsePrefix("10.12.0.0/16"), &Tenant{Name: "local-12", Blocklist: tenantClient, Stats: tenantCollector})
+	server, _ := NewServer(
+		"127.0.0.1:5353",
+		PlainUpstreams(startTestUpstream(t, dns.RcodeSuccess, "192.0.2.1")),
+		time.Second,
+		apiClient,
+		collector,
+		logger,
+		WithTenants(tenants),
+	)
+
+	tests := []struct {
+		client string
+		domain string
+		wantIP string
+	}{
+		{"192.168.1.50", "example.com", "0.0.0.0"},
+		{"192.168.1.50", "tenant.example", "192.0.2.1"},
+		{"10.12.3.4", "example.com", "192.0.2.1"},
+		{"10.12.3.4", "tenant.example", "0.0.0.0"},
+	}
+	for _, tt := range tests {
+		r := new(dns.Msg)
+		r.SetQuestion(dns.Fqdn(tt.domain), dns.TypeA)
+		w := &mockDNSWriter{remote: &net.UDPAddr{IP: net.ParseIP(tt.client), Port: 12345}}
+		server.ServeDNS(w, r)
+		if w.msg == nil || len(w.msg.Answer) != 1 {
+			t.Fatalf("Expected one answer for %s from %s, got %v", tt.domain, tt.client, w.msg)
+		}
+		if ip := w.msg.Answer[0].(*dns.A).A.String(); ip != tt.wantIP {
+			t.Errorf("Expected %s for %s from %s, got %s", tt.wantIP, tt.domain, tt.client, ip)
+		}
+	}
+
+	for name, c := range map[string]*stats.Collector{"server": collector, "tenant": tenantCollector} {
+		if total, blocked, _, _ := c.Snapshot(); total != 2 || blocked != 1 {
+			t.Errorf("Expected the %s collector to count 2 queries and 1 block, got %d and %d", name, total, blocked)
+		}
+	}
+	if d := server.Explain(netip.MustParseAddr("10.12.3.4"), "tenant.example"); !d.Blocked || d.Tenant != "local-12" {
+		t.Errorf("Expected the tenant's blocklist to explain the block, got %+v", d)
+	}
+}
+
+func TestPauseBlocking(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	apiClient := api.NewClient("https://api.example.com", "", 10*time.Second)
+	apiClient.SetBlocklistForTesting(&api.Blocklist{
+		BlockList: []api.BlockListItem{{URL: "https://example.com", Employer: "Test Corp"}},
+	})
+	server, _ := NewServer(
+		"127.0.0.1:5353",
+		PlainUpstreams(startTestUpstream(t, dns.RcodeSuccess, "192.0.2.1")),
+		time.Second,
+		apiClient,
+		nil,
+		logger,
+	)
+	answer := func() string {
+		t.Helper()
+		r := new(dns.Msg)
+		r.SetQuestion("example.com.", dns.TypeA)
+		w := &mockDNSWriter{}
+		server.ServeDNS(w, r)
+		if w.msg == nil || len(w.msg.Answer) != 1 {
+			t.Fatalf("Expected one answer, got %v", w.msg)
+		}
+		return w.msg.Answer[0].(*dns.A).A.String()
+	}
+
+	server.PauseBlocking(0)
+	if paused, until := server.BlockingPaused(); !paused || !until.IsZero() {
+		t.Errorf("Expected blocking paused until resumed, got %v until %v", paused, until)
+	}
+	if ip := answer(); ip != "192.0.2.1" {
+		t.Errorf("Expected the upstream answer while paused, got %s", ip)
+	}
+	if d := server.Explain(netip.Addr{}, "example.com"); d.Blocked || d.Source != SourcePaused {
+		t.Errorf("Expected the pause to explain the answer, got %+v", d)
+	}
+
+	server.ResumeBlocking()
+	if ip := answer(); ip != "0.0.0.0" {
+		t.Errorf("Expected blocking after resuming, got %s", ip)
+	}
+
+	server.PauseBlocking(time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if paused, _ := server.BlockingPaused(); paused {
+		t.Error("Expected a timed pause to end by itself")
+	}
+	if ip := answer(); ip != "0.0.0.0" {
+		t.Errorf("Expected blocking after the pause ended, got %s", ip)
+	}
+}
+
+func TestServeDNSTracing(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	apiClient := api.NewClient("https://api.example.com", "", 10*time.Second)
+
+	spans := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	defer provider.Shutdown(context.Background())
+
+	servfail := startTestUpstream(t, dns.RcodeServerFailure, "")
+	good := startTestUpstream(t, dns.RcodeSuccess, "192.0.2.1")
+	server, _ := NewServer(
+		"127.0.0.1:5353",
+		PlainUpstreams(servfail, good),
+		500*time.Millisecond,
+		apiClient,
+		nil,
+		logger,
+		WithSoftFailureRetries(1),
+		WithTracerProvider(provider),
+	)
+
+	r := new(dns.Msg)
+	r.SetQuestion("example.org.", dns.TypeA)
+	server.ServeDNS(&mockDNSWriter{}, r)
+
+	ended := spans.Ended()
+	if len(ended) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(ended))
+	}
+
+	query := ended[2]
+	if query.Name() != "dns.query" {
+		t.Fatalf("Expected the query span to end last, got %q", query.Name())
+	}
+	attrs := attribute.NewSet(query.Attributes()...)
+	if v, _ := attrs.Value("dns.qtype"); v.AsString() != "A" {
+		t.Errorf("Expected dns.qtype A, got %q", v.AsString())
+	}
+	if v, _ := attrs.Value("dns.rcode"); v.AsString() != "NOERROR" {
+		t.Errorf("Expected dns.rcode NOERROR, got %q", v.AsString())
+	}
+	for _, kv := range query.Attributes() {
+		if kv.Value.AsString() == "example.org" || kv.Value.AsString() == "example.org." {
+			t.Errorf("Query name recorded in attribute %s", kv.Key)
+		}
+	}
+
+	for i, want := range []struct {
+		upstream string
+		status   codes.Code
+	}{
+		{servfail, codes.Error},
+		{good, codes.Unset},
+	} {
+		span := ended[i]
+		if span.Name() != "dns.upstream" {
+			t.Errorf("Span %d: expected dns.upstream, got %q", i, span.Name())
+		}
+		if span.Parent().SpanID() != query.SpanContext().SpanID() {
+			t.Errorf("Span %d: expected the query span as parent", i)
+		}
+		attrs := attribute.NewSet(span.Attributes()...)
+		if v, _ := attrs.Value("dns.upstream"); v.AsString() != want.upstream {
+			t.Errorf("Span %d: expected upstream %s, got %q", i, want.upstream, v.AsString())
+		}
+		if span.Status().Code != want.status {
+			t.Errorf("Span %d: expected status %v, got %v", i, want.status, span.Status().Code)
+		}
+	}
+}
+
+func TestShutdownDrainsQueries(t *testing.T) {
+	// The upstream holds each query until released
+	received := make(chan struct{}, 2)
+	release := make(chan struct{})
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	started := make(chan struct{})
+	upstream := &dns.Server{
+		PacketConn:        pc,
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			received <- struct{}{}
+			<-release
+			m := new(dns.Msg)
+			m.SetReply(r)
+			w.WriteMsg(m)
+		}),
+	}
+	go upstream.ActivateAndServe()
+	<-started
+	t.Cleanup(func() { upstream.Shutdown() })
+
+	start := func() *Server {
+		server, _ := NewServer(
+			"127.0.0.1:0",
+			PlainUpstreams(pc.LocalAddr().String()),
+			5*time.Second,
+			api.NewClient("https://api.example.com", "", time.Second),
+			nil,
+			slog.New(slog.DiscardHandler),
+		)
+		if err := server.Listen(); err != nil {
+			t.Fatalf("Listen failed: %v", err)
+		}
+		go server.Start()
+		go server.StartTCP()
+		for !server.Serving() {
+			time.Sleep(5 * time.Millisecond)
+		}
+		return server
+	}
+	query := func(network, addr string) <-chan error {
+		answered := make(chan error, 1)
+		go func() {
+			m := new(dns.Msg)
+			m.SetQuestion("example.com.", dns.TypeA)
+			_, _, err := (&dns.Client{Net: network, Timeout: 5 * time.Second}).Exchange(m, addr)
+			answered <- err
+		}()
+		<-received
+		return answered
+	}
+
+	// Queries in flight on both transports are answered before Shutdown
+	// returns, and no new connections are accepted meanwhile
+	server := start()
+	addr := server.Addr().String()
+	udpAnswered, tcpAnswered := query("udp", addr), query("tcp", addr)
+	stopped := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stopped <- server.Shutdown(ctx)
+	}()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("Still accepting TCP connections while draining")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	release <- struct{}{}
+	release <- struct{}{}
+	if err := <-udpAnswered; err != nil {
+		t.Errorf("UDP query in flight was not answered: %v", err)
+	}
+	if err := <-tcpAnswered; err != nil {
+		t.Errorf("TCP query in flight was not answered: %v", err)
+	}
+	if err := <-stopped; err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+
+	// Past the deadline, Shutdown gives up on them
+	server = start()
+	query("udp", server.Addr().String())
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the deadline to pass, got %v", err)
+	}
+	close(release)
+}
@@ -0,0 +1,47 @@
+package dns
+
+import (
+	"net/netip"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/ipmatch"
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+)
+
+// Tenant is a member organization sharing the server. Queries from its
+// clients are checked against its own blocklist and counted in its own
+// stats; local policy applies to every tenant alike.
+type Tenant struct {
+	Name      string
+	Blocklist *api.Client
+
+	// Stats receives the tenant's query events. Upstream, rate limit and
+	// panic events are not per client and go to the server's recorder.
+	Stats stats.Recorder
+}
+
+// WithTenants serves clients in each tenant's prefixes with that tenant's
+// blocklist and stats. Clients outside every tenant are served with the
+// blocklist and recorder passed to NewServer.
+func WithTenants(tenants *ipmatch.Table[*Tenant]) Option {
+	return func(s *Server) {
+		s.tenants = tenants
+	}
+}
+
+// tenantFor returns the tenant serving client, or nil.
+func (s *Server) tenantFor(client netip.Addr) *Tenant {
+	if s.tenants == nil || !client.IsValid() {
+		return nil
+	}
+	t, _, _ := s.tenants.Lookup(client.Unmap())
+	return t
+}
+
+// serving returns the blocklist and recorder for queries from client.
+func (s *Server) serving(client netip.Addr) (*api.Client, stats.Recorder) {
+	if t := s.tenantFor(client); t != nil {
+		return t.Blocklist, t.Stats
+	}
+	return s.apiClient, s.stats
+}
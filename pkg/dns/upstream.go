@@ -0,0 +1,222 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Upstream protocols.
+const (
+	ProtocolUDP   = "udp"
+	ProtocolTCP   = "tcp"
+	ProtocolTLS   = "tls"
+	ProtocolHTTPS = "https"
+)
+
+// maxDoHResponseSize bounds a DNS-over-HTTPS response body; DNS messages
+// are at most 64 KiB.
+const maxDoHResponseSize = 65535
+
+// Upstream is a resolver that allowed queries are forwarded to.
+type Upstream struct {
+	// Addr is "host:port" for UDP, TCP and TLS, and the query URL for
+	// HTTPS.
+	Addr string
+
+	// Protocol is one of the Protocol constants. Empty means UDP.
+	Protocol string
+
+	// ServerName is the name verified in the resolver's TLS certificate
+	// and sent as SNI. Empty uses the host in Addr.
+	ServerName string
+
+	// Timeout bounds each exchange. Zero uses the server's query timeout.
+	Timeout time.Duration
+
+	// Weight is the upstream's share of first attempts among the weighted
+	// upstreams. Zero makes it a fallback, tried in order after all
+	// weighted upstreams.
+	Weight int
+
+	// HealthCheck includes the upstream in UpstreamHealth and so in health
+	// reports and upstream alerts.
+	HealthCheck bool
+}
+
+// PlainUpstreams returns health-checked UDP upstreams for addrs.
+func PlainUpstreams(addrs ...string) []Upstream {
+	upstreams := make([]Upstream, len(addrs))
+	for i, addr := range addrs {
+		upstreams[i] = Upstream{Addr: addr, HealthCheck: true}
+	}
+	return upstreams
+}
+
+// String names the upstream in logs, stats and health reports: Addr for
+// UDP, otherwise Addr with the protocol as a scheme.
+func (u Upstream) String() string {
+	switch u.Protocol {
+	case "", ProtocolUDP, ProtocolHTTPS:
+		return u.Addr
+	default:
+		return u.Protocol + "://" + u.Addr
+	}
+}
+
+// upstreamConn exchanges messages with one upstream.
+type upstreamConn struct {
+	Upstream
+	name   string
+	client *dns.Client
+	http   *http.Client
+}
+
+func newUpstreamConn(u Upstream, defaultTimeout time.Duration) *upstreamConn {
+	timeout := u.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	c := &upstreamConn{Upstream: u, name: u.String()}
+
+	var tlsConfig *tls.Config
+	if u.ServerName != "" {
+		tlsConfig = &tls.Config{ServerName: u.ServerName}
+	}
+	switch u.Protocol {
+	case ProtocolHTTPS:
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		c.http = &http.Client{Timeout: timeout, Transport: transport}
+	case ProtocolTLS:
+		if tlsConfig == nil {
+			host, _, _ := net.SplitHostPort(u.Addr)
+			tlsConfig = &tls.Config{ServerName: host}
+		}
+		c.client = &dns.Client{Net: "tcp-tls", Timeout: timeout, TLSConfig: tlsConfig}
+	case ProtocolTCP:
+		c.client = &dns.Client{Net: "tcp", Timeout: timeout}
+	default:
+		c.client = &dns.Client{Net: "udp", Timeout: timeout}
+	}
+	return c
+}
+
+func (c *upstreamConn) exchange(ctx context.Context, r *dns.Msg) (*dns.Msg, error) {
+	if c.http == nil {
+		resp, _, err := c.client.ExchangeContext(ctx, r, c.Addr)
+		return resp, err
+	}
+
+	// RFC 8484 recommends ID 0 so responses cache well
+	query := r.Copy()
+	query.Id = 0
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.Addr, bytes.NewReader(packed))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	httpResp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH server returned status %d", httpResp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, maxDoHResponseSize))
+	if err != nil {
+		return nil, err
+	}
+	resp := new(dns.Msg)
+	if err := resp.Unpack(body); err != nil {
+		return nil, fmt.Errorf("parsing DoH response: %w", err)
+	}
+	resp.Id = r.Id
+	return resp, nil
+}
+
+// upstreamSet is the upstreams in effect, ready to use.
+type upstreamSet struct {
+	conns    []*upstreamConn
+	weighted bool
+}
+
+func newUpstreamSet(upstreams []Upstream, defaultTimeout time.Duration) *upstreamSet {
+	set := &upstreamSet{}
+	for _, u := range upstreams {
+		set.conns = append(set.conns, newUpstreamConn(u, defaultTimeout))
+		if u.Weight > 0 {
+			set.weighted = true
+		}
+	}
+	return set
+}
+
+// order returns the upstreams in the order to try them for one query:
+// without weights, as configured; with weights, the weighted upstreams in a
+// random order where each comes first in proportion to its weight, followed
+// by the others as configured.
+func (set *upstreamSet) order() []*upstreamConn {
+	if !set.weighted {
+		return set.conns
+	}
+
+	// Weighted random sampling without replacement (Efraimidis-Spirakis):
+	// sorting by u^(1/w) puts each upstream first with probability w/sum(w)
+	type keyed struct {
+		conn *upstreamConn
+		key  float64
+	}
+	var weighted []keyed
+	var fallbacks []*upstreamConn
+	for _, c := range set.conns {
+		if c.Weight > 0 {
+			weighted = append(weighted, keyed{c, math.Pow(rand.Float64(), 1/float64(c.Weight))})
+		} else {
+			fallbacks = append(fallbacks, c)
+		}
+	}
+	slices.SortFunc(weighted, func(a, b keyed) int {
+		switch {
+		case a.key > b.key:
+			return -1
+		case a.key < b.key:
+			return 1
+		}
+		return 0
+	})
+
+	ordered := make([]*upstreamConn, 0, len(set.conns))
+	for _, k := range weighted {
+		ordered = append(ordered, k.conn)
+	}
+	return append(ordered, fallbacks...)
+}
+
+// healthChecked returns the names of the upstreams included in health
+// reporting.
+func healthChecked(upstreams []Upstream) []string {
+	var names []string
+	for _, u := range upstreams {
+		if u.HealthCheck {
+			names = append(names, u.String())
+		}
+	}
+	return names
+}
@@ -0,0 +1,106 @@
+package dns
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+)
+
+func TestUpstreamSetOrder(t *testing.T) {
+	set := newUpstreamSet([]Upstream{
+		{Addr: "192.0.2.1:53", Weight: 3},
+		{Addr: "192.0.2.2:53"},
+		{Addr: "192.0.2.3:53", Weight: 1},
+	}, time.Second)
+
+	first := map[string]int{}
+	for range 4000 {
+		order := set.order()
+		if len(order) != 3 || order[2].Addr != "192.0.2.2:53" {
+			t.Fatalf("Expected the unweighted upstream last, got %v", order)
+		}
+		first[order[0].Addr]++
+	}
+	// 3:1 weights put the first upstream first about 3000 times
+	if n := first["192.0.2.1:53"]; n < 2700 || n > 3300 {
+		t.Errorf("Expected about 3000 first attempts for weight 3, got %d", n)
+	}
+
+	unweighted := newUpstreamSet(PlainUpstreams("192.0.2.1:53", "192.0.2.2:53"), time.Second)
+	if order := unweighted.order(); order[0].Addr != "192.0.2.1:53" || order[1].Addr != "192.0.2.2:53" {
+		t.Errorf("Expected unweighted upstreams in configured order, got %v", order)
+	}
+}
+
+func TestUpstreamDoH(t *testing.T) {
+	doh := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		query := new(dns.Msg)
+		if err := query.Unpack(body); err != nil || query.Id != 0 {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		m := new(dns.Msg)
+		m.SetReply(query)
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: query.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+			A:   net.ParseIP("192.0.2.7"),
+		})
+		packed, _ := m.Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(packed)
+	}))
+	defer doh.Close()
+
+	conn := newUpstreamConn(Upstream{Addr: doh.URL, Protocol: ProtocolHTTPS}, time.Second)
+	r := new(dns.Msg)
+	r.SetQuestion("example.org.", dns.TypeA)
+	resp, err := conn.exchange(context.Background(), r)
+	if err != nil {
+		t.Fatalf("exchange failed: %v", err)
+	}
+	if resp.Id != r.Id {
+		t.Errorf("Expected the query ID restored, got %d want %d", resp.Id, r.Id)
+	}
+	if len(resp.Answer) != 1 || resp.Answer[0].(*dns.A).A.String() != "192.0.2.7" {
+		t.Errorf("Unexpected answer %v", resp.Answer)
+	}
+}
+
+func TestUpstreamHealthCheckDisabled(t *testing.T) {
+	checked := startTestUpstream(t, dns.RcodeSuccess, "192.0.2.1")
+	unchecked := Upstream{Addr: startTestUpstream(t, dns.RcodeSuccess, "192.0.2.2")}
+
+	server, _ := NewServer(
+		"127.0.0.1:0",
+		append([]Upstream{unchecked}, PlainUpstreams(checked)...),
+		time.Second,
+		api.NewClient("https://api.example.com", "", time.Second),
+		nil,
+		slog.New(slog.DiscardHandler),
+	)
+
+	r := new(dns.Msg)
+	r.SetQuestion("example.org.", dns.TypeA)
+	w := &mockDNSWriter{}
+	server.ServeDNS(w, r)
+	if w.msg == nil || len(w.msg.Answer) != 1 || w.msg.Answer[0].(*dns.A).A.String() != "192.0.2.2" {
+		t.Fatalf("Expected the unchecked upstream to answer, got %v", w.msg)
+	}
+
+	if health := server.UpstreamHealth(); len(health) != 1 || health[0].Addr != checked {
+		t.Errorf("Expected only the health-checked upstream reported, got %+v", health)
+	}
+}
@@ -0,0 +1,251 @@
+// Package ipmatch provides fast longest-prefix matching of IP addresses
+// against large sets of CIDR prefixes, for client ACLs, policy groups, and
+// trusted proxy lists.
+package ipmatch
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Table maps IP prefixes to values and finds the most specific prefix
+// containing an address. It is a path-compressed binary radix tree with
+// separate roots for IPv4 and IPv6; lookups cost at most one node visit per
+// distinct prefix length on the path, independent of the table size.
+//
+// A Table is safe for concurrent lookups once built. Inserts must not run
+// concurrently with other operations; callers that update at runtime should
+// build a new Table and swap it in.
+type Table[V any] struct {
+	v4, v6 *node[V]
+	size   int
+}
+
+type node[V any] struct {
+	key      [16]byte
+	bits     int
+	children [2]*node[V]
+	set      bool
+	val      V
+}
+
+// Insert adds prefix with value v, replacing the value if the prefix is
+// already present. IPv4-mapped IPv6 prefixes are stored as IPv4.
+func (t *Table[V]) Insert(prefix netip.Prefix, v V) {
+	prefix = normalize(prefix)
+	if !prefix.IsValid() {
+		return
+	}
+
+	root := &t.v6
+	if prefix.Addr().Is4() {
+		root = &t.v4
+	}
+	if insert(root, keyOf(prefix.Addr()), prefix.Bits(), v) {
+		t.size++
+	}
+}
+
+// Lookup returns the value and prefix of the most specific entry containing
+// addr.
+func (t *Table[V]) Lookup(addr netip.Addr) (V, netip.Prefix, bool) {
+	var zero V
+	if !addr.IsValid() {
+		return zero, netip.Prefix{}, false
+	}
+	addr = addr.Unmap()
+
+	root, maxBits := t.v6, 128
+	if addr.Is4() {
+		root, maxBits = t.v4, 32
+	}
+
+	key := keyOf(addr)
+	var best *node[V]
+	for n := root; n != nil; {
+		if commonLen(n.key, key, n.bits) < n.bits {
+			break
+		}
+		if n.set {
+			best = n
+		}
+		if n.bits == maxBits {
+			break
+		}
+		n = n.children[bitAt(key, n.bits)]
+	}
+
+	if best == nil {
+		return zero, netip.Prefix{}, false
+	}
+	return best.val, prefixOf(best.key, best.bits, addr.Is4()), true
+}
+
+// Contains reports whether any prefix in the table contains addr.
+func (t *Table[V]) Contains(addr netip.Addr) bool {
+	_, _, ok := t.Lookup(addr)
+	return ok
+}
+
+// Len returns the number of distinct prefixes in the table.
+func (t *Table[V]) Len() int {
+	return t.size
+}
+
+// insert adds a prefix under root and reports whether it was new.
+func insert[V any](root **node[V], key [16]byte, bits int, v V) bool {
+	for {
+		n := *root
+		if n == nil {
+			*root = &node[V]{key: mask(key, bits), bits: bits, set: true, val: v}
+			return true
+		}
+
+		common := commonLen(n.key, key, min(n.bits, bits))
+		if common == n.bits {
+			if bits == n.bits {
+				added := !n.set
+				n.set, n.val = true, v
+				return added
+			}
+			root = &n.children[bitAt(key, n.bits)]
+			continue
+		}
+
+		// The new prefix diverges inside this node's span: split at the
+		// common length.
+		parent := &node[V]{key: mask(key, common), bits: common}
+		parent.children[bitAt(n.key, common)] = n
+		if bits == common {
+			parent.set, parent.val = true, v
+		} else {
+			parent.children[bitAt(key, common)] = &node[V]{key: mask(key, bits), bits: bits, set: true, val: v}
+		}
+		*root = parent
+		return true
+	}
+}
+
+// Set is a set of IP prefixes.
+type Set struct {
+	t Table[struct{}]
+}
+
+// ParseSet builds a Set from CIDR strings. Bare addresses are treated as
+// single-host prefixes.
+func ParseSet(cidrs []string) (*Set, error) {
+	s := &Set{}
+	for _, c := range cidrs {
+		p, err := ParsePrefix(c)
+		if err != nil {
+			return nil, err
+		}
+		s.Add(p)
+	}
+	return s, nil
+}
+
+// Add adds prefix to the set.
+func (s *Set) Add(prefix netip.Prefix) {
+	s.t.Insert(prefix, struct{}{})
+}
+
+// Contains reports whether addr is covered by any prefix in the set.
+func (s *Set) Contains(addr netip.Addr) bool {
+	return s.t.Contains(addr)
+}
+
+// Len returns the number of distinct prefixes in the set.
+func (s *Set) Len() int {
+	return s.t.Len()
+}
+
+// ParsePrefix parses a CIDR such as "10.0.0.0/8" or a bare address such as
+// "192.168.1.5", which becomes a /32 (or /128). Host bits are masked off.
+func ParsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid CIDR %q: %w", s, err)
+		}
+		return normalize(p), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid IP address %q: %w", s, err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// normalize masks host bits and converts IPv4-mapped IPv6 prefixes to IPv4.
+func normalize(p netip.Prefix) netip.Prefix {
+	if !p.IsValid() {
+		return p
+	}
+	addr, bits := p.Addr(), p.Bits()
+	if addr.Is4In6() {
+		if bits < 96 {
+			return netip.PrefixFrom(addr, bits).Masked()
+		}
+		addr, bits = addr.Unmap(), bits-96
+	}
+	return netip.PrefixFrom(addr, bits).Masked()
+}
+
+// keyOf left-aligns the address bytes so IPv4 bit 0 is key bit 0.
+func keyOf(addr netip.Addr) [16]byte {
+	var key [16]byte
+	if addr.Is4() {
+		a4 := addr.As4()
+		copy(key[:], a4[:])
+		return key
+	}
+	return addr.As16()
+}
+
+func prefixOf(key [16]byte, bits int, is4 bool) netip.Prefix {
+	if is4 {
+		return netip.PrefixFrom(netip.AddrFrom4([4]byte(key[:4])), bits)
+	}
+	return netip.PrefixFrom(netip.AddrFrom16(key), bits)
+}
+
+func bitAt(key [16]byte, i int) int {
+	return int(key[i/8]>>(7-i%8)) & 1
+}
+
+// commonLen returns the number of leading bits a and b share, up to limit.
+func commonLen(a, b [16]byte, limit int) int {
+	n := 0
+	for i := 0; i < 16 && n < limit; i++ {
+		x := a[i] ^ b[i]
+		if x == 0 {
+			n += 8
+			continue
+		}
+		for x&0x80 == 0 {
+			n++
+			x <<= 1
+		}
+		break
+	}
+	return min(n, limit)
+}
+
+// mask clears all bits after the first bits bits.
+func mask(key [16]byte, bits int) [16]byte {
+	for i := range key {
+		switch {
+		case bits >= (i+1)*8:
+		case bits <= i*8:
+			key[i] = 0
+		default:
+			key[i] &= ^byte(0xff >> (bits - i*8))
+		}
+	}
+	return key
+}
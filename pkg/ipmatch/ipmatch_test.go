@@ -0,0 +1,215 @@
+package ipmatch
+
+import (
+	"math/rand"
+	"net/netip"
+	"testing"
+)
+
+func TestTableLookupLongestPrefix(t *testing.T) {
+	var table Table[string]
+	for cidr, name := range map[string]string{
+		"10.0.0.0/8":      "corp",
+		"10.1.0.0/16":     "office",
+		"10.1.2.0/24":     "lab",
+		"10.1.2.3/32":     "printer",
+		"0.0.0.0/0":       "default4",
+		"2001:db8::/32":   "doc",
+		"2001:db8:1::/48": "doc-office",
+	} {
+		table.Insert(netip.MustParsePrefix(cidr), name)
+	}
+
+	tests := []struct {
+		addr   string
+		want   string
+		prefix string
+	}{
+		{"10.1.2.3", "printer", "10.1.2.3/32"},
+		{"10.1.2.4", "lab", "10.1.2.0/24"},
+		{"10.1.3.1", "office", "10.1.0.0/16"},
+		{"10.200.0.1", "corp", "10.0.0.0/8"},
+		{"192.168.1.1", "default4", "0.0.0.0/0"},
+		{"::ffff:10.1.2.4", "lab", "10.1.2.0/24"},
+		{"2001:db8:1::5", "doc-office", "2001:db8:1::/48"},
+		{"2001:db8:2::5", "doc", "2001:db8::/32"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			got, prefix, ok := table.Lookup(netip.MustParseAddr(tt.addr))
+			if !ok {
+				t.Fatalf("Lookup(%s): expected match", tt.addr)
+			}
+			if got != tt.want {
+				t.Errorf("Lookup(%s): expected '%s', got '%s'", tt.addr, tt.want, got)
+			}
+			if prefix.String() != tt.prefix {
+				t.Errorf("Lookup(%s): expected prefix %s, got %s", tt.addr, tt.prefix, prefix)
+			}
+		})
+	}
+
+	if _, _, ok := table.Lookup(netip.MustParseAddr("2001:db9::1")); ok {
+		t.Error("Expected no match outside IPv6 prefixes")
+	}
+	if table.Len() != 7 {
+		t.Errorf("Expected 7 prefixes, got %d", table.Len())
+	}
+}
+
+func TestTableInsertReplaces(t *testing.T) {
+	var table Table[int]
+	table.Insert(netip.MustParsePrefix("192.168.0.0/16"), 1)
+	table.Insert(netip.MustParsePrefix("192.168.5.5/16"), 2) // host bits masked
+
+	if table.Len() != 1 {
+		t.Errorf("Expected 1 prefix, got %d", table.Len())
+	}
+	if v, _, _ := table.Lookup(netip.MustParseAddr("192.168.1.1")); v != 2 {
+		t.Errorf("Expected replaced value 2, got %d", v)
+	}
+}
+
+func TestParseSet(t *testing.T) {
+	set, err := ParseSet([]string{"192.168.1.0/24", "10.0.0.5", " fd00::/8 "})
+	if err != nil {
+		t.Fatalf("ParseSet failed: %v", err)
+	}
+
+	for addr, want := range map[string]bool{
+		"192.168.1.77": true,
+		"192.168.2.1":  false,
+		"10.0.0.5":     true,
+		"10.0.0.6":     false,
+		"fd12::1":      true,
+		"fe80::1":      false,
+	} {
+		if got := set.Contains(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("Contains(%s): expected %v, got %v", addr, want, got)
+		}
+	}
+
+	if _, err := ParseSet([]string{"not-an-ip"}); err == nil {
+		t.Error("Expected error for invalid address")
+	}
+	if _, err := ParseSet([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("Expected error for invalid CIDR")
+	}
+}
+
+// TestTableMatchesLinearScan cross-checks the tree against a brute-force
+// longest-prefix search over random data.
+func TestTableMatchesLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	prefixes := randomPrefixes(rng, 2000)
+
+	var table Table[int]
+	for i, p := range prefixes {
+		table.Insert(p, i)
+	}
+
+	for i := 0; i < 20000; i++ {
+		addr := randomAddr(rng)
+		want, wantOK := linearLookup(prefixes, addr)
+		got, _, gotOK := table.Lookup(addr)
+		if gotOK != wantOK || (gotOK && prefixes[got].Bits() != prefixes[want].Bits()) {
+			t.Fatalf("Lookup(%s): tree=%v/%v linear=%v/%v", addr, got, gotOK, want, wantOK)
+		}
+	}
+}
+
+func randomAddr(rng *rand.Rand) netip.Addr {
+	if rng.Intn(2) == 0 {
+		var b [4]byte
+		rng.Read(b[:])
+		// Concentrate addresses in 10/8 so lookups actually hit
+		b[0] = 10
+		return netip.AddrFrom4(b)
+	}
+	var b [16]byte
+	rng.Read(b[:])
+	b[0], b[1], b[2], b[3] = 0x20, 0x01, 0x0d, 0xb8
+	return netip.AddrFrom16(b)
+}
+
+func randomPrefixes(rng *rand.Rand, n int) []netip.Prefix {
+	seen := make(map[netip.Prefix]bool)
+	var prefixes []netip.Prefix
+	for len(prefixes) < n {
+		addr := randomAddr(rng)
+		bits := 8 + rng.Intn(25)
+		if addr.Is6() {
+			bits = 32 + rng.Intn(97)
+		}
+		p := netip.PrefixFrom(addr, bits).Masked()
+		if !seen[p] {
+			seen[p] = true
+			prefixes = append(prefixes, p)
+		}
+	}
+	return prefixes
+}
+
+func linearLookup(prefixes []netip.Prefix, addr netip.Addr) (int, bool) {
+	best, bestBits := -1, -1
+	for i, p := range prefixes {
+		if p.Contains(addr) && p.Bits() > bestBits {
+			best, bestBits = i, p.Bits()
+		}
+	}
+	return best, best >= 0
+}
+
+func benchmarkLookup(b *testing.B, n int) {
+	rng := rand.New(rand.NewSource(1))
+	prefixes := randomPrefixes(rng, n)
+
+	var table Table[int]
+	for i, p := range prefixes {
+		table.Insert(p, i)
+	}
+
+	addrs := make([]netip.Addr, 1024)
+	for i := range addrs {
+		addrs[i] = randomAddr(rng)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		table.Lookup(addrs[i%len(addrs)])
+	}
+}
+
+func BenchmarkLookup100(b *testing.B)    { benchmarkLookup(b, 100) }
+func BenchmarkLookup1000(b *testing.B)   { benchmarkLookup(b, 1000) }
+func BenchmarkLookup10000(b *testing.B)  { benchmarkLookup(b, 10000) }
+func BenchmarkLookup100000(b *testing.B) { benchmarkLookup(b, 100000) }
+
+// BenchmarkLinearScan10000 is the naive baseline the tree replaces.
+func BenchmarkLinearScan10000(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	prefixes := randomPrefixes(rng, 10000)
+	addrs := make([]netip.Addr, 1024)
+	for i := range addrs {
+		addrs[i] = randomAddr(rng)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		linearLookup(prefixes, addrs[i%len(addrs)])
+	}
+}
+
+func BenchmarkInsert10000(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	prefixes := randomPrefixes(rng, 10000)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var table Table[int]
+		for j, p := range prefixes {
+			table.Insert(p, j)
+		}
+	}
+}
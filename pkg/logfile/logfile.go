@@ -0,0 +1,153 @@
+// Package logfile writes log output to a file that rotates itself by size
+// and age, for routers and other small devices that have persistent storage
+// but no logrotate. Rotated files are kept as path.1 (newest) to path.N.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Options configures rotation. Zero values disable the corresponding limit.
+type Options struct {
+	// MaxSize rotates the file before a write would take it past this many
+	// bytes.
+	MaxSize int64
+
+	// MaxAge rotates the file once it has been written to for this long.
+	MaxAge time.Duration
+
+	// MaxBackups is how many rotated files are kept. With none, rotating
+	// discards the file's contents.
+	MaxBackups int
+}
+
+// File is an io.Writer that appends to a log file and rotates it. It is
+// safe for concurrent use.
+type File struct {
+	path string
+	opts Options
+	now  func() time.Time
+
+	mu      sync.Mutex
+	f       *os.File
+	size    int64
+	started time.Time
+}
+
+// Open opens path for appending, creating it and its directory if needed.
+func Open(path string, opts Options) (*File, error) {
+	if path == "" {
+		return nil, fmt.Errorf("log file path is required")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, fmt.Errorf("creating log directory: %w", err)
+	}
+	lf := &File{path: path, opts: opts, now: time.Now}
+	if err := lf.open(); err != nil {
+		return nil, err
+	}
+
+	// The last rotation happened when path.1 was last written, so the
+	// current file's age survives restarts
+	lf.started = lf.now()
+	if info, err := os.Stat(lf.backup(1)); err == nil && info.ModTime().Before(lf.started) {
+		lf.started = info.ModTime()
+	}
+	return lf, nil
+}
+
+func (lf *File) open() error {
+	f, err := os.OpenFile(lf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return fmt.Errorf("opening log file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("opening log file: %w", err)
+	}
+	lf.f, lf.size = f, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if the file is too large or too old.
+func (lf *File) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f == nil {
+		return 0, os.ErrClosed
+	}
+
+	if lf.size > 0 && lf.due(len(p)) {
+		// A file that could not be moved aside is still written to
+		if err := lf.rotate(); err != nil && lf.f == nil {
+			return 0, err
+		}
+	}
+	n, err := lf.f.Write(p)
+	lf.size += int64(n)
+	return n, err
+}
+
+// due reports whether the file must be rotated before writing n bytes.
+func (lf *File) due(n int) bool {
+	if lf.opts.MaxSize > 0 && lf.size+int64(n) > lf.opts.MaxSize {
+		return true
+	}
+	return lf.opts.MaxAge > 0 && lf.now().Sub(lf.started) >= lf.opts.MaxAge
+}
+
+// rotate shifts the backups up by one, moves the file to path.1 and starts
+// a new one.
+func (lf *File) rotate() error {
+	if err := lf.f.Close(); err != nil {
+		return fmt.Errorf("rotating log file: %w", err)
+	}
+	lf.f = nil
+
+	var err error
+	if lf.opts.MaxBackups > 0 {
+		os.Remove(lf.backup(lf.opts.MaxBackups))
+		for i := lf.opts.MaxBackups - 1; i >= 1; i-- {
+			if rerr := os.Rename(lf.backup(i), lf.backup(i+1)); rerr != nil && !os.IsNotExist(rerr) {
+				err = rerr
+			}
+		}
+		if rerr := os.Rename(lf.path, lf.backup(1)); rerr != nil {
+			err = rerr
+		}
+	} else {
+		err = os.Remove(lf.path)
+	}
+	if err != nil {
+		err = fmt.Errorf("rotating log file: %w", err)
+	}
+
+	// Keep logging even if the old file could not be moved aside
+	if oerr := lf.open(); oerr != nil {
+		return oerr
+	}
+	lf.started = lf.now()
+	return err
+}
+
+func (lf *File) backup(i int) string {
+	return lf.path + "." + strconv.Itoa(i)
+}
+
+// Close closes the file. Later writes fail.
+func (lf *File) Close() error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f == nil {
+		return nil
+	}
+	err := lf.f.Close()
+	lf.f = nil
+	return err
+}
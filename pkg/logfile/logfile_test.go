@@ -0,0 +1,106 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Reading %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestRotateBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "opl-dns.log")
+	lf, err := Open(path, Options{MaxSize: 10, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer lf.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := lf.Write([]byte(line)); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+
+	if got := readFile(t, path); got != "fourth\n" {
+		t.Errorf("Expected the newest line in the file, got %q", got)
+	}
+	if got := readFile(t, path+".1"); got != "third\n" {
+		t.Errorf("Expected the previous line in .1, got %q", got)
+	}
+	if got := readFile(t, path+".2"); got != "second\n" {
+		t.Errorf("Expected the line before in .2, got %q", got)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected only 2 backups, got .3 (err %v)", err)
+	}
+}
+
+func TestRotateByAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "opl-dns.log")
+	lf, err := Open(path, Options{MaxAge: time.Hour, MaxBackups: 1})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer lf.Close()
+	now := time.Now()
+	lf.now = func() time.Time { return now }
+	lf.started = now
+
+	lf.Write([]byte("old\n"))
+	now = now.Add(30 * time.Minute)
+	lf.Write([]byte("still current\n"))
+	now = now.Add(30 * time.Minute)
+	lf.Write([]byte("new\n"))
+
+	if got := readFile(t, path); got != "new\n" {
+		t.Errorf("Expected a new file after an hour, got %q", got)
+	}
+	if got := readFile(t, path+".1"); got != "old\nstill current\n" {
+		t.Errorf("Expected the first hour in .1, got %q", got)
+	}
+}
+
+func TestReopenAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "opl-dns.log")
+	for _, line := range []string{"before restart\n", "after restart\n"} {
+		lf, err := Open(path, Options{MaxSize: 1 << 20})
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		lf.Write([]byte(line))
+		lf.Close()
+	}
+
+	if got := readFile(t, path); got != "before restart\nafter restart\n" {
+		t.Errorf("Expected both lines, got %q", got)
+	}
+}
+
+func TestRotateWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "opl-dns.log")
+	lf, err := Open(path, Options{MaxSize: 10})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer lf.Close()
+
+	lf.Write([]byte("discarded\n"))
+	lf.Write([]byte("kept\n"))
+
+	if got := readFile(t, path); got != "kept\n" {
+		t.Errorf("Expected only the newest line, got %q", got)
+	}
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Errorf("Expected no backup, got err %v", err)
+	}
+}
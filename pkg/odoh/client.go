@@ -0,0 +1,176 @@
+package odoh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// configTTL is how long a target's config is reused before refetching it.
+const configTTL = time.Hour
+
+// maxMessageSize bounds responses read from the proxy and target.
+const maxMessageSize = 64 * 1024
+
+// Client sends DNS queries to an ODoH target through an oblivious proxy.
+type Client struct {
+	proxyURL   *url.URL
+	targetURL  *url.URL
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	config    *Config
+	fetchedAt time.Time
+}
+
+// NewClient creates a client that relays through proxyURL (e.g.
+// "https://odoh-proxy.example/proxy") to the target at targetURL (e.g.
+// "https://odoh.example/dns-query"). A nil httpClient uses
+// http.DefaultClient.
+func NewClient(proxyURL, targetURL string, httpClient *http.Client) (*Client, error) {
+	proxy, err := parseHTTPSURL("proxy", proxyURL)
+	if err != nil {
+		return nil, err
+	}
+	target, err := parseHTTPSURL("target", targetURL)
+	if err != nil {
+		return nil, err
+	}
+	if proxy.Host == target.Host {
+		return nil, fmt.Errorf("proxy and target must be different hosts")
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &Client{proxyURL: proxy, targetURL: target, httpClient: httpClient}, nil
+}
+
+func parseHTTPSURL(name, raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s URL: %w", name, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("invalid %s URL %q: must be an https:// URL", name, raw)
+	}
+	return u, nil
+}
+
+// String describes the upstream for logs.
+func (c *Client) String() string {
+	return fmt.Sprintf("odoh://%s via %s", c.targetURL.Host, c.proxyURL.Host)
+}
+
+// Exchange sends m to the target through the proxy and returns the answer.
+func (c *Client) Exchange(ctx context.Context, m *dns.Msg) (*dns.Msg, error) {
+	// RFC 8484 asks for ID 0 so identical queries are indistinguishable
+	q := m.Copy()
+	q.Id = 0
+	packed, err := q.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("packing query: %w", err)
+	}
+
+	resp, err := c.exchange(ctx, packed, false)
+	if err != nil {
+		return nil, err
+	}
+
+	answer := new(dns.Msg)
+	if err := answer.Unpack(resp); err != nil {
+		return nil, fmt.Errorf("unpacking response: %w", err)
+	}
+	answer.Id = m.Id
+	return answer, nil
+}
+
+func (c *Client) exchange(ctx context.Context, packed []byte, retried bool) ([]byte, error) {
+	cfg, err := c.targetConfig(ctx, retried)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, qc, err := cfg.EncryptQuery(packed)
+	if err != nil {
+		return nil, fmt.Errorf("encrypting query: %w", err)
+	}
+
+	reqURL := *c.proxyURL
+	params := reqURL.Query()
+	params.Set("targethost", c.targetURL.Host)
+	params.Set("targetpath", c.targetURL.EscapedPath())
+	reqURL.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, reqURL.String(), bytes.NewReader(encrypted))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", ContentType)
+	req.Header.Set("Accept", ContentType)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("sending query to proxy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// The target rejects queries for a key it no longer holds; fetch its
+	// current config once and retry.
+	if resp.StatusCode == http.StatusUnauthorized && !retried {
+		return c.exchange(ctx, packed, true)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxy returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	return qc.DecryptResponse(body)
+}
+
+// targetConfig returns the target's cached config, fetching it from
+// /.well-known/odohconfigs when missing, expired, or refresh is set.
+func (c *Client) targetConfig(ctx context.Context, refresh bool) (*Config, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.config != nil && !refresh && time.Since(c.fetchedAt) < configTTL {
+		return c.config, nil
+	}
+
+	configURL := url.URL{Scheme: c.targetURL.Scheme, Host: c.targetURL.Host, Path: "/.well-known/odohconfigs"}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, configURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching target config: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching target config: status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxMessageSize))
+	if err != nil {
+		return nil, fmt.Errorf("reading target config: %w", err)
+	}
+
+	cfg, err := ParseConfigs(body)
+	if err != nil {
+		return nil, fmt.Errorf("parsing target config: %w", err)
+	}
+	c.config, c.fetchedAt = cfg, time.Now()
+	return cfg, nil
+}
@@ -0,0 +1,235 @@
+package odoh
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// odohTestEnv runs a target resolver and an oblivious proxy in front of it.
+type odohTestEnv struct {
+	target *httptest.Server
+	proxy  *httptest.Server
+
+	mu          sync.Mutex
+	keys        *testTarget
+	configFetch atomic.Int32
+	proxied     atomic.Int32
+}
+
+func newODoHTestEnv(t *testing.T) *odohTestEnv {
+	t.Helper()
+	env := &odohTestEnv{keys: newTestTarget(t)}
+
+	env.target = httptest.NewTLSServer(http.HandlerFunc(env.serveTarget))
+	env.target.Config.ErrorLog = log.New(io.Discard, "", 0)
+	t.Cleanup(env.target.Close)
+
+	env.proxy = httptest.NewTLSServer(http.HandlerFunc(env.serveProxy))
+	env.proxy.Config.ErrorLog = log.New(io.Discard, "", 0)
+	t.Cleanup(env.proxy.Close)
+
+	return env
+}
+
+func (env *odohTestEnv) currentKeys() *testTarget {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	return env.keys
+}
+
+func (env *odohTestEnv) serveTarget(w http.ResponseWriter, r *http.Request) {
+	keys := env.currentKeys()
+
+	if r.URL.Path == "/.well-known/odohconfigs" {
+		env.configFetch.Add(1)
+		w.Write(keys.cfg.MarshalConfigs())
+		return
+	}
+	if r.URL.Path != "/dns-query" || r.Header.Get("Content-Type") != ContentType {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	query, qc, err := keys.decryptQuery(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	req := new(dns.Msg)
+	if err := req.Unpack(query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := new(dns.Msg)
+	resp.SetReply(req)
+	rr, _ := dns.NewRR(req.Question[0].Name + " 60 IN A 192.0.2.1")
+	resp.Answer = append(resp.Answer, rr)
+	packed, _ := resp.Pack()
+
+	encrypted, err := keys.encryptResponse(qc, packed)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Write(encrypted)
+}
+
+// serveProxy relays the request body to targethost/targetpath without
+// inspecting it.
+func (env *odohTestEnv) serveProxy(w http.ResponseWriter, r *http.Request) {
+	env.proxied.Add(1)
+	target := url.URL{
+		Scheme: "https",
+		Host:   r.URL.Query().Get("targethost"),
+		Path:   r.URL.Query().Get("targetpath"),
+	}
+	req, _ := http.NewRequestWithContext(r.Context(), http.MethodPost, target.String(), r.Body)
+	req.Header.Set("Content-Type", r.Header.Get("Content-Type"))
+
+	resp, err := env.target.Client().Do(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+func (env *odohTestEnv) client(t *testing.T) *Client {
+	t.Helper()
+	c, err := NewClient(env.proxy.URL+"/proxy", env.target.URL+"/dns-query", env.target.Client())
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return c
+}
+
+func TestClientExchange(t *testing.T) {
+	env := newODoHTestEnv(t)
+	c := env.client(t)
+
+	for i := 0; i < 2; i++ {
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+
+		resp, err := c.Exchange(context.Background(), m)
+		if err != nil {
+			t.Fatalf("Exchange() error = %v", err)
+		}
+		if resp.Id != m.Id {
+			t.Errorf("response ID = %d, want %d", resp.Id, m.Id)
+		}
+		if len(resp.Answer) != 1 {
+			t.Fatalf("expected 1 answer, got %d", len(resp.Answer))
+		}
+		if a, ok := resp.Answer[0].(*dns.A); !ok || a.A.String() != "192.0.2.1" {
+			t.Errorf("unexpected answer %v", resp.Answer[0])
+		}
+	}
+
+	if got := env.proxied.Load(); got != 2 {
+		t.Errorf("proxy relayed %d queries, want 2", got)
+	}
+	if got := env.configFetch.Load(); got != 1 {
+		t.Errorf("config fetched %d times, want 1", got)
+	}
+}
+
+func TestClientRefetchesRotatedConfig(t *testing.T) {
+	env := newODoHTestEnv(t)
+	c := env.client(t)
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	if _, err := c.Exchange(context.Background(), m); err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	env.mu.Lock()
+	env.keys = newTestTarget(t)
+	env.mu.Unlock()
+
+	if _, err := c.Exchange(context.Background(), m); err != nil {
+		t.Fatalf("Exchange() after key rotation error = %v", err)
+	}
+	if got := env.configFetch.Load(); got != 2 {
+		t.Errorf("config fetched %d times, want 2", got)
+	}
+}
+
+func TestClientProxyError(t *testing.T) {
+	env := newODoHTestEnv(t)
+	env.proxy.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusBadGateway)
+	})
+	c := env.client(t)
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	if _, err := c.Exchange(context.Background(), m); err == nil {
+		t.Error("expected error when the proxy fails")
+	}
+}
+
+func TestNewClientErrors(t *testing.T) {
+	tests := []struct {
+		name, proxy, target string
+	}{
+		{"plain HTTP proxy", "http://proxy.example/proxy", "https://target.example/dns-query"},
+		{"missing target host", "https://proxy.example/proxy", "https:///dns-query"},
+		{"same host", "https://odoh.example/proxy", "https://odoh.example/dns-query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewClient(tt.proxy, tt.target, nil); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestClientQueryIDIsZero(t *testing.T) {
+	env := newODoHTestEnv(t)
+	var sawID atomic.Int32
+	sawID.Store(-1)
+
+	inner := env.target.Config.Handler
+	env.target.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			body, _ := io.ReadAll(r.Body)
+			if query, _, err := env.currentKeys().decryptQuery(body); err == nil {
+				req := new(dns.Msg)
+				if req.Unpack(query) == nil {
+					sawID.Store(int32(req.Id))
+				}
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		inner.ServeHTTP(w, r)
+	})
+
+	m := new(dns.Msg)
+	m.SetQuestion("example.com.", dns.TypeA)
+	m.Id = 4242
+	if _, err := env.client(t).Exchange(context.Background(), m); err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if got := sawID.Load(); got != 0 {
+		t.Errorf("target saw query ID %d, want 0", got)
+	}
+}
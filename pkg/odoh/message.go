@@ -0,0 +1,274 @@
+// Package odoh implements an Oblivious DNS over HTTPS (RFC 9230) client.
+// Queries are encrypted to the target resolver's public key and relayed by a
+// separate proxy, so the proxy learns who is asking but not what, and the
+// target learns what is asked but not by whom.
+package odoh
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/cloudflare/circl/hpke"
+	"github.com/cloudflare/circl/kem"
+)
+
+// ContentType is the media type of ODoH requests and responses.
+const ContentType = "application/oblivious-dns-message"
+
+const (
+	configVersion = 0x0001
+
+	messageTypeQuery    = 0x01
+	messageTypeResponse = 0x02
+
+	labelQuery    = "odoh query"
+	labelResponse = "odoh response"
+	labelKeyID    = "odoh key id"
+	labelKey      = "odoh key"
+	labelNonce    = "odoh nonce"
+)
+
+// Config is a target's ObliviousDoHConfigContents: the HPKE suite and public
+// key that queries are encrypted to.
+type Config struct {
+	KEM       hpke.KEM
+	KDF       hpke.KDF
+	AEAD      hpke.AEAD
+	PublicKey []byte
+
+	pk kem.PublicKey
+}
+
+// ParseConfigs decodes an ObliviousDoHConfigs structure, as served at
+// /.well-known/odohconfigs, and returns the first config this client
+// supports.
+func ParseConfigs(data []byte) (*Config, error) {
+	r := bytes.NewReader(data)
+	list, err := readVector(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading configs: %w", err)
+	}
+
+	r = bytes.NewReader(list)
+	for r.Len() > 0 {
+		var version uint16
+		if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+			return nil, fmt.Errorf("reading config version: %w", err)
+		}
+		contents, err := readVector(r)
+		if err != nil {
+			return nil, fmt.Errorf("reading config: %w", err)
+		}
+		if version != configVersion {
+			continue
+		}
+
+		cfg, err := parseConfigContents(contents)
+		if err != nil {
+			continue
+		}
+		return cfg, nil
+	}
+	return nil, errors.New("no supported ODoH config")
+}
+
+func parseConfigContents(data []byte) (*Config, error) {
+	r := bytes.NewReader(data)
+	var ids [3]uint16
+	if err := binary.Read(r, binary.BigEndian, &ids); err != nil {
+		return nil, err
+	}
+	publicKey, err := readVector(r)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{
+		KEM:       hpke.KEM(ids[0]),
+		KDF:       hpke.KDF(ids[1]),
+		AEAD:      hpke.AEAD(ids[2]),
+		PublicKey: publicKey,
+	}
+	if !cfg.KEM.IsValid() || !cfg.KDF.IsValid() || !cfg.AEAD.IsValid() {
+		return nil, fmt.Errorf("unsupported HPKE suite %#x/%#x/%#x", ids[0], ids[1], ids[2])
+	}
+	if cfg.pk, err = cfg.KEM.Scheme().UnmarshalBinaryPublicKey(publicKey); err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return cfg, nil
+}
+
+// contents serializes the config as ObliviousDoHConfigContents.
+func (c *Config) contents() []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, [3]uint16{uint16(c.KEM), uint16(c.KDF), uint16(c.AEAD)})
+	writeVector(&b, c.PublicKey)
+	return b.Bytes()
+}
+
+// MarshalConfigs serializes c as a single-entry ObliviousDoHConfigs
+// structure.
+func (c *Config) MarshalConfigs() []byte {
+	var cfg bytes.Buffer
+	binary.Write(&cfg, binary.BigEndian, uint16(configVersion))
+	writeVector(&cfg, c.contents())
+
+	var b bytes.Buffer
+	writeVector(&b, cfg.Bytes())
+	return b.Bytes()
+}
+
+// KeyID identifies the config to the target.
+func (c *Config) KeyID() []byte {
+	prk := c.KDF.Extract(c.contents(), nil)
+	return c.KDF.Expand(prk, []byte(labelKeyID), uint(c.KDF.ExtractSize()))
+}
+
+// QueryContext holds the state needed to decrypt the response to one query.
+type QueryContext struct {
+	cfg       *Config
+	plaintext []byte
+	secret    []byte
+}
+
+// EncryptQuery encrypts a wire-format DNS message into an ObliviousDoHMessage.
+func (c *Config) EncryptQuery(dnsMessage []byte) ([]byte, *QueryContext, error) {
+	sender, err := hpke.NewSuite(c.KEM, c.KDF, c.AEAD).NewSender(c.pk, []byte(labelQuery))
+	if err != nil {
+		return nil, nil, err
+	}
+	enc, sealer, err := sender.Setup(rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plaintext := encodePlaintext(dnsMessage)
+	keyID := c.KeyID()
+	ct, err := sealer.Seal(plaintext, messageAAD(messageTypeQuery, keyID))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	qc := &QueryContext{
+		cfg:       c,
+		plaintext: plaintext,
+		secret:    sealer.Export([]byte(labelResponse), c.AEAD.KeySize()),
+	}
+	return encodeMessage(messageTypeQuery, keyID, append(enc, ct...)), qc, nil
+}
+
+// DecryptResponse decrypts an ObliviousDoHMessage response and returns the
+// wire-format DNS message inside it.
+func (qc *QueryContext) DecryptResponse(message []byte) ([]byte, error) {
+	msgType, nonce, ct, err := decodeMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	if msgType != messageTypeResponse {
+		return nil, fmt.Errorf("unexpected message type %d", msgType)
+	}
+
+	aead, aeadNonce, err := qc.responseKeys(nonce)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := aead.Open(nil, aeadNonce, ct, messageAAD(messageTypeResponse, nonce))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting response: %w", err)
+	}
+	return decodePlaintext(plaintext)
+}
+
+// responseKeys derives the response AEAD key and nonce from the exported
+// secret, bound to the query plaintext and the target's response nonce.
+func (qc *QueryContext) responseKeys(responseNonce []byte) (cipher.AEAD, []byte, error) {
+	var salt bytes.Buffer
+	salt.Write(qc.plaintext)
+	writeVector(&salt, responseNonce)
+	prk := qc.cfg.KDF.Extract(qc.secret, salt.Bytes())
+
+	key := qc.cfg.KDF.Expand(prk, []byte(labelKey), qc.cfg.AEAD.KeySize())
+	aead, err := qc.cfg.AEAD.New(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, qc.cfg.KDF.Expand(prk, []byte(labelNonce), qc.cfg.AEAD.NonceSize()), nil
+}
+
+func encodePlaintext(dnsMessage []byte) []byte {
+	var b bytes.Buffer
+	writeVector(&b, dnsMessage)
+	writeVector(&b, nil) // no padding
+	return b.Bytes()
+}
+
+func decodePlaintext(data []byte) ([]byte, error) {
+	r := bytes.NewReader(data)
+	msg, err := readVector(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading DNS message: %w", err)
+	}
+	padding, err := readVector(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading padding: %w", err)
+	}
+	for _, b := range padding {
+		if b != 0 {
+			return nil, errors.New("non-zero padding")
+		}
+	}
+	return msg, nil
+}
+
+func messageAAD(msgType byte, keyID []byte) []byte {
+	var b bytes.Buffer
+	b.WriteByte(msgType)
+	writeVector(&b, keyID)
+	return b.Bytes()
+}
+
+func encodeMessage(msgType byte, keyID, encrypted []byte) []byte {
+	var b bytes.Buffer
+	b.WriteByte(msgType)
+	writeVector(&b, keyID)
+	writeVector(&b, encrypted)
+	return b.Bytes()
+}
+
+func decodeMessage(data []byte) (msgType byte, keyID, encrypted []byte, err error) {
+	r := bytes.NewReader(data)
+	if msgType, err = r.ReadByte(); err != nil {
+		return 0, nil, nil, fmt.Errorf("reading message type: %w", err)
+	}
+	if keyID, err = readVector(r); err != nil {
+		return 0, nil, nil, fmt.Errorf("reading key ID: %w", err)
+	}
+	if encrypted, err = readVector(r); err != nil {
+		return 0, nil, nil, fmt.Errorf("reading encrypted message: %w", err)
+	}
+	return msgType, keyID, encrypted, nil
+}
+
+// writeVector writes data with a 16-bit length prefix.
+func writeVector(b *bytes.Buffer, data []byte) {
+	binary.Write(b, binary.BigEndian, uint16(len(data)))
+	b.Write(data)
+}
+
+// readVector reads data with a 16-bit length prefix.
+func readVector(r *bytes.Reader) ([]byte, error) {
+	var n uint16
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	if int(n) > r.Len() {
+		return nil, errors.New("truncated")
+	}
+	data := make([]byte, n)
+	r.Read(data)
+	return data, nil
+}
@@ -0,0 +1,208 @@
+package odoh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/cloudflare/circl/hpke"
+	"github.com/cloudflare/circl/kem"
+)
+
+// testTarget is the target side of the protocol, used to check the client
+// against an independent decryption path.
+type testTarget struct {
+	cfg *Config
+	sk  kem.PrivateKey
+}
+
+func newTestTarget(t *testing.T) *testTarget {
+	t.Helper()
+	k := hpke.KEM_X25519_HKDF_SHA256
+	pk, sk, err := k.Scheme().GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkBytes, err := pk.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testTarget{
+		cfg: &Config{
+			KEM:       k,
+			KDF:       hpke.KDF_HKDF_SHA256,
+			AEAD:      hpke.AEAD_AES128GCM,
+			PublicKey: pkBytes,
+			pk:        pk,
+		},
+		sk: sk,
+	}
+}
+
+// decryptQuery returns the DNS message in an encrypted query and the context
+// needed to answer it.
+func (tt *testTarget) decryptQuery(message []byte) ([]byte, *QueryContext, error) {
+	msgType, keyID, encrypted, err := decodeMessage(message)
+	if err != nil {
+		return nil, nil, err
+	}
+	if msgType != messageTypeQuery {
+		return nil, nil, fmt.Errorf("unexpected message type %d", msgType)
+	}
+	if !bytes.Equal(keyID, tt.cfg.KeyID()) {
+		return nil, nil, fmt.Errorf("unknown key ID")
+	}
+
+	encSize := tt.cfg.KEM.Scheme().CiphertextSize()
+	if len(encrypted) < encSize {
+		return nil, nil, fmt.Errorf("truncated query")
+	}
+	receiver, err := hpke.NewSuite(tt.cfg.KEM, tt.cfg.KDF, tt.cfg.AEAD).NewReceiver(tt.sk, []byte(labelQuery))
+	if err != nil {
+		return nil, nil, err
+	}
+	opener, err := receiver.Setup(encrypted[:encSize])
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, err := opener.Open(encrypted[encSize:], messageAAD(messageTypeQuery, keyID))
+	if err != nil {
+		return nil, nil, err
+	}
+	msg, err := decodePlaintext(plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	qc := &QueryContext{
+		cfg:       tt.cfg,
+		plaintext: plaintext,
+		secret:    opener.Export([]byte(labelResponse), tt.cfg.AEAD.KeySize()),
+	}
+	return msg, qc, nil
+}
+
+// encryptResponse seals a DNS answer for the query behind qc.
+func (tt *testTarget) encryptResponse(qc *QueryContext, dnsMessage []byte) ([]byte, error) {
+	nonce := make([]byte, max(tt.cfg.AEAD.KeySize(), tt.cfg.AEAD.NonceSize()))
+	rand.Read(nonce)
+
+	aead, aeadNonce, err := qc.responseKeys(nonce)
+	if err != nil {
+		return nil, err
+	}
+	ct := aead.Seal(nil, aeadNonce, encodePlaintext(dnsMessage), messageAAD(messageTypeResponse, nonce))
+	return encodeMessage(messageTypeResponse, nonce, ct), nil
+}
+
+func TestConfigsRoundTrip(t *testing.T) {
+	target := newTestTarget(t)
+
+	cfg, err := ParseConfigs(target.cfg.MarshalConfigs())
+	if err != nil {
+		t.Fatalf("ParseConfigs() error = %v", err)
+	}
+	if cfg.KEM != target.cfg.KEM || cfg.KDF != target.cfg.KDF || cfg.AEAD != target.cfg.AEAD {
+		t.Errorf("suite = %v/%v/%v, want %v/%v/%v", cfg.KEM, cfg.KDF, cfg.AEAD, target.cfg.KEM, target.cfg.KDF, target.cfg.AEAD)
+	}
+	if !bytes.Equal(cfg.KeyID(), target.cfg.KeyID()) {
+		t.Error("parsed config has a different key ID")
+	}
+}
+
+func TestParseConfigsSkipsUnsupported(t *testing.T) {
+	target := newTestTarget(t)
+
+	// An unknown version ahead of a supported config
+	var list bytes.Buffer
+	list.Write([]byte{0xff, 0x00})
+	writeVector(&list, []byte{1, 2, 3})
+	list.Write([]byte{0x00, 0x01})
+	writeVector(&list, target.cfg.contents())
+
+	var b bytes.Buffer
+	writeVector(&b, list.Bytes())
+
+	cfg, err := ParseConfigs(b.Bytes())
+	if err != nil {
+		t.Fatalf("ParseConfigs() error = %v", err)
+	}
+	if !bytes.Equal(cfg.PublicKey, target.cfg.PublicKey) {
+		t.Error("expected the supported config to be selected")
+	}
+}
+
+func TestParseConfigsErrors(t *testing.T) {
+	tests := map[string][]byte{
+		"empty":       nil,
+		"truncated":   {0x00, 0x10, 0x00, 0x01},
+		"no versions": {0x00, 0x00},
+		"bad suite":   {0x00, 0x0c, 0x00, 0x01, 0x00, 0x08, 0xff, 0xff, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00},
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseConfigs(data); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestQueryResponseRoundTrip(t *testing.T) {
+	target := newTestTarget(t)
+	query := []byte("example query")
+	answer := []byte("example answer")
+
+	encrypted, qc, err := target.cfg.EncryptQuery(query)
+	if err != nil {
+		t.Fatalf("EncryptQuery() error = %v", err)
+	}
+
+	got, targetQC, err := target.decryptQuery(encrypted)
+	if err != nil {
+		t.Fatalf("target could not decrypt query: %v", err)
+	}
+	if !bytes.Equal(got, query) {
+		t.Errorf("target decrypted %q, want %q", got, query)
+	}
+
+	response, err := target.encryptResponse(targetQC, answer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = qc.DecryptResponse(response)
+	if err != nil {
+		t.Fatalf("DecryptResponse() error = %v", err)
+	}
+	if !bytes.Equal(got, answer) {
+		t.Errorf("DecryptResponse() = %q, want %q", got, answer)
+	}
+}
+
+func TestDecryptResponseRejectsTampering(t *testing.T) {
+	target := newTestTarget(t)
+
+	encrypted, qc, err := target.cfg.EncryptQuery([]byte("query"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, targetQC, err := target.decryptQuery(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := target.encryptResponse(targetQC, []byte("answer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response[len(response)-1] ^= 0xff
+	if _, err := qc.DecryptResponse(response); err == nil {
+		t.Error("expected error for tampered response")
+	}
+
+	// A query message is not a response
+	if _, err := qc.DecryptResponse(encrypted); err == nil {
+		t.Error("expected error for query message type")
+	}
+}
@@ -0,0 +1,426 @@
+// Package policy holds locally managed DNS policy: allowlisted domains,
+// manual block entries, and client policy groups. Operators edit it through
+// the admin UI, and it is persisted to a state file separate from
+// config.json.
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/ipmatch"
+)
+
+// Group modes.
+const (
+	// ModeEnforce applies the blocklist to the group's clients (the default).
+	ModeEnforce = "enforce"
+	// ModeOff exempts the group's clients from all blocking.
+	ModeOff = "off"
+)
+
+// State is the persisted, editable form of the local policy.
+type State struct {
+	// Allowlist holds domains that are never blocked, including their
+	// subdomains, regardless of the OPL blocklist.
+	Allowlist []string `json:"allowlist"`
+
+	// Blocks holds domains blocked locally in addition to the OPL blocklist.
+	Blocks []Block `json:"blocks"`
+
+	// Groups assigns per-client policy by source address.
+	Groups []Group `json:"groups"`
+}
+
+// Block is a manually added block entry.
+type Block struct {
+	Domain   string `json:"domain"`
+	Employer string `json:"employer,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Group applies policy to clients whose address falls in one of its
+// prefixes. When prefixes of several groups overlap, the most specific
+// prefix wins.
+type Group struct {
+	Name string `json:"name"`
+
+	// Clients lists CIDRs or bare IP addresses.
+	Clients []string `json:"clients"`
+
+	// Mode is ModeEnforce or ModeOff. Empty means ModeEnforce.
+	Mode string `json:"mode,omitempty"`
+
+	// Allowlist holds extra domains never blocked for this group.
+	Allowlist []string `json:"allowlist,omitempty"`
+
+	// Schedule limits when the group applies. Outside all of its windows
+	// the group's clients are treated as belonging to no group. Empty
+	// means always.
+	Schedule []Window `json:"schedule,omitempty"`
+}
+
+// Window is a daily time range in the server's local time zone.
+type Window struct {
+	// Days are three-letter weekday names, "mon" to "sun", on which the
+	// window starts. Empty means every day.
+	Days []string `json:"days,omitempty"`
+
+	// Start and End are "15:04" times. A window whose End is not after its
+	// Start runs past midnight into the next day.
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// weekdays maps Window.Days names to weekdays.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Verdict is the outcome of evaluating local policy for a query.
+type Verdict int
+
+const (
+	// VerdictDefault means local policy has no opinion; consult the blocklist.
+	VerdictDefault Verdict = iota
+	// VerdictAllow means the query must not be blocked.
+	VerdictAllow
+	// VerdictBlock means the query is blocked by a manual entry.
+	VerdictBlock
+)
+
+// domainPattern matches a lowercase domain name without a trailing dot.
+var domainPattern = regexp.MustCompile(`^([a-z0-9_]([a-z0-9_-]{0,61}[a-z0-9_])?\.)*[a-z0-9_]([a-z0-9_-]{0,61}[a-z0-9_])?$`)
+
+// NormalizeDomain lowercases domain and strips surrounding whitespace and a
+// trailing dot.
+func NormalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// Normalize returns a copy of s with domains normalized, modes defaulted, and
+// surrounding whitespace removed.
+func (s State) Normalize() State {
+	out := State{
+		Allowlist: make([]string, 0, len(s.Allowlist)),
+		Blocks:    make([]Block, 0, len(s.Blocks)),
+		Groups:    make([]Group, 0, len(s.Groups)),
+	}
+	for _, d := range s.Allowlist {
+		out.Allowlist = append(out.Allowlist, NormalizeDomain(d))
+	}
+	for _, b := range s.Blocks {
+		out.Blocks = append(out.Blocks, Block{
+			Domain:   NormalizeDomain(b.Domain),
+			Employer: strings.TrimSpace(b.Employer),
+			Reason:   strings.TrimSpace(b.Reason),
+		})
+	}
+	for _, g := range s.Groups {
+		ng := Group{
+			Name:    strings.TrimSpace(g.Name),
+			Clients: make([]string, 0, len(g.Clients)),
+			Mode:    strings.ToLower(strings.TrimSpace(g.Mode)),
+		}
+		if ng.Mode == "" {
+			ng.Mode = ModeEnforce
+		}
+		for _, c := range g.Clients {
+			ng.Clients = append(ng.Clients, strings.TrimSpace(c))
+		}
+		for _, d := range g.Allowlist {
+			ng.Allowlist = append(ng.Allowlist, NormalizeDomain(d))
+		}
+		for _, w := range g.Schedule {
+			nw := Window{Start: strings.TrimSpace(w.Start), End: strings.TrimSpace(w.End)}
+			for _, d := range w.Days {
+				nw.Days = append(nw.Days, strings.ToLower(strings.TrimSpace(d)))
+			}
+			ng.Schedule = append(ng.Schedule, nw)
+		}
+		out.Groups = append(out.Groups, ng)
+	}
+	return out
+}
+
+// Validate reports every problem in s, joined into one error. s should be
+// normalized first.
+func (s State) Validate() error {
+	var errs []error
+
+	allowed := make(map[string]bool)
+	for _, d := range s.Allowlist {
+		if !domainPattern.MatchString(d) {
+			errs = append(errs, fmt.Errorf("allowlist: %q is not a valid domain name", d))
+			continue
+		}
+		if allowed[d] {
+			errs = append(errs, fmt.Errorf("allowlist: %q is listed more than once", d))
+		}
+		allowed[d] = true
+	}
+
+	blocked := make(map[string]bool)
+	for _, b := range s.Blocks {
+		switch {
+		case !domainPattern.MatchString(b.Domain):
+			errs = append(errs, fmt.Errorf("blocks: %q is not a valid domain name", b.Domain))
+		case blocked[b.Domain]:
+			errs = append(errs, fmt.Errorf("blocks: %q is listed more than once", b.Domain))
+		case allowed[b.Domain]:
+			errs = append(errs, fmt.Errorf("blocks: %q is also on the allowlist", b.Domain))
+		}
+		blocked[b.Domain] = true
+	}
+
+	names := make(map[string]bool)
+	for i, g := range s.Groups {
+		label := g.Name
+		if label == "" {
+			label = fmt.Sprintf("#%d", i+1)
+			errs = append(errs, fmt.Errorf("groups[%s]: name is required", label))
+		} else if names[g.Name] {
+			errs = append(errs, fmt.Errorf("groups[%s]: name is used more than once", label))
+		}
+		names[g.Name] = true
+
+		if g.Mode != ModeEnforce && g.Mode != ModeOff {
+			errs = append(errs, fmt.Errorf("groups[%s]: mode must be %q or %q (got %q)", label, ModeEnforce, ModeOff, g.Mode))
+		}
+		if len(g.Clients) == 0 {
+			errs = append(errs, fmt.Errorf("groups[%s]: at least one client address or CIDR is required", label))
+		}
+		for _, c := range g.Clients {
+			if _, err := ipmatch.ParsePrefix(c); err != nil {
+				errs = append(errs, fmt.Errorf("groups[%s]: %w", label, err))
+			}
+		}
+		for _, d := range g.Allowlist {
+			if !domainPattern.MatchString(d) {
+				errs = append(errs, fmt.Errorf("groups[%s]: allowlist entry %q is not a valid domain name", label, d))
+			}
+		}
+		for _, w := range g.Schedule {
+			if _, err := compileWindow(w); err != nil {
+				errs = append(errs, fmt.Errorf("groups[%s]: schedule: %w", label, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Policy is a compiled, read-only State ready for per-query evaluation. A nil
+// *Policy has no opinion on any query.
+type Policy struct {
+	state  State
+	allow  map[string]struct{}
+	blocks map[string]*Block
+	groups ipmatch.Table[*group]
+}
+
+type group struct {
+	name     string
+	mode     string
+	allow    map[string]struct{}
+	schedule []window
+}
+
+// window is a compiled Window. days is a bitmask of weekdays, with 0 for
+// every day; start and end are minutes after midnight.
+type window struct {
+	days       uint8
+	start, end int
+}
+
+func compileWindow(w Window) (window, error) {
+	var cw window
+	for _, d := range w.Days {
+		day, ok := weekdays[d]
+		if !ok {
+			return window{}, fmt.Errorf("%q is not a day; use mon, tue, wed, thu, fri, sat or sun", d)
+		}
+		cw.days |= 1 << day
+	}
+	start, err := time.Parse("15:04", w.Start)
+	if err != nil {
+		return window{}, fmt.Errorf("start %q is not a 15:04 time", w.Start)
+	}
+	end, err := time.Parse("15:04", w.End)
+	if err != nil {
+		return window{}, fmt.Errorf("end %q is not a 15:04 time", w.End)
+	}
+	cw.start = start.Hour()*60 + start.Minute()
+	cw.end = end.Hour()*60 + end.Minute()
+	return cw, nil
+}
+
+// on reports whether the window starts on day.
+func (w window) on(day time.Weekday) bool {
+	return w.days == 0 || w.days&(1<<day) != 0
+}
+
+// active reports whether the group applies at t.
+func (g *group) active(t time.Time) bool {
+	if len(g.schedule) == 0 {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	for _, w := range g.schedule {
+		if w.start < w.end {
+			if w.on(day) && minute >= w.start && minute < w.end {
+				return true
+			}
+			continue
+		}
+		// Past midnight: the evening of a listed day or the morning after
+		if (w.on(day) && minute >= w.start) || (w.on((day+6)%7) && minute < w.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compile normalizes and validates state and builds a Policy from it.
+func Compile(state State) (*Policy, error) {
+	return compile(state, nil)
+}
+
+// compile builds a Policy from state plus groups fixed in the configuration
+// file. The configured groups are not part of the policy's State, so edits
+// through the admin interface never touch them. Where a group in state has
+// exactly the same prefix as a configured group, the group in state wins.
+func compile(state State, configured []Group) (*Policy, error) {
+	state = state.Normalize()
+	if err := state.Validate(); err != nil {
+		return nil, err
+	}
+	fixed := State{Groups: configured}.Normalize()
+	if err := fixed.Validate(); err != nil {
+		return nil, fmt.Errorf("configured %w", err)
+	}
+	configuredNames := make(map[string]bool, len(fixed.Groups))
+	for _, g := range fixed.Groups {
+		configuredNames[g.Name] = true
+	}
+	for _, g := range state.Groups {
+		if configuredNames[g.Name] {
+			return nil, fmt.Errorf("groups[%s]: name is used by a group in the configuration file", g.Name)
+		}
+	}
+
+	p := &Policy{
+		state:  state,
+		allow:  make(map[string]struct{}, len(state.Allowlist)),
+		blocks: make(map[string]*Block, len(state.Blocks)),
+	}
+	for _, d := range state.Allowlist {
+		p.allow[d] = struct{}{}
+	}
+	for i := range state.Blocks {
+		p.blocks[state.Blocks[i].Domain] = &state.Blocks[i]
+	}
+	for _, g := range slices.Concat(fixed.Groups, state.Groups) {
+		cg := &group{name: g.Name, mode: g.Mode, allow: make(map[string]struct{}, len(g.Allowlist))}
+		for _, d := range g.Allowlist {
+			cg.allow[d] = struct{}{}
+		}
+		for _, w := range g.Schedule {
+			cw, _ := compileWindow(w) // validated above
+			cg.schedule = append(cg.schedule, cw)
+		}
+		for _, c := range g.Clients {
+			prefix, _ := ipmatch.ParsePrefix(c) // validated above
+			p.groups.Insert(prefix, cg)
+		}
+	}
+	return p, nil
+}
+
+// State returns the normalized state the policy was compiled from.
+func (p *Policy) State() State {
+	if p == nil {
+		return State{}.Normalize()
+	}
+	return p.state.Normalize()
+}
+
+// Evaluate decides how local policy treats a query for domain from client.
+// For VerdictBlock it also returns the matching entry. client may be the zero
+// Addr when the source is unknown, in which case no group applies.
+func (p *Policy) Evaluate(client netip.Addr, domain string) (Verdict, *Block) {
+	return p.evaluate(client, domain, time.Now())
+}
+
+func (p *Policy) evaluate(client netip.Addr, domain string, now time.Time) (Verdict, *Block) {
+	if p == nil {
+		return VerdictDefault, nil
+	}
+	domain = NormalizeDomain(domain)
+
+	g := p.group(client, now)
+	if g != nil && g.mode == ModeOff {
+		return VerdictAllow, nil
+	}
+
+	for _, name := range suffixes(domain) {
+		if _, ok := p.allow[name]; ok {
+			return VerdictAllow, nil
+		}
+		if g != nil {
+			if _, ok := g.allow[name]; ok {
+				return VerdictAllow, nil
+			}
+		}
+	}
+
+	for _, name := range suffixes(domain) {
+		if b, ok := p.blocks[name]; ok {
+			return VerdictBlock, b
+		}
+	}
+
+	return VerdictDefault, nil
+}
+
+// GroupFor returns the name of the group client belongs to, if any. A group
+// outside its schedule does not count.
+func (p *Policy) GroupFor(client netip.Addr) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	g := p.group(client, time.Now())
+	if g == nil {
+		return "", false
+	}
+	return g.name, true
+}
+
+// group returns the most specific group for client, or nil if there is none
+// or it is outside its schedule at now.
+func (p *Policy) group(client netip.Addr, now time.Time) *group {
+	g, _, ok := p.groups.Lookup(client)
+	if !ok || !g.active(now) {
+		return nil
+	}
+	return g
+}
+
+// suffixes returns domain followed by each of its parent domains, stopping
+// before the top-level label, matching api.Client.CheckDomain.
+func suffixes(domain string) []string {
+	out := []string{domain}
+	for i := 0; i < len(domain); i++ {
+		if domain[i] == '.' && strings.Contains(domain[i+1:], ".") {
+			out = append(out, domain[i+1:])
+		}
+	}
+	return out
+}
@@ -0,0 +1,156 @@
+package policy
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testState() State {
+	return State{
+		Allowlist: []string{"Union.Example.org."},
+		Blocks: []Block{
+			{Domain: "scab-staffing.example", Employer: "Scab Staffing Inc", Reason: "Strikebreaking agency"},
+		},
+		Groups: []Group{
+			{Name: "guests", Clients: []string{"192.168.50.0/24"}, Mode: "off"},
+			{Name: "kids", Clients: []string{"192.168.1.0/24", "fd00::/8"}, Allowlist: []string{"school.example"}},
+			{Name: "laptop", Clients: []string{"192.168.1.23"}},
+		},
+	}
+}
+
+func TestPolicyEvaluate(t *testing.T) {
+	p, err := Compile(testState())
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		client string
+		domain string
+		want   Verdict
+	}{
+		{"manual block", "10.0.0.1", "scab-staffing.example", VerdictBlock},
+		{"manual block subdomain", "10.0.0.1", "www.scab-staffing.example.", VerdictBlock},
+		{"global allowlist", "10.0.0.1", "lists.union.example.org", VerdictAllow},
+		{"no opinion", "10.0.0.1", "example.com", VerdictDefault},
+		{"group mode off", "192.168.50.7", "scab-staffing.example", VerdictAllow},
+		{"group allowlist", "192.168.1.5", "www.school.example", VerdictAllow},
+		{"group allowlist not global", "10.0.0.1", "school.example", VerdictDefault},
+		{"most specific group wins", "192.168.1.23", "school.example", VerdictDefault},
+		{"ipv6 group", "fd00::1", "school.example", VerdictAllow},
+		{"unknown client", "", "scab-staffing.example", VerdictBlock},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var client netip.Addr
+			if tt.client != "" {
+				client = netip.MustParseAddr(tt.client)
+			}
+			got, block := p.Evaluate(client, tt.domain)
+			if got != tt.want {
+				t.Errorf("Evaluate(%s, %s): expected %v, got %v", tt.client, tt.domain, tt.want, got)
+			}
+			if got == VerdictBlock && block.Employer != "Scab Staffing Inc" {
+				t.Errorf("Expected matching block entry, got %+v", block)
+			}
+		})
+	}
+
+	if name, ok := p.GroupFor(netip.MustParseAddr("192.168.1.99")); !ok || name != "kids" {
+		t.Errorf("GroupFor: expected 'kids', got '%s' (%v)", name, ok)
+	}
+}
+
+func TestPolicySchedule(t *testing.T) {
+	state := testState()
+	// Guests are exempt on weekday evenings, overnight into the next morning
+	state.Groups[0].Schedule = []Window{{Days: []string{"Mon", "tue", "wed", "thu", "fri"}, Start: "18:00", End: "06:00"}}
+	p, err := Compile(state)
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	guest := netip.MustParseAddr("192.168.50.7")
+	tests := []struct {
+		at   string
+		want Verdict
+	}{
+		{"2026-03-02T12:00:00", VerdictBlock}, // Monday noon
+		{"2026-03-02T18:00:00", VerdictAllow}, // Monday evening
+		{"2026-03-03T05:59:00", VerdictAllow}, // Tuesday early morning, Monday's window
+		{"2026-03-03T06:00:00", VerdictBlock}, // window ended
+		{"2026-03-07T20:00:00", VerdictBlock}, // Saturday evening
+		{"2026-03-07T02:00:00", VerdictAllow}, // Saturday early morning, Friday's window
+		{"2026-03-08T02:00:00", VerdictBlock}, // Sunday early morning
+	}
+	for _, tt := range tests {
+		now, _ := time.ParseInLocation("2006-01-02T15:04:05", tt.at, time.Local)
+		if got, _ := p.evaluate(guest, "scab-staffing.example", now); got != tt.want {
+			t.Errorf("At %s (%s): expected %v, got %v", tt.at, now.Weekday(), tt.want, got)
+		}
+	}
+}
+
+func TestNilPolicy(t *testing.T) {
+	var p *Policy
+	if v, _ := p.Evaluate(netip.MustParseAddr("10.0.0.1"), "example.com"); v != VerdictDefault {
+		t.Errorf("Expected nil policy to have no opinion, got %v", v)
+	}
+}
+
+func TestStateValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*State)
+		wantErr string
+	}{
+		{"valid", func(s *State) {}, ""},
+		{"bad allowlist domain", func(s *State) { s.Allowlist = append(s.Allowlist, "not a domain") }, "allowlist: \"not a domain\""},
+		{"duplicate block", func(s *State) { s.Blocks = append(s.Blocks, Block{Domain: "SCAB-staffing.example"}) }, "listed more than once"},
+		{"block conflicts with allowlist", func(s *State) { s.Blocks = append(s.Blocks, Block{Domain: "union.example.org"}) }, "also on the allowlist"},
+		{"group without name", func(s *State) { s.Groups[0].Name = " " }, "groups[#1]: name is required"},
+		{"duplicate group name", func(s *State) { s.Groups[1].Name = "guests" }, "used more than once"},
+		{"unknown mode", func(s *State) { s.Groups[0].Mode = "monitor" }, "mode must be"},
+		{"bad CIDR", func(s *State) { s.Groups[0].Clients = []string{"192.168.50.0/33"} }, "invalid CIDR"},
+		{"no clients", func(s *State) { s.Groups[0].Clients = nil }, "at least one client"},
+		{"bad schedule day", func(s *State) {
+			s.Groups[0].Schedule = []Window{{Days: []string{"monday"}, Start: "09:00", End: "17:00"}}
+		}, "is not a day"},
+		{"bad schedule time", func(s *State) { s.Groups[0].Schedule = []Window{{Start: "9am", End: "17:00"}} }, "not a 15:04 time"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := testState()
+			tt.modify(&s)
+			_, err := Compile(s)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestStateValidateReportsAllProblems(t *testing.T) {
+	_, err := Compile(State{
+		Allowlist: []string{"bad domain"},
+		Groups:    []Group{{Name: "x", Mode: "bogus"}},
+	})
+	if err == nil {
+		t.Fatal("Expected validation error")
+	}
+	if n := len(strings.Split(err.Error(), "\n")); n != 3 {
+		t.Errorf("Expected 3 problems, got %d: %v", n, err)
+	}
+}
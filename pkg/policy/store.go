@@ -0,0 +1,151 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// Store holds the active Policy and persists edits to its state file.
+// Readers never block: Apply compiles and saves the new state first and only
+// then swaps it in, so a failed apply leaves the running policy untouched.
+type Store struct {
+	path       string
+	mu         sync.Mutex // serializes Apply, Reload and SetGroups
+	configured []Group
+	current    atomic.Pointer[Policy]
+}
+
+// NewStore loads the state file at path. A missing file yields an empty
+// policy. An empty path keeps the policy in memory only.
+func NewStore(path string) (*Store, error) {
+	s := &Store{path: path}
+	p, err := load(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.current.Store(p)
+	return s, nil
+}
+
+// SetGroups sets the client groups defined in the configuration file. They
+// apply alongside the state file's groups but are not part of its State and
+// cannot be edited through the admin interface. If groups are invalid or
+// clash with the state file's, the running policy is kept.
+func (s *Store) SetGroups(groups []Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := compile(s.current.Load().state, groups)
+	if err != nil {
+		return err
+	}
+	s.configured = groups
+	s.current.Store(p)
+	return nil
+}
+
+// Reload re-reads the state file, picking up edits made outside the admin
+// interface. If the file is invalid the running policy is kept.
+func (s *Store) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, err := load(s.path, s.configured)
+	if err != nil {
+		return err
+	}
+	s.current.Store(p)
+	return nil
+}
+
+// load reads the state file at path and compiles it with the configured
+// groups. A missing file or empty path yields an empty state.
+func load(path string, configured []Group) (*Policy, error) {
+	state := State{}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return nil, fmt.Errorf("reading policy file: %w", err)
+		default:
+			if err := json.Unmarshal(data, &state); err != nil {
+				return nil, fmt.Errorf("parsing policy file: %w", err)
+			}
+		}
+	}
+
+	p, err := compile(state, configured)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+	return p, nil
+}
+
+// Policy returns the active policy.
+func (s *Store) Policy() *Policy {
+	return s.current.Load()
+}
+
+// Path returns the state file path, or "" for an in-memory store.
+func (s *Store) Path() string {
+	return s.path
+}
+
+// Apply validates state, writes it to the state file, and makes it the
+// active policy. Validation errors are returned unchanged so callers can
+// show them to the operator.
+func (s *Store) Apply(state State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, err := compile(state, s.configured)
+	if err != nil {
+		return err
+	}
+
+	if s.path != "" {
+		if err := writeFileAtomic(s.path, p.state); err != nil {
+			return err
+		}
+	}
+	s.current.Store(p)
+	return nil
+}
+
+// writeFileAtomic writes state next to path and renames it into place, so
+// a crash mid-write never leaves a truncated policy file behind.
+func writeFileAtomic(path string, state State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling policy: %w", err)
+	}
+	data = append(data, '\n')
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("writing policy file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing policy file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing policy file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing policy file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("writing policy file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing policy file: %w", err)
+	}
+	return nil
+}
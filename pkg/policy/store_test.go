@@ -0,0 +1,141 @@
+package policy
+
+import (
+	"encoding/json"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoreApplyPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore on missing file failed: %v", err)
+	}
+	if v, _ := store.Policy().Evaluate(netip.Addr{}, "scab-staffing.example"); v != VerdictDefault {
+		t.Errorf("Expected empty policy, got verdict %v", v)
+	}
+
+	if err := store.Apply(testState()); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if v, _ := store.Policy().Evaluate(netip.Addr{}, "scab-staffing.example"); v != VerdictBlock {
+		t.Errorf("Expected applied block to take effect, got verdict %v", v)
+	}
+
+	reloaded, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore on saved file failed: %v", err)
+	}
+	state := reloaded.Policy().State()
+	if len(state.Allowlist) != 1 || state.Allowlist[0] != "union.example.org" {
+		t.Errorf("Expected normalized allowlist to round-trip, got %v", state.Allowlist)
+	}
+	if len(state.Groups) != 3 || state.Groups[1].Mode != ModeEnforce {
+		t.Errorf("Expected groups with defaulted mode to round-trip, got %+v", state.Groups)
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected only the policy file in its directory, got %d entries", len(entries))
+	}
+}
+
+func TestStoreApplyInvalidKeepsPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	store, _ := NewStore(path)
+	if err := store.Apply(testState()); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	before, _ := os.ReadFile(path)
+
+	bad := testState()
+	bad.Groups[0].Mode = "bogus"
+	if err := store.Apply(bad); err == nil {
+		t.Fatal("Expected validation error")
+	}
+
+	after, _ := os.ReadFile(path)
+	if string(before) != string(after) {
+		t.Error("Expected state file to be unchanged after failed apply")
+	}
+	if v, _ := store.Policy().Evaluate(netip.MustParseAddr("192.168.50.1"), "scab-staffing.example"); v != VerdictAllow {
+		t.Error("Expected previous policy to stay active after failed apply")
+	}
+}
+
+func TestNewStoreInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+
+	garbled := filepath.Join(dir, "garbled.json")
+	os.WriteFile(garbled, []byte("{not json"), 0644)
+	if _, err := NewStore(garbled); err == nil {
+		t.Error("Expected error for unparseable policy file")
+	}
+
+	invalid := filepath.Join(dir, "invalid.json")
+	data, _ := json.Marshal(State{Allowlist: []string{"bad domain"}})
+	os.WriteFile(invalid, data, 0644)
+	if _, err := NewStore(invalid); err == nil {
+		t.Error("Expected error for policy file that fails validation")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store, err := NewStore("")
+	if err != nil {
+		t.Fatalf("NewStore failed: %v", err)
+	}
+	if err := store.Apply(testState()); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if v, _ := store.Policy().Evaluate(netip.Addr{}, "scab-staffing.example"); v != VerdictBlock {
+		t.Errorf("Expected in-memory apply to take effect, got verdict %v", v)
+	}
+}
+
+func TestStoreSetGroups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	store, _ := NewStore(path)
+	if err := store.Apply(testState()); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+
+	configured := []Group{{Name: "office", Clients: []string{"10.1.0.0/16"}, Mode: ModeOff}}
+	if err := store.SetGroups(configured); err != nil {
+		t.Fatalf("SetGroups failed: %v", err)
+	}
+	if v, _ := store.Policy().Evaluate(netip.MustParseAddr("10.1.2.3"), "scab-staffing.example"); v != VerdictAllow {
+		t.Errorf("Expected configured group to apply, got verdict %v", v)
+	}
+	if groups := store.Policy().State().Groups; len(groups) != 3 {
+		t.Errorf("Expected configured groups kept out of the state, got %+v", groups)
+	}
+
+	// Configured groups survive edits and reloads
+	state := testState()
+	state.Groups = state.Groups[:1]
+	if err := store.Apply(state); err != nil {
+		t.Fatalf("Apply failed: %v", err)
+	}
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if name, _ := store.Policy().GroupFor(netip.MustParseAddr("10.1.2.3")); name != "office" {
+		t.Errorf("Expected configured group after reload, got %q", name)
+	}
+
+	state.Groups = append(state.Groups, Group{Name: "office", Clients: []string{"10.2.0.0/16"}})
+	if err := store.Apply(state); err == nil {
+		t.Error("Expected a group reusing a configured name to be rejected")
+	}
+	if err := store.SetGroups([]Group{{Name: "guests", Clients: []string{"10.3.0.0/16"}}}); err == nil {
+		t.Error("Expected a configured group reusing a state group name to be rejected")
+	}
+	if name, _ := store.Policy().GroupFor(netip.MustParseAddr("10.1.2.3")); name != "office" {
+		t.Errorf("Expected a rejected change to keep the running policy, got %q", name)
+	}
+}
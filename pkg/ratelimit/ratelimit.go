@@ -0,0 +1,319 @@
+// Package ratelimit provides per-key rate limiters for the DNS server and
+// HTTP endpoints. State for a key is created on first use and evicted after
+// the key has been idle for the limiter's TTL, so memory stays bounded by
+// the number of recently active keys. A flood of distinct keys, such as
+// spoofed source networks, is bounded separately by the limiter's maximum
+// number of keys.
+package ratelimit
+
+import (
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMaxKeys is how many keys a limiter tracks unless WithMaxKeys says
+// otherwise.
+const DefaultMaxKeys = 100_000
+
+// shards is how many independently locked parts the keys are split into,
+// so that concurrent callers and idle sweeps do not all wait on one lock.
+const shards = 16
+
+// evictionSample is how many keys are compared to find one to evict when a
+// shard is full. The least recently seen of them goes, approximating LRU
+// without ordering every key.
+const evictionSample = 8
+
+// Limiter decides whether an event for key may proceed.
+type Limiter interface {
+	// Allow records an event for key and reports whether it is within the
+	// limit.
+	Allow(key string) bool
+}
+
+// Option customizes a limiter.
+type Option func(*options)
+
+type options struct {
+	ttl     time.Duration
+	maxKeys int
+	now     func() time.Time
+}
+
+// WithTTL sets how long an idle key is kept before its state is dropped.
+// The default is long enough for an idle key to have fully recovered, after
+// which dropping it changes nothing.
+func WithTTL(ttl time.Duration) Option {
+	return func(o *options) {
+		o.ttl = ttl
+	}
+}
+
+// WithMaxKeys sets how many keys are tracked at most, DefaultMaxKeys unless
+// given. When the limit is reached, a new key replaces one of the least
+// recently seen, which starts afresh if it returns.
+func WithMaxKeys(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.maxKeys = n
+		}
+	}
+}
+
+// WithClock sets the time source, for tests.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+func buildOptions(defaultTTL time.Duration, opts []Option) options {
+	o := options{ttl: defaultTTL, maxKeys: DefaultMaxKeys, now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// keyed holds per-key state with idle eviction, split into shards by key.
+// Each shard sweeps its idle keys inline at most once per TTL, so no
+// background goroutine is needed, and a sweep only covers one shard.
+type keyed[T any] struct {
+	ttl         time.Duration
+	now         func() time.Time
+	maxPerShard int
+	seed        maphash.Seed
+	shards      [shards]shard[T]
+	evicted     atomic.Uint64
+}
+
+type shard[T any] struct {
+	mu        sync.Mutex
+	entries   map[string]*entry[T]
+	lastSweep time.Time
+}
+
+type entry[T any] struct {
+	state    T
+	lastSeen time.Time
+}
+
+func newKeyed[T any](o options) *keyed[T] {
+	k := &keyed[T]{
+		ttl:         o.ttl,
+		now:         o.now,
+		maxPerShard: max(1, o.maxKeys/shards),
+		seed:        maphash.MakeSeed(),
+	}
+	now := o.now()
+	for i := range k.shards {
+		k.shards[i].entries = make(map[string]*entry[T])
+		k.shards[i].lastSweep = now
+	}
+	return k
+}
+
+// with runs fn on key's state, creating it if needed. fn runs with the
+// key's shard locked.
+func (k *keyed[T]) with(key string, fn func(state *T, now time.Time, created bool) bool) bool {
+	s := &k.shards[maphash.String(k.seed, key)%shards]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := k.now()
+	if now.Sub(s.lastSweep) >= k.ttl {
+		k.sweepLocked(s, now)
+	}
+
+	e, ok := s.entries[key]
+	if !ok {
+		if len(s.entries) >= k.maxPerShard {
+			k.evictLocked(s)
+		}
+		e = &entry[T]{}
+		s.entries[key] = e
+	}
+	e.lastSeen = now
+	return fn(&e.state, now, !ok)
+}
+
+// sweepLocked drops the keys of s that have been idle for the TTL.
+func (k *keyed[T]) sweepLocked(s *shard[T], now time.Time) {
+	for key, e := range s.entries {
+		if now.Sub(e.lastSeen) >= k.ttl {
+			delete(s.entries, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// evictLocked drops the least recently seen of a few keys of s, taken in
+// map order, which is random.
+func (k *keyed[T]) evictLocked(s *shard[T]) {
+	var oldest string
+	var oldestSeen time.Time
+	n := 0
+	for key, e := range s.entries {
+		if n == 0 || e.lastSeen.Before(oldestSeen) {
+			oldest, oldestSeen = key, e.lastSeen
+		}
+		if n++; n == evictionSample {
+			break
+		}
+	}
+	delete(s.entries, oldest)
+	k.evicted.Add(1)
+}
+
+// len returns the number of keys not yet idle for the TTL.
+func (k *keyed[T]) len() int {
+	now := k.now()
+	n := 0
+	for i := range k.shards {
+		s := &k.shards[i]
+		s.mu.Lock()
+		if now.Sub(s.lastSweep) >= k.ttl {
+			k.sweepLocked(s, now)
+		}
+		n += len(s.entries)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// TokenBucket allows bursts of up to burst events per key, refilled at rate
+// events per second. It suits traffic that is normally steady but may spike
+// briefly, such as DNS queries from one client.
+type TokenBucket struct {
+	rate  float64
+	burst float64
+	keys  *keyed[bucket]
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a token bucket limiter. A rate of zero or less
+// allows everything.
+func NewTokenBucket(rate float64, burst int, opts ...Option) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	// An idle bucket is full again after burst/rate seconds
+	ttl := time.Minute
+	if rate > 0 {
+		ttl = max(ttl, time.Duration(float64(burst)/rate*float64(time.Second)))
+	}
+	return &TokenBucket{
+		rate:  rate,
+		burst: float64(burst),
+		keys:  newKeyed[bucket](buildOptions(ttl, opts)),
+	}
+}
+
+// Allow takes a token from key's bucket if one is available.
+func (l *TokenBucket) Allow(key string) bool {
+	if l.rate <= 0 {
+		return true
+	}
+	return l.keys.with(key, func(b *bucket, now time.Time, created bool) bool {
+		if created {
+			b.tokens = l.burst
+		} else {
+			elapsed := now.Sub(b.last).Seconds()
+			b.tokens = min(l.burst, b.tokens+elapsed*l.rate)
+		}
+		b.last = now
+
+		if b.tokens < 1 {
+			return false
+		}
+		b.tokens--
+		return true
+	})
+}
+
+// Len returns the number of keys currently tracked.
+func (l *TokenBucket) Len() int {
+	return l.keys.len()
+}
+
+// Evicted returns how many keys were dropped to stay within the maximum
+// number of keys, rather than for being idle.
+func (l *TokenBucket) Evicted() uint64 {
+	return l.keys.evicted.Load()
+}
+
+// SlidingWindow allows up to limit events per key in any window-long
+// period. It estimates the count over the trailing window from the current
+// and previous fixed windows, weighting the previous one by how much of it
+// still overlaps, which avoids the double burst a fixed window allows at
+// its boundary. It suits low-rate limits such as login attempts.
+type SlidingWindow struct {
+	limit  int
+	window time.Duration
+	keys   *keyed[windowCount]
+}
+
+type windowCount struct {
+	start    time.Time
+	current  int
+	previous int
+}
+
+// NewSlidingWindow creates a sliding window limiter. A limit of zero or
+// less allows everything.
+func NewSlidingWindow(limit int, window time.Duration, opts ...Option) *SlidingWindow {
+	return &SlidingWindow{
+		limit:  limit,
+		window: window,
+		keys:   newKeyed[windowCount](buildOptions(2*window, opts)),
+	}
+}
+
+// Allow counts an event for key if the estimated count over the trailing
+// window is below the limit. Rejected events are not counted, so a client
+// that backs off recovers after one window.
+func (l *SlidingWindow) Allow(key string) bool {
+	if l.limit <= 0 {
+		return true
+	}
+	return l.keys.with(key, func(w *windowCount, now time.Time, created bool) bool {
+		if created {
+			w.start = now
+		}
+		if elapsed := now.Sub(w.start); elapsed >= l.window {
+			periods := elapsed / l.window
+			if periods == 1 {
+				w.previous = w.current
+			} else {
+				w.previous = 0
+			}
+			w.current = 0
+			w.start = w.start.Add(periods * l.window)
+		}
+
+		overlap := 1 - float64(now.Sub(w.start))/float64(l.window)
+		estimate := float64(w.previous)*overlap + float64(w.current)
+		if estimate >= float64(l.limit) {
+			return false
+		}
+		w.current++
+		return true
+	})
+}
+
+// Len returns the number of keys currently tracked.
+func (l *SlidingWindow) Len() int {
+	return l.keys.len()
+}
+
+// Evicted returns how many keys were dropped to stay within the maximum
+// number of keys, rather than for being idle.
+func (l *SlidingWindow) Evicted() uint64 {
+	return l.keys.evicted.Load()
+}
@@ -0,0 +1,175 @@
+package ratelimit
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a manually advanced time source.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func allowN(l Limiter, key string, n int) int {
+	allowed := 0
+	for i := 0; i < n; i++ {
+		if l.Allow(key) {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestTokenBucket(t *testing.T) {
+	clock := newFakeClock()
+	l := NewTokenBucket(2, 5, WithClock(clock.Now))
+
+	if got := allowN(l, "a", 10); got != 5 {
+		t.Errorf("Expected burst of 5, got %d", got)
+	}
+	if got := allowN(l, "b", 10); got != 5 {
+		t.Errorf("Expected keys to be limited independently, got %d for second key", got)
+	}
+
+	clock.Advance(time.Second)
+	if got := allowN(l, "a", 10); got != 2 {
+		t.Errorf("Expected 2 tokens after 1s at 2/s, got %d", got)
+	}
+
+	clock.Advance(time.Hour)
+	if got := allowN(l, "a", 10); got != 5 {
+		t.Errorf("Expected refill to cap at burst, got %d", got)
+	}
+}
+
+func TestTokenBucketDisabled(t *testing.T) {
+	l := NewTokenBucket(0, 1)
+	if got := allowN(l, "a", 100); got != 100 {
+		t.Errorf("Expected zero rate to allow everything, got %d", got)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	clock := newFakeClock()
+	l := NewSlidingWindow(10, time.Minute, WithClock(clock.Now))
+
+	if got := allowN(l, "a", 15); got != 10 {
+		t.Errorf("Expected 10 allowed in the first window, got %d", got)
+	}
+
+	// Halfway into the next window, half of the previous window still counts
+	clock.Advance(90 * time.Second)
+	if got := allowN(l, "a", 15); got != 5 {
+		t.Errorf("Expected 5 allowed with half the previous window overlapping, got %d", got)
+	}
+
+	// After two idle windows the history is gone
+	clock.Advance(3 * time.Minute)
+	if got := allowN(l, "a", 15); got != 10 {
+		t.Errorf("Expected full limit after idling, got %d", got)
+	}
+}
+
+func TestSlidingWindowBoundary(t *testing.T) {
+	clock := newFakeClock()
+	l := NewSlidingWindow(10, time.Minute, WithClock(clock.Now))
+
+	clock.Advance(59 * time.Second)
+	allowN(l, "a", 10)
+
+	// A fixed window would allow another 10 here
+	clock.Advance(2 * time.Second)
+	if got := allowN(l, "a", 10); got > 1 {
+		t.Errorf("Expected the boundary burst to be limited, got %d allowed", got)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	clock := newFakeClock()
+	l := NewTokenBucket(1, 1, WithClock(clock.Now), WithTTL(time.Minute))
+
+	l.Allow("a")
+	l.Allow("b")
+	if l.Len() != 2 {
+		t.Fatalf("Expected 2 keys, got %d", l.Len())
+	}
+
+	clock.Advance(30 * time.Second)
+	l.Allow("b")
+	clock.Advance(45 * time.Second)
+	l.Allow("c")
+
+	// "a" has been idle past the TTL; "b" was seen 45s ago
+	if l.Len() != 2 {
+		t.Errorf("Expected idle key to be evicted, got %d keys", l.Len())
+	}
+}
+
+func TestMaxKeys(t *testing.T) {
+	clock := newFakeClock()
+	l := NewTokenBucket(1, 1, WithClock(clock.Now), WithMaxKeys(160))
+
+	// A flood of distinct keys, none idle long enough to be swept
+	for i := range 10_000 {
+		l.Allow(fmt.Sprintf("10.%d.%d.0/24", i/256, i%256))
+		clock.Advance(time.Millisecond)
+	}
+	if n := l.Len(); n > 160 {
+		t.Errorf("Expected at most 160 keys, got %d", n)
+	}
+	if evicted := l.Evicted(); evicted < 10_000-160 {
+		t.Errorf("Expected evictions counted for the keys dropped, got %d", evicted)
+	}
+
+	// A key seen just now survives the next few new keys
+	l.Allow("recent")
+	for i := range 4 {
+		l.Allow(fmt.Sprintf("192.0.2.%d", i))
+	}
+	if l.Allow("recent") {
+		t.Error("Expected the recently seen key to keep its empty bucket")
+	}
+}
+
+func TestConcurrentAllow(t *testing.T) {
+	l := NewTokenBucket(1, 100)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n := allowN(l, "shared", 50)
+			mu.Lock()
+			allowed += n
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	// One token may refill while the goroutines run
+	if allowed < 100 || allowed > 101 {
+		t.Errorf("Expected about 100 allowed across goroutines, got %d", allowed)
+	}
+}
@@ -0,0 +1,251 @@
+// Package remoteconfig fetches configuration documents published centrally,
+// so that a union can manage a fleet of resolvers from one place. Documents
+// are signed with an Ed25519 key held by the publisher; unsigned or altered
+// documents are rejected. The last document that was applied is cached on
+// disk so a resolver can start while the publisher is unreachable.
+package remoteconfig
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HeaderSignature carries a document's signature, as
+// "ed25519=<base64 signature>".
+const HeaderSignature = "X-OPL-Signature"
+
+// signatureVersion prefixes every signed payload, keeping configuration
+// signatures distinct from stats report signatures made with the same kind
+// of key.
+const signatureVersion = "opl-config-v1"
+
+// maxDocumentSize bounds how much of a response is read.
+const maxDocumentSize = 1 << 20
+
+// Document is a configuration document and its signature.
+type Document struct {
+	// Body is the JSON configuration, exactly as signed
+	Body []byte `json:"body"`
+
+	// Signature is the HeaderSignature value it was served with
+	Signature string `json:"signature"`
+
+	// Fetched is when it was downloaded
+	Fetched time.Time `json:"fetched"`
+}
+
+// Config configures a Source.
+type Config struct {
+	// URL serves the configuration document
+	URL string
+
+	// APIKey, if set, is sent in the X-API-Key header
+	APIKey string
+
+	// PublicKey verifies document signatures
+	PublicKey ed25519.PublicKey
+
+	// CacheFile, if set, keeps the last accepted document
+	CacheFile string
+
+	// Timeout bounds each fetch
+	Timeout time.Duration
+
+	// Transport, if set, is used for requests, e.g. to honor a proxy or CA
+	Transport http.RoundTripper
+}
+
+// Source fetches and verifies configuration documents from one URL.
+type Source struct {
+	cfg    Config
+	client *http.Client
+
+	mu      sync.Mutex
+	current *Document
+}
+
+// New creates a Source.
+func New(cfg Config) *Source {
+	return &Source{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout, Transport: cfg.Transport},
+	}
+}
+
+// Fetch downloads the document and verifies its signature. It does not
+// change Current; call Accept once the document has been applied.
+func (s *Source) Fetch(ctx context.Context) (*Document, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.cfg.APIKey != "" {
+		req.Header.Set("X-API-Key", s.cfg.APIKey)
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching remote configuration: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching remote configuration: unexpected status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading remote configuration: %w", err)
+	}
+	if len(body) > maxDocumentSize {
+		return nil, fmt.Errorf("remote configuration is larger than %d bytes", maxDocumentSize)
+	}
+
+	doc := &Document{Body: body, Signature: resp.Header.Get(HeaderSignature), Fetched: time.Now()}
+	if err := Verify(s.cfg.PublicKey, doc.Body, doc.Signature); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Cached returns the cached document after verifying it again, so a cache
+// file edited by hand is rejected like a tampered download.
+func (s *Source) Cached() (*Document, error) {
+	if s.cfg.CacheFile == "" {
+		return nil, fmt.Errorf("no remote configuration cache file")
+	}
+	data, err := os.ReadFile(s.cfg.CacheFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading remote configuration cache: %w", err)
+	}
+	var doc Document
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing remote configuration cache: %w", err)
+	}
+	if err := Verify(s.cfg.PublicKey, doc.Body, doc.Signature); err != nil {
+		return nil, fmt.Errorf("remote configuration cache: %w", err)
+	}
+	return &doc, nil
+}
+
+// Accept makes doc the current document and, if a cache file is set,
+// writes it there. The document is current even if caching fails.
+func (s *Source) Accept(doc *Document) error {
+	s.mu.Lock()
+	s.current = doc
+	s.mu.Unlock()
+
+	if s.cfg.CacheFile == "" {
+		return nil
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	// Written to a temporary file and renamed so a crash never leaves a
+	// truncated cache
+	tmp, err := os.CreateTemp(filepath.Dir(s.cfg.CacheFile), ".remote-config-*")
+	if err != nil {
+		return fmt.Errorf("caching remote configuration: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("caching remote configuration: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("caching remote configuration: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), s.cfg.CacheFile); err != nil {
+		return fmt.Errorf("caching remote configuration: %w", err)
+	}
+	return nil
+}
+
+// Current returns the accepted document, or nil if none has been.
+func (s *Source) Current() *Document {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.current
+}
+
+// SignaturePayload returns the bytes signed for a document body.
+func SignaturePayload(body []byte) []byte {
+	return append([]byte(signatureVersion+"\n"), body...)
+}
+
+// Sign returns the HeaderSignature value for body.
+func Sign(key ed25519.PrivateKey, body []byte) string {
+	return "ed25519=" + base64.StdEncoding.EncodeToString(ed25519.Sign(key, SignaturePayload(body)))
+}
+
+// Verify checks a HeaderSignature value against body.
+func Verify(key ed25519.PublicKey, body []byte, signature string) error {
+	if signature == "" {
+		return fmt.Errorf("remote configuration is not signed")
+	}
+	algorithm, encoded, _ := strings.Cut(signature, "=")
+	if algorithm != "ed25519" {
+		return fmt.Errorf("remote configuration signature uses unsupported algorithm %q", algorithm)
+	}
+	sig, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || !ed25519.Verify(key, SignaturePayload(body), sig) {
+		return fmt.Errorf("remote configuration signature does not verify")
+	}
+	return nil
+}
+
+// LoadPublicKey reads a PEM-encoded Ed25519 public key, as printed by
+// "opl-dns -generate-signing-key".
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("public key %s is not a PEM public key", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key: %w", err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %s is not an Ed25519 key", path)
+	}
+	return edKey, nil
+}
+
+// LoadPrivateKey reads a PEM-encoded PKCS #8 Ed25519 private key, as
+// written by "opl-dns -generate-signing-key", for signing documents.
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("signing key %s is not a PEM private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing signing key: %w", err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("signing key %s is not an Ed25519 key", path)
+	}
+	return edKey, nil
+}
@@ -0,0 +1,116 @@
+package remoteconfig
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// publisher serves body signed with key, or with signature if it is set.
+func publisher(t *testing.T, key ed25519.PrivateKey, body []byte, signature *string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "fleet-key" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		sig := Sign(key, body)
+		if signature != nil {
+			sig = *signature
+		}
+		w.Header().Set(HeaderSignature, sig)
+		w.Write(body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSource_Fetch(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	body := []byte(`{"dns":{"upstream_dns":["9.9.9.9:53"]}}`)
+
+	server := publisher(t, private, body, nil)
+	source := New(Config{URL: server.URL, APIKey: "fleet-key", PublicKey: public, Timeout: time.Second})
+	doc, err := source.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if string(doc.Body) != string(body) {
+		t.Errorf("Body = %s", doc.Body)
+	}
+	if source.Current() != nil {
+		t.Error("Expected Fetch to leave the current document unset")
+	}
+
+	unauthorized := New(Config{URL: server.URL, PublicKey: public, Timeout: time.Second})
+	if _, err := unauthorized.Fetch(context.Background()); err == nil {
+		t.Error("Expected a fetch without the API key to fail")
+	}
+
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	forged := Sign(otherKey, body)
+	unsigned := ""
+	for name, sig := range map[string]*string{"forged": &forged, "unsigned": &unsigned} {
+		server := publisher(t, private, body, sig)
+		source := New(Config{URL: server.URL, APIKey: "fleet-key", PublicKey: public, Timeout: time.Second})
+		if _, err := source.Fetch(context.Background()); err == nil {
+			t.Errorf("Expected a %s document to be rejected", name)
+		}
+	}
+}
+
+func TestSource_Cache(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	cacheFile := filepath.Join(t.TempDir(), "remote.json")
+	source := New(Config{PublicKey: public, CacheFile: cacheFile})
+
+	if _, err := source.Cached(); err == nil {
+		t.Error("Expected an error before anything is cached")
+	}
+
+	body := []byte(`{"logging":{"level":"debug"}}`)
+	doc := &Document{Body: body, Signature: Sign(private, body), Fetched: time.Now()}
+	if err := source.Accept(doc); err != nil {
+		t.Fatalf("Accept failed: %v", err)
+	}
+	if source.Current() != doc {
+		t.Error("Expected Accept to make the document current")
+	}
+	cached, err := source.Cached()
+	if err != nil {
+		t.Fatalf("Cached failed: %v", err)
+	}
+	if string(cached.Body) != string(body) {
+		t.Errorf("Cached body = %s", cached.Body)
+	}
+
+	// A cache edited by hand no longer verifies
+	tampered := &Document{Body: []byte(`{"logging":{"level":"error"}}`), Signature: doc.Signature}
+	if err := source.Accept(tampered); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Cached(); err == nil {
+		t.Error("Expected a tampered cache to be rejected")
+	}
+}
+
+func TestLoadKeys(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadPublicKey(filepath.Join(dir, "missing.pem")); err == nil {
+		t.Error("Expected a missing public key to be an error")
+	}
+	path := filepath.Join(dir, "not-a-key.pem")
+	os.WriteFile(path, []byte("not a key"), 0o600)
+	if _, err := LoadPublicKey(path); err == nil {
+		t.Error("Expected a non-PEM public key to be rejected")
+	}
+	if _, err := LoadPrivateKey(path); err == nil {
+		t.Error("Expected a non-PEM private key to be rejected")
+	}
+}
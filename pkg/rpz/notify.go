@@ -0,0 +1,55 @@
+package rpz
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// notifyTimeout bounds each NOTIFY exchange. Secondaries that miss one
+// still pick up the change at the SOA refresh interval.
+const notifyTimeout = 5 * time.Second
+
+// sendNotify tells every configured secondary the zone has changed.
+func (s *Server) sendNotify(ctx context.Context) {
+	serial := s.Serial()
+	var wg sync.WaitGroup
+	for _, addr := range s.notify {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.notifyOne(ctx, addr, serial); err != nil {
+				s.logger.Warn("Error notifying secondary", "addr", addr, "serial", serial, "error", err)
+				return
+			}
+			s.logger.Debug("Notified secondary", "addr", addr, "serial", serial)
+		}()
+	}
+	wg.Wait()
+}
+
+// notifyOne sends a NOTIFY for serial to the secondary at addr.
+func (s *Server) notifyOne(ctx context.Context, addr string, serial uint32) error {
+	m := new(dns.Msg)
+	m.SetNotify(s.zone.origin)
+	m.Answer = []dns.RR{s.zone.soa(serial)}
+
+	c := &dns.Client{Net: "udp", Timeout: notifyTimeout}
+	if len(s.keys) > 0 {
+		key := s.keys[0]
+		c.TsigSecret = map[string]string{dns.Fqdn(key.Name): key.Secret}
+		m.SetTsig(dns.Fqdn(key.Name), dns.Fqdn(key.Algorithm), 300, time.Now().Unix())
+	}
+
+	resp, _, err := c.ExchangeContext(ctx, m, addr)
+	if err != nil {
+		return err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("answered %s", dns.RcodeToString[resp.Rcode])
+	}
+	return nil
+}
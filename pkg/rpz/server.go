@@ -0,0 +1,514 @@
+package rpz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+	"github.com/online-picket-line/opl-for-dns/pkg/ipmatch"
+)
+
+// transferChunk is how many records go in each message of a zone transfer.
+const transferChunk = 500
+
+// expiryInterval is how often the zone is rebuilt to drop domains whose
+// action has ended since the last blocklist update.
+const expiryInterval = time.Minute
+
+// Key is a TSIG key secondaries sign their queries with.
+type Key struct {
+	// Name is the key name
+	Name string
+
+	// Algorithm is a TSIG algorithm name such as "hmac-sha256"
+	Algorithm string
+
+	// Secret is the base64 encoded key
+	Secret string
+}
+
+// Config configures a Server.
+type Config struct {
+	// ListenAddr is the UDP and TCP address to serve the zone on
+	ListenAddr string
+
+	// Zone is the name of the policy zone
+	Zone string
+
+	// Action is how resolvers answer for blocked domains. Defaults to
+	// ActionNull.
+	Action Action
+
+	// TTL is the TTL of the zone's records
+	TTL time.Duration
+
+	// AllowTransfer lists the CIDRs or bare IP addresses allowed to query
+	// and transfer the zone
+	AllowTransfer []string
+
+	// Keys, if set, are the TSIG keys queries must be signed with. NOTIFY
+	// messages are signed with the first.
+	Keys []Key
+
+	// Notify lists the host:port addresses of secondaries told about every
+	// change to the zone
+	Notify []string
+
+	// JournalSize is how many changes are kept to answer incremental
+	// transfers
+	JournalSize int
+
+	// Logger receives transfer and NOTIFY logs. Defaults to slog.Default().
+	Logger *slog.Logger
+}
+
+// Server serves the blocklist as an authoritative response policy zone,
+// answering SOA queries and full (AXFR) and incremental (IXFR) transfers,
+// and sending NOTIFY to secondaries when the zone changes.
+type Server struct {
+	listenAddr  string
+	zone        zoneData
+	allow       *ipmatch.Set
+	keys        []Key
+	tsig        map[string]string
+	notify      []string
+	journalSize int
+	logger      *slog.Logger
+
+	// Zone state, guarded by mu. current is nil until the first blocklist
+	// is loaded.
+	mu        sync.RWMutex
+	blocklist *api.Blocklist
+	current   *snapshot
+	journal   []delta
+	changed   chan struct{}
+
+	listenMu    sync.Mutex
+	udpConn     net.PacketConn
+	tcpListener net.Listener
+	server      *dns.Server
+	tcpServer   *dns.Server
+}
+
+// New creates a Server. It serves no zone until Update is first called.
+func New(cfg Config) (*Server, error) {
+	if cfg.ListenAddr == "" {
+		return nil, fmt.Errorf("listen address is required")
+	}
+	zone, err := newZoneData(cfg)
+	if err != nil {
+		return nil, err
+	}
+	allow, err := ipmatch.ParseSet(cfg.AllowTransfer)
+	if err != nil {
+		return nil, err
+	}
+
+	var tsig map[string]string
+	for _, k := range cfg.Keys {
+		if tsig == nil {
+			tsig = make(map[string]string)
+		}
+		// Secondaries send the key name as they configure it, which may
+		// differ in case
+		tsig[dns.Fqdn(k.Name)] = k.Secret
+		tsig[dns.CanonicalName(k.Name)] = k.Secret
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &Server{
+		listenAddr:  cfg.ListenAddr,
+		zone:        zone,
+		allow:       allow,
+		keys:        cfg.Keys,
+		tsig:        tsig,
+		notify:      cfg.Notify,
+		journalSize: cfg.JournalSize,
+		logger:      logger,
+		changed:     make(chan struct{}, 1),
+	}, nil
+}
+
+// Update rebuilds the zone from blocklist. The serial is bumped, and
+// secondaries notified, only if the blocked domains changed.
+func (s *Server) Update(blocklist *api.Blocklist) {
+	if blocklist == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocklist = blocklist
+	s.rebuildLocked(time.Now())
+}
+
+func (s *Server) rebuildLocked(now time.Time) {
+	if s.blocklist == nil {
+		return
+	}
+	domains := domainsOf(s.blocklist, s.zone.origin, now)
+	var prev []string
+	var serial uint32
+	if s.current != nil {
+		if slices.Equal(s.current.domains, domains) {
+			return
+		}
+		prev, serial = s.current.domains, s.current.serial
+	}
+
+	added, removed := diff(prev, domains)
+	next := &snapshot{serial: nextSerial(serial, now), domains: domains}
+	if s.current != nil && s.journalSize > 0 {
+		s.journal = append(s.journal, delta{from: serial, to: next.serial, added: added, removed: removed})
+		if extra := len(s.journal) - s.journalSize; extra > 0 {
+			s.journal = slices.Delete(s.journal, 0, extra)
+		}
+	}
+	s.current = next
+	s.logger.Info("Response policy zone updated",
+		"zone", s.zone.origin,
+		"serial", next.serial,
+		"domains", len(domains),
+		"added", len(added),
+		"removed", len(removed),
+	)
+
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Serial returns the zone's current serial, or 0 before the first
+// blocklist is loaded.
+func (s *Server) Serial() uint32 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.current == nil {
+		return 0
+	}
+	return s.current.serial
+}
+
+// Run drops expired domains from the zone as their actions end, and
+// notifies secondaries of every change, until ctx is cancelled.
+func (s *Server) Run(ctx context.Context) {
+	ticker := time.NewTicker(expiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.rebuildLocked(time.Now())
+			s.mu.Unlock()
+		case <-s.changed:
+			s.sendNotify(ctx)
+		}
+	}
+}
+
+// Listen binds the UDP and TCP sockets for the configured listen address.
+// When the address uses port 0, the TCP listener is bound to the port the
+// kernel picked for UDP so both transports share a single address. Calling
+// Listen is optional; Start and StartTCP bind on first use.
+func (s *Server) Listen() error {
+	s.listenMu.Lock()
+	defer s.listenMu.Unlock()
+	return s.listenLocked()
+}
+
+func (s *Server) listenLocked() error {
+	if s.udpConn != nil {
+		return nil
+	}
+
+	udpConn, err := net.ListenPacket("udp", s.listenAddr)
+	if err != nil {
+		return fmt.Errorf("listening on UDP %s: %w", s.listenAddr, err)
+	}
+
+	tcpAddr := s.listenAddr
+	if host, port, err := net.SplitHostPort(s.listenAddr); err == nil && port == "0" {
+		tcpAddr = net.JoinHostPort(host, fmt.Sprint(udpConn.LocalAddr().(*net.UDPAddr).Port))
+	}
+
+	tcpListener, err := net.Listen("tcp", tcpAddr)
+	if err != nil {
+		udpConn.Close()
+		return fmt.Errorf("listening on TCP %s: %w", tcpAddr, err)
+	}
+
+	s.udpConn = udpConn
+	s.tcpListener = tcpListener
+	return nil
+}
+
+// Addr returns the bound UDP address, or nil if the server is not listening yet.
+func (s *Server) Addr() net.Addr {
+	s.listenMu.Lock()
+	defer s.listenMu.Unlock()
+	if s.udpConn == nil {
+		return nil
+	}
+	return s.udpConn.LocalAddr()
+}
+
+// Start serves the zone on UDP.
+func (s *Server) Start() error {
+	s.listenMu.Lock()
+	if err := s.listenLocked(); err != nil {
+		s.listenMu.Unlock()
+		return err
+	}
+	server := &dns.Server{PacketConn: s.udpConn, Net: "udp", Handler: s, TsigSecret: s.tsig}
+	s.server = server
+	s.listenMu.Unlock()
+
+	s.logger.Info("Serving response policy zone", "zone", s.zone.origin, "addr", s.udpConn.LocalAddr())
+	return server.ActivateAndServe()
+}
+
+// StartTCP serves the zone on TCP, which zone transfers use.
+func (s *Server) StartTCP() error {
+	s.listenMu.Lock()
+	if err := s.listenLocked(); err != nil {
+		s.listenMu.Unlock()
+		return err
+	}
+	tcpServer := &dns.Server{Listener: s.tcpListener, Net: "tcp", Handler: s, TsigSecret: s.tsig}
+	s.tcpServer = tcpServer
+	s.listenMu.Unlock()
+
+	return tcpServer.ActivateAndServe()
+}
+
+// Shutdown stops serving on both transports, waits until transfers in
+// flight are done or ctx is, and releases the sockets.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.listenMu.Lock()
+	server, tcpServer := s.server, s.tcpServer
+	udpConn, tcpListener := s.udpConn, s.tcpListener
+	s.listenMu.Unlock()
+
+	var errs []error
+	for _, srv := range []*dns.Server{server, tcpServer} {
+		if srv != nil {
+			errs = append(errs, srv.ShutdownContext(ctx))
+		}
+	}
+	// Closing the sockets makes a pending ActivateAndServe return even if
+	// the server never started serving
+	if udpConn != nil {
+		udpConn.Close()
+	}
+	if tcpListener != nil {
+		tcpListener.Close()
+	}
+	return errors.Join(errs...)
+}
+
+// ServeDNS answers queries for the zone and transfers it.
+func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	client := remoteAddr(w)
+	if !s.allow.Contains(client) {
+		s.logger.Debug("Refused response policy zone query", "client", client)
+		m.Rcode = dns.RcodeRefused
+		w.WriteMsg(m)
+		return
+	}
+	if s.tsig != nil {
+		if r.IsTsig() == nil {
+			s.logger.Debug("Refused unsigned response policy zone query", "client", client)
+			m.Rcode = dns.RcodeRefused
+			w.WriteMsg(m)
+			return
+		}
+		if err := w.TsigStatus(); err != nil {
+			s.logger.Warn("Refused response policy zone query with a bad signature", "client", client, "error", err)
+			m.Rcode = dns.RcodeNotAuth
+			w.WriteMsg(m)
+			return
+		}
+	}
+
+	if r.Opcode != dns.OpcodeQuery || len(r.Question) != 1 {
+		m.Rcode = dns.RcodeNotImplemented
+		s.reply(w, r, m)
+		return
+	}
+	q := r.Question[0]
+	name := dns.CanonicalName(q.Name)
+	if !dns.IsSubDomain(s.zone.origin, name) {
+		m.Rcode = dns.RcodeRefused
+		s.reply(w, r, m)
+		return
+	}
+
+	s.mu.RLock()
+	snap, journal := s.current, s.journal
+	s.mu.RUnlock()
+	if snap == nil {
+		// Secondaries keep the copy they have until the blocklist loads
+		m.Rcode = dns.RcodeServerFailure
+		s.reply(w, r, m)
+		return
+	}
+
+	tcp := w.LocalAddr().Network() == "tcp"
+	switch q.Qtype {
+	case dns.TypeAXFR:
+		if !tcp {
+			m.Rcode = dns.RcodeRefused
+			s.reply(w, r, m)
+			return
+		}
+		s.logger.Info("Transferring response policy zone", "client", client, "serial", snap.serial, "type", "AXFR")
+		s.transfer(w, r, s.axfr(snap))
+		return
+
+	case dns.TypeIXFR:
+		from, ok := ixfrSerial(r)
+		if !ok {
+			m.Rcode = dns.RcodeFormatError
+			s.reply(w, r, m)
+			return
+		}
+		// A secondary that is up to date, or asks over UDP, gets the
+		// current SOA; over UDP that tells it to transfer over TCP
+		if int32(from-snap.serial) >= 0 || !tcp {
+			m.Authoritative = true
+			m.Answer = []dns.RR{s.zone.soa(snap.serial)}
+			s.reply(w, r, m)
+			return
+		}
+		rrs := s.ixfr(snap, journal, from)
+		kind := "IXFR"
+		if rrs == nil {
+			// Too far behind for the journal; RFC 1995 allows answering
+			// with the whole zone
+			rrs, kind = s.axfr(snap), "AXFR"
+		}
+		s.logger.Info("Transferring response policy zone", "client", client, "from", from, "serial", snap.serial, "type", kind)
+		s.transfer(w, r, rrs)
+		return
+	}
+
+	m.Authoritative = true
+	s.answer(m, snap, name, q.Qtype)
+	s.reply(w, r, m)
+}
+
+// answer fills m with the zone's answer for name and qtype.
+func (s *Server) answer(m *dns.Msg, snap *snapshot, name string, qtype uint16) {
+	var rrs []dns.RR
+	if name == s.zone.origin {
+		rrs = []dns.RR{s.zone.soa(snap.serial), s.zone.ns()}
+	} else if snap.blocked(strings.TrimSuffix(name, "."+s.zone.origin)) != "" {
+		rrs = s.zone.recordsAt(name)
+	} else {
+		m.Rcode = dns.RcodeNameError
+	}
+	for _, rr := range rrs {
+		if t := rr.Header().Rrtype; t == qtype || t == dns.TypeCNAME || qtype == dns.TypeANY {
+			m.Answer = append(m.Answer, rr)
+		}
+	}
+	if len(m.Answer) == 0 {
+		m.Ns = []dns.RR{s.zone.soa(snap.serial)}
+	}
+}
+
+// axfr returns the records of a full transfer of snap.
+func (s *Server) axfr(snap *snapshot) []dns.RR {
+	soa := s.zone.soa(snap.serial)
+	rrs := []dns.RR{soa, s.zone.ns()}
+	for _, d := range snap.domains {
+		rrs = append(rrs, s.zone.records(d)...)
+	}
+	return append(rrs, soa)
+}
+
+// ixfr returns the records of an incremental transfer from serial from to
+// snap, or nil if the journal does not reach back to from.
+func (s *Server) ixfr(snap *snapshot, journal []delta, from uint32) []dns.RR {
+	i := slices.IndexFunc(journal, func(d delta) bool { return d.from == from })
+	if i < 0 {
+		return nil
+	}
+	soa := s.zone.soa(snap.serial)
+	rrs := []dns.RR{soa}
+	for _, d := range journal[i:] {
+		rrs = append(rrs, s.zone.soa(d.from))
+		for _, domain := range d.removed {
+			rrs = append(rrs, s.zone.records(domain)...)
+		}
+		rrs = append(rrs, s.zone.soa(d.to))
+		for _, domain := range d.added {
+			rrs = append(rrs, s.zone.records(domain)...)
+		}
+	}
+	return append(rrs, soa)
+}
+
+// transfer sends rrs as a zone transfer answering r, and closes the
+// connection.
+func (s *Server) transfer(w dns.ResponseWriter, r *dns.Msg, rrs []dns.RR) {
+	ch := make(chan *dns.Envelope)
+	done := make(chan struct{})
+	go func() {
+		defer close(ch)
+		for chunk := range slices.Chunk(rrs, transferChunk) {
+			select {
+			case ch <- &dns.Envelope{RR: chunk}:
+			case <-done:
+				return
+			}
+		}
+	}()
+	if err := new(dns.Transfer).Out(w, r, ch); err != nil {
+		s.logger.Warn("Error transferring response policy zone", "client", remoteAddr(w), "error", err)
+	}
+	close(done)
+	w.Close()
+}
+
+// reply writes m, signed with the key r was signed with, if any.
+func (s *Server) reply(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg) {
+	if t := r.IsTsig(); t != nil && w.TsigStatus() == nil {
+		m.SetTsig(t.Hdr.Name, t.Algorithm, t.Fudge, time.Now().Unix())
+	}
+	w.WriteMsg(m)
+}
+
+// ixfrSerial returns the serial in the authority section of an IXFR query.
+func ixfrSerial(r *dns.Msg) (uint32, bool) {
+	for _, rr := range r.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa.Serial, true
+		}
+	}
+	return 0, false
+}
+
+// remoteAddr returns the address a query came from.
+func remoteAddr(w dns.ResponseWriter) netip.Addr {
+	addrPort, _ := netip.ParseAddrPort(w.RemoteAddr().String())
+	return addrPort.Addr().Unmap()
+}
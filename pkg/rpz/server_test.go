@@ -0,0 +1,224 @@
+package rpz
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+)
+
+const (
+	testKey    = "xfr.opl."
+	testSecret = "c2VjcmV0LWtleS1mb3ItdGVzdHM="
+)
+
+// startServer serves a zone for cfg on a free local port and returns the
+// server and its address.
+func startServer(t *testing.T, cfg Config) (*Server, string) {
+	t.Helper()
+
+	cfg.ListenAddr = "127.0.0.1:0"
+	if cfg.Zone == "" {
+		cfg.Zone = "opl.rpz"
+	}
+	if cfg.AllowTransfer == nil {
+		cfg.AllowTransfer = []string{"127.0.0.1"}
+	}
+	cfg.TTL = time.Minute
+	cfg.JournalSize = 8
+	cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := s.Listen(); err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	go s.Start()
+	go s.StartTCP()
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	return s, s.Addr().String()
+}
+
+func blocklistOf(domains ...string) *api.Blocklist {
+	b := &api.Blocklist{}
+	for _, d := range domains {
+		b.BlockList = append(b.BlockList, api.BlockListItem{Domain: d})
+	}
+	return b
+}
+
+// transferIn runs the transfer m against addr and returns the records.
+func transferIn(t *testing.T, addr string, m *dns.Msg) []dns.RR {
+	t.Helper()
+	tr := &dns.Transfer{TsigSecret: map[string]string{testKey: testSecret}}
+	envs, err := tr.In(m, addr)
+	if err != nil {
+		t.Fatalf("Transfer failed: %v", err)
+	}
+	var rrs []dns.RR
+	for env := range envs {
+		if env.Error != nil {
+			t.Fatalf("Transfer failed: %v", env.Error)
+		}
+		rrs = append(rrs, env.RR...)
+	}
+	return rrs
+}
+
+func signed(m *dns.Msg) *dns.Msg {
+	m.SetTsig(testKey, dns.HmacSHA256, 300, time.Now().Unix())
+	return m
+}
+
+func TestServerTransfers(t *testing.T) {
+	s, addr := startServer(t, Config{
+		Keys: []Key{{Name: testKey, Algorithm: "hmac-sha256", Secret: testSecret}},
+	})
+
+	c := &dns.Client{TsigSecret: map[string]string{testKey: testSecret}}
+	soaQuery := signed(new(dns.Msg).SetQuestion("opl.rpz.", dns.TypeSOA))
+	if resp, _, err := c.Exchange(soaQuery, addr); err != nil || resp.Rcode != dns.RcodeServerFailure {
+		t.Fatalf("Expected SERVFAIL before the blocklist loads, got %v (%v)", resp, err)
+	}
+
+	s.Update(blocklistOf("shop.example.com", "news.example"))
+	first := s.Serial()
+	axfr := transferIn(t, addr, signed(new(dns.Msg).SetAxfr("opl.rpz.")))
+	// SOA, NS, A and AAAA at each domain and its wildcard, SOA
+	if len(axfr) != 11 {
+		t.Fatalf("Expected 11 records in the full transfer, got %d: %v", len(axfr), axfr)
+	}
+	if soa, ok := axfr[0].(*dns.SOA); !ok || soa.Serial != first {
+		t.Errorf("Expected the transfer to start with SOA serial %d, got %v", first, axfr[0])
+	}
+	if a, ok := axfr[4].(*dns.A); !ok || a.Hdr.Name != "*.news.example.opl.rpz." || !a.A.Equal(net.IPv4zero) {
+		t.Errorf("Expected the wildcard to block subdomains, got %v", axfr[4])
+	}
+
+	s.Update(blocklistOf("shop.example.com", "news.example"))
+	if s.Serial() != first {
+		t.Errorf("Expected an unchanged blocklist to keep serial %d, got %d", first, s.Serial())
+	}
+	s.Update(blocklistOf("shop.example.com", "picket.example"))
+	second := s.Serial()
+	if second == first {
+		t.Fatal("Expected a changed blocklist to bump the serial")
+	}
+
+	ixfr := transferIn(t, addr, signed(new(dns.Msg).SetIxfr("opl.rpz.", first, ".", ".")))
+	// SOA, old SOA, 4 removed, new SOA, 4 added, SOA
+	if len(ixfr) != 12 {
+		t.Fatalf("Expected 12 records in the incremental transfer, got %d: %v", len(ixfr), ixfr)
+	}
+	if soa, ok := ixfr[1].(*dns.SOA); !ok || soa.Serial != first {
+		t.Errorf("Expected the removals to start with serial %d, got %v", first, ixfr[1])
+	}
+	if ixfr[2].Header().Name != "news.example.opl.rpz." || ixfr[7].Header().Name != "picket.example.opl.rpz." {
+		t.Errorf("Expected news.example removed and picket.example added, got %v", ixfr)
+	}
+
+	// A secondary the journal does not reach back to gets the whole zone
+	if rrs := transferIn(t, addr, signed(new(dns.Msg).SetIxfr("opl.rpz.", first-1, ".", "."))); len(rrs) != 11 {
+		t.Errorf("Expected a full transfer for an unknown serial, got %d records", len(rrs))
+	}
+
+	resp, _, err := c.Exchange(signed(new(dns.Msg).SetIxfr("opl.rpz.", second, ".", ".")), addr)
+	if err != nil || len(resp.Answer) != 1 || resp.Answer[0].(*dns.SOA).Serial != second {
+		t.Errorf("Expected an up-to-date secondary to get the SOA alone, got %v (%v)", resp, err)
+	}
+
+	resp, _, err = c.Exchange(signed(new(dns.Msg).SetQuestion("www.picket.example.opl.rpz.", dns.TypeAAAA)), addr)
+	if err != nil || len(resp.Answer) != 1 || !resp.Authoritative {
+		t.Errorf("Expected the wildcard to answer for a subdomain, got %v (%v)", resp, err)
+	}
+	resp, _, err = c.Exchange(signed(new(dns.Msg).SetQuestion("news.example.opl.rpz.", dns.TypeA)), addr)
+	if err != nil || resp.Rcode != dns.RcodeNameError {
+		t.Errorf("Expected NXDOMAIN for a domain no longer blocked, got %v (%v)", resp, err)
+	}
+}
+
+func TestServerAccess(t *testing.T) {
+	s, addr := startServer(t, Config{
+		AllowTransfer: []string{"192.0.2.0/24"},
+	})
+	s.Update(blocklistOf("shop.example.com"))
+
+	resp, err := dns.Exchange(new(dns.Msg).SetQuestion("opl.rpz.", dns.TypeSOA), addr)
+	if err != nil || resp.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected a client outside allow_transfer refused, got %v (%v)", resp, err)
+	}
+
+	s, addr = startServer(t, Config{
+		Keys: []Key{{Name: testKey, Algorithm: "hmac-sha256", Secret: testSecret}},
+	})
+	s.Update(blocklistOf("shop.example.com"))
+
+	resp, err = dns.Exchange(new(dns.Msg).SetQuestion("opl.rpz.", dns.TypeSOA), addr)
+	if err != nil || resp.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected an unsigned query refused, got %v (%v)", resp, err)
+	}
+
+	c := &dns.Client{TsigSecret: map[string]string{testKey: "d3Jvbmcta2V5"}}
+	resp, _, _ = c.Exchange(signed(new(dns.Msg).SetQuestion("opl.rpz.", dns.TypeSOA)), addr)
+	if resp == nil || resp.Rcode != dns.RcodeNotAuth {
+		t.Errorf("Expected a query signed with the wrong key rejected, got %v", resp)
+	}
+
+	c.TsigSecret = map[string]string{testKey: testSecret}
+	resp, _, err = c.Exchange(signed(new(dns.Msg).SetQuestion("other.zone.", dns.TypeSOA)), addr)
+	if err != nil || resp.Rcode != dns.RcodeRefused {
+		t.Errorf("Expected a query outside the zone refused, got %v (%v)", resp, err)
+	}
+}
+
+func TestServerNotify(t *testing.T) {
+	notified := make(chan *dns.Msg, 4)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondary := &dns.Server{
+		PacketConn: pc,
+		TsigSecret: map[string]string{testKey: testSecret},
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			if w.TsigStatus() != nil {
+				m.Rcode = dns.RcodeNotAuth
+			} else {
+				m.SetTsig(testKey, dns.HmacSHA256, 300, time.Now().Unix())
+			}
+			w.WriteMsg(m)
+			notified <- r
+		}),
+	}
+	go secondary.ActivateAndServe()
+	defer secondary.Shutdown()
+
+	s, _ := startServer(t, Config{
+		Keys:   []Key{{Name: testKey, Algorithm: "hmac-sha256", Secret: testSecret}},
+		Notify: []string{pc.LocalAddr().String()},
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.Run(ctx)
+
+	s.Update(blocklistOf("shop.example.com"))
+	select {
+	case m := <-notified:
+		if m.Opcode != dns.OpcodeNotify || m.Question[0].Name != "opl.rpz." || m.IsTsig() == nil {
+			t.Errorf("Expected a signed NOTIFY for opl.rpz., got %v", m)
+		}
+		if soa, ok := m.Answer[0].(*dns.SOA); !ok || soa.Serial != s.Serial() {
+			t.Errorf("Expected the NOTIFY to carry serial %d, got %v", s.Serial(), m.Answer)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the secondary to be notified")
+	}
+}
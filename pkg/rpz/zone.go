@@ -0,0 +1,221 @@
+// Package rpz serves the OPL blocklist as a DNS response policy zone (RPZ),
+// so resolvers such as BIND, PowerDNS Recursor and Knot Resolver can
+// transfer it and enforce the blocklist themselves.
+package rpz
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+)
+
+// Action is how resolvers answer queries for blocked domains.
+type Action string
+
+const (
+	// ActionNull answers 0.0.0.0 and ::, as opl-dns itself does
+	ActionNull Action = "null"
+
+	// ActionNXDomain answers that the name does not exist
+	ActionNXDomain Action = "nxdomain"
+
+	// ActionNoData answers that the name has no records of the type asked
+	ActionNoData Action = "nodata"
+)
+
+// SOA timers. Secondaries are told about changes with NOTIFY, so the
+// refresh interval only bounds how long a missed NOTIFY goes unnoticed. The
+// expiry is long so that secondaries keep enforcing the blocklist through
+// an outage of this server.
+const (
+	soaRefresh = 5 * 60
+	soaRetry   = 60
+	soaExpire  = 7 * 24 * 60 * 60
+)
+
+// snapshot is one version of the zone.
+type snapshot struct {
+	serial  uint32
+	domains []string // sorted, lowercase, without the final dot
+}
+
+// delta is the change between two consecutive versions of the zone.
+type delta struct {
+	from, to uint32
+	added    []string
+	removed  []string
+}
+
+// domainsOf returns the sorted, unique domains blocklist blocks at now.
+// Domains that cannot be placed under origin are skipped.
+func domainsOf(blocklist *api.Blocklist, origin string, now time.Time) []string {
+	var domains []string
+	for _, item := range blocklist.BlockList {
+		if item.Expired(now) {
+			continue
+		}
+		d := strings.ToLower(strings.TrimSuffix(item.Domain, "."))
+		if d == "" {
+			continue
+		}
+		// The wildcard owner is the longest name the domain needs
+		if _, ok := dns.IsDomainName("*." + d + "." + origin); !ok {
+			continue
+		}
+		domains = append(domains, d)
+	}
+	slices.Sort(domains)
+	return slices.Compact(domains)
+}
+
+// diff returns the domains in next but not prev, and those in prev but not
+// next. Both must be sorted.
+func diff(prev, next []string) (added, removed []string) {
+	i, j := 0, 0
+	for i < len(prev) || j < len(next) {
+		switch {
+		case j == len(next) || (i < len(prev) && prev[i] < next[j]):
+			removed = append(removed, prev[i])
+			i++
+		case i == len(prev) || next[j] < prev[i]:
+			added = append(added, next[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return added, removed
+}
+
+// nextSerial returns the serial following serial. Serials follow the clock
+// where they can, so that they keep increasing across restarts and
+// secondaries take the first version served after one.
+func nextSerial(serial uint32, now time.Time) uint32 {
+	if t := uint32(now.Unix()); int32(t-serial) > 0 {
+		return t
+	}
+	return serial + 1
+}
+
+// zoneData builds the records of a zone named origin.
+type zoneData struct {
+	origin string // fully qualified, lowercase
+	action Action
+	ttl    uint32
+}
+
+// newZoneData checks the zone name and action in cfg.
+func newZoneData(cfg Config) (zoneData, error) {
+	origin := dns.CanonicalName(cfg.Zone)
+	if _, ok := dns.IsDomainName(origin); !ok || origin == "." {
+		return zoneData{}, fmt.Errorf("invalid zone name %q", cfg.Zone)
+	}
+	action := cfg.Action
+	switch action {
+	case "":
+		action = ActionNull
+	case ActionNull, ActionNXDomain, ActionNoData:
+	default:
+		return zoneData{}, fmt.Errorf("unknown action %q", action)
+	}
+	return zoneData{origin: origin, action: action, ttl: uint32(cfg.TTL / time.Second)}, nil
+}
+
+// WriteZone writes the zone a Server configured with cfg would serve for
+// blocklist at now to w, as a master file, for resolvers that load the
+// policy zone from a file instead of transferring it. Only the Zone, Action
+// and TTL of cfg are used. The serial follows the clock, as a Server's does.
+func WriteZone(w io.Writer, cfg Config, blocklist *api.Blocklist, now time.Time) error {
+	z, err := newZoneData(cfg)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "$ORIGIN %s\n", z.origin)
+	soa := z.soa(nextSerial(0, now))
+	for _, rr := range []dns.RR{soa, z.ns()} {
+		fmt.Fprintln(bw, rr)
+	}
+	for _, d := range domainsOf(blocklist, z.origin, now) {
+		for _, rr := range z.records(d) {
+			fmt.Fprintln(bw, rr)
+		}
+	}
+	return bw.Flush()
+}
+
+// soa returns the zone's SOA record for serial.
+func (z zoneData) soa(serial uint32) dns.RR {
+	return &dns.SOA{
+		Hdr:     z.header(z.origin, dns.TypeSOA),
+		Ns:      "localhost.",
+		Mbox:    "hostmaster." + z.origin,
+		Serial:  serial,
+		Refresh: soaRefresh,
+		Retry:   soaRetry,
+		Expire:  soaExpire,
+		Minttl:  z.ttl,
+	}
+}
+
+// ns returns the zone's NS record. Resolvers never query a policy zone's
+// name servers, so it names localhost, as is usual for RPZ.
+func (z zoneData) ns() dns.RR {
+	return &dns.NS{Hdr: z.header(z.origin, dns.TypeNS), Ns: "localhost."}
+}
+
+// records returns the policy records blocking domain and its subdomains.
+func (z zoneData) records(domain string) []dns.RR {
+	owner := domain + "." + z.origin
+	var rrs []dns.RR
+	for _, name := range []string{owner, "*." + owner} {
+		rrs = append(rrs, z.recordsAt(name)...)
+	}
+	return rrs
+}
+
+// recordsAt returns the policy records owned by name.
+func (z zoneData) recordsAt(name string) []dns.RR {
+	switch z.action {
+	case ActionNXDomain:
+		return []dns.RR{&dns.CNAME{Hdr: z.header(name, dns.TypeCNAME), Target: "."}}
+	case ActionNoData:
+		return []dns.RR{&dns.CNAME{Hdr: z.header(name, dns.TypeCNAME), Target: "*."}}
+	default:
+		return []dns.RR{
+			&dns.A{Hdr: z.header(name, dns.TypeA), A: net.IPv4zero},
+			&dns.AAAA{Hdr: z.header(name, dns.TypeAAAA), AAAA: net.IPv6zero},
+		}
+	}
+}
+
+func (z zoneData) header(name string, rrtype uint16) dns.RR_Header {
+	return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: z.ttl}
+}
+
+// blocked returns the blocked domain a name in the zone belongs to, or ""
+// if it belongs to none. Names under a blocked domain's wildcard are
+// matched the way the wildcard record would match them.
+func (s *snapshot) blocked(name string) string {
+	if _, ok := slices.BinarySearch(s.domains, name); ok {
+		return name
+	}
+	for {
+		i := strings.IndexByte(name, '.')
+		if i < 0 {
+			return ""
+		}
+		name = name[i+1:]
+		if _, ok := slices.BinarySearch(s.domains, name); ok {
+			return name
+		}
+	}
+}
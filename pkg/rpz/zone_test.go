@@ -0,0 +1,91 @@
+package rpz
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/online-picket-line/opl-for-dns/pkg/api"
+)
+
+func TestDomainsOf(t *testing.T) {
+	now := time.Now()
+	blocklist := &api.Blocklist{BlockList: []api.BlockListItem{
+		{Domain: "Shop.Example.com"},
+		{Domain: "shop.example.com."},
+		{Domain: "ended.example", ExpiresAt: now.Add(-time.Minute)},
+		{Domain: "ending.example", ExpiresAt: now.Add(time.Minute)},
+		{Domain: "bad..example"},
+		{Domain: ""},
+	}}
+	got := domainsOf(blocklist, "opl.rpz.", now)
+	if want := []string{"ending.example", "shop.example.com"}; !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	added, removed := diff([]string{"a.example", "b.example", "d.example"}, []string{"b.example", "c.example", "e.example"})
+	if want := []string{"c.example", "e.example"}; !slices.Equal(added, want) {
+		t.Errorf("Expected %v added, got %v", want, added)
+	}
+	if want := []string{"a.example", "d.example"}; !slices.Equal(removed, want) {
+		t.Errorf("Expected %v removed, got %v", want, removed)
+	}
+}
+
+func TestNextSerial(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	if got := nextSerial(0, now); got != 1_800_000_000 {
+		t.Errorf("Expected the first serial to follow the clock, got %d", got)
+	}
+	if got := nextSerial(1_800_000_000, now); got != 1_800_000_001 {
+		t.Errorf("Expected a second change within a second to increment, got %d", got)
+	}
+	if got := nextSerial(1_900_000_000, now); got != 1_900_000_001 {
+		t.Errorf("Expected a serial ahead of the clock to increment, got %d", got)
+	}
+}
+
+func TestWriteZone(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	blocklist := &api.Blocklist{BlockList: []api.BlockListItem{
+		{Domain: "shop.example.com"},
+		{Domain: "ended.example", ExpiresAt: now.Add(-time.Minute)},
+	}}
+
+	var buf bytes.Buffer
+	cfg := Config{Zone: "OPL.rpz", Action: ActionNXDomain, TTL: time.Minute}
+	if err := WriteZone(&buf, cfg, blocklist, now); err != nil {
+		t.Fatalf("WriteZone failed: %v", err)
+	}
+
+	// The file must load as a zone
+	var names []string
+	zp := dns.NewZoneParser(strings.NewReader(buf.String()), "", "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		names = append(names, rr.Header().Name+" "+dns.TypeToString[rr.Header().Rrtype])
+		if soa, isSOA := rr.(*dns.SOA); isSOA && soa.Serial != 1_800_000_000 {
+			t.Errorf("Expected the serial to follow the clock, got %d", soa.Serial)
+		}
+	}
+	if err := zp.Err(); err != nil {
+		t.Fatalf("Failed to parse the zone: %v\n%s", err, buf.String())
+	}
+	want := []string{
+		"opl.rpz. SOA",
+		"opl.rpz. NS",
+		"shop.example.com.opl.rpz. CNAME",
+		"*.shop.example.com.opl.rpz. CNAME",
+	}
+	if !slices.Equal(names, want) {
+		t.Errorf("Expected %v, got %v", want, names)
+	}
+
+	if err := WriteZone(&buf, Config{Zone: "opl.rpz", Action: "drop"}, blocklist, now); err == nil {
+		t.Error("Expected an unknown action rejected")
+	}
+}
@@ -0,0 +1,101 @@
+package stats
+
+import "time"
+
+// Blocklist fetch kinds.
+const (
+	FetchFull = "full"
+	FetchDiff = "diff"
+)
+
+// Blocklist fetch results.
+const (
+	// FetchOK means a new blocklist was downloaded and applied.
+	FetchOK = "ok"
+	// FetchNotModified means the API answered 304 and the cache was kept.
+	FetchNotModified = "not_modified"
+	// FetchUnavailable means a diff was not available and a full fetch
+	// follows. It is not a failure.
+	FetchUnavailable = "unavailable"
+	// FetchError means the request failed or the response was unusable.
+	FetchError = "error"
+)
+
+// APIFetch describes one blocklist request to the OPL API.
+type APIFetch struct {
+	// Kind is FetchFull or FetchDiff.
+	Kind string
+
+	// Result is one of the Fetch result constants.
+	Result string
+
+	// Duration is the time from sending the request to having the new
+	// blocklist in place, including ParseDuration.
+	Duration time.Duration
+
+	// Bytes is the size of the response body.
+	Bytes int64
+
+	// ParseDuration is the time spent decoding the response and building
+	// the blocklist. It is zero when nothing was parsed.
+	ParseDuration time.Duration
+
+	// ConsecutiveFailures is the number of failed fetches in a row,
+	// including this one. It is zero after any result but FetchError.
+	ConsecutiveFailures int
+}
+
+// APIFetchStats summarizes the blocklist fetches recorded by a Collector.
+type APIFetchStats struct {
+	Fetches     int64 `json:"fetches"`
+	NotModified int64 `json:"notModified"`
+	Failures    int64 `json:"failures"`
+
+	// NotModifiedRatio is NotModified divided by Fetches, or 0 before the
+	// first fetch.
+	NotModifiedRatio float64 `json:"notModifiedRatio"`
+
+	// Details of the most recent fetch that downloaded a blocklist
+	LastDurationMs      int64 `json:"lastDurationMs"`
+	LastBytes           int64 `json:"lastBytes"`
+	LastParseDurationMs int64 `json:"lastParseDurationMs"`
+
+	ConsecutiveFailures int `json:"consecutiveFailures"`
+}
+
+// RecordAPIFetch records one blocklist request to the OPL API. Fallbacks
+// from an unavailable diff are not counted, since the full fetch that
+// follows is.
+func (c *Collector) RecordAPIFetch(fetch APIFetch) {
+	if fetch.Result == FetchUnavailable {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.apiFetch.Fetches++
+	c.apiFetch.ConsecutiveFailures = fetch.ConsecutiveFailures
+	switch fetch.Result {
+	case FetchNotModified:
+		c.apiFetch.NotModified++
+	case FetchError:
+		c.apiFetch.Failures++
+	case FetchOK:
+		c.apiFetch.LastDurationMs = fetch.Duration.Milliseconds()
+		c.apiFetch.LastBytes = fetch.Bytes
+		c.apiFetch.LastParseDurationMs = fetch.ParseDuration.Milliseconds()
+	}
+}
+
+// APIFetchStats returns a summary of the recorded blocklist fetches.
+func (c *Collector) APIFetchStats() APIFetchStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := c.apiFetch
+	if s.Fetches > 0 {
+		s.NotModifiedRatio = float64(s.NotModified) / float64(s.Fetches)
+	}
+	return s
+}
@@ -0,0 +1,40 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCollector_APIFetchStats(t *testing.T) {
+	c := NewCollector()
+
+	if s := c.APIFetchStats(); s.Fetches != 0 || s.NotModifiedRatio != 0 {
+		t.Errorf("Expected empty stats, got %+v", s)
+	}
+
+	c.RecordAPIFetch(APIFetch{
+		Kind:          FetchFull,
+		Result:        FetchOK,
+		Duration:      250 * time.Millisecond,
+		Bytes:         4096,
+		ParseDuration: 20 * time.Millisecond,
+	})
+	c.RecordAPIFetch(APIFetch{Kind: FetchDiff, Result: FetchUnavailable})
+	c.RecordAPIFetch(APIFetch{Kind: FetchFull, Result: FetchNotModified, Duration: time.Millisecond})
+	c.RecordAPIFetch(APIFetch{Kind: FetchFull, Result: FetchNotModified, Duration: time.Millisecond})
+	c.RecordAPIFetch(APIFetch{Kind: FetchFull, Result: FetchError, ConsecutiveFailures: 1})
+
+	want := APIFetchStats{
+		Fetches:             4,
+		NotModified:         2,
+		Failures:            1,
+		NotModifiedRatio:    0.5,
+		LastDurationMs:      250,
+		LastBytes:           4096,
+		LastParseDurationMs: 20,
+		ConsecutiveFailures: 1,
+	}
+	if got := c.APIFetchStats(); got != want {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,167 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint is the part of a Collector's state that survives restarts:
+// lifetime counters, the baselines for report deltas, and the breakdowns in
+// the stats report. Latency histograms, per-minute history, and per-client
+// counts start afresh.
+type Checkpoint struct {
+	SavedAt       time.Time `json:"savedAt"`
+	CountersSince time.Time `json:"countersSince"`
+
+	TotalQueries       int64 `json:"totalQueries"`
+	QueriesBlocked     int64 `json:"queriesBlocked"`
+	QueriesForwarded   int64 `json:"queriesForwarded"`
+	BypassesIssued     int64 `json:"bypassesIssued"`
+	SoftFailureRetries int64 `json:"softFailureRetries"`
+
+	LastReportQueries   int64 `json:"lastReportQueries"`
+	LastReportBlocked   int64 `json:"lastReportBlocked"`
+	LastReportForwarded int64 `json:"lastReportForwarded"`
+	LastReportBypasses  int64 `json:"lastReportBypasses"`
+
+	BlockedDomains   map[string]int64      `json:"blockedDomains,omitempty"`
+	BlockedEmployers []employerActionCount `json:"blockedEmployers,omitempty"`
+	UpstreamRcodes   map[string]int64      `json:"upstreamRcodes,omitempty"`
+	QueryTypes       map[string]int64      `json:"queryTypes,omitempty"`
+	ResponseRcodes   map[string]int64      `json:"responseRcodes,omitempty"`
+	RateLimited      map[string]int64      `json:"rateLimited,omitempty"`
+	Panics           map[string]int64      `json:"panics,omitempty"`
+}
+
+// employerActionCount is one entry of Collector.blockedEmployers, whose
+// struct keys cannot be JSON object keys.
+type employerActionCount struct {
+	Employer string `json:"employer"`
+	ActionID string `json:"actionId,omitempty"`
+	Count    int64  `json:"count"`
+}
+
+// Checkpoint returns the collector's persistent state.
+func (c *Collector) Checkpoint() Checkpoint {
+	cp := Checkpoint{
+		SavedAt:             time.Now(),
+		TotalQueries:        c.totalQueries.Load(),
+		QueriesBlocked:      c.queriesBlocked.Load(),
+		QueriesForwarded:    c.queriesForwarded.Load(),
+		BypassesIssued:      c.bypassesIssued.Load(),
+		SoftFailureRetries:  c.softFailureRetries.Load(),
+		LastReportQueries:   c.lastReportQueries.Load(),
+		LastReportBlocked:   c.lastReportBlocked.Load(),
+		LastReportForwarded: c.lastReportForwarded.Load(),
+		LastReportBypasses:  c.lastReportBypasses.Load(),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cp.CountersSince = c.countersSince
+	cp.BlockedDomains = c.blockedDomains.counts()
+	for key, count := range c.blockedEmployers {
+		cp.BlockedEmployers = append(cp.BlockedEmployers, employerActionCount{key.Employer, key.ActionID, count})
+	}
+	cp.UpstreamRcodes = maps.Clone(c.upstreamRcodes)
+	cp.QueryTypes = maps.Clone(c.queryTypes)
+	cp.ResponseRcodes = maps.Clone(c.responseRcodes)
+	cp.RateLimited = maps.Clone(c.rateLimited)
+	cp.Panics = maps.Clone(c.panics)
+	return cp
+}
+
+// Restore adds the counts in cp to the collector and takes over its report
+// baselines. Call it before the collector starts recording.
+func (c *Collector) Restore(cp Checkpoint) {
+	c.totalQueries.Add(cp.TotalQueries)
+	c.queriesBlocked.Add(cp.QueriesBlocked)
+	c.queriesForwarded.Add(cp.QueriesForwarded)
+	c.bypassesIssued.Add(cp.BypassesIssued)
+	c.softFailureRetries.Add(cp.SoftFailureRetries)
+	c.lastReportQueries.Store(cp.LastReportQueries)
+	c.lastReportBlocked.Store(cp.LastReportBlocked)
+	c.lastReportForwarded.Store(cp.LastReportForwarded)
+	c.lastReportBypasses.Store(cp.LastReportBypasses)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !cp.CountersSince.IsZero() {
+		c.countersSince = cp.CountersSince
+	}
+	c.blockedDomains.merge(cp.BlockedDomains)
+	for _, e := range cp.BlockedEmployers {
+		c.blockedEmployers[employerKey{e.Employer, e.ActionID}] += e.Count
+	}
+	addCounts(c.upstreamRcodes, cp.UpstreamRcodes)
+	addCounts(c.queryTypes, cp.QueryTypes)
+	addCounts(c.responseRcodes, cp.ResponseRcodes)
+	addCounts(c.rateLimited, cp.RateLimited)
+	addCounts(c.panics, cp.Panics)
+}
+
+func addCounts(dst, src map[string]int64) {
+	for k, v := range src {
+		dst[k] += v
+	}
+}
+
+// CountersSince returns when the lifetime counters started, which is
+// earlier than the process start if they were restored from a checkpoint.
+func (c *Collector) CountersSince() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.countersSince
+}
+
+// LoadCheckpoint reads a checkpoint written by SaveCheckpoint. A missing file
+// yields an empty checkpoint.
+func LoadCheckpoint(path string) (Checkpoint, error) {
+	var cp Checkpoint
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return cp, nil
+	case err != nil:
+		return cp, fmt.Errorf("reading stats file: %w", err)
+	}
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return cp, fmt.Errorf("parsing stats file: %w", err)
+	}
+	return cp, nil
+}
+
+// SaveCheckpoint writes cp next to path and renames it into place, so a
+// crash mid-write never leaves a truncated file behind.
+func SaveCheckpoint(path string, cp Checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return fmt.Errorf("marshaling stats: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("writing stats file: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing stats file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing stats file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing stats file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing stats file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package stats
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	c := NewCollector()
+	c.RecordBlock("acme.com")
+	c.RecordEmployerBlock("Acme", "strike-1")
+	c.RecordQuery()
+	c.RecordQueryType("A")
+	c.RecordResponseRcode("NOERROR")
+	c.RecordUpstreamRcode("NOERROR")
+	c.RecordRateLimited("dns")
+	c.computeDeltas()
+	c.RecordQuery()
+
+	path := filepath.Join(t.TempDir(), "stats.json")
+	if err := SaveCheckpoint(path, c.Checkpoint()); err != nil {
+		t.Fatalf("SaveCheckpoint failed: %v", err)
+	}
+
+	cp, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint failed: %v", err)
+	}
+	restored := NewCollector()
+	restored.Restore(cp)
+
+	if total, blocked, forwarded, _ := restored.Snapshot(); total != 3 || blocked != 1 || forwarded != 2 {
+		t.Errorf("expected 3/1/2 after restore, got %d/%d/%d", total, blocked, forwarded)
+	}
+	if dQ, dB, dF, _ := restored.computeDeltas(); dQ != 1 || dB != 0 || dF != 1 {
+		t.Errorf("expected deltas to continue from the saved baseline, got %d/%d/%d", dQ, dB, dF)
+	}
+	if top := restored.TopBlockedDomains(1); len(top) != 1 || top[0].Count != 1 {
+		t.Errorf("unexpected top blocked domains %+v", top)
+	}
+	if top := restored.TopBlockedEmployers(1); len(top) != 1 || top[0].Actions[0].ID != "strike-1" {
+		t.Errorf("unexpected top blocked employers %+v", top)
+	}
+	if restored.QueryTypes()["A"] != 1 || restored.ResponseRcodes()["NOERROR"] != 1 ||
+		restored.UpstreamRcodes()["NOERROR"] != 1 || restored.RateLimited()["dns"] != 1 {
+		t.Error("breakdowns were not restored")
+	}
+	if !restored.CountersSince().Equal(c.CountersSince()) {
+		t.Errorf("expected counters since %v, got %v", c.CountersSince(), restored.CountersSince())
+	}
+}
+
+func TestLoadCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+
+	cp, err := LoadCheckpoint(filepath.Join(dir, "missing.json"))
+	if err != nil || cp.TotalQueries != 0 {
+		t.Errorf("expected empty checkpoint for a missing file, got %+v, %v", cp, err)
+	}
+
+	c := NewCollector()
+	before := c.CountersSince()
+	c.Restore(cp)
+	if !c.CountersSince().Equal(before) {
+		t.Error("restoring an empty checkpoint should keep the start time")
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	os.WriteFile(corrupt, []byte("{"), 0644)
+	if _, err := LoadCheckpoint(corrupt); err == nil {
+		t.Error("expected an error for a corrupt file")
+	}
+
+	if err := SaveCheckpoint(filepath.Join(dir, "missing-dir", "stats.json"), Checkpoint{SavedAt: time.Now()}); err == nil {
+		t.Error("expected an error writing into a missing directory")
+	}
+}
@@ -0,0 +1,201 @@
+package stats
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ClientStatsConfig controls per-client query counting.
+type ClientStatsConfig struct {
+	// MaxClients bounds how many clients are tracked at once. When the
+	// table is full, the least active client is evicted to make room.
+	// Defaults to 1000.
+	MaxClients int
+
+	// Anonymize records a keyed hash of each client address instead of the
+	// address itself.
+	Anonymize bool
+
+	// Report includes the most active clients in the stats report. Client
+	// addresses are always hashed before they are reported, with a key
+	// that changes every day (UTC).
+	Report bool
+}
+
+// ClientCount holds one client's query and block counts.
+type ClientCount struct {
+	Client  string `json:"client"`
+	Queries int64  `json:"queries"`
+	Blocked int64  `json:"blocked"`
+}
+
+// clientStats counts queries per client in a bounded table.
+type clientStats struct {
+	maxClients int
+	anonymize  bool
+	report     bool
+
+	// key hashes client addresses. It is random per process, so hashed IDs
+	// stay stable until restart but cannot be reversed by the backend.
+	key []byte
+
+	now func() time.Time
+
+	mu     sync.Mutex
+	counts map[string]*ClientCount
+
+	// reportKey hashes reported clients. It is replaced every day, so the
+	// backend cannot follow a client from one day to the next.
+	reportKey    []byte
+	reportKeyDay int64
+}
+
+func newClientStats(cfg ClientStatsConfig) *clientStats {
+	if cfg.MaxClients <= 0 {
+		cfg.MaxClients = 1000
+	}
+	key := make([]byte, 32)
+	rand.Read(key)
+	return &clientStats{
+		maxClients: cfg.MaxClients,
+		anonymize:  cfg.Anonymize,
+		report:     cfg.Report,
+		key:        key,
+		now:        time.Now,
+		counts:     make(map[string]*ClientCount),
+	}
+}
+
+// reportHash hashes id for the stats report with the current day's key.
+func (s *clientStats) reportHash(id string) string {
+	s.mu.Lock()
+	if day := s.now().UTC().Unix() / 86400; s.reportKey == nil || day != s.reportKeyDay {
+		s.reportKey = make([]byte, 32)
+		rand.Read(s.reportKey)
+		s.reportKeyDay = day
+	}
+	key := s.reportKey
+	s.mu.Unlock()
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// hash returns a short keyed hash identifying client.
+func (s *clientStats) hash(client string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(client))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+func (s *clientStats) record(client netip.Addr, blocked bool) {
+	id := client.Unmap().String()
+	if s.anonymize {
+		id = s.hash(id)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.counts[id]
+	if !ok {
+		if len(s.counts) >= s.maxClients {
+			s.evictLocked()
+		}
+		c = &ClientCount{Client: id}
+		s.counts[id] = c
+	}
+	c.Queries++
+	if blocked {
+		c.Blocked++
+	}
+}
+
+// evictLocked drops the client with the fewest queries.
+func (s *clientStats) evictLocked() {
+	var victim *ClientCount
+	for _, c := range s.counts {
+		if victim == nil || c.Queries < victim.Queries {
+			victim = c
+		}
+	}
+	if victim != nil {
+		delete(s.counts, victim.Client)
+	}
+}
+
+// top returns the n clients with the most blocked queries, then the most
+// queries overall.
+func (s *clientStats) top(n int) []ClientCount {
+	s.mu.Lock()
+	clients := make([]ClientCount, 0, len(s.counts))
+	for _, c := range s.counts {
+		clients = append(clients, *c)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].Blocked != clients[j].Blocked {
+			return clients[i].Blocked > clients[j].Blocked
+		}
+		if clients[i].Queries != clients[j].Queries {
+			return clients[i].Queries > clients[j].Queries
+		}
+		return clients[i].Client < clients[j].Client
+	})
+
+	if len(clients) > n {
+		clients = clients[:n]
+	}
+	return clients
+}
+
+// reported returns the top n clients for the stats report, with addresses
+// hashed, or nil if clients are not reported.
+func (s *clientStats) reported(n int) []ClientCount {
+	if !s.report {
+		return nil
+	}
+	clients := s.top(n)
+	for i := range clients {
+		clients[i].Client = s.reportHash(clients[i].Client)
+	}
+	return clients
+}
+
+// RecordClientQuery records a query from client and whether it was blocked.
+// Clients are always counted towards UniqueClients; per-client counts are
+// only kept if the collector was created WithClientStats.
+func (c *Collector) RecordClientQuery(client netip.Addr, blocked bool) {
+	if !client.IsValid() {
+		return
+	}
+	c.unique.record(client, blocked)
+	if c.clients != nil {
+		c.clients.record(client, blocked)
+	}
+}
+
+// TopClients returns the n clients with the most blocked queries, or nil if
+// per-client stats are disabled.
+func (c *Collector) TopClients(n int) []ClientCount {
+	if c.clients == nil {
+		return nil
+	}
+	return c.clients.top(n)
+}
+
+// reportedClients returns the top n clients for the stats report.
+func (c *Collector) reportedClients(n int) []ClientCount {
+	if c.clients == nil {
+		return nil
+	}
+	return c.clients.reported(n)
+}
@@ -0,0 +1,109 @@
+package stats
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestCollector_TopClients(t *testing.T) {
+	c := NewCollector()
+	c.RecordClientQuery(netip.MustParseAddr("192.168.1.10"), true)
+	if clients := c.TopClients(10); clients != nil {
+		t.Errorf("Expected no client stats when disabled, got %+v", clients)
+	}
+
+	c = NewCollector(WithClientStats(ClientStatsConfig{MaxClients: 3}))
+	record := func(client string, queries, blocked int) {
+		for i := range queries {
+			c.RecordClientQuery(netip.MustParseAddr(client), i < blocked)
+		}
+	}
+	record("192.168.1.10", 5, 0)
+	record("192.168.1.11", 2, 2)
+	record("::ffff:192.168.1.12", 3, 1)
+	c.RecordClientQuery(netip.Addr{}, true)
+
+	want := []ClientCount{
+		{Client: "192.168.1.11", Queries: 2, Blocked: 2},
+		{Client: "192.168.1.12", Queries: 3, Blocked: 1},
+		{Client: "192.168.1.10", Queries: 5},
+	}
+	got := c.TopClients(10)
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d clients, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Client %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+
+	// A new client evicts the least active one
+	record("192.168.1.13", 1, 0)
+	got = c.TopClients(10)
+	if len(got) != 3 {
+		t.Fatalf("Expected table to stay at 3 clients, got %+v", got)
+	}
+	for _, cc := range got {
+		if cc.Client == "192.168.1.11" {
+			t.Errorf("Expected least active client to be evicted, got %+v", got)
+		}
+	}
+
+	if top := c.TopClients(1); len(top) != 1 || top[0].Client != "192.168.1.12" {
+		t.Errorf("Expected top client 192.168.1.12, got %+v", top)
+	}
+}
+
+func TestCollector_ClientsAnonymized(t *testing.T) {
+	c := NewCollector(WithClientStats(ClientStatsConfig{Anonymize: true, Report: true}))
+	c.RecordClientQuery(netip.MustParseAddr("192.168.1.10"), true)
+	c.RecordClientQuery(netip.MustParseAddr("192.168.1.10"), false)
+
+	got := c.TopClients(10)
+	if len(got) != 1 || got[0].Queries != 2 || got[0].Blocked != 1 {
+		t.Fatalf("Unexpected client counts %+v", got)
+	}
+	if got[0].Client == "192.168.1.10" || len(got[0].Client) != 16 {
+		t.Errorf("Expected a hashed client ID, got %q", got[0].Client)
+	}
+	if reported := c.reportedClients(10); len(reported) != 1 || reported[0].Client == got[0].Client || len(reported[0].Client) != 16 {
+		t.Errorf("Expected reported ID to be hashed with the report key, got %+v", reported)
+	}
+}
+
+func TestCollector_ReportedClientsRotateDaily(t *testing.T) {
+	c := NewCollector(WithClientStats(ClientStatsConfig{Report: true}))
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	c.clients.now = func() time.Time { return now }
+	c.RecordClientQuery(netip.MustParseAddr("192.168.1.10"), true)
+
+	first := c.reportedClients(10)[0].Client
+	now = now.Add(13 * time.Hour)
+	if same := c.reportedClients(10)[0].Client; same != first {
+		t.Errorf("Expected the same ID within a day, got %q and %q", first, same)
+	}
+	now = now.Add(time.Hour)
+	if next := c.reportedClients(10)[0].Client; next == first {
+		t.Errorf("Expected a new ID the next day, got %q again", next)
+	}
+}
+
+func TestCollector_ReportedClients(t *testing.T) {
+	c := NewCollector(WithClientStats(ClientStatsConfig{}))
+	c.RecordClientQuery(netip.MustParseAddr("192.168.1.10"), true)
+	if reported := c.reportedClients(10); reported != nil {
+		t.Errorf("Expected no reported clients unless enabled, got %+v", reported)
+	}
+
+	c = NewCollector(WithClientStats(ClientStatsConfig{Report: true}))
+	c.RecordClientQuery(netip.MustParseAddr("192.168.1.10"), true)
+	if local := c.TopClients(10); local[0].Client != "192.168.1.10" {
+		t.Errorf("Expected local stats to keep the address, got %+v", local)
+	}
+	reported := c.reportedClients(10)
+	if len(reported) != 1 || reported[0].Client == "192.168.1.10" || reported[0].Blocked != 1 {
+		t.Errorf("Expected reported client to be hashed, got %+v", reported)
+	}
+}
@@ -4,9 +4,9 @@ package stats
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
+	"maps"
 	"net/http"
 	"sort"
 	"sync"
@@ -27,40 +27,186 @@ type Collector struct {
 	lastReportForwarded atomic.Int64
 	lastReportBypasses  atomic.Int64
 
-	// Top blocked domains tracking
-	mu             sync.Mutex
-	blockedDomains map[string]int64
+	// Upstream resolution health
+	softFailureRetries atomic.Int64
+
+	// Query handling and upstream exchange times
+	queryLatency    latencyHistogram
+	upstreamLatency latencyHistogram
+
+	// Per-minute counts for the last day
+	history history
+
+	// Top blocked domains and employers, upstream rcode, and rate limit
+	// tracking
+	mu               sync.Mutex
+	blockedDomains   *domainCounts
+	blockedEmployers map[employerKey]int64
+	upstreamRcodes   map[string]int64
+	queryTypes       map[string]int64
+	responseRcodes   map[string]int64
+	rateLimited      map[string]int64
+	panics           map[string]int64
+	apiFetch         APIFetchStats
+	lastBlocked      string
+
+	// Per-client counts; nil unless enabled with WithClientStats
+	clients *clientStats
+
+	// Distinct clients since the last report
+	unique *uniqueClients
 
 	startTime time.Time
+
+	// countersSince is when the lifetime counters started; guarded by mu
+	countersSince time.Time
+}
+
+// CollectorOption configures a Collector.
+type CollectorOption func(*Collector)
+
+// WithClientStats enables per-client query and block counts.
+func WithClientStats(cfg ClientStatsConfig) CollectorOption {
+	return func(c *Collector) {
+		c.clients = newClientStats(cfg)
+	}
 }
 
 // NewCollector creates a new stats collector.
-func NewCollector() *Collector {
-	return &Collector{
-		blockedDomains: make(map[string]int64),
-		startTime:      time.Now(),
+func NewCollector(opts ...CollectorOption) *Collector {
+	c := &Collector{
+		blockedDomains:   newDomainCounts(defaultMaxBlockedDomains),
+		blockedEmployers: make(map[employerKey]int64),
+		upstreamRcodes:   make(map[string]int64),
+		queryTypes:       make(map[string]int64),
+		responseRcodes:   make(map[string]int64),
+		rateLimited:      make(map[string]int64),
+		panics:           make(map[string]int64),
+		unique:           newUniqueClients(),
+		startTime:        time.Now(),
 	}
+	c.history.now = time.Now
+	c.countersSince = c.startTime
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 // RecordQuery records a DNS query that was forwarded to upstream.
 func (c *Collector) RecordQuery() {
 	c.totalQueries.Add(1)
 	c.queriesForwarded.Add(1)
+	c.history.add(1, 0, 0)
 }
 
 // RecordBlock records a DNS query that was blocked.
 func (c *Collector) RecordBlock(domain string) {
 	c.totalQueries.Add(1)
 	c.queriesBlocked.Add(1)
+	c.history.add(1, 1, 0)
 
 	c.mu.Lock()
-	c.blockedDomains[domain]++
+	c.blockedDomains.add(domain, 1)
+	c.lastBlocked = domain
 	c.mu.Unlock()
 }
 
+// LastBlockedDomain returns the domain most recently blocked, or "" if none
+// has been since the collector was created.
+func (c *Collector) LastBlockedDomain() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastBlocked
+}
+
 // RecordBypass records a bypass being issued.
 func (c *Collector) RecordBypass() {
 	c.bypassesIssued.Add(1)
+	c.history.add(0, 0, 1)
+}
+
+// RecordUpstreamRcode records the response code of an upstream answer.
+func (c *Collector) RecordUpstreamRcode(rcode string) {
+	c.mu.Lock()
+	c.upstreamRcodes[rcode]++
+	c.mu.Unlock()
+}
+
+// RecordQueryType records the type of a query, e.g. "A" or "HTTPS".
+func (c *Collector) RecordQueryType(qtype string) {
+	c.mu.Lock()
+	c.queryTypes[qtype]++
+	c.mu.Unlock()
+}
+
+// RecordResponseRcode records the response code of an answer sent to a
+// client.
+func (c *Collector) RecordResponseRcode(rcode string) {
+	c.mu.Lock()
+	c.responseRcodes[rcode]++
+	c.mu.Unlock()
+}
+
+// QueryTypes returns a copy of the query counts by type.
+func (c *Collector) QueryTypes() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.queryTypes)
+}
+
+// ResponseRcodes returns a copy of the counts of answers sent to clients by
+// rcode.
+func (c *Collector) ResponseRcodes() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.responseRcodes)
+}
+
+// RecordSoftFailureRetry records a query retried on another upstream after a
+// SERVFAIL or REFUSED answer.
+func (c *Collector) RecordSoftFailureRetry() {
+	c.softFailureRetries.Add(1)
+}
+
+// UpstreamRcodes returns a copy of the upstream response counts by rcode.
+func (c *Collector) UpstreamRcodes() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.upstreamRcodes)
+}
+
+// SoftFailureRetries returns the number of soft-failure retries.
+func (c *Collector) SoftFailureRetries() int64 {
+	return c.softFailureRetries.Load()
+}
+
+// RecordRateLimited records a request rejected by the rate limiter.
+func (c *Collector) RecordRateLimited(scope string) {
+	c.mu.Lock()
+	c.rateLimited[scope]++
+	c.mu.Unlock()
+}
+
+// RateLimited returns a copy of the rate-limited request counts by scope.
+func (c *Collector) RateLimited() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.rateLimited)
+}
+
+// RecordPanic records a handler panic that was recovered.
+func (c *Collector) RecordPanic(scope string) {
+	c.mu.Lock()
+	c.panics[scope]++
+	c.mu.Unlock()
+}
+
+// Panics returns a copy of the recovered panic counts by scope.
+func (c *Collector) Panics() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return maps.Clone(c.panics)
 }
 
 // DomainCount holds a domain and its block count.
@@ -69,14 +215,15 @@ type DomainCount struct {
 	Count  int64  `json:"count"`
 }
 
-// TopBlockedDomains returns the top N blocked domains.
+// TopBlockedDomains returns the top N blocked domains. Counts of domains
+// that are rarely blocked may be overestimated; see WithMaxBlockedDomains.
 func (c *Collector) TopBlockedDomains(n int) []DomainCount {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	domains := make([]DomainCount, 0, len(c.blockedDomains))
-	for domain, count := range c.blockedDomains {
-		domains = append(domains, DomainCount{Domain: domain, Count: count})
+	domains := make([]DomainCount, 0, len(c.blockedDomains.entries))
+	for domain, e := range c.blockedDomains.entries {
+		domains = append(domains, DomainCount{Domain: domain, Count: e.count})
 	}
 
 	sort.Slice(domains, func(i, j int) bool {
@@ -121,24 +268,60 @@ func (c *Collector) computeDeltas() (dQueries, dBlocked, dForwarded, dBypasses i
 
 // StatsReport is the payload sent to the OPL backend.
 type StatsReport struct {
-	InstanceID           string        `json:"instanceId"`
-	Version              string        `json:"version"`
-	Uptime               int64         `json:"uptime"` // seconds
-	TotalQueries         int64         `json:"totalQueries"`
-	QueriesBlocked       int64         `json:"queriesBlocked"`
-	QueriesForwarded     int64         `json:"queriesForwarded"`
-	BypassesIssued       int64         `json:"bypassesIssued"`
-	ActiveSessions       int           `json:"activeSessions"`
-	BlocklistSize        int           `json:"blocklistSize"`
-	BlocklistEmployers   int           `json:"blocklistEmployers"`
-	LastBlocklistRefresh string        `json:"lastBlocklistRefresh,omitempty"`
-	TopBlockedDomains    []DomainCount `json:"topBlockedDomains"`
+	InstanceID           string `json:"instanceId"`
+	Version              string `json:"version"`
+	Uptime               int64  `json:"uptime"` // seconds
+	TotalQueries         int64  `json:"totalQueries"`
+	QueriesBlocked       int64  `json:"queriesBlocked"`
+	QueriesForwarded     int64  `json:"queriesForwarded"`
+	BypassesIssued       int64  `json:"bypassesIssued"`
+	ActiveSessions       int    `json:"activeSessions"`
+	BlocklistSize        int    `json:"blocklistSize"`
+	BlocklistEmployers   int    `json:"blocklistEmployers"`
+	LastBlocklistRefresh string `json:"lastBlocklistRefresh,omitempty"`
+
+	// CountersSince is when the lifetime counters started. It predates
+	// the uptime when counters were restored from a checkpoint.
+	CountersSince     string        `json:"countersSince"`
+	TopBlockedDomains []DomainCount `json:"topBlockedDomains"`
+
+	// Blocked queries by employer and labor action
+	TopBlockedEmployers []EmployerCount `json:"topBlockedEmployers"`
+
+	// Queries by type and answers to clients by rcode
+	QueryTypes     map[string]int64 `json:"queryTypes,omitempty"`
+	ResponseRcodes map[string]int64 `json:"responseRcodes,omitempty"`
+
+	// Upstream resolution health
+	UpstreamRcodes     map[string]int64 `json:"upstreamRcodes,omitempty"`
+	SoftFailureRetries int64            `json:"softFailureRetries"`
+
+	// Requests rejected by rate limiting, by scope
+	RateLimited map[string]int64 `json:"rateLimited,omitempty"`
+
+	// Queries and requests whose handler panicked, by scope
+	Panics map[string]int64 `json:"panics,omitempty"`
+
+	// Blocklist fetches from the OPL API
+	APIFetch APIFetchStats `json:"apiFetch"`
+
+	// Most active clients by blocked queries, with hashed addresses. Only
+	// sent when enabled in the client stats config.
+	TopClients []ClientCount `json:"topClients,omitempty"`
+
+	// Estimated distinct clients since the last report, and how many of
+	// them had a query blocked
+	UniqueClients        int64 `json:"uniqueClients"`
+	UniqueBlockedClients int64 `json:"uniqueBlockedClients"`
 
 	// Deltas since last report
 	QueriesSinceLastReport   int64 `json:"queriesSinceLastReport"`
 	BlockedSinceLastReport   int64 `json:"blockedSinceLastReport"`
 	ForwardedSinceLastReport int64 `json:"forwardedSinceLastReport"`
 	BypassesSinceLastReport  int64 `json:"bypassesSinceLastReport"`
+
+	// Labels are static operator-supplied tags such as a site name
+	Labels map[string]string `json:"labels,omitempty"`
 }
 
 // Reporter periodically sends stats reports to the OPL backend.
@@ -149,6 +332,9 @@ type Reporter struct {
 	reportURL  string
 	apiKey     string
 	interval   time.Duration
+	privacy    Privacy
+	signer     *ReportSigner
+	content    ReportContent
 	httpClient *http.Client
 	logger     *slog.Logger
 
@@ -156,6 +342,38 @@ type Reporter struct {
 	getActiveSessions func() int
 	getBlocklistSize  func() (domains int, employers int)
 	getLastRefresh    func() time.Time
+
+	statusMu sync.Mutex
+	status   ReporterStatus
+}
+
+// ReporterStatus describes the outcome of recent stats reports.
+type ReporterStatus struct {
+	// LastSuccess is when a report was last accepted by the backend.
+	LastSuccess time.Time `json:"last_success,omitzero"`
+
+	// LastError describes why the most recent report failed, or is empty if
+	// it succeeded or none has been sent.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Status returns the outcome of recent reports.
+func (r *Reporter) Status() ReporterStatus {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	return r.status
+}
+
+// setStatus records the outcome of a report. A nil err means success.
+func (r *Reporter) setStatus(err error) {
+	r.statusMu.Lock()
+	defer r.statusMu.Unlock()
+	if err != nil {
+		r.status.LastError = err.Error()
+		return
+	}
+	r.status.LastSuccess = time.Now()
+	r.status.LastError = ""
 }
 
 // ReporterConfig holds configuration for the stats reporter.
@@ -168,6 +386,20 @@ type ReporterConfig struct {
 	Interval   time.Duration
 	Logger     *slog.Logger
 
+	// Privacy limits what reports include. Defaults to PrivacyFull.
+	Privacy Privacy
+
+	// Content selects the top list sizes, excluded fields and labels.
+	// The zero value sends every field with top 10 lists.
+	Content ReportContent
+
+	// Signer, if set, signs every report.
+	Signer *ReportSigner
+
+	// Transport sends report requests. Defaults to http.DefaultTransport;
+	// pass the API client's transport to honor its proxy and CA settings.
+	Transport http.RoundTripper
+
 	// Callbacks
 	GetActiveSessions func() int
 	GetBlocklistSize  func() (domains int, employers int)
@@ -176,6 +408,9 @@ type ReporterConfig struct {
 
 // NewReporter creates a stats reporter.
 func NewReporter(cfg ReporterConfig) *Reporter {
+	if cfg.Privacy == "" {
+		cfg.Privacy = PrivacyFull
+	}
 	return &Reporter{
 		collector:         cfg.Collector,
 		instanceID:        cfg.InstanceID,
@@ -183,8 +418,11 @@ func NewReporter(cfg ReporterConfig) *Reporter {
 		reportURL:         cfg.ReportURL,
 		apiKey:            cfg.APIKey,
 		interval:          cfg.Interval,
+		privacy:           cfg.Privacy,
+		signer:            cfg.Signer,
+		content:           cfg.Content,
 		logger:            cfg.Logger,
-		httpClient:        &http.Client{Timeout: 10 * time.Second},
+		httpClient:        &http.Client{Timeout: 10 * time.Second, Transport: cfg.Transport},
 		getActiveSessions: cfg.GetActiveSessions,
 		getBlocklistSize:  cfg.GetBlocklistSize,
 		getLastRefresh:    cfg.GetLastRefresh,
@@ -207,6 +445,7 @@ func (r *Reporter) Start(ctx context.Context) {
 		case <-ctx.Done():
 			// Send final report before exiting
 			r.sendReport(context.Background())
+			r.httpClient.CloseIdleConnections()
 			return
 		case <-ticker.C:
 			r.sendReport(ctx)
@@ -217,6 +456,7 @@ func (r *Reporter) Start(ctx context.Context) {
 func (r *Reporter) sendReport(ctx context.Context) {
 	total, blocked, forwarded, bypasses := r.collector.Snapshot()
 	dQueries, dBlocked, dForwarded, dBypasses := r.collector.computeDeltas()
+	uniqueClients, uniqueBlocked := r.collector.unique.reset()
 
 	activeSessions := 0
 	if r.getActiveSessions != nil {
@@ -248,32 +488,56 @@ func (r *Reporter) sendReport(ctx context.Context) {
 		BlocklistSize:            blocklistDomains,
 		BlocklistEmployers:       blocklistEmployers,
 		LastBlocklistRefresh:     lastRefreshStr,
-		TopBlockedDomains:        r.collector.TopBlockedDomains(10),
+		CountersSince:            r.collector.CountersSince().Format(time.RFC3339),
+		TopBlockedDomains:        r.collector.TopBlockedDomains(topN(r.content.TopDomains)),
+		TopBlockedEmployers:      r.collector.TopBlockedEmployers(topN(r.content.TopEmployers)),
+		QueryTypes:               r.collector.QueryTypes(),
+		ResponseRcodes:           r.collector.ResponseRcodes(),
+		UpstreamRcodes:           r.collector.UpstreamRcodes(),
+		SoftFailureRetries:       r.collector.SoftFailureRetries(),
+		RateLimited:              r.collector.RateLimited(),
+		Panics:                   r.collector.Panics(),
+		APIFetch:                 r.collector.APIFetchStats(),
+		TopClients:               r.collector.reportedClients(topN(r.content.TopClients)),
+		UniqueClients:            uniqueClients,
+		UniqueBlockedClients:     uniqueBlocked,
 		QueriesSinceLastReport:   dQueries,
 		BlockedSinceLastReport:   dBlocked,
 		ForwardedSinceLastReport: dForwarded,
 		BypassesSinceLastReport:  dBypasses,
+		Labels:                   r.content.Labels,
 	}
+	r.privacy.applyPrivacy(&report)
 
-	body, err := json.Marshal(report)
+	body, err := r.content.marshal(&report)
 	if err != nil {
 		r.logger.Error("Failed to marshal stats report", "error", err)
+		r.setStatus(err)
 		return
 	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.reportURL, bytes.NewReader(body))
 	if err != nil {
 		r.logger.Error("Failed to create stats report request", "error", err)
+		r.setStatus(err)
 		return
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("X-API-Key", r.apiKey)
 	req.Header.Set("User-Agent", fmt.Sprintf("OPL-DNS-Server/%s", r.version))
+	if r.signer != nil {
+		if err := r.signer.sign(req, body); err != nil {
+			r.logger.Error("Failed to sign stats report", "error", err)
+			r.setStatus(err)
+			return
+		}
+	}
 
 	resp, err := r.httpClient.Do(req)
 	if err != nil {
 		r.logger.Warn("Failed to send stats report", "error", err)
+		r.setStatus(err)
 		return
 	}
 	defer resp.Body.Close()
@@ -283,8 +547,10 @@ func (r *Reporter) sendReport(ctx context.Context) {
 			"status", resp.StatusCode,
 			"instanceId", r.instanceID,
 		)
+		r.setStatus(fmt.Errorf("report rejected with status %d", resp.StatusCode))
 		return
 	}
+	r.setStatus(nil)
 
 	r.logger.Debug("Stats report sent",
 		"totalQueries", total,
@@ -6,6 +6,8 @@ import (
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"strings"
 	"testing"
 	"time"
 )
@@ -43,6 +45,9 @@ func TestCollector_RecordBlock(t *testing.T) {
 	if forwarded != 0 {
 		t.Errorf("expected 0 forwarded queries, got %d", forwarded)
 	}
+	if last := c.LastBlockedDomain(); last != "test.org" {
+		t.Errorf("expected test.org blocked last, got %q", last)
+	}
 }
 
 func TestCollector_RecordBypass(t *testing.T) {
@@ -57,6 +62,53 @@ func TestCollector_RecordBypass(t *testing.T) {
 	}
 }
 
+func TestCollector_UpstreamRcodes(t *testing.T) {
+	c := NewCollector()
+
+	c.RecordUpstreamRcode("NOERROR")
+	c.RecordUpstreamRcode("NOERROR")
+	c.RecordUpstreamRcode("SERVFAIL")
+	c.RecordSoftFailureRetry()
+
+	rcodes := c.UpstreamRcodes()
+	if rcodes["NOERROR"] != 2 || rcodes["SERVFAIL"] != 1 {
+		t.Errorf("unexpected rcode counts: %v", rcodes)
+	}
+	if c.SoftFailureRetries() != 1 {
+		t.Errorf("expected 1 soft failure retry, got %d", c.SoftFailureRetries())
+	}
+
+	// Returned map must be a copy
+	rcodes["NOERROR"] = 100
+	if c.UpstreamRcodes()["NOERROR"] != 2 {
+		t.Error("expected UpstreamRcodes to return a copy")
+	}
+}
+
+func TestCollector_QueryTypesAndResponseRcodes(t *testing.T) {
+	c := NewCollector()
+
+	c.RecordQueryType("A")
+	c.RecordQueryType("A")
+	c.RecordQueryType("HTTPS")
+	c.RecordResponseRcode("NOERROR")
+	c.RecordResponseRcode("SERVFAIL")
+
+	types := c.QueryTypes()
+	if types["A"] != 2 || types["HTTPS"] != 1 || len(types) != 2 {
+		t.Errorf("unexpected query types %v", types)
+	}
+	types["A"] = 100
+	if c.QueryTypes()["A"] != 2 {
+		t.Error("QueryTypes should return a copy")
+	}
+
+	rcodes := c.ResponseRcodes()
+	if rcodes["NOERROR"] != 1 || rcodes["SERVFAIL"] != 1 || len(rcodes) != 2 {
+		t.Errorf("unexpected response rcodes %v", rcodes)
+	}
+}
+
 func TestCollector_TopBlockedDomains(t *testing.T) {
 	c := NewCollector()
 
@@ -159,7 +211,12 @@ func TestReporter_SendReport(t *testing.T) {
 	c := NewCollector()
 	c.RecordBlock("test.com")
 	c.RecordBlock("test.com")
+	c.RecordEmployerBlock("Test Corp", "strike-1")
+	c.RecordEmployerBlock("Test Corp", "strike-1")
 	c.RecordQuery()
+	c.RecordClientQuery(netip.MustParseAddr("192.168.1.10"), true)
+	c.RecordClientQuery(netip.MustParseAddr("192.168.1.10"), true)
+	c.RecordClientQuery(netip.MustParseAddr("192.168.1.11"), false)
 
 	reporter := NewReporter(ReporterConfig{
 		Collector:         c,
@@ -191,4 +248,48 @@ func TestReporter_SendReport(t *testing.T) {
 	if receivedReport.BlocklistSize != 42 {
 		t.Errorf("expected blocklist size 42, got %d", receivedReport.BlocklistSize)
 	}
+	if e := receivedReport.TopBlockedEmployers; len(e) != 1 || e[0].Employer != "Test Corp" || e[0].Count != 2 || len(e[0].Actions) != 1 {
+		t.Errorf("unexpected top blocked employers %+v", e)
+	}
+	if receivedReport.UniqueClients != 2 || receivedReport.UniqueBlockedClients != 1 {
+		t.Errorf("expected 2 unique clients, 1 blocked, got %d and %d", receivedReport.UniqueClients, receivedReport.UniqueBlockedClients)
+	}
+
+	// Unique clients are counted per reporting interval
+	reporter.sendReport(context.Background())
+	if receivedReport.UniqueClients != 0 {
+		t.Errorf("expected unique clients to reset after a report, got %d", receivedReport.UniqueClients)
+	}
+}
+
+func TestReporter_Status(t *testing.T) {
+	status := http.StatusCreated
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	reporter := NewReporter(ReporterConfig{
+		Collector: NewCollector(),
+		ReportURL: server.URL,
+		Interval:  time.Second,
+		Logger:    slog.New(slog.DiscardHandler),
+	})
+
+	if s := reporter.Status(); !s.LastSuccess.IsZero() || s.LastError != "" {
+		t.Errorf("expected empty status before the first report, got %+v", s)
+	}
+
+	reporter.sendReport(context.Background())
+	first := reporter.Status()
+	if first.LastSuccess.IsZero() || first.LastError != "" {
+		t.Errorf("expected successful status, got %+v", first)
+	}
+
+	status = http.StatusForbidden
+	reporter.sendReport(context.Background())
+	s := reporter.Status()
+	if !s.LastSuccess.Equal(first.LastSuccess) || !strings.Contains(s.LastError, "403") {
+		t.Errorf("expected failure to keep last success and record the status, got %+v", s)
+	}
 }
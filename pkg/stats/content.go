@@ -0,0 +1,89 @@
+package stats
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// defaultTopN is how many top domains, employers and clients a report lists
+// when ReportContent leaves the count unset.
+const defaultTopN = 10
+
+// requiredReportFields cannot be excluded; the backend needs them to file
+// the report.
+var requiredReportFields = map[string]bool{"instanceId": true, "version": true}
+
+// ReportContent selects what stats reports include, within what the privacy
+// mode allows.
+type ReportContent struct {
+	// TopDomains, TopEmployers and TopClients are how many entries the top
+	// lists hold. Zero means 10.
+	TopDomains   int
+	TopEmployers int
+	TopClients   int
+
+	// Exclude lists report fields to leave out, by their JSON name
+	// (e.g., "queryTypes"). instanceId and version are always sent.
+	Exclude []string
+
+	// Labels are sent unchanged with every report, e.g. a site name or
+	// region.
+	Labels map[string]string
+}
+
+// Validate reports whether every excluded field exists and may be left
+// out.
+func (c ReportContent) Validate() error {
+	fields := reportFields()
+	for _, name := range c.Exclude {
+		if !fields[name] {
+			return fmt.Errorf("unknown report field %q", name)
+		}
+		if requiredReportFields[name] {
+			return fmt.Errorf("report field %q is required", name)
+		}
+	}
+	for k := range c.Labels {
+		if k == "" {
+			return fmt.Errorf("report labels must have non-empty names")
+		}
+	}
+	return nil
+}
+
+// reportFields returns the JSON names of the stats report fields.
+func reportFields() map[string]bool {
+	t := reflect.TypeFor[StatsReport]()
+	fields := make(map[string]bool, t.NumField())
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name] = true
+	}
+	return fields
+}
+
+func topN(n int) int {
+	if n <= 0 {
+		return defaultTopN
+	}
+	return n
+}
+
+// marshal encodes report without the excluded fields.
+func (c ReportContent) marshal(report *StatsReport) ([]byte, error) {
+	body, err := json.Marshal(report)
+	if err != nil || len(c.Exclude) == 0 {
+		return body, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	for _, name := range c.Exclude {
+		delete(fields, name)
+	}
+	return json.Marshal(fields)
+}
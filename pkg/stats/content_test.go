@@ -0,0 +1,79 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestReporter_Content(t *testing.T) {
+	var fields map[string]json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+			t.Errorf("Decoding report: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	c := NewCollector()
+	for i := range 5 {
+		c.RecordBlock(fmt.Sprintf("domain%d.com", i))
+	}
+
+	reporter := NewReporter(ReporterConfig{
+		Collector:  c,
+		InstanceID: "test-instance",
+		ReportURL:  server.URL,
+		Interval:   time.Minute,
+		Logger:     slog.New(slog.DiscardHandler),
+		Content: ReportContent{
+			TopDomains: 3,
+			Exclude:    []string{"queryTypes", "apiFetch"},
+			Labels:     map[string]string{"site": "hq", "region": "PT"},
+		},
+	})
+	reporter.sendReport(context.Background())
+
+	var domains []DomainCount
+	json.Unmarshal(fields["topBlockedDomains"], &domains)
+	if len(domains) != 3 {
+		t.Errorf("Expected 3 top domains, got %d", len(domains))
+	}
+	if _, ok := fields["apiFetch"]; ok {
+		t.Error("Expected apiFetch to be excluded")
+	}
+	if _, ok := fields["totalQueries"]; !ok {
+		t.Error("Expected other fields to be kept")
+	}
+	var labels map[string]string
+	json.Unmarshal(fields["labels"], &labels)
+	if labels["site"] != "hq" || labels["region"] != "PT" {
+		t.Errorf("Unexpected labels %v", labels)
+	}
+}
+
+func TestReportContent_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		content ReportContent
+		wantErr bool
+	}{
+		{"empty", ReportContent{}, false},
+		{"known fields", ReportContent{Exclude: []string{"topBlockedDomains", "uniqueClients"}}, false},
+		{"unknown field", ReportContent{Exclude: []string{"topDomains"}}, true},
+		{"required field", ReportContent{Exclude: []string{"instanceId"}}, true},
+		{"empty label name", ReportContent{Labels: map[string]string{"": "hq"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.content.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package stats
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// defaultMaxBlockedDomains bounds the blocked-domain table when no
+// WithMaxBlockedDomains option is given.
+const defaultMaxBlockedDomains = 10000
+
+// WithMaxBlockedDomains bounds how many distinct blocked domains are
+// counted. Defaults to 10000.
+func WithMaxBlockedDomains(n int) CollectorOption {
+	return func(c *Collector) {
+		if n > 0 {
+			c.blockedDomains = newDomainCounts(n)
+		}
+	}
+}
+
+// domainCounts counts blocked queries per domain in a table of bounded size,
+// using the Space-Saving algorithm: once the table is full, a new domain
+// replaces the one with the lowest count and inherits that count. Domains
+// blocked more often than 1/max of the time are always kept, and no count is
+// ever too low, so the top of the table is reliable even when clients query
+// an endless stream of random subdomains. Callers hold Collector.mu.
+type domainCounts struct {
+	max     int
+	entries map[string]*domainEntry
+	byCount domainHeap
+}
+
+type domainEntry struct {
+	domain string
+	count  int64
+	index  int
+}
+
+func newDomainCounts(max int) *domainCounts {
+	return &domainCounts{
+		max:     max,
+		entries: make(map[string]*domainEntry),
+	}
+}
+
+// add adds n blocked queries for domain.
+func (d *domainCounts) add(domain string, n int64) {
+	if e, ok := d.entries[domain]; ok {
+		e.count += n
+		heap.Fix(&d.byCount, e.index)
+		return
+	}
+	if len(d.entries) < d.max {
+		e := &domainEntry{domain: domain, count: n}
+		d.entries[domain] = e
+		heap.Push(&d.byCount, e)
+		return
+	}
+
+	e := d.byCount[0]
+	delete(d.entries, e.domain)
+	e.domain = domain
+	e.count += n
+	d.entries[domain] = e
+	heap.Fix(&d.byCount, 0)
+}
+
+// merge adds saved counts to the table, keeping the largest when they do not
+// all fit. Unlike add, merged domains never inherit an evicted count, so a
+// table restored into a smaller bound stays exact.
+func (d *domainCounts) merge(counts map[string]int64) {
+	domains := make([]string, 0, len(counts))
+	for domain := range counts {
+		domains = append(domains, domain)
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		return counts[domains[i]] > counts[domains[j]]
+	})
+
+	for _, domain := range domains {
+		if _, ok := d.entries[domain]; ok || len(d.entries) < d.max {
+			d.add(domain, counts[domain])
+		}
+	}
+}
+
+// counts returns a copy of the table.
+func (d *domainCounts) counts() map[string]int64 {
+	counts := make(map[string]int64, len(d.entries))
+	for domain, e := range d.entries {
+		counts[domain] = e.count
+	}
+	return counts
+}
+
+// domainHeap is a min-heap of entries by count.
+type domainHeap []*domainEntry
+
+func (h domainHeap) Len() int           { return len(h) }
+func (h domainHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+
+func (h domainHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *domainHeap) Push(x any) {
+	e := x.(*domainEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *domainHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
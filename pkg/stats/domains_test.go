@@ -0,0 +1,71 @@
+package stats
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCollector_BlockedDomainsBounded(t *testing.T) {
+	c := NewCollector(WithMaxBlockedDomains(10))
+
+	// A heavy hitter interleaved with a flood of one-off random subdomains
+	for i := range 1000 {
+		c.RecordBlock(fmt.Sprintf("r%d.scab.example", i))
+		if i%4 == 0 {
+			c.RecordBlock("picketed.example")
+		}
+	}
+
+	if n := len(c.blockedDomains.entries); n != 10 {
+		t.Errorf("expected 10 tracked domains, got %d", n)
+	}
+
+	top := c.TopBlockedDomains(1)
+	if len(top) != 1 || top[0].Domain != "picketed.example" {
+		t.Fatalf("expected picketed.example on top, got %+v", top)
+	}
+	if top[0].Count < 250 {
+		t.Errorf("expected a count of at least 250, got %d", top[0].Count)
+	}
+	if total := sumCounts(c.blockedDomains.counts()); total != 1250 {
+		t.Errorf("expected counts to sum to all 1250 blocks, got %d", total)
+	}
+}
+
+func TestCollector_BlockedDomainsExactBelowBound(t *testing.T) {
+	c := NewCollector(WithMaxBlockedDomains(3))
+	c.RecordBlock("a.example")
+	c.RecordBlock("b.example")
+	c.RecordBlock("b.example")
+
+	counts := c.blockedDomains.counts()
+	if counts["a.example"] != 1 || counts["b.example"] != 2 || len(counts) != 2 {
+		t.Errorf("unexpected counts %v", counts)
+	}
+}
+
+func TestCollector_RestoreBlockedDomainsBounded(t *testing.T) {
+	cp := Checkpoint{BlockedDomains: map[string]int64{}}
+	for i := range 20 {
+		cp.BlockedDomains[fmt.Sprintf("d%d.example", i)] = int64(i + 1)
+	}
+
+	c := NewCollector(WithMaxBlockedDomains(5))
+	c.Restore(cp)
+
+	if n := len(c.blockedDomains.entries); n != 5 {
+		t.Errorf("expected 5 tracked domains, got %d", n)
+	}
+	top := c.TopBlockedDomains(1)
+	if len(top) != 1 || top[0].Domain != "d19.example" {
+		t.Errorf("expected d19.example on top, got %+v", top)
+	}
+}
+
+func sumCounts(counts map[string]int64) int64 {
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	return total
+}
@@ -0,0 +1,77 @@
+package stats
+
+import "sort"
+
+// EmployerCount holds the blocked queries for one employer, broken down by
+// labor action.
+type EmployerCount struct {
+	Employer string        `json:"employer"`
+	Count    int64         `json:"count"`
+	Actions  []ActionCount `json:"actions,omitempty"`
+}
+
+// ActionCount holds the blocked queries for one labor action.
+type ActionCount struct {
+	ID    string `json:"id"`
+	Count int64  `json:"count"`
+}
+
+// employerKey identifies one action of one employer. ActionID is empty for
+// entries without an action, such as manual blocks.
+type employerKey struct {
+	Employer string
+	ActionID string
+}
+
+// RecordEmployerBlock records a blocked query attributed to employer and
+// the labor action with actionID.
+func (c *Collector) RecordEmployerBlock(employer, actionID string) {
+	if employer == "" {
+		return
+	}
+	c.mu.Lock()
+	c.blockedEmployers[employerKey{employer, actionID}]++
+	c.mu.Unlock()
+}
+
+// TopBlockedEmployers returns the n employers with the most blocked queries.
+// Each employer's actions are sorted by count.
+func (c *Collector) TopBlockedEmployers(n int) []EmployerCount {
+	c.mu.Lock()
+	byEmployer := make(map[string]*EmployerCount)
+	for key, count := range c.blockedEmployers {
+		e, ok := byEmployer[key.Employer]
+		if !ok {
+			e = &EmployerCount{Employer: key.Employer}
+			byEmployer[key.Employer] = e
+		}
+		e.Count += count
+		if key.ActionID != "" {
+			e.Actions = append(e.Actions, ActionCount{ID: key.ActionID, Count: count})
+		}
+	}
+	c.mu.Unlock()
+
+	employers := make([]EmployerCount, 0, len(byEmployer))
+	for _, e := range byEmployer {
+		sort.Slice(e.Actions, func(i, j int) bool {
+			if e.Actions[i].Count != e.Actions[j].Count {
+				return e.Actions[i].Count > e.Actions[j].Count
+			}
+			return e.Actions[i].ID < e.Actions[j].ID
+		})
+		employers = append(employers, *e)
+	}
+
+	sort.Slice(employers, func(i, j int) bool {
+		if employers[i].Count != employers[j].Count {
+			return employers[i].Count > employers[j].Count
+		}
+		return employers[i].Employer < employers[j].Employer
+	})
+
+	if len(employers) > n {
+		employers = employers[:n]
+	}
+	return employers
+}
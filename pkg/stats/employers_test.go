@@ -0,0 +1,33 @@
+package stats
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCollector_TopBlockedEmployers(t *testing.T) {
+	c := NewCollector()
+
+	c.RecordEmployerBlock("Acme", "strike-1")
+	c.RecordEmployerBlock("Acme", "strike-1")
+	c.RecordEmployerBlock("Acme", "boycott-2")
+	c.RecordEmployerBlock("Globex", "strike-3")
+	c.RecordEmployerBlock("Scab Staffing", "")
+	c.RecordEmployerBlock("", "ignored")
+
+	want := []EmployerCount{
+		{Employer: "Acme", Count: 3, Actions: []ActionCount{{ID: "strike-1", Count: 2}, {ID: "boycott-2", Count: 1}}},
+		{Employer: "Globex", Count: 1, Actions: []ActionCount{{ID: "strike-3", Count: 1}}},
+	}
+	if got := c.TopBlockedEmployers(2); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	all := c.TopBlockedEmployers(10)
+	if len(all) != 3 {
+		t.Fatalf("Expected 3 employers, got %+v", all)
+	}
+	if manual := all[2]; manual.Employer != "Scab Staffing" || manual.Count != 1 || manual.Actions != nil {
+		t.Errorf("Expected employer without action IDs, got %+v", manual)
+	}
+}
@@ -0,0 +1,83 @@
+package stats
+
+import (
+	"sync"
+	"time"
+)
+
+// HistoryWindow is how far back per-minute query history is kept.
+const HistoryWindow = 24 * time.Hour
+
+// historyMinutes is the number of per-minute buckets in HistoryWindow.
+const historyMinutes = int(HistoryWindow / time.Minute)
+
+// HistoryPoint holds the counts for one minute.
+type HistoryPoint struct {
+	// Time is the start of the minute.
+	Time     time.Time `json:"time"`
+	Queries  int64     `json:"queries"`
+	Blocked  int64     `json:"blocked"`
+	Bypasses int64     `json:"bypasses"`
+}
+
+// history is a ring buffer of per-minute counts covering HistoryWindow. A
+// bucket is reused when its minute comes round again a day later.
+type history struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets [historyMinutes]HistoryPoint
+}
+
+// bucketLocked returns the bucket for the minute containing t, clearing it
+// if it still holds an older minute.
+func (h *history) bucketLocked(t time.Time) *HistoryPoint {
+	minute := t.Truncate(time.Minute)
+	b := &h.buckets[int(minute.Unix()/60)%historyMinutes]
+	if !b.Time.Equal(minute) {
+		*b = HistoryPoint{Time: minute}
+	}
+	return b
+}
+
+func (h *history) add(queries, blocked, bypasses int64) {
+	h.mu.Lock()
+	b := h.bucketLocked(h.now())
+	b.Queries += queries
+	b.Blocked += blocked
+	b.Bypasses += bypasses
+	h.mu.Unlock()
+}
+
+// points returns one point per minute from since to now, oldest first.
+// Minutes without queries are included with zero counts.
+func (h *history) points(since time.Time) []HistoryPoint {
+	now := h.now().Truncate(time.Minute)
+	since = since.Truncate(time.Minute)
+	if oldest := now.Add(-HistoryWindow + time.Minute); since.Before(oldest) {
+		since = oldest
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var points []HistoryPoint
+	for t := since; !t.After(now); t = t.Add(time.Minute) {
+		b := h.buckets[int(t.Unix()/60)%historyMinutes]
+		if !b.Time.Equal(t) {
+			b = HistoryPoint{Time: t}
+		}
+		points = append(points, b)
+	}
+	return points
+}
+
+// History returns per-minute query, block, and bypass counts for the last d,
+// oldest first, ending with the current, partial minute. It covers at most
+// HistoryWindow and never reaches back before the collector was created.
+func (c *Collector) History(d time.Duration) []HistoryPoint {
+	since := c.history.now().Add(-d)
+	if since.Before(c.startTime) {
+		since = c.startTime
+	}
+	return c.history.points(since)
+}
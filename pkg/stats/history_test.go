@@ -0,0 +1,63 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCollector_History(t *testing.T) {
+	start := time.Date(2024, 5, 1, 15, 0, 30, 0, time.UTC)
+	now := start
+	c := NewCollector()
+	c.startTime = start
+	c.history.now = func() time.Time { return now }
+
+	c.RecordQuery()
+	c.RecordBlock("scab.example")
+	now = now.Add(2 * time.Minute)
+	c.RecordBlock("scab.example")
+	c.RecordBypass()
+
+	points := c.History(time.Hour)
+	if len(points) != 3 {
+		t.Fatalf("expected 3 points since start, got %d", len(points))
+	}
+	want := []HistoryPoint{
+		{Time: start.Truncate(time.Minute), Queries: 2, Blocked: 1},
+		{Time: start.Truncate(time.Minute).Add(time.Minute)},
+		{Time: start.Truncate(time.Minute).Add(2 * time.Minute), Queries: 1, Blocked: 1, Bypasses: 1},
+	}
+	for i, p := range points {
+		if !p.Time.Equal(want[i].Time) || p.Queries != want[i].Queries || p.Blocked != want[i].Blocked || p.Bypasses != want[i].Bypasses {
+			t.Errorf("point %d: expected %+v, got %+v", i, want[i], p)
+		}
+	}
+
+	if points := c.History(time.Minute); len(points) != 2 {
+		t.Errorf("expected 2 points for the last minute, got %d", len(points))
+	}
+}
+
+func TestCollector_HistoryWrapsAfterADay(t *testing.T) {
+	start := time.Date(2024, 5, 1, 15, 0, 0, 0, time.UTC)
+	now := start
+	c := NewCollector()
+	c.startTime = start
+	c.history.now = func() time.Time { return now }
+
+	c.RecordBlock("scab.example")
+	now = now.Add(HistoryWindow)
+	c.RecordQuery()
+
+	points := c.History(2 * HistoryWindow)
+	if len(points) != historyMinutes {
+		t.Fatalf("expected %d points, got %d", historyMinutes, len(points))
+	}
+	if !points[0].Time.Equal(start.Add(time.Minute)) {
+		t.Errorf("expected history to start a day ago, got %v", points[0].Time)
+	}
+	last := points[len(points)-1]
+	if last.Queries != 1 || last.Blocked != 0 {
+		t.Errorf("expected the reused bucket to hold only the new query, got %+v", last)
+	}
+}
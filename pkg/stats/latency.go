@@ -0,0 +1,140 @@
+package stats
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// Latency histogram layout. Values are in microseconds. Below
+// latencySubBuckets each value has its own bucket; above, every power of two
+// is split into latencySubBuckets buckets, so a bucket's width is at most
+// 1/8 of its value. Values beyond the last bucket are clamped to it.
+const (
+	latencySubBucketBits = 3
+	latencySubBuckets    = 1 << latencySubBucketBits
+	latencyBuckets       = latencySubBuckets * 30
+)
+
+// latencyHistogram is a lock-free log-linear histogram of durations.
+type latencyHistogram struct {
+	counts [latencyBuckets]atomic.Int64
+	count  atomic.Int64
+	sumUs  atomic.Int64
+	maxUs  atomic.Int64
+}
+
+// latencyBucket returns the bucket index for us microseconds.
+func latencyBucket(us int64) int {
+	if us < latencySubBuckets {
+		return int(max(us, 0))
+	}
+	shift := bits.Len64(uint64(us)) - latencySubBucketBits - 1
+	mantissa := int(us>>shift) - latencySubBuckets
+	return min(latencySubBuckets+shift*latencySubBuckets+mantissa, latencyBuckets-1)
+}
+
+// latencyBucketUpper returns the largest value in microseconds that falls
+// into bucket i.
+func latencyBucketUpper(i int) int64 {
+	if i < latencySubBuckets {
+		return int64(i)
+	}
+	shift := (i - latencySubBuckets) / latencySubBuckets
+	mantissa := int64(i%latencySubBuckets + latencySubBuckets)
+	return (mantissa+1)<<shift - 1
+}
+
+func (h *latencyHistogram) record(d time.Duration) {
+	us := d.Microseconds()
+	h.counts[latencyBucket(us)].Add(1)
+	h.count.Add(1)
+	h.sumUs.Add(us)
+	for {
+		cur := h.maxUs.Load()
+		if us <= cur || h.maxUs.CompareAndSwap(cur, us) {
+			break
+		}
+	}
+}
+
+// LatencyStats summarizes a latency histogram. Percentiles are accurate to
+// within one bucket, about 12%.
+type LatencyStats struct {
+	Count  int64   `json:"count"`
+	MeanMs float64 `json:"meanMs"`
+	P50Ms  float64 `json:"p50Ms"`
+	P90Ms  float64 `json:"p90Ms"`
+	P99Ms  float64 `json:"p99Ms"`
+	MaxMs  float64 `json:"maxMs"`
+}
+
+func (h *latencyHistogram) stats() LatencyStats {
+	var counts [latencyBuckets]int64
+	var total int64
+	for i := range counts {
+		counts[i] = h.counts[i].Load()
+		total += counts[i]
+	}
+	if total == 0 {
+		return LatencyStats{}
+	}
+
+	maxUs := h.maxUs.Load()
+	percentile := func(p float64) float64 {
+		rank := int64(p*float64(total) + 0.5)
+		var seen int64
+		for i, n := range counts {
+			seen += n
+			if seen >= rank && n > 0 {
+				return usToMs(min(latencyBucketUpper(i), maxUs))
+			}
+		}
+		return usToMs(maxUs)
+	}
+
+	return LatencyStats{
+		Count:  total,
+		MeanMs: usToMs(h.sumUs.Load()) / float64(h.count.Load()),
+		P50Ms:  percentile(0.50),
+		P90Ms:  percentile(0.90),
+		P99Ms:  percentile(0.99),
+		MaxMs:  usToMs(maxUs),
+	}
+}
+
+// LatencyHistogram summarizes durations in constant memory, with the same
+// accuracy as the collector's latency stats. The zero value is ready to use,
+// and it is safe for concurrent use.
+type LatencyHistogram struct {
+	h latencyHistogram
+}
+
+// Record adds one duration.
+func (h *LatencyHistogram) Record(d time.Duration) {
+	h.h.record(d)
+}
+
+// Stats summarizes the durations recorded so far.
+func (h *LatencyHistogram) Stats() LatencyStats {
+	return h.h.stats()
+}
+
+func usToMs(us int64) float64 {
+	return float64(us) / 1000
+}
+
+// RecordQueryDuration records the time taken to answer a query.
+func (c *Collector) RecordQueryDuration(d time.Duration) {
+	c.queryLatency.record(d)
+}
+
+// QueryLatency summarizes the time taken to answer queries.
+func (c *Collector) QueryLatency() LatencyStats {
+	return c.queryLatency.stats()
+}
+
+// UpstreamLatency summarizes the time taken by upstream exchanges.
+func (c *Collector) UpstreamLatency() LatencyStats {
+	return c.upstreamLatency.stats()
+}
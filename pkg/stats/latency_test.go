@@ -0,0 +1,83 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyBuckets(t *testing.T) {
+	prev := -1
+	for _, us := range []int64{0, 1, 7, 8, 15, 16, 17, 100, 1000, 123456, 5_000_000} {
+		i := latencyBucket(us)
+		if i < prev {
+			t.Errorf("bucket for %dus (%d) is below the previous bucket (%d)", us, i, prev)
+		}
+		prev = i
+		if upper := latencyBucketUpper(i); upper < us || float64(upper-us) > float64(us)/8+1 {
+			t.Errorf("bucket %d for %dus has upper bound %dus", i, us, upper)
+		}
+	}
+	if i := latencyBucket(1 << 62); i != latencyBuckets-1 {
+		t.Errorf("expected huge values to clamp to the last bucket, got %d", i)
+	}
+	if i := latencyBucket(-5); i != 0 {
+		t.Errorf("expected negative values in bucket 0, got %d", i)
+	}
+}
+
+func TestCollector_QueryLatency(t *testing.T) {
+	c := NewCollector()
+	if s := c.QueryLatency(); s != (LatencyStats{}) {
+		t.Errorf("expected empty stats, got %+v", s)
+	}
+
+	// 90 fast queries, 9 slower, 1 very slow
+	for range 90 {
+		c.RecordQueryDuration(2 * time.Millisecond)
+	}
+	for range 9 {
+		c.RecordQueryDuration(40 * time.Millisecond)
+	}
+	c.RecordQueryDuration(time.Second)
+
+	s := c.QueryLatency()
+	if s.Count != 100 {
+		t.Fatalf("expected 100 observations, got %d", s.Count)
+	}
+	within := func(name string, got, want float64) {
+		if got < want || got > want*1.125 {
+			t.Errorf("%s: expected about %.1fms, got %.3fms", name, want, got)
+		}
+	}
+	within("p50", s.P50Ms, 2)
+	within("p90", s.P90Ms, 2)
+	within("p99", s.P99Ms, 40)
+	if s.MaxMs != 1000 {
+		t.Errorf("expected max 1000ms, got %.3f", s.MaxMs)
+	}
+	if want := (90*2 + 9*40 + 1000) / 100.0; s.MeanMs != want {
+		t.Errorf("expected mean %.2fms, got %.2f", want, s.MeanMs)
+	}
+
+	c.RecordUpstreamExchange(UpstreamExchange{Upstream: "192.0.2.53:53", Result: UpstreamOK, Duration: 25 * time.Millisecond})
+	if u := c.UpstreamLatency(); u.Count != 1 || u.MaxMs != 25 {
+		t.Errorf("unexpected upstream latency %+v", u)
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	var h LatencyHistogram
+	if got := h.Stats(); got.Count != 0 {
+		t.Errorf("Expected empty stats, got %+v", got)
+	}
+	for i := 1; i <= 100; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	got := h.Stats()
+	if got.Count != 100 || got.MaxMs != 100 {
+		t.Errorf("Expected 100 durations up to 100ms, got %+v", got)
+	}
+	if got.P50Ms < 44 || got.P50Ms > 57 {
+		t.Errorf("Expected p50 near 50ms, got %v", got.P50Ms)
+	}
+}
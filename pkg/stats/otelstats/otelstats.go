@@ -0,0 +1,274 @@
+// Package otelstats implements stats.Recorder on top of OpenTelemetry
+// metrics, for embedders that export through an OTel pipeline instead of (or
+// alongside) the OPL stats report. It also serves those metrics to
+// Prometheus and pushes metrics and traces to an OTLP collector.
+package otelstats
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Recorder records query events as OpenTelemetry counters:
+//
+//	opl.dns.queries                        {result=forwarded|blocked}
+//	opl.dns.bypasses
+//	opl.dns.query_types                    {qtype}
+//	opl.dns.responses                      {rcode}
+//	opl.dns.upstream.responses             {rcode}
+//	opl.dns.upstream.soft_failure_retries
+//	opl.dns.rate_limited                   {scope}
+//	opl.dns.query.duration                 histogram, seconds
+//	opl.dns.upstream.exchanges             {upstream, result=ok|soft_failure|error}
+//	opl.dns.upstream.duration              histogram, seconds {upstream}
+//	opl.dns.upstream.consecutive_failures  gauge {upstream}
+//
+// and blocklist fetches from the OPL API as:
+//
+//	opl.api.fetches                        {kind=full|diff, result}
+//	opl.api.fetch.duration                 histogram, seconds
+//	opl.api.fetch.size                     histogram, bytes
+//	opl.api.fetch.parse_duration           histogram, seconds
+//	opl.api.fetch.consecutive_failures     gauge
+//
+// Blocked domain names are deliberately not recorded as attributes to keep
+// metric cardinality bounded; use the stats Collector for top-domain reports.
+type Recorder struct {
+	queries            metric.Int64Counter
+	bypasses           metric.Int64Counter
+	queryTypes         metric.Int64Counter
+	responses          metric.Int64Counter
+	upstreamResponses  metric.Int64Counter
+	softFailureRetries metric.Int64Counter
+	rateLimited        metric.Int64Counter
+	panics             metric.Int64Counter
+	queryDuration      metric.Float64Histogram
+	upstreamExchanges  metric.Int64Counter
+	upstreamDuration   metric.Float64Histogram
+	upstreamFailures   metric.Int64Gauge
+
+	apiFetches             metric.Int64Counter
+	apiFetchDuration       metric.Float64Histogram
+	apiFetchSize           metric.Int64Histogram
+	apiFetchParseDuration  metric.Float64Histogram
+	apiConsecutiveFailures metric.Int64Gauge
+
+	forwardedAttrs metric.AddOption
+	blockedAttrs   metric.AddOption
+}
+
+var _ stats.Recorder = (*Recorder)(nil)
+
+// dnsDurationBuckets spans cached answers through upstream timeouts.
+var dnsDurationBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// New creates the counters on meter.
+func New(meter metric.Meter) (*Recorder, error) {
+	r := &Recorder{
+		forwardedAttrs: metric.WithAttributes(attribute.String("result", "forwarded")),
+		blockedAttrs:   metric.WithAttributes(attribute.String("result", "blocked")),
+	}
+
+	var err error
+	if r.queries, err = meter.Int64Counter("opl.dns.queries",
+		metric.WithDescription("DNS queries handled, by result"),
+		metric.WithUnit("{query}"),
+	); err != nil {
+		return nil, fmt.Errorf("creating queries counter: %w", err)
+	}
+	if r.bypasses, err = meter.Int64Counter("opl.dns.bypasses",
+		metric.WithDescription("Block page bypasses issued"),
+		metric.WithUnit("{bypass}"),
+	); err != nil {
+		return nil, fmt.Errorf("creating bypasses counter: %w", err)
+	}
+	if r.queryTypes, err = meter.Int64Counter("opl.dns.query_types",
+		metric.WithDescription("DNS queries received, by query type"),
+		metric.WithUnit("{query}"),
+	); err != nil {
+		return nil, fmt.Errorf("creating query types counter: %w", err)
+	}
+	if r.responses, err = meter.Int64Counter("opl.dns.responses",
+		metric.WithDescription("DNS responses sent to clients, by rcode"),
+		metric.WithUnit("{response}"),
+	); err != nil {
+		return nil, fmt.Errorf("creating responses counter: %w", err)
+	}
+	if r.upstreamResponses, err = meter.Int64Counter("opl.dns.upstream.responses",
+		metric.WithDescription("Upstream DNS responses, by rcode"),
+		metric.WithUnit("{response}"),
+	); err != nil {
+		return nil, fmt.Errorf("creating upstream responses counter: %w", err)
+	}
+	if r.softFailureRetries, err = meter.Int64Counter("opl.dns.upstream.soft_failure_retries",
+		metric.WithDescription("Queries retried on another upstream after SERVFAIL or REFUSED"),
+		metric.WithUnit("{retry}"),
+	); err != nil {
+		return nil, fmt.Errorf("creating soft failure retries counter: %w", err)
+	}
+	if r.rateLimited, err = meter.Int64Counter("opl.dns.rate_limited",
+		metric.WithDescription("Requests rejected by rate limiting, by scope"),
+		metric.WithUnit("{request}"),
+	); err != nil {
+		return nil, fmt.Errorf("creating rate limited counter: %w", err)
+	}
+	if r.panics, err = meter.Int64Counter("opl.dns.panics",
+		metric.WithDescription("Queries and requests whose handler panicked and was recovered, by scope"),
+		metric.WithUnit("{panic}"),
+	); err != nil {
+		return nil, fmt.Errorf("creating panics counter: %w", err)
+	}
+	if r.queryDuration, err = meter.Float64Histogram("opl.dns.query.duration",
+		metric.WithDescription("Time to answer a DNS query"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(dnsDurationBuckets...),
+	); err != nil {
+		return nil, fmt.Errorf("creating query duration histogram: %w", err)
+	}
+	if r.upstreamExchanges, err = meter.Int64Counter("opl.dns.upstream.exchanges",
+		metric.WithDescription("Queries sent to upstream resolvers, by upstream and result"),
+		metric.WithUnit("{exchange}"),
+	); err != nil {
+		return nil, fmt.Errorf("creating upstream exchanges counter: %w", err)
+	}
+	if r.upstreamFailures, err = meter.Int64Gauge("opl.dns.upstream.consecutive_failures",
+		metric.WithDescription("Exchanges with an upstream that have failed in a row"),
+		metric.WithUnit("{exchange}"),
+	); err != nil {
+		return nil, fmt.Errorf("creating upstream consecutive failures gauge: %w", err)
+	}
+	if r.upstreamDuration, err = meter.Float64Histogram("opl.dns.upstream.duration",
+		metric.WithDescription("Time taken by one upstream exchange, by upstream"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(dnsDurationBuckets...),
+	); err != nil {
+		return nil, fmt.Errorf("creating upstream duration histogram: %w", err)
+	}
+
+	if r.apiFetches, err = meter.Int64Counter("opl.api.fetches",
+		metric.WithDescription("Blocklist requests to the OPL API, by kind and result"),
+		metric.WithUnit("{fetch}"),
+	); err != nil {
+		return nil, fmt.Errorf("creating API fetches counter: %w", err)
+	}
+	if r.apiFetchDuration, err = meter.Float64Histogram("opl.api.fetch.duration",
+		metric.WithDescription("Time to fetch and apply the blocklist"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30),
+	); err != nil {
+		return nil, fmt.Errorf("creating API fetch duration histogram: %w", err)
+	}
+	if r.apiFetchSize, err = meter.Int64Histogram("opl.api.fetch.size",
+		metric.WithDescription("Size of blocklist responses"),
+		metric.WithUnit("By"),
+		metric.WithExplicitBucketBoundaries(1<<10, 16<<10, 64<<10, 256<<10, 1<<20, 4<<20, 16<<20),
+	); err != nil {
+		return nil, fmt.Errorf("creating API fetch size histogram: %w", err)
+	}
+	if r.apiFetchParseDuration, err = meter.Float64Histogram("opl.api.fetch.parse_duration",
+		metric.WithDescription("Time to decode a blocklist response and build the lookup table"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1),
+	); err != nil {
+		return nil, fmt.Errorf("creating API fetch parse duration histogram: %w", err)
+	}
+	if r.apiConsecutiveFailures, err = meter.Int64Gauge("opl.api.fetch.consecutive_failures",
+		metric.WithDescription("Blocklist fetches that have failed in a row"),
+		metric.WithUnit("{fetch}"),
+	); err != nil {
+		return nil, fmt.Errorf("creating API consecutive failures gauge: %w", err)
+	}
+
+	return r, nil
+}
+
+// RecordQuery records a query that was forwarded to upstream.
+func (r *Recorder) RecordQuery() {
+	r.queries.Add(context.Background(), 1, r.forwardedAttrs)
+}
+
+// RecordBlock records a query for a blocked domain.
+func (r *Recorder) RecordBlock(string) {
+	r.queries.Add(context.Background(), 1, r.blockedAttrs)
+}
+
+// RecordEmployerBlock is a no-op: employer names are free text from the
+// blocklist, so they are kept by stats.Collector rather than as labels.
+func (r *Recorder) RecordEmployerBlock(string, string) {}
+
+// RecordBypass records a bypass being issued.
+func (r *Recorder) RecordBypass() {
+	r.bypasses.Add(context.Background(), 1)
+}
+
+// RecordQueryType records the type of a query.
+func (r *Recorder) RecordQueryType(qtype string) {
+	r.queryTypes.Add(context.Background(), 1, metric.WithAttributes(attribute.String("qtype", qtype)))
+}
+
+// RecordResponseRcode records the response code of an answer sent to a
+// client.
+func (r *Recorder) RecordResponseRcode(rcode string) {
+	r.responses.Add(context.Background(), 1, metric.WithAttributes(attribute.String("rcode", rcode)))
+}
+
+// RecordUpstreamRcode records the response code of an upstream answer.
+func (r *Recorder) RecordUpstreamRcode(rcode string) {
+	r.upstreamResponses.Add(context.Background(), 1, metric.WithAttributes(attribute.String("rcode", rcode)))
+}
+
+// RecordSoftFailureRetry records a query retried on another upstream.
+func (r *Recorder) RecordSoftFailureRetry() {
+	r.softFailureRetries.Add(context.Background(), 1)
+}
+
+// RecordRateLimited records a request rejected by the rate limiter.
+func (r *Recorder) RecordRateLimited(scope string) {
+	r.rateLimited.Add(context.Background(), 1, metric.WithAttributes(attribute.String("scope", scope)))
+}
+
+// RecordPanic records a handler panic that was recovered.
+func (r *Recorder) RecordPanic(scope string) {
+	r.panics.Add(context.Background(), 1, metric.WithAttributes(attribute.String("scope", scope)))
+}
+
+// RecordQueryDuration records the time taken to answer a query.
+func (r *Recorder) RecordQueryDuration(d time.Duration) {
+	r.queryDuration.Record(context.Background(), d.Seconds())
+}
+
+// RecordUpstreamExchange records one query sent to an upstream resolver.
+func (r *Recorder) RecordUpstreamExchange(ex stats.UpstreamExchange) {
+	ctx := context.Background()
+	upstream := attribute.String("upstream", ex.Upstream)
+
+	r.upstreamExchanges.Add(ctx, 1, metric.WithAttributes(upstream, attribute.String("result", ex.Result)))
+	r.upstreamDuration.Record(ctx, ex.Duration.Seconds(), metric.WithAttributes(upstream))
+	r.upstreamFailures.Record(ctx, int64(ex.ConsecutiveFailures), metric.WithAttributes(upstream))
+}
+
+// RecordAPIFetch records one blocklist request to the OPL API. Sizes and
+// parse times are recorded only for responses that carried a blocklist.
+func (r *Recorder) RecordAPIFetch(fetch stats.APIFetch) {
+	ctx := context.Background()
+	kind := attribute.String("kind", fetch.Kind)
+
+	r.apiFetches.Add(ctx, 1, metric.WithAttributes(kind, attribute.String("result", fetch.Result)))
+	r.apiFetchDuration.Record(ctx, fetch.Duration.Seconds(), metric.WithAttributes(kind))
+	if fetch.Result == stats.FetchOK {
+		r.apiFetchSize.Record(ctx, fetch.Bytes, metric.WithAttributes(kind))
+		r.apiFetchParseDuration.Record(ctx, fetch.ParseDuration.Seconds(), metric.WithAttributes(kind))
+	}
+	r.apiConsecutiveFailures.Record(ctx, int64(fetch.ConsecutiveFailures))
+}
+
+// RecordClientQuery is a no-op: a label per client address would give the
+// metrics unbounded cardinality. Per-client counts are kept by
+// stats.Collector instead.
+func (r *Recorder) RecordClientQuery(netip.Addr, bool) {}
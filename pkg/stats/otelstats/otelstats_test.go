@@ -0,0 +1,150 @@
+package otelstats
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestRecorder(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	defer provider.Shutdown(context.Background())
+
+	r, err := New(provider.Meter("opl-dns-test"))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	r.RecordQuery()
+	r.RecordQuery()
+	r.RecordBlock("example.com")
+	r.RecordBypass()
+	r.RecordUpstreamRcode("NOERROR")
+	r.RecordUpstreamRcode("SERVFAIL")
+	r.RecordUpstreamRcode("NOERROR")
+	r.RecordSoftFailureRetry()
+	r.RecordQueryType("A")
+	r.RecordQueryType("A")
+	r.RecordQueryType("HTTPS")
+	r.RecordResponseRcode("NXDOMAIN")
+	r.RecordRateLimited("dns")
+	r.RecordQueryDuration(2 * time.Millisecond)
+	r.RecordQueryDuration(30 * time.Millisecond)
+	r.RecordUpstreamExchange(stats.UpstreamExchange{Upstream: "8.8.8.8:53", Result: stats.UpstreamOK, Duration: 25 * time.Millisecond})
+	r.RecordUpstreamExchange(stats.UpstreamExchange{Upstream: "8.8.4.4:53", Result: stats.UpstreamError, Duration: time.Second, ConsecutiveFailures: 3})
+	r.RecordAPIFetch(stats.APIFetch{Kind: stats.FetchFull, Result: stats.FetchOK, Duration: time.Second, Bytes: 2048})
+	r.RecordAPIFetch(stats.APIFetch{Kind: stats.FetchFull, Result: stats.FetchNotModified})
+	r.RecordAPIFetch(stats.APIFetch{Kind: stats.FetchFull, Result: stats.FetchError, ConsecutiveFailures: 1})
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+
+	tests := []struct {
+		metric string
+		attr   attribute.KeyValue
+		want   int64
+	}{
+		{"opl.dns.queries", attribute.String("result", "forwarded"), 2},
+		{"opl.dns.queries", attribute.String("result", "blocked"), 1},
+		{"opl.dns.bypasses", attribute.KeyValue{}, 1},
+		{"opl.dns.upstream.responses", attribute.String("rcode", "NOERROR"), 2},
+		{"opl.dns.upstream.responses", attribute.String("rcode", "SERVFAIL"), 1},
+		{"opl.dns.query_types", attribute.String("qtype", "A"), 2},
+		{"opl.dns.query_types", attribute.String("qtype", "HTTPS"), 1},
+		{"opl.dns.responses", attribute.String("rcode", "NXDOMAIN"), 1},
+		{"opl.dns.upstream.exchanges", attribute.String("result", "ok"), 1},
+		{"opl.dns.upstream.exchanges", attribute.String("result", "error"), 1},
+		{"opl.dns.upstream.soft_failure_retries", attribute.KeyValue{}, 1},
+		{"opl.dns.rate_limited", attribute.String("scope", "dns"), 1},
+		{"opl.api.fetches", attribute.String("result", "ok"), 1},
+		{"opl.api.fetches", attribute.String("result", "not_modified"), 1},
+		{"opl.api.fetches", attribute.String("result", "error"), 1},
+	}
+
+	for _, tt := range tests {
+		if got := sumOf(rm, tt.metric, tt.attr); got != tt.want {
+			t.Errorf("%s{%s}: expected %d, got %d", tt.metric, tt.attr.Value.Emit(), tt.want, got)
+		}
+	}
+
+	if got := histogramCount(rm, "opl.dns.query.duration"); got != 2 {
+		t.Errorf("opl.dns.query.duration: expected 2 observations, got %d", got)
+	}
+	if got := histogramCount(rm, "opl.dns.upstream.duration"); got != 2 {
+		t.Errorf("opl.dns.upstream.duration: expected 2 observations, got %d", got)
+	}
+	if got := histogramCount(rm, "opl.api.fetch.duration"); got != 3 {
+		t.Errorf("opl.api.fetch.duration: expected 3 observations, got %d", got)
+	}
+	if got := histogramCount(rm, "opl.api.fetch.size"); got != 1 {
+		t.Errorf("opl.api.fetch.size: expected 1 observation, got %d", got)
+	}
+	if got := gaugeOf(rm, "opl.api.fetch.consecutive_failures"); got != 1 {
+		t.Errorf("opl.api.fetch.consecutive_failures: expected 1, got %d", got)
+	}
+}
+
+// sumOf returns the counter value for the data point carrying attr, or the
+// only data point when attr is empty.
+func sumOf(rm metricdata.ResourceMetrics, name string, attr attribute.KeyValue) int64 {
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != name {
+				continue
+			}
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok {
+				return -1
+			}
+			for _, dp := range sum.DataPoints {
+				if !attr.Valid() {
+					return dp.Value
+				}
+				if v, ok := dp.Attributes.Value(attr.Key); ok && v == attr.Value {
+					return dp.Value
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// histogramCount returns the total observation count of a histogram.
+func histogramCount(rm metricdata.ResourceMetrics, name string) uint64 {
+	var n uint64
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if h, ok := m.Data.(metricdata.Histogram[int64]); ok && m.Name == name {
+				for _, dp := range h.DataPoints {
+					n += dp.Count
+				}
+			}
+			if h, ok := m.Data.(metricdata.Histogram[float64]); ok && m.Name == name {
+				for _, dp := range h.DataPoints {
+					n += dp.Count
+				}
+			}
+		}
+	}
+	return n
+}
+
+// gaugeOf returns the value of a single-point gauge.
+func gaugeOf(rm metricdata.ResourceMetrics, name string) int64 {
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if g, ok := m.Data.(metricdata.Gauge[int64]); ok && m.Name == name && len(g.DataPoints) > 0 {
+				return g.DataPoints[0].Value
+			}
+		}
+	}
+	return -1
+}
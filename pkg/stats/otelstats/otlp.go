@@ -0,0 +1,149 @@
+package otelstats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// OTLPConfig configures export to an OpenTelemetry collector over
+// OTLP/HTTP.
+type OTLPConfig struct {
+	// Endpoint is the collector's base URL, e.g. "http://otel-collector:4318".
+	// Signals are sent to /v1/metrics and /v1/traces below it; http://
+	// endpoints are used without TLS.
+	Endpoint string
+
+	// Headers are sent with every export, e.g. for authentication.
+	Headers map[string]string
+
+	// Metrics and Traces select what is exported.
+	Metrics bool
+	Traces  bool
+
+	// MetricInterval is how often metrics are pushed.
+	MetricInterval time.Duration
+
+	// TraceSampleRatio is the fraction of new traces that are recorded.
+	TraceSampleRatio float64
+
+	// ServiceVersion and InstanceID describe this server in the resource
+	// attached to all telemetry.
+	ServiceVersion string
+	InstanceID     string
+}
+
+// OTLP pushes metrics and traces to an OpenTelemetry collector. Its Recorder
+// is a no-op when metrics are disabled, and its TracerProvider is a no-op
+// when traces are disabled.
+type OTLP struct {
+	stats.Recorder
+
+	tracerProvider trace.TracerProvider
+	shutdown       []func(context.Context) error
+}
+
+// NewOTLP creates the exporters. No connection is made until the first
+// export; Shutdown flushes pending telemetry and stops the exporters.
+func NewOTLP(ctx context.Context, cfg OTLPConfig) (*OTLP, error) {
+	base, err := url.Parse(cfg.Endpoint)
+	if err != nil || base.Host == "" || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("OTLP endpoint must be an http:// or https:// URL")
+	}
+	basePath := strings.TrimSuffix(base.Path, "/")
+	insecure := base.Scheme == "http"
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(
+		attribute.String("service.name", "opl-dns"),
+		attribute.String("service.version", cfg.ServiceVersion),
+		attribute.String("service.instance.id", cfg.InstanceID),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("building OTel resource: %w", err)
+	}
+
+	o := &OTLP{
+		Recorder:       stats.NopRecorder{},
+		tracerProvider: noop.NewTracerProvider(),
+	}
+
+	if cfg.Metrics {
+		opts := []otlpmetrichttp.Option{
+			otlpmetrichttp.WithEndpoint(base.Host),
+			otlpmetrichttp.WithURLPath(basePath + "/v1/metrics"),
+			otlpmetrichttp.WithHeaders(cfg.Headers),
+		}
+		if insecure {
+			opts = append(opts, otlpmetrichttp.WithInsecure())
+		}
+		exporter, err := otlpmetrichttp.New(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("creating OTLP metric exporter: %w", err)
+		}
+		provider := sdkmetric.NewMeterProvider(
+			sdkmetric.WithResource(res),
+			sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(cfg.MetricInterval))),
+		)
+		o.shutdown = append(o.shutdown, provider.Shutdown)
+
+		recorder, err := New(provider.Meter(meterName))
+		if err != nil {
+			o.Shutdown(ctx)
+			return nil, err
+		}
+		o.Recorder = recorder
+	}
+
+	if cfg.Traces {
+		opts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(base.Host),
+			otlptracehttp.WithURLPath(basePath + "/v1/traces"),
+			otlptracehttp.WithHeaders(cfg.Headers),
+		}
+		if insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(ctx, opts...)
+		if err != nil {
+			o.Shutdown(ctx)
+			return nil, fmt.Errorf("creating OTLP trace exporter: %w", err)
+		}
+		provider := sdktrace.NewTracerProvider(
+			sdktrace.WithResource(res),
+			sdktrace.WithBatcher(exporter),
+			sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TraceSampleRatio))),
+		)
+		o.shutdown = append(o.shutdown, provider.Shutdown)
+		o.tracerProvider = provider
+	}
+
+	return o, nil
+}
+
+// TracerProvider returns the provider to instrument with.
+func (o *OTLP) TracerProvider() trace.TracerProvider {
+	return o.tracerProvider
+}
+
+// Shutdown flushes pending metrics and spans and stops the exporters.
+func (o *OTLP) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, shutdown := range o.shutdown {
+		errs = append(errs, shutdown(ctx))
+	}
+	o.shutdown = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,82 @@
+package otelstats
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOTLPExport(t *testing.T) {
+	var mu sync.Mutex
+	received := make(map[string]string)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received[r.URL.Path] = r.Header.Get("Authorization")
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/x-protobuf")
+	}))
+	defer collector.Close()
+
+	o, err := NewOTLP(context.Background(), OTLPConfig{
+		Endpoint:         collector.URL + "/otel/",
+		Headers:          map[string]string{"Authorization": "Bearer secret"},
+		Metrics:          true,
+		Traces:           true,
+		MetricInterval:   time.Hour,
+		TraceSampleRatio: 1,
+		ServiceVersion:   "test",
+		InstanceID:       "dns-1",
+	})
+	if err != nil {
+		t.Fatalf("NewOTLP failed: %v", err)
+	}
+
+	o.RecordQuery()
+	_, span := o.TracerProvider().Tracer("test").Start(context.Background(), "dns.query")
+	span.End()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := o.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, path := range []string{"/otel/v1/metrics", "/otel/v1/traces"} {
+		auth, ok := received[path]
+		if !ok {
+			t.Errorf("Expected an export to %s, got %v", path, received)
+			continue
+		}
+		if auth != "Bearer secret" {
+			t.Errorf("Expected configured headers on %s, got Authorization %q", path, auth)
+		}
+	}
+}
+
+func TestOTLPSignalsDisabled(t *testing.T) {
+	o, err := NewOTLP(context.Background(), OTLPConfig{Endpoint: "http://127.0.0.1:1"})
+	if err != nil {
+		t.Fatalf("NewOTLP failed: %v", err)
+	}
+
+	_, span := o.TracerProvider().Tracer("test").Start(context.Background(), "dns.query")
+	if span.IsRecording() {
+		t.Error("Expected a no-op tracer when traces are disabled")
+	}
+	if err := o.Shutdown(context.Background()); err != nil {
+		t.Errorf("Shutdown failed: %v", err)
+	}
+}
+
+func TestOTLPInvalidEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"", "otel-collector:4318", "grpc://otel-collector:4317"} {
+		if _, err := NewOTLP(context.Background(), OTLPConfig{Endpoint: endpoint, Metrics: true}); err == nil {
+			t.Errorf("Expected an error for endpoint %q", endpoint)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package otelstats
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// meterName identifies this module's instruments.
+const meterName = "github.com/online-picket-line/opl-for-dns"
+
+// Prometheus is a Recorder whose counters are served in the Prometheus
+// exposition format, for deployments that scrape metrics rather than run an
+// OTel collector. Counter names follow the Prometheus conventions, so
+// opl.dns.queries is exported as opl_dns_queries_total.
+type Prometheus struct {
+	*Recorder
+
+	handler http.Handler
+}
+
+// NewPrometheus creates a recorder backed by its own Prometheus registry,
+// so several instances can coexist in one process.
+func NewPrometheus() (*Prometheus, error) {
+	registry := prometheus.NewRegistry()
+	exporter, err := otelprom.New(otelprom.WithRegisterer(registry), otelprom.WithoutScopeInfo())
+	if err != nil {
+		return nil, fmt.Errorf("creating Prometheus exporter: %w", err)
+	}
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(exporter))
+
+	recorder, err := New(provider.Meter(meterName))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Prometheus{
+		Recorder: recorder,
+		handler:  promhttp.HandlerFor(registry, promhttp.HandlerOpts{}),
+	}, nil
+}
+
+// Handler serves the current counter values.
+func (p *Prometheus) Handler() http.Handler {
+	return p.handler
+}
@@ -0,0 +1,59 @@
+package otelstats
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/online-picket-line/opl-for-dns/pkg/stats"
+)
+
+func TestPrometheus(t *testing.T) {
+	p, err := NewPrometheus()
+	if err != nil {
+		t.Fatalf("NewPrometheus failed: %v", err)
+	}
+
+	p.RecordQuery()
+	p.RecordBlock("example.com")
+	p.RecordRateLimited("dns")
+	p.RecordRateLimited("dns")
+	p.RecordQueryType("AAAA")
+	p.RecordResponseRcode("SERVFAIL")
+	p.RecordQueryDuration(3 * time.Millisecond)
+	p.RecordUpstreamExchange(stats.UpstreamExchange{Upstream: "9.9.9.9:53", Result: stats.UpstreamSoftFailure, Duration: 20 * time.Millisecond, ConsecutiveFailures: 2})
+	p.RecordAPIFetch(stats.APIFetch{Kind: stats.FetchFull, Result: stats.FetchNotModified})
+
+	// A second instance must not conflict with the first
+	if _, err := NewPrometheus(); err != nil {
+		t.Fatalf("second NewPrometheus failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	p.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		`opl_dns_queries_total{result="forwarded"} 1`,
+		`opl_dns_queries_total{result="blocked"} 1`,
+		`opl_dns_rate_limited_total{scope="dns"} 2`,
+		`opl_api_fetches_total{kind="full",result="not_modified"} 1`,
+		`opl_api_fetch_duration_seconds_count{kind="full"} 1`,
+		`opl_api_fetch_consecutive_failures 0`,
+		`opl_dns_query_types_total{qtype="AAAA"} 1`,
+		`opl_dns_responses_total{rcode="SERVFAIL"} 1`,
+		`opl_dns_query_duration_seconds_bucket{le="0.005"} 1`,
+		`opl_dns_upstream_duration_seconds_count{upstream="9.9.9.9:53"} 1`,
+		`opl_dns_upstream_exchanges_total{result="soft_failure",upstream="9.9.9.9:53"} 1`,
+		`opl_dns_upstream_consecutive_failures{upstream="9.9.9.9:53"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
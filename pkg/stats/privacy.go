@@ -0,0 +1,56 @@
+package stats
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Privacy controls how much detail stats reports carry.
+type Privacy string
+
+const (
+	// PrivacyFull sends everything the configuration enables, with the
+	// hostname as the default instance ID.
+	PrivacyFull Privacy = "full"
+
+	// PrivacyAnonymized sends the same data as PrivacyFull, but a hash
+	// replaces the hostname as the default instance ID.
+	PrivacyAnonymized Privacy = "anonymized"
+
+	// PrivacyAggregate sends only totals: no top blocked domains and no
+	// per-client counts, and a hashed default instance ID.
+	PrivacyAggregate Privacy = "aggregate-only"
+)
+
+// ParsePrivacy parses a privacy mode. An empty string means PrivacyFull.
+func ParsePrivacy(s string) (Privacy, error) {
+	switch p := Privacy(s); p {
+	case "":
+		return PrivacyFull, nil
+	case PrivacyFull, PrivacyAnonymized, PrivacyAggregate:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown privacy mode %q", s)
+	}
+}
+
+// HidesHostname reports whether the hostname must not be sent.
+func (p Privacy) HidesHostname() bool {
+	return p == PrivacyAnonymized || p == PrivacyAggregate
+}
+
+// AnonymousInstanceID derives a stable instance ID from hostname that does
+// not reveal it.
+func AnonymousInstanceID(hostname string) string {
+	sum := sha256.Sum256([]byte("opl-dns-instance:" + hostname))
+	return "opl-dns-" + hex.EncodeToString(sum[:6])
+}
+
+// applyPrivacy removes the details p does not allow from report.
+func (p Privacy) applyPrivacy(report *StatsReport) {
+	if p == PrivacyAggregate {
+		report.TopBlockedDomains = []DomainCount{}
+		report.TopClients = nil
+	}
+}
@@ -0,0 +1,93 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReporter_Privacy(t *testing.T) {
+	tests := []struct {
+		privacy     Privacy
+		wantDomains bool
+		wantClients bool
+	}{
+		{PrivacyFull, true, true},
+		{PrivacyAnonymized, true, true},
+		{PrivacyAggregate, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.privacy), func(t *testing.T) {
+			var body string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				var raw json.RawMessage
+				json.NewDecoder(r.Body).Decode(&raw)
+				body = string(raw)
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer server.Close()
+
+			c := NewCollector(WithClientStats(ClientStatsConfig{Report: true}))
+			c.RecordBlock("scab.example")
+			c.RecordEmployerBlock("Acme", "strike-1")
+			c.RecordClientQuery(netip.MustParseAddr("192.168.1.10"), true)
+
+			reporter := NewReporter(ReporterConfig{
+				Collector: c,
+				ReportURL: server.URL,
+				Interval:  time.Minute,
+				Logger:    slog.Default(),
+				Privacy:   tt.privacy,
+			})
+			reporter.sendReport(context.Background())
+
+			var report StatsReport
+			if err := json.Unmarshal([]byte(body), &report); err != nil {
+				t.Fatalf("decoding report: %v", err)
+			}
+			if got := len(report.TopBlockedDomains) > 0; got != tt.wantDomains {
+				t.Errorf("expected top blocked domains %v, got %+v", tt.wantDomains, report.TopBlockedDomains)
+			}
+			if got := len(report.TopClients) > 0; got != tt.wantClients {
+				t.Errorf("expected top clients %v, got %+v", tt.wantClients, report.TopClients)
+			}
+			if strings.Contains(body, "scab.example") != tt.wantDomains {
+				t.Errorf("unexpected domain presence in %s", body)
+			}
+			if strings.Contains(body, "192.168.1.10") {
+				t.Errorf("client address sent in %s", body)
+			}
+			if report.QueriesBlocked != 1 || report.UniqueBlockedClients != 1 || len(report.TopBlockedEmployers) != 1 {
+				t.Errorf("expected totals in every mode, got %+v", report)
+			}
+		})
+	}
+}
+
+func TestParsePrivacy(t *testing.T) {
+	for in, want := range map[string]Privacy{"": PrivacyFull, "full": PrivacyFull, "anonymized": PrivacyAnonymized, "aggregate-only": PrivacyAggregate} {
+		if got, err := ParsePrivacy(in); err != nil || got != want {
+			t.Errorf("ParsePrivacy(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParsePrivacy("none"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+}
+
+func TestAnonymousInstanceID(t *testing.T) {
+	id := AnonymousInstanceID("dns1.union-hall.example")
+	if strings.Contains(id, "union-hall") || !strings.HasPrefix(id, "opl-dns-") {
+		t.Errorf("expected a hashed ID, got %q", id)
+	}
+	if again := AnonymousInstanceID("dns1.union-hall.example"); again != id {
+		t.Errorf("expected a stable ID, got %q and %q", id, again)
+	}
+}
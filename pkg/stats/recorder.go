@@ -0,0 +1,171 @@
+package stats
+
+import (
+	"net/netip"
+	"time"
+)
+
+// Recorder receives query events from the DNS server and fetch events from
+// the API client. Collector is the default implementation; embedders can
+// supply their own to feed a different metrics pipeline.
+type Recorder interface {
+	// RecordQuery records a query that was forwarded to upstream.
+	RecordQuery()
+	// RecordBlock records a query for a blocked domain.
+	RecordBlock(domain string)
+	// RecordEmployerBlock attributes a blocked query to employer and the
+	// labor action with actionID, which may be empty.
+	RecordEmployerBlock(employer, actionID string)
+	// RecordBypass records a bypass being issued.
+	RecordBypass()
+	// RecordQueryType records the type of a query, e.g. "A" or "HTTPS".
+	RecordQueryType(qtype string)
+	// RecordResponseRcode records the response code of an answer sent to a
+	// client.
+	RecordResponseRcode(rcode string)
+	// RecordUpstreamRcode records the response code of an upstream answer.
+	RecordUpstreamRcode(rcode string)
+	// RecordSoftFailureRetry records a query retried on another upstream
+	// after a SERVFAIL or REFUSED answer.
+	RecordSoftFailureRetry()
+	// RecordRateLimited records a request rejected by the rate limiter for
+	// scope (e.g. "dns" or "admin").
+	RecordRateLimited(scope string)
+	// RecordPanic records a query or request for scope (e.g. "dns" or
+	// "admin") whose handler panicked and was recovered.
+	RecordPanic(scope string)
+	// RecordQueryDuration records the time taken to answer a query.
+	RecordQueryDuration(d time.Duration)
+	// RecordUpstreamExchange records one query sent to an upstream
+	// resolver, whether or not it succeeded.
+	RecordUpstreamExchange(ex UpstreamExchange)
+	// RecordAPIFetch records one blocklist request to the OPL API.
+	RecordAPIFetch(fetch APIFetch)
+	// RecordClientQuery records a query from client and whether it was
+	// blocked.
+	RecordClientQuery(client netip.Addr, blocked bool)
+}
+
+var _ Recorder = (*Collector)(nil)
+
+// NopRecorder discards all events.
+type NopRecorder struct{}
+
+func (NopRecorder) RecordQuery()                            {}
+func (NopRecorder) RecordBlock(string)                      {}
+func (NopRecorder) RecordEmployerBlock(string, string)      {}
+func (NopRecorder) RecordBypass()                           {}
+func (NopRecorder) RecordQueryType(string)                  {}
+func (NopRecorder) RecordResponseRcode(string)              {}
+func (NopRecorder) RecordUpstreamRcode(string)              {}
+func (NopRecorder) RecordSoftFailureRetry()                 {}
+func (NopRecorder) RecordRateLimited(string)                {}
+func (NopRecorder) RecordPanic(string)                      {}
+func (NopRecorder) RecordQueryDuration(time.Duration)       {}
+func (NopRecorder) RecordUpstreamExchange(UpstreamExchange) {}
+func (NopRecorder) RecordAPIFetch(APIFetch)                 {}
+func (NopRecorder) RecordClientQuery(netip.Addr, bool)      {}
+
+// Multi returns a Recorder that forwards every event to each of recorders.
+// Nil recorders are skipped.
+func Multi(recorders ...Recorder) Recorder {
+	var rs multiRecorder
+	for _, r := range recorders {
+		if r != nil {
+			rs = append(rs, r)
+		}
+	}
+	switch len(rs) {
+	case 0:
+		return NopRecorder{}
+	case 1:
+		return rs[0]
+	}
+	return rs
+}
+
+type multiRecorder []Recorder
+
+func (m multiRecorder) RecordQuery() {
+	for _, r := range m {
+		r.RecordQuery()
+	}
+}
+
+func (m multiRecorder) RecordBlock(domain string) {
+	for _, r := range m {
+		r.RecordBlock(domain)
+	}
+}
+
+func (m multiRecorder) RecordEmployerBlock(employer, actionID string) {
+	for _, r := range m {
+		r.RecordEmployerBlock(employer, actionID)
+	}
+}
+
+func (m multiRecorder) RecordBypass() {
+	for _, r := range m {
+		r.RecordBypass()
+	}
+}
+
+func (m multiRecorder) RecordQueryType(qtype string) {
+	for _, r := range m {
+		r.RecordQueryType(qtype)
+	}
+}
+
+func (m multiRecorder) RecordResponseRcode(rcode string) {
+	for _, r := range m {
+		r.RecordResponseRcode(rcode)
+	}
+}
+
+func (m multiRecorder) RecordUpstreamRcode(rcode string) {
+	for _, r := range m {
+		r.RecordUpstreamRcode(rcode)
+	}
+}
+
+func (m multiRecorder) RecordSoftFailureRetry() {
+	for _, r := range m {
+		r.RecordSoftFailureRetry()
+	}
+}
+
+func (m multiRecorder) RecordRateLimited(scope string) {
+	for _, r := range m {
+		r.RecordRateLimited(scope)
+	}
+}
+
+func (m multiRecorder) RecordPanic(scope string) {
+	for _, r := range m {
+		r.RecordPanic(scope)
+	}
+}
+
+func (m multiRecorder) RecordQueryDuration(d time.Duration) {
+	for _, r := range m {
+		r.RecordQueryDuration(d)
+	}
+}
+
+func (m multiRecorder) RecordUpstreamExchange(ex UpstreamExchange) {
+	for _, r := range m {
+		r.RecordUpstreamExchange(ex)
+	}
+}
+
+func (m multiRecorder) RecordAPIFetch(fetch APIFetch) {
+	for _, r := range m {
+		r.RecordAPIFetch(fetch)
+	}
+}
+
+func (m multiRecorder) RecordClientQuery(client netip.Addr, blocked bool) {
+	for _, r := range m {
+		r.RecordClientQuery(client, blocked)
+	}
+}
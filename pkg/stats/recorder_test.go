@@ -0,0 +1,60 @@
+package stats
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMulti(t *testing.T) {
+	a, b := NewCollector(), NewCollector()
+	r := Multi(a, nil, b)
+
+	r.RecordQuery()
+	r.RecordBlock("example.com")
+	r.RecordEmployerBlock("Acme", "strike-1")
+	r.RecordBypass()
+	r.RecordUpstreamRcode("NOERROR")
+	r.RecordQueryType("AAAA")
+	r.RecordResponseRcode("NXDOMAIN")
+	r.RecordSoftFailureRetry()
+	r.RecordRateLimited("admin")
+	r.RecordQueryDuration(time.Millisecond)
+	r.RecordUpstreamExchange(UpstreamExchange{Upstream: "192.0.2.53:53", Result: UpstreamOK, Duration: time.Millisecond})
+	r.RecordAPIFetch(APIFetch{Kind: FetchFull, Result: FetchOK})
+
+	for name, c := range map[string]*Collector{"a": a, "b": b} {
+		total, blocked, forwarded, bypasses := c.Snapshot()
+		if total != 2 || blocked != 1 || forwarded != 1 || bypasses != 1 {
+			t.Errorf("%s: expected 2/1/1/1, got %d/%d/%d/%d", name, total, blocked, forwarded, bypasses)
+		}
+		if c.UpstreamRcodes()["NOERROR"] != 1 || c.SoftFailureRetries() != 1 || c.RateLimited()["admin"] != 1 {
+			t.Errorf("%s: upstream stats not forwarded", name)
+		}
+		if c.QueryTypes()["AAAA"] != 1 || c.ResponseRcodes()["NXDOMAIN"] != 1 {
+			t.Errorf("%s: query type or response rcode not forwarded", name)
+		}
+		if top := c.TopBlockedEmployers(1); len(top) != 1 || top[0].Employer != "Acme" {
+			t.Errorf("%s: employer block not forwarded", name)
+		}
+		if c.QueryLatency().Count != 1 || c.UpstreamLatency().Count != 1 {
+			t.Errorf("%s: latency not forwarded", name)
+		}
+		if c.APIFetchStats().Fetches != 1 {
+			t.Errorf("%s: API fetch not forwarded", name)
+		}
+	}
+}
+
+func TestMultiCollapses(t *testing.T) {
+	if _, ok := Multi().(NopRecorder); !ok {
+		t.Error("Expected Multi() to return NopRecorder")
+	}
+	if _, ok := Multi(nil).(NopRecorder); !ok {
+		t.Error("Expected Multi(nil) to return NopRecorder")
+	}
+
+	c := NewCollector()
+	if r := Multi(c, nil); r != Recorder(c) {
+		t.Error("Expected Multi with a single recorder to return it unwrapped")
+	}
+}
@@ -0,0 +1,196 @@
+package stats
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// SigningAlgorithm selects how stats reports are signed.
+type SigningAlgorithm string
+
+const (
+	// SigningHMAC signs with HMAC-SHA256 and a secret shared with the
+	// backend.
+	SigningHMAC SigningAlgorithm = "hmac-sha256"
+
+	// SigningEd25519 signs with an Ed25519 private key whose public key is
+	// registered with the backend.
+	SigningEd25519 SigningAlgorithm = "ed25519"
+)
+
+// Headers carrying a report signature.
+const (
+	HeaderSignature = "X-OPL-Signature"
+	HeaderTimestamp = "X-OPL-Timestamp"
+	HeaderNonce     = "X-OPL-Nonce"
+	HeaderKeyID     = "X-OPL-Key-ID"
+)
+
+// signatureVersion prefixes every signed payload so the format can change
+// without old signatures verifying under a new scheme.
+const signatureVersion = "opl-stats-v1"
+
+// minHMACKeyLen is the shortest accepted HMAC secret, in bytes.
+const minHMACKeyLen = 32
+
+// ReportSigner signs stats reports so the backend can tell which instance
+// sent them and reject replays. Each report carries a timestamp and a random
+// nonce, which are signed together with the body.
+type ReportSigner struct {
+	algorithm  SigningAlgorithm
+	hmacKey    []byte
+	privateKey ed25519.PrivateKey
+	keyID      string
+	now        func() time.Time
+}
+
+// NewHMACSigner signs with HMAC-SHA256 using secret, which must be at least
+// 32 bytes.
+func NewHMACSigner(secret []byte) (*ReportSigner, error) {
+	if len(secret) < minHMACKeyLen {
+		return nil, fmt.Errorf("HMAC signing secret must be at least %d bytes", minHMACKeyLen)
+	}
+	return &ReportSigner{algorithm: SigningHMAC, hmacKey: secret, now: time.Now}, nil
+}
+
+// NewEd25519Signer signs with key. Reports carry the ID of its public key
+// (see KeyID) so the backend can look it up.
+func NewEd25519Signer(key ed25519.PrivateKey) *ReportSigner {
+	return &ReportSigner{
+		algorithm:  SigningEd25519,
+		privateKey: key,
+		keyID:      KeyID(key.Public().(ed25519.PublicKey)),
+		now:        time.Now,
+	}
+}
+
+// LoadReportSigner reads a signing key from path. For SigningHMAC the file
+// holds the secret, with surrounding whitespace ignored; for SigningEd25519
+// it holds a PEM-encoded PKCS #8 private key, as written by
+// GenerateSigningKey or "openssl genpkey -algorithm ed25519".
+func LoadReportSigner(algorithm SigningAlgorithm, path string) (*ReportSigner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading signing key: %w", err)
+	}
+
+	switch algorithm {
+	case SigningHMAC:
+		return NewHMACSigner(bytes.TrimSpace(data))
+	case SigningEd25519:
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "PRIVATE KEY" {
+			return nil, fmt.Errorf("signing key %s is not a PEM private key", path)
+		}
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing signing key: %w", err)
+		}
+		edKey, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("signing key %s is not an Ed25519 key", path)
+		}
+		return NewEd25519Signer(edKey), nil
+	default:
+		return nil, fmt.Errorf("unknown signing algorithm %q", algorithm)
+	}
+}
+
+// GenerateSigningKey writes a new Ed25519 private key to path, readable only
+// by its owner, and returns the PEM-encoded public key to register with the
+// backend. It refuses to overwrite an existing file.
+func GenerateSigningKey(path string) (publicPEM []byte, err error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	if err := pem.Encode(f, &pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), nil
+}
+
+// PublicKeyPEM returns the PEM-encoded public key of an Ed25519 signer.
+func (s *ReportSigner) PublicKeyPEM() ([]byte, error) {
+	if s.algorithm != SigningEd25519 {
+		return nil, fmt.Errorf("%s signers have no public key", s.algorithm)
+	}
+	der, err := x509.MarshalPKIXPublicKey(s.privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// KeyID identifies an Ed25519 public key: the first 8 bytes of its SHA-256
+// hash, in hex.
+func KeyID(key ed25519.PublicKey) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:8])
+}
+
+// SignaturePayload returns the bytes that are signed for a report body sent
+// with the given timestamp and nonce headers. Verifiers rebuild it from the
+// request to check the signature.
+func SignaturePayload(timestamp, nonce string, body []byte) []byte {
+	payload := make([]byte, 0, len(signatureVersion)+len(timestamp)+len(nonce)+len(body)+3)
+	payload = append(payload, signatureVersion+"\n"+timestamp+"\n"+nonce+"\n"...)
+	return append(payload, body...)
+}
+
+// sign sets the signature headers on req for body. The signature header is
+// "<algorithm>=<base64 signature>".
+func (s *ReportSigner) sign(req *http.Request, body []byte) error {
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return err
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+	payload := SignaturePayload(timestamp, nonce, body)
+
+	var signature []byte
+	switch s.algorithm {
+	case SigningHMAC:
+		mac := hmac.New(sha256.New, s.hmacKey)
+		mac.Write(payload)
+		signature = mac.Sum(nil)
+	case SigningEd25519:
+		signature = ed25519.Sign(s.privateKey, payload)
+		req.Header.Set(HeaderKeyID, s.keyID)
+	}
+
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, string(s.algorithm)+"="+base64.StdEncoding.EncodeToString(signature))
+	return nil
+}
@@ -0,0 +1,160 @@
+package stats
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sendSigned sends one report signed by signer and returns the request the
+// backend received, with its body.
+func sendSigned(t *testing.T, signer *ReportSigner) (*http.Request, []byte) {
+	t.Helper()
+
+	var req *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	reporter := NewReporter(ReporterConfig{
+		Collector:  NewCollector(),
+		InstanceID: "test-instance",
+		ReportURL:  server.URL,
+		Interval:   time.Minute,
+		Signer:     signer,
+		Logger:     slog.New(slog.DiscardHandler),
+	})
+	reporter.sendReport(context.Background())
+	if req == nil {
+		t.Fatal("No report received")
+	}
+	return req, body
+}
+
+// decodeSignature splits a signature header into its algorithm and bytes.
+func decodeSignature(t *testing.T, header string) (SigningAlgorithm, []byte) {
+	t.Helper()
+	algorithm, encoded, ok := strings.Cut(header, "=")
+	if !ok {
+		t.Fatalf("Malformed signature header %q", header)
+	}
+	signature, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("Decoding signature: %v", err)
+	}
+	return SigningAlgorithm(algorithm), signature
+}
+
+func TestReporter_SignsWithHMAC(t *testing.T) {
+	secret := []byte(strings.Repeat("s", 32))
+	signer, err := NewHMACSigner(secret)
+	if err != nil {
+		t.Fatalf("NewHMACSigner failed: %v", err)
+	}
+	signer.now = func() time.Time { return time.Unix(1767225600, 0) }
+
+	req, body := sendSigned(t, signer)
+	if got := req.Header.Get(HeaderTimestamp); got != "1767225600" {
+		t.Errorf("Timestamp = %q", got)
+	}
+	nonce := req.Header.Get(HeaderNonce)
+	if len(nonce) != 32 {
+		t.Errorf("Expected a 128-bit hex nonce, got %q", nonce)
+	}
+	if req.Header.Get(HeaderKeyID) != "" {
+		t.Error("Expected no key ID for HMAC signatures")
+	}
+
+	algorithm, signature := decodeSignature(t, req.Header.Get(HeaderSignature))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(SignaturePayload("1767225600", nonce, body))
+	if algorithm != SigningHMAC || !hmac.Equal(signature, mac.Sum(nil)) {
+		t.Error("HMAC signature does not verify")
+	}
+
+	// A second report gets a fresh nonce so replays can be told apart
+	if req2, _ := sendSigned(t, signer); req2.Header.Get(HeaderNonce) == nonce {
+		t.Error("Expected a new nonce for every report")
+	}
+}
+
+func TestReporter_SignsWithEd25519(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "signing.key")
+	publicPEM, err := GenerateSigningKey(path)
+	if err != nil {
+		t.Fatalf("GenerateSigningKey failed: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected a private key file with mode 0600, got %v, %v", info.Mode(), err)
+	}
+	if _, err := GenerateSigningKey(path); err == nil {
+		t.Error("Expected GenerateSigningKey to refuse to overwrite a key")
+	}
+
+	block, _ := pem.Decode(publicPEM)
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("Parsing public key: %v", err)
+	}
+	public := parsed.(ed25519.PublicKey)
+
+	signer, err := LoadReportSigner(SigningEd25519, path)
+	if err != nil {
+		t.Fatalf("LoadReportSigner failed: %v", err)
+	}
+	req, body := sendSigned(t, signer)
+
+	if got := req.Header.Get(HeaderKeyID); got != KeyID(public) {
+		t.Errorf("Key ID = %q, want %q", got, KeyID(public))
+	}
+	algorithm, signature := decodeSignature(t, req.Header.Get(HeaderSignature))
+	payload := SignaturePayload(req.Header.Get(HeaderTimestamp), req.Header.Get(HeaderNonce), body)
+	if algorithm != SigningEd25519 || !ed25519.Verify(public, payload, signature) {
+		t.Error("Ed25519 signature does not verify")
+	}
+	if ed25519.Verify(public, SignaturePayload(req.Header.Get(HeaderTimestamp), "other-nonce", body), signature) {
+		t.Error("Expected the signature to cover the nonce")
+	}
+}
+
+func TestLoadReportSigner(t *testing.T) {
+	dir := t.TempDir()
+	short := filepath.Join(dir, "short")
+	os.WriteFile(short, []byte("too-short\n"), 0o600)
+	if _, err := LoadReportSigner(SigningHMAC, short); err == nil {
+		t.Error("Expected a short HMAC secret to be rejected")
+	}
+
+	secret := filepath.Join(dir, "secret")
+	os.WriteFile(secret, []byte(strings.Repeat("k", 40)+"\n"), 0o600)
+	signer, err := LoadReportSigner(SigningHMAC, secret)
+	if err != nil {
+		t.Fatalf("LoadReportSigner failed: %v", err)
+	}
+	if string(signer.hmacKey) != strings.Repeat("k", 40) {
+		t.Error("Expected surrounding whitespace to be trimmed from the secret")
+	}
+
+	if _, err := LoadReportSigner(SigningEd25519, secret); err == nil {
+		t.Error("Expected a non-PEM file to be rejected as an Ed25519 key")
+	}
+	if _, err := LoadReportSigner(SigningEd25519, filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected a missing key file to be an error")
+	}
+}
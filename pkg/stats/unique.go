@@ -0,0 +1,100 @@
+package stats
+
+import (
+	"hash/maphash"
+	"math"
+	"math/bits"
+	"net/netip"
+	"sync/atomic"
+)
+
+// HyperLogLog layout: 2^12 registers give a standard error of about 1.6%.
+const (
+	hllPrecision = 12
+	hllRegisters = 1 << hllPrecision
+)
+
+// hyperLogLog estimates the number of distinct values added to it. It holds
+// only register maxima, never the values themselves, so client addresses
+// cannot be recovered from it. It is safe for concurrent use without locks.
+type hyperLogLog struct {
+	registers [hllRegisters]atomic.Uint32
+}
+
+func (h *hyperLogLog) add(hash uint64) {
+	index := hash >> (64 - hllPrecision)
+	rank := uint32(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	r := &h.registers[index]
+	for {
+		cur := r.Load()
+		if rank <= cur || r.CompareAndSwap(cur, rank) {
+			return
+		}
+	}
+}
+
+// estimate returns the approximate number of distinct values added.
+func (h *hyperLogLog) estimate() int64 {
+	const m = float64(hllRegisters)
+	alpha := 0.7213 / (1 + 1.079/m)
+
+	var sum float64
+	zeros := 0
+	for i := range h.registers {
+		rank := h.registers[i].Load()
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		// Linear counting is more accurate for small cardinalities
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int64(math.Round(estimate))
+}
+
+// uniqueClients estimates distinct clients, and distinct clients with a
+// blocked query, since the last reset.
+type uniqueClients struct {
+	seed    maphash.Seed
+	all     atomic.Pointer[hyperLogLog]
+	blocked atomic.Pointer[hyperLogLog]
+}
+
+func newUniqueClients() *uniqueClients {
+	u := &uniqueClients{seed: maphash.MakeSeed()}
+	u.all.Store(new(hyperLogLog))
+	u.blocked.Store(new(hyperLogLog))
+	return u
+}
+
+func (u *uniqueClients) record(client netip.Addr, blocked bool) {
+	addr := client.As16()
+	hash := maphash.Bytes(u.seed, addr[:])
+	u.all.Load().add(hash)
+	if blocked {
+		u.blocked.Load().add(hash)
+	}
+}
+
+// estimates returns the current estimates without resetting them.
+func (u *uniqueClients) estimates() (all, blocked int64) {
+	return u.all.Load().estimate(), u.blocked.Load().estimate()
+}
+
+// reset returns the estimates and starts counting afresh. Queries recorded
+// while the sketches are swapped may land in either interval.
+func (u *uniqueClients) reset() (all, blocked int64) {
+	return u.all.Swap(new(hyperLogLog)).estimate(), u.blocked.Swap(new(hyperLogLog)).estimate()
+}
+
+// UniqueClients estimates how many distinct clients have sent queries, and
+// how many have had a query blocked, since the last stats report (or since
+// the collector was created). The estimates are accurate to within a few
+// percent.
+func (c *Collector) UniqueClients() (all, blocked int64) {
+	return c.unique.estimates()
+}
@@ -0,0 +1,51 @@
+package stats
+
+import (
+	"math"
+	"net/netip"
+	"testing"
+)
+
+func TestUniqueClientsEstimate(t *testing.T) {
+	u := newUniqueClients()
+
+	// 50,000 distinct IPv4 clients, each sending several queries, plus the
+	// IPv4-mapped form of some of them, which must not count twice
+	base := netip.MustParseAddr("10.0.0.0").As4()
+	for i := range 50000 {
+		a := base
+		a[1], a[2], a[3] = byte(i>>16), byte(i>>8), byte(i)
+		addr := netip.AddrFrom4(a)
+		for range 3 {
+			u.record(addr, i%10 == 0)
+		}
+		if i%7 == 0 {
+			u.record(netip.AddrFrom16(addr.As16()), false)
+		}
+	}
+
+	all, blocked := u.estimates()
+	if err := math.Abs(float64(all)-50000) / 50000; err > 0.05 {
+		t.Errorf("expected about 50000 clients, got %d", all)
+	}
+	if err := math.Abs(float64(blocked)-5000) / 5000; err > 0.05 {
+		t.Errorf("expected about 5000 blocked clients, got %d", blocked)
+	}
+
+	if all, _ := u.reset(); all == 0 {
+		t.Error("expected reset to return the estimate")
+	}
+	if all, blocked := u.estimates(); all != 0 || blocked != 0 {
+		t.Errorf("expected zero after reset, got %d and %d", all, blocked)
+	}
+}
+
+func TestUniqueClientsSmall(t *testing.T) {
+	u := newUniqueClients()
+	for _, s := range []string{"192.168.1.10", "192.168.1.11", "2001:db8::1", "192.168.1.10"} {
+		u.record(netip.MustParseAddr(s), false)
+	}
+	if all, _ := u.estimates(); all != 3 {
+		t.Errorf("expected exactly 3 clients at small counts, got %d", all)
+	}
+}
@@ -0,0 +1,33 @@
+package stats
+
+import "time"
+
+// Upstream exchange results.
+const (
+	// UpstreamOK is any answer other than SERVFAIL or REFUSED.
+	UpstreamOK = "ok"
+	// UpstreamSoftFailure is a SERVFAIL or REFUSED answer.
+	UpstreamSoftFailure = "soft_failure"
+	// UpstreamError is a network error or timeout.
+	UpstreamError = "error"
+)
+
+// UpstreamExchange describes one query sent to an upstream resolver.
+type UpstreamExchange struct {
+	// Upstream is the resolver address, or the ODoH target.
+	Upstream string
+	// Result is one of the Upstream* result constants.
+	Result string
+	// Duration is the time taken by the exchange.
+	Duration time.Duration
+	// ConsecutiveFailures counts failed exchanges with this upstream in a
+	// row, including this one; 0 after a success.
+	ConsecutiveFailures int
+}
+
+// RecordUpstreamExchange records the time taken by one upstream exchange.
+// Per-upstream counts are left to the DNS server's health report and the
+// metrics recorders.
+func (c *Collector) RecordUpstreamExchange(ex UpstreamExchange) {
+	c.upstreamLatency.record(ex.Duration)
+}